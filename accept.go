@@ -0,0 +1,46 @@
+package webfetch
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// DefaultAccept is the Accept header of requests without FetchOptions.Accept,
+// preferring the documents Fetch converts
+const DefaultAccept = "text/html,application/xhtml+xml,application/pdf"
+
+// acceptHeader returns the Accept header preferring types in order, each type
+// after the first getting a lower quality value, down to 0.1
+func acceptHeader(types []string) string {
+	if len(types) == 0 {
+		return DefaultAccept
+	}
+	parts := make([]string, len(types))
+	for i, t := range types {
+		q := max(10-i, 1)
+		if q == 10 {
+			parts[i] = t
+			continue
+		}
+		parts[i] = fmt.Sprintf("%s;q=0.%d", t, q)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// acceptsMediaType reports whether the media type of contentType is one of
+// types, or of a major type such as text/* among them
+func acceptsMediaType(types []string, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	major, _, _ := strings.Cut(mediaType, "/")
+	for _, t := range types {
+		t = strings.ToLower(t)
+		if t == mediaType || t == "*/*" || t == major+"/*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package webfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_acceptHeader(t *testing.T) {
+	tests := []struct {
+		types    []string
+		expected string
+	}{
+		{expected: DefaultAccept},
+		{types: []string{"application/json"}, expected: "application/json"},
+		{types: []string{"application/json", "text/html", "*/*"}, expected: "application/json, text/html;q=0.9, */*;q=0.8"},
+		{
+			types:    []string{"a/1", "a/2", "a/3", "a/4", "a/5", "a/6", "a/7", "a/8", "a/9", "a/10", "a/11"},
+			expected: "a/1, a/2;q=0.9, a/3;q=0.8, a/4;q=0.7, a/5;q=0.6, a/6;q=0.5, a/7;q=0.4, a/8;q=0.3, a/9;q=0.2, a/10;q=0.1, a/11;q=0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := acceptHeader(tt.types); got != tt.expected {
+			t.Errorf("expected %q for %v, got %q", tt.expected, tt.types, got)
+		}
+	}
+}
+
+func Test_acceptsMediaType(t *testing.T) {
+	tests := []struct {
+		types       []string
+		contentType string
+		expected    bool
+	}{
+		{types: []string{"application/json"}, contentType: "application/json; charset=utf-8", expected: true},
+		{types: []string{"Text/*"}, contentType: "text/markdown", expected: true},
+		{types: []string{"*/*"}, contentType: "text/plain", expected: true},
+		{types: []string{"text/*"}, contentType: "application/json"},
+		{contentType: "application/json"},
+	}
+
+	for _, tt := range tests {
+		if got := acceptsMediaType(tt.types, tt.contentType); got != tt.expected {
+			t.Errorf("expected %t for %q in %v, got %t", tt.expected, tt.contentType, tt.types, got)
+		}
+	}
+}
+
+func TestFetch_Accept(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Negotiates JSON for clients preferring it
+		if strings.HasPrefix(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"name":"webfetch"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<h1>webfetch</h1>"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		accept   []string
+		expected string
+	}{
+		{name: "default", expected: "# webfetch"},
+		{name: "json", accept: []string{"application/json", "text/html"}, expected: `{"name":"webfetch"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Fetch(context.Background(), server.URL, FetchOptions{Timeout: 5 * time.Second, Accept: tt.accept})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.TrimSpace(doc.Content) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, doc.Content)
+			}
+		})
+	}
+
+	// Types that are not preferred are refused
+	_, err := Fetch(context.Background(), server.URL, FetchOptions{
+		Timeout: 5 * time.Second,
+		Headers: map[string]string{"Accept": "application/json"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "unsupported content type") {
+		t.Errorf("expected an unsupported content type error, got %v", err)
+	}
+}
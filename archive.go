@@ -0,0 +1,253 @@
+package webfetch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultWaybackEndpoint is the base URL of the Wayback Machine.
+const DefaultWaybackEndpoint = "https://web.archive.org"
+
+// defaultArchivePollInterval is the time between status checks of Save Page
+// Now 2 captures
+const defaultArchivePollInterval = 2 * time.Second
+
+// ArchiveOptions configures Archive.
+type ArchiveOptions struct {
+	// FetchOptions sets the user agent, timeout and request limiter of the
+	// requests to the archive. AllowURL and AllowIP are not applied, as the
+	// requests go to Endpoint rather than to the archived URL.
+	FetchOptions
+
+	// Endpoint is the base URL of the Wayback Machine (default
+	// DefaultWaybackEndpoint).
+	Endpoint string
+	// AccessKey and SecretKey are the S3-like API keys of an archive.org
+	// account. With keys, captures use the Save Page Now 2 API, which reports
+	// failures and is less rate limited; without, the anonymous form.
+	AccessKey string
+	SecretKey string
+	// PollInterval is the time between status checks of Save Page Now 2
+	// captures (default 2s).
+	PollInterval time.Duration
+}
+
+// Snapshot is a capture of a page by the Wayback Machine.
+type Snapshot struct {
+	// URL is the URL of the snapshot, e.g.
+	// https://web.archive.org/web/20260301120000/https://example.com/.
+	URL string `json:"snapshot_url"`
+	// OriginalURL is the archived URL.
+	OriginalURL string `json:"original_url"`
+	// Timestamp is the time of the capture.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ArchiveError is returned by Archive when the Wayback Machine refuses or
+// fails to capture a page.
+type ArchiveError struct {
+	// StatusCode is the HTTP status code of the response, if the request failed.
+	StatusCode int
+	// Message describes the failure.
+	Message string
+}
+
+func (e *ArchiveError) Error() string {
+	if e.StatusCode == http.StatusTooManyRequests {
+		return "archive failed: rate limited by the Wayback Machine, retry later"
+	}
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("archive failed: unexpected status code: %d", e.StatusCode)
+	}
+	return "archive failed: " + e.Message
+}
+
+// snapshotPath matches the path of a snapshot: /web/<timestamp>/<url>
+var snapshotPath = regexp.MustCompile(`^/web/(\d{14})/(.+)$`)
+
+// Archive asks the Wayback Machine to capture rawURL with Save Page Now, and
+// returns the snapshot. Captures take from a few seconds to a minute, so
+// opts.Timeout should allow for it.
+func Archive(ctx context.Context, rawURL string, opts ArchiveOptions) (*Snapshot, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return nil, fmt.Errorf("invalid URL: only absolute http and https URLs can be archived")
+	}
+	// Archived URLs are public, so credentials are never sent
+	if parsedURL.User != nil {
+		return nil, fmt.Errorf("invalid URL: URLs with credentials cannot be archived")
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = DefaultWaybackEndpoint
+	}
+	opts.Endpoint = strings.TrimSuffix(opts.Endpoint, "/")
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+		// The deadline covers the whole capture, including status checks
+		opts.Timeout = 0
+	}
+	opts.AllowURL = nil
+	opts.AllowIP = nil
+	client := newClient(opts.FetchOptions)
+
+	if opts.AccessKey != "" {
+		return archiveWithKeys(ctx, client, rawURL, opts)
+	}
+
+	// The anonymous form redirects to the snapshot, or names it in
+	// Content-Location
+	req, err := newArchiveRequest(ctx, http.MethodGet, opts.Endpoint+"/save/"+rawURL, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the Wayback Machine: %w", err)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &ArchiveError{StatusCode: resp.StatusCode}
+	}
+	if snapshot := parseSnapshot(opts.Endpoint, pathAndQuery(resp.Request.URL)); snapshot != nil {
+		return snapshot, nil
+	}
+	if location, err := resp.Request.URL.Parse(resp.Header.Get("Content-Location")); err == nil {
+		if snapshot := parseSnapshot(opts.Endpoint, pathAndQuery(location)); snapshot != nil {
+			return snapshot, nil
+		}
+	}
+	return nil, &ArchiveError{Message: "no snapshot in the response of the Wayback Machine"}
+}
+
+// spnStatus is a response of the Save Page Now 2 API
+type spnStatus struct {
+	JobID       string `json:"job_id"`
+	Status      string `json:"status"`
+	Message     string `json:"message"`
+	Timestamp   string `json:"timestamp"`
+	OriginalURL string `json:"original_url"`
+}
+
+// archiveWithKeys captures rawURL with the Save Page Now 2 API: it submits a
+// capture job, then checks its status until it completes
+func archiveWithKeys(ctx context.Context, client *http.Client, rawURL string, opts ArchiveOptions) (*Snapshot, error) {
+	form := url.Values{"url": {rawURL}}
+	req, err := newArchiveRequest(ctx, http.MethodPost, opts.Endpoint+"/save", strings.NewReader(form.Encode()), opts)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	job, err := doSPN(client, req)
+	if err != nil {
+		return nil, err
+	}
+	if job.JobID == "" {
+		return nil, &ArchiveError{Message: job.Message}
+	}
+
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = defaultArchivePollInterval
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("archive failed: capture still in progress: %w", ctx.Err())
+		case <-time.After(interval):
+		}
+		req, err := newArchiveRequest(ctx, http.MethodGet, opts.Endpoint+"/save/status/"+url.PathEscape(job.JobID), nil, opts)
+		if err != nil {
+			return nil, err
+		}
+		status, err := doSPN(client, req)
+		if err != nil {
+			return nil, err
+		}
+		switch status.Status {
+		case "pending":
+			continue
+		case "success":
+			original := status.OriginalURL
+			if original == "" {
+				original = rawURL
+			}
+			if snapshot := parseSnapshot(opts.Endpoint, "/web/"+status.Timestamp+"/"+original); snapshot != nil {
+				return snapshot, nil
+			}
+			return nil, &ArchiveError{Message: "invalid snapshot timestamp " + status.Timestamp}
+		default:
+			return nil, &ArchiveError{Message: status.Message}
+		}
+	}
+}
+
+// newArchiveRequest creates a request to the Wayback Machine, authenticated
+// with the keys of opts, if any
+func newArchiveRequest(ctx context.Context, method, rawURL string, body io.Reader, opts ArchiveOptions) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent(opts.FetchOptions))
+	if opts.RequestID != "" {
+		req.Header.Set("X-Request-Id", opts.RequestID)
+	}
+	if opts.AccessKey != "" {
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "LOW "+opts.AccessKey+":"+opts.SecretKey)
+	}
+	return req, nil
+}
+
+// doSPN sends a request of the Save Page Now 2 API and decodes its response
+func doSPN(client *http.Client, req *http.Request) (*spnStatus, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the Wayback Machine: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &ArchiveError{StatusCode: resp.StatusCode}
+	}
+	var status spnStatus
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&status); err != nil {
+		return nil, fmt.Errorf("archive failed: invalid response: %w", err)
+	}
+	return &status, nil
+}
+
+// pathAndQuery returns the path of u followed by its query, which belongs to
+// the archived URL in snapshot URLs
+func pathAndQuery(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+	return u.Path + "?" + u.RawQuery
+}
+
+// parseSnapshot returns the snapshot whose path on endpoint is path, or nil if
+// path is not the path of a snapshot
+func parseSnapshot(endpoint, path string) *Snapshot {
+	m := snapshotPath.FindStringSubmatch(path)
+	if m == nil {
+		return nil
+	}
+	timestamp, err := time.Parse("20060102150405", m[1])
+	if err != nil {
+		return nil
+	}
+	return &Snapshot{URL: endpoint + path, OriginalURL: m[2], Timestamp: timestamp}
+}
@@ -0,0 +1,82 @@
+package webfetch
+
+import (
+	"slices"
+	"unicode"
+)
+
+// rtlScripts are the scripts written right to left
+var rtlScripts = []*unicode.RangeTable{unicode.Arabic, unicode.Hebrew, unicode.Syriac, unicode.Thaana, unicode.Nko}
+
+// mirrored maps the brackets that are mirrored in right-to-left text
+var mirrored = map[rune]rune{'(': ')', ')': '(', '[': ']', ']': '[', '{': '}', '}': '{', '<': '>', '>': '<'}
+
+// isRTL reports whether r is a strong right-to-left character
+func isRTL(r rune) bool {
+	return unicode.In(r, rtlScripts...)
+}
+
+// isLTR reports whether r is a strong left-to-right character. Digits count as
+// left to right, since numbers are read left to right in any script.
+func isLTR(r rune) bool {
+	return (unicode.IsLetter(r) || unicode.IsDigit(r)) && !isRTL(r)
+}
+
+// logicalOrder converts a line of text in visual order, left to right, into
+// reading order. This is a simplified form of the Unicode bidirectional
+// algorithm: the base direction is that of the majority of letters,
+// and neutral characters take the direction of the run surrounding them.
+func logicalOrder(visual string) string {
+	runes := []rune(visual)
+	rtl, ltr := 0, 0
+	for _, r := range runes {
+		switch {
+		case isRTL(r):
+			rtl++
+		case isLTR(r) && unicode.IsLetter(r):
+			ltr++
+		}
+	}
+
+	if rtl > ltr {
+		// Read right to left, then restore the embedded left-to-right runs
+		slices.Reverse(runes)
+		mirror(runes)
+		reverseRuns(runes, isLTR)
+	} else {
+		reverseRuns(runes, isRTL)
+	}
+	return string(runes)
+}
+
+// reverseRuns reverses and mirrors each maximal run of runes starting and ending
+// with a strong character for which strong returns true, neutral characters
+// included
+func reverseRuns(runes []rune, strong func(rune) bool) {
+	for i := 0; i < len(runes); i++ {
+		if !strong(runes[i]) {
+			continue
+		}
+		end := i
+		for j := i + 1; j < len(runes); j++ {
+			if strong(runes[j]) {
+				end = j
+			} else if isRTL(runes[j]) || isLTR(runes[j]) {
+				break
+			}
+		}
+		run := runes[i : end+1]
+		slices.Reverse(run)
+		mirror(run)
+		i = end
+	}
+}
+
+// mirror swaps the brackets of runes
+func mirror(runes []rune) {
+	for i, r := range runes {
+		if m, ok := mirrored[r]; ok {
+			runes[i] = m
+		}
+	}
+}
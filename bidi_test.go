@@ -0,0 +1,54 @@
+package webfetch
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ledongthuc/pdf"
+)
+
+func Test_logicalOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		visual   string
+		expected string
+	}{
+		{name: "latin", visual: "Hello (world)", expected: "Hello (world)"},
+		{name: "hebrew", visual: "םלוע םולש", expected: "שלום עולם"},
+		{name: "arabic with number", visual: "2024 ماع", expected: "عام 2024"},
+		{name: "hebrew with latin", visual: "PDF ץבוק", expected: "קובץ PDF"},
+		{name: "hebrew parentheses", visual: "(ןחבמ) ךמסמ", expected: "מסמך (מבחן)"},
+		{name: "latin with hebrew word", visual: "the word םולש means peace", expected: "the word שלום means peace"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := logicalOrder(tt.visual); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func Test_writePageText_RTL(t *testing.T) {
+	// Glyphs of "שלום עולם" drawn right to left, as PDF producers emit them
+	var texts []pdf.Text
+	x := 100.0
+	for _, r := range "שלום" {
+		x -= 6
+		texts = append(texts, pdf.Text{S: string(r), X: x, Y: 700, W: 6, FontSize: 12})
+	}
+	x -= 4
+	for _, r := range "עולם" {
+		x -= 6
+		texts = append(texts, pdf.Text{S: string(r), X: x, Y: 700, W: 6, FontSize: 12})
+	}
+	texts = append(texts, pdf.Text{S: "Next", X: 10, Y: 680, W: 24, FontSize: 12})
+
+	var buf bytes.Buffer
+	writePageText(texts, &buf)
+	expected := "שלום עולם\nNext"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
@@ -0,0 +1,642 @@
+package webfetch
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStore is the storage of a Cache: values stored under keys until they
+// expire. Implementations must be safe for concurrent use.
+type CacheStore interface {
+	// Get returns the value stored under key, if any.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key, to be removed after ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes the value stored under key, if any.
+	Delete(ctx context.Context, key string) error
+	// Keys returns the keys of the stored values.
+	Keys(ctx context.Context) ([]string, error)
+}
+
+// Cache is a cache of fetched documents, kept in a CacheStore. It is safe for
+// concurrent use. Store errors are treated as cache misses.
+//
+// As a shared HTTP cache, it honors the Cache-Control and Expires headers of
+// responses: responses marked no-store, no-cache or private are not cached,
+// and entries expire after the lifetime declared with s-maxage, max-age or
+// Expires, or else after the time-to-live of the cache.
+type Cache struct {
+	ttl   time.Duration
+	store CacheStore
+
+	// minTTL and maxTTL bound declared lifetimes when positive
+	minTTL time.Duration
+	maxTTL time.Duration
+
+	// maxEntrySize is the maximum encoded size of a stored entry and its content
+	// when positive
+	maxEntrySize int
+
+	// staleTTL is how long entries are served after they expire, while they
+	// are refreshed
+	staleTTL time.Duration
+	// refreshing holds the keys of the entries being refreshed
+	refreshing *refreshSet
+	// revalidateTTL is how long entries with validators are kept after they
+	// expire, to be revalidated with conditional requests
+	revalidateTTL time.Duration
+
+	// scope prefixes the keys of the entries visible through the cache
+	scope string
+
+	// now returns the current time; replaced in tests
+	now func() time.Time
+}
+
+// cacheEntry is a cached document together with the canonical URL it was fetched from
+type cacheEntry struct {
+	URL       string    `json:"url"`
+	Doc       Document  `json:"doc"`
+	Raw       bool      `json:"raw,omitempty"`
+	StoredAt  time.Time `json:"stored_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// StaleUntil is when the entry stops being served stale, if it may be
+	StaleUntil time.Time `json:"stale_until,omitempty"`
+	// ContentKey is the key of the cacheContent holding the content of Doc,
+	// which is then stored empty
+	ContentKey string `json:"content_key,omitempty"`
+	// ETag and LastModified are the validators of the response, and
+	// RevalidateUntil is when the entry stops being revalidated once expired
+	ETag            string    `json:"etag,omitempty"`
+	LastModified    string    `json:"last_modified,omitempty"`
+	RevalidateUntil time.Time `json:"revalidate_until,omitzero"`
+}
+
+// cacheContent is a document content stored once for every URL serving it,
+// with the first URL it was fetched from
+type cacheContent struct {
+	URL     string `json:"url"`
+	Content string `json:"content"`
+}
+
+// contentKeyPrefix starts the keys of cacheContent values, followed by the
+// scope of the cache and the hash of the content
+const contentKeyPrefix = "content:"
+
+// CacheEntry describes a cached document.
+type CacheEntry struct {
+	// URL is the canonical URL of the cached document.
+	URL string
+	// Size is the size of the cached content in bytes.
+	Size int
+	// StoredAt is when the document was fetched.
+	StoredAt time.Time
+	// ExpiresAt is when the entry stops being served.
+	ExpiresAt time.Time
+}
+
+// NewCache creates an in-memory cache whose entries expire after ttl, unless
+// their response declares another lifetime.
+func NewCache(ttl time.Duration) *Cache {
+	return NewCacheWithStore(ttl, NewMemoryStore())
+}
+
+// NewCacheWithStore creates a cache whose entries expire after ttl, unless their
+// response declares another lifetime, kept in store.
+// Caches sharing a store, e.g. in several processes with a RedisStore, share
+// their entries.
+func NewCacheWithStore(ttl time.Duration, store CacheStore) *Cache {
+	return &Cache{
+		ttl:        ttl,
+		store:      store,
+		refreshing: &refreshSet{keys: make(map[string]bool)},
+		now:        time.Now,
+	}
+}
+
+// refreshSet is a set of keys safe for concurrent use
+type refreshSet struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+// SetTTLBounds bounds the lifetimes declared by responses to at least minTTL and
+// at most maxTTL, ignoring non-positive bounds. It must be called before the
+// cache is used. Responses that must not be cached are never stored.
+func (c *Cache) SetTTLBounds(minTTL, maxTTL time.Duration) {
+	c.minTTL = minTTL
+	c.maxTTL = maxTTL
+}
+
+// SetMaxEntrySize prevents storing documents whose encoded entry is larger than
+// size bytes, ignoring non-positive sizes. It must be called before the cache
+// is used.
+func (c *Cache) SetMaxEntrySize(size int) {
+	c.maxEntrySize = size
+}
+
+// SetStaleWhileRevalidate makes the cache serve entries for up to stale after
+// they expire, marked with Document.Stale, while Fetch refreshes them in the
+// background. Responses with Cache-Control must-revalidate, proxy-revalidate
+// or s-maxage are not served stale. It must be called before the cache is used.
+func (c *Cache) SetStaleWhileRevalidate(stale time.Duration) {
+	c.staleTTL = stale
+}
+
+// SetRevalidation keeps the entries of responses with an ETag or
+// Last-Modified header for window after they expire. Fetch then revalidates
+// them with a conditional request, and a 304 Not Modified response renews
+// the entry without downloading and converting the document again. Responses
+// marked no-cache are stored too, and revalidated on each use. It must be
+// called before the cache is used.
+func (c *Cache) SetRevalidation(window time.Duration) {
+	c.revalidateTTL = window
+}
+
+// startRefresh reports whether the caller should refresh the entry under key,
+// which is then marked as being refreshed until endRefresh.
+func (c *Cache) startRefresh(key string) bool {
+	c.refreshing.mu.Lock()
+	defer c.refreshing.mu.Unlock()
+
+	if c.refreshing.keys[c.scope+key] {
+		return false
+	}
+	c.refreshing.keys[c.scope+key] = true
+	return true
+}
+
+// endRefresh marks the refresh of the entry under key as done.
+func (c *Cache) endRefresh(key string) {
+	c.refreshing.mu.Lock()
+	defer c.refreshing.mu.Unlock()
+
+	delete(c.refreshing.keys, c.scope+key)
+}
+
+// Scope returns a cache sharing the store and settings of c whose entries are
+// only visible through caches of the same scope, e.g. to isolate the tenants
+// of a server. The entries of every scope remain visible through c.
+func (c *Cache) Scope(name string) *Cache {
+	sum := sha256.Sum256([]byte(name))
+	scoped := *c
+	scoped.scope = c.scope + "s:" + hex.EncodeToString(sum[:16]) + ":"
+	return &scoped
+}
+
+// load returns the entry stored under key, if present and fresh, or stale
+// within its stale window when allowStale is set, with Doc.Stale set. Entries
+// past their stale window are deleted.
+func (c *Cache) load(ctx context.Context, key string, allowStale bool) (*cacheEntry, bool) {
+	entry, ok := c.read(ctx, key)
+	if !ok {
+		return nil, false
+	}
+	if now := c.now(); !now.Before(entry.ExpiresAt) {
+		if !now.Before(entry.StaleUntil) {
+			// Entries are kept while they can be revalidated
+			if !now.Before(entry.RevalidateUntil) {
+				c.store.Delete(ctx, key)
+			}
+			return nil, false
+		}
+		if !allowStale {
+			return nil, false
+		}
+		entry.Doc.Stale = true
+	}
+	return c.withContent(ctx, key, entry)
+}
+
+// revalidation returns the entry stored under key, fresh or expired, if it
+// can still be revalidated with a conditional request.
+func (c *Cache) revalidation(ctx context.Context, key string) (*cacheEntry, bool) {
+	entry, ok := c.read(ctx, c.scope+key)
+	if !ok || entry.ETag == "" && entry.LastModified == "" || !c.now().Before(entry.RevalidateUntil) {
+		return nil, false
+	}
+	return c.withContent(ctx, c.scope+key, entry)
+}
+
+// read returns the entry stored under key, whatever its expiry time.
+func (c *Cache) read(ctx context.Context, key string) (*cacheEntry, bool) {
+	data, ok, err := c.store.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		c.store.Delete(ctx, key)
+		return nil, false
+	}
+	// Entries stored without expiry time live for the TTL of the cache
+	if entry.ExpiresAt.IsZero() {
+		entry.ExpiresAt = entry.StoredAt.Add(c.ttl)
+	}
+	return &entry, true
+}
+
+// withContent loads the content of entry, stored under key, if stored apart.
+func (c *Cache) withContent(ctx context.Context, key string, entry *cacheEntry) (*cacheEntry, bool) {
+	if entry.ContentKey != "" {
+		content, ok := c.content(ctx, entry.ContentKey)
+		if !ok {
+			// The content was evicted before the entry
+			c.store.Delete(ctx, key)
+			return nil, false
+		}
+		entry.Doc.Content = content.Content
+	}
+	return entry, true
+}
+
+// content returns the cacheContent stored under key, if any.
+func (c *Cache) content(ctx context.Context, key string) (*cacheContent, bool) {
+	data, ok, err := c.store.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, false
+	}
+	var content cacheContent
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, false
+	}
+	return &content, true
+}
+
+// get returns a copy of the cached document for key, if present and fresh or
+// within its stale window.
+func (c *Cache) get(ctx context.Context, key string) (*Document, bool) {
+	entry, ok := c.load(ctx, c.scope+key, true)
+	if !ok {
+		return nil, false
+	}
+	return &entry.Doc, true
+}
+
+// set stores a copy of doc under key, for the lifetime allowed by policy. raw
+// reports that doc holds the response body rather than a conversion. The
+// content is stored once for all URLs serving it: set returns the URL of a
+// cached document with the same content fetched from another URL, if any.
+func (c *Cache) set(ctx context.Context, key, canonicalURL string, doc *Document, raw bool, policy cachePolicy) (duplicateOf string) {
+	revalidate := c.revalidateTTL > 0 && policy.canRevalidate()
+	if policy.noStore || policy.noCache && !revalidate {
+		return ""
+	}
+	ttl := c.ttl
+	if policy.explicit {
+		ttl = policy.ttl
+		if c.minTTL > 0 {
+			ttl = max(ttl, c.minTTL)
+		}
+		if c.maxTTL > 0 {
+			ttl = min(ttl, c.maxTTL)
+		}
+	}
+	// no-cache entries are revalidated on each use
+	if policy.noCache {
+		ttl = 0
+	}
+	if ttl <= 0 && !revalidate {
+		return ""
+	}
+
+	now := c.now()
+	entry := cacheEntry{URL: canonicalURL, Doc: *doc, Raw: raw, StoredAt: now, ExpiresAt: now.Add(ttl)}
+	entry.Doc.Stale = false
+	entry.Doc.CacheStatus = ""
+	// Entries are kept for their stale window after they expire
+	storeTTL := max(ttl, 0)
+	if c.staleTTL > 0 && !policy.mustRevalidate && !policy.noCache {
+		entry.StaleUntil = entry.ExpiresAt.Add(c.staleTTL)
+		storeTTL += c.staleTTL
+	}
+	// and for their revalidation window, if longer
+	if revalidate {
+		entry.ETag = policy.etag
+		entry.LastModified = policy.lastModified
+		entry.RevalidateUntil = entry.ExpiresAt.Add(c.revalidateTTL)
+		storeTTL = max(storeTTL, max(ttl, 0)+c.revalidateTTL)
+	}
+	var content *cacheContent
+	if doc.Content != "" {
+		entry.ContentKey = contentKeyPrefix + c.scope + contentHash(doc.Content)
+		entry.Doc.Content = ""
+		var ok bool
+		if content, ok = c.content(ctx, entry.ContentKey); ok && content.URL != canonicalURL {
+			duplicateOf = content.URL
+		} else {
+			content = &cacheContent{URL: canonicalURL, Content: doc.Content}
+		}
+		entry.Doc.DuplicateOf = duplicateOf
+	}
+	data, err := json.Marshal(entry)
+	if err != nil || c.maxEntrySize > 0 && len(data)+len(doc.Content) > c.maxEntrySize {
+		return duplicateOf
+	}
+
+	if content != nil {
+		// Storing the content again extends its lifetime to the new entry
+		contentData, err := json.Marshal(content)
+		if err != nil || c.store.Set(ctx, entry.ContentKey, contentData, storeTTL) != nil {
+			return duplicateOf
+		}
+	}
+	c.store.Set(ctx, c.scope+key, data, storeTTL)
+	return duplicateOf
+}
+
+// entries returns the store keys and fresh entries of the cache scope.
+func (c *Cache) entries(ctx context.Context) map[string]*cacheEntry {
+	keys, err := c.store.Keys(ctx)
+	if err != nil {
+		return nil
+	}
+	entries := make(map[string]*cacheEntry, len(keys))
+	for _, key := range keys {
+		if !strings.HasPrefix(key, c.scope) || strings.HasPrefix(key, contentKeyPrefix) {
+			continue
+		}
+		if entry, ok := c.load(ctx, key, false); ok {
+			entries[key] = entry
+		}
+	}
+	return entries
+}
+
+// Entries returns the fresh entries, sorted by URL.
+func (c *Cache) Entries() []CacheEntry {
+	var entries []CacheEntry
+	for _, entry := range c.entries(context.Background()) {
+		entries = append(entries, CacheEntry{
+			URL:       entry.URL,
+			Size:      len(entry.Doc.Content),
+			StoredAt:  entry.StoredAt,
+			ExpiresAt: entry.ExpiresAt,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].URL != entries[j].URL {
+			return entries[i].URL < entries[j].URL
+		}
+		return entries[i].StoredAt.Before(entries[j].StoredAt)
+	})
+	return entries
+}
+
+// Documents returns a copy of the fresh converted documents, one per URL and
+// sorted by URL. Of the variants of a URL, e.g. fetched with different
+// selectors, the most recently stored is returned.
+func (c *Cache) Documents() []*Document {
+	latest := make(map[string]*cacheEntry)
+	for _, entry := range c.entries(context.Background()) {
+		if entry.Raw {
+			continue
+		}
+		if prev, ok := latest[entry.URL]; !ok || entry.StoredAt.After(prev.StoredAt) {
+			latest[entry.URL] = entry
+		}
+	}
+	urls := slices.Sorted(maps.Keys(latest))
+	docs := make([]*Document, len(urls))
+	for i, u := range urls {
+		docs[i] = &latest[u].Doc
+	}
+	return docs
+}
+
+// Evict removes every cached variant of rawURL and returns the number of entries removed.
+func (c *Cache) Evict(rawURL string) (int, error) {
+	canonical, err := CanonicalizeURL(rawURL, false)
+	if err != nil {
+		return 0, err
+	}
+	return c.evictFunc(func(e *cacheEntry) bool { return e.URL == canonical }), nil
+}
+
+// EvictHost removes all entries fetched from host and returns the number of entries removed.
+func (c *Cache) EvictHost(host string) int {
+	host = strings.ToLower(host)
+	return c.evictFunc(func(e *cacheEntry) bool {
+		u, err := url.Parse(e.URL)
+		return err == nil && (u.Host == host || u.Hostname() == host)
+	})
+}
+
+// Clear removes all entries and returns the number of entries removed.
+func (c *Cache) Clear() int {
+	n := c.evictFunc(func(*cacheEntry) bool { return true })
+	ctx := context.Background()
+	if keys, err := c.store.Keys(ctx); err == nil {
+		for _, key := range keys {
+			if strings.HasPrefix(key, contentKeyPrefix+c.scope) {
+				c.store.Delete(ctx, key)
+			}
+		}
+	}
+	return n
+}
+
+// evictFunc removes the entries for which match returns true.
+func (c *Cache) evictFunc(match func(*cacheEntry) bool) int {
+	ctx := context.Background()
+	n := 0
+	for key, entry := range c.entries(ctx) {
+		if match(entry) && c.store.Delete(ctx, key) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// MemoryStore is an in-memory CacheStore. When limits are set, the least
+// recently used values are evicted to stay within them.
+type MemoryStore struct {
+	mu    sync.Mutex
+	items map[string]*list.Element
+	// lru holds the *memoryItem values, most recently used first
+	lru *list.List
+
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	evictions  int64
+}
+
+// memoryItem is a value of a MemoryStore with its key and expiry time
+type memoryItem struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// size is the number of bytes counted for the item against MemoryStore limits
+func (item *memoryItem) size() int64 {
+	return int64(len(item.key) + len(item.value))
+}
+
+// MemoryStoreStats describes the content of a MemoryStore.
+type MemoryStoreStats struct {
+	// Entries is the number of stored values.
+	Entries int
+	// Bytes is the size of the stored keys and values.
+	Bytes int64
+	// Evictions is the number of values evicted to stay within the limits.
+	Evictions int64
+}
+
+// NewMemoryStore creates an empty in-memory store without limits.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: make(map[string]*list.Element), lru: list.New()}
+}
+
+// SetLimits bounds the store to maxEntries values and maxBytes bytes of keys
+// and values, ignoring non-positive limits. Values larger than maxBytes are not
+// stored.
+func (s *MemoryStore) SetLimits(maxEntries int, maxBytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxEntries = maxEntries
+	s.maxBytes = maxBytes
+	s.evict()
+}
+
+// Stats returns the number and size of the stored values and the number of evictions.
+func (s *MemoryStore) Stats() MemoryStoreStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return MemoryStoreStats{Entries: s.lru.Len(), Bytes: s.bytes, Evictions: s.evictions}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	item := elem.Value.(*memoryItem)
+	if !item.expiresAt.IsZero() && !time.Now().Before(item.expiresAt) {
+		s.remove(elem)
+		return nil, false, nil
+	}
+	s.lru.MoveToFront(elem)
+	return item.value, true, nil
+}
+
+func (s *MemoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.items[key]; ok {
+		s.remove(elem)
+	}
+	item := &memoryItem{key: key, value: value}
+	if ttl > 0 {
+		item.expiresAt = time.Now().Add(ttl)
+	}
+	if s.maxBytes > 0 && item.size() > s.maxBytes {
+		return nil
+	}
+	s.items[key] = s.lru.PushFront(item)
+	s.bytes += item.size()
+	s.evict()
+	return nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.items[key]; ok {
+		s.remove(elem)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Keys(_ context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(s.items))
+	for key, elem := range s.items {
+		if item := elem.Value.(*memoryItem); !item.expiresAt.IsZero() && !now.Before(item.expiresAt) {
+			s.remove(elem)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// remove removes the item of elem. The caller must hold s.mu.
+func (s *MemoryStore) remove(elem *list.Element) {
+	item := s.lru.Remove(elem).(*memoryItem)
+	delete(s.items, item.key)
+	s.bytes -= item.size()
+}
+
+// evict removes the least recently used items until the store is within its
+// limits. The caller must hold s.mu.
+func (s *MemoryStore) evict() {
+	for s.lru.Len() > 0 && (s.maxEntries > 0 && s.lru.Len() > s.maxEntries || s.maxBytes > 0 && s.bytes > s.maxBytes) {
+		s.remove(s.lru.Back())
+		s.evictions++
+	}
+}
+
+// cacheKey returns the cache key for fetching canonicalURL with opts. Options that
+// change the request or the conversion are part of the key, so that for example a
+// raw fetch never serves a converted document.
+func cacheKey(canonicalURL, fragment string, opts FetchOptions) string {
+	var sb strings.Builder
+	if fragment != "" {
+		fmt.Fprintf(&sb, "frag:%s\n", fragment)
+	}
+	names := make([]string, 0, len(opts.Headers))
+	for name := range opts.Headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(&sb, "h:%s=%s\n", strings.ToLower(name), opts.Headers[name])
+	}
+	fmt.Fprintf(&sb, "ua:%s\nsel:%s\nex:%s\nraw:%t\niframes:%t\nlang:%s\nocr:%t\n",
+		opts.UserAgent, opts.Selector, strings.Join(opts.ExcludeSelectors, ","), opts.Raw, opts.InlineIframes, opts.Language, opts.PDFOCR != nil)
+	if opts.StripTrackingLinks {
+		fmt.Fprintf(&sb, "tracking:%s\n", strings.Join(trackingParams(opts), ","))
+	}
+	if len(opts.Accept) > 0 {
+		fmt.Fprintf(&sb, "accept:%s\n", strings.Join(opts.Accept, ","))
+	}
+	if opts.PDFFallback != nil {
+		fmt.Fprintf(&sb, "pdffallback:%s\n", opts.PDFFallback.Name)
+	}
+	if opts.Render != nil {
+		sb.WriteString("render\n")
+	}
+	if opts.NormalizeWhitespace {
+		sb.WriteString("whitespace\n")
+	}
+	// Documents converted without the check must not be served to strict callers
+	if opts.StrictContentType {
+		sb.WriteString("strict\n")
+	}
+
+	sum := sha256.Sum256([]byte(sb.String()))
+	return canonicalURL + "#" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,285 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newCountingServer returns a server answering HTML that includes the number of requests served
+func newCountingServer(hits *atomic.Int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>hit " + strconv.FormatInt(n, 10) + "</p>"))
+	}))
+}
+
+func TestFetch_Cache(t *testing.T) {
+	var hits atomic.Int64
+	server := newCountingServer(&hits)
+	defer server.Close()
+
+	cache := NewCache(time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	opts := FetchOptions{Timeout: 5 * time.Second, Cache: cache}
+
+	first, err := Fetch(context.Background(), server.URL+"/page", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A cosmetic variant of the same URL is served from cache
+	second, err := Fetch(context.Background(), server.URL+"/docs/../page", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first.Content != "hit 1" || second.Content != "hit 1" || hits.Load() != 1 {
+		t.Errorf("expected second fetch to be served from cache, got %q and %q (%d hits)",
+			first.Content, second.Content, hits.Load())
+	}
+
+	// Different conversion options are cached separately
+	raw, err := Fetch(context.Background(), server.URL+"/page", FetchOptions{Timeout: 5 * time.Second, Cache: cache, Raw: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if raw.Content != "<p>hit 2</p>" {
+		t.Errorf("expected raw fetch to bypass converted entry, got %q", raw.Content)
+	}
+
+	// Expired entries are fetched again
+	now = now.Add(time.Minute)
+	third, err := Fetch(context.Background(), server.URL+"/page", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if third.Content != "hit 3" {
+		t.Errorf("expected expired entry to be refetched, got %q", third.Content)
+	}
+}
+
+func TestCache_Management(t *testing.T) {
+	cache := NewCache(time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.set(context.Background(), "a1", "https://a.example/1", &Document{Content: "one"}, false, cachePolicy{})
+	cache.set(context.Background(), "a1-raw", "https://a.example/1", &Document{Content: "<p>one</p>"}, true, cachePolicy{})
+	cache.set(context.Background(), "a2", "https://a.example/2", &Document{Content: "two"}, false, cachePolicy{})
+	cache.set(context.Background(), "b1", "https://b.example:8443/1", &Document{Content: "three"}, false, cachePolicy{})
+
+	entries := cache.Entries()
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(entries))
+	}
+	if entries[0].URL != "https://a.example/1" {
+		t.Errorf("unexpected first entry: %+v", entries[0])
+	}
+	if !entries[0].ExpiresAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected entry to expire after the TTL, got %v", entries[0].ExpiresAt)
+	}
+
+	n, err := cache.Evict("HTTPS://A.example:443/1#top")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 variants evicted by URL, got %d", n)
+	}
+
+	if n := cache.EvictHost("b.example"); n != 1 {
+		t.Errorf("expected 1 entry evicted by host, got %d", n)
+	}
+
+	if n := cache.Clear(); n != 1 {
+		t.Errorf("expected 1 entry cleared, got %d", n)
+	}
+	if len(cache.Entries()) != 0 {
+		t.Error("expected empty cache after clear")
+	}
+}
+
+func TestCache_EntriesSkipsExpired(t *testing.T) {
+	cache := NewCache(time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.set(context.Background(), "old", "https://example.com/old", &Document{Content: "old"}, false, cachePolicy{})
+	now = now.Add(30 * time.Second)
+	cache.set(context.Background(), "new", "https://example.com/new", &Document{Content: "new"}, false, cachePolicy{})
+	now = now.Add(30 * time.Second)
+
+	entries := cache.Entries()
+	if len(entries) != 1 || entries[0].URL != "https://example.com/new" {
+		t.Errorf("expected only the fresh entry, got %+v", entries)
+	}
+}
+
+func TestCache_Scope(t *testing.T) {
+	var hits atomic.Int64
+	server := newCountingServer(&hits)
+	defer server.Close()
+
+	cache := NewCache(time.Minute)
+	alice, bob := cache.Scope("alice"), cache.Scope("bob")
+
+	fetch := func(c *Cache) string {
+		t.Helper()
+		doc, err := Fetch(context.Background(), server.URL, FetchOptions{Timeout: 5 * time.Second, Cache: c})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return doc.Content
+	}
+
+	// Each scope fetches its own copy
+	if got := []string{fetch(alice), fetch(bob), fetch(cache.Scope("alice"))}; got[0] != "hit 1" || got[1] != "hit 2" || got[2] != "hit 1" {
+		t.Errorf("expected hit 1, hit 2 and hit 1, got %v", got)
+	}
+	if len(alice.Entries()) != 1 || len(bob.Entries()) != 1 || len(cache.Entries()) != 2 {
+		t.Errorf("expected one entry per scope and two in the cache, got %d, %d and %d",
+			len(alice.Entries()), len(bob.Entries()), len(cache.Entries()))
+	}
+
+	if n := bob.Clear(); n != 1 || len(alice.Entries()) != 1 {
+		t.Errorf("expected clearing a scope to leave the others, got %d evicted and %d left", n, len(alice.Entries()))
+	}
+}
+
+func TestMemoryStore_Limits(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.SetLimits(2, 20)
+
+	store.Set(ctx, "a", []byte("1234"), 0)
+	store.Set(ctx, "b", []byte("1234"), 0)
+	// Reading a makes b the least recently used value
+	store.Get(ctx, "a")
+	store.Set(ctx, "c", []byte("1234"), 0)
+	if _, ok, _ := store.Get(ctx, "b"); ok {
+		t.Errorf("expected b to be evicted by the entry limit")
+	}
+
+	// d evicts a by the entry limit, then c by the size limit
+	store.Set(ctx, "d", []byte("1234567890123456"), 0)
+	if _, ok, _ := store.Get(ctx, "d"); !ok {
+		t.Errorf("expected d to be stored")
+	}
+	stats := store.Stats()
+	if stats.Entries != 1 || stats.Bytes != 17 || stats.Evictions != 3 {
+		t.Errorf("expected 1 entry of 17 bytes after 3 evictions, got %+v", stats)
+	}
+
+	// Values larger than the limit are not stored
+	store.Set(ctx, "e", make([]byte, 20), 0)
+	if _, ok, _ := store.Get(ctx, "e"); ok {
+		t.Errorf("expected e to be too large to store")
+	}
+}
+
+func TestCache_MaxEntrySize(t *testing.T) {
+	cache := NewCache(time.Minute)
+	cache.SetMaxEntrySize(1000)
+
+	ctx := context.Background()
+	cache.set(ctx, "small", "https://example.com/small", &Document{Content: "small"}, false, cachePolicy{})
+	cache.set(ctx, "large", "https://example.com/large", &Document{Content: strings.Repeat("x", 1000)}, false, cachePolicy{})
+	if _, ok := cache.get(ctx, "small"); !ok {
+		t.Errorf("expected small document to be cached")
+	}
+	if _, ok := cache.get(ctx, "large"); ok {
+		t.Errorf("expected large document not to be cached")
+	}
+}
+
+func TestFetch_CacheDuplicates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Same page</p>"))
+	}))
+	defer server.Close()
+
+	store := NewMemoryStore()
+	cache := NewCacheWithStore(time.Minute, store)
+	opts := FetchOptions{Timeout: 5 * time.Second, Cache: cache}
+
+	var docs []*Document
+	for _, path := range []string{"/page", "/alias", "/page"} {
+		doc, err := Fetch(context.Background(), server.URL+path, opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		docs = append(docs, doc)
+	}
+
+	if docs[0].DuplicateOf != "" || docs[1].DuplicateOf != server.URL+"/page" {
+		t.Errorf("expected the alias to be a duplicate of %s/page, got %q and %q", server.URL, docs[0].DuplicateOf, docs[1].DuplicateOf)
+	}
+	if docs[2].Content != "Same page" {
+		t.Errorf("expected cached content %q, got %q", "Same page", docs[2].Content)
+	}
+	// Two entries share one copy of the content
+	if entries := store.Stats().Entries; entries != 3 {
+		t.Errorf("expected 2 entries and 1 content in the store, got %d values", entries)
+	}
+}
+
+func TestFetch_CacheMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     CacheMode
+		expected string
+		hits     int64
+		cached   string
+	}{
+		{name: "default", mode: CacheDefault, expected: "hit 1", hits: 1, cached: "hit 1"},
+		{name: "bypass", mode: CacheBypass, expected: "hit 2", hits: 2, cached: "hit 1"},
+		{name: "only", mode: CacheOnly, expected: "hit 1", hits: 1, cached: "hit 1"},
+		{name: "refresh", mode: CacheRefresh, expected: "hit 2", hits: 2, cached: "hit 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int64
+			server := newCountingServer(&hits)
+			defer server.Close()
+
+			cache := NewCache(time.Minute)
+			opts := FetchOptions{Timeout: 5 * time.Second, Cache: cache}
+			if _, err := Fetch(context.Background(), server.URL, opts); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			opts.CacheMode = tt.mode
+			doc, err := Fetch(context.Background(), server.URL, opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if doc.Content != tt.expected || hits.Load() != tt.hits {
+				t.Errorf("expected %q after %d requests, got %q after %d", tt.expected, tt.hits, doc.Content, hits.Load())
+			}
+
+			opts.CacheMode = CacheOnly
+			if doc, err := Fetch(context.Background(), server.URL, opts); err != nil || doc.Content != tt.cached {
+				t.Errorf("expected %q in the cache, got %v, %v", tt.cached, doc, err)
+			}
+		})
+	}
+
+	_, err := Fetch(context.Background(), "https://example.com", FetchOptions{CacheMode: CacheOnly})
+	if !errors.Is(err, ErrNotCached) {
+		t.Errorf("expected ErrNotCached without cache, got %v", err)
+	}
+	if _, err := Fetch(context.Background(), "https://example.com", FetchOptions{CacheMode: "sometimes"}); err == nil {
+		t.Errorf("expected an invalid cache mode error")
+	}
+}
@@ -0,0 +1,112 @@
+package webfetch
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCacheLifetime bounds declared freshness lifetimes, as for max-age in RFC 9111
+const maxCacheLifetime = (1<<31 - 1) * time.Second
+
+// cachePolicy is how a response may be cached, from its Cache-Control, Pragma
+// and Expires headers
+type cachePolicy struct {
+	// noStore forbids caching the response: no-store or private
+	noStore bool
+	// noCache forbids serving the response without revalidating it: no-cache
+	noCache bool
+	// explicit reports whether the response declares its freshness lifetime ttl
+	explicit bool
+	ttl      time.Duration
+	// mustRevalidate forbids serving the response once stale
+	mustRevalidate bool
+	// etag and lastModified are the validators of the response, sent in the
+	// conditional requests revalidating it
+	etag         string
+	lastModified string
+}
+
+// canRevalidate reports whether the response has a validator
+func (p cachePolicy) canRevalidate() bool {
+	return p.etag != "" || p.lastModified != ""
+}
+
+// responseCachePolicy returns the cache policy of a response with header h
+// received at now, as a shared cache. s-maxage takes precedence over max-age,
+// which takes precedence over Expires. The age of the response is deducted.
+func responseCachePolicy(h http.Header, now time.Time) cachePolicy {
+	var policy cachePolicy
+	directives := cacheControlDirectives(h.Values("Cache-Control"))
+	if len(h.Values("Cache-Control")) == 0 && strings.Contains(strings.ToLower(h.Get("Pragma")), "no-cache") {
+		policy.noCache = true
+	}
+
+	for _, name := range []string{"no-store", "private"} {
+		// private with field names only restricts those fields
+		if value, ok := directives[name]; ok && (name == "no-store" || value == "") {
+			policy.noStore = true
+		}
+	}
+	// no-cache with field names only restricts those fields
+	if value, ok := directives["no-cache"]; ok && value == "" {
+		policy.noCache = true
+	}
+
+	// s-maxage implies proxy-revalidate for shared caches
+	for _, name := range []string{"must-revalidate", "proxy-revalidate", "s-maxage"} {
+		if _, ok := directives[name]; ok {
+			policy.mustRevalidate = true
+		}
+	}
+
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if value, ok := directives[name]; ok {
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || seconds < 0 {
+				// An invalid lifetime makes the response stale
+				seconds = 0
+			}
+			policy.explicit = true
+			policy.ttl = time.Duration(min(seconds, int64(maxCacheLifetime/time.Second))) * time.Second
+			break
+		}
+	}
+	if expires := h.Get("Expires"); !policy.explicit && expires != "" {
+		policy.explicit = true
+		if t, err := http.ParseTime(expires); err == nil {
+			date, err := http.ParseTime(h.Get("Date"))
+			if err != nil {
+				date = now
+			}
+			policy.ttl = max(t.Sub(date), 0)
+		}
+	}
+
+	if age, err := strconv.ParseInt(h.Get("Age"), 10, 64); err == nil && age > 0 && policy.explicit {
+		policy.ttl = max(policy.ttl-time.Duration(min(age, int64(maxCacheLifetime/time.Second)))*time.Second, 0)
+	}
+	policy.etag = h.Get("ETag")
+	policy.lastModified = h.Get("Last-Modified")
+	return policy
+}
+
+// cacheControlDirectives returns the directives of Cache-Control header
+// values, with lowercase names and unquoted values
+func cacheControlDirectives(values []string) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range values {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if _, ok := directives[name]; !ok {
+				directives[name] = strings.Trim(strings.TrimSpace(arg), `"`)
+			}
+		}
+	}
+	return directives
+}
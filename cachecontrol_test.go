@@ -0,0 +1,258 @@
+package webfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_responseCachePolicy(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	date := now.Format(http.TimeFormat)
+
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected cachePolicy
+	}{
+		{name: "no headers", header: http.Header{}},
+		{name: "no-store", header: http.Header{"Cache-Control": {"max-age=60, no-store"}}, expected: cachePolicy{noStore: true, explicit: true, ttl: time.Minute}},
+		{name: "no-cache", header: http.Header{"Cache-Control": {"No-Cache"}}, expected: cachePolicy{noCache: true}},
+		{name: "no-cache with field", header: http.Header{"Cache-Control": {`no-cache="Set-Cookie", max-age=60`}}, expected: cachePolicy{explicit: true, ttl: time.Minute}},
+		{name: "private", header: http.Header{"Cache-Control": {"private, max-age=60"}}, expected: cachePolicy{noStore: true, explicit: true, ttl: time.Minute}},
+		{name: "pragma", header: http.Header{"Pragma": {"no-cache"}}, expected: cachePolicy{noCache: true}},
+		{name: "max-age", header: http.Header{"Cache-Control": {"public, max-age=600"}}, expected: cachePolicy{explicit: true, ttl: 10 * time.Minute}},
+		{name: "s-maxage", header: http.Header{"Cache-Control": {"max-age=600", "s-maxage=60"}}, expected: cachePolicy{explicit: true, ttl: time.Minute, mustRevalidate: true}},
+		{name: "must-revalidate", header: http.Header{"Cache-Control": {"max-age=60, must-revalidate"}}, expected: cachePolicy{explicit: true, ttl: time.Minute, mustRevalidate: true}},
+		{name: "invalid max-age", header: http.Header{"Cache-Control": {"max-age=soon"}}, expected: cachePolicy{explicit: true}},
+		{name: "age", header: http.Header{"Cache-Control": {"max-age=600"}, "Age": {"100"}}, expected: cachePolicy{explicit: true, ttl: 500 * time.Second}},
+		{
+			name:     "expires",
+			header:   http.Header{"Date": {date}, "Expires": {now.Add(time.Hour).Format(http.TimeFormat)}},
+			expected: cachePolicy{explicit: true, ttl: time.Hour},
+		},
+		{name: "invalid expires", header: http.Header{"Expires": {"0"}}, expected: cachePolicy{explicit: true}},
+		{
+			name:     "validators",
+			header:   http.Header{"Cache-Control": {"no-cache"}, "Etag": {`"v1"`}, "Last-Modified": {date}},
+			expected: cachePolicy{noCache: true, etag: `"v1"`, lastModified: date},
+		},
+		{
+			name:     "max-age over expires",
+			header:   http.Header{"Cache-Control": {"max-age=60"}, "Expires": {now.Add(time.Hour).Format(http.TimeFormat)}},
+			expected: cachePolicy{explicit: true, ttl: time.Minute},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := responseCachePolicy(tt.header, now); got != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFetch_CacheControl(t *testing.T) {
+	var hits atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Cache-Control", r.URL.Query().Get("cc"))
+		w.Write([]byte("<p>hit " + strconv.FormatInt(n, 10) + "</p>"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		cacheControl string
+		minTTL       time.Duration
+		maxTTL       time.Duration
+		after        time.Duration
+		cached       bool
+	}{
+		{name: "default TTL", after: 59 * time.Second, cached: true},
+		{name: "no-store", cacheControl: "no-store", cached: false},
+		{name: "fresh max-age", cacheControl: "max-age=600", after: 5 * time.Minute, cached: true},
+		{name: "stale max-age", cacheControl: "max-age=10", after: 10 * time.Second, cached: false},
+		{name: "max-age raised to min", cacheControl: "max-age=0", minTTL: time.Minute, after: 30 * time.Second, cached: true},
+		{name: "max-age lowered to max", cacheControl: "max-age=600", maxTTL: time.Minute, after: time.Minute, cached: false},
+		{name: "min does not override no-store", cacheControl: "no-store", minTTL: time.Minute, cached: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewCache(time.Minute)
+			cache.SetTTLBounds(tt.minTTL, tt.maxTTL)
+			now := time.Now()
+			cache.now = func() time.Time { return now }
+			opts := FetchOptions{Timeout: 5 * time.Second, Cache: cache}
+			pageURL := server.URL + "/?cc=" + tt.cacheControl
+
+			first, err := Fetch(context.Background(), pageURL, opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			now = now.Add(tt.after)
+			second, err := Fetch(context.Background(), pageURL, opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cached := first.Content == second.Content; cached != tt.cached {
+				t.Errorf("expected cached %t, got %q then %q", tt.cached, first.Content, second.Content)
+			}
+		})
+	}
+}
+
+func TestFetch_StaleWhileRevalidate(t *testing.T) {
+	var hits atomic.Int64
+	server := newCountingServer(&hits)
+	defer server.Close()
+
+	cache := NewCache(time.Minute)
+	cache.SetStaleWhileRevalidate(time.Minute)
+	var now atomic.Int64
+	now.Store(time.Now().UnixNano())
+	cache.now = func() time.Time { return time.Unix(0, now.Load()) }
+	opts := FetchOptions{Timeout: 5 * time.Second, Cache: cache}
+
+	fetch := func() *Document {
+		t.Helper()
+		doc, err := Fetch(context.Background(), server.URL, opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return doc
+	}
+
+	first := fetch()
+	if first.Stale || first.FetchedAt.IsZero() {
+		t.Errorf("expected a fresh document with its fetch time, got %+v", first)
+	}
+
+	// An expired entry is served stale and refreshed in the background
+	now.Add(int64(90 * time.Second))
+	stale := fetch()
+	if stale.Content != "hit 1" || !stale.Stale || !stale.FetchedAt.Equal(first.FetchedAt) {
+		t.Errorf("expected stale hit 1, got %q (stale %t)", stale.Content, stale.Stale)
+	}
+	u, _ := url.Parse(server.URL)
+	key := cacheKey(canonicalURL(u, nil).String(), "", opts)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if doc, ok := cache.get(context.Background(), key); ok && !doc.Stale {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the entry to be refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if refreshed := fetch(); refreshed.Content != "hit 2" || refreshed.Stale {
+		t.Errorf("expected fresh hit 2, got %q (stale %t)", refreshed.Content, refreshed.Stale)
+	}
+
+	// Past the stale window, the page is fetched again before returning
+	now.Add(int64(3 * time.Minute))
+	if doc := fetch(); doc.Content != "hit 3" || doc.Stale {
+		t.Errorf("expected fresh hit 3, got %q (stale %t)", doc.Content, doc.Stale)
+	}
+}
+
+func TestFetch_Revalidation(t *testing.T) {
+	// The page changes with its version; versions are served with their ETag,
+	// Last-Modified, or both
+	var version, hits, notModified atomic.Int64
+	version.Store(1)
+	modified := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		v := version.Load()
+		etag := `"v` + strconv.FormatInt(v, 10) + `"`
+		lastModified := modified.Add(time.Duration(v) * time.Hour).Format(http.TimeFormat)
+		if cc := r.URL.Query().Get("cc"); cc != "" {
+			w.Header().Set("Cache-Control", cc)
+		}
+		if r.URL.Query().Get("validator") != "last-modified" {
+			w.Header().Set("ETag", etag)
+		}
+		w.Header().Set("Last-Modified", lastModified)
+		if r.Header.Get("If-None-Match") == etag || r.Header.Get("If-None-Match") == "" && r.Header.Get("If-Modified-Since") == lastModified {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>version " + strconv.FormatInt(v, 10) + "</p>"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		query    string
+		window   time.Duration
+		after    time.Duration
+		expected []CacheStatus
+	}{
+		{name: "fresh", after: 30 * time.Second, window: time.Hour, expected: []CacheStatus{CacheMiss, CacheHit, CacheMiss}},
+		{name: "etag", after: 2 * time.Minute, window: time.Hour, expected: []CacheStatus{CacheMiss, CacheRevalidated, CacheMiss}},
+		{name: "last-modified", query: "validator=last-modified", after: 2 * time.Minute, window: time.Hour, expected: []CacheStatus{CacheMiss, CacheRevalidated, CacheMiss}},
+		{name: "no-cache", query: "cc=no-cache", window: time.Hour, expected: []CacheStatus{CacheMiss, CacheRevalidated, CacheMiss}},
+		{name: "past the window", after: 2 * time.Hour, window: time.Hour, expected: []CacheStatus{CacheMiss, CacheMiss, CacheMiss}},
+		{name: "disabled", after: 2 * time.Minute, expected: []CacheStatus{CacheMiss, CacheMiss, CacheMiss}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version.Store(1)
+			hits.Store(0)
+			notModified.Store(0)
+			cache := NewCache(time.Minute)
+			cache.SetRevalidation(tt.window)
+			now := time.Now()
+			cache.now = func() time.Time { return now }
+			var info FetchInfo
+			opts := FetchOptions{Timeout: 5 * time.Second, Cache: cache, OnFetch: func(i FetchInfo) { info = i }}
+			pageURL := server.URL + "/?" + tt.query
+
+			var statuses []CacheStatus
+			for i, expected := range []string{"version 1", "version 1", "version 2"} {
+				if i == 2 {
+					// The page changed: revalidations download it again
+					version.Store(2)
+					now = now.Add(tt.after + time.Minute)
+				} else {
+					now = now.Add(tt.after)
+				}
+				doc, err := Fetch(context.Background(), pageURL, opts)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if doc.Content != expected {
+					t.Errorf("fetch %d: expected %q, got %q", i+1, expected, doc.Content)
+				}
+				if doc.CacheStatus == CacheRevalidated && (!info.Revalidated || !info.Cached) {
+					t.Errorf("fetch %d: expected a revalidated fetch, got %+v", i+1, info)
+				}
+				statuses = append(statuses, doc.CacheStatus)
+			}
+			if !slices.Equal(statuses, tt.expected) {
+				t.Errorf("expected cache statuses %v, got %v", tt.expected, statuses)
+			}
+			var expectedNotModified int64
+			if slices.Contains(tt.expected, CacheRevalidated) {
+				expectedNotModified = 1
+			}
+			if notModified.Load() != expectedNotModified {
+				t.Errorf("expected %d not modified responses, got %d", expectedNotModified, notModified.Load())
+			}
+		})
+	}
+}
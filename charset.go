@@ -0,0 +1,115 @@
+package webfetch
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// charsetPreviewSize is the number of bytes examined to determine the encoding
+// of an HTML document, as in the HTML standard's prescan
+const charsetPreviewSize = 1024
+
+// utf8BOM is the UTF-8 byte order mark
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// decodeHTML returns a reader of the HTML body r transcoded to UTF-8, without
+// byte order mark. The encoding is determined from a byte order mark, the
+// layout of UTF-16 text, the charset parameter of contentType, a <meta> charset
+// declaration, or else by sniffing the first bytes.
+//
+// Documents in UTF-8 or windows-1252 (which includes ISO-8859-1 and
+// undeclared documents) are read as UTF-8 where they are valid UTF-8 and as
+// windows-1252 elsewhere, which recovers pages mixing both encodings, such as
+// a UTF-8 template around legacy content or a wrong charset declaration.
+func decodeHTML(r io.Reader, contentType string) io.Reader {
+	br := bufio.NewReaderSize(r, charsetPreviewSize)
+	preview, _ := br.Peek(charsetPreviewSize)
+
+	if bytes.HasPrefix(preview, utf8BOM) {
+		br.Discard(len(utf8BOM))
+		return transform.NewReader(br, utf8Fallback{})
+	}
+	if e := sniffUTF16(preview); e != nil {
+		return transform.NewReader(br, unicode.BOMOverride(e.NewDecoder()))
+	}
+
+	var decoder transform.Transformer
+	switch e, name, _ := charset.DetermineEncoding(preview, contentType); {
+	case e == encoding.Nop, name == "utf-8", name == "windows-1252":
+		decoder = utf8Fallback{}
+	default:
+		decoder = e.NewDecoder()
+	}
+	// BOMOverride drops a UTF-16 byte order mark, and decodes the body as
+	// UTF-16 whatever the declared encoding
+	return transform.NewReader(br, unicode.BOMOverride(decoder))
+}
+
+// sniffUTF16 returns the UTF-16 encoding of text without byte order mark
+// starting with preview, recognized by the zero high bytes of its ASCII
+// characters, or nil.
+func sniffUTF16(preview []byte) encoding.Encoding {
+	pairs := len(preview) / 2
+	if pairs < 2 {
+		return nil
+	}
+	var even, odd int
+	for i := 0; i < pairs*2; i += 2 {
+		if preview[i] == 0 {
+			even++
+		}
+		if preview[i+1] == 0 {
+			odd++
+		}
+	}
+	switch {
+	case even == 0 && odd > pairs*3/4:
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case odd == 0 && even > pairs*3/4:
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	}
+	return nil
+}
+
+// utf8Fallback is a transformer to UTF-8 keeping the valid UTF-8 sequences
+// of its input and decoding the other bytes as windows-1252.
+type utf8Fallback struct {
+	transform.NopResetter
+}
+
+func (utf8Fallback) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		if c := src[nSrc]; c < utf8.RuneSelf {
+			if nDst == len(dst) {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			dst[nDst] = c
+			nDst++
+			nSrc++
+			continue
+		}
+
+		r, size := utf8.DecodeRune(src[nSrc:])
+		if r == utf8.RuneError && size == 1 {
+			if !atEOF && !utf8.FullRune(src[nSrc:]) {
+				// The sequence may continue in the next input
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			r = charmap.Windows1252.DecodeByte(src[nSrc])
+		}
+		if nDst+utf8.RuneLen(r) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += utf8.EncodeRune(dst[nDst:], r)
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
@@ -0,0 +1,176 @@
+package webfetch
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func Test_decodeHTML(t *testing.T) {
+	encode := func(e encoding.Encoding, s string) []byte {
+		b, err := e.NewEncoder().Bytes([]byte(s))
+		if err != nil {
+			t.Fatalf("failed to encode %q: %v", s, err)
+		}
+		return b
+	}
+	padding := strings.Repeat("<!-- padding -->", 100)
+
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		expected    string
+	}{
+		{
+			name:        "utf-8 header",
+			body:        []byte("<p>Grüße</p>"),
+			contentType: "text/html; charset=utf-8",
+			expected:    "<p>Grüße</p>",
+		},
+		{
+			name:        "iso-8859-1 header",
+			body:        encode(charmap.ISO8859_1, "<p>Grüße</p>"),
+			contentType: "text/html; charset=ISO-8859-1",
+			expected:    "<p>Grüße</p>",
+		},
+		{
+			name:        "koi8-r header",
+			body:        encode(charmap.KOI8R, "<p>Привет</p>"),
+			contentType: "text/html; charset=koi8-r",
+			expected:    "<p>Привет</p>",
+		},
+		{
+			name:        "windows-1251 meta",
+			body:        encode(charmap.Windows1251, `<meta charset="windows-1251"><p>Привет</p>`),
+			contentType: "text/html",
+			expected:    `<meta charset="windows-1251"><p>Привет</p>`,
+		},
+		{
+			name:        "shift_jis meta http-equiv",
+			body:        encode(japanese.ShiftJIS, `<meta http-equiv="Content-Type" content="text/html; charset=Shift_JIS"><p>こんにちは</p>`),
+			contentType: "text/html",
+			expected:    `<meta http-equiv="Content-Type" content="text/html; charset=Shift_JIS"><p>こんにちは</p>`,
+		},
+		{
+			name:        "euc-kr header",
+			body:        encode(korean.EUCKR, "<p>안녕하세요</p>"),
+			contentType: "text/html; charset=euc-kr",
+			expected:    "<p>안녕하세요</p>",
+		},
+		{
+			name:        "gbk header",
+			body:        encode(simplifiedchinese.GBK, "<p>你好</p>"),
+			contentType: "text/html; charset=gbk",
+			expected:    "<p>你好</p>",
+		},
+		{
+			name:        "utf-8 bom",
+			body:        append([]byte("\xef\xbb\xbf"), encode(encoding.Nop, "<p>Grüße</p>")...),
+			contentType: "text/html; charset=iso-8859-1",
+			expected:    "<p>Grüße</p>",
+		},
+		{
+			name:        "utf-8 bom with utf-8 header",
+			body:        []byte("\xef\xbb\xbf<p>Grüße</p>"),
+			contentType: "text/html; charset=utf-8",
+			expected:    "<p>Grüße</p>",
+		},
+		{
+			name:        "utf-16le bom",
+			body:        append([]byte("\xff\xfe"), encode(unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), "<p>Grüße</p>")...),
+			contentType: "text/html; charset=utf-8",
+			expected:    "<p>Grüße</p>",
+		},
+		{
+			name:        "utf-16be bom",
+			body:        append([]byte("\xfe\xff"), encode(unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), "<p>Привет</p>")...),
+			contentType: "text/html",
+			expected:    "<p>Привет</p>",
+		},
+		{
+			name:        "utf-16le without bom",
+			body:        encode(unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), "<!DOCTYPE html><p>Grüße</p>"),
+			contentType: "text/html",
+			expected:    "<!DOCTYPE html><p>Grüße</p>",
+		},
+		{
+			name:        "utf-16be without bom",
+			body:        encode(unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), "<!DOCTYPE html><p>Grüße</p>"),
+			contentType: "text/html; charset=iso-8859-1",
+			expected:    "<!DOCTYPE html><p>Grüße</p>",
+		},
+		{
+			name:        "utf-8 with latin-1 fragments",
+			body:        append([]byte("<p>Grüße</p><p>"), encode(charmap.Windows1252, "Café – €5</p>")...),
+			contentType: "text/html; charset=utf-8",
+			expected:    "<p>Grüße</p><p>Café – €5</p>",
+		},
+		{
+			name:        "utf-8 declared as iso-8859-1",
+			body:        []byte("<p>Grüße</p>"),
+			contentType: "text/html; charset=iso-8859-1",
+			expected:    "<p>Grüße</p>",
+		},
+		{
+			name:        "undeclared utf-8 after ascii preview",
+			body:        []byte(padding + "<p>Grüße</p>"),
+			contentType: "text/html",
+			expected:    padding + "<p>Grüße</p>",
+		},
+		{
+			name:        "undeclared invalid utf-8",
+			body:        encode(charmap.Windows1252, "<p>Grüße</p>"),
+			contentType: "text/html",
+			expected:    "<p>Grüße</p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := io.ReadAll(decodeHTML(bytes.NewReader(tt.body), tt.contentType))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, data)
+			}
+		})
+	}
+}
+
+func Fuzz_decodeHTML(f *testing.F) {
+	f.Add([]byte("<p>Grüße</p>"), "text/html; charset=utf-8")
+	f.Add([]byte("\xef\xbb\xbf<p>Grüße</p>"), "text/html")
+	f.Add([]byte("\xff\xfe<\x00p\x00>\x00"), "text/html")
+	f.Add([]byte("\x00<\x00p\x00>\x00\xe9"), "text/html; charset=utf-16")
+	f.Add([]byte("<p>caf\xe9 \xe2\x82</p>"), "text/html")
+	f.Add([]byte(`<meta charset="shift_jis"><p>\x82\xa0\x82</p>`), "text/html")
+	f.Add([]byte("<p>\xc1\xe5</p>"), "text/html; charset=gbk")
+
+	f.Fuzz(func(t *testing.T, body []byte, contentType string) {
+		data, err := io.ReadAll(decodeHTML(bytes.NewReader(body), contentType))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !utf8.Valid(data) {
+			t.Fatalf("expected valid UTF-8, got %q", data)
+		}
+		// Valid UTF-8 documents are read as is, whatever their declared charset
+		// if it is UTF-8 or windows-1252
+		if utf8.Valid(body) && !bytes.HasPrefix(body, []byte("\xef\xbb\xbf")) && !bytes.Contains(body, []byte{0}) &&
+			(contentType == "text/html" || contentType == "text/html; charset=utf-8") &&
+			!bytes.Contains(bytes.ToLower(body), []byte("charset")) && !bytes.Equal(data, body) {
+			t.Errorf("expected %q, got %q", body, data)
+		}
+	})
+}
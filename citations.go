@@ -0,0 +1,146 @@
+package webfetch
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// maxCitationContext is the maximum length in bytes of a citation context
+const maxCitationContext = 500
+
+// Citation is a link found in the content of an HTML document.
+type Citation struct {
+	// URL is the absolute URL of the link, without fragment.
+	URL string `json:"url"`
+	// Text is the anchor text of the link.
+	Text string `json:"text,omitempty"`
+	// Context is the sentence containing the link.
+	Context string `json:"context,omitempty"`
+}
+
+// blockAtoms are the elements whose text is searched for the sentence around a link
+var blockAtoms = []atom.Atom{
+	atom.P, atom.Li, atom.Td, atom.Th, atom.Dd, atom.Dt, atom.Blockquote, atom.Figcaption,
+	atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Div, atom.Section, atom.Article, atom.Body,
+}
+
+// extractCitations returns the http(s) links of root outside of the non-content
+// elements, with their anchor text and surrounding sentence, in document order.
+// Links to the page itself are skipped.
+func extractCitations(root *html.Node, baseURL *url.URL) []Citation {
+	page := *baseURL
+	page.Fragment = ""
+	page.RawFragment = ""
+
+	var citations []Citation
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if slices.Contains(tagsToRemove, n.Data) {
+				return
+			}
+			if n.DataAtom == atom.A {
+				if c, ok := newCitation(n, baseURL, page.String()); ok {
+					citations = append(citations, c)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return citations
+}
+
+// newCitation returns the citation of the link a, if it points to another page
+func newCitation(a *html.Node, baseURL *url.URL, page string) (Citation, bool) {
+	href := strings.TrimSpace(getAttr(a, "href"))
+	if href == "" {
+		return Citation{}, false
+	}
+	u, err := baseURL.Parse(href)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return Citation{}, false
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.String() == page {
+		return Citation{}, false
+	}
+
+	c := Citation{URL: u.String(), Text: normalizeSpace(textContent(a))}
+
+	block := a.Parent
+	for block != nil && (block.Type != html.ElementNode || !slices.Contains(blockAtoms, block.DataAtom)) {
+		block = block.Parent
+	}
+	if block != nil {
+		c.Context = sentenceAround(block, a)
+	}
+	return c, true
+}
+
+// sentenceAround returns the sentence of the text of block containing the text of n
+func sentenceAround(block, n *html.Node) string {
+	var sb strings.Builder
+	start, end := -1, -1
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		if c == n {
+			start = sb.Len()
+		}
+		if c.Type == html.TextNode {
+			sb.WriteString(c.Data)
+		}
+		for child := c.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if c == n {
+			end = sb.Len()
+		}
+	}
+	walk(block)
+
+	text := sb.String()
+	if start < 0 {
+		return ""
+	}
+
+	// Extend to the sentence boundaries around the link
+	from := 0
+	for i := start - 1; i > 0; i-- {
+		if isSentenceEnd(text, i-1) && unicode.IsSpace(rune(text[i])) {
+			from = i
+			break
+		}
+	}
+	to := len(text)
+	for i := end; i < len(text)-1; i++ {
+		if isSentenceEnd(text, i) && unicode.IsSpace(rune(text[i+1])) {
+			to = i + 1
+			break
+		}
+	}
+
+	sentence := normalizeSpace(text[from:to])
+	if len(sentence) > maxCitationContext {
+		sentence = strings.ToValidUTF8(sentence[:maxCitationContext], "") + "…"
+	}
+	return sentence
+}
+
+// isSentenceEnd reports whether text[i] ends a sentence
+func isSentenceEnd(text string, i int) bool {
+	return text[i] == '.' || text[i] == '!' || text[i] == '?'
+}
+
+// normalizeSpace collapses runs of whitespace in s into single spaces and trims it
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
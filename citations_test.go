@@ -0,0 +1,31 @@
+package webfetch
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_extractCitations(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com/docs/page#intro")
+
+	page := `<nav><a href="/home">Home</a></nav>
+<p>Go is fast. See the <a href="https://go.dev/ref/spec#Types">language
+spec</a> for details! It is short.</p>
+<ul><li><a href="guide">Guide</a></li></ul>
+<p><a href="#top">Back to top</a> <a href="mailto:someone@example.com">Mail</a></p>`
+
+	doc, err := convertHTML(strings.NewReader(page), baseURL, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []Citation{
+		{URL: "https://go.dev/ref/spec", Text: "language spec", Context: "See the language spec for details!"},
+		{URL: "https://example.com/docs/guide", Text: "Guide", Context: "Guide"},
+	}
+	if !reflect.DeepEqual(doc.Citations, expected) {
+		t.Errorf("expected citations %+v, got %+v", expected, doc.Citations)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+// acceptRule sets the media types preferred for the hosts matching pattern
+type acceptRule struct {
+	pattern string
+	types   []string
+}
+
+// parseAcceptTypes parses a comma-separated list of media types, most
+// preferred first, such as application/json,text/html or text/*
+func parseAcceptTypes(s string) ([]string, error) {
+	types := splitList(s)
+	if err := checkAcceptTypes(types); err != nil {
+		return nil, err
+	}
+	return types, nil
+}
+
+// checkAcceptTypes returns an error if types holds an invalid media type
+func checkAcceptTypes(types []string) error {
+	for _, t := range types {
+		mediaType, params, err := mime.ParseMediaType(t)
+		if err != nil || len(params) > 0 || !strings.Contains(mediaType, "/") {
+			return fmt.Errorf("invalid media type %q (expected e.g. application/json or text/*)", t)
+		}
+	}
+	return nil
+}
+
+// parseAcceptRules parses a semicolon-separated list of host=types rules,
+// where host is a host pattern as in the policy file and types a
+// comma-separated list of media types
+func parseAcceptRules(s string) ([]acceptRule, error) {
+	var rules []acceptRule
+	for item := range strings.SplitSeq(s, ";") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		pattern, list, ok := strings.Cut(item, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid accept rule %q (expected host=types, e.g. api.example.com=application/json,text/html)", item)
+		}
+		if err := checkHostPattern(pattern); err != nil {
+			return nil, fmt.Errorf("invalid accept rule %q: %w", item, err)
+		}
+		if !isHostRegexp(pattern) {
+			pattern = strings.ToLower(pattern)
+		}
+		types, err := parseAcceptTypes(list)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, acceptRule{pattern: pattern, types: types})
+	}
+	return rules, nil
+}
+
+// acceptTypes returns the media types preferred for rawURL: those of the first
+// -accept-hosts rule matching its host, else those of -accept
+func (c config) acceptTypes(rawURL string) []string {
+	if u, err := url.Parse(rawURL); err == nil {
+		host := strings.ToLower(u.Hostname())
+		for _, rule := range c.acceptRules {
+			if matchHost(rule.pattern, host) {
+				return rule.types
+			}
+		}
+	}
+	return c.accept
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestParseAcceptRules(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []acceptRule
+		err      bool
+	}{
+		{
+			input: "api.example.com=application/json,text/html; *.docs.example=text/*;",
+			expected: []acceptRule{
+				{pattern: "api.example.com", types: []string{"application/json", "text/html"}},
+				{pattern: "*.docs.example", types: []string{"text/*"}},
+			},
+		},
+		{input: "application/json", err: true},
+		{input: "api.example.com=json", err: true},
+		{input: "api.example.com=text/html;q=0.5", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			rules, err := parseAcceptRules(tt.input)
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected an error, got %v", rules)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(rules, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, rules)
+			}
+		})
+	}
+}
+
+func TestConfig_acceptTypes(t *testing.T) {
+	cfg := config{
+		accept: []string{"text/html"},
+		acceptRules: []acceptRule{
+			{pattern: "api.example.com", types: []string{"application/json"}},
+			{pattern: "*.docs.example", types: []string{"text/markdown"}},
+		},
+	}
+	tests := []struct {
+		url      string
+		expected []string
+	}{
+		{url: "https://API.example.com/v1/items", expected: []string{"application/json"}},
+		{url: "https://en.docs.example/guide", expected: []string{"text/markdown"}},
+		{url: "https://example.com/", expected: []string{"text/html"}},
+	}
+
+	for _, tt := range tests {
+		if got := cfg.acceptTypes(tt.url); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("expected %v for %s, got %v", tt.expected, tt.url, got)
+		}
+	}
+}
+
+func TestWebfetchTool_Accept(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"items":[1,2]}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Items: 1, 2</p>"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		cfg      config
+		args     map[string]any
+		expected string
+	}{
+		{name: "default", args: map[string]any{}, expected: "Items: 1, 2"},
+		{name: "server", cfg: config{accept: []string{"application/json"}}, args: map[string]any{}, expected: `{"items":[1,2]}`},
+		{name: "host", cfg: config{acceptRules: []acceptRule{{pattern: "127.0.0.1", types: []string{"application/json"}}}}, args: map[string]any{}, expected: `{"items":[1,2]}`},
+		{name: "call", cfg: config{accept: []string{"application/json"}}, args: map[string]any{"accept": []string{"text/html"}}, expected: "Items: 1, 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := connectTestClient(t, setupMCPServer(tt.cfg))
+			tt.args["url"] = server.URL
+			res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "webfetch", Arguments: tt.args})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.IsError {
+				t.Fatalf("unexpected tool error: %v", res.Content[0].(*mcp.TextContent).Text)
+			}
+			if text := res.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, text)
+			}
+		})
+	}
+
+	session := connectTestClient(t, setupMCPServer(config{}))
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch",
+		Arguments: map[string]any{"url": server.URL, "accept": []string{"json"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.IsError {
+		t.Error("expected an invalid media type to be refused")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"regexp"
+
+	"github.com/benoute/webfetch"
+)
+
+// How URLs are written to the access log
+const (
+	accessLogURLsHash = "hash"
+	accessLogURLsFull = "full"
+)
+
+// accessLog writes one structured record per fetch
+type accessLog struct {
+	logger *slog.Logger
+	// fullURLs logs the full URL instead of the host and a hash of the path
+	fullURLs bool
+	// redactQuery replaces query values when logging full URLs
+	redactQuery bool
+}
+
+// newAccessLog returns an access log writing JSON records to w
+func newAccessLog(w io.Writer, urls string, redactQuery bool) *accessLog {
+	return &accessLog{
+		logger:      slog.New(slog.NewJSONHandler(w, nil)),
+		fullURLs:    urls == accessLogURLsFull,
+		redactQuery: redactQuery,
+	}
+}
+
+// openAccessLog opens the access log destination: "-" for stderr, otherwise a
+// file that is appended to. Stdout is never used as it carries the stdio transport.
+func openAccessLog(path string) (io.Writer, error) {
+	if path == "-" {
+		return os.Stderr, nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open access log: %w", err)
+	}
+	return f, nil
+}
+
+// log records a fetch made by tool for the call requestID of session
+func (a *accessLog) log(session, requestID, tool string, info webfetch.FetchInfo) {
+	attrs := []slog.Attr{
+		slog.String("session", session),
+		slog.String("request_id", requestID),
+		slog.String("tool", tool),
+	}
+
+	if u, err := url.Parse(info.URL); err == nil {
+		if a.fullURLs {
+			attrs = append(attrs, slog.String("url", a.redactURL(u)))
+		} else {
+			attrs = append(attrs,
+				slog.String("host", u.Host),
+				slog.String("path_hash", pathHash(u)),
+			)
+		}
+	}
+
+	attrs = append(attrs,
+		slog.Int("status", info.StatusCode),
+		slog.Int64("bytes", info.Bytes),
+		slog.Float64("duration_ms", milliseconds(info.Duration)),
+		slog.Bool("cached", info.Cached),
+	)
+	if info.Resumes > 0 {
+		attrs = append(attrs, slog.Int("resumes", info.Resumes))
+	}
+
+	level := slog.LevelInfo
+	if info.Err != nil {
+		level = slog.LevelWarn
+		attrs = append(attrs,
+			slog.String("error", a.redactErrorURLs(info.Err.Error())),
+			slog.String("error_class", string(webfetch.ClassifyError(info.Err))),
+		)
+	}
+	a.logger.LogAttrs(context.Background(), level, "fetch", attrs...)
+}
+
+// pathHash returns the hash of the path and query of u logged in place of the
+// full URL
+func pathHash(u *url.URL) string {
+	sum := sha256.Sum256([]byte(u.RequestURI()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// redactURL returns u as logged with full URLs
+func (a *accessLog) redactURL(u *url.URL) string {
+	if a.redactQuery {
+		u.RawQuery = redactQuery(u.Query())
+	}
+	return u.String()
+}
+
+// errorURLs matches the URLs quoted in error messages
+var errorURLs = regexp.MustCompile(`https?://[^\s"']+`)
+
+// redactErrorURLs hides the URLs of an error message as the URL of the fetch
+// is: their path and query are replaced by their hash, or their query values
+// are redacted
+func (a *accessLog) redactErrorURLs(message string) string {
+	if a.fullURLs && !a.redactQuery {
+		return message
+	}
+	return errorURLs.ReplaceAllStringFunc(message, func(raw string) string {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return "[URL]"
+		}
+		if a.fullURLs {
+			return a.redactURL(u)
+		}
+		return u.Scheme + "://" + u.Host + "/[" + pathHash(u) + "]"
+	})
+}
+
+// redactQuery encodes query keeping the parameter names but hiding their values
+func redactQuery(query url.Values) string {
+	for _, values := range query {
+		for i := range values {
+			values[i] = "REDACTED"
+		}
+	}
+	return query.Encode()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestAccessLog(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Hello</p>"))
+	}))
+	defer site.Close()
+
+	tests := []struct {
+		name        string
+		urls        string
+		redactQuery bool
+		check       func(t *testing.T, record map[string]any)
+	}{
+		{
+			name: "hash",
+			urls: accessLogURLsHash,
+			check: func(t *testing.T, record map[string]any) {
+				if _, ok := record["url"]; ok {
+					t.Errorf("expected no full URL, got %v", record["url"])
+				}
+				if record["host"] != strings.TrimPrefix(site.URL, "http://") || record["path_hash"] == "" {
+					t.Errorf("expected host and path hash, got %v", record)
+				}
+			},
+		},
+		{
+			name: "full",
+			urls: accessLogURLsFull,
+			check: func(t *testing.T, record map[string]any) {
+				if record["url"] != site.URL+"/page?token=secret" {
+					t.Errorf("expected full URL, got %v", record["url"])
+				}
+			},
+		},
+		{
+			name:        "full with redacted query",
+			urls:        accessLogURLsFull,
+			redactQuery: true,
+			check: func(t *testing.T, record map[string]any) {
+				if record["url"] != site.URL+"/page?token=REDACTED" {
+					t.Errorf("expected redacted URL, got %v", record["url"])
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			session := connectTestClient(t, setupMCPServer(config{
+				accessLogOutput:      &buf,
+				accessLogURLs:        tt.urls,
+				accessLogRedactQuery: tt.redactQuery,
+			}))
+
+			_, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+				Name:      "webfetch",
+				Arguments: map[string]any{"url": site.URL + "/page?token=secret"},
+			})
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+
+			var record map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+				t.Fatalf("failed to decode access log %q: %v", buf.String(), err)
+			}
+			if record["msg"] != "fetch" || record["tool"] != "webfetch" || record["status"] != float64(200) {
+				t.Errorf("unexpected record: %v", record)
+			}
+			if record["bytes"] != float64(len("<p>Hello</p>")) {
+				t.Errorf("expected bytes to be logged, got %v", record["bytes"])
+			}
+			tt.check(t, record)
+		})
+	}
+}
+
+func TestAccessLog_RedactErrorURLs(t *testing.T) {
+	const message = `Get "https://example.com/page?token=secret": dial tcp: connection refused`
+
+	tests := []struct {
+		name        string
+		urls        string
+		redactQuery bool
+		expected    string
+	}{
+		{name: "hash", urls: accessLogURLsHash, expected: `Get "https://example.com/[` + pathHash(&url.URL{Path: "/page", RawQuery: "token=secret"}) + `]": dial tcp: connection refused`},
+		{name: "full", urls: accessLogURLsFull, expected: message},
+		{name: "full with redacted query", urls: accessLogURLsFull, redactQuery: true, expected: `Get "https://example.com/page?token=REDACTED": dial tcp: connection refused`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAccessLog(io.Discard, tt.urls, tt.redactQuery)
+			if got := a.redactErrorURLs(message); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	// Failed fetches are logged with their class
+	var buf bytes.Buffer
+	a := newAccessLog(&buf, accessLogURLsHash, false)
+	a.log("", "", "webfetch", webfetch.FetchInfo{URL: "https://example.com/page?token=secret", Err: errors.New(message)})
+	if strings.Contains(buf.String(), "secret") || !strings.Contains(buf.String(), `"error_class":`) {
+		t.Errorf("expected a redacted error with its class, got %s", buf.String())
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// defaultArchiveTimeout leaves time for the Wayback Machine to capture a page
+const defaultArchiveTimeout = 2 * time.Minute
+
+type archiveToolInput struct {
+	URL     string `json:"url" jsonschema:"The URL to archive (required)"`
+	Timeout string `json:"timeout,omitempty" jsonschema:"Maximum time to wait for the capture, capped by the server (default: 2m)"`
+}
+
+// parseArchiveKeys parses the access:secret API keys of an archive.org account
+func parseArchiveKeys(s string) (access, secret string, err error) {
+	access, secret, ok := strings.Cut(s, ":")
+	if !ok || access == "" || secret == "" {
+		return "", "", fmt.Errorf("invalid archive keys: expected access:secret")
+	}
+	return access, secret, nil
+}
+
+// addArchiveTool registers the webfetch_archive tool on the server
+func (t *tools) addArchiveTool() {
+	mcp.AddTool(t.server, &mcp.Tool{
+		Name: t.cfg.toolName("webfetch_archive"),
+		Description: "Asks the Wayback Machine to archive a URL and returns the URL of the snapshot, " +
+			"to cite a page as it was read. Captures take up to a minute.",
+	}, func(
+		ctx context.Context,
+		req *mcp.CallToolRequest,
+		input archiveToolInput,
+	) (*mcp.CallToolResult, *webfetch.Snapshot, error) {
+		if input.URL == "" {
+			return toolError("url is required"), nil, nil
+		}
+		timeout := defaultArchiveTimeout
+		if input.Timeout != "" {
+			parsed, err := time.ParseDuration(input.Timeout)
+			if err != nil {
+				return toolError("invalid timeout format: " + err.Error()), nil, nil
+			}
+			timeout = parsed
+		}
+		if t.cfg.maxTimeout > 0 && timeout > t.cfg.maxTimeout {
+			timeout = t.cfg.maxTimeout
+		}
+		if result := t.checkPolicy(ctx, req, "webfetch_archive", input.URL); result != nil {
+			return result, nil, nil
+		}
+
+		snapshot, err := webfetch.Archive(ctx, input.URL, webfetch.ArchiveOptions{
+			FetchOptions: webfetch.FetchOptions{
+				Timeout:             timeout,
+				ConnectTimeout:      t.cfg.connectTimeout,
+				TLSHandshakeTimeout: t.cfg.tlsHandshakeTimeout,
+				UserAgent:           t.cfg.userAgent,
+				Resolver:            t.cfg.resolver,
+				RequestLimiter:      t.requestLimiter,
+				RequestID:           requestID(ctx),
+			},
+			Endpoint:  t.cfg.archiveEndpoint,
+			AccessKey: t.cfg.archiveAccessKey,
+			SecretKey: t.cfg.archiveSecretKey,
+		})
+		if err != nil {
+			return fetchError(err), nil, nil
+		}
+		return nil, snapshot, nil
+	})
+}
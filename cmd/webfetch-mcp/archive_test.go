@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestArchiveTool(t *testing.T) {
+	archive := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/save/https://example.com/" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Location", "/web/20260301120000/https://example.com/")
+	}))
+	defer archive.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{archive: true, archiveEndpoint: archive.URL}))
+	tests := []struct {
+		url       string
+		expected  string
+		expectErr bool
+	}{
+		{url: "https://example.com/", expected: `"snapshot_url":"` + archive.URL + `/web/20260301120000/https://example.com/"`},
+		{url: "https://example.com/busy", expected: "rate limited", expectErr: true},
+	}
+	for _, tt := range tests {
+		res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+			Name:      "webfetch_archive",
+			Arguments: map[string]any{"url": tt.url},
+		})
+		if err != nil {
+			t.Fatalf("CallTool failed: %v", err)
+		}
+		if text := res.Content[0].(*mcp.TextContent).Text; res.IsError != tt.expectErr || !strings.Contains(text, tt.expected) {
+			t.Errorf("%s: expected %q, got %q", tt.url, tt.expected, text)
+		}
+	}
+
+	// The tool is opt-in, as it sends URLs to the Wayback Machine
+	res, err := connectTestClient(t, setupMCPServer(config{})).ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("ListTools failed: %v", err)
+	}
+	for _, tool := range res.Tools {
+		if tool.Name == "webfetch_archive" {
+			t.Error("expected no webfetch_archive tool without -archive")
+		}
+	}
+}
+
+func TestParseArchiveKeys(t *testing.T) {
+	tests := []struct {
+		input     string
+		access    string
+		secret    string
+		expectErr bool
+	}{
+		{input: "access:secret", access: "access", secret: "secret"},
+		{input: "access", expectErr: true},
+		{input: ":secret", expectErr: true},
+	}
+	for _, tt := range tests {
+		access, secret, err := parseArchiveKeys(tt.input)
+		if (err != nil) != tt.expectErr {
+			t.Errorf("parseArchiveKeys(%q): expected error %v, got %v", tt.input, tt.expectErr, err)
+		} else if access != tt.access || secret != tt.secret {
+			t.Errorf("parseArchiveKeys(%q): expected %q, %q, got %q, %q", tt.input, tt.access, tt.secret, access, secret)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/benoute/webfetch"
+)
+
+// Policy decisions recorded in the audit log
+const (
+	decisionAllowed = "allowed"
+	decisionBlocked = "blocked"
+)
+
+// auditRecord is one line of the audit log
+type auditRecord struct {
+	Time      time.Time `json:"time"`
+	Session   string    `json:"session"`
+	RequestID string    `json:"request_id,omitempty"`
+	Tool      string    `json:"tool"`
+	URL       string    `json:"url"`
+	Decision  string    `json:"decision"`
+	Reason    string    `json:"reason,omitempty"`
+	Status    int       `json:"status,omitempty"`
+	Cached    bool      `json:"cached,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// auditLog appends one JSON record per outbound URL and policy decision. It is
+// safe for concurrent use.
+type auditLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	// logger reports the records that could not be written
+	logger *slog.Logger
+}
+
+// newAuditLog returns an audit log writing to w, and reporting write failures
+// to logOutput
+func newAuditLog(w, logOutput io.Writer) *auditLog {
+	return &auditLog{enc: json.NewEncoder(w), logger: slog.New(slog.NewJSONHandler(logOutput, nil))}
+}
+
+// record appends rec to the log
+func (a *auditLog) record(rec auditRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if rec.Time.IsZero() {
+		rec.Time = time.Now().UTC()
+	}
+	if err := a.enc.Encode(rec); err != nil {
+		a.logger.Error("failed to write audit record",
+			slog.String("session", rec.Session),
+			slog.String("request_id", rec.RequestID),
+			slog.String("tool", rec.Tool),
+			slog.String("decision", rec.Decision),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// blocked records a URL denied by policy
+func (a *auditLog) blocked(session, requestID, tool, rawURL string, reason error) {
+	a.record(auditRecord{
+		Session:   session,
+		RequestID: requestID,
+		Tool:      tool,
+		URL:       webfetch.StripUserinfo(rawURL),
+		Decision:  decisionBlocked,
+		Reason:    reason.Error(),
+	})
+}
+
+// fetched records an allowed fetch. Fetches aborted by the blocklist, the
+// policy or a quota were already recorded as blocked, except connections
+// refused by the CIDR rules, which are recorded here with the requested URL.
+func (a *auditLog) fetched(session, requestID, tool string, info webfetch.FetchInfo) {
+	var policyErr *policyError
+	var quotaErr *quotaError
+	if errors.As(info.Err, &policyErr) {
+		if policyErr.dial {
+			a.blocked(session, requestID, tool, info.URL, policyErr)
+		}
+		return
+	}
+	var blocklistErr *blocklistError
+	if errors.As(info.Err, &quotaErr) || errors.As(info.Err, &blocklistErr) {
+		return
+	}
+
+	rec := auditRecord{
+		Session:   session,
+		RequestID: requestID,
+		Tool:      tool,
+		URL:       info.URL,
+		Decision:  decisionAllowed,
+		Status:    info.StatusCode,
+		Cached:    info.Cached,
+	}
+	if info.Err != nil {
+		rec.Error = info.Err.Error()
+	}
+	a.record(rec)
+}
+
+// rotatingFile is an append-only file that is rotated when it would exceed
+// maxSize bytes. Rotated files are renamed path.1, path.2, ... keeping at most
+// maxBackups of them, or all of them when maxBackups is not positive.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// openRotatingFile opens path for appending
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	r.file = f
+	r.size = info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if the file would grow beyond maxSize
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backups, moves the current file to path.1 and reopens path
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+
+	last := r.maxBackups
+	if last > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", r.path, last))
+	} else {
+		// Records are never deleted: every backup shifts
+		last = 1
+		for {
+			if _, err := os.Stat(fmt.Sprintf("%s.%d", r.path, last)); err != nil {
+				break
+			}
+			last++
+		}
+	}
+	for i := last - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return err
+	}
+
+	return r.open()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestAuditLog(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Hello</p>"))
+	}))
+	defer site.Close()
+
+	var buf bytes.Buffer
+	session := connectTestClient(t, setupMCPServer(config{auditLogOutput: &buf}))
+
+	calls := []map[string]any{
+		{"url": site.URL + "/ok"},
+		{"url": site.URL + "/blocked", "headers": map[string]string{"Cookie": "x"}},
+	}
+	for _, args := range calls {
+		if _, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "webfetch", Arguments: args}); err != nil {
+			t.Fatalf("CallTool failed: %v", err)
+		}
+	}
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var rec auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("failed to decode audit record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 audit records, got %d", len(records))
+	}
+	if records[0].URL != site.URL+"/ok" || records[0].Decision != decisionAllowed || records[0].Status != 200 {
+		t.Errorf("unexpected allowed record: %+v", records[0])
+	}
+	if records[1].URL != site.URL+"/blocked" || records[1].Decision != decisionBlocked ||
+		!strings.Contains(records[1].Reason, "Cookie") {
+		t.Errorf("unexpected blocked record: %+v", records[1])
+	}
+	if records[0].RequestID == "" || records[0].RequestID == records[1].RequestID {
+		t.Errorf("expected distinct request IDs, got %q and %q", records[0].RequestID, records[1].RequestID)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	r, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	expected := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+	for name, content := range expected {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		if string(data) != content {
+			t.Errorf("expected %s to contain %q, got %q", name, content, data)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 backups, got %v", err)
+	}
+}
+
+func TestRotatingFile_KeepAll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	r, err := openRotatingFile(path, 10, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	expected := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+		path + ".3": "first\n",
+	}
+	for name, content := range expected {
+		if data, err := os.ReadFile(name); err != nil || string(data) != content {
+			t.Errorf("expected %s to contain %q, got %q (%v)", name, content, data, err)
+		}
+	}
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestAuditLog_WriteError(t *testing.T) {
+	var logOutput bytes.Buffer
+	a := newAuditLog(failingWriter{}, &logOutput)
+	a.record(auditRecord{Session: "s", Tool: "webfetch", URL: "https://example.com/", Decision: decisionAllowed})
+	if !strings.Contains(logOutput.String(), `"msg":"failed to write audit record"`) || !strings.Contains(logOutput.String(), "disk full") {
+		t.Errorf("expected the write failure to be reported, got %q", logOutput.String())
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// maxBatchURLs is the maximum number of URLs of a webfetch_batch call
+const maxBatchURLs = 20
+
+// defaultBatchWorkers is the number of pages fetched at once by a
+// webfetch_batch call unless -batch-workers is set
+const defaultBatchWorkers = 4
+
+type batchToolInput struct {
+	URLs             []string `json:"urls" jsonschema:"The URLs to fetch, at most 20 (required)"`
+	Timeout          string   `json:"timeout,omitempty" jsonschema:"Timeout of each request, capped by the server (default: 5s)"`
+	MaxContentTokens int      `json:"max_content_tokens,omitempty" jsonschema:"Maximum content length of each page, capped by the server content budget split between the pages (default: 100000 split between the pages)"`
+	Cache            string   `json:"cache,omitempty" jsonschema:"Result cache use for each page, as with webfetch: default, bypass, only or refresh (default: default)"`
+}
+
+// batchEntry is the outcome of fetching one URL of a batch
+type batchEntry struct {
+	URL        string              `json:"url"`
+	Fetched    bool                `json:"fetched"`
+	FinalURL   string              `json:"final_url,omitempty"`
+	Cache      string              `json:"cache,omitempty"`
+	Error      string              `json:"error,omitempty"`
+	ErrorClass webfetch.ErrorClass `json:"error_class,omitempty"`
+}
+
+type batchToolOutput struct {
+	Results []batchEntry `json:"results,omitempty"`
+}
+
+// addBatchTool registers the webfetch_batch tool on the server
+func (t *tools) addBatchTool() {
+	mcp.AddTool(t.server, &mcp.Tool{
+		Name: t.cfg.toolName("webfetch_batch"),
+		Description: "Fetches several URLs concurrently and converts them to Markdown as with " + t.cfg.toolName("webfetch") +
+			", returning one section per URL. A page that fails does not fail the others.",
+	}, func(
+		ctx context.Context,
+		req *mcp.CallToolRequest,
+		input batchToolInput,
+	) (*mcp.CallToolResult, *batchToolOutput, error) {
+		if len(input.URLs) == 0 {
+			return toolError("urls is required"), nil, nil
+		}
+		if len(input.URLs) > maxBatchURLs {
+			return toolError(fmt.Sprintf("too many urls: at most %d can be fetched at once", maxBatchURLs)), nil, nil
+		}
+		// Invalid parameters would fail every page
+		if _, err := t.resolveTimeout(input.Timeout); err != nil {
+			return toolError(err.Error()), nil, nil
+		}
+		if _, err := parseCacheMode(input.Cache); err != nil {
+			return toolError(err.Error()), nil, nil
+		}
+
+		input.MaxContentTokens = t.batchMaxContentTokens(input.MaxContentTokens, len(input.URLs))
+
+		output := &batchToolOutput{Results: make([]batchEntry, len(input.URLs))}
+		sections := make([]string, len(input.URLs))
+		workers := t.cfg.batchWorkers
+		if workers <= 0 {
+			workers = defaultBatchWorkers
+		}
+		sem := make(chan struct{}, workers)
+		var wg sync.WaitGroup
+		for i, u := range input.URLs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				output.Results[i], sections[i] = t.batchFetch(ctx, req, input, u)
+			}()
+		}
+		wg.Wait()
+
+		result := &mcp.CallToolResult{}
+		for _, section := range sections {
+			result.Content = append(result.Content, &mcp.TextContent{Text: section})
+		}
+		return result, output, nil
+	})
+}
+
+// batchMaxContentTokens returns the content limit of each of the n pages of a
+// batch: the pages share the content budget of one call, which is
+// -max-content-tokens-limit when set and the default content limit
+// otherwise, so that a batch does not return n times more content than a
+// single fetch
+func (t *tools) batchMaxContentTokens(input, n int) int {
+	budget := t.cfg.maxContentTokensLimit
+	if budget <= 0 {
+		budget = t.resolveMaxContentTokens(0)
+	}
+	return min(t.resolveMaxContentTokens(input), max(budget/n, 1))
+}
+
+// batchFetch fetches u through the webfetch pipeline, so that the blocklist,
+// policy, quotas, cache and post-processing apply, and returns its entry and
+// Markdown section
+func (t *tools) batchFetch(ctx context.Context, req *mcp.CallToolRequest, input batchToolInput, u string) (batchEntry, string) {
+	page, _, _ := t.handleWebfetch(ctx, req, webfetchToolInput{
+		URL:              u,
+		Timeout:          input.Timeout,
+		MaxContentTokens: input.MaxContentTokens,
+		Cache:            input.Cache,
+	})
+	t.recordFetch(ctx, req, "webfetch_batch", u, page, nil)
+	text := page.Content[0].(*mcp.TextContent).Text
+	entry := batchEntry{URL: u}
+	if page.IsError {
+		entry.Error = text
+		if info, ok := page.Meta[errorMetaKey].(errorInfo); ok {
+			entry.ErrorClass = info.Class
+		}
+		return entry, fmt.Sprintf("## %s\n\nFailed: %s", u, text)
+	}
+	entry.Fetched = true
+	entry.FinalURL, _ = page.Meta[finalURLMetaKey].(string)
+	entry.Cache, _ = page.Meta[cacheMetaKey].(string)
+	return entry, fmt.Sprintf("## %s\n\n%s", u, text)
+}
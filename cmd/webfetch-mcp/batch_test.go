@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestBatchTool(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int64
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for m := maxInFlight.Load(); n > m && !maxInFlight.CompareAndSwap(m, n); m = maxInFlight.Load() {
+		}
+		time.Sleep(50 * time.Millisecond)
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<h1>Page ` + r.URL.Path + `</h1>`))
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{batchWorkers: 2}))
+	urls := []string{site.URL + "/a", site.URL + "/missing", site.URL + "/b", site.URL + "/c", site.URL + "/d"}
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch_batch",
+		Arguments: map[string]any{"urls": urls},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected error: %+v", res.Content)
+	}
+
+	var output batchToolOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	json.Unmarshal(data, &output)
+	if len(output.Results) != len(urls) || len(res.Content) != len(urls) {
+		t.Fatalf("expected %d results and sections, got %+v and %d sections", len(urls), output.Results, len(res.Content))
+	}
+	for i, u := range urls {
+		entry := output.Results[i]
+		section := res.Content[i].(*mcp.TextContent).Text
+		if u == site.URL+"/missing" {
+			if entry.Fetched || !strings.Contains(entry.Error, "404") || entry.ErrorClass != webfetch.ErrorPermanent {
+				t.Errorf("expected a permanent 404 error, got %+v", entry)
+			}
+			if !strings.HasPrefix(section, "## "+u+"\n\nFailed: ") {
+				t.Errorf("expected a failed section for %s, got %q", u, section)
+			}
+			continue
+		}
+		expected := "## " + u + "\n\n# Page " + strings.TrimPrefix(u, site.URL)
+		if !entry.Fetched || entry.URL != u || section != expected {
+			t.Errorf("expected %q, got %q and %+v", expected, section, entry)
+		}
+	}
+	if maxInFlight.Load() > 2 {
+		t.Errorf("expected at most 2 concurrent fetches, got %d", maxInFlight.Load())
+	}
+}
+
+func TestBatchTool_Invalid(t *testing.T) {
+	session := connectTestClient(t, setupMCPServer(config{}))
+
+	tests := []struct {
+		name     string
+		args     map[string]any
+		expected string
+	}{
+		{name: "no urls", args: map[string]any{"urls": []string{}}, expected: "urls is required"},
+		{name: "too many urls", args: map[string]any{"urls": make([]string, maxBatchURLs+1)}, expected: "too many urls"},
+		{name: "invalid cache", args: map[string]any{"urls": []string{"https://example.com"}, "cache": "never"}, expected: "unknown cache mode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "webfetch_batch", Arguments: tt.args})
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+			text := res.Content[0].(*mcp.TextContent).Text
+			if !res.IsError || !strings.Contains(text, tt.expected) {
+				t.Errorf("expected error %q, got %q (error %t)", tt.expected, text, res.IsError)
+			}
+		})
+	}
+}
+
+func TestBatchTool_ContentBudget(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(strings.Repeat("a", 100)))
+	}))
+	defer site.Close()
+
+	tests := []struct {
+		name     string
+		cfg      config
+		args     map[string]any
+		expected int
+	}{
+		{name: "default split", cfg: config{maxContentTokens: 40}, args: map[string]any{}, expected: 10},
+		{name: "limit split", cfg: config{maxContentTokensLimit: 80}, args: map[string]any{"max_content_tokens": 1000}, expected: 20},
+		{name: "smaller request", cfg: config{maxContentTokensLimit: 80}, args: map[string]any{"max_content_tokens": 5}, expected: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := connectTestClient(t, setupMCPServer(tt.cfg))
+			tt.args["urls"] = []string{site.URL + "/a", site.URL + "/b", site.URL + "/c", site.URL + "/d"}
+			res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "webfetch_batch", Arguments: tt.args})
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+			for _, content := range res.Content {
+				text := content.(*mcp.TextContent).Text
+				if !strings.Contains(text, "\n\n"+strings.Repeat("a", tt.expected)+"\n\n... (truncated)") {
+					t.Errorf("expected content truncated to %d characters, got %q", tt.expected, text)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// blocklistEntry blocks the hosts matching pattern, explaining why with reason
+type blocklistEntry struct {
+	pattern string
+	reason  string
+}
+
+// blocklistError reports a host on the operator blocklist, with the reason
+// given by the operator
+type blocklistError struct {
+	host   string
+	reason string
+}
+
+func (e *blocklistError) Error() string {
+	return fmt.Sprintf("blocked: %s is on the blocklist (%s)", e.host, e.reason)
+}
+
+// parseBlocklist parses a blocklist file: one host pattern per line, as in the
+// policy file, followed by the reason it is blocked, e.g.
+//
+//	*.example.com  legal: court order 2026-041
+//
+// Blank lines and lines starting with # are ignored.
+func parseBlocklist(data []byte) ([]blocklistEntry, error) {
+	var entries []blocklistEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern := strings.Fields(line)[0]
+		reason := strings.TrimSpace(strings.TrimPrefix(line, pattern))
+		if err := checkHostPattern(pattern); err != nil {
+			return nil, fmt.Errorf("invalid blocklist: line %d: %w", n, err)
+		}
+		if reason == "" {
+			return nil, fmt.Errorf("invalid blocklist: line %d: missing reason for %s", n, pattern)
+		}
+		entries = append(entries, blocklistEntry{pattern: strings.ToLower(pattern), reason: reason})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid blocklist: %w", err)
+	}
+	return entries, nil
+}
+
+// blocklistStore holds the current blocklist, reloading it when its file
+// changes. It is safe for concurrent use.
+type blocklistStore struct {
+	path    string
+	current atomic.Pointer[[]blocklistEntry]
+
+	mu      sync.Mutex
+	modTime time.Time
+}
+
+// newBlocklistStore loads the blocklist file at path
+func newBlocklistStore(path string) (*blocklistStore, error) {
+	s := &blocklistStore{path: path}
+	if _, err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// reload reads the blocklist file if it changed since the last load. On error
+// the current blocklist stays in effect.
+func (s *blocklistStore) reload() (bool, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read blocklist: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current.Load() != nil && info.ModTime().Equal(s.modTime) {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read blocklist: %w", err)
+	}
+	entries, err := parseBlocklist(data)
+	if err != nil {
+		return false, err
+	}
+	s.current.Store(&entries)
+	s.modTime = info.ModTime()
+	return true, nil
+}
+
+// watch reloads the blocklist every interval until ctx is done, logging the outcome
+func (s *blocklistStore) watch(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := s.reload()
+			if err != nil {
+				logger.Warn("blocklist reload failed, keeping current blocklist", "path", s.path, "error", err)
+			} else if reloaded {
+				logger.Info("blocklist reloaded", "path", s.path, "entries", len(*s.current.Load()))
+			}
+		}
+	}
+}
+
+// checkHost returns a *blocklistError if host is on the blocklist. The first
+// matching entry gives the reason.
+func (s *blocklistStore) checkHost(host string) error {
+	host = normalizeHost(host)
+	for _, entry := range *s.current.Load() {
+		if matchHost(entry.pattern, host) {
+			return &blocklistError{host: host, reason: entry.reason}
+		}
+	}
+	return nil
+}
+
+// checkURL returns a *blocklistError if the host of rawURL is on the blocklist
+func (s *blocklistStore) checkURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		// Left for the fetch to report
+		return nil
+	}
+	return s.checkHost(u.Hostname())
+}
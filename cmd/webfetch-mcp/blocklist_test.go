@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestParseBlocklist(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected []blocklistEntry
+		err      string
+	}{
+		{
+			name: "entries",
+			data: "# takedowns\n\nPirate.example  legal: court order 2026-041\n*.spam.example\tabuse: malware distribution\n",
+			expected: []blocklistEntry{
+				{pattern: "pirate.example", reason: "legal: court order 2026-041"},
+				{pattern: "*.spam.example", reason: "abuse: malware distribution"},
+			},
+		},
+		{name: "missing reason", data: "a.example\n", err: "line 1: missing reason"},
+		{name: "invalid pattern", data: "# comment\nhttps://a.example ToS\n", err: "line 2: invalid host pattern"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := parseBlocklist([]byte(tt.data))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(entries) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, entries)
+			}
+			for i := range entries {
+				if entries[i] != tt.expected[i] {
+					t.Errorf("expected %v, got %v", tt.expected[i], entries[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBlocklistStore_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	start := time.Now().Add(-time.Hour)
+	writePolicy(t, path, "a.example ToS: no automated access\n", start)
+
+	store, err := newBlocklistStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = store.checkHost("A.example")
+	if err == nil || err.Error() != "blocked: a.example is on the blocklist (ToS: no automated access)" {
+		t.Errorf("expected a.example to be blocked with its reason, got %v", err)
+	}
+	if store.checkHost("a.example.") == nil {
+		t.Error("expected a.example. to be blocked")
+	}
+
+	writePolicy(t, path, "b.example legal: takedown notice\n", start.Add(time.Minute))
+	if reloaded, err := store.reload(); err != nil || !reloaded {
+		t.Fatalf("expected reload, got %v, %v", reloaded, err)
+	}
+	if store.checkHost("a.example") != nil || store.checkHost("b.example") == nil {
+		t.Error("expected reloaded blocklist to block b.example only")
+	}
+
+	// An invalid file keeps the current blocklist
+	writePolicy(t, path, "c.example\n", start.Add(2*time.Minute))
+	if _, err := store.reload(); err == nil {
+		t.Error("expected error for invalid blocklist")
+	}
+	if store.checkHost("b.example") == nil {
+		t.Error("expected previous blocklist to stay in effect")
+	}
+}
+
+func TestWebfetchTool_Blocklist(t *testing.T) {
+	blocked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>secret</p>"))
+	}))
+	defer blocked.Close()
+	blockedURL, _ := url.Parse(blocked.URL)
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, blocked.URL, http.StatusFound)
+	}))
+	defer site.Close()
+	// Both servers listen on 127.0.0.1, so tell them apart with localhost
+	siteURL := strings.Replace(site.URL, "127.0.0.1", "localhost", 1)
+
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writePolicy(t, path, blockedURL.Hostname()+" legal: court order 2026-041\n", time.Now())
+	store, err := newBlocklistStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var audit bytes.Buffer
+	session := connectTestClient(t, setupMCPServer(config{blocklist: store, auditLogOutput: &audit}))
+
+	for _, target := range []string{blocked.URL, siteURL} {
+		res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+			Name:      "webfetch",
+			Arguments: map[string]any{"url": target},
+		})
+		if err != nil {
+			t.Fatalf("CallTool failed: %v", err)
+		}
+		text := res.Content[0].(*mcp.TextContent).Text
+		if !res.IsError || !strings.Contains(text, "is on the blocklist (legal: court order 2026-041)") {
+			t.Errorf("expected %s to be blocked with its reason, got %q", target, text)
+		}
+	}
+
+	if n := strings.Count(audit.String(), `"decision":"blocked"`); n != 2 {
+		t.Errorf("expected 2 blocked audit records, got %d in %s", n, audit.String())
+	}
+	if strings.Contains(audit.String(), `"decision":"allowed"`) {
+		t.Errorf("expected no allowed audit record, got %s", audit.String())
+	}
+}
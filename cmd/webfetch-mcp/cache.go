@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type cacheToolInput struct {
+	Action string   `json:"action" jsonschema:"One of: list (show cached pages), evict (remove a URL or all pages of a host), clear (remove everything), warm (fetch URLs into the cache)"`
+	URL    string   `json:"url,omitempty" jsonschema:"URL to evict (evict action)"`
+	Host   string   `json:"host,omitempty" jsonschema:"Host whose pages to evict (evict action)"`
+	URLs   []string `json:"urls,omitempty" jsonschema:"URLs to fetch into the cache (warm action)"`
+}
+
+// maxWarmURLs is the maximum number of URLs of a warm action
+const maxWarmURLs = 100
+
+// cacheToolEntry describes a cached page in the list action output
+type cacheToolEntry struct {
+	URL        string  `json:"url"`
+	Size       int     `json:"size"`
+	AgeSeconds float64 `json:"age_seconds"`
+	TTLSeconds float64 `json:"ttl_seconds"`
+}
+
+type cacheToolOutput struct {
+	Entries []cacheToolEntry   `json:"entries,omitempty"`
+	Evicted int                `json:"evicted"`
+	Warmed  int                `json:"warmed,omitempty"`
+	Failed  []cacheWarmFailure `json:"failed,omitempty"`
+}
+
+// addCacheTool registers the webfetch_cache tool on the server
+func (t *tools) addCacheTool() {
+	mcp.AddTool(t.server, &mcp.Tool{
+		Name: t.cfg.toolName("webfetch_cache"),
+		Description: "Inspects, purges and warms the webfetch cache. Evict a URL to force the next fetch " +
+			"to retrieve a fresh copy; warm a list of URLs to make their first fetch instant.",
+	}, func(
+		ctx context.Context,
+		req *mcp.CallToolRequest,
+		input cacheToolInput,
+	) (*mcp.CallToolResult, cacheToolOutput, error) {
+		return t.handleCache(ctx, req, input)
+	})
+}
+
+// sessionCache returns the cache of the session of req: the shared cache, or
+// with -cache-scope session a scope of it isolating the session
+func (t *tools) sessionCache(req *mcp.CallToolRequest) *webfetch.Cache {
+	if t.cache == nil || t.cfg.cacheScope != cacheScopeSession {
+		return t.cache
+	}
+	return t.cache.Scope(sessionID(req))
+}
+
+func (t *tools) handleCache(ctx context.Context, req *mcp.CallToolRequest, input cacheToolInput) (
+	*mcp.CallToolResult,
+	cacheToolOutput,
+	error,
+) {
+	var output cacheToolOutput
+	cache := t.sessionCache(req)
+
+	switch input.Action {
+	case "list":
+		now := time.Now()
+		for _, entry := range cache.Entries() {
+			output.Entries = append(output.Entries, cacheToolEntry{
+				URL:        entry.URL,
+				Size:       entry.Size,
+				AgeSeconds: now.Sub(entry.StoredAt).Round(time.Second).Seconds(),
+				TTLSeconds: entry.ExpiresAt.Sub(now).Round(time.Second).Seconds(),
+			})
+		}
+
+	case "evict":
+		if input.URL == "" && input.Host == "" {
+			return toolError("url or host is required for the evict action"), output, nil
+		}
+		if input.URL != "" {
+			n, err := cache.Evict(input.URL)
+			if err != nil {
+				return toolError(err.Error()), output, nil
+			}
+			output.Evicted += n
+		}
+		if input.Host != "" {
+			output.Evicted += cache.EvictHost(input.Host)
+		}
+
+	case "clear":
+		output.Evicted = cache.Clear()
+
+	case "warm":
+		if len(input.URLs) == 0 {
+			return toolError("urls is required for the warm action"), output, nil
+		}
+		if len(input.URLs) > maxWarmURLs {
+			return toolError(fmt.Sprintf("too many urls: %d (maximum %d)", len(input.URLs), maxWarmURLs)), output, nil
+		}
+		output.Warmed, output.Failed = t.warmCache(ctx, req, input.URLs)
+
+	default:
+		return toolError("unknown action: " + input.Action + " (expected list, evict, clear or warm)"), output, nil
+	}
+
+	return nil, output, nil
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestCacheTool(t *testing.T) {
+	var hits atomic.Int64
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<p>Hello</p>`))
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{cacheTTL: time.Minute}))
+	ctx := context.Background()
+
+	callTool := func(name string, args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+		if err != nil {
+			t.Fatalf("CallTool %s failed: %v", name, err)
+		}
+		if res.IsError {
+			t.Fatalf("unexpected tool error: %v", res.Content[0].(*mcp.TextContent).Text)
+		}
+		return res
+	}
+	cacheOutput := func(res *mcp.CallToolResult) cacheToolOutput {
+		t.Helper()
+		var output cacheToolOutput
+		data, _ := json.Marshal(res.StructuredContent)
+		if err := json.Unmarshal(data, &output); err != nil {
+			t.Fatalf("failed to decode output: %v", err)
+		}
+		return output
+	}
+
+	callTool("webfetch", map[string]any{"url": site.URL + "/a"})
+	callTool("webfetch", map[string]any{"url": site.URL + "/a"})
+	if hits.Load() != 1 {
+		t.Errorf("expected second fetch to be served from cache, got %d requests", hits.Load())
+	}
+
+	list := cacheOutput(callTool("webfetch_cache", map[string]any{"action": "list"}))
+	if len(list.Entries) != 1 || list.Entries[0].URL != site.URL+"/a" || list.Entries[0].Size != 5 {
+		t.Errorf("unexpected cache entries: %+v", list.Entries)
+	}
+
+	evict := cacheOutput(callTool("webfetch_cache", map[string]any{"action": "evict", "url": site.URL + "/a"}))
+	if evict.Evicted != 1 {
+		t.Errorf("expected 1 evicted entry, got %d", evict.Evicted)
+	}
+
+	callTool("webfetch", map[string]any{"url": site.URL + "/a"})
+	if hits.Load() != 2 {
+		t.Errorf("expected fetch after eviction to hit the site, got %d requests", hits.Load())
+	}
+}
+
+func TestCacheTool_DisabledWithoutTTL(t *testing.T) {
+	session := connectTestClient(t, setupMCPServer(config{}))
+
+	res, err := session.ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("ListTools failed: %v", err)
+	}
+	for _, tool := range res.Tools {
+		if tool.Name == "webfetch_cache" {
+			t.Error("expected webfetch_cache tool to be absent when caching is disabled")
+		}
+	}
+}
+
+func TestWebfetchTool_Offline(t *testing.T) {
+	var hits atomic.Int64
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<p>Hello</p>`))
+	}))
+	defer site.Close()
+
+	// An online server fills the store that the offline server reads
+	store := webfetch.NewMemoryStore()
+	online := connectTestClient(t, setupMCPServer(config{cacheTTL: time.Minute, cacheStore: store}))
+	offline := connectTestClient(t, setupMCPServer(config{cacheTTL: time.Minute, cacheStore: store, offline: true}))
+	ctx := context.Background()
+	if _, err := online.CallTool(ctx, &mcp.CallToolParams{Name: "webfetch", Arguments: map[string]any{"url": site.URL + "/a"}}); err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+		isError  bool
+	}{
+		{name: "cached", url: site.URL + "/a", expected: "Hello"},
+		{name: "not cached", url: site.URL + "/b", expected: "not in cache: " + site.URL + "/b", isError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := offline.CallTool(ctx, &mcp.CallToolParams{Name: "webfetch", Arguments: map[string]any{"url": tt.url}})
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+			text := res.Content[0].(*mcp.TextContent).Text
+			if res.IsError != tt.isError || !strings.Contains(text, tt.expected) {
+				t.Errorf("expected %q (error %t), got %q (error %t)", tt.expected, tt.isError, text, res.IsError)
+			}
+		})
+	}
+	if hits.Load() != 1 {
+		t.Errorf("expected no request in offline mode, got %d requests", hits.Load())
+	}
+}
+
+func TestWebfetchTool_CacheMode(t *testing.T) {
+	var hits atomic.Int64
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<p>Version %d</p>", n)
+	}))
+	defer site.Close()
+
+	client := connectTestClient(t, setupMCPServer(config{cacheTTL: time.Minute}))
+	ctx := context.Background()
+
+	// Steps run in order against the same cache
+	tests := []struct {
+		name     string
+		url      string
+		cache    string
+		expected string
+		status   string
+		isError  bool
+	}{
+		{name: "only not cached", url: "/a", cache: "only", expected: "not in cache", isError: true},
+		{name: "default fills the cache", url: "/a", cache: "default", expected: "Version 1", status: "miss"},
+		{name: "only cached", url: "/a", cache: "only", expected: "Version 1", status: "hit"},
+		{name: "bypass", url: "/a", cache: "bypass", expected: "Version 2", status: "bypass"},
+		{name: "bypass does not store", url: "/a", expected: "Version 1", status: "hit"},
+		{name: "refresh", url: "/a", cache: "refresh", expected: "Version 3", status: "miss"},
+		{name: "refresh stores", url: "/a", expected: "Version 3", status: "hit"},
+		{name: "unknown", url: "/a", cache: "never", expected: "unknown cache mode: never", isError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := map[string]any{"url": site.URL + tt.url}
+			if tt.cache != "" {
+				args["cache"] = tt.cache
+			}
+			res, err := client.CallTool(ctx, &mcp.CallToolParams{Name: "webfetch", Arguments: args})
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+			text := res.Content[0].(*mcp.TextContent).Text
+			if res.IsError != tt.isError || !strings.Contains(text, tt.expected) {
+				t.Errorf("expected %q (error %t), got %q (error %t)", tt.expected, tt.isError, text, res.IsError)
+			}
+			if status, _ := res.Meta[cacheMetaKey].(string); status != tt.status {
+				t.Errorf("expected cache status %q in _meta, got %v", tt.status, res.Meta[cacheMetaKey])
+			}
+		})
+	}
+}
+
+func TestWebfetchTool_CacheScope(t *testing.T) {
+	var hits atomic.Int64
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<p>Hello</p>`))
+	}))
+	defer site.Close()
+
+	tests := []struct {
+		name     string
+		scope    string
+		expected int64
+	}{
+		{name: "shared", scope: cacheScopeShared, expected: 1},
+		{name: "session", scope: cacheScopeSession, expected: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits.Store(0)
+			// Sessions have IDs over HTTP only
+			server := setupMCPServer(config{cacheTTL: time.Minute, cacheScope: tt.scope})
+			endpoint := httptest.NewServer(mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, nil))
+			defer endpoint.Close()
+
+			ctx := context.Background()
+			var entries []int
+			for range 2 {
+				client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "v1.0.0"}, nil)
+				session, err := client.Connect(ctx, &mcp.StreamableClientTransport{Endpoint: endpoint.URL}, nil)
+				if err != nil {
+					t.Fatalf("failed to connect client: %v", err)
+				}
+				defer session.Close()
+
+				if _, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "webfetch", Arguments: map[string]any{"url": site.URL}}); err != nil {
+					t.Fatalf("CallTool failed: %v", err)
+				}
+				res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "webfetch_cache", Arguments: map[string]any{"action": "list"}})
+				if err != nil {
+					t.Fatalf("CallTool failed: %v", err)
+				}
+				var output cacheToolOutput
+				data, _ := json.Marshal(res.StructuredContent)
+				json.Unmarshal(data, &output)
+				entries = append(entries, len(output.Entries))
+			}
+
+			if hits.Load() != tt.expected || entries[0] != 1 || entries[1] != 1 {
+				t.Errorf("expected %d requests and one entry per session, got %d requests and %v entries", tt.expected, hits.Load(), entries)
+			}
+		})
+	}
+}
+
+func TestWebfetchTool_StaleWhileRevalidate(t *testing.T) {
+	var hits atomic.Int64
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Cache-Control", "max-age=1")
+		w.Write([]byte(`<p>Hello</p>`))
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{cacheTTL: time.Minute, cacheStaleWhileRevalidate: time.Minute}))
+	call := func() *mcp.CallToolResult {
+		t.Helper()
+		res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+			Name:      "webfetch",
+			Arguments: map[string]any{"url": site.URL, "formats": []string{"metadata"}},
+		})
+		if err != nil {
+			t.Fatalf("CallTool failed: %v", err)
+		}
+		return res
+	}
+
+	if res := call(); res.Meta[staleMetaKey] != nil {
+		t.Errorf("expected a fresh page, got %v", res.Meta)
+	}
+	time.Sleep(1100 * time.Millisecond)
+
+	res := call()
+	var metadata documentMetadata
+	if err := json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &metadata); err != nil {
+		t.Fatalf("failed to decode metadata: %v", err)
+	}
+	stale, _ := res.Meta[staleMetaKey].(map[string]any)
+	if !metadata.Stale || metadata.FetchedAt == "" || stale["fetched_at"] != metadata.FetchedAt {
+		t.Errorf("expected a stale page with its fetch time, got %+v and %v", metadata, res.Meta)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// maxCheckURLs is the maximum number of URLs checked in one call
+const maxCheckURLs = 50
+
+type checkToolInput struct {
+	URLs     []string `json:"urls" jsonschema:"The URLs to check (required, at most 50)"`
+	Timeout  string   `json:"timeout,omitempty" jsonschema:"Timeout of each robots.txt and HEAD request, capped by the server (default: 5s)"`
+	SkipHead bool     `json:"skip_head,omitempty" jsonschema:"Skip the HEAD request and only evaluate scheme, policy and robots.txt"`
+}
+
+// checkStep is the outcome of one check of a URL
+type checkStep struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// checkResult reports whether a URL would be fetched and converted
+type checkResult struct {
+	URL     string      `json:"url"`
+	Allowed bool        `json:"allowed"`
+	Reason  string      `json:"reason,omitempty"`
+	Checks  []checkStep `json:"checks"`
+
+	StatusCode    int    `json:"status_code,omitempty"`
+	ContentType   string `json:"content_type,omitempty"`
+	ContentLength int64  `json:"content_length,omitempty"`
+}
+
+type checkToolOutput struct {
+	Results []checkResult `json:"results"`
+}
+
+// addCheckTool registers the webfetch_check tool on the server
+func (t *tools) addCheckTool() {
+	mcp.AddTool(t.server, &mcp.Tool{
+		Name: t.cfg.toolName("webfetch_check"),
+		Description: "Checks whether URLs would be fetched, without downloading them: scheme, server policy, " +
+			"robots.txt, and content type and size from a HEAD request.",
+	}, func(
+		ctx context.Context,
+		req *mcp.CallToolRequest,
+		input checkToolInput,
+	) (*mcp.CallToolResult, checkToolOutput, error) {
+		return t.handleCheck(ctx, req, input)
+	})
+}
+
+func (t *tools) handleCheck(ctx context.Context, req *mcp.CallToolRequest, input checkToolInput) (
+	*mcp.CallToolResult,
+	checkToolOutput,
+	error,
+) {
+	if len(input.URLs) == 0 {
+		return toolError("urls is required"), checkToolOutput{}, nil
+	}
+	if len(input.URLs) > maxCheckURLs {
+		return toolError(fmt.Sprintf("at most %d urls can be checked at once", maxCheckURLs)), checkToolOutput{}, nil
+	}
+
+	timeout, err := t.resolveTimeout(input.Timeout)
+	if err != nil {
+		return toolError(err.Error()), checkToolOutput{}, nil
+	}
+	opts := t.fetchOptions(ctx, req, "webfetch_check", timeout)
+
+	var output checkToolOutput
+	for _, rawURL := range input.URLs {
+		output.Results = append(output.Results, t.checkURL(ctx, rawURL, opts, !input.SkipHead))
+	}
+	return nil, output, nil
+}
+
+// checkURL runs the checks on rawURL, stopping at the first failing one
+func (t *tools) checkURL(ctx context.Context, rawURL string, opts webfetch.FetchOptions, head bool) checkResult {
+	result := checkResult{URL: rawURL}
+	fail := func(name, detail string) checkResult {
+		result.Checks = append(result.Checks, checkStep{Name: name, Detail: detail})
+		result.Reason = name + ": " + detail
+		return result
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fail("scheme", "only absolute http and https URLs can be fetched")
+	}
+	result.Checks = append(result.Checks, checkStep{Name: "scheme", OK: true})
+
+	if t.cfg.blocklist != nil {
+		if err := t.cfg.blocklist.checkURL(rawURL); err != nil {
+			return fail("policy", err.Error())
+		}
+	}
+	if t.cfg.policy != nil {
+		if err := t.cfg.policy.checkHost(rawURL); err != nil {
+			return fail("policy", err.Error())
+		}
+	}
+	result.Checks = append(result.Checks, checkStep{Name: "policy", OK: true})
+
+	allowed, err := webfetch.RobotsAllowed(ctx, rawURL, opts)
+	if err != nil {
+		return fail("robots", err.Error())
+	}
+	if !allowed {
+		return fail("robots", "disallowed by robots.txt")
+	}
+	result.Checks = append(result.Checks, checkStep{Name: "robots", OK: true})
+
+	if !head {
+		result.Allowed = true
+		return result
+	}
+
+	info, err := webfetch.Head(ctx, rawURL, opts)
+	if err != nil {
+		return fail("head", err.Error())
+	}
+	result.StatusCode = info.StatusCode
+	result.ContentType = info.ContentType
+	if info.ContentLength >= 0 {
+		result.ContentLength = info.ContentLength
+	}
+
+	switch {
+	case info.StatusCode == http.StatusMethodNotAllowed:
+		// Content type and size are unknown, but the URL may still be fetched
+		result.Checks = append(result.Checks, checkStep{Name: "head", OK: true, Detail: "HEAD not supported by the server"})
+		result.Allowed = true
+		return result
+	case info.StatusCode != http.StatusOK:
+		return fail("head", fmt.Sprintf("unexpected status code: %d", info.StatusCode))
+	case !webfetch.SupportsContentType(info.ContentType, opts):
+		return fail("head", "unsupported content type: "+info.ContentType)
+	}
+
+	if maxSize := webfetch.MaxDownloadSize(info.ContentType, opts); info.ContentLength > maxSize {
+		return fail("head", fmt.Sprintf("content too large: %d bytes (max %d bytes)", info.ContentLength, maxSize))
+	}
+	result.Checks = append(result.Checks, checkStep{Name: "head", OK: true})
+
+	result.Allowed = true
+	return result
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestCheckTool(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /secret\n"))
+		case "/doc.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Header().Set("Content-Length", "5000")
+		case "/big":
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Length", "5000")
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			w.Header().Set("Content-Type", "text/html")
+		}
+		if r.Method != http.MethodHead && r.URL.Path != "/robots.txt" {
+			t.Errorf("expected only HEAD requests, got %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{maxPDFSize: 1000, maxDownloadSize: 1000}))
+
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name: "webfetch_check",
+		Arguments: map[string]any{"urls": []string{
+			site.URL + "/page",
+			"ftp://example.com/file",
+			site.URL + "/secret/page",
+			site.URL + "/image.png",
+			site.URL + "/doc.pdf",
+			site.URL + "/big",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+
+	var output checkToolOutput
+	if err := json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &output); err != nil {
+		t.Fatalf("failed to decode output: %v", err)
+	}
+
+	expected := []struct {
+		allowed    bool
+		failedStep string
+	}{
+		{allowed: true},
+		{failedStep: "scheme"},
+		{failedStep: "robots"},
+		{failedStep: "head"},
+		{failedStep: "head"},
+		{failedStep: "head"},
+	}
+	if len(output.Results) != len(expected) {
+		t.Fatalf("expected %d results, got %d", len(expected), len(output.Results))
+	}
+	for i, e := range expected {
+		result := output.Results[i]
+		if result.Allowed != e.allowed {
+			t.Errorf("%s: expected allowed %v, got %+v", result.URL, e.allowed, result)
+			continue
+		}
+		last := result.Checks[len(result.Checks)-1]
+		if !e.allowed && (last.Name != e.failedStep || last.OK) {
+			t.Errorf("%s: expected %s check to fail, got %+v", result.URL, e.failedStep, result.Checks)
+		}
+	}
+	if output.Results[0].ContentType != "text/html" || output.Results[0].StatusCode != 200 {
+		t.Errorf("expected HEAD details, got %+v", output.Results[0])
+	}
+}
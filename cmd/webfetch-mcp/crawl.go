@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type crawlToolInput struct {
+	URL           string `json:"url" jsonschema:"The URL to start crawling from (required)"`
+	Timeout       string `json:"timeout,omitempty" jsonschema:"Per-page request timeout, capped by the server (default: 5s)"`
+	MaxPages      int    `json:"max_pages,omitempty" jsonschema:"Maximum number of pages to fetch (default: 10)"`
+	MaxDepth      int    `json:"max_depth,omitempty" jsonschema:"Maximum number of links to follow from the start URL (default: unlimited)"`
+	MaxTotalBytes int    `json:"max_total_bytes,omitempty" jsonschema:"Stop once the converted pages reach this many bytes (default: unlimited)"`
+	MaxDuration   string `json:"max_duration,omitempty" jsonschema:"Maximum duration of the whole crawl, e.g. 30s (default: unlimited)"`
+
+	StripTrackingParams bool `json:"strip_tracking_params,omitempty" jsonschema:"Treat URLs that only differ by tracking parameters (utm_*, fbclid, ...) as the same page"`
+}
+
+// crawlManifestEntry describes one crawled page registered as an MCP resource.
+// Duplicate pages share the resource of the page they duplicate.
+type crawlManifestEntry struct {
+	URL string `json:"url"`
+	URI string `json:"uri"`
+	// Path is the file the page was written to, with -save-dir
+	Path        string `json:"path,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Size        int    `json:"size"`
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+}
+
+type crawlToolOutput struct {
+	Pages           []crawlManifestEntry `json:"pages"`
+	BudgetExhausted bool                 `json:"budget_exhausted"`
+	StopReason      string               `json:"stop_reason,omitempty"`
+}
+
+// addCrawlTool registers the webfetch_crawl tool on the server
+func (t *tools) addCrawlTool() {
+	mcp.AddTool(t.server, &mcp.Tool{
+		Name: t.cfg.toolName("webfetch_crawl"),
+		Description: "Crawls pages on the same host starting from a URL and converts them to Markdown. " +
+			"Each page is readable as a resource by this session; the result is a manifest of resource URIs to read.",
+	}, func(
+		ctx context.Context,
+		req *mcp.CallToolRequest,
+		input crawlToolInput,
+	) (*mcp.CallToolResult, crawlToolOutput, error) {
+		result, output, err := t.handleCrawl(ctx, req, input)
+		if result != nil && result.IsError {
+			t.recordFetch(ctx, req, "webfetch_crawl", input.URL, result, nil)
+		}
+		return result, output, err
+	})
+	t.addDocumentTemplate("webfetch://crawl/{crawl}/page/{page}", "crawl-page", "Pages of the crawls of "+t.cfg.toolName("webfetch_crawl")+", readable by the session that crawled them")
+}
+
+func (t *tools) handleCrawl(ctx context.Context, req *mcp.CallToolRequest, input crawlToolInput) (
+	*mcp.CallToolResult,
+	crawlToolOutput,
+	error,
+) {
+	if input.URL == "" {
+		return toolError("URL is required"), crawlToolOutput{}, nil
+	}
+
+	timeout, err := t.resolveTimeout(input.Timeout)
+	if err != nil {
+		return toolError(err.Error()), crawlToolOutput{}, nil
+	}
+
+	// Parse crawl duration budget if provided
+	var maxDuration time.Duration
+	if input.MaxDuration != "" {
+		parsedDuration, err := time.ParseDuration(input.MaxDuration)
+		if err != nil {
+			return toolError("invalid max_duration format: " + err.Error()), crawlToolOutput{}, nil
+		}
+		maxDuration = parsedDuration
+	}
+
+	if result := t.checkPolicy(ctx, req, "webfetch_crawl", input.URL); result != nil {
+		return result, crawlToolOutput{}, nil
+	}
+
+	opts := t.fetchOptions(ctx, req, "webfetch_crawl", timeout)
+	opts.Accept = t.cfg.acceptTypes(input.URL)
+	result, err := webfetch.Crawl(ctx, input.URL, webfetch.CrawlOptions{
+		FetchOptions:  opts,
+		MaxPages:      input.MaxPages,
+		MaxDepth:      input.MaxDepth,
+		MaxTotalBytes: input.MaxTotalBytes,
+		MaxDuration:   maxDuration,
+
+		StripTrackingParams: input.StripTrackingParams,
+	})
+	if err != nil {
+		return fetchError(err), crawlToolOutput{}, nil
+	}
+
+	// Register each page as a resource and build the manifest
+	// Random crawl IDs keep the URIs of the pages of other sessions unknown
+	crawlID := rand.Text()
+	output := crawlToolOutput{
+		Pages:           make([]crawlManifestEntry, 0, len(result.Pages)),
+		BudgetExhausted: result.BudgetExhausted,
+		StopReason:      result.StopReason,
+	}
+	uris := make(map[string]string)
+	refused := make(map[string]bool)
+	for i, doc := range result.Pages {
+		t.recordFetch(ctx, req, "webfetch_crawl", doc.URL, nil, doc)
+		if t.noarchive != nil {
+			// Duplicates have the content of a refused page
+			if refused[doc.DuplicateOf] || t.noarchive.check(sessionID(req), requestID(ctx), "webfetch_crawl", doc) != nil {
+				refused[doc.URL] = true
+				continue
+			}
+		}
+		if uri, ok := uris[doc.DuplicateOf]; ok && doc.Content == "" {
+			output.Pages = append(output.Pages, crawlManifestEntry{
+				URL:         doc.URL,
+				URI:         uri,
+				Title:       doc.Title,
+				DuplicateOf: doc.DuplicateOf,
+			})
+			continue
+		}
+		uri := fmt.Sprintf("webfetch://crawl/%s/page/%d", crawlID, i+1)
+		uris[doc.URL] = uri
+		if t.pii != nil {
+			// Cached documents are shared, so the scrubbed content goes in a copy
+			scrubbed := *doc
+			scrubbed.Content = t.pii.scrub(doc.Content)
+			doc = &scrubbed
+		}
+		path, err := t.saveDocument(req, uri, doc)
+		if err != nil {
+			return toolError(err.Error()), crawlToolOutput{}, nil
+		}
+		output.Pages = append(output.Pages, crawlManifestEntry{
+			URL:         doc.URL,
+			URI:         uri,
+			Path:        path,
+			Title:       doc.Title,
+			Size:        len(doc.Content),
+			DuplicateOf: doc.DuplicateOf,
+		})
+	}
+
+	return nil, output, nil
+}
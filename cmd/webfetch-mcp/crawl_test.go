@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// connectTestClient connects an in-memory MCP client to server
+func connectTestClient(t *testing.T, server *mcp.Server) *mcp.ClientSession {
+	t.Helper()
+
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := server.Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatalf("failed to connect server: %v", err)
+	}
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "v1.0.0"}, nil)
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect client: %v", err)
+	}
+	t.Cleanup(func() { session.Close() })
+
+	return session
+}
+
+// connectHTTPTestClient connects a client to server over streamable HTTP,
+// whose sessions have IDs, unlike in-memory ones
+func connectHTTPTestClient(t *testing.T, server *mcp.Server) *mcp.ClientSession {
+	t.Helper()
+
+	endpoint := httptest.NewServer(mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, nil))
+	t.Cleanup(endpoint.Close)
+	client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "v1.0.0"}, nil)
+	session, err := client.Connect(context.Background(), &mcp.StreamableClientTransport{Endpoint: endpoint.URL}, nil)
+	if err != nil {
+		t.Fatalf("failed to connect client: %v", err)
+	}
+	t.Cleanup(func() { session.Close() })
+
+	return session
+}
+
+func TestCrawlTool(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<title>Home</title><a href="/next">Next</a>`))
+		case "/next":
+			w.Write([]byte(`<title>Next</title><p>Second page</p>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{}))
+	ctx := context.Background()
+
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{
+		Name:      "webfetch_crawl",
+		Arguments: map[string]any{"url": site.URL + "/"},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected tool error: %v", res.Content)
+	}
+
+	var output crawlToolOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &output); err != nil {
+		t.Fatalf("failed to decode manifest: %v", err)
+	}
+	if len(output.Pages) != 2 {
+		t.Fatalf("expected 2 pages in manifest, got %d", len(output.Pages))
+	}
+	if output.Pages[1].Title != "Next" || output.Pages[1].URL != site.URL+"/next" {
+		t.Errorf("unexpected manifest entry: %+v", output.Pages[1])
+	}
+
+	read, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: output.Pages[1].URI})
+	if err != nil {
+		t.Fatalf("ReadResource failed: %v", err)
+	}
+	if len(read.Contents) != 1 || read.Contents[0].Text != "Second page" {
+		t.Errorf("unexpected resource contents: %+v", read.Contents)
+	}
+}
+
+func TestCrawlTool_SessionIsolation(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<title>Home</title><p>Home page</p>`))
+	}))
+	defer site.Close()
+
+	saveDir := t.TempDir()
+	server := setupMCPServer(config{saveDir: saveDir})
+	crawling := connectHTTPTestClient(t, server)
+	other := connectHTTPTestClient(t, server)
+	ctx := context.Background()
+
+	res, err := crawling.CallTool(ctx, &mcp.CallToolParams{
+		Name:      "webfetch_crawl",
+		Arguments: map[string]any{"url": site.URL + "/"},
+	})
+	if err != nil || res.IsError {
+		t.Fatalf("unexpected error: %v %+v", err, res)
+	}
+	var output crawlToolOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	json.Unmarshal(data, &output)
+	if len(output.Pages) != 1 {
+		t.Fatalf("expected 1 page, got %+v", output.Pages)
+	}
+	uri := output.Pages[0].URI
+	if !regexp.MustCompile(`^webfetch://crawl/[A-Z2-7]{26}/page/1$`).MatchString(uri) {
+		t.Errorf("expected a random crawl ID, got %s", uri)
+	}
+
+	// Only the crawling session may read the page, which is not listed
+	if _, err := crawling.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri}); err != nil {
+		t.Errorf("ReadResource failed: %v", err)
+	}
+	if _, err := other.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri}); err == nil {
+		t.Errorf("expected the page of another session not to be found")
+	}
+	for _, session := range []*mcp.ClientSession{crawling, other} {
+		if list, err := session.ListResources(ctx, nil); err != nil || len(list.Resources) != 0 {
+			t.Errorf("expected no listed resource, got %+v (%v)", list, err)
+		}
+	}
+
+	// The files of the crawl are removed with its session
+	crawling.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for files, _ := os.ReadDir(saveDir); len(files) != 0; files, _ = os.ReadDir(saveDir) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected no saved file after the session end, got %v", files)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCrawlTool_Duplicates(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="/docs">Docs</a> <a href="/docs?utm_source=nav">Docs again</a>`))
+			return
+		}
+		w.Write([]byte(`<p>Documentation</p>`))
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{}))
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch_crawl",
+		Arguments: map[string]any{"url": site.URL + "/"},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+
+	var output crawlToolOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &output); err != nil {
+		t.Fatalf("failed to decode manifest: %v", err)
+	}
+	if len(output.Pages) != 3 {
+		t.Fatalf("expected 3 pages in manifest, got %d", len(output.Pages))
+	}
+	original, duplicate := output.Pages[1], output.Pages[2]
+	if duplicate.DuplicateOf != original.URL || duplicate.URI != original.URI || duplicate.Size != 0 {
+		t.Errorf("expected %+v to share the resource of %+v", duplicate, original)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckLoopbackAddr(t *testing.T) {
+	tests := []struct {
+		addr      string
+		expectErr bool
+	}{
+		{addr: "localhost:6060", expectErr: false},
+		{addr: "127.0.0.1:6060", expectErr: false},
+		{addr: "[::1]:6060", expectErr: false},
+		{addr: ":6060", expectErr: true},
+		{addr: "0.0.0.0:6060", expectErr: true},
+		{addr: "example.com:6060", expectErr: true},
+		{addr: "localhost", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		err := checkLoopbackAddr(tt.addr)
+		if (err != nil) != tt.expectErr {
+			t.Errorf("checkLoopbackAddr(%q): expected error %v, got %v", tt.addr, tt.expectErr, err)
+		}
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	server := httptest.NewServer(debugHandler())
+	defer server.Close()
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/vars"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected status 200 for %s, got %d", path, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Modes of the webfetch_diff tool
+const (
+	diffModeUnified = "unified"
+	diffModeWords   = "words"
+)
+
+const (
+	// diffContextLines is the number of unchanged lines around each change
+	diffContextLines = 3
+	// maxDiffEdits bounds the edits searched for by diffTokens, beyond which the
+	// rest of the texts is reported as replaced
+	maxDiffEdits = 1000
+)
+
+type diffToolInput struct {
+	URL     string `json:"url" jsonschema:"The URL to fetch and compare with its cached version (required)"`
+	Timeout string `json:"timeout,omitempty" jsonschema:"Request timeout, capped by the server (default: 5s)"`
+	Mode    string `json:"mode,omitempty" jsonschema:"Diff format: unified (changed lines prefixed with - and +) or words (changed words marked inline as [-removed-]{+added+}) (default: unified)"`
+
+	Selector         string   `json:"selector,omitempty" jsonschema:"CSS selector restricting HTML conversion to the matching elements (e.g. #content); compare with the version cached with the same selectors"`
+	ExcludeSelectors []string `json:"exclude_selectors,omitempty" jsonschema:"CSS selectors for HTML elements to drop before conversion (e.g. .comments)"`
+}
+
+type diffToolOutput struct {
+	URL     string `json:"url"`
+	Changed bool   `json:"changed"`
+	// FirstFetch is set when no previous version was cached to compare with
+	FirstFetch        bool   `json:"first_fetch,omitempty"`
+	PreviousFetchedAt string `json:"previous_fetched_at,omitempty"`
+	FetchedAt         string `json:"fetched_at,omitempty"`
+	AddedLines        int    `json:"added_lines"`
+	RemovedLines      int    `json:"removed_lines"`
+}
+
+// addDiffTool registers the webfetch_diff tool on the server
+func (t *tools) addDiffTool() {
+	mcp.AddTool(t.server, &mcp.Tool{
+		Name: t.cfg.toolName("webfetch_diff"),
+		Description: "Fetches a URL and returns the changes of its Markdown since the version in the cache, " +
+			"as a unified or word-level diff, then caches the new version. Use it to find out what changed on a page.",
+	}, func(
+		ctx context.Context,
+		req *mcp.CallToolRequest,
+		input diffToolInput,
+	) (*mcp.CallToolResult, diffToolOutput, error) {
+		result, output, err := t.handleDiff(ctx, req, input)
+		if result != nil && result.IsError {
+			t.recordFetch(ctx, req, "webfetch_diff", input.URL, result, nil)
+		}
+		return result, output, err
+	})
+}
+
+func (t *tools) handleDiff(ctx context.Context, req *mcp.CallToolRequest, input diffToolInput) (
+	*mcp.CallToolResult,
+	diffToolOutput,
+	error,
+) {
+	if input.URL == "" {
+		return toolError("URL is required"), diffToolOutput{}, nil
+	}
+	timeout, err := t.resolveTimeout(input.Timeout)
+	if err != nil {
+		return toolError(err.Error()), diffToolOutput{}, nil
+	}
+	mode := input.Mode
+	if mode == "" {
+		mode = diffModeUnified
+	}
+	if mode != diffModeUnified && mode != diffModeWords {
+		return toolError("unknown mode: " + mode + " (expected unified or words)"), diffToolOutput{}, nil
+	}
+	if result := t.checkPolicy(ctx, req, "webfetch_diff", input.URL); result != nil {
+		return result, diffToolOutput{}, nil
+	}
+
+	opts := t.fetchOptions(ctx, req, "webfetch_diff", timeout)
+	opts.Accept = t.cfg.acceptTypes(input.URL)
+	opts.Selector = input.Selector
+	opts.ExcludeSelectors = input.ExcludeSelectors
+
+	opts.CacheMode = webfetch.CacheOnly
+	previous, err := webfetch.Fetch(ctx, input.URL, opts)
+	if err != nil && !errors.Is(err, webfetch.ErrNotCached) {
+		return fetchError(err), diffToolOutput{}, nil
+	}
+	opts.CacheMode = webfetch.CacheRefresh
+	doc, err := webfetch.Fetch(ctx, input.URL, opts)
+	if err != nil {
+		return fetchError(err), diffToolOutput{}, nil
+	}
+	t.recordFetch(ctx, req, "webfetch_diff", input.URL, nil, doc)
+	if t.noarchive != nil {
+		if err := t.noarchive.check(sessionID(req), requestID(ctx), "webfetch_diff", doc); err != nil {
+			return toolError(err.Error()), diffToolOutput{}, nil
+		}
+	}
+
+	output := diffToolOutput{URL: doc.URL, FetchedAt: formatFetchedAt(doc.FetchedAt)}
+	if previous == nil {
+		output.FirstFetch = true
+		text := fmt.Sprintf("No previous version of %s is cached to compare with. The current version is now cached for the next diff.", input.URL)
+		return textResult(text), output, nil
+	}
+	output.PreviousFetchedAt = formatFetchedAt(previous.FetchedAt)
+	if previous.Content == doc.Content {
+		return textResult("No changes since the cached version fetched at " + output.PreviousFetchedAt + "."), output, nil
+	}
+
+	before, after := previous.Content, doc.Content
+	if t.pii != nil {
+		before, after = t.pii.scrub(before), t.pii.scrub(after)
+	}
+	ops := diffLines(before, after)
+	output.Changed = true
+	for _, op := range ops {
+		switch op.kind {
+		case '+':
+			output.AddedLines++
+		case '-':
+			output.RemovedLines++
+		}
+	}
+
+	header := fmt.Sprintf("--- %s (fetched at %s)\n+++ %s (fetched at %s)\n", input.URL, output.PreviousFetchedAt, input.URL, output.FetchedAt)
+	text := header + formatDiff(ops, mode, diffContextLines)
+	if maxContentTokens := t.resolveMaxContentTokens(0); maxContentTokens > 0 && len(text) > maxContentTokens {
+		text = text[:maxContentTokens] + "\n\n... (truncated)"
+	}
+	return textResult(text), output, nil
+}
+
+// textResult returns a tool result with a single text content block
+func textResult(text string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: text}}}
+}
+
+// diffOp is an edit of a diff: kind is ' ' for a token kept, '-' for a token
+// removed and '+' for a token added
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// diffLines returns the line edits turning a into b
+func diffLines(a, b string) []diffOp {
+	return diffTokens(splitLines(a), splitLines(b))
+}
+
+// splitLines splits s into lines, without line terminators
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffTokens returns the edits turning a into b, using the algorithm of Myers
+// on the tokens between their common prefix and suffix
+func diffTokens(a, b []string) []diffOp {
+	var prefix, suffix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, s := range a[:prefix] {
+		ops = append(ops, diffOp{' ', s})
+	}
+	ops = append(ops, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, s := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', s})
+	}
+	return ops
+}
+
+// myersDiff returns the shortest edits turning a into b, or replaces all of a
+// with b when they take more than maxDiffEdits
+func myersDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	maxD := min(n+m, maxDiffEdits)
+	// v[offset+k] is the furthest x reached on diagonal k = x - y. trace keeps
+	// v[offset-d-1:offset+d+2] before each round d, to walk the path back.
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int
+	for d := 0; d <= maxD; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return myersPath(a, b, trace)
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, n+m)
+	for _, s := range a {
+		ops = append(ops, diffOp{'-', s})
+	}
+	for _, s := range b {
+		ops = append(ops, diffOp{'+', s})
+	}
+	return ops
+}
+
+// myersPath walks back the rounds of myersDiff from the end of a and b
+func myersPath(a, b []string, trace [][]int) []diffOp {
+	var ops []diffOp
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		// v[i] of round d is at v[i+d+1]
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[k-1+d+1] < v[k+1+d+1]) {
+			prevK = k + 1
+		}
+		prevX := v[prevK+d+1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{'+', b[y-1]})
+			} else {
+				ops = append(ops, diffOp{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// formatDiff formats the line edits ops as hunks of changes surrounded by
+// context unchanged lines, in the unified or words mode
+func formatDiff(ops []diffOp, mode string, context int) string {
+	var sb strings.Builder
+	for start := 0; start < len(ops); {
+		// Find the next change, and extend the hunk over changes separated by
+		// at most twice the context
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		last := first
+		for i := first + 1; i < len(ops) && i <= last+2*context+1; i++ {
+			if ops[i].kind != ' ' {
+				last = i
+			}
+		}
+		from, to := max(first-context, 0), min(last+context+1, len(ops))
+
+		// Line numbers of the hunk in both versions
+		aLine, bLine := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				aLine++
+			}
+			if op.kind != '-' {
+				bLine++
+			}
+		}
+		var aCount, bCount int
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		if aCount == 0 {
+			aLine--
+		}
+		if bCount == 0 {
+			bLine--
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", aLine, aCount, bLine, bCount)
+
+		if mode == diffModeWords {
+			writeWordHunk(&sb, ops[from:to])
+		} else {
+			for _, op := range ops[from:to] {
+				sb.WriteByte(op.kind)
+				sb.WriteString(op.text)
+				sb.WriteByte('\n')
+			}
+		}
+		start = to
+	}
+	return sb.String()
+}
+
+// diffWord matches the tokens of word diffs: runs of spaces, words and single
+// punctuation characters
+var diffWord = regexp.MustCompile(`\s+|[\p{L}\p{N}_]+|[^\s\p{L}\p{N}_]`)
+
+// writeWordHunk writes the line edits ops with the changes of each run of
+// changed lines marked inline as [-removed-]{+added+}
+func writeWordHunk(sb *strings.Builder, ops []diffOp) {
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			sb.WriteString(ops[i].text)
+			sb.WriteByte('\n')
+			i++
+			continue
+		}
+		var removed, added []string
+		for ; i < len(ops) && ops[i].kind != ' '; i++ {
+			if ops[i].kind == '-' {
+				removed = append(removed, ops[i].text)
+			} else {
+				added = append(added, ops[i].text)
+			}
+		}
+		a := diffWord.FindAllString(strings.Join(removed, "\n"), -1)
+		b := diffWord.FindAllString(strings.Join(added, "\n"), -1)
+		words := diffTokens(a, b)
+		for j := 0; j < len(words); {
+			kind := words[j].kind
+			var run strings.Builder
+			for ; j < len(words) && words[j].kind == kind; j++ {
+				run.WriteString(words[j].text)
+			}
+			switch kind {
+			case '-':
+				sb.WriteString("[-" + run.String() + "-]")
+			case '+':
+				sb.WriteString("{+" + run.String() + "+}")
+			default:
+				sb.WriteString(run.String())
+			}
+		}
+		sb.WriteByte('\n')
+	}
+}
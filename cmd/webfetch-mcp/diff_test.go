@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestFormatDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		mode     string
+		expected string
+	}{
+		{
+			name:     "identical",
+			a:        "one\ntwo\n",
+			b:        "one\ntwo\n",
+			expected: "",
+		},
+		{
+			name:     "changed line",
+			a:        "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			b:        "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			expected: "@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name:     "separate hunks",
+			a:        "a\n1\n2\n3\n4\n5\n6\n7\n8\nb\n",
+			b:        "1\n2\n3\n4\n5\n6\n7\n8\n",
+			expected: "@@ -1,4 +1,3 @@\n-a\n 1\n 2\n 3\n@@ -7,4 +6,3 @@\n 6\n 7\n 8\n-b\n",
+		},
+		{
+			name:     "added to empty",
+			a:        "",
+			b:        "new\n",
+			expected: "@@ -0,0 +1,1 @@\n+new\n",
+		},
+		{
+			name:     "words",
+			a:        "# Pricing\n\nThe plan costs $10 per month.\n",
+			b:        "# Pricing\n\nThe pro plan costs $12 per month.\n",
+			mode:     diffModeWords,
+			expected: "@@ -1,3 +1,3 @@\n# Pricing\n\nThe {+pro +}plan costs $[-10-]{+12+} per month.\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatDiff(diffLines(tt.a, tt.b), tt.mode, diffContextLines)
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDiffTokens_Shortest(t *testing.T) {
+	a := strings.Split("abcabba", "")
+	b := strings.Split("cbabac", "")
+	ops := diffTokens(a, b)
+
+	var edits int
+	var before, after strings.Builder
+	for _, op := range ops {
+		if op.kind != '+' {
+			before.WriteString(op.text)
+		}
+		if op.kind != '-' {
+			after.WriteString(op.text)
+		}
+		if op.kind != ' ' {
+			edits++
+		}
+	}
+	if before.String() != "abcabba" || after.String() != "cbabac" {
+		t.Errorf("expected edits of abcabba into cbabac, got %q into %q", before.String(), after.String())
+	}
+	if edits != 5 {
+		t.Errorf("expected 5 edits, got %d", edits)
+	}
+}
+
+func TestDiffTool(t *testing.T) {
+	var price atomic.Int64
+	price.Store(10)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<h1>Pricing</h1><p>The plan costs $%d per month.</p>", price.Load())
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{cacheTTL: time.Hour}))
+	diff := func(args map[string]any) (string, diffToolOutput) {
+		t.Helper()
+		res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "webfetch_diff", Arguments: args})
+		if err != nil {
+			t.Fatalf("CallTool failed: %v", err)
+		}
+		if res.IsError {
+			t.Fatalf("unexpected error: %+v", res.Content)
+		}
+		var output diffToolOutput
+		data, _ := json.Marshal(res.StructuredContent)
+		json.Unmarshal(data, &output)
+		return res.Content[0].(*mcp.TextContent).Text, output
+	}
+
+	if _, output := diff(map[string]any{"url": site.URL}); !output.FirstFetch || output.Changed {
+		t.Errorf("expected first fetch, got %+v", output)
+	}
+	if text, output := diff(map[string]any{"url": site.URL}); output.Changed || !strings.HasPrefix(text, "No changes") {
+		t.Errorf("expected no changes, got %+v: %q", output, text)
+	}
+
+	price.Store(12)
+	text, output := diff(map[string]any{"url": site.URL, "mode": "words"})
+	if !output.Changed || output.AddedLines != 1 || output.RemovedLines != 1 {
+		t.Errorf("expected one changed line, got %+v", output)
+	}
+	if !strings.Contains(text, "$[-10-]{+12+} per month") {
+		t.Errorf("expected word diff of the price, got %q", text)
+	}
+
+	// The new version is cached for the next diff
+	if _, output := diff(map[string]any{"url": site.URL}); output.Changed {
+		t.Errorf("expected no changes after the diff, got %+v", output)
+	}
+}
+
+func TestDiffTool_RequiresCache(t *testing.T) {
+	session := connectTestClient(t, setupMCPServer(config{}))
+	res, err := session.ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("ListTools failed: %v", err)
+	}
+	for _, tool := range res.Tools {
+		if tool.Name == "webfetch_diff" {
+			t.Error("expected no webfetch_diff tool without cache")
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+
+	"github.com/benoute/webfetch"
+)
+
+// newResolver returns the resolver of the outbound requests configured by
+// -dns-servers, -dns-doh-url and -hosts-file, or nil to use the system
+// resolver
+func newResolver(cfg config) (*webfetch.Resolver, error) {
+	if len(cfg.dnsServers) == 0 && cfg.dnsDoHURL == "" && cfg.hostsPath == "" {
+		return nil, nil
+	}
+	if len(cfg.dnsServers) > 0 && cfg.dnsDoHURL != "" {
+		return nil, errors.New("-dns-servers and -dns-doh-url are mutually exclusive")
+	}
+
+	resolver := &webfetch.Resolver{Servers: cfg.dnsServers, DoHURL: cfg.dnsDoHURL}
+	if cfg.hostsPath != "" {
+		f, err := os.Open(cfg.hostsPath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		hosts, err := webfetch.ParseHosts(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cfg.hostsPath, err)
+		}
+		resolver.Hosts = hosts
+	}
+	return resolver, nil
+}
+
+// parseDNSServers parses a comma-separated list of DNS server addresses, on
+// port 53 unless given
+func parseDNSServers(s string) ([]string, error) {
+	var servers []string
+	for _, server := range splitList(s) {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		host, _, _ := net.SplitHostPort(server)
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("invalid DNS server %q (expected an IP address, with an optional port)", server)
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+// parseDoHURL checks the URL of a DNS-over-HTTPS endpoint
+func parseDoHURL(s string) (string, error) {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return "", fmt.Errorf("invalid DNS-over-HTTPS URL %q (expected https://host/path)", s)
+	}
+	return s, nil
+}
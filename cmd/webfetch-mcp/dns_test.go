@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestParseDNSServers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+		err      bool
+	}{
+		{input: "10.0.0.2", expected: []string{"10.0.0.2:53"}},
+		{input: "10.0.0.2, 10.0.0.3:5353", expected: []string{"10.0.0.2:53", "10.0.0.3:5353"}},
+		{input: "2001:db8::1,[2001:db8::2]:53", expected: []string{"[2001:db8::1]:53", "[2001:db8::2]:53"}},
+		{input: "dns.example.com", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			servers, err := parseDNSServers(tt.input)
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected an error, got %v", servers)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(servers, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, servers)
+			}
+		})
+	}
+}
+
+func TestParseDoHURL(t *testing.T) {
+	if _, err := parseDoHURL("https://cloudflare-dns.com/dns-query"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, s := range []string{"http://cloudflare-dns.com/dns-query", "cloudflare-dns.com", "https:///dns-query"} {
+		if _, err := parseDoHURL(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	hostsPath := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(hostsPath, []byte("127.0.0.1 wiki.internal\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver, err := newResolver(config{})
+	if err != nil || resolver != nil {
+		t.Errorf("expected no resolver, got %v, %v", resolver, err)
+	}
+	if _, err := newResolver(config{dnsServers: []string{"10.0.0.2:53"}, dnsDoHURL: "https://dns.example/dns-query"}); err == nil {
+		t.Error("expected -dns-servers and -dns-doh-url to be refused together")
+	}
+	if _, err := newResolver(config{hostsPath: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("expected an error for a missing hosts file")
+	}
+
+	resolver, err = newResolver(config{hostsPath: hostsPath})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	addrs, err := resolver.LookupNetIP(context.Background(), "wiki.internal")
+	if err != nil || len(addrs) != 1 || addrs[0] != netip.MustParseAddr("127.0.0.1") {
+		t.Errorf("expected wiki.internal to resolve to 127.0.0.1, got %v, %v", addrs, err)
+	}
+}
+
+func TestWebfetchTool_HostsFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Internal wiki</p>"))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	hostsPath := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(hostsPath, []byte("127.0.0.1 wiki.internal\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resolver, err := newResolver(config{hostsPath: hostsPath})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	session := connectTestClient(t, setupMCPServer(config{resolver: resolver}))
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch",
+		Arguments: map[string]any{"url": "http://wiki.internal:" + port + "/"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected tool error: %v", res.Content)
+	}
+	if text := res.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, "Internal wiki") {
+		t.Errorf("expected the page of wiki.internal, got %q", text)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"math"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// errorMetaKey is the _meta key of tool results classifying the error of a
+// failed fetch
+const errorMetaKey = "error"
+
+// errorInfo tells agents whether and when to retry a failed fetch
+type errorInfo struct {
+	Class     webfetch.ErrorClass `json:"class"`
+	Retryable bool                `json:"retryable"`
+	// RetryAfterSeconds is the delay asked by the server or until the quota
+	// resets, if known
+	RetryAfterSeconds int64 `json:"retry_after_seconds,omitempty"`
+}
+
+// classifyError classifies err like webfetch.ClassifyError, exceeded quotas
+// being transient
+func classifyError(err error) errorInfo {
+	info := errorInfo{Class: webfetch.ClassifyError(err)}
+	var quotaErr *quotaError
+	var statusErr *webfetch.StatusError
+	switch {
+	case errors.As(err, &quotaErr):
+		info.Class = webfetch.ErrorTransient
+		info.RetryAfterSeconds = quotaErr.RetryAfterSeconds
+	case errors.As(err, &statusErr) && statusErr.RetryAfter > 0:
+		info.RetryAfterSeconds = int64(math.Ceil(statusErr.RetryAfter.Seconds()))
+	}
+	info.Retryable = info.Class == webfetch.ErrorTransient
+	return info
+}
+
+// fetchError returns the tool error for a failed fetch, classified in the
+// result _meta so agents can tell whether to retry. Exceeded quotas are also
+// described there.
+func fetchError(err error) *mcp.CallToolResult {
+	result := toolError(err.Error())
+	result.Meta = mcp.Meta{errorMetaKey: classifyError(err)}
+	var quotaErr *quotaError
+	if errors.As(err, &quotaErr) {
+		result.Meta[quotaMetaKey] = quotaErr
+	}
+	return result
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestWebfetchTool_ErrorClass(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/busy":
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	tests := []struct {
+		path       string
+		class      string
+		retryable  bool
+		retryAfter float64
+	}{
+		{path: "/busy", class: "transient", retryable: true, retryAfter: 120},
+		{path: "/missing", class: "permanent"},
+	}
+
+	session := connectTestClient(t, setupMCPServer(config{}))
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+				Name:      "webfetch",
+				Arguments: map[string]any{"url": site.URL + tt.path},
+			})
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+			if !res.IsError {
+				t.Fatalf("expected an error, got %+v", res.Content)
+			}
+			info, ok := res.Meta[errorMetaKey].(map[string]any)
+			if !ok {
+				t.Fatalf("expected error _meta, got %+v", res.Meta)
+			}
+			if info["class"] != tt.class || info["retryable"] != tt.retryable {
+				t.Errorf("expected class %s and retryable %v, got %+v", tt.class, tt.retryable, info)
+			}
+			if retryAfter, _ := info["retry_after_seconds"].(float64); retryAfter != tt.retryAfter {
+				t.Errorf("expected retry after %vs, got %+v", tt.retryAfter, info)
+			}
+		})
+	}
+}
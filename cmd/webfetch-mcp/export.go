@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/benoute/webfetch"
+)
+
+// runExport runs the export command: it crawls the URLs given as arguments
+// and reads the result cache kept in Redis, if any, then writes the pages to a
+// directory with webfetch.Export. It returns the exit status.
+func runExport(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: webfetch-mcp export -out dir [flags] [url ...]")
+		fmt.Fprintln(stderr, "\nWrites the pages crawled from each url, and the pages of the Redis result cache, as Markdown files with front matter and an index.")
+		fs.PrintDefaults()
+	}
+	out := fs.String("out", "", "Directory to write the Markdown files to (required)")
+	redisURL := fs.String("cache-redis-url", "", "Export the result cache kept in this Redis server")
+	userAgent := fs.String("user-agent", webfetch.DefaultUserAgent, "User-Agent for crawl requests")
+	timeout := fs.Duration("timeout", defaultTimeout, "Request timeout")
+	maxPages := fs.Int("max-pages", 10, "Maximum number of pages crawled from each url")
+	maxDepth := fs.Int("max-depth", 0, "Maximum number of links followed from each url (default: no limit)")
+
+	if err := setFlagsFromEnv(fs); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *out == "" {
+		fmt.Fprintln(stderr, "-out is required")
+		return 2
+	}
+	if fs.NArg() == 0 && *redisURL == "" {
+		fmt.Fprintln(stderr, "nothing to export: pass URLs to crawl or -cache-redis-url")
+		return 2
+	}
+
+	var docs []*webfetch.Document
+	seen := make(map[string]bool)
+	add := func(doc *webfetch.Document) {
+		if !seen[doc.URL] {
+			seen[doc.URL] = true
+			docs = append(docs, doc)
+		}
+	}
+
+	ctx := context.Background()
+	for _, rawURL := range fs.Args() {
+		result, err := webfetch.Crawl(ctx, rawURL, webfetch.CrawlOptions{
+			FetchOptions: webfetch.FetchOptions{Timeout: *timeout, UserAgent: *userAgent},
+			MaxPages:     *maxPages,
+			MaxDepth:     *maxDepth,
+		})
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", rawURL, err)
+			return 1
+		}
+		for _, doc := range result.Pages {
+			add(doc)
+		}
+	}
+	if *redisURL != "" {
+		store, err := webfetch.NewRedisStore(*redisURL, redisKeyPrefix)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		// The cache treats store errors as misses, so the store is checked first
+		if _, err := store.Keys(ctx); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		// Entries carry their own expiry time, so the TTL is not used
+		for _, doc := range webfetch.NewCacheWithStore(0, store).Documents() {
+			add(doc)
+		}
+	}
+
+	pages, err := webfetch.Export(*out, docs)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "exported %d pages to %s\n", len(pages), *out)
+	return 0
+}
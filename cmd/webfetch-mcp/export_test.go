@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunExport(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<title>Home</title><p>See <a href="/docs/intro">the intro</a>.</p>`))
+		case "/docs/intro":
+			w.Write([]byte(`<title>Intro</title><p>Welcome</p>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+	host := strings.ReplaceAll(strings.TrimPrefix(site.URL, "http://"), ":", "-")
+
+	tests := []struct {
+		name     string
+		args     []string
+		status   int
+		expected string
+	}{
+		{name: "crawl", args: []string{"-out", "OUT", site.URL + "/"}, status: 0, expected: "exported 2 pages to OUT"},
+		{name: "missing out", args: []string{site.URL}, status: 2, expected: "-out is required"},
+		{name: "nothing to export", args: []string{"-out", "OUT"}, status: 2, expected: "nothing to export"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "snapshot")
+			args := make([]string, len(tt.args))
+			for i, arg := range tt.args {
+				args[i] = strings.ReplaceAll(arg, "OUT", dir)
+			}
+
+			var stdout, stderr bytes.Buffer
+			status := runExport(args, &stdout, &stderr)
+			output := stdout.String() + stderr.String()
+			if status != tt.status || !strings.Contains(output, strings.ReplaceAll(tt.expected, "OUT", dir)) {
+				t.Fatalf("expected status %d and %q, got %d and %q", tt.status, tt.expected, status, output)
+			}
+			if status != 0 {
+				return
+			}
+
+			index, err := os.ReadFile(filepath.Join(dir, "index.md"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expected := "# Index\n\n- [Home](" + host + "/index.md) - <" + site.URL + "/>\n- [Intro](" + host + "/docs/intro.md) - <" + site.URL + "/docs/intro>\n"
+			if string(index) != expected {
+				t.Errorf("expected index %q, got %q", expected, index)
+			}
+			if _, err := os.Stat(filepath.Join(dir, host, "docs", "intro.md")); err != nil {
+				t.Errorf("expected intro page to be exported: %v", err)
+			}
+		})
+	}
+}
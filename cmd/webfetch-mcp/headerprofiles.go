@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// headerProfile adds headers, such as API keys, cookies or a user agent, to
+// the requests to the hosts matching its patterns
+type headerProfile struct {
+	// Hosts are host patterns, as in the policy file
+	Hosts []string `json:"hosts"`
+	// Headers are the headers added to the requests, overriding those of the
+	// call; ${NAME} in a value is replaced by the environment variable NAME
+	Headers map[string]string `json:"headers"`
+}
+
+// headerProfilesFile is the JSON file of -header-profiles
+type headerProfilesFile struct {
+	Profiles []headerProfile `json:"profiles"`
+}
+
+// envReference matches the references to environment variables in header values
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// headerName matches valid header names
+var headerName = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// parseHeaderProfiles decodes and validates a header profiles file, expanding
+// the environment variables of the header values
+func parseHeaderProfiles(data []byte) ([]headerProfile, error) {
+	var file headerProfilesFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid header profiles: %w", err)
+	}
+
+	for i, profile := range file.Profiles {
+		if len(profile.Hosts) == 0 {
+			return nil, fmt.Errorf("invalid header profiles: profile %d has no hosts", i+1)
+		}
+		for j, pattern := range profile.Hosts {
+			if err := checkHostPattern(pattern); err != nil {
+				return nil, fmt.Errorf("invalid header profiles: %w", err)
+			}
+			if !isHostRegexp(pattern) {
+				profile.Hosts[j] = strings.ToLower(pattern)
+			}
+		}
+		headers := make(map[string]string, len(profile.Headers))
+		for name, value := range profile.Headers {
+			if !headerName.MatchString(name) {
+				return nil, fmt.Errorf("invalid header profiles: invalid header name %q", name)
+			}
+			var missing string
+			value = envReference.ReplaceAllStringFunc(value, func(ref string) string {
+				name := envReference.FindStringSubmatch(ref)[1]
+				v, ok := os.LookupEnv(name)
+				if !ok && missing == "" {
+					missing = name
+				}
+				return v
+			})
+			// Credentials must not be sent empty
+			if missing != "" {
+				return nil, fmt.Errorf("invalid header profiles: environment variable %s of header %s is not set", missing, name)
+			}
+			headers[http.CanonicalHeaderKey(name)] = value
+		}
+		file.Profiles[i].Headers = headers
+	}
+	return file.Profiles, nil
+}
+
+// headerProfileStore holds the current header profiles, reloading them when
+// their file changes. It is safe for concurrent use.
+type headerProfileStore struct {
+	path    string
+	current atomic.Pointer[[]headerProfile]
+
+	mu      sync.Mutex
+	modTime time.Time
+}
+
+// newHeaderProfileStore loads the header profiles file at path
+func newHeaderProfileStore(path string) (*headerProfileStore, error) {
+	s := &headerProfileStore{path: path}
+	if _, err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// reload reads the header profiles file if it changed since the last load. On
+// error the current profiles stay in effect.
+func (s *headerProfileStore) reload() (bool, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read header profiles: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current.Load() != nil && info.ModTime().Equal(s.modTime) {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read header profiles: %w", err)
+	}
+	profiles, err := parseHeaderProfiles(data)
+	if err != nil {
+		return false, err
+	}
+	s.current.Store(&profiles)
+	s.modTime = info.ModTime()
+	return true, nil
+}
+
+// watch reloads the header profiles every interval until ctx is done, logging
+// the outcome
+func (s *headerProfileStore) watch(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := s.reload()
+			if err != nil {
+				logger.Warn("header profiles reload failed, keeping current profiles", "path", s.path, "error", err)
+			} else if reloaded {
+				logger.Info("header profiles reloaded", "path", s.path, "profiles", len(*s.current.Load()))
+			}
+		}
+	}
+}
+
+// headers returns the headers of the profiles matching the host of u. When
+// several profiles set a header, the first one gives its value.
+func (s *headerProfileStore) headers(u *url.URL) map[string]string {
+	host := strings.ToLower(u.Hostname())
+	var headers map[string]string
+	for _, profile := range *s.current.Load() {
+		for _, pattern := range profile.Hosts {
+			if !matchHost(pattern, host) {
+				continue
+			}
+			if headers == nil {
+				headers = make(map[string]string)
+			}
+			for name, value := range profile.Headers {
+				if _, ok := headers[name]; !ok {
+					headers[name] = value
+				}
+			}
+			break
+		}
+	}
+	return headers
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestParseHeaderProfiles(t *testing.T) {
+	t.Setenv("WIKI_TOKEN", "t0ken")
+
+	tests := []struct {
+		name     string
+		input    string
+		expected []headerProfile
+		err      string
+	}{
+		{
+			name:  "valid",
+			input: `{"profiles": [{"hosts": ["Wiki.Internal", "*.corp.example"], "headers": {"authorization": "Bearer ${WIKI_TOKEN}", "User-Agent": "acme/1.0"}}]}`,
+			expected: []headerProfile{{
+				Hosts:   []string{"wiki.internal", "*.corp.example"},
+				Headers: map[string]string{"Authorization": "Bearer t0ken", "User-Agent": "acme/1.0"},
+			}},
+		},
+		{name: "unknown field", input: `{"profiles": [{"hosts": ["a.example"], "cookies": {}}]}`, err: "unknown field"},
+		{name: "no hosts", input: `{"profiles": [{"headers": {"X-Api-Key": "k"}}]}`, err: "profile 1 has no hosts"},
+		{name: "invalid pattern", input: `{"profiles": [{"hosts": ["https://a.example"]}]}`, err: "invalid host pattern"},
+		{name: "invalid header", input: `{"profiles": [{"hosts": ["a.example"], "headers": {"X Api Key": "k"}}]}`, err: "invalid header name"},
+		{name: "missing variable", input: `{"profiles": [{"hosts": ["a.example"], "headers": {"X-Api-Key": "${MISSING_API_KEY}"}}]}`, err: "environment variable MISSING_API_KEY of header X-Api-Key is not set"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profiles, err := parseHeaderProfiles([]byte(tt.input))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(profiles, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, profiles)
+			}
+		})
+	}
+}
+
+func TestHeaderProfileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	start := time.Now().Add(-time.Hour)
+	writePolicy(t, path, `{"profiles": [
+		{"hosts": ["api.example.com"], "headers": {"X-Api-Key": "key", "Cookie": "a=1"}},
+		{"hosts": ["*.example.com"], "headers": {"Cookie": "b=2", "User-Agent": "acme/1.0"}}
+	]}`, start)
+
+	store, err := newHeaderProfileStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		url      string
+		expected map[string]string
+	}{
+		{url: "https://API.example.com/v1", expected: map[string]string{"X-Api-Key": "key", "Cookie": "a=1", "User-Agent": "acme/1.0"}},
+		{url: "https://www.example.com/", expected: map[string]string{"Cookie": "b=2", "User-Agent": "acme/1.0"}},
+		{url: "https://example.org/"},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if got := store.headers(u); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("expected %v for %s, got %v", tt.expected, tt.url, got)
+		}
+	}
+
+	writePolicy(t, path, `{"profiles": [{"hosts": ["example.org"], "headers": {"X-Api-Key": "other"}}]}`, start.Add(time.Minute))
+	if reloaded, err := store.reload(); err != nil || !reloaded {
+		t.Fatalf("expected reload, got %v, %v", reloaded, err)
+	}
+	u, _ := url.Parse("https://example.org/")
+	if got := store.headers(u); got["X-Api-Key"] != "other" {
+		t.Errorf("expected the reloaded profiles, got %v", got)
+	}
+
+	// An invalid file keeps the current profiles
+	writePolicy(t, path, `{"profiles": [{"hosts": []}]}`, start.Add(2*time.Minute))
+	if _, err := store.reload(); err == nil {
+		t.Error("expected error for invalid profiles")
+	}
+	if got := store.headers(u); got["X-Api-Key"] != "other" {
+		t.Errorf("expected previous profiles to stay in effect, got %v", got)
+	}
+}
+
+func TestWebfetchTool_HeaderProfiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Internal report</p>"))
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	writePolicy(t, path, `{"profiles": [{"hosts": ["`+serverURL.Hostname()+`"], "headers": {"X-Api-Key": "s3cret"}}]}`, time.Now())
+	store, err := newHeaderProfileStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	session := connectTestClient(t, setupMCPServer(config{headerProfiles: store}))
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch",
+		Arguments: map[string]any{"url": server.URL},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected tool error: %v", res.Content[0].(*mcp.TextContent).Text)
+	}
+	if text := res.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, "Internal report") || strings.Contains(text, "s3cret") {
+		t.Errorf("expected the internal page without the key, got %q", text)
+	}
+}
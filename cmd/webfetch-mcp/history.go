@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// maxHistoryEntries is the number of fetches remembered per session
+const maxHistoryEntries = 1000
+
+// historyEntry records one fetch made on behalf of a session
+type historyEntry struct {
+	Time   time.Time `json:"time"`
+	Tool   string    `json:"tool"`
+	URL    string    `json:"url"`
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	Title  string    `json:"title,omitempty"`
+	Size   int       `json:"size"`
+	Tokens int       `json:"tokens"`
+
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// history keeps the most recent fetches of each session, until it ends. It is
+// safe for concurrent use.
+type history struct {
+	mu       sync.Mutex
+	sessions map[string][]historyEntry
+	// attached holds the sessions whose end drops their history
+	attached map[string]bool
+}
+
+func newHistory() *history {
+	return &history{sessions: make(map[string][]historyEntry), attached: make(map[string]bool)}
+}
+
+// add appends entry to the history of sessionID, dropping the oldest entries
+// beyond maxHistoryEntries
+func (h *history) add(sessionID string, entry historyEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := append(h.sessions[sessionID], entry)
+	if len(entries) > maxHistoryEntries {
+		entries = entries[len(entries)-maxHistoryEntries:]
+	}
+	h.sessions[sessionID] = entries
+}
+
+// attach reports whether the end of sessionID must be awaited to drop its
+// history, i.e. on its first fetch
+func (h *history) attach(sessionID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.attached[sessionID] {
+		return false
+	}
+	h.attached[sessionID] = true
+	return true
+}
+
+// remove drops the history of sessionID, once it ended
+func (h *history) remove(sessionID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.sessions, sessionID)
+	delete(h.attached, sessionID)
+}
+
+// list returns up to limit of the most recent entries of sessionID, oldest first.
+// A limit of zero returns all entries.
+func (h *history) list(sessionID string, limit int) []historyEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := h.sessions[sessionID]
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return append([]historyEntry(nil), entries...)
+}
+
+// restore replaces the history of sessionID with entries, e.g. when resuming
+// the session after a restart
+func (h *history) restore(sessionID string, entries []historyEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(entries) > maxHistoryEntries {
+		entries = entries[len(entries)-maxHistoryEntries:]
+	}
+	h.sessions[sessionID] = entries
+}
+
+// estimateTokens approximates the number of LLM tokens in content (about 4 bytes per token)
+func estimateTokens(content string) int {
+	return (len(content) + 3) / 4
+}
+
+// sessionID returns the ID of the session that made req, or "" for stdio sessions
+func sessionID(req *mcp.CallToolRequest) string {
+	if req == nil {
+		return ""
+	}
+	return serverSessionID(req.Session)
+}
+
+// serverSessionID returns the ID of session, or "" for stdio sessions
+func serverSessionID(session *mcp.ServerSession) string {
+	if session == nil {
+		return ""
+	}
+	return session.ID()
+}
+
+type historyToolInput struct {
+	Limit int `json:"limit,omitempty" jsonschema:"Return only the most recent entries (default: all)"`
+}
+
+type historyToolOutput struct {
+	Entries []historyEntry `json:"entries"`
+}
+
+// addHistoryTool registers the webfetch_history tool on the server
+func (t *tools) addHistoryTool() {
+	mcp.AddTool(t.server, &mcp.Tool{
+		Name: t.cfg.toolName("webfetch_history"),
+		Description: "Lists the URLs fetched in the current session with their time, status and size, " +
+			"to avoid fetching the same page twice.",
+	}, func(
+		ctx context.Context,
+		req *mcp.CallToolRequest,
+		input historyToolInput,
+	) (*mcp.CallToolResult, historyToolOutput, error) {
+		return nil, historyToolOutput{Entries: t.history.list(sessionID(req), input.Limit)}, nil
+	})
+}
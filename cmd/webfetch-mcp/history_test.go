@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestHistory_Limits(t *testing.T) {
+	h := newHistory()
+	for i := range maxHistoryEntries + 5 {
+		h.add("s1", historyEntry{Size: i})
+	}
+	h.add("s2", historyEntry{Size: -1})
+
+	entries := h.list("s1", 0)
+	if len(entries) != maxHistoryEntries {
+		t.Fatalf("expected %d entries, got %d", maxHistoryEntries, len(entries))
+	}
+	if entries[0].Size != 5 {
+		t.Errorf("expected oldest entries to be dropped, first entry has size %d", entries[0].Size)
+	}
+
+	recent := h.list("s1", 2)
+	if len(recent) != 2 || recent[1].Size != maxHistoryEntries+4 {
+		t.Errorf("expected the 2 most recent entries, got %+v", recent)
+	}
+
+	if other := h.list("s2", 0); len(other) != 1 || other[0].Size != -1 {
+		t.Errorf("expected sessions to be isolated, got %+v", other)
+	}
+}
+
+func TestHistoryTool(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<title>Hello</title><p>Hello World</p>`))
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{}))
+	ctx := context.Background()
+
+	for _, path := range []string{"/page", "/missing"} {
+		if _, err := session.CallTool(ctx, &mcp.CallToolParams{
+			Name:      "webfetch",
+			Arguments: map[string]any{"url": site.URL + path},
+		}); err != nil {
+			t.Fatalf("CallTool failed: %v", err)
+		}
+	}
+
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "webfetch_history"})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+
+	var output historyToolOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &output); err != nil {
+		t.Fatalf("failed to decode output: %v", err)
+	}
+
+	if len(output.Entries) != 2 {
+		t.Fatalf("expected 2 history entries, got %d", len(output.Entries))
+	}
+	if e := output.Entries[0]; e.URL != site.URL+"/page" || e.Status != "ok" || e.Size != 11 || e.Tokens != 3 {
+		t.Errorf("unexpected first entry: %+v", e)
+	}
+	if e := output.Entries[1]; e.Status != "error" || e.Error != "unexpected status code: 404" {
+		t.Errorf("unexpected second entry: %+v", e)
+	}
+}
+
+func TestHistory_Remove(t *testing.T) {
+	h := newHistory()
+	h.add("s1", historyEntry{Size: 1})
+	h.add("s2", historyEntry{Size: 2})
+	if !h.attach("s1") || h.attach("s1") {
+		t.Fatal("expected the end of s1 to be awaited once")
+	}
+
+	h.remove("s1")
+	if entries := h.list("s1", 0); len(entries) != 0 {
+		t.Errorf("expected the history of the ended session to be dropped, got %+v", entries)
+	}
+	if entries := h.list("s2", 0); len(entries) != 1 {
+		t.Errorf("expected the other session to keep its history, got %+v", entries)
+	}
+	if !h.attach("s1") {
+		t.Error("expected a new session with the same ID to be awaited again")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Defaults of the limits of the streamable HTTP transport
+const (
+	defaultHTTPMaxBodySize       = 4 * 1024 * 1024
+	defaultHTTPReadHeaderTimeout = 10 * time.Second
+	defaultHTTPReadTimeout       = time.Minute
+	defaultHTTPIdleTimeout       = 2 * time.Minute
+	defaultHTTPRequestTimeout    = 10 * time.Minute
+)
+
+// defaultListenAddr only accepts local connections, as the server fetches URLs
+// on behalf of its clients
+const defaultListenAddr = "127.0.0.1:8080"
+
+// checkListenAddr ensures addr is a host:port address to listen on, where the
+// host is an IP address, a host name or empty for all interfaces
+func checkListenAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+	if port == "" {
+		return fmt.Errorf("invalid listen address %q: missing port", addr)
+	}
+	return nil
+}
+
+// listenNetwork returns the network to listen on addr. An IPv4 address only
+// binds IPv4 and an IPv6 address only IPv6, whereas Go would otherwise make
+// wildcard addresses such as 0.0.0.0 dual-stack; an empty host binds both.
+func listenNetwork(addr string) string {
+	host, _, _ := net.SplitHostPort(addr)
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return "tcp"
+	case ip.To4() != nil:
+		return "tcp4"
+	default:
+		return "tcp6"
+	}
+}
+
+// shutdownTimeout bounds the time the calls in progress have to finish when
+// the server stops
+const shutdownTimeout = 30 * time.Second
+
+// newHTTPServer returns the server of the streamable HTTP transport, applying
+// the HTTP timeouts and request limits of cfg to handler
+func newHTTPServer(cfg config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           limitRequests(handler, cfg.httpMaxBodySize, cfg.httpRequestTimeout),
+		ReadHeaderTimeout: cfg.httpReadHeaderTimeout,
+		ReadTimeout:       cfg.httpReadTimeout,
+		WriteTimeout:      cfg.httpWriteTimeout,
+		IdleTimeout:       cfg.httpIdleTimeout,
+	}
+}
+
+// limitRequests bounds the body of requests to maxBodySize bytes and the time
+// spent handling POST requests, i.e. MCP calls, to timeout, when positive. GET
+// requests open the event streams of sessions, which last as long as the
+// session does.
+func limitRequests(next http.Handler, maxBodySize int64, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if maxBodySize > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		}
+		if timeout > 0 && r.Method == http.MethodPost {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseBasePath normalizes the -base-path flag: a path starting with a slash
+// and without trailing slash, or "" to serve at the root
+func parseBasePath(s string) (string, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "/")
+	if s == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(s, "/") {
+		s = "/" + s
+	}
+	if strings.ContainsAny(s, "?#{} ") || strings.Contains(s, "//") {
+		return "", fmt.Errorf("invalid base path %q", s)
+	}
+	return s, nil
+}
+
+// routeHTTP serves the MCP endpoint at basePath and the health check at
+// basePath/healthz. Without base path, every other path is the MCP endpoint,
+// as clients use various paths such as /mcp.
+func routeHTTP(basePath string, mcpHandler http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+basePath+"/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "ok")
+	})
+	if basePath == "" {
+		mux.Handle("/", mcpHandler)
+	} else {
+		mux.Handle(basePath, mcpHandler)
+		mux.Handle(basePath+"/{$}", mcpHandler)
+	}
+	return mux
+}
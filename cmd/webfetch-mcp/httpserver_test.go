@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimitRequests(t *testing.T) {
+	tests := []struct {
+		name             string
+		method           string
+		body             string
+		expectBodyErr    bool
+		expectedDeadline bool
+	}{
+		{name: "call", method: http.MethodPost, body: "0123456789", expectedDeadline: true},
+		{name: "body too large", method: http.MethodPost, body: "0123456789a", expectBodyErr: true, expectedDeadline: true},
+		{name: "event stream", method: http.MethodGet},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bodyErr error
+			var hasDeadline bool
+			handler := limitRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, bodyErr = io.ReadAll(r.Body)
+				_, hasDeadline = r.Context().Deadline()
+			}), 10, time.Minute)
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, "/mcp", strings.NewReader(tt.body)))
+
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(bodyErr, &maxBytesErr) != tt.expectBodyErr {
+				t.Errorf("expected body error %t, got %v", tt.expectBodyErr, bodyErr)
+			}
+			if hasDeadline != tt.expectedDeadline {
+				t.Errorf("expected deadline %t, got %t", tt.expectedDeadline, hasDeadline)
+			}
+		})
+	}
+}
+
+func TestParseBasePath(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  string
+		expectErr bool
+	}{
+		{input: "", expected: ""},
+		{input: "/", expected: ""},
+		{input: "/mcp/webfetch", expected: "/mcp/webfetch"},
+		{input: "mcp/webfetch/", expected: "/mcp/webfetch"},
+		{input: "/mcp//webfetch", expectErr: true},
+		{input: "/mcp/{name}", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseBasePath(tt.input)
+		if (err != nil) != tt.expectErr {
+			t.Errorf("parseBasePath(%q): expected error %v, got %v", tt.input, tt.expectErr, err)
+		} else if got != tt.expected {
+			t.Errorf("parseBasePath(%q): expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestListenNetwork(t *testing.T) {
+	tests := []struct {
+		addr      string
+		expected  string
+		expectErr bool
+	}{
+		{addr: "127.0.0.1:8080", expected: "tcp4"},
+		{addr: "0.0.0.0:8080", expected: "tcp4"},
+		{addr: "[::1]:8080", expected: "tcp6"},
+		{addr: "[::]:8080", expected: "tcp6"},
+		{addr: ":8080", expected: "tcp"},
+		{addr: "localhost:8080", expected: "tcp"},
+		{addr: "8080", expectErr: true},
+		{addr: "127.0.0.1:", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		err := checkListenAddr(tt.addr)
+		if (err != nil) != tt.expectErr {
+			t.Errorf("checkListenAddr(%q): expected error %v, got %v", tt.addr, tt.expectErr, err)
+		} else if err == nil && listenNetwork(tt.addr) != tt.expected {
+			t.Errorf("listenNetwork(%q): expected %q, got %q", tt.addr, tt.expected, listenNetwork(tt.addr))
+		}
+	}
+}
+
+func TestRouteHTTP(t *testing.T) {
+	mcpHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("mcp"))
+	})
+
+	tests := []struct {
+		name           string
+		basePath       string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "root", path: "/mcp", expectedStatus: http.StatusOK, expectedBody: "mcp"},
+		{name: "root health", path: "/healthz", expectedStatus: http.StatusOK, expectedBody: "ok\n"},
+		{name: "base path", basePath: "/mcp/webfetch", path: "/mcp/webfetch", expectedStatus: http.StatusOK, expectedBody: "mcp"},
+		{name: "trailing slash", basePath: "/mcp/webfetch", path: "/mcp/webfetch/", expectedStatus: http.StatusOK, expectedBody: "mcp"},
+		{name: "base path health", basePath: "/mcp/webfetch", path: "/mcp/webfetch/healthz", expectedStatus: http.StatusOK, expectedBody: "ok\n"},
+		{name: "outside base path", basePath: "/mcp/webfetch", path: "/mcp", expectedStatus: http.StatusNotFound},
+		{name: "below base path", basePath: "/mcp/webfetch", path: "/mcp/webfetch/other", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			routeHTTP(tt.basePath, mcpHandler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedBody != "" && rec.Body.String() != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
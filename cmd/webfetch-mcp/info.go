@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type infoToolInput struct {
+	URL     string `json:"url" jsonschema:"The URL of the document (required)"`
+	Timeout string `json:"timeout,omitempty" jsonschema:"Timeout of each request, capped by the server (default: 5s)"`
+}
+
+// addInfoTool registers the webfetch_info tool on the server
+func (t *tools) addInfoTool() {
+	mcp.AddTool(t.server, &mcp.Tool{
+		Name: t.cfg.toolName("webfetch_info"),
+		Description: "Describes a document without downloading it: content type, size and last modification " +
+			"from a HEAD request, and for PDFs the page count and title read with range requests. " +
+			"Use it to triage large documents before fetching them.",
+	}, func(
+		ctx context.Context,
+		req *mcp.CallToolRequest,
+		input infoToolInput,
+	) (*mcp.CallToolResult, *webfetch.DocumentInfo, error) {
+		if input.URL == "" {
+			return toolError("url is required"), nil, nil
+		}
+		timeout, err := t.resolveTimeout(input.Timeout)
+		if err != nil {
+			return toolError(err.Error()), nil, nil
+		}
+		if result := t.checkPolicy(ctx, req, "webfetch_info", input.URL); result != nil {
+			return result, nil, nil
+		}
+
+		info, err := webfetch.Info(ctx, input.URL, t.fetchOptions(ctx, req, "webfetch_info", timeout))
+		if err != nil {
+			return fetchError(err), nil, nil
+		}
+		return nil, info, nil
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestInfoTool(t *testing.T) {
+	pdf, err := os.ReadFile("../../testdata/test.pdf")
+	if err != nil {
+		t.Fatalf("failed to read test PDF: %v", err)
+	}
+	modified := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.pdf" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		http.ServeContent(w, r, "", modified, bytes.NewReader(pdf))
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{}))
+
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch_info",
+		Arguments: map[string]any{"url": site.URL + "/doc.pdf"},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	var info webfetch.DocumentInfo
+	if err := json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &info); err != nil {
+		t.Fatalf("failed to decode info: %v", err)
+	}
+	expected := webfetch.DocumentInfo{URL: site.URL + "/doc.pdf", ContentType: "application/pdf", Size: int64(len(pdf)), LastModified: modified, Pages: 2}
+	if info != expected {
+		t.Errorf("expected %+v, got %+v", expected, info)
+	}
+
+	res, err = session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch_info",
+		Arguments: map[string]any{"url": site.URL + "/missing.pdf"},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if text := res.Content[0].(*mcp.TextContent).Text; !res.IsError || !strings.Contains(text, "unexpected status code: 404") {
+		t.Errorf("expected status error, got %q", text)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"cmp"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Sizes of the keywords format
+const (
+	maxKeywords        = 10
+	maxEntities        = 10
+	maxKeySentences    = 3
+	minKeySentenceSize = 6
+)
+
+// keywordWord matches the words of a text, with inner apostrophes and hyphens
+var keywordWord = regexp.MustCompile(`[\p{L}\p{N}]+(?:['’-][\p{L}\p{N}]+)*`)
+
+// sentenceEnd matches the end of a sentence followed by the next one
+var sentenceEnd = regexp.MustCompile(`[.!?]+["')\]]*\s+`)
+
+// markdownInline matches the inline code, bare URLs and emphasis markers
+// removed from the text of Markdown lines
+var markdownInline = regexp.MustCompile("`[^`]*`|https?://\\S+|[*_~|\\\\]+")
+
+// stopWords are the common English words that are not keywords
+var stopWords = makeSet(strings.Fields(`a about above after again against all also am an and any are as at be
+because been before being below between both but by can could did do does doing down during each few for
+from further had has have having he her here hers herself him himself his how i if in into is it its itself
+just may me might more most must my myself no nor not now of off on once only or other our ours ourselves
+out over own same shall she should so some such than that the their theirs them themselves then there these
+they this those through to too under until up upon us very was we were what when where which while who whom
+why will with within without would yet you your yours yourself yourselves one two new also however many much
+like can't don't it's i'm you're we're they're isn't aren't wasn't weren't won't`))
+
+func makeSet(words []string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
+// keywordsResult is the JSON representation of the keywords format
+type keywordsResult struct {
+	Keywords     []termCount `json:"keywords"`
+	Entities     []termCount `json:"entities"`
+	KeySentences []string    `json:"key_sentences"`
+}
+
+// termCount is a keyword or entity with its number of occurrences
+type termCount struct {
+	Text  string `json:"text"`
+	Count int    `json:"count"`
+}
+
+// markdownSentence is a sentence of a Markdown document; headings, list items
+// and table cells are sentences of their own
+type markdownSentence struct {
+	text string
+	// prose is set for the sentences of paragraphs, as opposed to headings,
+	// list items and tables
+	prose bool
+}
+
+// markdownSentences returns the sentences of markdown as plain text, code
+// blocks excluded
+func markdownSentences(markdown string) []markdownSentence {
+	var sentences []markdownSentence
+	fence := ""
+	for line := range strings.SplitSeq(markdown, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+
+		prose := true
+		for _, marker := range []string{"#", "- ", "* ", "+ ", "|"} {
+			if strings.HasPrefix(trimmed, marker) {
+				prose = false
+			}
+		}
+		trimmed = strings.TrimLeft(trimmed, "#>-*+ 0123456789.)")
+		trimmed = markdownLink.ReplaceAllString(trimmed, "$1")
+		trimmed = markdownInline.ReplaceAllString(trimmed, " ")
+
+		if !prose {
+			if text := strings.Join(strings.Fields(trimmed), " "); text != "" {
+				sentences = append(sentences, markdownSentence{text: text})
+			}
+			continue
+		}
+		last := 0
+		for _, m := range sentenceEnd.FindAllStringIndex(trimmed, -1) {
+			// A sentence ends before a capital letter or a digit
+			if r, _ := utf8.DecodeRuneInString(trimmed[m[1]:]); !unicode.IsUpper(r) && !unicode.IsDigit(r) {
+				continue
+			}
+			sentences = append(sentences, markdownSentence{text: strings.TrimSpace(trimmed[last:m[1]]), prose: true})
+			last = m[1]
+		}
+		if text := strings.TrimSpace(trimmed[last:]); text != "" {
+			sentences = append(sentences, markdownSentence{text: text, prose: true})
+		}
+	}
+	return sentences
+}
+
+// isCapitalized reports whether word starts with an uppercase letter
+func isCapitalized(word string) bool {
+	r, _ := utf8.DecodeRuneInString(word)
+	return unicode.IsUpper(r)
+}
+
+// isKeywordCandidate reports whether the lowercase word can be a keyword: not
+// a stop word, a number or a single letter
+func isKeywordCandidate(word string) bool {
+	if stopWords[word] || utf8.RuneCountInString(word) < 3 {
+		return false
+	}
+	return strings.ContainsFunc(word, unicode.IsLetter)
+}
+
+// extractKeywords returns the most frequent keywords of markdown, single words
+// and pairs of words repeated together, the names found by capitalization,
+// and the sentences using the most keywords. Stop words are English.
+func extractKeywords(markdown string) keywordsResult {
+	sentences := markdownSentences(markdown)
+
+	words := make(map[string]int)
+	pairs := make(map[string]int)
+	entities := make(map[string]int)
+	// midSentence holds the words seen capitalized after the first word of a
+	// sentence, so that capitalized first words are only names if seen there
+	midSentence := make(map[string]bool)
+	type entityRun struct {
+		text  string
+		first bool
+	}
+	var runs []entityRun
+
+	for _, s := range sentences {
+		tokens := keywordWord.FindAllString(s.text, -1)
+		prev := ""
+		for _, token := range tokens {
+			word := strings.ToLower(token)
+			if !isKeywordCandidate(word) {
+				prev = ""
+				continue
+			}
+			words[word]++
+			if prev != "" {
+				pairs[prev+" "+word]++
+			}
+			prev = word
+		}
+
+		// Titles and list items capitalize words that are not names
+		if !s.prose {
+			continue
+		}
+		var run []string
+		flush := func(end int) {
+			if len(run) > 0 {
+				runs = append(runs, entityRun{text: strings.Join(run, " "), first: end == len(run)})
+			}
+			run = nil
+		}
+		for i, token := range tokens {
+			if !isCapitalized(token) || (i == 0 && stopWords[strings.ToLower(token)]) {
+				flush(i)
+				continue
+			}
+			if i > 0 {
+				midSentence[token] = true
+			}
+			run = append(run, token)
+		}
+		flush(len(tokens))
+	}
+	for _, run := range runs {
+		if run.first && !strings.Contains(run.text, " ") && !midSentence[run.text] {
+			continue
+		}
+		entities[run.text]++
+	}
+
+	// Pairs repeated in the text rank above their words
+	var candidates []termCount
+	for pair, count := range pairs {
+		if count > 1 {
+			candidates = append(candidates, termCount{Text: pair, Count: count})
+		}
+	}
+	for word, count := range words {
+		candidates = append(candidates, termCount{Text: word, Count: count})
+	}
+	score := func(t termCount) int { return t.Count * (strings.Count(t.Text, " ") + 1) }
+	slices.SortFunc(candidates, func(a, b termCount) int {
+		return cmp.Or(cmp.Compare(score(b), score(a)), cmp.Compare(a.Text, b.Text))
+	})
+	result := keywordsResult{Keywords: []termCount{}, Entities: []termCount{}, KeySentences: []string{}}
+	for _, c := range candidates {
+		if len(result.Keywords) == maxKeywords {
+			break
+		}
+		if slices.ContainsFunc(result.Keywords, func(k termCount) bool { return isPairWord(k.Text, c.Text) }) {
+			continue
+		}
+		result.Keywords = append(result.Keywords, c)
+	}
+
+	for text, count := range entities {
+		result.Entities = append(result.Entities, termCount{Text: text, Count: count})
+	}
+	slices.SortFunc(result.Entities, func(a, b termCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Text, b.Text))
+	})
+	result.Entities = result.Entities[:min(len(result.Entities), maxEntities)]
+
+	// Key sentences use the keywords most, relative to their length
+	keywordWeight := make(map[string]int)
+	for _, k := range result.Keywords {
+		for word := range strings.SplitSeq(k.Text, " ") {
+			keywordWeight[word] = max(keywordWeight[word], words[word])
+		}
+	}
+	type scored struct {
+		index int
+		score float64
+	}
+	var ranked []scored
+	for i, s := range sentences {
+		tokens := keywordWord.FindAllString(s.text, -1)
+		if !s.prose || len(tokens) < minKeySentenceSize {
+			continue
+		}
+		total := 0
+		for _, token := range tokens {
+			total += keywordWeight[strings.ToLower(token)]
+		}
+		if total > 0 {
+			ranked = append(ranked, scored{index: i, score: float64(total) / float64(len(tokens))})
+		}
+	}
+	slices.SortStableFunc(ranked, func(a, b scored) int { return cmp.Compare(b.score, a.score) })
+	ranked = ranked[:min(len(ranked), maxKeySentences)]
+	slices.SortFunc(ranked, func(a, b scored) int { return cmp.Compare(a.index, b.index) })
+	for _, r := range ranked {
+		result.KeySentences = append(result.KeySentences, sentences[r.index].text)
+	}
+	return result
+}
+
+// isPairWord reports whether word is one of the words of pair, or pair one of
+// the words of word
+func isPairWord(pair, word string) bool {
+	if strings.Contains(word, " ") {
+		pair, word = word, pair
+	}
+	if !strings.Contains(pair, " ") {
+		return false
+	}
+	first, second, _ := strings.Cut(pair, " ")
+	return word == first || word == second
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestMarkdownSentences(t *testing.T) {
+	markdown := "# The Title\n\nFirst sentence, see [the docs](https://example.com). Second one! third part.\n\n```\ncode. Here\n```\n\n- A list item. With two\n"
+	expected := []markdownSentence{
+		{text: "The Title"},
+		{text: "First sentence, see the docs.", prose: true},
+		{text: "Second one! third part.", prose: true},
+		{text: "A list item. With two"},
+	}
+	if got := markdownSentences(markdown); !slices.Equal(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestExtractKeywords(t *testing.T) {
+	markdown := `# River Survey
+
+The Thames survey measured water quality along the river for two years.
+Water quality improved in every section of the river. The survey was funded by the Environment Agency.
+Researchers at Oxford University published the water quality data in March. Thames fishermen welcomed the news.
+It rained.`
+
+	result := extractKeywords(markdown)
+
+	keywords := make([]string, 0, len(result.Keywords))
+	for _, k := range result.Keywords {
+		keywords = append(keywords, k.Text)
+	}
+	if expected := []string{"water quality", "river", "survey", "thames"}; !slices.Equal(keywords[:len(expected)], expected) {
+		t.Errorf("expected keywords starting with %v, got %v", expected, keywords)
+	}
+
+	entities := make(map[string]int)
+	for _, e := range result.Entities {
+		entities[e.Text] = e.Count
+	}
+	for name, count := range map[string]int{"Thames": 2, "Environment Agency": 1, "Oxford University": 1, "March": 1} {
+		if entities[name] != count {
+			t.Errorf("expected entity %q %d times, got %v", name, count, result.Entities)
+		}
+	}
+	if _, ok := entities["Water"]; ok {
+		t.Errorf("expected no capitalized first word in entities, got %v", result.Entities)
+	}
+	if _, ok := entities["River Survey"]; ok {
+		t.Errorf("expected no heading in entities, got %v", result.Entities)
+	}
+
+	expected := []string{
+		"The Thames survey measured water quality along the river for two years.",
+		"Water quality improved in every section of the river.",
+		"Researchers at Oxford University published the water quality data in March.",
+	}
+	if !slices.Equal(result.KeySentences, expected) {
+		t.Errorf("expected key sentences %q, got %q", expected, result.KeySentences)
+	}
+}
+
+func TestWebfetchTool_KeywordsFormat(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<p>Intro text.</p><p>Later the Danube flooded, and the Danube floods were measured.</p>")
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{}))
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch",
+		Arguments: map[string]any{"url": site.URL, "formats": []string{"keywords"}, "max_length": 5},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected error: %+v", res.Content)
+	}
+
+	// Keywords describe the whole page, beyond max_length
+	var result keywordsResult
+	if err := json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result); err != nil {
+		t.Fatalf("invalid keywords block: %v", err)
+	}
+	if len(result.Keywords) == 0 || result.Keywords[0].Text != "danube" {
+		t.Errorf("expected danube as first keyword, got %+v", result.Keywords)
+	}
+	if !slices.Equal(result.Entities, []termCount{{Text: "Danube", Count: 2}}) {
+		t.Errorf("expected the Danube entity, got %+v", result.Entities)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type llmsTxtToolInput struct {
+	URL        string `json:"url" jsonschema:"Any URL of the site (required)"`
+	Timeout    string `json:"timeout,omitempty" jsonschema:"Timeout of each request, capped by the server (default: 5s)"`
+	Full       bool   `json:"full,omitempty" jsonschema:"Return the content of llms-full.txt, the curated content of the whole site in one document, instead of the llms.txt index"`
+	StartIndex int    `json:"start_index,omitempty" jsonschema:"Return content starting at this character index, useful to continue a truncated result (default: 0)"`
+	MaxLength  int    `json:"max_length,omitempty" jsonschema:"Maximum number of characters to return from start_index (default: server content limit)"`
+}
+
+// addLLMsTxtTool registers the webfetch_llms_txt tool on the server
+func (t *tools) addLLMsTxtTool() {
+	mcp.AddTool(t.server, &mcp.Tool{
+		Name: t.cfg.toolName("webfetch_llms_txt"),
+		Description: "Discovers the llms.txt file of a site: an index of Markdown pages curated by its authors for language models, " +
+			"and llms-full.txt with all of that content in one document. When a site has them, prefer the pages they list " +
+			"to scraping its HTML pages.",
+	}, func(
+		ctx context.Context,
+		req *mcp.CallToolRequest,
+		input llmsTxtToolInput,
+	) (*mcp.CallToolResult, *webfetch.LLMsTxt, error) {
+		result, output := t.handleLLMsTxt(ctx, req, input)
+		t.recordFetch(ctx, req, "webfetch_llms_txt", input.URL, result, nil)
+		return result, output, nil
+	})
+}
+
+func (t *tools) handleLLMsTxt(ctx context.Context, req *mcp.CallToolRequest, input llmsTxtToolInput) (*mcp.CallToolResult, *webfetch.LLMsTxt) {
+	if input.URL == "" {
+		return toolError("url is required"), nil
+	}
+	timeout, err := t.resolveTimeout(input.Timeout)
+	if err != nil {
+		return toolError(err.Error()), nil
+	}
+	if input.StartIndex < 0 || input.MaxLength < 0 {
+		return toolError("start_index and max_length must not be negative"), nil
+	}
+	if result := t.checkPolicy(ctx, req, "webfetch_llms_txt", input.URL); result != nil {
+		return result, nil
+	}
+
+	opts := t.fetchOptions(ctx, req, "webfetch_llms_txt", timeout)
+	info, err := webfetch.DiscoverLLMsTxt(ctx, input.URL, opts)
+	if err != nil {
+		return fetchError(err), nil
+	}
+	host := input.URL
+	if u, err := url.Parse(input.URL); err == nil {
+		host = u.Host
+	}
+
+	var text string
+	switch {
+	case input.Full && info.FullURL == "":
+		return toolError("no llms-full.txt found on " + host), nil
+	case input.Full:
+		opts.Raw = true
+		doc, err := webfetch.Fetch(ctx, info.FullURL, opts)
+		if err != nil {
+			return fetchError(err), nil
+		}
+		text = doc.Content
+	case info.URL == "" && info.FullURL != "":
+		text = "No llms.txt found on " + host + ", but it has an llms-full.txt: call again with full set to read it."
+	case info.URL == "":
+		text = "No llms.txt found on " + host + "."
+	default:
+		text = info.Content
+	}
+	if t.pii != nil {
+		text = t.pii.scrub(text)
+	}
+
+	maxContentTokens := t.resolveMaxContentTokens(0)
+	if input.StartIndex > 0 || input.MaxLength > 0 {
+		maxLength := maxContentTokens
+		if input.MaxLength > 0 {
+			// max_length is capped by -max-content-tokens-limit too
+			maxLength = t.resolveMaxContentTokens(input.MaxLength)
+		}
+		text = paginateContent(text, input.StartIndex, maxLength)
+	} else if maxContentTokens > 0 && len(text) > maxContentTokens {
+		text = paginateContent(text, 0, maxContentTokens)
+	}
+	return textResult(text), info
+}
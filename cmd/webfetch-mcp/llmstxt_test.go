@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestLLMsTxtTool(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/llms.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("# Example\n\n> Example docs.\n\n## Docs\n\n- [Guide](/guide.md): Getting started\n"))
+		case "/llms-full.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("# Guide\n\nThe whole guide."))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{}))
+	call := func(args map[string]any) (string, webfetch.LLMsTxt) {
+		t.Helper()
+		res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "webfetch_llms_txt", Arguments: args})
+		if err != nil {
+			t.Fatalf("CallTool failed: %v", err)
+		}
+		if res.IsError {
+			t.Fatalf("unexpected error: %+v", res.Content)
+		}
+		var output webfetch.LLMsTxt
+		data, _ := json.Marshal(res.StructuredContent)
+		json.Unmarshal(data, &output)
+		return res.Content[0].(*mcp.TextContent).Text, output
+	}
+
+	text, output := call(map[string]any{"url": site.URL + "/docs/page"})
+	if output.URL != site.URL+"/llms.txt" || output.FullURL != site.URL+"/llms-full.txt" {
+		t.Errorf("expected llms.txt and llms-full.txt, got %+v", output)
+	}
+	if len(output.Links) != 1 || output.Links[0].URL != site.URL+"/guide.md" {
+		t.Errorf("expected the guide link, got %+v", output.Links)
+	}
+	if !strings.HasPrefix(text, "# Example") {
+		t.Errorf("expected the llms.txt content, got %q", text)
+	}
+
+	if text, _ := call(map[string]any{"url": site.URL, "full": true, "start_index": 9}); text != "The whole guide." {
+		t.Errorf("expected the llms-full.txt content from index 9, got %q", text)
+	}
+}
+
+func TestLLMsTxtTool_Missing(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body>Home</body></html>"))
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{}))
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "webfetch_llms_txt", Arguments: map[string]any{"url": site.URL}})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if text := res.Content[0].(*mcp.TextContent).Text; res.IsError || !strings.HasPrefix(text, "No llms.txt found") {
+		t.Errorf("expected no llms.txt, got %q", text)
+	}
+
+	res, err = session.CallTool(context.Background(), &mcp.CallToolParams{Name: "webfetch_llms_txt", Arguments: map[string]any{"url": site.URL, "full": true}})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if !res.IsError {
+		t.Errorf("expected an error without llms-full.txt, got %+v", res.Content)
+	}
+}
@@ -2,34 +2,779 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/benoute/webfetch"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/rs/cors"
 )
 
-func parseFlags() (isHttp bool, port string) {
-	flag.BoolVar(&isHttp, "http", false, "Run as streamable HTTP instead of stdio")
-	flag.StringVar(&port, "port", "8080", "Port to listen on for streamable HTTP")
+// config holds the server configuration parsed from the command line
+type config struct {
+	http bool
+	// listen is the host:port address serving streamable HTTP
+	listen string
+	// tlsCertPath and tlsKeyPath serve HTTPS when set; tlsClientCAPath then
+	// requires client certificates issued by its CAs
+	tlsCertPath     string
+	tlsKeyPath      string
+	tlsClientCAPath string
+	// basePath is the path of the MCP endpoint behind a reverse proxy, e.g.
+	// /mcp/webfetch, or "" to serve it on every path
+	basePath string
+	// socket is the path of the Unix domain socket serving streamable HTTP
+	// instead of listen, if set
+	socket string
+	// httpMaxBodySize and the HTTP timeouts limit the requests of the
+	// streamable HTTP transport when positive
+	httpMaxBodySize       int64
+	httpReadHeaderTimeout time.Duration
+	httpReadTimeout       time.Duration
+	httpWriteTimeout      time.Duration
+	httpIdleTimeout       time.Duration
+	httpRequestTimeout    time.Duration
+
+	// sessionStorePath is the directory or Redis URL keeping the state of HTTP
+	// sessions across restarts, if set
+	sessionStorePath string
+	sessionTTL       time.Duration
+	// sessions saves the state of HTTP sessions; opened by main from
+	// sessionStorePath
+	sessions *sessionPersistence
+	// toolPrefix replaces the webfetch stem of tool names when set, e.g. "web."
+	// names the webfetch_crawl tool web.crawl
+	toolPrefix string
+
+	// allowedHeaders lists the header names agents may set per call
+	allowedHeaders []string
+	// userAgent is the User-Agent sent when the call does not set one
+	userAgent string
+	// userAgentPattern must fully match per-call user agents; nil rejects them all
+	userAgentPattern *regexp.Regexp
+
+	// cacheTTL enables the result cache when positive
+	cacheTTL time.Duration
+	// cacheMinTTL and cacheMaxTTL bound the cache lifetimes declared by
+	// responses when positive
+	cacheMinTTL time.Duration
+	cacheMaxTTL time.Duration
+	// cacheStaleWhileRevalidate is how long expired pages are served while
+	// they are refreshed in the background
+	cacheStaleWhileRevalidate time.Duration
+	// cacheRevalidate is how long expired pages with an ETag or
+	// Last-Modified header are kept to be revalidated
+	cacheRevalidate time.Duration
+	// cacheMaxEntries and cacheMaxBytes bound the in-memory cache when positive
+	cacheMaxEntries int
+	cacheMaxBytes   int64
+	// cacheMaxEntrySize is the maximum size of a cached page when positive
+	cacheMaxEntrySize int
+	// cacheRedisURL is the Redis server sharing the result cache between
+	// replicas, the cache being kept in memory when empty
+	cacheRedisURL string
+	// cacheDir is the directory keeping the result cache across restarts
+	cacheDir string
+	// cacheStore holds the result cache; opened by main from cacheRedisURL
+	// or cacheDir
+	cacheStore webfetch.CacheStore
+	// cacheWarmPath lists URLs fetched into the cache at startup
+	cacheWarmPath string
+	// cacheWarmURLs holds the URLs of cacheWarmPath; read by main
+	cacheWarmURLs []string
+	// cacheScope is cacheScopeSession to isolate the cache of each session
+	cacheScope string
+	// offline serves pages only from the result cache, without requests
+	offline bool
+
+	// stripTracking selects where tracking parameters are removed: in links
+	// (stripTrackingLinks), also in fetched URLs (stripTrackingAll), or nowhere
+	stripTracking string
+	// trackingParams replaces the default tracking parameter patterns when set
+	trackingParams []string
+	// scrubPII holds the categories of personal data masked in returned content
+	scrubPII map[string]bool
+	// noarchive selects how pages marked noindex or noarchive are handled: one
+	// of noarchiveIgnore, noarchiveNoCache or noarchiveRefuse
+	noarchive string
+
+	// timeout is the request timeout used when the call does not set one
+	timeout time.Duration
+	// maxTimeout caps per-call timeouts when positive
+	maxTimeout time.Duration
+	// maxRedirects is the number of redirects followed, the library default
+	// if zero and none if negative
+	maxRedirects int
+	// connectTimeout, tlsHandshakeTimeout, responseHeaderTimeout and
+	// bodyReadTimeout bound the phases of each request when positive, within
+	// the request timeout
+	connectTimeout        time.Duration
+	tlsHandshakeTimeout   time.Duration
+	responseHeaderTimeout time.Duration
+	bodyReadTimeout       time.Duration
+	// maxContentTokens is the content limit used when the call does not set one
+	maxContentTokens int
+	// maxContentTokensLimit caps per-call content limits when positive
+	maxContentTokensLimit int
+	// maxPDFSize is the largest PDF in bytes that is converted
+	maxPDFSize int64
+	// maxDownloadSize is the largest response body in bytes that is read
+	maxDownloadSize int64
+	// maxDownloadSizes overrides maxDownloadSize and maxPDFSize per media type
+	maxDownloadSizes map[string]int64
+	// strictContentType refuses responses whose content contradicts their
+	// declared type or URL extension
+	strictContentType bool
+
+	// disabled holds the features turned off for this deployment
+	disabled map[string]bool
+
+	// accessLogPath is where fetches are logged: a file, "-" for stderr, or "" to disable
+	accessLogPath string
+	// accessLogURLs selects how URLs are logged: hash or full
+	accessLogURLs string
+	// accessLogRedactQuery hides query values of logged full URLs
+	accessLogRedactQuery bool
+	// accessLogOutput receives the access log; opened by main from accessLogPath
+	accessLogOutput io.Writer
+
+	// auditLogPath is the JSONL file recording outbound URLs and policy decisions
+	auditLogPath string
+	// auditLogMaxSize is the size in bytes at which the audit log is rotated
+	auditLogMaxSize int64
+	// auditLogMaxBackups is the number of rotated audit logs kept
+	auditLogMaxBackups int
+	// auditLogOutput receives the audit log; opened by main from auditLogPath
+	auditLogOutput io.Writer
+
+	// sessionMaxFetches, sessionMaxBytes and sessionMaxRenders limit the
+	// outbound requests, downloaded bytes and rendered pages of each session
+	// per quotaWindow when positive
+	sessionMaxFetches int64
+	sessionMaxBytes   int64
+	sessionMaxRenders int64
+	quotaWindow       time.Duration
+
+	// archive enables the webfetch_archive tool, capturing pages with the
+	// Wayback Machine at archiveEndpoint, authenticated with the keys if set
+	archive          bool
+	archiveEndpoint  string
+	archiveAccessKey string
+	archiveSecretKey string
+
+	// maxWatches bounds the pages each session watches when positive, and
+	// watchMinInterval the frequency of their checks
+	maxWatches       int
+	watchMinInterval time.Duration
+
+	// saveDir is the directory where saved results and crawled pages are
+	// written, instead of being kept in memory, when not empty
+	saveDir string
+
+	// searchEngine enables the webfetch_search tool with one of the
+	// searchEngine* engines, at searchURL or the default URL of the engine
+	searchEngine string
+	searchURL    string
+	searchAPIKey string
+
+	// translateURL is the LibreTranslate compatible endpoint used to translate
+	// pages, translation being disabled when empty
+	translateURL    string
+	translateAPIKey string
+
+	// renderJS enables the render_js parameter, rendering pages in the
+	// headless Chrome at chromePath, or found in the usual locations when
+	// empty, for up to renderTimeout
+	renderJS      bool
+	chromePath    string
+	renderTimeout time.Duration
+
+	// pdfOCRCommand recognizes the text of PDF pages whose fonts have no Unicode
+	// mapping, OCR being disabled when empty
+	pdfOCRCommand string
+	// pdfFallbackCommand extracts the text of PDFs the built-in parser fails
+	// on, the fallback being disabled when empty
+	pdfFallbackCommand string
+	// maxPDFPages is the largest number of pages of a PDF that is converted,
+	// unlimited when zero
+	maxPDFPages int
+	// pdfTimeout bounds the time spent parsing a PDF when positive
+	pdfTimeout time.Duration
+	// pdfSubprocess parses PDFs in a subprocess whose memory is capped to
+	// pdfMemoryLimit bytes
+	pdfSubprocess  bool
+	pdfMemoryLimit int64
+	// pdfSpoolThreshold is the size in bytes above which PDFs are spooled to
+	// temporary files in pdfSpoolDir, never when negative
+	pdfSpoolThreshold int64
+	pdfSpoolDir       string
+
+	// slowFetchThreshold logs a warning for fetches slower than this when positive
+	slowFetchThreshold time.Duration
+	// largeContentThreshold logs a warning for converted content larger than this
+	// many bytes when positive
+	largeContentThreshold int
+	// logOutput receives operational warnings; stderr when nil
+	logOutput io.Writer
+
+	// maxConcurrentRequests caps the simultaneous outbound requests of all
+	// sessions when positive; requests over the cap wait up to
+	// requestQueueTimeout for a slot
+	maxConcurrentRequests int
+	requestQueueTimeout   time.Duration
+	// batchWorkers is the number of pages fetched at once by a
+	// webfetch_batch call, defaultBatchWorkers when not positive
+	batchWorkers int
+
+	// allowHosts restricts fetches to the hosts matching its patterns, when
+	// set, and denyHosts blocks the hosts matching its patterns
+	allowHosts []string
+	denyHosts  []string
+	// denyPrivateAddresses refuses connections to the addresses of the host
+	// and of private networks, except those in allowedPrivateCIDRs; set by
+	// parseFlags unless -allow-private-addresses
+	denyPrivateAddresses bool
+	allowedPrivateCIDRs  []netip.Prefix
+	// policyPath is the JSON policy file, reloaded when it changes
+	policyPath string
+	// policy holds the loaded policy; loaded by main from policyPath
+	policy *policyStore
+	// blocklistPath is the blocklist file of hosts with the reason they are
+	// blocked, reloaded when it changes
+	blocklistPath string
+	// blocklist holds the loaded blocklist; loaded by main from blocklistPath
+	blocklist *blocklistStore
+	// headerProfilesPath is the JSON file of the headers added to the requests
+	// to matching hosts, reloaded when it changes
+	headerProfilesPath string
+	// headerProfiles holds the loaded profiles; loaded by main from
+	// headerProfilesPath
+	headerProfiles *headerProfileStore
+
+	// accept lists the media types preferred for the responses of all hosts
+	// but those of acceptRules, most preferred first (default: HTML and PDF)
+	accept      []string
+	acceptRules []acceptRule
+
+	// dnsServers, dnsDoHURL and the hosts file at hostsPath resolve the host
+	// names of outbound requests instead of the system resolver
+	dnsServers []string
+	dnsDoHURL  string
+	hostsPath  string
+	// resolver is built by main from dnsServers, dnsDoHURL and hostsPath
+	resolver *webfetch.Resolver
+
+	// debug serves pprof and expvar on debugAddr
+	debug     bool
+	debugAddr string
+}
+
+// defaultCacheMaxBytes bounds the in-memory cache unless -cache-max-bytes is set
+const defaultCacheMaxBytes = 256 * 1024 * 1024
+
+// defaultCacheRevalidate is how long expired pages are kept to be revalidated
+// unless -cache-revalidate is set
+const defaultCacheRevalidate = time.Hour
+
+// redisKeyPrefix prefixes the keys of the result cache in Redis
+const redisKeyPrefix = "webfetch:cache:"
+
+// Values of -cache-scope
+const (
+	cacheScopeShared  = "shared"
+	cacheScopeSession = "session"
+)
+
+// Values of -strip-tracking
+const (
+	stripTrackingNone  = "none"
+	stripTrackingLinks = "links"
+	stripTrackingAll   = "all"
+)
+
+// Features that can be turned off with -disable
+const (
+	featurePDF     = "pdf"
+	featureCrawl   = "crawl"
+	featureHistory = "history"
+	featureCache   = "cache"
+	featureStats   = "stats"
+	featureCheck   = "check"
+	featureInfo    = "info"
+	featureDiff    = "diff"
+	featureWatch   = "watch"
+	featureLLMsTxt = "llmstxt"
+	featurePreview = "preview"
+	featureBatch   = "batch"
+)
+
+var features = []string{featurePDF, featureCrawl, featureHistory, featureCache, featureStats, featureCheck, featureInfo, featureDiff, featureWatch, featureLLMsTxt, featurePreview, featureBatch}
+
+// enabled reports whether feature is enabled
+func (c config) enabled(feature string) bool {
+	return !c.disabled[feature]
+}
+
+// toolNamePrefix matches the prefixes accepted by -tool-prefix, in the
+// characters allowed in MCP tool names
+var toolNamePrefix = regexp.MustCompile(`^[A-Za-z0-9_.-]*$`)
+
+// toolName returns the name under which the tool name is listed: name itself,
+// or the tool prefix followed by name without its webfetch stem, e.g.
+// web.fetch for webfetch and web.crawl for webfetch_crawl.
+func (c config) toolName(name string) string {
+	if c.toolPrefix == "" {
+		return name
+	}
+	if name == "webfetch" {
+		return c.toolPrefix + "fetch"
+	}
+	return c.toolPrefix + strings.TrimPrefix(name, "webfetch_")
+}
+
+func parseFlags() config {
+	cfg := config{accessLogURLs: accessLogURLsHash, cacheScope: cacheScopeShared, stripTracking: stripTrackingLinks, noarchive: noarchiveIgnore, listen: defaultListenAddr, debugAddr: "localhost:6060"}
+	var allowedHeaders string
+
+	flag.BoolVar(&cfg.http, "http", false, "Run as streamable HTTP instead of stdio")
+	flag.Func("listen", "Address to listen on for streamable HTTP, e.g. 0.0.0.0:8080 or [::]:8080 to accept remote connections over IPv4 or IPv6, or :8080 for both (default: "+defaultListenAddr+")", func(s string) error {
+		if err := checkListenAddr(s); err != nil {
+			return err
+		}
+		cfg.listen = s
+		return nil
+	})
+	flag.Func("port", "Deprecated: port of -listen", func(s string) error {
+		host, _, _ := net.SplitHostPort(cfg.listen)
+		addr := net.JoinHostPort(host, s)
+		if err := checkListenAddr(addr); err != nil {
+			return err
+		}
+		cfg.listen = addr
+		return nil
+	})
+	flag.Int64Var(&cfg.httpMaxBodySize, "http-max-body-size", defaultHTTPMaxBodySize, "Maximum size in bytes of the body of HTTP requests (0 disables the limit)")
+	flag.DurationVar(&cfg.httpReadHeaderTimeout, "http-read-header-timeout", defaultHTTPReadHeaderTimeout, "Maximum time to read the headers of HTTP requests (0 disables the limit)")
+	flag.DurationVar(&cfg.httpReadTimeout, "http-read-timeout", defaultHTTPReadTimeout, "Maximum time to read HTTP requests, including their body (0 disables the limit)")
+	flag.DurationVar(&cfg.httpWriteTimeout, "http-write-timeout", 0, "Maximum time to write HTTP responses, which also cuts the event streams of sessions (default: no limit)")
+	flag.DurationVar(&cfg.httpIdleTimeout, "http-idle-timeout", defaultHTTPIdleTimeout, "Maximum time an idle HTTP keep-alive connection is kept open (0 uses -http-read-timeout)")
+	flag.DurationVar(&cfg.httpRequestTimeout, "http-request-timeout", defaultHTTPRequestTimeout, "Maximum time spent handling an MCP call over HTTP, after which it is cancelled (0 disables the limit)")
+	flag.StringVar(&cfg.sessionStorePath, "session-store", "", "Directory or Redis URL (redis:// or rediss://) keeping the history and quota usage of HTTP sessions, so that clients keep their session across restarts (default: in memory)")
+	flag.DurationVar(&cfg.sessionTTL, "session-ttl", defaultSessionTTL, "Time the state of an idle HTTP session is kept in -session-store")
+	flag.StringVar(&cfg.tlsCertPath, "tls-cert", "", "PEM certificate chain serving HTTP mode over HTTPS, with -tls-key (default: plain HTTP)")
+	flag.StringVar(&cfg.tlsKeyPath, "tls-key", "", "PEM private key of -tls-cert")
+	flag.StringVar(&cfg.tlsClientCAPath, "tls-client-ca", "", "PEM bundle of the CAs whose client certificates are accepted; clients without such a certificate are refused (default: no client authentication)")
+	flag.Func("base-path", "Path of the streamable HTTP endpoint, e.g. /mcp/webfetch behind a shared reverse proxy, with the health check at <base-path>/healthz (default: every path)", func(s string) error {
+		path, err := parseBasePath(s)
+		cfg.basePath = path
+		return err
+	})
+	flag.StringVar(&cfg.socket, "socket", "", "Path of a Unix domain socket to serve streamable HTTP on instead of -listen, implies -http (default: disabled)")
+	flag.Func("tool-prefix", "Prefix replacing the webfetch stem of tool names, e.g. \"web.\" for web.fetch and web.crawl, to avoid collisions behind MCP gateways (default: webfetch, webfetch_crawl...)", func(s string) error {
+		if !toolNamePrefix.MatchString(s) {
+			return fmt.Errorf("invalid tool prefix %q: only letters, digits, _, - and . are allowed", s)
+		}
+		cfg.toolPrefix = s
+		return nil
+	})
+	flag.StringVar(&allowedHeaders, "allowed-headers", "", "Comma-separated header names agents may set per call (e.g. Referer,Authorization)")
+	flag.StringVar(&cfg.userAgent, "user-agent", webfetch.DefaultUserAgent, "Default User-Agent for outgoing requests")
+	flag.Func("user-agent-pattern", "Regular expression per-call user agents must match (default: per-call user agents are rejected)", func(s string) error {
+		re, err := regexp.Compile("^(?:" + s + ")$")
+		if err != nil {
+			return err
+		}
+		cfg.userAgentPattern = re
+		return nil
+	})
+	flag.DurationVar(&cfg.cacheTTL, "cache-ttl", 0, "Cache converted pages for this long, e.g. 15m (default: caching disabled)")
+	flag.DurationVar(&cfg.cacheMinTTL, "cache-min-ttl", 0, "Minimum time to cache pages whose response declares a shorter lifetime with Cache-Control or Expires (default: none)")
+	flag.DurationVar(&cfg.cacheMaxTTL, "cache-max-ttl", 0, "Maximum time to cache pages whose response declares a longer lifetime with Cache-Control or Expires (default: none)")
+	flag.DurationVar(&cfg.cacheStaleWhileRevalidate, "cache-stale-while-revalidate", 0, "Serve expired pages for up to this long while refreshing them in the background, e.g. 10m (default: disabled)")
+	flag.DurationVar(&cfg.cacheRevalidate, "cache-revalidate", defaultCacheRevalidate, "Keep expired pages with an ETag or Last-Modified header for this long, and revalidate them with conditional requests (0 disables revalidation)")
+	flag.IntVar(&cfg.cacheMaxEntries, "cache-max-entries", 0, "Maximum number of entries in the in-memory cache, evicting the least recently used; each page takes one entry and each distinct content another (default: no limit)")
+	flag.Int64Var(&cfg.cacheMaxBytes, "cache-max-bytes", defaultCacheMaxBytes, "Maximum size in bytes of the in-memory cache, evicting the least recently used pages (0 disables the limit)")
+	flag.IntVar(&cfg.cacheMaxEntrySize, "cache-max-entry-size", 0, "Maximum size in bytes of a cached page; larger pages are not cached (default: no limit)")
+	flag.StringVar(&cfg.cacheRedisURL, "cache-redis-url", "", "Keep the result cache in this Redis server, e.g. redis://:password@host:6379/0, to share it between replicas (default: in memory)")
+	flag.StringVar(&cfg.cacheDir, "cache-dir", "", "Keep the result cache in files of this directory, created if missing, so that it survives restarts (default: in memory)")
+	flag.Func("cache-scope", "Share the result cache between sessions (shared) or isolate it per session (session) (default: shared)", func(s string) error {
+		if s != cacheScopeShared && s != cacheScopeSession {
+			return fmt.Errorf("expected %s or %s", cacheScopeShared, cacheScopeSession)
+		}
+		cfg.cacheScope = s
+		return nil
+	})
+	flag.StringVar(&cfg.cacheWarmPath, "cache-warm", "", "File listing URLs, one per line, to fetch into the cache at startup; requires -cache-ttl (default: none)")
+	flag.BoolVar(&cfg.offline, "offline", false, "Serve pages only from the result cache and never make outbound requests; requires -cache-ttl")
+	flag.Func("strip-tracking", "Remove tracking parameters (utm_*, fbclid, ...) from the links of pages (links), also from the fetched URLs (all), or nowhere (none) (default: links)", func(s string) error {
+		if s != stripTrackingNone && s != stripTrackingLinks && s != stripTrackingAll {
+			return fmt.Errorf("expected %s, %s or %s", stripTrackingNone, stripTrackingLinks, stripTrackingAll)
+		}
+		cfg.stripTracking = s
+		return nil
+	})
+	flag.Func("tracking-params", "Comma-separated tracking parameters removed by -strip-tracking, a trailing * matching any suffix (e.g. utm_*,fbclid,ref) (default: utm_*, fbclid, gclid and other common ones)", func(s string) error {
+		params := splitList(s)
+		if len(params) == 0 {
+			return fmt.Errorf("expected at least one parameter")
+		}
+		cfg.trackingParams = params
+		return nil
+	})
+	flag.Func("scrub-pii", "Comma-separated categories of personal data masked in returned content: "+strings.Join(piiCategories, ", ")+" (default: none)", func(s string) error {
+		categories, err := parsePIICategories(s)
+		if err != nil {
+			return err
+		}
+		cfg.scrubPII = categories
+		return nil
+	})
+	flag.Func("noarchive", "Handling of pages marked noindex or noarchive by X-Robots-Tag or robots meta tags: ignore, no-cache (never cached) or refuse (neither cached nor returned) (default: ignore)", func(s string) error {
+		if s != noarchiveIgnore && s != noarchiveNoCache && s != noarchiveRefuse {
+			return fmt.Errorf("expected %s, %s or %s", noarchiveIgnore, noarchiveNoCache, noarchiveRefuse)
+		}
+		cfg.noarchive = s
+		return nil
+	})
+	flag.DurationVar(&cfg.timeout, "timeout", defaultTimeout, "Default request timeout")
+	flag.DurationVar(&cfg.maxTimeout, "max-timeout", 0, "Maximum request timeout agents may ask for (default: no limit)")
+	flag.IntVar(&cfg.maxRedirects, "max-redirects", webfetch.DefaultMaxRedirects, "Maximum number of redirects followed by a request (negative: none)")
+	flag.DurationVar(&cfg.connectTimeout, "connect-timeout", 0, "Maximum time to resolve a host and connect to it (default: bounded by the request timeout)")
+	flag.DurationVar(&cfg.tlsHandshakeTimeout, "tls-handshake-timeout", 0, "Maximum time of a TLS handshake (default: 10s)")
+	flag.DurationVar(&cfg.responseHeaderTimeout, "response-header-timeout", 0, "Maximum time to wait for the response headers once a request is sent (default: bounded by the request timeout)")
+	flag.DurationVar(&cfg.bodyReadTimeout, "body-read-timeout", 0, "Maximum time to wait for each part of a response body, so that stalled downloads fail early (default: bounded by the request timeout)")
+	flag.IntVar(&cfg.maxContentTokens, "max-content-tokens", defaultMaxContentTokens, "Default maximum content length")
+	flag.IntVar(&cfg.maxContentTokensLimit, "max-content-tokens-limit", 0, "Maximum content length agents may ask for (default: no limit)")
+	flag.Int64Var(&cfg.maxPDFSize, "max-pdf-size", webfetch.DefaultMaxPDFSize, "Maximum size in bytes of a PDF to convert")
+	flag.Int64Var(&cfg.maxDownloadSize, "max-download-size", webfetch.DefaultMaxDownloadSize, "Maximum size in bytes of a response body, except PDFs")
+	flag.Func("max-download-sizes", "Comma-separated maximum sizes in bytes per media type, overriding -max-download-size and -max-pdf-size (e.g. text/html=5000000,image/*=1000000)", func(s string) error {
+		sizes, err := parseDownloadSizes(s)
+		if err != nil {
+			return err
+		}
+		cfg.maxDownloadSizes = sizes
+		return nil
+	})
+	flag.Func("disable", "Comma-separated features to turn off: "+strings.Join(features, ", "), func(s string) error {
+		disabled, err := parseFeatures(s)
+		if err != nil {
+			return err
+		}
+		cfg.disabled = disabled
+		return nil
+	})
+	flag.StringVar(&cfg.accessLogPath, "access-log", "", "Log every fetch as JSON to this file, or - for stderr (default: disabled)")
+	flag.Func("access-log-urls", "How to log URLs: hash (host and a hash of the path) or full (default: hash)", func(s string) error {
+		if s != accessLogURLsHash && s != accessLogURLsFull {
+			return fmt.Errorf("expected %s or %s", accessLogURLsHash, accessLogURLsFull)
+		}
+		cfg.accessLogURLs = s
+		return nil
+	})
+	flag.BoolVar(&cfg.accessLogRedactQuery, "access-log-redact-query", false, "Replace query parameter values in logged full URLs")
+	flag.StringVar(&cfg.auditLogPath, "audit-log", "", "Append every outbound URL and policy decision as JSON lines to this file (default: disabled)")
+	flag.Int64Var(&cfg.auditLogMaxSize, "audit-log-max-size", 100*1024*1024, "Rotate the audit log when it reaches this size in bytes (0 disables rotation)")
+	flag.IntVar(&cfg.auditLogMaxBackups, "audit-log-max-backups", 5, "Number of rotated audit logs to keep, 0 keeping all of them")
+	flag.IntVar(&cfg.batchWorkers, "batch-workers", defaultBatchWorkers, "Number of pages fetched at once by a webfetch_batch call")
+	flag.IntVar(&cfg.maxConcurrentRequests, "max-concurrent-requests", 0, "Maximum simultaneous outbound requests across all sessions; further requests wait for a slot (default: unlimited)")
+	flag.DurationVar(&cfg.requestQueueTimeout, "request-queue-timeout", defaultRequestQueueTimeout, "Maximum time an outbound request waits for a slot under -max-concurrent-requests (0 waits until the call times out)")
+	flag.Func("allow-hosts", "Comma-separated host patterns, e.g. example.com,*.example.org,/docs[0-9]*\\.example\\.net/, restricting fetches to the matching hosts; may be repeated (default: all hosts)", func(s string) error {
+		patterns, err := parseHostPatterns(s)
+		cfg.allowHosts = append(cfg.allowHosts, patterns...)
+		return err
+	})
+	flag.Func("deny-hosts", "Comma-separated host patterns of the hosts that may not be fetched, even if allowed by -allow-hosts; may be repeated (default: none)", func(s string) error {
+		patterns, err := parseHostPatterns(s)
+		cfg.denyHosts = append(cfg.denyHosts, patterns...)
+		return err
+	})
+	allowPrivateAddresses := flag.Bool("allow-private-addresses", false, "Allow connections to loopback, private network, link-local and unique local addresses, e.g. for internal deployments")
+	flag.Func("allow-private-cidrs", "Comma-separated private address ranges that may be connected to, e.g. 10.1.2.0/24,fd12:3456::/32 (default: none)", func(s string) error {
+		prefixes, err := parseAllowedCIDRs(s)
+		cfg.allowedPrivateCIDRs = prefixes
+		return err
+	})
+	flag.StringVar(&cfg.policyPath, "policy", "", "JSON policy file with host allow/deny lists and rate limits, reloaded when it changes (default: no policy)")
+	flag.StringVar(&cfg.blocklistPath, "blocklist", "", "File of blocked host patterns, each followed by the reason returned to agents, reloaded when it changes (default: no blocklist)")
+	flag.Func("accept", "Comma-separated media types preferred for responses, most preferred first, sent in the Accept header; listed textual types that are not converted, e.g. application/json, are returned as-is (default: "+webfetch.DefaultAccept+")", func(s string) error {
+		types, err := parseAcceptTypes(s)
+		cfg.accept = types
+		return err
+	})
+	flag.Func("accept-hosts", "Semicolon-separated host=types rules overriding -accept for matching hosts, e.g. \"api.example.com=application/json,text/html;*.docs.example=text/markdown\" (default: none)", func(s string) error {
+		rules, err := parseAcceptRules(s)
+		cfg.acceptRules = rules
+		return err
+	})
+	flag.Func("dns-servers", "Comma-separated DNS servers resolving the hosts of outbound requests, e.g. 10.0.0.2,10.0.0.3:5353 (default: the system resolver)", func(s string) error {
+		servers, err := parseDNSServers(s)
+		cfg.dnsServers = servers
+		return err
+	})
+	flag.Func("dns-doh-url", "DNS-over-HTTPS endpoint resolving the hosts of outbound requests, e.g. https://cloudflare-dns.com/dns-query (default: the system resolver)", func(s string) error {
+		dohURL, err := parseDoHURL(s)
+		cfg.dnsDoHURL = dohURL
+		return err
+	})
+	flag.StringVar(&cfg.hostsPath, "hosts-file", "", "Hosts file of addresses pinned for host names, looked up before DNS by outbound requests (default: none)")
+	flag.StringVar(&cfg.headerProfilesPath, "header-profiles", "", "JSON file of headers, such as API keys or cookies, added to the requests to matching hosts, reloaded when it changes (default: none)")
+	flag.Int64Var(&cfg.sessionMaxFetches, "session-max-fetches", 0, "Maximum outbound requests per session and quota window (default: unlimited)")
+	flag.Int64Var(&cfg.sessionMaxBytes, "session-max-bytes", 0, "Maximum downloaded bytes per session and quota window (default: unlimited)")
+	flag.Int64Var(&cfg.sessionMaxRenders, "session-max-renders", 0, "Maximum pages rendered with render_js per session and quota window (default: unlimited)")
+	flag.DurationVar(&cfg.quotaWindow, "quota-window", defaultQuotaWindow, "Period after which session quotas reset, starting at the first request")
+	flag.IntVar(&cfg.maxWatches, "max-watches", defaultMaxWatches, "Maximum pages watched by a session with webfetch_watch (0 means unlimited)")
+	flag.DurationVar(&cfg.watchMinInterval, "watch-min-interval", defaultWatchMinInterval, "Minimum time between checks of a watched page")
+	flag.BoolVar(&cfg.archive, "archive", false, "Enable the webfetch_archive tool, which submits URLs to the Wayback Machine")
+	flag.StringVar(&cfg.archiveEndpoint, "archive-endpoint", webfetch.DefaultWaybackEndpoint, "Base URL of the Wayback Machine used by webfetch_archive")
+	flag.Func("archive-keys", "access:secret API keys of an archive.org account, for captures with Save Page Now 2 (default: anonymous captures)", func(s string) error {
+		access, secret, err := parseArchiveKeys(s)
+		cfg.archiveAccessKey, cfg.archiveSecretKey = access, secret
+		return err
+	})
+	flag.StringVar(&cfg.saveDir, "save-dir", "", "Directory where the results of webfetch with save and the pages of webfetch_crawl are written, their resources being read from the files, which are removed with their session (default: kept in memory)")
+	flag.Func("search", "Search engine enabling the webfetch_search tool: searxng (with -search-url), brave (with -search-api-key) or duckduckgo (default: disabled)", func(s string) error {
+		if !slices.Contains(searchEngines, s) {
+			return fmt.Errorf("expected one of %s", strings.Join(searchEngines, ", "))
+		}
+		cfg.searchEngine = s
+		return nil
+	})
+	flag.StringVar(&cfg.searchURL, "search-url", "", "URL of the SearXNG instance, or of the API of the other search engines (default: their public API)")
+	flag.StringVar(&cfg.searchAPIKey, "search-api-key", "", "API key of the search engine")
+	flag.StringVar(&cfg.translateURL, "translate-url", "", "LibreTranslate compatible /translate endpoint enabling the translate_to parameter (default: disabled)")
+	flag.StringVar(&cfg.translateAPIKey, "translate-api-key", "", "API key sent to the translation endpoint")
+	flag.BoolVar(&cfg.renderJS, "render-js", false, "Enable the render_js parameter, rendering pages in a headless Chrome before conversion")
+	flag.StringVar(&cfg.chromePath, "chrome-path", "", "Chrome or Chromium executable used by -render-js (default: found in the usual locations)")
+	flag.DurationVar(&cfg.renderTimeout, "render-timeout", defaultRenderTimeout, "Maximum time spent rendering a page in the browser (0 disables the limit)")
+	flag.BoolVar(&cfg.strictContentType, "strict-content-type", false, "Refuse to convert responses whose content contradicts their Content-Type header or URL extension, e.g. HTML served as PDF")
+	flag.StringVar(&cfg.pdfFallbackCommand, "pdf-fallback-command", "", "Command extracting the text of PDFs the built-in parser fails to parse or finds no text in, run with the PDF on stdin, e.g. \"pdftotext - -\" (default: disabled)")
+	flag.IntVar(&cfg.maxPDFPages, "max-pdf-pages", 0, "Maximum number of pages of a PDF to convert (default: unlimited)")
+	flag.DurationVar(&cfg.pdfTimeout, "pdf-timeout", defaultPDFTimeout, "Maximum time spent parsing a PDF (0 disables the limit)")
+	flag.BoolVar(&cfg.pdfSubprocess, "pdf-subprocess", false, "Parse PDFs in a subprocess with a memory cap, killed after -pdf-timeout, so that malformed PDFs cannot crash the server")
+	flag.Int64Var(&cfg.pdfMemoryLimit, "pdf-memory-limit", defaultPDFMemoryLimit, "Memory cap in bytes of PDF parser subprocesses")
+	flag.Int64Var(&cfg.pdfSpoolThreshold, "pdf-spool-threshold", webfetch.DefaultPDFSpoolThreshold, "Size in bytes above which a PDF is spooled to a temporary file and parsed from disk instead of memory (-1 keeps all PDFs in memory)")
+	flag.StringVar(&cfg.pdfSpoolDir, "pdf-spool-dir", "", "Directory of the temporary files of spooled PDFs (default: the system temporary directory)")
+	flag.StringVar(&cfg.pdfOCRCommand, "pdf-ocr-command", "", "Command recognizing the text of PDF pages whose fonts have no Unicode mapping, run with the PDF on stdin and the page number as last argument (default: disabled)")
+	flag.DurationVar(&cfg.slowFetchThreshold, "slow-fetch-threshold", 0, "Log a warning with a timing breakdown for fetches slower than this, e.g. 10s (default: disabled)")
+	flag.IntVar(&cfg.largeContentThreshold, "large-content-threshold", 0, "Log a warning for converted content larger than this many bytes (default: disabled)")
+	flag.BoolVar(&cfg.debug, "debug", false, "Serve pprof and expvar debug endpoints on -debug-addr")
+	flag.Func("debug-addr", "Localhost address for the debug endpoints (default: localhost:6060)", func(s string) error {
+		if err := checkLoopbackAddr(s); err != nil {
+			return err
+		}
+		cfg.debugAddr = s
+		return nil
+	})
+
+	if err := setFlagsFromEnv(flag.CommandLine); err != nil {
+		fmt.Fprintln(flag.CommandLine.Output(), err)
+		os.Exit(2)
+	}
 	flag.Parse()
+	if cfg.offline && cfg.cacheTTL <= 0 {
+		fmt.Fprintln(flag.CommandLine.Output(), "-offline requires -cache-ttl")
+		os.Exit(2)
+	}
+	if err := checkSearchConfig(cfg.searchEngine, cfg.searchURL, cfg.searchAPIKey); err != nil {
+		fmt.Fprintln(flag.CommandLine.Output(), err)
+		os.Exit(2)
+	}
+	if cfg.cacheDir != "" && cfg.cacheRedisURL != "" {
+		fmt.Fprintln(flag.CommandLine.Output(), "-cache-dir and -cache-redis-url are mutually exclusive")
+		os.Exit(2)
+	}
+	if cfg.cacheWarmPath != "" && cfg.cacheTTL <= 0 {
+		fmt.Fprintln(flag.CommandLine.Output(), "-cache-warm requires -cache-ttl")
+		os.Exit(2)
+	}
+
+	cfg.allowedHeaders = splitList(allowedHeaders)
+	cfg.denyPrivateAddresses = !*allowPrivateAddresses
 
-	return isHttp, port
+	return cfg
+}
+
+// envPrefix prefixes the environment variables that set flags, e.g.
+// WEBFETCH_CACHE_TTL sets -cache-ttl
+const envPrefix = "WEBFETCH_"
+
+// setFlagsFromEnv sets each flag of fs from its environment variable, if defined.
+// It runs before parsing so that command-line flags take precedence.
+func setFlagsFromEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		value, ok := os.LookupEnv(name)
+		if !ok || err != nil {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value %q for %s: %w", value, name, setErr)
+		}
+	})
+	return err
+}
+
+// parseFeatures parses a comma-separated list of feature names
+func parseFeatures(s string) (map[string]bool, error) {
+	set := make(map[string]bool)
+	for _, name := range splitList(s) {
+		name = strings.ToLower(name)
+		if !slices.Contains(features, name) {
+			return nil, fmt.Errorf("unknown feature %q (expected one of %s)", name, strings.Join(features, ", "))
+		}
+		set[name] = true
+	}
+	return set, nil
+}
+
+// parseDownloadSizes parses a comma-separated list of type=bytes pairs, where
+// type is a media type such as text/html or a major type such as text/*
+func parseDownloadSizes(s string) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	for _, item := range splitList(s) {
+		mediaType, value, ok := strings.Cut(item, "=")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if !ok || !strings.Contains(mediaType, "/") {
+			return nil, fmt.Errorf("invalid download size %q (expected type=bytes, e.g. text/html=5000000)", item)
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid download size %q: size must be a positive number of bytes", item)
+		}
+		sizes[mediaType] = size
+	}
+	return sizes, nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
 }
 
 func main() {
-	isHttp, port := parseFlags()
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		os.Exit(runExport(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "pdf-parse" {
+		os.Exit(runPDFParse(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
+	cfg := parseFlags()
 
 	logger := log.New(os.Stdout, "", 0)
 
+	if cfg.accessLogPath != "" {
+		w, err := openAccessLog(cfg.accessLogPath)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cfg.accessLogOutput = w
+	}
+	if cfg.auditLogPath != "" {
+		w, err := openRotatingFile(cfg.auditLogPath, cfg.auditLogMaxSize, cfg.auditLogMaxBackups)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cfg.auditLogOutput = w
+	}
+
+	if cfg.cacheRedisURL != "" {
+		store, err := webfetch.NewRedisStore(cfg.cacheRedisURL, redisKeyPrefix)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cfg.cacheStore = store
+	}
+	if cfg.cacheDir != "" {
+		store, err := webfetch.NewDiskStore(cfg.cacheDir)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cfg.cacheStore = store
+	}
+
+	if cfg.cacheWarmPath != "" {
+		urls, err := readURLList(cfg.cacheWarmPath)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cfg.cacheWarmURLs = urls
+	}
+
+	if cfg.policyPath != "" {
+		store, err := newPolicyStore(cfg.policyPath)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cfg.policy = store
+		go store.watch(context.Background(), policyReloadInterval, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	}
+	if cfg.blocklistPath != "" {
+		store, err := newBlocklistStore(cfg.blocklistPath)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cfg.blocklist = store
+		go store.watch(context.Background(), policyReloadInterval, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	}
+	if cfg.headerProfilesPath != "" {
+		store, err := newHeaderProfileStore(cfg.headerProfilesPath)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cfg.headerProfiles = store
+		go store.watch(context.Background(), policyReloadInterval, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	}
+
+	resolver, err := newResolver(cfg)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	cfg.resolver = resolver
+
+	if cfg.sessionStorePath != "" && (cfg.http || cfg.socket != "") {
+		store, err := openSessionStore(cfg.sessionStorePath)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cfg.sessions = newSessionPersistence(store, cfg.sessionTTL, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	}
+
+	// Debug endpoints run on their own localhost listener
+	if cfg.debug {
+		go func() {
+			logger.Fatal(http.ListenAndServe(cfg.debugAddr, debugHandler()))
+		}()
+	}
+
 	// Create a server with the webfetch tool
-	server := setupMCPServer()
+	server := setupMCPServer(cfg)
 
 	// Stdio transport
-	if !isHttp {
+	if !cfg.http && cfg.socket == "" {
 		if err := server.Run(context.Background(), &mcp.StdioTransport{}); err != nil {
 			logger.Fatal(err)
 		}
@@ -45,6 +790,11 @@ func main() {
 		nil,
 	)
 
+	if cfg.sessions != nil {
+		handler = cfg.sessions.handler(handler)
+	}
+	handler = routeHTTP(cfg.basePath, handler)
+
 	// Add CORS handler
 	handler = cors.New(cors.Options{
 		AllowOriginFunc: func(origin string) bool {
@@ -56,12 +806,67 @@ func main() {
 			"Authorization",
 			"Mcp-Session-Id",
 			"mcp-protocol-version",
+			requestIDHeader,
 		},
 		ExposedHeaders:   []string{"Mcp-Session-Id"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}).Handler(handler)
 
-	fmt.Printf("MCP Server running in HTTP mode on port %s\n", port)
-	logger.Fatal(http.ListenAndServe(":"+port, handler))
+	httpServer := newHTTPServer(cfg, handler)
+	tlsConfig, err := serverTLSConfig(cfg)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	ln, err := systemdListener()
+	switch {
+	case err != nil:
+		logger.Fatal(err)
+	case ln != nil:
+		fmt.Println("MCP Server running in HTTP mode on the socket passed by systemd")
+	case cfg.socket != "":
+		ln, err = listenSocket(cfg.socket)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		fmt.Printf("MCP Server running in HTTP mode on socket %s\n", cfg.socket)
+	default:
+		ln, err = net.Listen(listenNetwork(cfg.listen), cfg.listen)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		fmt.Printf("MCP Server running in HTTP mode on %s\n", ln.Addr())
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			httpServer.TLSConfig = tlsConfig
+			// The certificate is already loaded in tlsConfig
+			serveErr <- httpServer.ServeTLS(ln, "", "")
+			return
+		}
+		serveErr <- httpServer.Serve(ln)
+	}()
+	if err := sdNotify("READY=1"); err != nil {
+		logger.Printf("sd_notify failed: %v", err)
+	}
+
+	// Stop accepting connections on SIGTERM and let the calls in progress
+	// finish, so that a restarted server, e.g. by systemd with the same socket,
+	// takes over without failed calls
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	select {
+	case err := <-serveErr:
+		logger.Fatal(err)
+	case <-stop:
+	}
+	sdNotify("STOPPING=1")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	// Event streams stay open until the timeout
+	if err := httpServer.Shutdown(ctx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		logger.Fatal(err)
+	}
 }
@@ -3,7 +3,11 @@ package main
 import (
 	"flag"
 	"os"
+	"slices"
 	"testing"
+	"time"
+
+	"github.com/benoute/webfetch"
 )
 
 func TestParseFlags(t *testing.T) {
@@ -16,34 +20,53 @@ func TestParseFlags(t *testing.T) {
 	}()
 
 	tests := []struct {
-		name         string
-		args         []string
-		expectedHttp bool
-		expectedPort string
+		name                   string
+		args                   []string
+		expectedHttp           bool
+		expectedListen         string
+		expectedAllowedHeaders []string
 	}{
 		{
-			name:         "default values",
-			args:         []string{"cmd"},
-			expectedHttp: false,
-			expectedPort: "8080",
+			name:           "default values",
+			args:           []string{"cmd"},
+			expectedHttp:   false,
+			expectedListen: "127.0.0.1:8080",
+		},
+		{
+			name:           "http mode with custom port",
+			args:           []string{"cmd", "-http", "-port", "9090"},
+			expectedHttp:   true,
+			expectedListen: "127.0.0.1:9090",
+		},
+		{
+			name:           "listen address",
+			args:           []string{"cmd", "-http", "-listen", "[::1]:9090"},
+			expectedHttp:   true,
+			expectedListen: "[::1]:9090",
+		},
+		{
+			name:           "port of listen address",
+			args:           []string{"cmd", "-listen", "0.0.0.0:9090", "-port", "7070"},
+			expectedListen: "0.0.0.0:7070",
 		},
 		{
-			name:         "http mode with custom port",
-			args:         []string{"cmd", "-http", "-port", "9090"},
-			expectedHttp: true,
-			expectedPort: "9090",
+			name:           "only http flag",
+			args:           []string{"cmd", "-http"},
+			expectedHttp:   true,
+			expectedListen: "127.0.0.1:8080",
 		},
 		{
-			name:         "only http flag",
-			args:         []string{"cmd", "-http"},
-			expectedHttp: true,
-			expectedPort: "8080",
+			name:           "only port",
+			args:           []string{"cmd", "-port", "7070"},
+			expectedHttp:   false,
+			expectedListen: "127.0.0.1:7070",
 		},
 		{
-			name:         "only port",
-			args:         []string{"cmd", "-port", "7070"},
-			expectedHttp: false,
-			expectedPort: "7070",
+			name:                   "allowed headers",
+			args:                   []string{"cmd", "-allowed-headers", "Referer, Authorization,"},
+			expectedHttp:           false,
+			expectedListen:         "127.0.0.1:8080",
+			expectedAllowedHeaders: []string{"Referer", "Authorization"},
 		},
 	}
 
@@ -53,14 +76,140 @@ func TestParseFlags(t *testing.T) {
 			flag.CommandLine = flag.NewFlagSet(tt.args[0], flag.ContinueOnError)
 			os.Args = tt.args
 
-			isHttp, port := parseFlags()
+			cfg := parseFlags()
 
-			if isHttp != tt.expectedHttp {
-				t.Errorf("Expected http %v, got %v", tt.expectedHttp, isHttp)
+			if cfg.http != tt.expectedHttp {
+				t.Errorf("Expected http %v, got %v", tt.expectedHttp, cfg.http)
+			}
+			if cfg.listen != tt.expectedListen {
+				t.Errorf("Expected listen address %s, got %s", tt.expectedListen, cfg.listen)
 			}
-			if port != tt.expectedPort {
-				t.Errorf("Expected port %s, got %s", tt.expectedPort, port)
+			if cfg.userAgent != webfetch.DefaultUserAgent {
+				t.Errorf("Expected user agent %s, got %s", webfetch.DefaultUserAgent, cfg.userAgent)
+			}
+			if !slices.Equal(cfg.allowedHeaders, tt.expectedAllowedHeaders) {
+				t.Errorf("Expected allowed headers %v, got %v", tt.expectedAllowedHeaders, cfg.allowedHeaders)
 			}
 		})
 	}
 }
+
+func TestParseFlags_Values(t *testing.T) {
+	originalArgs := os.Args
+	originalFlagCommandLine := flag.CommandLine
+	defer func() {
+		os.Args = originalArgs
+		flag.CommandLine = originalFlagCommandLine
+	}()
+
+	flag.CommandLine = flag.NewFlagSet("cmd", flag.ContinueOnError)
+	os.Args = []string{"cmd", "-user-agent", "corp-bot/1.0", "-user-agent-pattern", "Mozilla/5.0 .*", "-cache-ttl", "15m",
+		"-cache-revalidate", "24h", "-connect-timeout", "3s", "-body-read-timeout", "10s", "-allow-private-cidrs", "10.1.2.0/24",
+		"-allow-hosts", "example.com, *.example.org", "-allow-hosts", `/docs[0-9]+\.example\.net/`}
+
+	cfg := parseFlags()
+
+	if cfg.userAgent != "corp-bot/1.0" {
+		t.Errorf("Expected user agent corp-bot/1.0, got %s", cfg.userAgent)
+	}
+	if cfg.cacheTTL != 15*time.Minute {
+		t.Errorf("Expected cache TTL 15m, got %v", cfg.cacheTTL)
+	}
+	if cfg.cacheRevalidate != 24*time.Hour {
+		t.Errorf("Expected cache revalidation window 24h, got %v", cfg.cacheRevalidate)
+	}
+	if cfg.connectTimeout != 3*time.Second || cfg.bodyReadTimeout != 10*time.Second {
+		t.Errorf("Expected connect timeout 3s and body read timeout 10s, got %v and %v", cfg.connectTimeout, cfg.bodyReadTimeout)
+	}
+	if !cfg.denyPrivateAddresses || len(cfg.allowedPrivateCIDRs) != 1 || cfg.allowedPrivateCIDRs[0].String() != "10.1.2.0/24" {
+		t.Errorf("Expected private addresses denied except 10.1.2.0/24, got %t and %v", cfg.denyPrivateAddresses, cfg.allowedPrivateCIDRs)
+	}
+	if expected := []string{"example.com", "*.example.org", `/docs[0-9]+\.example\.net/`}; !slices.Equal(cfg.allowHosts, expected) {
+		t.Errorf("Expected allowed hosts %q, got %q", expected, cfg.allowHosts)
+	}
+	if cfg.userAgentPattern == nil {
+		t.Fatal("Expected user agent pattern to be set")
+	}
+	if !cfg.userAgentPattern.MatchString("Mozilla/5.0 (X11)") {
+		t.Error("Expected pattern to match Mozilla user agent")
+	}
+	if cfg.userAgentPattern.MatchString("curl/8.0 Mozilla/5.0 x") {
+		t.Error("Expected pattern to be anchored")
+	}
+}
+
+func TestParseFlags_Env(t *testing.T) {
+	originalArgs := os.Args
+	originalFlagCommandLine := flag.CommandLine
+	defer func() {
+		os.Args = originalArgs
+		flag.CommandLine = originalFlagCommandLine
+	}()
+
+	t.Setenv("WEBFETCH_PORT", "9090")
+	t.Setenv("WEBFETCH_MAX_TIMEOUT", "30s")
+	t.Setenv("WEBFETCH_MAX_CONTENT_TOKENS", "5000")
+
+	flag.CommandLine = flag.NewFlagSet("cmd", flag.ContinueOnError)
+	os.Args = []string{"cmd", "-port", "7070", "-max-pdf-size", "1024"}
+
+	cfg := parseFlags()
+
+	// Command-line flags take precedence over the environment
+	if cfg.listen != "127.0.0.1:7070" {
+		t.Errorf("Expected listen address 127.0.0.1:7070, got %s", cfg.listen)
+	}
+	if cfg.maxTimeout != 30*time.Second {
+		t.Errorf("Expected max timeout 30s, got %v", cfg.maxTimeout)
+	}
+	if cfg.maxContentTokens != 5000 {
+		t.Errorf("Expected max content tokens 5000, got %d", cfg.maxContentTokens)
+	}
+	if cfg.maxPDFSize != 1024 {
+		t.Errorf("Expected max PDF size 1024, got %d", cfg.maxPDFSize)
+	}
+	if cfg.timeout != defaultTimeout {
+		t.Errorf("Expected default timeout %v, got %v", defaultTimeout, cfg.timeout)
+	}
+}
+
+func TestSetFlagsFromEnv_Invalid(t *testing.T) {
+	t.Setenv("WEBFETCH_TIMEOUT", "soon")
+
+	fs := flag.NewFlagSet("cmd", flag.ContinueOnError)
+	fs.Duration("timeout", defaultTimeout, "")
+
+	if err := setFlagsFromEnv(fs); err == nil {
+		t.Error("Expected error for invalid duration")
+	}
+}
+
+func TestParseFeatures(t *testing.T) {
+	disabled, err := parseFeatures("PDF, crawl")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !disabled[featurePDF] || !disabled[featureCrawl] || len(disabled) != 2 {
+		t.Errorf("expected pdf and crawl disabled, got %v", disabled)
+	}
+
+	if _, err := parseFeatures("pdf,javascript"); err == nil {
+		t.Error("expected error for unknown feature")
+	}
+}
+
+func TestParseDownloadSizes(t *testing.T) {
+	sizes, err := parseDownloadSizes("Text/HTML=5000, image/* = 100")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sizes["text/html"] != 5000 || sizes["image/*"] != 100 || len(sizes) != 2 {
+		t.Errorf("expected text/html 5000 and image/* 100, got %v", sizes)
+	}
+
+	for _, s := range []string{"text/html", "html=5000", "text/html=0", "text/html=5MB"} {
+		if _, err := parseDownloadSizes(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
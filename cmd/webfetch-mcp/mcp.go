@@ -2,6 +2,18 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/benoute/webfetch"
@@ -9,88 +21,885 @@ import (
 )
 
 const (
-	defaultTimeout          = 5 * time.Second
-	defaultMaxContentTokens = 100000
+	defaultTimeout             = 5 * time.Second
+	defaultMaxContentTokens    = 100000
+	defaultRequestQueueTimeout = 30 * time.Second
 )
 
 type webfetchToolInput struct {
 	URL              string `json:"url" jsonschema:"The URL to fetch (required)"`
-	Timeout          string `json:"timeout,omitempty" jsonschema:"Request timeout (default: 5s)"`
-	MaxContentTokens int    `json:"max_content_tokens,omitempty" jsonschema:"Maximum content length - truncated if exceeded (default: 100000)"`
+	Timeout          string `json:"timeout,omitempty" jsonschema:"Request timeout, capped by the server (default: 5s)"`
+	MaxContentTokens int    `json:"max_content_tokens,omitempty" jsonschema:"Maximum content length - truncated if exceeded, capped by the server (default: 100000)"`
+	StartIndex       int    `json:"start_index,omitempty" jsonschema:"Return content starting at this character index, useful to continue a truncated result (default: 0)"`
+	MaxLength        int    `json:"max_length,omitempty" jsonschema:"Maximum number of characters to return from start_index (default: max_content_tokens)"`
+
+	Headers   map[string]string `json:"headers,omitempty" jsonschema:"Additional request headers (e.g. Referer), limited to the names allowed by the server operator"`
+	UserAgent string            `json:"user_agent,omitempty" jsonschema:"User-Agent to send, subject to server policy (default: server user agent)"`
+
+	Selector         string   `json:"selector,omitempty" jsonschema:"CSS selector restricting HTML conversion to the matching elements (e.g. #content)"`
+	ExcludeSelectors []string `json:"exclude_selectors,omitempty" jsonschema:"CSS selectors for HTML elements to drop before conversion (e.g. .comments)"`
+
+	Language string `json:"language,omitempty" jsonschema:"Preferred language tag (e.g. fr or pt-BR): sent in Accept-Language, and the alternate version of the page in that language declared with hreflang is fetched, if any"`
+
+	IgnoreFragment bool `json:"ignore_fragment,omitempty" jsonschema:"Convert the whole page when the URL has a #fragment, instead of only the section it points to"`
+	InlineIframes  bool `json:"inline_iframes,omitempty" jsonschema:"Inline the content of same-origin iframes (one level deep, at most 10) instead of dropping them"`
+	RenderJS       bool `json:"render_js,omitempty" jsonschema:"Render HTML pages in a headless browser, running their scripts, before conversion, for pages building their content client-side; requires rendering enabled on the server"`
+
+	Raw bool `json:"raw,omitempty" jsonschema:"Return the response body as-is instead of converting it (binary bodies are base64 encoded)"`
+
+	Accept []string `json:"accept,omitempty" jsonschema:"Media types to ask for, most preferred first (e.g. [application/json, text/html] for an API); textual types that are not converted are returned as-is (default: server preference for the host, HTML and PDF)"`
+
+	Cache string `json:"cache,omitempty" jsonschema:"Result cache use: default, bypass (fetch without reading or storing the cache), only (serve from the cache, fail when not cached) or refresh (fetch and replace the cached copy) (default: default)"`
+
+	TranslateTo string `json:"translate_to,omitempty" jsonschema:"Translate the Markdown into this language (e.g. de), keeping code and links as is; requires a translation API configured on the server"`
+
+	UnicodeNormalization string `json:"unicode_normalization,omitempty" jsonschema:"Unicode normalization of the Markdown: nfc (composed characters) or nfkc (also replaces compatibility characters such as ligatures and fullwidth forms) (default: none)"`
+	NormalizeTypography  bool   `json:"normalize_typography,omitempty" jsonschema:"Replace smart quotes, dashes, ellipses and non-breaking spaces with plain ASCII equivalents"`
+	NormalizeWhitespace  bool   `json:"normalize_whitespace,omitempty" jsonschema:"Trim trailing whitespace and collapse blank lines of plain text documents (Markdown is returned untouched)"`
+	TOCMinLength         int    `json:"toc_min_length,omitempty" jsonschema:"Prepend a table of contents linking to the headings when the Markdown is at least this many characters long (default: no table of contents)"`
+
+	Save bool `json:"save,omitempty" jsonschema:"Save the Markdown as a resource and return its URI with a short summary instead of the content, to keep large documents out of the conversation"`
+
+	Formats []string `json:"formats,omitempty" jsonschema:"Representations to return, each as a separate content block: markdown, metadata (JSON), links (one URL per line), citations (JSON list of links with anchor text and surrounding sentence), keywords (JSON top keywords, names and key sentences of the page) (default: [markdown])"`
+}
+
+// Representations that can be requested with the formats parameter
+const (
+	formatMarkdown  = "markdown"
+	formatMetadata  = "metadata"
+	formatLinks     = "links"
+	formatCitations = "citations"
+	formatKeywords  = "keywords"
+)
+
+// documentMetadata is the JSON representation of the metadata format
+type documentMetadata struct {
+	URL string `json:"url"`
+	// FinalURL is the URL after redirects, if the request was redirected
+	FinalURL    string `json:"final_url,omitempty"`
+	Title       string `json:"title,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int    `json:"size"`
+	ContentHash string `json:"content_hash,omitempty"`
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	FetchedAt   string `json:"fetched_at,omitempty"`
+	Stale       bool   `json:"stale,omitempty"`
+	webfetch.Metadata
+}
+
+// tools holds the configuration and state shared by the tool handlers
+type tools struct {
+	cfg    config
+	server *mcp.Server
+	// cache is nil when caching is disabled
+	cache *webfetch.Cache
+	// cacheMemory is the store of cache when kept in memory
+	cacheMemory *webfetch.MemoryStore
+	history     *history
+	// accessLog is nil when access logging is disabled
+	accessLog *accessLog
+	// auditLog is nil when the audit log is disabled
+	auditLog *auditLog
+	warnings *fetchWarnings
+	stats    *stats
+	// quotas is nil when sessions are not limited
+	quotas *quotas
+	// postProcessors transform the Markdown returned by the webfetch tool, in order
+	postProcessors []postProcessor
+	// pii is nil when personal data is not scrubbed
+	pii *piiScrubber
+	// noarchive is nil when robots directives are ignored
+	noarchive *noarchivePolicy
+	// ocr is nil when PDF OCR is disabled
+	ocr webfetch.OCRFunc
+	// private is nil when connections to private addresses are allowed
+	private *privateAddresses
+	// requestLimiter is nil when outbound requests are not capped
+	requestLimiter *webfetch.RequestLimiter
+	// pdfFallback is nil when no fallback PDF engine is configured
+	pdfFallback *webfetch.PDFEngine
+	// renderer is nil when JavaScript rendering is disabled
+	renderer webfetch.RenderFunc
+	// pdfParser is nil when PDFs are parsed in process
+	pdfParser func(ctx context.Context, pdf io.Reader) (string, error)
+	// documents holds the resources of the saved results and crawled pages
+	documents *documents
+	// watches is nil when the watch tools are disabled
+	watches *watches
+	// searcher is nil when web search is disabled
+	searcher *searcher
 }
 
 // setupMCPServer creates and configures the MCP server with the webfetch tool
-func setupMCPServer() *mcp.Server {
-	server := mcp.NewServer(&mcp.Implementation{Name: "webfetch", Version: "v1.0.0"}, nil)
+func setupMCPServer(cfg config) *mcp.Server {
+	t := &tools{cfg: cfg, history: newHistory(), stats: newStats(), documents: newDocuments()}
+	opts := &mcp.ServerOptions{}
+	if cfg.sessions != nil {
+		opts.GetSessionID = cfg.sessions.sessionID
+	}
+	if !cfg.offline && cfg.enabled(featureWatch) {
+		t.watches = newWatches(cfg.maxWatches)
+		opts.SubscribeHandler = t.watches.subscribe
+		opts.UnsubscribeHandler = t.watches.unsubscribe
+	}
+	server := mcp.NewServer(&mcp.Implementation{Name: "webfetch", Version: "v1.0.0"}, opts)
+	t.server = server
+
+	server.AddReceivingMiddleware(requestIDMiddleware, t.stats.middleware)
+	if cfg.sessions != nil {
+		server.AddReceivingMiddleware(t.persistSessions)
+	}
+	if cfg.cacheTTL > 0 && cfg.cacheStore != nil {
+		t.cache = webfetch.NewCacheWithStore(cfg.cacheTTL, cfg.cacheStore)
+	} else if cfg.cacheTTL > 0 {
+		t.cacheMemory = webfetch.NewMemoryStore()
+		t.cacheMemory.SetLimits(cfg.cacheMaxEntries, cfg.cacheMaxBytes)
+		t.cache = webfetch.NewCacheWithStore(cfg.cacheTTL, t.cacheMemory)
+	}
+	if t.cache != nil {
+		t.cache.SetTTLBounds(cfg.cacheMinTTL, cfg.cacheMaxTTL)
+		t.cache.SetMaxEntrySize(cfg.cacheMaxEntrySize)
+		t.cache.SetStaleWhileRevalidate(cfg.cacheStaleWhileRevalidate)
+		t.cache.SetRevalidation(cfg.cacheRevalidate)
+	}
+	if cfg.accessLogOutput != nil {
+		t.accessLog = newAccessLog(cfg.accessLogOutput, cfg.accessLogURLs, cfg.accessLogRedactQuery)
+	}
+	if cfg.auditLogOutput != nil {
+		logOutput := cfg.logOutput
+		if logOutput == nil {
+			logOutput = os.Stderr
+		}
+		t.auditLog = newAuditLog(cfg.auditLogOutput, logOutput)
+	}
+	if cfg.sessionMaxFetches > 0 || cfg.sessionMaxBytes > 0 || cfg.sessionMaxRenders > 0 {
+		t.quotas = newQuotas(cfg.sessionMaxFetches, cfg.sessionMaxBytes, cfg.sessionMaxRenders, cfg.quotaWindow)
+	}
+	if cfg.pdfOCRCommand != "" {
+		t.ocr = commandOCR(cfg.pdfOCRCommand)
+	}
+	if cfg.pdfFallbackCommand != "" {
+		t.pdfFallback = commandPDFEngine(cfg.pdfFallbackCommand)
+	}
+	if cfg.pdfSubprocess {
+		t.pdfParser = subprocessPDFParser(cfg)
+	}
+	if cfg.denyPrivateAddresses {
+		t.private = &privateAddresses{allowed: cfg.allowedPrivateCIDRs}
+	}
+	if cfg.renderJS && !cfg.offline {
+		// The requests of the browser are checked like the fetches
+		var proxy *renderProxy
+		if allowIP := t.allowIP(); allowIP != nil || t.checksURLs() {
+			proxy = newRenderProxy(t.policyAllowsURL, allowIP)
+		}
+		t.renderer = newChromeRenderer(cfg.chromePath, cfg.userAgent, cfg.renderTimeout, proxy).render
+	}
+	if cfg.maxConcurrentRequests > 0 {
+		t.requestLimiter = webfetch.NewRequestLimiter(cfg.maxConcurrentRequests, cfg.requestQueueTimeout)
+	}
+	t.pii = newPIIScrubber(cfg.scrubPII)
+	if cfg.noarchive == noarchiveNoCache || cfg.noarchive == noarchiveRefuse {
+		logOutput := cfg.logOutput
+		if logOutput == nil {
+			logOutput = os.Stderr
+		}
+		t.noarchive = newNoarchivePolicy(cfg.noarchive == noarchiveRefuse, logOutput)
+	}
+	if cfg.translateURL != "" && !cfg.offline {
+		t.postProcessors = append(t.postProcessors, newTranslator(cfg.translateURL, cfg.translateAPIKey))
+	}
+	if cfg.slowFetchThreshold > 0 || cfg.largeContentThreshold > 0 {
+		logOutput := cfg.logOutput
+		if logOutput == nil {
+			logOutput = os.Stderr
+		}
+		t.warnings = &fetchWarnings{
+			logger: slog.New(slog.NewJSONHandler(logOutput, nil)),
+			slow:   cfg.slowFetchThreshold,
+			large:  cfg.largeContentThreshold,
+		}
+	}
+
+	if t.cache != nil && len(cfg.cacheWarmURLs) > 0 {
+		logOutput := cfg.logOutput
+		if logOutput == nil {
+			logOutput = os.Stderr
+		}
+		go t.warmCacheAtStartup(cfg.cacheWarmURLs, logOutput)
+	}
 
 	// Add webfetch tool
+	description := "Fetches a URL and converts its HTML or PDF content to Markdown; plain text and Markdown are returned as-is."
+	if !cfg.enabled(featurePDF) {
+		description = "Fetches a URL and converts its HTML content to Markdown; plain text and Markdown are returned as-is."
+	}
 	mcp.AddTool(server, &mcp.Tool{
-		Name:        "webfetch",
-		Description: "Fetches a URL and converts its HTML or PDF content to Markdown.",
+		Name:        cfg.toolName("webfetch"),
+		Description: description,
 	}, func(
 		ctx context.Context,
 		req *mcp.CallToolRequest,
 		input webfetchToolInput,
 	) (*mcp.CallToolResult, any, error) {
-		return handleWebfetch(ctx, input)
+		result, output, err := t.handleWebfetch(ctx, req, input)
+		t.recordFetch(ctx, req, "webfetch", input.URL, result, nil)
+		return result, output, err
 	})
+	t.addDocumentTemplate("webfetch://saved/{id}", "saved-result", "Results saved by "+cfg.toolName("webfetch")+" with save, readable by the session that saved them")
+
+	// Add crawl tool
+	if cfg.enabled(featureCrawl) {
+		t.addCrawlTool()
+	}
+
+	// Add history tool
+	if cfg.enabled(featureHistory) {
+		t.addHistoryTool()
+	}
+
+	// Add cache management tool
+	if t.cache != nil && cfg.enabled(featureCache) {
+		t.addCacheTool()
+	}
+
+	// Add URL check tool
+	if cfg.enabled(featureCheck) {
+		t.addCheckTool()
+	}
+
+	// Add document info tool
+	if cfg.enabled(featureInfo) {
+		t.addInfoTool()
+	}
+
+	// Add page preview tool
+	if cfg.enabled(featurePreview) {
+		t.addPreviewTool()
+	}
+
+	// Add batch fetch tool
+	if cfg.enabled(featureBatch) {
+		t.addBatchTool()
+	}
+
+	// Add llms.txt discovery tool
+	if cfg.enabled(featureLLMsTxt) {
+		t.addLLMsTxtTool()
+	}
+
+	// Add page diff tool, which compares with the cache
+	if t.cache != nil && !cfg.offline && cfg.enabled(featureDiff) {
+		t.addDiffTool()
+	}
+
+	// Add watch tools
+	if t.watches != nil {
+		t.addWatchTools()
+	}
+
+	// Add archive tool, which sends URLs to a third party
+	if cfg.archive && !cfg.offline {
+		t.addArchiveTool()
+	}
+
+	// Add search tool
+	if cfg.searchEngine != "" && !cfg.offline {
+		t.searcher = newSearcher(cfg.searchEngine, cfg.searchURL, cfg.searchAPIKey, cfg.userAgent)
+		t.addSearchTool()
+	}
+
+	// Add stats tool
+	if cfg.enabled(featureStats) {
+		t.addStatsTool()
+	}
 
 	return server
 }
 
-func handleWebfetch(ctx context.Context, input webfetchToolInput) (
+// toolError returns a tool result reporting the error message to the model
+func toolError(text string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: text},
+		},
+		IsError: true,
+	}
+}
+
+// recordFetch adds a fetch to the history of the calling session. Either result
+// (for a failed call) or doc (for a successful fetch) describes the outcome.
+func (t *tools) recordFetch(
+	ctx context.Context,
+	req *mcp.CallToolRequest,
+	tool string,
+	url string,
+	result *mcp.CallToolResult,
+	doc *webfetch.Document,
+) {
+	if !t.cfg.enabled(featureHistory) {
+		return
+	}
+
+	// Credentials of the URL are not kept
+	entry := historyEntry{Time: time.Now(), Tool: tool, URL: webfetch.StripUserinfo(url), Status: "ok", RequestID: requestID(ctx)}
+	switch {
+	case result != nil && result.IsError:
+		entry.Status = "error"
+		if text, ok := result.Content[0].(*mcp.TextContent); ok {
+			entry.Error = text.Text
+		}
+	case doc != nil:
+		entry.Title = doc.Title
+		entry.Size = len(doc.Content)
+		entry.Tokens = estimateTokens(doc.Content)
+	case result != nil && len(result.Content) > 0:
+		if text, ok := result.Content[0].(*mcp.TextContent); ok {
+			entry.Size = len(text.Text)
+			entry.Tokens = estimateTokens(text.Text)
+		}
+	}
+	session := sessionID(req)
+	t.history.add(session, entry)
+	// The history ends with its session, as watches do
+	if req != nil && req.Session != nil && t.history.attach(session) {
+		go func() {
+			req.Session.Wait()
+			t.history.remove(session)
+		}()
+	}
+}
+
+// fetchOptions returns the fetch options shared by all tools for fetches made by
+// tool on behalf of req
+func (t *tools) fetchOptions(
+	ctx context.Context,
+	req *mcp.CallToolRequest,
+	tool string,
+	timeout time.Duration,
+) webfetch.FetchOptions {
+	opts := webfetch.FetchOptions{
+		Timeout:               timeout,
+		ConnectTimeout:        t.cfg.connectTimeout,
+		TLSHandshakeTimeout:   t.cfg.tlsHandshakeTimeout,
+		ResponseHeaderTimeout: t.cfg.responseHeaderTimeout,
+		BodyReadTimeout:       t.cfg.bodyReadTimeout,
+		UserAgent:             t.cfg.userAgent,
+		MaxRedirects:          t.cfg.maxRedirects,
+		Cache:                 t.sessionCache(req),
+		Offline:               t.cfg.offline,
+		StripTrackingLinks:    t.cfg.stripTracking == stripTrackingLinks || t.cfg.stripTracking == stripTrackingAll,
+		StripTrackingURL:      t.cfg.stripTracking == stripTrackingAll,
+		TrackingParams:        t.cfg.trackingParams,
+		HonorNoArchive:        t.noarchive != nil,
+		MaxDownloadSize:       t.cfg.maxDownloadSize,
+		MaxDownloadSizes:      t.cfg.maxDownloadSizes,
+		StrictContentType:     t.cfg.strictContentType,
+		MaxPDFSize:            t.cfg.maxPDFSize,
+		DisablePDF:            !t.cfg.enabled(featurePDF),
+		MaxPDFPages:           t.cfg.maxPDFPages,
+		PDFTimeout:            t.cfg.pdfTimeout,
+		PDFSpoolThreshold:     t.cfg.pdfSpoolThreshold,
+		PDFSpoolDir:           t.cfg.pdfSpoolDir,
+		PDFParser:             t.pdfParser,
+		PDFFallback:           t.pdfFallback,
+		PDFOCR:                t.ocr,
+		Resolver:              t.cfg.resolver,
+		RequestLimiter:        t.requestLimiter,
+		RequestID:             requestID(ctx),
+	}
+	session := sessionID(req)
+	opts.OnFetch = func(info webfetch.FetchInfo) {
+		t.stats.record(info)
+		if t.quotas != nil && !info.Cached {
+			t.quotas.addBytes(session, info.Bytes)
+		}
+		if t.accessLog != nil {
+			t.accessLog.log(session, opts.RequestID, tool, info)
+		}
+		if t.auditLog != nil {
+			t.auditLog.fetched(session, opts.RequestID, tool, info)
+		}
+		if t.warnings != nil {
+			t.warnings.check(session, opts.RequestID, tool, info)
+		}
+	}
+	if t.checksURLs() || t.quotas != nil {
+		opts.AllowURL = func(u *url.URL) error {
+			err := t.allowURL(session, u)
+			if err != nil && t.auditLog != nil {
+				t.auditLog.blocked(session, opts.RequestID, tool, u.String(), err)
+			}
+			return err
+		}
+	}
+	opts.AllowIP = t.allowIP()
+	if t.cfg.headerProfiles != nil {
+		opts.HostHeaders = t.cfg.headerProfiles.headers
+	}
+	return opts
+}
+
+// allowIP returns the check of the addresses connected to by outbound
+// requests, applying the private address protection and the policy, or nil
+// when neither is enabled
+func (t *tools) allowIP() func(ip netip.Addr) error {
+	switch {
+	case t.private != nil && t.cfg.policy != nil:
+		return func(ip netip.Addr) error {
+			if err := t.private.allowIP(ip); err != nil {
+				return err
+			}
+			return t.cfg.policy.allowIP(ip)
+		}
+	case t.private != nil:
+		return t.private.allowIP
+	case t.cfg.policy != nil:
+		return t.cfg.policy.allowIP
+	}
+	return nil
+}
+
+// allowURL applies the blocklist, the policy and the quotas of session to an
+// outbound request
+func (t *tools) allowURL(session string, u *url.URL) error {
+	if err := t.policyAllowsURL(u); err != nil {
+		return err
+	}
+	if t.quotas != nil {
+		return t.quotas.take(session)
+	}
+	return nil
+}
+
+// render returns the renderer of the fetches of session, each render counting
+// against its quota
+func (t *tools) render(session string) webfetch.RenderFunc {
+	if t.quotas == nil {
+		return t.renderer
+	}
+	return func(ctx context.Context, rawURL string) (string, error) {
+		if err := t.quotas.takeRender(session); err != nil {
+			return "", err
+		}
+		return t.renderer(ctx, rawURL)
+	}
+}
+
+// checksURLs reports whether policyAllowsURL refuses any URL
+func (t *tools) checksURLs() bool {
+	return t.cfg.policy != nil || t.cfg.blocklist != nil || len(t.cfg.allowHosts) > 0 || len(t.cfg.denyHosts) > 0
+}
+
+// policyAllowsURL applies the blocklist, -allow-hosts, -deny-hosts and the
+// policy to an outbound request
+func (t *tools) policyAllowsURL(u *url.URL) error {
+	if t.cfg.blocklist != nil {
+		if err := t.cfg.blocklist.checkHost(u.Hostname()); err != nil {
+			return err
+		}
+	}
+	if err := t.checkHost(u.Hostname()); err != nil {
+		return err
+	}
+	if t.cfg.policy != nil {
+		return t.cfg.policy.allowURL(u)
+	}
+	return nil
+}
+
+// checkHost returns a *policyError if host does not match -allow-hosts or
+// matches -deny-hosts
+func (t *tools) checkHost(host string) error {
+	if len(t.cfg.allowHosts) == 0 && len(t.cfg.denyHosts) == 0 {
+		return nil
+	}
+	hosts := policy{AllowHosts: t.cfg.allowHosts, DenyHosts: t.cfg.denyHosts}
+	return hosts.checkHost(host)
+}
+
+// blocked records in the audit log that the call was denied by policy, and
+// returns the tool error reporting it
+func (t *tools) blocked(
+	ctx context.Context,
+	req *mcp.CallToolRequest,
+	tool string,
+	rawURL string,
+	reason error,
+) *mcp.CallToolResult {
+	if t.auditLog != nil {
+		t.auditLog.blocked(sessionID(req), requestID(ctx), tool, rawURL, reason)
+	}
+	return toolError(reason.Error())
+}
+
+// checkPolicy returns the tool error for a URL whose host the blocklist or the
+// policy blocks, or nil. Redirects and crawled pages are checked while fetching; this check also
+// covers pages that would be served from the cache.
+func (t *tools) checkPolicy(
+	ctx context.Context,
+	req *mcp.CallToolRequest,
+	tool string,
+	rawURL string,
+) *mcp.CallToolResult {
+	if t.cfg.blocklist != nil {
+		if err := t.cfg.blocklist.checkURL(rawURL); err != nil {
+			return t.blocked(ctx, req, tool, rawURL, err)
+		}
+	}
+	if u, err := url.Parse(rawURL); err == nil {
+		if err := t.checkHost(u.Hostname()); err != nil {
+			return t.blocked(ctx, req, tool, rawURL, err)
+		}
+	}
+	if t.cfg.policy != nil {
+		if err := t.cfg.policy.checkHost(rawURL); err != nil {
+			return t.blocked(ctx, req, tool, rawURL, err)
+		}
+	}
+	return nil
+}
+
+// resolveTimeout parses the per-call timeout, falling back to the server default,
+// and clamps it to the server maximum. Non-positive timeouts are refused.
+func (t *tools) resolveTimeout(input string) (time.Duration, error) {
+	timeout := t.cfg.timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	if input != "" {
+		parsedTimeout, err := time.ParseDuration(input)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timeout format: %w", err)
+		}
+		if parsedTimeout <= 0 {
+			return 0, fmt.Errorf("invalid timeout: %s is not positive", input)
+		}
+		timeout = parsedTimeout
+	}
+	if t.cfg.maxTimeout > 0 && timeout > t.cfg.maxTimeout {
+		timeout = t.cfg.maxTimeout
+	}
+	return timeout, nil
+}
+
+// resolveMaxContentTokens returns the per-call content limit, falling back to the
+// server default, clamped to the server maximum
+func (t *tools) resolveMaxContentTokens(input int) int {
+	maxContentTokens := t.cfg.maxContentTokens
+	if maxContentTokens <= 0 {
+		maxContentTokens = defaultMaxContentTokens
+	}
+	if input > 0 {
+		maxContentTokens = input
+	}
+	if t.cfg.maxContentTokensLimit > 0 && maxContentTokens > t.cfg.maxContentTokensLimit {
+		maxContentTokens = t.cfg.maxContentTokensLimit
+	}
+	return maxContentTokens
+}
+
+// parseCacheMode returns the cache mode named by the cache input of the webfetch tool
+func parseCacheMode(mode string) (webfetch.CacheMode, error) {
+	switch mode {
+	case "", "default":
+		return webfetch.CacheDefault, nil
+	case "bypass":
+		return webfetch.CacheBypass, nil
+	case "only":
+		return webfetch.CacheOnly, nil
+	case "refresh":
+		return webfetch.CacheRefresh, nil
+	}
+	return "", fmt.Errorf("unknown cache mode: %s (expected default, bypass, only or refresh)", mode)
+}
+
+func (t *tools) handleWebfetch(ctx context.Context, req *mcp.CallToolRequest, input webfetchToolInput) (
 	*mcp.CallToolResult,
 	any,
 	error,
 ) {
 	if input.URL == "" {
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: "URL is required"},
-			},
-			IsError: true,
-		}, nil, nil
-	}
-
-	// Parse timeout from input or use default
-	timeout := defaultTimeout
-	if input.Timeout != "" {
-		parsedTimeout, err := time.ParseDuration(input.Timeout)
-		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "invalid timeout format: " + err.Error()},
-				},
-				IsError: true,
-			}, nil, nil
+		return toolError("URL is required"), nil, nil
+	}
+
+	timeout, err := t.resolveTimeout(input.Timeout)
+	if err != nil {
+		return toolError(err.Error()), nil, nil
+	}
+	maxContentTokens := t.resolveMaxContentTokens(input.MaxContentTokens)
+
+	if input.StartIndex < 0 || input.MaxLength < 0 || input.TOCMinLength < 0 {
+		return toolError("start_index, max_length and toc_min_length must not be negative"), nil, nil
+	}
+
+	formats := input.Formats
+	if len(formats) == 0 {
+		formats = []string{formatMarkdown}
+	}
+	for _, format := range formats {
+		if format != formatMarkdown && format != formatMetadata && format != formatLinks && format != formatCitations && format != formatKeywords {
+			return toolError("unknown format: " + format + " (expected markdown, metadata, links, citations or keywords)"), nil, nil
 		}
-		timeout = parsedTimeout
 	}
 
-	// Use max content tokens from input or default
-	maxContentTokens := defaultMaxContentTokens
-	if input.MaxContentTokens > 0 {
-		maxContentTokens = input.MaxContentTokens
+	if _, err := normalizeUnicode("", input.UnicodeNormalization); err != nil {
+		return toolError(err.Error()), nil, nil
+	}
+	if input.TranslateTo != "" && t.cfg.translateURL == "" {
+		return toolError("translation is not configured on this server"), nil, nil
+	}
+	if input.TranslateTo != "" && t.cfg.offline {
+		return toolError("translation is not available in offline mode"), nil, nil
+	}
+	if input.RenderJS && t.renderer == nil {
+		return toolError("JavaScript rendering is not enabled on this server"), nil, nil
+	}
+	cacheMode, err := parseCacheMode(input.Cache)
+	if err != nil {
+		return toolError(err.Error()), nil, nil
+	}
+	if err := checkAcceptTypes(input.Accept); err != nil {
+		return toolError(err.Error()), nil, nil
+	}
+
+	if result := t.checkPolicy(ctx, req, "webfetch", input.URL); result != nil {
+		return result, nil, nil
+	}
+
+	// Only forward headers the operator allowed
+	if err := checkHeaders(input.Headers, t.cfg.allowedHeaders); err != nil {
+		return t.blocked(ctx, req, "webfetch", input.URL, err), nil, nil
+	}
+
+	opts := t.fetchOptions(ctx, req, "webfetch", timeout)
+	opts.Headers = input.Headers
+	opts.Selector = input.Selector
+	opts.ExcludeSelectors = input.ExcludeSelectors
+	opts.Language = input.Language
+	opts.IgnoreFragment = input.IgnoreFragment
+	opts.InlineIframes = input.InlineIframes
+	if input.RenderJS {
+		opts.Render = t.render(sessionID(req))
+	}
+	opts.Raw = input.Raw
+	opts.NormalizeWhitespace = input.NormalizeWhitespace
+	opts.CacheMode = cacheMode
+	opts.Accept = t.cfg.acceptTypes(input.URL)
+	if len(input.Accept) > 0 {
+		opts.Accept = input.Accept
+	}
+
+	// Use the per-call user agent only if it matches the operator policy
+	if input.UserAgent != "" {
+		if err := checkUserAgent(input.UserAgent, t.cfg.userAgentPattern); err != nil {
+			return t.blocked(ctx, req, "webfetch", input.URL, err), nil, nil
+		}
+		opts.UserAgent = input.UserAgent
 	}
 
-	markdown, err := webfetch.FetchAndConvert(ctx, input.URL, timeout)
+	doc, err := webfetch.Fetch(ctx, input.URL, opts)
 	if err != nil {
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: err.Error()},
-			},
-			IsError: true,
-		}, nil, nil
+		return fetchError(err), nil, nil
+	}
+	if t.noarchive != nil {
+		if err := t.noarchive.check(sessionID(req), requestID(ctx), "webfetch", doc); err != nil {
+			return toolError(err.Error()), nil, nil
+		}
+	}
+
+	markdown := doc.Content
+	if t.pii != nil && doc.Encoding == "" {
+		// Scrubbed first, so that post-processors never send personal data elsewhere
+		markdown = t.pii.scrub(markdown)
 	}
+	if doc.Encoding == "base64" {
+		markdown = fmt.Sprintf("Base64-encoded %s body:\n%s", doc.ContentType, doc.Content)
+	} else if !input.Raw {
+		for _, p := range t.postProcessors {
+			if markdown, err = p.postProcess(ctx, input, markdown); err != nil {
+				return toolError(err.Error()), nil, nil
+			}
+		}
+		if markdown, err = normalizeUnicode(markdown, input.UnicodeNormalization); err != nil {
+			return toolError(err.Error()), nil, nil
+		}
+		if input.NormalizeTypography {
+			markdown = normalizeTypography(markdown)
+		}
+		markdown = withTableOfContents(markdown, input.TOCMinLength)
+	}
+	// Keywords describe the whole page, not the returned part
+	fullMarkdown := markdown
 
-	// Truncate content if it exceeds maxContentTokens
-	if maxContentTokens > 0 && len(markdown) > maxContentTokens {
+	if input.Save {
+		// The summary replaces the whole content
+		saved := *doc
+		saved.Content = markdown
+		// Random IDs keep the URIs of the results of other sessions unknown
+		uri := "webfetch://saved/" + rand.Text()
+		if _, err := t.saveDocument(req, uri, &saved); err != nil {
+			return toolError(err.Error()), nil, nil
+		}
+		markdown = saveSummary(uri, &saved)
+	} else if input.StartIndex > 0 || input.MaxLength > 0 {
+		// Page through the content like the reference fetch server
+		maxLength := maxContentTokens
+		if input.MaxLength > 0 {
+			// max_length is capped by -max-content-tokens-limit too
+			maxLength = t.resolveMaxContentTokens(input.MaxLength)
+		}
+		markdown = paginateContent(markdown, input.StartIndex, maxLength)
+	} else if maxContentTokens > 0 && len(markdown) > maxContentTokens {
+		// Truncate content if it exceeds maxContentTokens
 		markdown = markdown[:maxContentTokens] + "\n\n... (truncated)"
 	}
 
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{Text: markdown},
-		},
-	}, nil, nil
+	// Build one content block per requested representation
+	result := &mcp.CallToolResult{}
+	for _, format := range formats {
+		var text string
+		switch format {
+		case formatMarkdown:
+			text = markdown
+		case formatMetadata:
+			title, metadata := doc.Title, doc.Metadata
+			if t.pii != nil {
+				title, metadata = t.pii.scrub(title), t.pii.scrubMetadata(metadata)
+			}
+			data, err := json.MarshalIndent(documentMetadata{
+				URL:         doc.URL,
+				FinalURL:    finalURL(doc),
+				Title:       title,
+				ContentType: doc.ContentType,
+				Size:        len(doc.Content),
+				ContentHash: doc.ContentHash,
+				DuplicateOf: doc.DuplicateOf,
+				FetchedAt:   formatFetchedAt(doc.FetchedAt),
+				Stale:       doc.Stale,
+				Metadata:    metadata,
+			}, "", "  ")
+			if err != nil {
+				return toolError("failed to encode metadata: " + err.Error()), nil, nil
+			}
+			text = string(data)
+		case formatLinks:
+			text = strings.Join(doc.Links, "\n")
+		case formatCitations:
+			citations := doc.Citations
+			if citations == nil {
+				citations = []webfetch.Citation{}
+			}
+			if t.pii != nil {
+				citations = t.pii.scrubCitations(citations)
+			}
+			data, err := json.MarshalIndent(citations, "", "  ")
+			if err != nil {
+				return toolError("failed to encode citations: " + err.Error()), nil, nil
+			}
+			text = string(data)
+		case formatKeywords:
+			data, err := json.MarshalIndent(extractKeywords(fullMarkdown), "", "  ")
+			if err != nil {
+				return toolError("failed to encode keywords: " + err.Error()), nil, nil
+			}
+			text = string(data)
+		}
+		result.Content = append(result.Content, &mcp.TextContent{Text: text})
+	}
+	if doc.Stale {
+		result.Meta = mcp.Meta{staleMetaKey: staleInfo{
+			FetchedAt:  formatFetchedAt(doc.FetchedAt),
+			AgeSeconds: time.Since(doc.FetchedAt).Round(time.Second).Seconds(),
+		}}
+	}
+	if final := finalURL(doc); final != "" {
+		if result.Meta == nil {
+			result.Meta = mcp.Meta{}
+		}
+		result.Meta[finalURLMetaKey] = final
+	}
+	if doc.CacheStatus != "" {
+		if result.Meta == nil {
+			result.Meta = mcp.Meta{}
+		}
+		result.Meta[cacheMetaKey] = string(doc.CacheStatus)
+	}
+
+	return result, nil, nil
+}
+
+// staleMetaKey is the _meta key of tool results served stale from the cache
+const staleMetaKey = "stale"
+
+// finalURLMetaKey is the _meta key of the URL of redirected fetches after
+// redirects
+const finalURLMetaKey = "final_url"
+
+// cacheMetaKey is the _meta key of how the result cache served the page: hit,
+// miss, revalidated or bypass
+const cacheMetaKey = "cache"
+
+// finalURL returns the URL doc was served from if the request was redirected,
+// otherwise an empty string
+func finalURL(doc *webfetch.Document) string {
+	if doc.FinalURL == "" || doc.FinalURL == doc.URL {
+		return ""
+	}
+	return doc.FinalURL
+}
+
+// staleInfo describes a page served stale while it is refreshed
+type staleInfo struct {
+	FetchedAt  string  `json:"fetched_at"`
+	AgeSeconds float64 `json:"age_seconds"`
+}
+
+// formatFetchedAt formats the fetch time of a document, if known
+func formatFetchedAt(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// checkHeaders returns an error if headers contains a name that is not in allowed.
+// Header names are compared case-insensitively.
+func checkHeaders(headers map[string]string, allowed []string) error {
+	for name := range headers {
+		if !slices.ContainsFunc(allowed, func(a string) bool { return strings.EqualFold(a, name) }) {
+			return fmt.Errorf("header %q is not allowed by server policy", http.CanonicalHeaderKey(name))
+		}
+	}
+	return nil
+}
+
+// checkUserAgent returns an error unless userAgent matches the operator pattern.
+// A nil pattern rejects every per-call user agent.
+func checkUserAgent(userAgent string, pattern *regexp.Regexp) error {
+	if pattern == nil {
+		return fmt.Errorf("custom user agents are not allowed by server policy")
+	}
+	if !pattern.MatchString(userAgent) {
+		return fmt.Errorf("user agent %q is not allowed by server policy", userAgent)
+	}
+	return nil
+}
+
+// paginateContent returns at most maxLength characters of content starting at the
+// character offset startIndex. Like the reference MCP fetch server, it appends a note
+// with the next start_index when content remains, and returns an error note when
+// startIndex is past the end.
+func paginateContent(content string, startIndex, maxLength int) string {
+	runes := []rune(content)
+	if startIndex >= len(runes) {
+		return "<error>No more content available.</error>"
+	}
+
+	end := min(startIndex+maxLength, len(runes))
+	page := string(runes[startIndex:end])
+	if end < len(runes) {
+		page += fmt.Sprintf("\n\n<error>Content truncated. Call the fetch tool with a start_index of %d to get more content.</error>", end)
+	}
+	return page
 }
@@ -0,0 +1,591 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestCheckHeaders(t *testing.T) {
+	allowed := []string{"Referer", "Authorization"}
+
+	tests := []struct {
+		name          string
+		headers       map[string]string
+		expectedError string
+	}{
+		{
+			name:    "no headers",
+			headers: nil,
+		},
+		{
+			name:    "allowed headers",
+			headers: map[string]string{"Referer": "https://example.com", "authorization": "Bearer x"},
+		},
+		{
+			name:          "disallowed header",
+			headers:       map[string]string{"cookie": "session=1"},
+			expectedError: `header "Cookie" is not allowed`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkHeaders(tt.headers, allowed)
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("expected error containing %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestCheckUserAgent(t *testing.T) {
+	pattern := regexp.MustCompile("^(?:Mozilla/5.0 .*)$")
+
+	tests := []struct {
+		name          string
+		userAgent     string
+		pattern       *regexp.Regexp
+		expectedError string
+	}{
+		{
+			name:      "matching user agent",
+			userAgent: "Mozilla/5.0 (X11; Linux x86_64)",
+			pattern:   pattern,
+		},
+		{
+			name:          "non-matching user agent",
+			userAgent:     "curl/8.0",
+			pattern:       pattern,
+			expectedError: `user agent "curl/8.0" is not allowed`,
+		},
+		{
+			name:          "no pattern configured",
+			userAgent:     "Mozilla/5.0 (X11; Linux x86_64)",
+			pattern:       nil,
+			expectedError: "custom user agents are not allowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkUserAgent(tt.userAgent, tt.pattern)
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("expected error containing %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestResolveLimits(t *testing.T) {
+	tests := []struct {
+		name           string
+		cfg            config
+		timeout        string
+		tokens         int
+		expectedTime   time.Duration
+		expectedTokens int
+	}{
+		{
+			name:           "built-in defaults",
+			expectedTime:   defaultTimeout,
+			expectedTokens: defaultMaxContentTokens,
+		},
+		{
+			name:           "server defaults",
+			cfg:            config{timeout: 10 * time.Second, maxContentTokens: 500},
+			expectedTime:   10 * time.Second,
+			expectedTokens: 500,
+		},
+		{
+			name:           "per-call values",
+			cfg:            config{maxTimeout: time.Minute, maxContentTokensLimit: 1000},
+			timeout:        "20s",
+			tokens:         800,
+			expectedTime:   20 * time.Second,
+			expectedTokens: 800,
+		},
+		{
+			name:           "per-call values clamped",
+			cfg:            config{maxTimeout: time.Minute, maxContentTokensLimit: 1000},
+			timeout:        "1h",
+			tokens:         5000,
+			expectedTime:   time.Minute,
+			expectedTokens: 1000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tl := &tools{cfg: tt.cfg}
+
+			timeout, err := tl.resolveTimeout(tt.timeout)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if timeout != tt.expectedTime {
+				t.Errorf("expected timeout %v, got %v", tt.expectedTime, timeout)
+			}
+			if tokens := tl.resolveMaxContentTokens(tt.tokens); tokens != tt.expectedTokens {
+				t.Errorf("expected max content tokens %d, got %d", tt.expectedTokens, tokens)
+			}
+		})
+	}
+
+	for _, timeout := range []string{"soon", "0s", "-1s"} {
+		if _, err := (&tools{}).resolveTimeout(timeout); err == nil {
+			t.Errorf("expected error for invalid timeout %q", timeout)
+		}
+	}
+}
+
+func TestPaginateContent(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		startIndex int
+		maxLength  int
+		expected   string
+	}{
+		{
+			name:      "fits in one page",
+			content:   "Hello World",
+			maxLength: 20,
+			expected:  "Hello World",
+		},
+		{
+			name:      "first page of several",
+			content:   "Hello World",
+			maxLength: 5,
+			expected:  "Hello\n\n<error>Content truncated. Call the fetch tool with a start_index of 5 to get more content.</error>",
+		},
+		{
+			name:       "last page",
+			content:    "Hello World",
+			startIndex: 6,
+			maxLength:  5,
+			expected:   "World",
+		},
+		{
+			name:       "offsets count characters not bytes",
+			content:    "héllo wörld",
+			startIndex: 1,
+			maxLength:  4,
+			expected:   "éllo\n\n<error>Content truncated. Call the fetch tool with a start_index of 5 to get more content.</error>",
+		},
+		{
+			name:       "start past the end",
+			content:    "Hello",
+			startIndex: 5,
+			maxLength:  5,
+			expected:   "<error>No more content available.</error>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := paginateContent(tt.content, tt.startIndex, tt.maxLength)
+			if result != tt.expected {
+				t.Errorf("paginateContent() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWebfetchTool_MaxLengthLimit(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(strings.Repeat("a", 100)))
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{maxContentTokensLimit: 10}))
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch",
+		Arguments: map[string]any{"url": site.URL, "max_length": 50},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	text := res.Content[0].(*mcp.TextContent).Text
+	if !strings.HasPrefix(text, strings.Repeat("a", 10)+"\n\n<error>Content truncated. Call the fetch tool with a start_index of 10") {
+		t.Errorf("expected max_length capped to 10 characters, got %q", text)
+	}
+}
+
+func TestWebfetchTool_Formats(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html lang="en"><head><title>Page</title><meta name="description" content="About"></head>` +
+			`<body><p>Hello</p><a href="/a">A</a> <a href="/b">B</a></body></html>`))
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{}))
+
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name: "webfetch",
+		Arguments: map[string]any{
+			"url":     site.URL,
+			"formats": []string{"metadata", "markdown", "links"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if res.IsError || len(res.Content) != 3 {
+		t.Fatalf("expected 3 content blocks, got %+v", res.Content)
+	}
+
+	var md documentMetadata
+	if err := json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &md); err != nil {
+		t.Fatalf("failed to decode metadata block: %v", err)
+	}
+	if md.Title != "Page" || md.Description != "About" || md.Language != "en" || md.ContentType != "text/html" {
+		t.Errorf("unexpected metadata: %+v", md)
+	}
+
+	if text := res.Content[1].(*mcp.TextContent).Text; !strings.Contains(text, "Hello") {
+		t.Errorf("expected markdown block, got %q", text)
+	}
+
+	if text := res.Content[2].(*mcp.TextContent).Text; text != site.URL+"/a\n"+site.URL+"/b" {
+		t.Errorf("unexpected links block: %q", text)
+	}
+}
+
+func TestWebfetchTool_StripTracking(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<p>Query: %s</p><a href="/a?id=1&amp;utm_source=x&amp;ref=y">A</a>`, r.URL.RawQuery)
+	}))
+	defer site.Close()
+
+	tests := []struct {
+		name          string
+		cfg           config
+		expectedQuery string
+		expectedLink  string
+	}{
+		{name: "none", cfg: config{stripTracking: stripTrackingNone}, expectedQuery: "q=go&fbclid=abc", expectedLink: "/a?id=1&utm_source=x&ref=y"},
+		{name: "links", cfg: config{stripTracking: stripTrackingLinks}, expectedQuery: "q=go&fbclid=abc", expectedLink: "/a?id=1&ref=y"},
+		{name: "all", cfg: config{stripTracking: stripTrackingAll}, expectedQuery: "q=go", expectedLink: "/a?id=1&ref=y"},
+		{
+			name:          "custom parameters",
+			cfg:           config{stripTracking: stripTrackingAll, trackingParams: []string{"ref", "fbclid"}},
+			expectedQuery: "q=go",
+			expectedLink:  "/a?id=1&utm_source=x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := connectTestClient(t, setupMCPServer(tt.cfg))
+			res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+				Name:      "webfetch",
+				Arguments: map[string]any{"url": site.URL + "/?q=go&fbclid=abc", "formats": []string{"markdown", "links"}},
+			})
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+			if res.IsError || len(res.Content) != 2 {
+				t.Fatalf("expected 2 content blocks, got %+v", res.Content)
+			}
+			if text := res.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, "Query: "+tt.expectedQuery+"\n") {
+				t.Errorf("expected query %q to be fetched, got %q", tt.expectedQuery, text)
+			}
+			if text := res.Content[1].(*mcp.TextContent).Text; text != site.URL+tt.expectedLink {
+				t.Errorf("expected links block %q, got %q", site.URL+tt.expectedLink, text)
+			}
+		})
+	}
+}
+
+func TestWebfetchTool_UnknownFormat(t *testing.T) {
+	session := connectTestClient(t, setupMCPServer(config{}))
+
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch",
+		Arguments: map[string]any{"url": "https://example.com", "formats": []string{"pdf"}},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if !res.IsError || !strings.Contains(res.Content[0].(*mcp.TextContent).Text, "unknown format: pdf") {
+		t.Errorf("expected unknown format error, got %+v", res.Content)
+	}
+}
+
+func TestSetupMCPServer_DisabledFeatures(t *testing.T) {
+	cfg := config{
+		cacheTTL: time.Minute,
+		disabled: map[string]bool{featureCrawl: true, featureCache: true, featurePDF: true, featureStats: true, featureCheck: true, featureInfo: true, featureDiff: true, featureWatch: true, featureLLMsTxt: true, featurePreview: true, featureBatch: true},
+	}
+	session := connectTestClient(t, setupMCPServer(cfg))
+
+	res, err := session.ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("ListTools failed: %v", err)
+	}
+
+	var names []string
+	for _, tool := range res.Tools {
+		names = append(names, tool.Name)
+		if tool.Name == "webfetch" && strings.Contains(tool.Description, "PDF") {
+			t.Errorf("expected webfetch description without PDF, got %q", tool.Description)
+		}
+	}
+	slices.Sort(names)
+	if expected := []string{"webfetch", "webfetch_history"}; !slices.Equal(names, expected) {
+		t.Errorf("expected tools %v, got %v", expected, names)
+	}
+}
+
+func TestSetupMCPServer_ToolPrefix(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Hello</p>"))
+	}))
+	defer site.Close()
+
+	cfg := config{toolPrefix: "web.", disabled: map[string]bool{featureCache: true, featureStats: true, featureCheck: true}}
+	session := connectTestClient(t, setupMCPServer(cfg))
+
+	res, err := session.ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("ListTools failed: %v", err)
+	}
+	var names []string
+	for _, tool := range res.Tools {
+		names = append(names, tool.Name)
+	}
+	slices.Sort(names)
+	if expected := []string{"web.batch", "web.changes", "web.crawl", "web.fetch", "web.history", "web.info", "web.llms_txt", "web.preview", "web.watch"}; !slices.Equal(names, expected) {
+		t.Errorf("expected tools %v, got %v", expected, names)
+	}
+
+	result, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "web.fetch",
+		Arguments: map[string]any{"url": site.URL},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if result.IsError || !strings.Contains(result.Content[0].(*mcp.TextContent).Text, "Hello") {
+		t.Errorf("expected page content, got %+v", result.Content)
+	}
+}
+
+func TestWebfetchTool_MaxConcurrentRequests(t *testing.T) {
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-unblock
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Hello</p>"))
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{maxConcurrentRequests: 1, requestQueueTimeout: 50 * time.Millisecond}))
+	call := func(path string) *mcp.CallToolResult {
+		res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+			Name:      "webfetch",
+			Arguments: map[string]any{"url": site.URL + path},
+		})
+		if err != nil {
+			t.Errorf("CallTool failed: %v", err)
+			return nil
+		}
+		return res
+	}
+
+	slow := make(chan *mcp.CallToolResult, 1)
+	go func() { slow <- call("/slow") }()
+	<-started
+
+	res := call("/fast")
+	if text := res.Content[0].(*mcp.TextContent).Text; !res.IsError || !strings.Contains(text, "timed out waiting for an outbound request slot") {
+		t.Errorf("expected queue timeout, got %q", text)
+	}
+
+	close(unblock)
+	if res := <-slow; res == nil || res.IsError {
+		t.Errorf("expected slow fetch to succeed, got %+v", res)
+	}
+	if res := call("/fast"); res.IsError {
+		t.Errorf("expected fetch to succeed once the slot is free, got %q", res.Content[0].(*mcp.TextContent).Text)
+	}
+}
+
+func TestWebfetchTool_StrictContentType(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("<!DOCTYPE html><p>Hello</p>"))
+	}))
+	defer site.Close()
+
+	tests := []struct {
+		name     string
+		strict   bool
+		expected string
+	}{
+		{name: "default", expected: "failed to parse PDF"},
+		{name: "strict", strict: true, expected: "content type mismatch: body looks like text/html but is declared as application/pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := connectTestClient(t, setupMCPServer(config{strictContentType: tt.strict}))
+			res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+				Name:      "webfetch",
+				Arguments: map[string]any{"url": site.URL},
+			})
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+			if text := res.Content[0].(*mcp.TextContent).Text; !res.IsError || !strings.Contains(text, tt.expected) {
+				t.Errorf("expected error %q, got %q", tt.expected, text)
+			}
+		})
+	}
+}
+
+func TestWebfetchTool_URLCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "alice" || password != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Private page</p>"))
+	}))
+	defer server.Close()
+	withCredentials := strings.Replace(server.URL, "http://", "http://alice:s3cret@", 1)
+
+	var audit bytes.Buffer
+	session := connectTestClient(t, setupMCPServer(config{auditLogOutput: &audit}))
+	calls := []map[string]any{
+		{"url": withCredentials + "/private"},
+		{"url": withCredentials + "/blocked", "headers": map[string]string{"Cookie": "x"}},
+	}
+	for _, args := range calls {
+		if _, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "webfetch", Arguments: args}); err != nil {
+			t.Fatalf("CallTool failed: %v", err)
+		}
+	}
+
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch",
+		Arguments: map[string]any{"url": withCredentials + "/private", "formats": []string{"metadata"}},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected tool error: %v", res.Content[0].(*mcp.TextContent).Text)
+	}
+	var metadata documentMetadata
+	if err := json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &metadata); err != nil {
+		t.Fatalf("failed to decode metadata: %v", err)
+	}
+	if metadata.URL != server.URL+"/private" {
+		t.Errorf("expected the URL without credentials, got %q", metadata.URL)
+	}
+
+	res, err = session.CallTool(context.Background(), &mcp.CallToolParams{Name: "webfetch_history"})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	history, _ := json.Marshal(res.StructuredContent)
+	for name, log := range map[string]string{"audit log": audit.String(), "history": string(history)} {
+		if strings.Contains(log, "s3cret") || strings.Contains(log, "alice") {
+			t.Errorf("expected the %s without credentials, got %s", name, log)
+		}
+		if !strings.Contains(log, server.URL+"/private") {
+			t.Errorf("expected the %s to record %s, got %s", name, server.URL+"/private", log)
+		}
+	}
+}
+
+func TestWebfetchTool_FinalURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Moved page</p>"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name             string
+		path             string
+		maxRedirects     int
+		expectedFinalURL string
+		expectedErr      string
+	}{
+		{name: "redirected", path: "/old", expectedFinalURL: server.URL + "/new"},
+		{name: "not redirected", path: "/new"},
+		{name: "redirects disabled", path: "/old", maxRedirects: -1, expectedErr: "stopped after 0 redirects"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := connectTestClient(t, setupMCPServer(config{maxRedirects: tt.maxRedirects}))
+			res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+				Name:      "webfetch",
+				Arguments: map[string]any{"url": server.URL + tt.path, "formats": []string{"metadata"}},
+			})
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+			text := res.Content[0].(*mcp.TextContent).Text
+			if tt.expectedErr != "" {
+				if !res.IsError || !strings.Contains(text, tt.expectedErr) {
+					t.Errorf("expected error %q, got %q", tt.expectedErr, text)
+				}
+				return
+			}
+			if res.IsError {
+				t.Fatalf("unexpected tool error: %v", text)
+			}
+
+			var metadata documentMetadata
+			if err := json.Unmarshal([]byte(text), &metadata); err != nil {
+				t.Fatalf("failed to decode metadata: %v", err)
+			}
+			if metadata.URL != server.URL+tt.path || metadata.FinalURL != tt.expectedFinalURL {
+				t.Errorf("expected %s with final URL %q, got %s with %q", server.URL+tt.path, tt.expectedFinalURL, metadata.URL, metadata.FinalURL)
+			}
+			if final, _ := res.Meta[finalURLMetaKey].(string); final != tt.expectedFinalURL {
+				t.Errorf("expected final URL %q in _meta, got %v", tt.expectedFinalURL, res.Meta[finalURLMetaKey])
+			}
+		})
+	}
+}
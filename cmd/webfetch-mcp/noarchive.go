@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/benoute/webfetch"
+)
+
+// Values of -noarchive
+const (
+	noarchiveIgnore  = "ignore"
+	noarchiveNoCache = "no-cache"
+	noarchiveRefuse  = "refuse"
+)
+
+// noarchivePolicy handles the pages whose robots directives ask not to keep a
+// copy of them (noindex, noarchive or none): they are never cached and, when
+// refuse is set, not returned either
+type noarchivePolicy struct {
+	refuse bool
+	logger *slog.Logger
+}
+
+// newNoarchivePolicy returns a policy logging its decisions to w
+func newNoarchivePolicy(refuse bool, w io.Writer) *noarchivePolicy {
+	return &noarchivePolicy{refuse: refuse, logger: slog.New(slog.NewJSONHandler(w, nil))}
+}
+
+// check logs the decision for doc if its robots directives ask not to keep a
+// copy of it, and returns an error if it must not be returned
+func (p *noarchivePolicy) check(session, requestID, tool string, doc *webfetch.Document) error {
+	if !doc.Metadata.NoArchive() {
+		return nil
+	}
+	decision := "not cached"
+	if p.refuse {
+		decision = "refused"
+	}
+	p.logger.Info("robots directives",
+		"session", session,
+		"request_id", requestID,
+		"tool", tool,
+		"url", doc.URL,
+		"robots", doc.Metadata.Robots,
+		"decision", decision,
+	)
+	if p.refuse {
+		return fmt.Errorf("refused: %s is marked %s by its robots directives", doc.URL, strings.Join(doc.Metadata.Robots, ", "))
+	}
+	return nil
+}
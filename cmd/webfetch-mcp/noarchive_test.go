@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestWebfetchTool_Noarchive(t *testing.T) {
+	var hits atomic.Int64
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("X-Robots-Tag", "noarchive")
+		w.Write([]byte(`<p>Hello</p>`))
+	}))
+	defer site.Close()
+
+	tests := []struct {
+		name             string
+		mode             string
+		expected         string
+		isError          bool
+		expectedHits     int64
+		expectedDecision string
+	}{
+		{name: "ignore", mode: noarchiveIgnore, expected: "Hello", expectedHits: 1},
+		{name: "no-cache", mode: noarchiveNoCache, expected: "Hello", expectedHits: 2, expectedDecision: "not cached"},
+		{name: "refuse", mode: noarchiveRefuse, expected: "is marked noarchive by its robots directives", isError: true, expectedHits: 2, expectedDecision: "refused"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits.Store(0)
+			var logs bytes.Buffer
+			session := connectTestClient(t, setupMCPServer(config{cacheTTL: time.Minute, noarchive: tt.mode, logOutput: &logs}))
+			for range 2 {
+				res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "webfetch", Arguments: map[string]any{"url": site.URL}})
+				if err != nil {
+					t.Fatalf("CallTool failed: %v", err)
+				}
+				text := res.Content[0].(*mcp.TextContent).Text
+				if res.IsError != tt.isError || !strings.Contains(text, tt.expected) {
+					t.Errorf("expected %q (error %t), got %q (error %t)", tt.expected, tt.isError, text, res.IsError)
+				}
+			}
+			if hits.Load() != tt.expectedHits {
+				t.Errorf("expected %d requests, got %d", tt.expectedHits, hits.Load())
+			}
+
+			if tt.expectedDecision == "" {
+				if logs.Len() != 0 {
+					t.Errorf("expected no log, got %s", logs.String())
+				}
+				return
+			}
+			var record struct {
+				URL      string   `json:"url"`
+				Robots   []string `json:"robots"`
+				Decision string   `json:"decision"`
+			}
+			line, _, _ := strings.Cut(logs.String(), "\n")
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("failed to decode log record %q: %v", line, err)
+			}
+			if record.URL != site.URL || record.Decision != tt.expectedDecision || len(record.Robots) != 1 {
+				t.Errorf("expected %s decision for %s, got %+v", tt.expectedDecision, site.URL, record)
+			}
+		})
+	}
+}
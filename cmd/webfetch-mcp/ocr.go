@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/benoute/webfetch"
+)
+
+// maxOCROutput is the maximum size in bytes of the text of a page read from
+// the OCR command
+const maxOCROutput = 1 << 20
+
+// commandOCR returns an OCRFunc running command, split on spaces, with the page
+// number as last argument and the PDF on its standard input. Its standard
+// output is the text of the page. For example, a script running pdftoppm and
+// tesseract.
+func commandOCR(command string) webfetch.OCRFunc {
+	args := strings.Fields(command)
+	return func(ctx context.Context, pdf []byte, page int) (string, error) {
+		cmd := exec.CommandContext(ctx, args[0], append(args[1:], strconv.Itoa(page))...)
+		cmd.Stdin = bytes.NewReader(pdf)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("OCR of page %d failed: %w: %s", page, err, strings.TrimSpace(stderr.String()))
+		}
+		if len(out) > maxOCROutput {
+			out = out[:maxOCROutput]
+		}
+		return strings.ToValidUTF8(string(out), ""), nil
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCommandOCR(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		expected string
+		err      string
+	}{
+		{name: "page argument", command: "echo page", expected: "page 3\n"},
+		{name: "pdf on stdin", command: "tr -d", expected: "%PDF-1.7"},
+		{name: "failure", command: "false", err: "OCR of page 3 failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, err := commandOCR(tt.command)(context.Background(), []byte("%PDF-1.7"), 3)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if text != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, text)
+			}
+		})
+	}
+}
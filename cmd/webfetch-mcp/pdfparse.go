@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benoute/webfetch"
+)
+
+const (
+	// defaultPDFTimeout bounds the time spent parsing a PDF
+	defaultPDFTimeout = 30 * time.Second
+	// defaultPDFMemoryLimit is the memory cap of PDF parser subprocesses (512MB)
+	defaultPDFMemoryLimit = 512 * 1024 * 1024
+)
+
+// pdfParseResult is written by the pdf-parse command to its standard output
+type pdfParseResult struct {
+	Content string `json:"content,omitempty"`
+	Page    int    `json:"page,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// runPDFParse runs the internal pdf-parse command: it converts the PDF read
+// from stdin and writes a pdfParseResult to stdout. Its memory is capped so
+// that the parser crashes instead of exhausting the memory of the host. It
+// returns the exit status.
+func runPDFParse(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("pdf-parse", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	memoryLimit := fs.Int64("memory-limit", defaultPDFMemoryLimit, "Memory cap in bytes")
+	maxPages := fs.Int("max-pages", 0, "Maximum number of pages (default: no limit)")
+	ocrCommand := fs.String("ocr-command", "", "OCR command for pages whose fonts have no Unicode mapping")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *memoryLimit > 0 {
+		// The soft limit makes the garbage collector work harder before the
+		// hard limit, where supported, makes allocations fail
+		debug.SetMemoryLimit(*memoryLimit)
+		if err := setMemoryCap(*memoryLimit); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	opts := webfetch.FetchOptions{MaxPDFPages: *maxPages}
+	if *ocrCommand != "" {
+		opts.PDFOCR = commandOCR(*ocrCommand)
+	}
+	var result pdfParseResult
+	result.Content, err = webfetch.ConvertPDF(context.Background(), data, opts)
+	if err != nil {
+		var parseErr *webfetch.PDFParseError
+		if errors.As(err, &parseErr) {
+			result.Page, err = parseErr.Page, parseErr.Err
+		}
+		result.Error = err.Error()
+	}
+	if err := json.NewEncoder(stdout).Encode(result); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// subprocessPDFParser returns a webfetch.FetchOptions.PDFParser running the
+// pdf-parse command of this executable, so that parser crashes and runaway
+// memory use do not take down the server. The subprocess is killed after
+// cfg.pdfTimeout, if positive.
+func subprocessPDFParser(cfg config) func(ctx context.Context, pdf io.Reader) (string, error) {
+	args := []string{"pdf-parse", "-memory-limit", strconv.FormatInt(cfg.pdfMemoryLimit, 10), "-max-pages", strconv.Itoa(cfg.maxPDFPages)}
+	if cfg.pdfOCRCommand != "" {
+		args = append(args, "-ocr-command", cfg.pdfOCRCommand)
+	}
+	return func(ctx context.Context, pdf io.Reader) (string, error) {
+		exe, err := os.Executable()
+		if err != nil {
+			return "", &webfetch.PDFParseError{Err: fmt.Errorf("parser process failed: %w", err)}
+		}
+		parseCtx := ctx
+		if cfg.pdfTimeout > 0 {
+			var cancel context.CancelFunc
+			parseCtx, cancel = context.WithTimeout(ctx, cfg.pdfTimeout)
+			defer cancel()
+		}
+
+		cmd := exec.CommandContext(parseCtx, exe, args...)
+		cmd.Stdin = pdf
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			if parseCtx.Err() != nil {
+				return "", &webfetch.PDFParseError{Err: webfetch.ErrPDFTimeout}
+			}
+			// Out of memory and other crashes report their cause first
+			cause, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n")
+			return "", &webfetch.PDFParseError{Err: fmt.Errorf("parser process failed: %v: %s", err, cause)}
+		}
+
+		var result pdfParseResult
+		if err := json.Unmarshal(out, &result); err != nil {
+			return "", &webfetch.PDFParseError{Err: fmt.Errorf("parser process failed: %w", err)}
+		}
+		if result.Error != "" {
+			return "", &webfetch.PDFParseError{Page: result.Page, Err: errors.New(result.Error)}
+		}
+		return result.Content, nil
+	}
+}
+
+// maxPDFFallbackOutput is the maximum size in bytes of the text read from the
+// PDF fallback command
+const maxPDFFallbackOutput = 16 << 20
+
+// commandPDFEngine returns a webfetch.PDFEngine named after the program of
+// command, split on spaces, run with the PDF on its standard input. Its
+// standard output is the text of the PDF, e.g. with "pdftotext - -" or
+// "mutool draw -F txt -o - /dev/stdin".
+func commandPDFEngine(command string) *webfetch.PDFEngine {
+	args := strings.Fields(command)
+	return &webfetch.PDFEngine{
+		Name: filepath.Base(args[0]),
+		Convert: func(ctx context.Context, pdf io.Reader) (string, error) {
+			cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+			cmd.Stdin = pdf
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
+			out, err := cmd.Output()
+			if err != nil {
+				return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+			}
+			if len(out) > maxPDFFallbackOutput {
+				out = out[:maxPDFFallbackOutput]
+			}
+			return strings.ToValidUTF8(string(out), ""), nil
+		},
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// setMemoryCap limits the data segment of the process, which includes the Go
+// heap, to limit bytes. RLIMIT_AS cannot be used as the Go runtime reserves
+// more address space than it uses.
+func setMemoryCap(limit int64) error {
+	rlimit := &syscall.Rlimit{Cur: uint64(limit), Max: uint64(limit)}
+	if err := syscall.Setrlimit(syscall.RLIMIT_DATA, rlimit); err != nil {
+		return fmt.Errorf("failed to cap memory: %w", err)
+	}
+	return nil
+}
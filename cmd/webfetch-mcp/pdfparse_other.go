@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+// setMemoryCap is a no-op outside Linux, where the data segment limit does not
+// bound mmap allocations: only the soft limit of the garbage collector applies
+func setMemoryCap(limit int64) error {
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestMain(m *testing.M) {
+	// PDF parser subprocesses run the test binary
+	if len(os.Args) > 1 && os.Args[1] == "pdf-parse" {
+		os.Exit(runPDFParse(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+	os.Exit(m.Run())
+}
+
+// onePagePDF returns a PDF document whose page has the content stream content
+func onePagePDF(content string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func TestRunPDFParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		pdf      []byte
+		expected pdfParseResult
+	}{
+		{
+			name:     "valid",
+			pdf:      onePagePDF("BT /F1 12 Tf 72 720 Td (Hello) Tj ET"),
+			expected: pdfParseResult{Content: "## Page 1\n\nHello"},
+		},
+		{
+			name:     "parser crash",
+			pdf:      onePagePDF("BT 1 Td ET"),
+			expected: pdfParseResult{Page: 1, Error: "parser crashed: bad Td"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			// A memory cap would apply to the test process
+			if code := runPDFParse([]string{"-memory-limit", "0"}, bytes.NewReader(tt.pdf), &stdout, &stderr); code != 0 {
+				t.Fatalf("expected exit status 0, got %d: %s", code, stderr.String())
+			}
+			var result pdfParseResult
+			if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+				t.Fatalf("failed to decode result %q: %v", stdout.String(), err)
+			}
+			result.Content = strings.TrimSpace(result.Content)
+			if result != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestWebfetchTool_PDFSubprocess(t *testing.T) {
+	pdfs := map[string][]byte{
+		"/valid": onePagePDF("BT /F1 12 Tf 72 720 Td (Hello) Tj ET"),
+		"/crash": onePagePDF("BT 1 Td ET"),
+	}
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write(pdfs[r.URL.Path])
+	}))
+	defer site.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		cfg      config
+		expected string
+		isError  bool
+		// linuxOnly cases rely on the hard memory cap
+		linuxOnly bool
+	}{
+		{name: "valid", path: "/valid", cfg: config{pdfMemoryLimit: defaultPDFMemoryLimit}, expected: "Hello"},
+		{
+			name:     "parser crash",
+			path:     "/crash",
+			cfg:      config{pdfMemoryLimit: defaultPDFMemoryLimit},
+			expected: "failed to parse PDF: page 1: parser crashed: bad Td",
+			isError:  true,
+		},
+		{
+			name:     "timeout",
+			path:     "/valid",
+			cfg:      config{pdfMemoryLimit: defaultPDFMemoryLimit, pdfTimeout: time.Nanosecond},
+			expected: "failed to parse PDF: parsing timed out",
+			isError:  true,
+		},
+		{
+			name:      "memory cap",
+			path:      "/valid",
+			cfg:       config{pdfMemoryLimit: 1024 * 1024},
+			expected:  "failed to parse PDF: parser process failed",
+			isError:   true,
+			linuxOnly: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.linuxOnly && runtime.GOOS != "linux" {
+				t.Skip("the memory cap is only enforced on Linux")
+			}
+			tt.cfg.pdfSubprocess = true
+			session := connectTestClient(t, setupMCPServer(tt.cfg))
+			res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+				Name:      "webfetch",
+				Arguments: map[string]any{"url": site.URL + tt.path},
+			})
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+			text := res.Content[0].(*mcp.TextContent).Text
+			if res.IsError != tt.isError || !strings.Contains(text, tt.expected) {
+				t.Errorf("expected %q (error %t), got %q (error %t)", tt.expected, tt.isError, text, res.IsError)
+			}
+		})
+	}
+}
+
+func TestWebfetchTool_PDFFallback(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write(onePagePDF("BT 1 Td ET"))
+	}))
+	defer site.Close()
+
+	tests := []struct {
+		name     string
+		command  string
+		expected string
+		isError  bool
+	}{
+		{name: "fallback", command: "sed -n s/1.Td/recovered/p", expected: "BT recovered ET"},
+		{name: "failing fallback", command: "false", expected: "parser crashed: bad Td (false: exit status 1", isError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := connectTestClient(t, setupMCPServer(config{pdfFallbackCommand: tt.command}))
+			res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+				Name:      "webfetch",
+				Arguments: map[string]any{"url": site.URL, "formats": []string{"markdown", "metadata"}},
+			})
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+			text := res.Content[0].(*mcp.TextContent).Text
+			if res.IsError != tt.isError || !strings.Contains(text, tt.expected) {
+				t.Errorf("expected %q (error %t), got %q (error %t)", tt.expected, tt.isError, text, res.IsError)
+			}
+			if !tt.isError && !strings.Contains(res.Content[1].(*mcp.TextContent).Text, `"pdf_engine": "sed"`) {
+				t.Errorf("expected the sed engine in metadata, got %s", res.Content[1].(*mcp.TextContent).Text)
+			}
+		})
+	}
+}
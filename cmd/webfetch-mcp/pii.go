@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/benoute/webfetch"
+)
+
+// Categories of personal data masked with -scrub-pii
+const (
+	piiEmail      = "email"
+	piiPhone      = "phone"
+	piiNationalID = "national-id"
+)
+
+// piiCategories lists the categories accepted by -scrub-pii
+var piiCategories = []string{piiEmail, piiPhone, piiNationalID}
+
+// piiRule masks the matches of pattern, if valid accepts them
+type piiRule struct {
+	category string
+	pattern  *regexp.Regexp
+	mask     string
+	valid    func(match string) bool
+}
+
+// piiRules are applied in order, so that the digits of emails and national IDs
+// are not taken for phone numbers
+var piiRules = []piiRule{
+	{
+		category: piiEmail,
+		// Markdown escapes underscores in the local part, e.g. john\_doe@example.com
+		pattern: regexp.MustCompile(`[A-Za-z0-9._%+\\-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+		mask:    "[redacted email]",
+	},
+	{
+		category: piiNationalID,
+		// US Social Security numbers and UK National Insurance numbers
+		pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b|\b[A-CEGHJ-PR-TW-Z]{2} ?\d{2} ?\d{2} ?\d{2} ?[A-D]\b`),
+		mask:    "[redacted national ID]",
+	},
+	{
+		category: piiPhone,
+		// International numbers, North American numbers with the area code in
+		// parentheses or dash separated, and national numbers in pairs of digits
+		// such as 06 12 34 56 78
+		pattern: regexp.MustCompile(`\+\d[\d ().-]{6,}\d|\(\d{3}\) ?\d{3}[-. ]\d{4}\b|\b\d{3}[-.]\d{3}[-.]\d{4}\b|\b0\d(?:[ .-]\d{2}){4}\b`),
+		mask:    "[redacted phone]",
+		valid: func(match string) bool {
+			digits := 0
+			for _, r := range match {
+				if r >= '0' && r <= '9' {
+					digits++
+				}
+			}
+			return digits >= 8 && digits <= 15
+		},
+	},
+}
+
+// parsePIICategories parses a comma-separated list of categories of personal data
+func parsePIICategories(s string) (map[string]bool, error) {
+	set := make(map[string]bool)
+	for _, name := range splitList(s) {
+		name = strings.ToLower(name)
+		if !slices.Contains(piiCategories, name) {
+			return nil, fmt.Errorf("unknown category %q (expected one of %s)", name, strings.Join(piiCategories, ", "))
+		}
+		set[name] = true
+	}
+	return set, nil
+}
+
+// piiScrubber masks the personal data of the enabled categories in the text
+// returned to agents
+type piiScrubber struct {
+	rules []piiRule
+}
+
+// newPIIScrubber returns a scrubber for categories, or nil if there is none
+func newPIIScrubber(categories map[string]bool) *piiScrubber {
+	var s piiScrubber
+	for _, rule := range piiRules {
+		if categories[rule.category] {
+			s.rules = append(s.rules, rule)
+		}
+	}
+	if len(s.rules) == 0 {
+		return nil
+	}
+	return &s
+}
+
+// scrub returns text with the personal data masked
+func (s *piiScrubber) scrub(text string) string {
+	for _, rule := range s.rules {
+		text = rule.pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if rule.valid != nil && !rule.valid(match) {
+				return match
+			}
+			return rule.mask
+		})
+	}
+	return text
+}
+
+// scrubCitations returns citations with the personal data of their text masked
+func (s *piiScrubber) scrubCitations(citations []webfetch.Citation) []webfetch.Citation {
+	scrubbed := make([]webfetch.Citation, len(citations))
+	for i, c := range citations {
+		scrubbed[i] = webfetch.Citation{URL: c.URL, Text: s.scrub(c.Text), Context: s.scrub(c.Context)}
+	}
+	return scrubbed
+}
+
+// scrubMetadata returns metadata with the personal data of its free text
+// fields masked
+func (s *piiScrubber) scrubMetadata(metadata webfetch.Metadata) webfetch.Metadata {
+	metadata.Description = s.scrub(metadata.Description)
+	metadata.Author = s.scrub(metadata.Author)
+	metadata.SiteName = s.scrub(metadata.SiteName)
+	return metadata
+}
+
+// scrubPreview returns preview with the personal data of its text masked
+func (s *piiScrubber) scrubPreview(preview webfetch.PagePreview) webfetch.PagePreview {
+	preview.Title = s.scrub(preview.Title)
+	preview.Description = s.scrub(preview.Description)
+	preview.SiteName = s.scrub(preview.SiteName)
+	return preview
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestPIIScrubber(t *testing.T) {
+	all := map[string]bool{piiEmail: true, piiPhone: true, piiNationalID: true}
+
+	tests := []struct {
+		name       string
+		categories map[string]bool
+		text       string
+		expected   string
+	}{
+		{name: "email", categories: all, text: "Write to john\\_doe@mail.example.com.", expected: "Write to [redacted email]."},
+		{name: "mailto link", categories: all, text: "[Contact](mailto:jane@example.org)", expected: "[Contact](mailto:[redacted email])"},
+		{name: "international phone", categories: all, text: "Call +33 6 12 34 56 78 now", expected: "Call [redacted phone] now"},
+		{name: "North American phone", categories: all, text: "Call (555) 123-4567 or 555.123.4567", expected: "Call [redacted phone] or [redacted phone]"},
+		{name: "national phone", categories: all, text: "Tel: 06 12 34 56 78", expected: "Tel: [redacted phone]"},
+		{name: "SSN", categories: all, text: "SSN 123-45-6789", expected: "SSN [redacted national ID]"},
+		{name: "NINO", categories: all, text: "NI number AB 12 34 56 C", expected: "NI number [redacted national ID]"},
+		{name: "numbers kept", categories: all, text: "In 2019-2024, 1,234 users paid +5 EUR (v1.2.3)", expected: "In 2019-2024, 1,234 users paid +5 EUR (v1.2.3)"},
+		{name: "short international number kept", categories: all, text: "+1 (555) 12", expected: "+1 (555) 12"},
+		{
+			name:       "disabled categories kept",
+			categories: map[string]bool{piiEmail: true},
+			text:       "jane@example.org, 555-123-4567, 123-45-6789",
+			expected:   "[redacted email], 555-123-4567, 123-45-6789",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newPIIScrubber(tt.categories).scrub(tt.text); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParsePIICategories(t *testing.T) {
+	categories, err := parsePIICategories("Email, national-id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !categories[piiEmail] || !categories[piiNationalID] || len(categories) != 2 {
+		t.Errorf("expected email and national-id, got %v", categories)
+	}
+	if _, err := parsePIICategories("email,address"); err == nil {
+		t.Error("expected error for unknown category")
+	}
+	if newPIIScrubber(nil) != nil {
+		t.Error("expected no scrubber without categories")
+	}
+}
+
+func TestWebfetchTool_ScrubPII(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Contact jane@example.org</title>
+<meta name="description" content="Call +44 20 7946 0958"><meta name="author" content="jane@example.org"></head>
+<body><p>Mail jane@example.org or see <a href="/team">the team page</a>, phone +44 20 7946 0958.</p></body></html>`))
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{scrubPII: map[string]bool{piiEmail: true, piiPhone: true}}))
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch",
+		Arguments: map[string]any{"url": site.URL, "formats": []string{"markdown", "citations", "metadata"}},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	for _, content := range res.Content {
+		text := content.(*mcp.TextContent).Text
+		if strings.Contains(text, "jane@example.org") || strings.Contains(text, "7946") {
+			t.Errorf("expected personal data to be masked, got %q", text)
+		}
+		if !strings.Contains(text, "[redacted email]") {
+			t.Errorf("expected a masked email, got %q", text)
+		}
+	}
+
+	// Previews are scrubbed too
+	res, err = session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch_preview",
+		Arguments: map[string]any{"urls": []string{site.URL}},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	data, _ := json.Marshal(res.StructuredContent)
+	if strings.Contains(string(data), "jane@example.org") || strings.Contains(string(data), "7946") || !strings.Contains(string(data), "[redacted email]") {
+		t.Errorf("expected personal data to be masked in the preview, got %s", data)
+	}
+}
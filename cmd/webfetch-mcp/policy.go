@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// policyReloadInterval is how often the policy file is checked for changes
+const policyReloadInterval = 2 * time.Second
+
+// policy is the operator policy applied to every outbound URL, loaded from a
+// JSON file. Host patterns are either a host name, matching exactly, or
+// "*.example.com", matching the subdomains of example.com.
+type policy struct {
+	// AllowHosts restricts fetches to matching hosts; empty allows all hosts
+	AllowHosts []string `json:"allow_hosts"`
+	// DenyHosts blocks matching hosts, even if allowed by AllowHosts
+	DenyHosts []string `json:"deny_hosts"`
+	// DenyCIDRs blocks connections to the addresses in these ranges, e.g.
+	// 10.0.0.0/8, checked once host names are resolved
+	DenyCIDRs []string `json:"deny_cidrs"`
+	// AllowCIDRs allows addresses in these ranges that are inside a larger range
+	// of DenyCIDRs, e.g. 10.1.2.0/24
+	AllowCIDRs []string `json:"allow_cidrs"`
+	// RateLimit limits the requests made to each host
+	RateLimit rateLimitPolicy `json:"rate_limit"`
+
+	// denyPrefixes and allowPrefixes are the parsed DenyCIDRs and AllowCIDRs
+	denyPrefixes  []netip.Prefix
+	allowPrefixes []netip.Prefix
+}
+
+type rateLimitPolicy struct {
+	// RequestsPerMinute applies to every host; 0 means unlimited
+	RequestsPerMinute int `json:"requests_per_minute"`
+	// Hosts overrides RequestsPerMinute for matching hosts
+	Hosts map[string]int `json:"hosts"`
+}
+
+// policyError reports a URL blocked by the policy
+type policyError struct {
+	reason string
+	// dial is set for connections refused by the CIDR rules, which are
+	// recorded in the audit log once the fetch fails
+	dial bool
+}
+
+func (e *policyError) Error() string {
+	return "blocked by policy: " + e.reason
+}
+
+// parsePolicy decodes and validates a policy file
+func parsePolicy(data []byte) (*policy, error) {
+	var p policy
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+
+	patterns := append(append([]string(nil), p.AllowHosts...), p.DenyHosts...)
+	for pattern := range p.RateLimit.Hosts {
+		patterns = append(patterns, pattern)
+	}
+	for _, pattern := range patterns {
+		if err := checkHostPattern(pattern); err != nil {
+			return nil, fmt.Errorf("invalid policy: %w", err)
+		}
+	}
+	var err error
+	if p.denyPrefixes, err = parsePrefixes(p.DenyCIDRs); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	if p.allowPrefixes, err = parsePrefixes(p.AllowCIDRs); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	if p.RateLimit.RequestsPerMinute < 0 {
+		return nil, fmt.Errorf("invalid policy: negative requests_per_minute")
+	}
+	for pattern, limit := range p.RateLimit.Hosts {
+		if limit < 0 {
+			return nil, fmt.Errorf("invalid policy: negative rate limit for %q", pattern)
+		}
+	}
+	return &p, nil
+}
+
+// parsePrefixes parses CIDR ranges; single addresses are ranges of one address
+func parsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid CIDR %q", cidr)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		// IPv4-mapped IPv6 ranges are matched as IPv4, like the addresses
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// longestMatch returns the length of the longest prefix containing ip, or -1
+func longestMatch(prefixes []netip.Prefix, ip netip.Addr) int {
+	longest := -1
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) && prefix.Bits() > longest {
+			longest = prefix.Bits()
+		}
+	}
+	return longest
+}
+
+// hostRegexps caches the compiled regular expressions of host patterns
+var hostRegexps sync.Map
+
+// isHostRegexp reports whether pattern is a regular expression between slashes
+func isHostRegexp(pattern string) bool {
+	return len(pattern) > 2 && pattern[0] == '/' && pattern[len(pattern)-1] == '/'
+}
+
+// hostRegexp compiles the regular expression of pattern, which must match
+// whole host names, ignoring case
+func hostRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := hostRegexps.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(`(?i)^(?:` + pattern[1:len(pattern)-1] + `)$`)
+	if err != nil {
+		return nil, err
+	}
+	hostRegexps.Store(pattern, re)
+	return re, nil
+}
+
+// checkHostPattern returns an error if pattern is not a valid host pattern: a
+// host name, a glob or a regular expression between slashes
+func checkHostPattern(pattern string) error {
+	if isHostRegexp(pattern) {
+		if _, err := hostRegexp(pattern); err != nil {
+			return fmt.Errorf("invalid host pattern %q: %w", pattern, err)
+		}
+		return nil
+	}
+	// Patterns of wildcards only, such as *, would match every host
+	if _, err := path.Match(pattern, ""); err != nil || strings.Trim(pattern, "*?.") == "" || strings.ContainsAny(pattern, "/:") {
+		return fmt.Errorf("invalid host pattern %q", pattern)
+	}
+	return nil
+}
+
+// parseHostPatterns parses comma-separated host patterns
+func parseHostPatterns(s string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(s, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		if err := checkHostPattern(pattern); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// matchHost reports whether host matches pattern: a host name matches
+// exactly, a glob such as *.example.com with path.Match, * matching dots too,
+// and a regular expression between slashes must match the whole host
+func matchHost(pattern, host string) bool {
+	host = normalizeHost(host)
+	if isHostRegexp(pattern) {
+		re, err := hostRegexp(pattern)
+		return err == nil && re.MatchString(host)
+	}
+	matched, _ := path.Match(strings.ToLower(pattern), host)
+	return matched
+}
+
+// normalizeHost returns host in lower case without the trailing dots of
+// fully qualified names, which reach the same host
+func normalizeHost(host string) string {
+	return strings.TrimRight(strings.ToLower(host), ".")
+}
+
+// checkHost returns a *policyError if host may not be fetched
+func (p *policy) checkHost(host string) error {
+	host = normalizeHost(host)
+	for _, pattern := range p.DenyHosts {
+		if matchHost(pattern, host) {
+			return &policyError{reason: fmt.Sprintf("host %s is denied", host)}
+		}
+	}
+	if len(p.AllowHosts) == 0 {
+		return nil
+	}
+	for _, pattern := range p.AllowHosts {
+		if matchHost(pattern, host) {
+			return nil
+		}
+	}
+	return &policyError{reason: fmt.Sprintf("host %s is not allowed", host)}
+}
+
+// checkIP returns a *policyError if connections to ip are not allowed: ip is
+// denied when the most specific range containing it is in DenyCIDRs
+func (p *policy) checkIP(ip netip.Addr) error {
+	ip = ip.Unmap()
+	deny := longestMatch(p.denyPrefixes, ip)
+	if deny >= 0 && deny >= longestMatch(p.allowPrefixes, ip) {
+		return &policyError{reason: fmt.Sprintf("address %s is denied", ip), dial: true}
+	}
+	return nil
+}
+
+// rateLimit returns the requests per minute allowed to host, 0 if unlimited.
+// When several patterns match, the most specific one applies.
+func (p *policy) rateLimit(host string) int {
+	host = normalizeHost(host)
+	best := ""
+	for pattern := range p.RateLimit.Hosts {
+		if matchHost(pattern, host) && (best == "" || moreSpecificPattern(pattern, best)) {
+			best = pattern
+		}
+	}
+	if best == "" {
+		return p.RateLimit.RequestsPerMinute
+	}
+	return p.RateLimit.Hosts[best]
+}
+
+// moreSpecificPattern reports whether host pattern a is more specific than b:
+// host names come before globs, globs before regular expressions, and longer
+// patterns before shorter ones of the same kind, ties being broken by name
+// so that the choice does not depend on the order of the patterns
+func moreSpecificPattern(a, b string) bool {
+	if ka, kb := hostPatternKind(a), hostPatternKind(b); ka != kb {
+		return ka < kb
+	}
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	return a < b
+}
+
+// hostPatternKind ranks host names 0, globs 1 and regular expressions 2
+func hostPatternKind(pattern string) int {
+	switch {
+	case isHostRegexp(pattern):
+		return 2
+	case strings.ContainsAny(pattern, "*?["):
+		return 1
+	}
+	return 0
+}
+
+// tokenBucket allows bursts of up to a minute's worth of requests. A bucket
+// left unused for a minute is full again, like a new one, so it is dropped.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// policyStore holds the current policy, reloading it when its file changes, and
+// the rate limiting state, which survives reloads. It is safe for concurrent use.
+type policyStore struct {
+	path    string
+	current atomic.Pointer[policy]
+
+	mu      sync.Mutex
+	modTime time.Time
+	buckets map[string]*tokenBucket
+	// pruned is when the idle buckets were last dropped
+	pruned time.Time
+
+	// now returns the current time; replaced in tests
+	now func() time.Time
+}
+
+// newPolicyStore loads the policy file at path
+func newPolicyStore(path string) (*policyStore, error) {
+	s := &policyStore{path: path, buckets: make(map[string]*tokenBucket), now: time.Now}
+	if _, err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// reload reads the policy file if it changed since the last load. On error the
+// current policy stays in effect.
+func (s *policyStore) reload() (bool, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read policy: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current.Load() != nil && info.ModTime().Equal(s.modTime) {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read policy: %w", err)
+	}
+	p, err := parsePolicy(data)
+	if err != nil {
+		return false, err
+	}
+	s.current.Store(p)
+	s.modTime = info.ModTime()
+	return true, nil
+}
+
+// watch reloads the policy every interval until ctx is done, logging the outcome
+func (s *policyStore) watch(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := s.reload()
+			if err != nil {
+				logger.Warn("policy reload failed, keeping current policy", "path", s.path, "error", err)
+			} else if reloaded {
+				logger.Info("policy reloaded", "path", s.path)
+			}
+		}
+	}
+}
+
+// checkHost returns a *policyError if the host of rawURL may not be fetched
+func (s *policyStore) checkHost(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		// Left for the fetch to report
+		return nil
+	}
+	return s.current.Load().checkHost(u.Hostname())
+}
+
+// allowIP checks ip against the CIDR rules of the current policy
+func (s *policyStore) allowIP(ip netip.Addr) error {
+	return s.current.Load().checkIP(ip)
+}
+
+// allowURL checks u against the host rules and takes a request from the rate
+// limit of its host
+func (s *policyStore) allowURL(u *url.URL) error {
+	p := s.current.Load()
+	host := normalizeHost(u.Hostname())
+	if err := p.checkHost(host); err != nil {
+		return err
+	}
+
+	limit := p.rateLimit(host)
+	if limit == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.pruned) >= time.Minute {
+		s.pruneBuckets(now)
+	}
+	b, ok := s.buckets[host]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit), last: now}
+		s.buckets[host] = b
+	}
+	b.tokens = min(float64(limit), b.tokens+now.Sub(b.last).Minutes()*float64(limit))
+	b.last = now
+	if b.tokens < 1 {
+		return &policyError{reason: fmt.Sprintf("rate limit of %d requests per minute exceeded for %s", limit, host)}
+	}
+	b.tokens--
+	return nil
+}
+
+// pruneBuckets drops the buckets unused for a minute, which are full. s.mu
+// must be held.
+func (s *policyStore) pruneBuckets(now time.Time) {
+	for host, b := range s.buckets {
+		if now.Sub(b.last) >= time.Minute {
+			delete(s.buckets, host)
+		}
+	}
+	s.pruned = now
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestParsePolicy_Invalid(t *testing.T) {
+	tests := []string{
+		`{"allow_host": ["example.com"]}`,
+		`{"deny_hosts": ["*"]}`,
+		`{"deny_hosts": ["https://example.com"]}`,
+		`{"rate_limit": {"requests_per_minute": -1}}`,
+		`{"rate_limit": {"hosts": {"example.com": -5}}}`,
+		`{"deny_cidrs": ["10.0.0.0/33"]}`,
+		`{"allow_cidrs": ["internal"]}`,
+		`{"allow_hosts": ["*.*"]}`,
+		`{"allow_hosts": ["docs[.example.com"]}`,
+		`{"allow_hosts": ["/docs(.example.com/"]}`,
+	}
+
+	for _, data := range tests {
+		if _, err := parsePolicy([]byte(data)); err == nil {
+			t.Errorf("expected error for %s", data)
+		}
+	}
+}
+
+func TestPolicy_CheckHost(t *testing.T) {
+	p, err := parsePolicy([]byte(`{
+		"allow_hosts": ["example.com", "*.example.org"],
+		"deny_hosts": ["private.example.org"]
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		host    string
+		allowed bool
+	}{
+		{host: "example.com", allowed: true},
+		{host: "EXAMPLE.com", allowed: true},
+		{host: "www.example.com", allowed: false},
+		{host: "docs.example.org", allowed: true},
+		{host: "example.org", allowed: false},
+		{host: "private.example.org", allowed: false},
+		{host: "private.example.org.", allowed: false},
+		{host: "PRIVATE.example.org..", allowed: false},
+		{host: "example.com.", allowed: true},
+		{host: "other.net", allowed: false},
+	}
+
+	for _, tt := range tests {
+		if err := p.checkHost(tt.host); (err == nil) != tt.allowed {
+			t.Errorf("checkHost(%q): expected allowed %v, got %v", tt.host, tt.allowed, err)
+		}
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		host     string
+		expected bool
+	}{
+		{pattern: "example.com", host: "example.com", expected: true},
+		{pattern: "Example.COM", host: "EXAMPLE.com", expected: true},
+		{pattern: "example.com", host: "www.example.com", expected: false},
+		{pattern: "example.com", host: "Example.com.", expected: true},
+		{pattern: "*.example.com", host: "www.example.com.", expected: true},
+		{pattern: "*.example.com", host: "a.b.example.com", expected: true},
+		{pattern: "*.example.com", host: "example.com", expected: false},
+		{pattern: "*.example.com", host: "badexample.com", expected: false},
+		{pattern: "docs.*.example.com", host: "docs.eu.example.com", expected: true},
+		{pattern: "api?.example.com", host: "api2.example.com", expected: true},
+		{pattern: "api[0-9].example.com", host: "apix.example.com", expected: false},
+		{pattern: `/docs[0-9]*\.example\.net/`, host: "Docs42.example.net", expected: true},
+		{pattern: `/docs[0-9]*\.example\.net/`, host: "docs.example.net.evil.com", expected: false},
+		{pattern: `/(a|b)\.example\.org/`, host: "c.example.org", expected: false},
+	}
+
+	for _, tt := range tests {
+		if err := checkHostPattern(tt.pattern); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if matched := matchHost(tt.pattern, tt.host); matched != tt.expected {
+			t.Errorf("matchHost(%q, %q): expected %v, got %v", tt.pattern, tt.host, tt.expected, matched)
+		}
+	}
+}
+
+func TestPolicy_CheckIP(t *testing.T) {
+	p, err := parsePolicy([]byte(`{
+		"deny_cidrs": ["10.0.0.0/8", "169.254.0.0/16", "fd00::/8", "10.1.2.3"],
+		"allow_cidrs": ["10.1.0.0/16", "169.254.0.0/16"]
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		ip      string
+		allowed bool
+	}{
+		{ip: "93.184.216.34", allowed: true},
+		{ip: "10.0.0.1", allowed: false},
+		{ip: "::ffff:10.0.0.1", allowed: false},
+		{ip: "10.1.0.1", allowed: true},
+		{ip: "10.1.2.3", allowed: false},
+		{ip: "169.254.169.254", allowed: false},
+		{ip: "fd12::1", allowed: false},
+		{ip: "2001:db8::1", allowed: true},
+	}
+
+	for _, tt := range tests {
+		if err := p.checkIP(netip.MustParseAddr(tt.ip)); (err == nil) != tt.allowed {
+			t.Errorf("checkIP(%s): expected allowed %v, got %v", tt.ip, tt.allowed, err)
+		}
+	}
+}
+
+// writePolicy writes data to path with the given modification time
+func writePolicy(t *testing.T, path, data string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("failed to set policy time: %v", err)
+	}
+}
+
+func TestPolicyStore_RateLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	writePolicy(t, path, `{"rate_limit": {"requests_per_minute": 60, "hosts": {"slow.example": 2}}}`, time.Now())
+
+	store, err := newPolicyStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	slow := &url.URL{Scheme: "https", Host: "slow.example"}
+	for i := range 2 {
+		if err := store.allowURL(slow); err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+	}
+	var policyErr *policyError
+	if err := store.allowURL(slow); !errors.As(err, &policyErr) {
+		t.Errorf("expected rate limit error, got %v", err)
+	}
+
+	// Other hosts have their own budget
+	if err := store.allowURL(&url.URL{Scheme: "https", Host: "fast.example"}); err != nil {
+		t.Errorf("unexpected error for other host: %v", err)
+	}
+
+	// Tokens refill over time
+	now = now.Add(30 * time.Second)
+	if err := store.allowURL(slow); err != nil {
+		t.Errorf("expected refilled token, got %v", err)
+	}
+}
+
+func TestPolicy_RateLimitOverlap(t *testing.T) {
+	p, err := parsePolicy([]byte(`{"rate_limit": {"requests_per_minute": 60, "hosts": {
+		"*.example.com": 1, "*.api.example.com": 3, "api.example.com": 5, "/example\\.(com|net)/": 7, "*.com": 9}}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		host     string
+		expected int
+	}{
+		{host: "api.example.com", expected: 5},
+		{host: "API.Example.com.", expected: 5},
+		{host: "v1.api.example.com", expected: 3},
+		{host: "www.example.com", expected: 1},
+		{host: "other.com", expected: 9},
+		{host: "example.com", expected: 9},
+		{host: "example.net", expected: 7},
+		{host: "example.org", expected: 60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			// The order of the patterns must not matter
+			for range 20 {
+				if got := p.rateLimit(tt.host); got != tt.expected {
+					t.Fatalf("expected %d, got %d", tt.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyStore_RateLimitBuckets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	writePolicy(t, path, `{"rate_limit": {"requests_per_minute": 1}}`, time.Now())
+
+	store, err := newPolicyStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	// Spellings of the same host share their bucket
+	if err := store.allowURL(&url.URL{Scheme: "https", Host: "example.com"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.allowURL(&url.URL{Scheme: "https", Host: "Example.com."}); err == nil {
+		t.Errorf("expected the rate limit of example.com to apply")
+	}
+	if len(store.buckets) != 1 {
+		t.Errorf("expected 1 bucket, got %d", len(store.buckets))
+	}
+
+	// Idle buckets are dropped
+	now = now.Add(time.Minute)
+	if err := store.allowURL(&url.URL{Scheme: "https", Host: "other.example"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := store.buckets["example.com"]; ok || len(store.buckets) != 1 {
+		t.Errorf("expected only the bucket of other.example, got %v", store.buckets)
+	}
+}
+
+func TestPolicyStore_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	modTime := time.Now().Add(-time.Hour)
+	writePolicy(t, path, `{"deny_hosts": ["a.example"]}`, modTime)
+
+	store, err := newPolicyStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.checkHost("https://a.example/") == nil {
+		t.Fatal("expected a.example to be denied")
+	}
+
+	// Unchanged file is not reloaded
+	if reloaded, err := store.reload(); reloaded || err != nil {
+		t.Errorf("expected no reload, got %v, %v", reloaded, err)
+	}
+
+	writePolicy(t, path, `{"deny_hosts": ["b.example"]}`, modTime.Add(time.Minute))
+	if reloaded, err := store.reload(); !reloaded || err != nil {
+		t.Fatalf("expected reload, got %v, %v", reloaded, err)
+	}
+	if store.checkHost("https://a.example/") != nil || store.checkHost("https://b.example/") == nil {
+		t.Error("expected reloaded policy to deny b.example only")
+	}
+
+	// An invalid file keeps the current policy
+	writePolicy(t, path, `{"deny_hosts": [`, modTime.Add(2*time.Minute))
+	if _, err := store.reload(); err == nil {
+		t.Error("expected error for invalid policy")
+	}
+	if store.checkHost("https://b.example/") == nil {
+		t.Error("expected previous policy to stay in effect")
+	}
+}
+
+func TestWebfetchTool_Policy(t *testing.T) {
+	denied := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>secret</p>"))
+	}))
+	defer denied.Close()
+	deniedURL, _ := url.Parse(denied.URL)
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, denied.URL, http.StatusFound)
+	}))
+	defer site.Close()
+	// Both servers listen on 127.0.0.1, so tell them apart with localhost
+	siteURL := strings.Replace(site.URL, "127.0.0.1", "localhost", 1)
+
+	path := filepath.Join(t.TempDir(), "policy.json")
+	writePolicy(t, path, `{"deny_hosts": ["`+deniedURL.Hostname()+`"]}`, time.Now())
+	store, err := newPolicyStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var audit bytes.Buffer
+	session := connectTestClient(t, setupMCPServer(config{policy: store, auditLogOutput: &audit}))
+
+	for _, target := range []string{denied.URL, siteURL} {
+		res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+			Name:      "webfetch",
+			Arguments: map[string]any{"url": target},
+		})
+		if err != nil {
+			t.Fatalf("CallTool failed: %v", err)
+		}
+		text := res.Content[0].(*mcp.TextContent).Text
+		if !res.IsError || !strings.Contains(text, "blocked by policy") {
+			t.Errorf("expected %s to be blocked, got %q", target, text)
+		}
+	}
+
+	if n := strings.Count(audit.String(), `"decision":"blocked"`); n != 2 {
+		t.Errorf("expected 2 blocked audit records, got %d in %s", n, audit.String())
+	}
+	if strings.Contains(audit.String(), `"decision":"allowed"`) {
+		t.Errorf("expected no allowed audit record, got %s", audit.String())
+	}
+}
+
+func TestWebfetchTool_PolicyCIDR(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>internal</p>"))
+	}))
+	defer site.Close()
+	// localhost is not denied by host, only by its address once resolved
+	siteURL := strings.Replace(site.URL, "127.0.0.1", "localhost", 1)
+
+	path := filepath.Join(t.TempDir(), "policy.json")
+	writePolicy(t, path, `{"deny_cidrs": ["127.0.0.0/8", "::1/128"]}`, time.Now())
+	store, err := newPolicyStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var audit bytes.Buffer
+	session := connectTestClient(t, setupMCPServer(config{policy: store, auditLogOutput: &audit}))
+
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch",
+		Arguments: map[string]any{"url": siteURL},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	text := res.Content[0].(*mcp.TextContent).Text
+	if !res.IsError || !strings.Contains(text, "blocked by policy: address") {
+		t.Errorf("expected %s to be blocked, got %q", siteURL, text)
+	}
+	if !strings.Contains(audit.String(), `"decision":"blocked"`) || !strings.Contains(audit.String(), siteURL) {
+		t.Errorf("expected a blocked audit record for %s, got %s", siteURL, audit.String())
+	}
+	if strings.Contains(audit.String(), `"decision":"allowed"`) {
+		t.Errorf("expected no allowed audit record, got %s", audit.String())
+	}
+}
+
+func TestWebfetchTool_HostPatterns(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/elsewhere" {
+			http.Redirect(w, r, strings.Replace("http://"+r.Host+"/", "localhost", "127.0.0.1", 1), http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>fetched</p>"))
+	}))
+	defer site.Close()
+	// localhost and 127.0.0.1 are two hosts of the same server
+	siteURL := strings.Replace(site.URL, "127.0.0.1", "localhost", 1)
+
+	tests := []struct {
+		name     string
+		cfg      config
+		url      string
+		expected string
+		isError  bool
+	}{
+		{name: "allowed", cfg: config{allowHosts: []string{"localhost"}}, url: siteURL, expected: "fetched"},
+		{name: "not allowed", cfg: config{allowHosts: []string{"*.example.com"}}, url: siteURL, expected: "blocked by policy: host localhost is not allowed", isError: true},
+		{name: "denied", cfg: config{denyHosts: []string{"/local.*/"}}, url: siteURL, expected: "blocked by policy: host localhost is denied", isError: true},
+		{name: "redirect denied", cfg: config{denyHosts: []string{"127.0.0.*"}}, url: siteURL + "/elsewhere", expected: "blocked by policy: host 127.0.0.1 is denied", isError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := connectTestClient(t, setupMCPServer(tt.cfg))
+			res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+				Name:      "webfetch",
+				Arguments: map[string]any{"url": tt.url},
+			})
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+			text := res.Content[0].(*mcp.TextContent).Text
+			if res.IsError != tt.isError || !strings.Contains(text, tt.expected) {
+				t.Errorf("expected %q (error %t), got %q (error %t)", tt.expected, tt.isError, text, res.IsError)
+			}
+		})
+	}
+}
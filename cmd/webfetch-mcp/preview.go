@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Limits of the webfetch_preview tool
+const (
+	maxPreviewURLs        = 20
+	maxConcurrentPreviews = 4
+)
+
+type previewToolInput struct {
+	URLs    []string `json:"urls" jsonschema:"The URLs of the pages to preview, at most 20 (required)"`
+	Timeout string   `json:"timeout,omitempty" jsonschema:"Timeout of each request, capped by the server (default: 5s)"`
+}
+
+// previewEntry is the preview of one URL, or the error previewing it
+type previewEntry struct {
+	webfetch.PagePreview
+	Error      string              `json:"error,omitempty"`
+	ErrorClass webfetch.ErrorClass `json:"error_class,omitempty"`
+}
+
+type previewToolOutput struct {
+	Previews []previewEntry `json:"previews,omitempty"`
+}
+
+// addPreviewTool registers the webfetch_preview tool on the server
+func (t *tools) addPreviewTool() {
+	mcp.AddTool(t.server, &mcp.Tool{
+		Name: t.cfg.toolName("webfetch_preview"),
+		Description: "Previews pages from the start of their HTML: title, description, image, site name, size and " +
+			"estimated length in tokens. Use it to triage a list of links before fetching the relevant ones.",
+	}, func(
+		ctx context.Context,
+		req *mcp.CallToolRequest,
+		input previewToolInput,
+	) (*mcp.CallToolResult, *previewToolOutput, error) {
+		if len(input.URLs) == 0 {
+			return toolError("urls is required"), nil, nil
+		}
+		if len(input.URLs) > maxPreviewURLs {
+			return toolError("too many urls: at most 20 can be previewed at once"), nil, nil
+		}
+		timeout, err := t.resolveTimeout(input.Timeout)
+		if err != nil {
+			return toolError(err.Error()), nil, nil
+		}
+
+		output := &previewToolOutput{Previews: make([]previewEntry, len(input.URLs))}
+		sem := make(chan struct{}, maxConcurrentPreviews)
+		var wg sync.WaitGroup
+		for i, u := range input.URLs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				output.Previews[i] = t.preview(ctx, req, u, timeout)
+			}()
+		}
+		wg.Wait()
+		return nil, output, nil
+	})
+}
+
+// preview previews the page at u, reporting failures in the entry
+func (t *tools) preview(ctx context.Context, req *mcp.CallToolRequest, u string, timeout time.Duration) previewEntry {
+	failed := func(text string, class webfetch.ErrorClass) previewEntry {
+		return previewEntry{PagePreview: webfetch.PagePreview{URL: u, Size: -1}, Error: text, ErrorClass: class}
+	}
+	if result := t.checkPolicy(ctx, req, "webfetch_preview", u); result != nil {
+		return failed(result.Content[0].(*mcp.TextContent).Text, webfetch.ErrorPermanent)
+	}
+	preview, err := webfetch.Preview(ctx, u, t.fetchOptions(ctx, req, "webfetch_preview", timeout))
+	if err != nil {
+		return failed(err.Error(), webfetch.ClassifyError(err))
+	}
+	if t.pii != nil {
+		return previewEntry{PagePreview: t.pii.scrubPreview(*preview)}
+	}
+	return previewEntry{PagePreview: *preview}
+}
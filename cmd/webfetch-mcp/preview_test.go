@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestPreviewTool(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<title>Page ` + r.URL.Path + `</title><meta name="description" content="About it"><p>Body</p>`))
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{}))
+	urls := []string{site.URL + "/a", site.URL + "/missing", site.URL + "/b"}
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch_preview",
+		Arguments: map[string]any{"urls": urls},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected error: %+v", res.Content)
+	}
+
+	var output previewToolOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	json.Unmarshal(data, &output)
+	if len(output.Previews) != 3 {
+		t.Fatalf("expected 3 previews, got %+v", output.Previews)
+	}
+	for i, expected := range []string{"Page /a", "", "Page /b"} {
+		p := output.Previews[i]
+		if p.URL != urls[i] || p.Title != expected {
+			t.Errorf("expected preview of %s titled %q, got %+v", urls[i], expected, p)
+		}
+	}
+	if p := output.Previews[1]; !strings.Contains(p.Error, "404") || p.Size != -1 {
+		t.Errorf("expected a 404 error, got %+v", p)
+	}
+	if p := output.Previews[0]; p.Description != "About it" || p.Size <= 0 {
+		t.Errorf("expected description and size, got %+v", p)
+	}
+}
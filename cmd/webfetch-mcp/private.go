@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// privatePrefixes are the ranges of the addresses of the host itself and of
+// private networks, refused unless -allow-private-addresses is set: the
+// unspecified addresses, which reach the host itself, loopback, RFC 1918
+// networks, link-local addresses, including cloud metadata endpoints such as
+// 169.254.169.254, the shared address space of carrier-grade NAT, IPv6 unique
+// local addresses and NAT64 addresses, which may translate to any of them
+var privatePrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// privateAddresses refuses connections to private addresses, except those in
+// the allowed ranges
+type privateAddresses struct {
+	allowed []netip.Prefix
+}
+
+// allowIP returns a *policyError if ip is private and not allowed
+func (p *privateAddresses) allowIP(ip netip.Addr) error {
+	ip = ip.Unmap()
+	if longestMatch(p.allowed, ip) >= 0 {
+		return nil
+	}
+	if longestMatch(privatePrefixes, ip) >= 0 {
+		return &policyError{reason: fmt.Sprintf("address %s is private", ip), dial: true}
+	}
+	return nil
+}
+
+// parseAllowedCIDRs parses the comma-separated ranges of -allow-private-cidrs
+func parseAllowedCIDRs(s string) ([]netip.Prefix, error) {
+	var cidrs []string
+	for _, cidr := range strings.Split(s, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr != "" {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	prefixes, err := parsePrefixes(cidrs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -allow-private-cidrs: %w", err)
+	}
+	return prefixes, nil
+}
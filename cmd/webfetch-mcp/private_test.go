@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestPrivateAddresses_AllowIP(t *testing.T) {
+	allowed, err := parseAllowedCIDRs("10.1.2.0/24, fd12:3456::/32")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	private := &privateAddresses{allowed: allowed}
+
+	tests := []struct {
+		ip      string
+		blocked bool
+	}{
+		{ip: "127.0.0.1", blocked: true},
+		{ip: "0.0.0.0", blocked: true},
+		{ip: "10.0.0.1", blocked: true},
+		{ip: "172.20.0.1", blocked: true},
+		{ip: "192.168.1.1", blocked: true},
+		{ip: "169.254.169.254", blocked: true},
+		{ip: "100.100.100.200", blocked: true},
+		{ip: "::1", blocked: true},
+		{ip: "::ffff:127.0.0.1", blocked: true},
+		{ip: "fe80::1", blocked: true},
+		{ip: "fd00::1", blocked: true},
+		{ip: "64:ff9b::a9fe:a9fe", blocked: true},
+		{ip: "100.128.0.1", blocked: false},
+		{ip: "10.1.2.3", blocked: false},
+		{ip: "fd12:3456::1", blocked: false},
+		{ip: "172.32.0.1", blocked: false},
+		{ip: "93.184.216.34", blocked: false},
+		{ip: "2606:2800:220:1::1", blocked: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			err := private.allowIP(netip.MustParseAddr(tt.ip))
+			if (err != nil) != tt.blocked {
+				t.Errorf("expected blocked %t, got %v", tt.blocked, err)
+			}
+		})
+	}
+
+	if _, err := parseAllowedCIDRs("10.1.2.0/24,intranet"); err == nil {
+		t.Error("expected an error for an invalid range")
+	}
+}
+
+func TestWebfetchTool_PrivateAddresses(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>internal</p>"))
+	}))
+	defer site.Close()
+	// The host name is only refused once resolved to a loopback address
+	siteURL := strings.Replace(site.URL, "127.0.0.1", "localhost", 1)
+
+	tests := []struct {
+		name     string
+		cfg      config
+		expected string
+		isError  bool
+	}{
+		{
+			name:     "denied",
+			cfg:      config{denyPrivateAddresses: true},
+			expected: "blocked by policy: address",
+			isError:  true,
+		},
+		{
+			name:     "allowed range",
+			cfg:      config{denyPrivateAddresses: true, allowedPrivateCIDRs: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}},
+			expected: "internal",
+		},
+		{
+			name:     "allowed",
+			expected: "internal",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := connectTestClient(t, setupMCPServer(tt.cfg))
+			res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+				Name:      "webfetch",
+				Arguments: map[string]any{"url": siteURL},
+			})
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+			text := res.Content[0].(*mcp.TextContent).Text
+			if res.IsError != tt.isError || !strings.Contains(text, tt.expected) {
+				t.Errorf("expected %q (error %t), got %q (error %t)", tt.expected, tt.isError, text, res.IsError)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultQuotaWindow is the period after which session quotas reset
+const defaultQuotaWindow = time.Hour
+
+// quotaMetaKey is the _meta key of tool results describing an exceeded quota
+const quotaMetaKey = "quota_exceeded"
+
+// quotaError reports that a session used up one of its quotas
+type quotaError struct {
+	// Quota is the exhausted quota: fetches, bytes or renders
+	Quota    string    `json:"quota"`
+	Limit    int64     `json:"limit"`
+	ResetsAt time.Time `json:"resets_at"`
+	// RetryAfterSeconds is the time left until ResetsAt
+	RetryAfterSeconds int64 `json:"retry_after_seconds"`
+}
+
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("quota exceeded: session limit of %d %s reached, resets at %s (in %ds)",
+		e.Limit, e.Quota, e.ResetsAt.Format(time.RFC3339), e.RetryAfterSeconds)
+}
+
+// sessionUsage is the usage of a session in its current window
+type sessionUsage struct {
+	start   time.Time
+	fetches int64
+	bytes   int64
+	renders int64
+}
+
+// quotas limits the outbound requests, downloaded bytes and rendered pages of
+// each session over a fixed window starting at its first request. It is safe
+// for concurrent use.
+type quotas struct {
+	maxFetches int64
+	maxBytes   int64
+	maxRenders int64
+	window     time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*sessionUsage
+
+	// now returns the current time; replaced in tests
+	now func() time.Time
+}
+
+func newQuotas(maxFetches, maxBytes, maxRenders int64, window time.Duration) *quotas {
+	if window <= 0 {
+		window = defaultQuotaWindow
+	}
+	return &quotas{
+		maxFetches: maxFetches,
+		maxBytes:   maxBytes,
+		maxRenders: maxRenders,
+		window:     window,
+		sessions:   make(map[string]*sessionUsage),
+		now:        time.Now,
+	}
+}
+
+// usage returns the usage of session in the current window, starting a new
+// window if the previous one ended. Callers must hold q.mu.
+func (q *quotas) usage(session string) *sessionUsage {
+	now := q.now()
+	u, ok := q.sessions[session]
+	if !ok || now.Sub(u.start) >= q.window {
+		// Drop the other ended windows to bound memory
+		for id, other := range q.sessions {
+			if now.Sub(other.start) >= q.window {
+				delete(q.sessions, id)
+			}
+		}
+		u = &sessionUsage{start: now}
+		q.sessions[session] = u
+	}
+	return u
+}
+
+// take counts an outbound request of session, or returns a *quotaError if a
+// quota is used up
+func (q *quotas) take(session string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u := q.usage(session)
+	switch {
+	case q.maxFetches > 0 && u.fetches >= q.maxFetches:
+		return q.exceeded(u, "fetches", q.maxFetches)
+	case q.maxBytes > 0 && u.bytes >= q.maxBytes:
+		return q.exceeded(u, "bytes", q.maxBytes)
+	}
+	u.fetches++
+	return nil
+}
+
+// takeRender counts a page rendered in the browser for session, or returns a
+// *quotaError if its render quota is used up
+func (q *quotas) takeRender(session string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u := q.usage(session)
+	if q.maxRenders > 0 && u.renders >= q.maxRenders {
+		return q.exceeded(u, "renders", q.maxRenders)
+	}
+	u.renders++
+	return nil
+}
+
+// addBytes counts bytes downloaded by session
+func (q *quotas) addBytes(session string, n int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.usage(session).bytes += n
+}
+
+// quotaUsage is the usage of a session in its current window, as saved with
+// the session state
+type quotaUsage struct {
+	Start   time.Time `json:"start"`
+	Fetches int64     `json:"fetches"`
+	Bytes   int64     `json:"bytes"`
+	Renders int64     `json:"renders,omitempty"`
+}
+
+// snapshot returns the usage of session in its current window, or nil if it
+// has none
+func (q *quotas) snapshot(session string) *quotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u, ok := q.sessions[session]
+	if !ok || q.now().Sub(u.start) >= q.window {
+		return nil
+	}
+	return &quotaUsage{Start: u.start, Fetches: u.fetches, Bytes: u.bytes, Renders: u.renders}
+}
+
+// restore sets the usage of session, e.g. when resuming the session after a
+// restart. Usage of an ended window is ignored.
+func (q *quotas) restore(session string, usage quotaUsage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.now().Sub(usage.Start) < q.window {
+		q.sessions[session] = &sessionUsage{start: usage.Start, fetches: usage.Fetches, bytes: usage.Bytes, renders: usage.Renders}
+	}
+}
+
+func (q *quotas) exceeded(u *sessionUsage, quota string, limit int64) *quotaError {
+	resetsAt := u.start.Add(q.window)
+	return &quotaError{
+		Quota:             quota,
+		Limit:             limit,
+		ResetsAt:          resetsAt.UTC(),
+		RetryAfterSeconds: int64(resetsAt.Sub(q.now()).Seconds() + 0.5),
+	}
+}
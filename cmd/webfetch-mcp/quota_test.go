@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestQuotas(t *testing.T) {
+	q := newQuotas(2, 1000, 0, time.Hour)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+
+	for i := range 2 {
+		if err := q.take("a"); err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+	}
+
+	now = now.Add(15 * time.Minute)
+	var quotaErr *quotaError
+	if err := q.take("a"); !errors.As(err, &quotaErr) {
+		t.Fatalf("expected quota error, got %v", err)
+	}
+	if quotaErr.Quota != "fetches" || quotaErr.RetryAfterSeconds != 45*60 ||
+		!quotaErr.ResetsAt.Equal(time.Date(2025, 1, 1, 13, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected quota error: %+v", quotaErr)
+	}
+
+	// Sessions have separate quotas
+	if err := q.take("b"); err != nil {
+		t.Errorf("unexpected error for other session: %v", err)
+	}
+	q.addBytes("b", 1000)
+	if err := q.take("b"); !errors.As(err, &quotaErr) || quotaErr.Quota != "bytes" {
+		t.Errorf("expected bytes quota error, got %v", err)
+	}
+
+	// Quotas reset after the window
+	now = now.Add(45 * time.Minute)
+	if err := q.take("a"); err != nil {
+		t.Errorf("expected quota to reset, got %v", err)
+	}
+}
+
+func TestWebfetchTool_Quota(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Hello</p>"))
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{sessionMaxFetches: 1}))
+
+	var res *mcp.CallToolResult
+	for _, path := range []string{"/a", "/b"} {
+		var err error
+		res, err = session.CallTool(context.Background(), &mcp.CallToolParams{
+			Name:      "webfetch",
+			Arguments: map[string]any{"url": site.URL + path},
+		})
+		if err != nil {
+			t.Fatalf("CallTool failed: %v", err)
+		}
+	}
+
+	if text := res.Content[0].(*mcp.TextContent).Text; !res.IsError || !strings.Contains(text, "quota exceeded") {
+		t.Fatalf("expected quota exceeded error, got %q", text)
+	}
+	quota, ok := res.Meta[quotaMetaKey].(map[string]any)
+	if !ok || quota["quota"] != "fetches" || quota["retry_after_seconds"] == nil {
+		t.Errorf("expected quota details in result meta, got %v", res.Meta)
+	}
+}
+
+func TestWebfetchTool_RenderQuota(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Hello</p>"))
+	}))
+	defer site.Close()
+
+	// The browser fails to start, but the render is still counted
+	session := connectTestClient(t, setupMCPServer(config{renderJS: true, chromePath: "/nonexistent/chrome", sessionMaxRenders: 1}))
+	call := func(renderJS bool) *mcp.CallToolResult {
+		t.Helper()
+		res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+			Name:      "webfetch",
+			Arguments: map[string]any{"url": site.URL, "render_js": renderJS},
+		})
+		if err != nil {
+			t.Fatalf("CallTool failed: %v", err)
+		}
+		return res
+	}
+
+	if res := call(true); !res.IsError || strings.Contains(res.Content[0].(*mcp.TextContent).Text, "quota exceeded") {
+		t.Fatalf("expected the render to fail on the browser, got %+v", res.Content)
+	}
+	res := call(true)
+	if text := res.Content[0].(*mcp.TextContent).Text; !res.IsError || !strings.Contains(text, "quota exceeded: session limit of 1 renders") {
+		t.Fatalf("expected render quota exceeded error, got %q", text)
+	}
+	if quota, ok := res.Meta[quotaMetaKey].(map[string]any); !ok || quota["quota"] != "renders" {
+		t.Errorf("expected render quota details in result meta, got %v", res.Meta)
+	}
+	// Fetches without rendering are not limited
+	if res := call(false); res.IsError {
+		t.Errorf("unexpected error: %+v", res.Content)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	// defaultRenderTimeout bounds the rendering of a page in the browser
+	defaultRenderTimeout = 15 * time.Second
+	// maxRenderTabs is the maximum number of pages rendered at the same time
+	maxRenderTabs = 4
+	// renderSettleInterval is how often the text of a page being rendered is
+	// measured, the page being rendered once its length stops changing
+	renderSettleInterval = 300 * time.Millisecond
+)
+
+// chromeRenderer renders pages in the tabs of a headless Chrome, started on
+// the first render and restarted if it exits
+type chromeRenderer struct {
+	execPath  string
+	userAgent string
+	timeout   time.Duration
+	tabs      chan struct{}
+	// proxy checks the requests of the browser, unless nil
+	proxy    *renderProxy
+	proxyURL string
+
+	mu      sync.Mutex
+	browser context.Context
+	cancel  context.CancelFunc
+}
+
+// newChromeRenderer returns a renderer running the Chrome executable at
+// execPath, or found in the usual locations when empty, with userAgent, if
+// set, and bounding each render to timeout when positive. The browser sends
+// all its requests through proxy, if not nil.
+func newChromeRenderer(execPath, userAgent string, timeout time.Duration, proxy *renderProxy) *chromeRenderer {
+	return &chromeRenderer{
+		execPath:  execPath,
+		userAgent: userAgent,
+		timeout:   timeout,
+		tabs:      make(chan struct{}, maxRenderTabs),
+		proxy:     proxy,
+	}
+}
+
+// render loads rawURL in a new tab and returns the HTML of the document once
+// its text settled, including the content of its open shadow roots
+func (r *chromeRenderer) render(ctx context.Context, rawURL string) (string, error) {
+	select {
+	case r.tabs <- struct{}{}:
+		defer func() { <-r.tabs }()
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	browser, err := r.browserContext()
+	if err != nil {
+		return "", err
+	}
+
+	// The tab is opened in a browser context of its own, so that renders
+	// share no cookies, storage or cache, both closed when ctx is done
+	tab, closeTab := chromedp.NewContext(browser, chromedp.WithNewBrowserContext(r.browserContextOptions))
+	defer closeTab()
+	defer context.AfterFunc(ctx, closeTab)()
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		tab, cancel = context.WithTimeout(tab, r.timeout)
+		defer cancel()
+	}
+
+	var html string
+	err = chromedp.Run(tab,
+		chromedp.Navigate(rawURL),
+		waitRendered(),
+		chromedp.Evaluate(serializeFlatTree, &html),
+	)
+	switch {
+	case ctx.Err() != nil:
+		return "", ctx.Err()
+	case errors.Is(err, context.DeadlineExceeded):
+		return "", fmt.Errorf("page not rendered within %v: %w", r.timeout, err)
+	case err != nil:
+		return "", err
+	}
+	return html, nil
+}
+
+// browserContext returns the context of the browser, starting it if it is
+// not running
+func (r *chromeRenderer) browserContext() (context.Context, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.browser != nil && r.browser.Err() == nil {
+		return r.browser, nil
+	}
+	if r.cancel != nil {
+		// Removes the profile of the browser that exited
+		r.cancel()
+	}
+
+	opts := chromedp.DefaultExecAllocatorOptions[:]
+	if r.execPath != "" {
+		opts = append(opts, chromedp.ExecPath(r.execPath))
+	}
+	if r.userAgent != "" {
+		opts = append(opts, chromedp.UserAgent(r.userAgent))
+	}
+	if r.proxy != nil {
+		if r.proxyURL == "" {
+			// The proxy outlives the browsers
+			proxyURL, err := r.proxy.start(context.Background())
+			if err != nil {
+				return nil, fmt.Errorf("failed to start the rendering proxy: %w", err)
+			}
+			r.proxyURL = proxyURL
+		}
+		// Loopback addresses are proxied too, and WebRTC may not send UDP
+		// packets around the proxy
+		opts = append(opts,
+			chromedp.ProxyServer(r.proxyURL),
+			chromedp.Flag("proxy-bypass-list", "<-loopback>"),
+			chromedp.Flag("force-webrtc-ip-handling-policy", "disable_non_proxied_udp"),
+		)
+	}
+	allocator, cancelAllocator := chromedp.NewExecAllocator(context.Background(), opts...)
+	browser, cancelBrowser := chromedp.NewContext(allocator)
+	cancel := func() {
+		cancelBrowser()
+		cancelAllocator()
+	}
+	// Running no action starts the browser
+	if err := chromedp.Run(browser); err != nil {
+		cancel()
+		r.browser, r.cancel = nil, nil
+		return nil, fmt.Errorf("failed to start Chrome: %w", err)
+	}
+	r.browser, r.cancel = browser, cancel
+	return browser, nil
+}
+
+// browserContextOptions sets up the browser context of a render, with the
+// proxy of the browser, if any
+func (r *chromeRenderer) browserContextOptions(params *target.CreateBrowserContextParams) *target.CreateBrowserContextParams {
+	if r.proxy == nil {
+		return params
+	}
+	return params.WithProxyServer(r.proxyURL).WithProxyBypassList("<-loopback>")
+}
+
+// serializeFlatTree is the script returning the HTML of a rendered document
+// as displayed: the content of open shadow roots, which the outer HTML of
+// their host leaves out, is serialized in place of the children of the host,
+// with the children assigned to its slots in place of the slots, as for the
+// web components of frameworks such as Lit
+const serializeFlatTree = `(() => {
+	const voids = new Set(["area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "source", "track", "wbr"]);
+	const raw = new Set(["script", "style", "noscript", "textarea", "title"]);
+	const escape = (text) => text.replace(/&/g, "&amp;").replace(/</g, "&lt;").replace(/>/g, "&gt;");
+	const children = (node) => {
+		if (node.shadowRoot) return node.shadowRoot.childNodes;
+		if (node.localName === "template") return node.content.childNodes;
+		return node.childNodes;
+	};
+	const serialize = (node) => {
+		if (node.nodeType === Node.TEXT_NODE) {
+			return node.parentNode && raw.has(node.parentNode.localName) ? node.data : escape(node.data);
+		}
+		if (node.nodeType !== Node.ELEMENT_NODE) return "";
+		if (node.localName === "slot") {
+			const assigned = node.assignedNodes();
+			return Array.from(assigned.length ? assigned : node.childNodes, serialize).join("");
+		}
+		let html = "<" + node.localName;
+		for (const attr of node.attributes) {
+			html += " " + attr.name + '="' + attr.value.replace(/&/g, "&amp;").replace(/"/g, "&quot;") + '"';
+		}
+		html += ">";
+		if (voids.has(node.localName)) return html;
+		return html + Array.from(children(node), serialize).join("") + "</" + node.localName + ">";
+	};
+	return serialize(document.documentElement);
+})()`
+
+// waitRendered waits until the page is loaded and the length of its text is
+// the same on two measures in a row, so that the content built by scripts
+// after the load is included
+func waitRendered() chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		last := -2
+		for {
+			var length int
+			err := chromedp.Evaluate(`document.readyState === "complete" && document.body ? document.body.innerText.length : -1`, &length).Do(ctx)
+			if err != nil {
+				return err
+			}
+			if length >= 0 && length == last {
+				return nil
+			}
+			last = length
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(renderSettleInterval):
+			}
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// hasChrome reports whether a Chrome executable is found in PATH
+func hasChrome() bool {
+	for _, name := range []string{"google-chrome", "chromium", "chromium-browser", "headless-shell"} {
+		if _, err := exec.LookPath(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWebfetchTool_RenderJS(t *testing.T) {
+	// The content of the page is built by its script
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><div id="app"></div><script>
+setTimeout(function () { document.getElementById("app").innerHTML = "<h1>Hello world</h1>"; }, 100);
+</script></body></html>`))
+	}))
+	defer site.Close()
+
+	tests := []struct {
+		name     string
+		cfg      config
+		chrome   bool
+		expected string
+		isError  bool
+	}{
+		{
+			name:     "rendered",
+			cfg:      config{renderJS: true, renderTimeout: 10 * time.Second},
+			chrome:   true,
+			expected: "# Hello world",
+		},
+		{
+			name:     "not enabled",
+			expected: "JavaScript rendering is not enabled on this server",
+			isError:  true,
+		},
+		{
+			name:     "offline",
+			cfg:      config{renderJS: true, offline: true},
+			expected: "JavaScript rendering is not enabled on this server",
+			isError:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.chrome && !hasChrome() {
+				t.Skip("Chrome not found")
+			}
+			session := connectTestClient(t, setupMCPServer(tt.cfg))
+			res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+				Name:      "webfetch",
+				Arguments: map[string]any{"url": site.URL, "render_js": true, "timeout": "15s"},
+			})
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+			text := res.Content[0].(*mcp.TextContent).Text
+			if res.IsError != tt.isError || text != tt.expected {
+				t.Errorf("expected %q (error %t), got %q (error %t)", tt.expected, tt.isError, text, res.IsError)
+			}
+		})
+	}
+}
+
+func TestWebfetchTool_RenderJSIsolation(t *testing.T) {
+	if !hasChrome() {
+		t.Skip("Chrome not found")
+	}
+	// The page remembers visits in a cookie and in local storage
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><div id="app"></div><script>
+var seen = document.cookie.indexOf("visited=1") >= 0 || localStorage.getItem("visited") === "1";
+document.cookie = "visited=1; max-age=3600";
+localStorage.setItem("visited", "1");
+document.getElementById("app").innerHTML = "<h1>" + (seen ? "Returning" : "First visit") + "</h1>";
+</script></body></html>`))
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{renderJS: true, renderTimeout: 10 * time.Second}))
+	for i := range 2 {
+		res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+			Name:      "webfetch",
+			Arguments: map[string]any{"url": site.URL, "render_js": true, "timeout": "15s"},
+		})
+		if err != nil {
+			t.Fatalf("CallTool failed: %v", err)
+		}
+		if text := res.Content[0].(*mcp.TextContent).Text; text != "# First visit" {
+			t.Errorf("render %d: expected no state left by other renders, got %q", i+1, text)
+		}
+	}
+}
+
+func TestWebfetchTool_RenderJSShadowDOM(t *testing.T) {
+	if !hasChrome() {
+		t.Skip("Chrome not found")
+	}
+	// A Lit-style component rendering its template in an open shadow root,
+	// with the light DOM children of the host in its slot
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><docs-card><p>Slotted text</p></docs-card><script>
+customElements.define("docs-card", class extends HTMLElement {
+	connectedCallback() {
+		const root = this.shadowRoot || this.attachShadow({mode: "open"});
+		root.innerHTML = "<style>h2 { color: red; }</style><h2>Card title</h2><slot></slot><p>Card footer</p>";
+	}
+});
+</script></body></html>`))
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{renderJS: true, renderTimeout: 10 * time.Second}))
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch",
+		Arguments: map[string]any{"url": site.URL, "render_js": true, "timeout": "15s"},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	expected := "## Card title\n\nSlotted text\n\nCard footer"
+	if text := res.Content[0].(*mcp.TextContent).Text; text != expected {
+		t.Errorf("expected the shadow DOM content %q, got %q", expected, text)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// hopHeaders are the headers of a proxied request or response that only
+// concern the connection to the proxy
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// renderProxy is the HTTP proxy of the rendering browser. It applies the
+// checks of the fetches to every request of the rendered pages, including
+// subresources, script requests and navigations: the URLs are checked with
+// allowURL before connecting and the addresses connected to with allowIP, so
+// that a host resolving to another address for the browser is refused too.
+type renderProxy struct {
+	allowURL  func(u *url.URL) error
+	dialer    *net.Dialer
+	transport *http.Transport
+}
+
+// newRenderProxy returns a proxy applying allowURL and allowIP, each nil when
+// not checked
+func newRenderProxy(allowURL func(u *url.URL) error, allowIP func(ip netip.Addr) error) *renderProxy {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if allowIP != nil {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			return allowIP(ip.Unmap())
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &renderProxy{allowURL: allowURL, dialer: dialer, transport: transport}
+}
+
+// start serves the proxy on a loopback port, until ctx is done, and returns
+// its URL
+func (p *renderProxy) start(ctx context.Context) (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	server := &http.Server{Handler: p, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	context.AfterFunc(ctx, func() { server.Close() })
+	return "http://" + listener.Addr().String(), nil
+}
+
+func (p *renderProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "not a proxy request", http.StatusBadRequest)
+		return
+	}
+	if p.allowURL != nil {
+		if err := p.allowURL(r.URL); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	for _, name := range hopHeaders {
+		out.Header.Del(name)
+	}
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		proxyError(w, err)
+		return
+	}
+	defer resp.Body.Close()
+	for _, name := range hopHeaders {
+		resp.Header.Del(name)
+	}
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// tunnel connects the browser to the host of a CONNECT request, used for
+// HTTPS and secure WebSocket requests
+func (p *renderProxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	if p.allowURL != nil {
+		if err := p.allowURL(&url.URL{Scheme: "https", Host: r.Host}); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	upstream, err := p.dialer.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		proxyError(w, err)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "tunnel not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+
+	done := make(chan struct{}, 2)
+	go func() {
+		// Bytes the browser sent after the request are buffered
+		io.Copy(upstream, buffered)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+	conn.Close()
+	upstream.Close()
+}
+
+// proxyError reports the failure of a proxied request, refused addresses
+// being forbidden
+func proxyError(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+	var policyErr *policyError
+	if errors.As(err, &policyErr) {
+		status = http.StatusForbidden
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderProxy(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer site.Close()
+	tlsSite := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	defer tlsSite.Close()
+
+	private := &privateAddresses{}
+	denyHost := func(u *url.URL) error {
+		if u.Hostname() == "denied.example" {
+			return &policyError{reason: "host denied.example is denied"}
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name     string
+		allowIP  func(netip.Addr) error
+		url      string
+		tls      bool
+		expected string
+		status   int
+	}{
+		{name: "allowed", url: site.URL, expected: "internal", status: http.StatusOK},
+		{name: "allowed tunnel", url: tlsSite.URL, tls: true, expected: "secure", status: http.StatusOK},
+		{name: "private address", allowIP: private.allowIP, url: site.URL, expected: "is private", status: http.StatusForbidden},
+		{name: "private address tunnel", allowIP: private.allowIP, url: tlsSite.URL, tls: true, expected: "is private"},
+		{name: "denied host", url: "http://denied.example/", expected: "host denied.example is denied", status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			proxyURL, err := newRenderProxy(denyHost, tt.allowIP).start(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			transport := tlsSite.Client().Transport.(*http.Transport).Clone()
+			transport.Proxy = func(*http.Request) (*url.URL, error) { return url.Parse(proxyURL) }
+			client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+
+			resp, err := client.Get(tt.url)
+			if tt.tls && tt.status == 0 {
+				// Refused tunnels fail the request
+				if err == nil || !strings.Contains(err.Error(), "Forbidden") {
+					t.Errorf("expected a refused tunnel, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status || !strings.Contains(string(body), tt.expected) {
+				t.Errorf("expected %d %q, got %d %q", tt.status, tt.expected, resp.StatusCode, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// requestIDHeader carries the request ID, both from HTTP clients and to fetched servers
+const requestIDHeader = "X-Request-Id"
+
+// requestIDMetaKey is the _meta key of tool results holding the request ID
+const requestIDMetaKey = "request_id"
+
+// maxRequestIDLength bounds request IDs accepted from clients
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// requestID returns the ID of the tool call that ctx belongs to, or ""
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// newRequestID returns a random 16-byte hex request ID
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID reports whether a client-supplied ID is safe to log and forward
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDMiddleware assigns a request ID to each tool call, reusing the
+// X-Request-Id header of HTTP clients when valid, and reports it in the _meta of
+// the result.
+func requestIDMiddleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if method != "tools/call" {
+			return next(ctx, method, req)
+		}
+
+		id := ""
+		if extra := req.GetExtra(); extra != nil && extra.Header != nil {
+			if header := extra.Header.Get(requestIDHeader); validRequestID(header) {
+				id = header
+			}
+		}
+		if id == "" {
+			id = newRequestID()
+		}
+
+		result, err := next(context.WithValue(ctx, requestIDKey{}, id), method, req)
+		if res, ok := result.(*mcp.CallToolResult); ok && res != nil {
+			if res.Meta == nil {
+				res.Meta = mcp.Meta{}
+			}
+			res.Meta[requestIDMetaKey] = id
+		}
+		return result, err
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id       string
+		expected bool
+	}{
+		{id: "abc-123", expected: true},
+		{id: "", expected: false},
+		{id: "with space", expected: false},
+		{id: "line\nbreak", expected: false},
+		{id: strings.Repeat("a", maxRequestIDLength+1), expected: false},
+	}
+
+	for _, tt := range tests {
+		if got := validRequestID(tt.id); got != tt.expected {
+			t.Errorf("validRequestID(%q): expected %v, got %v", tt.id, tt.expected, got)
+		}
+	}
+}
+
+func TestRequestIDMiddleware_UsesHeader(t *testing.T) {
+	var seen string
+	handler := requestIDMiddleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		seen = requestID(ctx)
+		return &mcp.CallToolResult{}, nil
+	})
+
+	req := &mcp.CallToolRequest{Extra: &mcp.RequestExtra{Header: http.Header{"X-Request-Id": {"upstream-1"}}}}
+	result, err := handler(context.Background(), "tools/call", req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if seen != "upstream-1" {
+		t.Errorf("expected request ID from header, got %q", seen)
+	}
+	if id := result.(*mcp.CallToolResult).Meta[requestIDMetaKey]; id != "upstream-1" {
+		t.Errorf("expected request ID in result meta, got %v", id)
+	}
+}
+
+func TestWebfetchTool_RequestID(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>" + r.Header.Get("X-Request-Id") + "</p>"))
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{}))
+
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch",
+		Arguments: map[string]any{"url": site.URL},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+
+	id, _ := res.Meta[requestIDMetaKey].(string)
+	if len(id) != 32 {
+		t.Fatalf("expected generated request ID in result meta, got %v", res.Meta)
+	}
+	if text := res.Content[0].(*mcp.TextContent).Text; text != id {
+		t.Errorf("expected X-Request-Id %s to be sent, got %q", id, text)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// saveExcerptLength is the length of the excerpt in the summary of a saved result
+const saveExcerptLength = 300
+
+// maxSessionDocuments bounds the saved results and crawled pages kept for
+// each session, the oldest being removed beyond it
+const maxSessionDocuments = 1000
+
+// savedDocument is the resource of a saved result or crawled page, written to
+// path with -save-dir, its content being read back from the file
+type savedDocument struct {
+	uri     string
+	path    string
+	content string
+}
+
+// documents keeps the resources of the saved results and crawled pages of
+// each session, which only that session may read and which are removed with
+// the session. It is safe for concurrent use.
+type documents struct {
+	mu        sync.Mutex
+	bySession map[string][]savedDocument
+}
+
+func newDocuments() *documents {
+	return &documents{bySession: make(map[string][]savedDocument)}
+}
+
+// add records doc for session, returning the oldest documents of the session
+// beyond maxSessionDocuments, and reporting whether the end of session must be
+// awaited to remove its documents, i.e. on its first one
+func (d *documents) add(session string, doc savedDocument) (evicted []savedDocument, attach bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	docs, attached := d.bySession[session]
+	docs = append(docs, doc)
+	if len(docs) > maxSessionDocuments {
+		evicted = slices.Clone(docs[:len(docs)-maxSessionDocuments])
+		docs = slices.Delete(docs, 0, len(evicted))
+	}
+	d.bySession[session] = docs
+	return evicted, !attached
+}
+
+// get returns the document of session at uri
+func (d *documents) get(session, uri string) (savedDocument, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := slices.IndexFunc(d.bySession[session], func(doc savedDocument) bool { return doc.uri == uri })
+	if i < 0 {
+		return savedDocument{}, false
+	}
+	return d.bySession[session][i], true
+}
+
+// removeSession drops the documents of session, returning them
+func (d *documents) removeSession(session string) []savedDocument {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	docs := d.bySession[session]
+	delete(d.bySession, session)
+	return docs
+}
+
+// saveDocument makes doc readable at uri by the session of req, until its
+// end. With -save-dir, the content is written to a file of the directory and
+// read back from it, so that large documents are not kept in memory, and the
+// path of the file is returned.
+func (t *tools) saveDocument(req *mcp.CallToolRequest, uri string, doc *webfetch.Document) (string, error) {
+	if t.cfg.saveDir == "" {
+		t.trackDocument(req, savedDocument{uri: uri, content: doc.Content})
+		return "", nil
+	}
+
+	if err := os.MkdirAll(t.cfg.saveDir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to save result: %w", err)
+	}
+	// webfetch://crawl/ID/page/2 is saved as crawl-ID-page-2-<random>.md, the
+	// random part keeping the files of previous runs
+	pattern := strings.ReplaceAll(strings.TrimPrefix(uri, "webfetch://"), "/", "-") + "-*.md"
+	f, err := os.CreateTemp(t.cfg.saveDir, pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to save result: %w", err)
+	}
+	if _, err := f.WriteString(doc.Content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to save result: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to save result: %w", err)
+	}
+	t.trackDocument(req, savedDocument{uri: uri, path: f.Name()})
+	return f.Name(), nil
+}
+
+// trackDocument records doc for the session of req, removing its file when
+// the session ends, as for watches, or when the session has too many
+// documents
+func (t *tools) trackDocument(req *mcp.CallToolRequest, doc savedDocument) {
+	session := sessionID(req)
+	evicted, attach := t.documents.add(session, doc)
+	removeDocumentFiles(evicted)
+	if attach && req != nil && req.Session != nil {
+		go func() {
+			req.Session.Wait()
+			removeDocumentFiles(t.documents.removeSession(session))
+		}()
+	}
+}
+
+// removeDocumentFiles removes the files of docs
+func removeDocumentFiles(docs []savedDocument) {
+	for _, doc := range docs {
+		if doc.path != "" {
+			os.Remove(doc.path)
+		}
+	}
+}
+
+// saveSummary describes a result saved at uri in place of its content. The
+// path of a saved file is left out, not to disclose the server file system.
+func saveSummary(uri string, doc *webfetch.Document) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Saved the content of %s as resource %s.\n\nTitle: %s\nSize: %d characters (about %d tokens)\n", doc.URL, uri, doc.Title, len(doc.Content), estimateTokens(doc.Content))
+
+	excerpt := strings.Join(strings.Fields(doc.Content), " ")
+	if len(excerpt) > saveExcerptLength {
+		excerpt = strings.ToValidUTF8(excerpt[:saveExcerptLength], "") + "..."
+	}
+	if excerpt != "" {
+		fmt.Fprintf(&sb, "Excerpt: %s\n", excerpt)
+	}
+	return sb.String()
+}
+
+// addDocumentTemplate registers the resource template of the saved results
+// or crawled pages whose URIs match uriTemplate. The documents are not listed
+// as resources, which all sessions would see, and each session may only read
+// its own: the URIs of the others are not found.
+func (t *tools) addDocumentTemplate(uriTemplate, name, description string) {
+	t.server.AddResourceTemplate(&mcp.ResourceTemplate{
+		URITemplate: uriTemplate,
+		Name:        name,
+		Description: description,
+		MIMEType:    "text/markdown",
+	}, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+		uri := req.Params.URI
+		doc, ok := t.documents.get(serverSessionID(req.Session), uri)
+		if !ok {
+			return nil, mcp.ResourceNotFoundError(uri)
+		}
+		text := doc.content
+		if doc.path != "" {
+			data, err := os.ReadFile(doc.path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", uri, err)
+			}
+			text = string(data)
+		}
+		return &mcp.ReadResourceResult{
+			Contents: []*mcp.ResourceContents{
+				{URI: uri, MIMEType: "text/markdown", Text: text},
+			},
+		}, nil
+	})
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestWebfetchTool_Save(t *testing.T) {
+	page := "<title>Report</title><p>" + strings.Repeat("Long report text. ", 100) + "</p>"
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	}))
+	defer site.Close()
+
+	tests := []struct {
+		name    string
+		saveDir string
+	}{
+		{name: "memory"},
+		{name: "directory", saveDir: filepath.Join(t.TempDir(), "saved")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := connectTestClient(t, setupMCPServer(config{saveDir: tt.saveDir}))
+			ctx := context.Background()
+			res, err := session.CallTool(ctx, &mcp.CallToolParams{
+				Name:      "webfetch",
+				Arguments: map[string]any{"url": site.URL, "save": true},
+			})
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+			if res.IsError {
+				t.Fatalf("unexpected error: %+v", res.Content)
+			}
+
+			summary := res.Content[0].(*mcp.TextContent).Text
+			uri := regexp.MustCompile(`webfetch://saved/[A-Z2-7]{26}`).FindString(summary)
+			if uri == "" || !strings.Contains(summary, "Title: Report\nSize: 1799 characters") || len(summary) > 600 {
+				t.Fatalf("expected a short summary with the resource URI, got %q", summary)
+			}
+			if tt.saveDir != "" {
+				files, _ := os.ReadDir(tt.saveDir)
+				if len(files) != 1 || strings.Contains(summary, tt.saveDir) {
+					t.Errorf("expected one saved file not named by the summary, got %v and %q", files, summary)
+				}
+			}
+
+			read, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri})
+			if err != nil {
+				t.Fatalf("ReadResource failed: %v", err)
+			}
+			if len(read.Contents) != 1 || len(read.Contents[0].Text) != 1799 {
+				t.Errorf("expected the whole content, got %+v", read.Contents)
+			}
+
+			// Saved files are removed with their session
+			if tt.saveDir != "" {
+				session.Close()
+				deadline := time.Now().Add(5 * time.Second)
+				for files, _ := os.ReadDir(tt.saveDir); len(files) != 0; files, _ = os.ReadDir(tt.saveDir) {
+					if time.Now().After(deadline) {
+						t.Fatalf("expected no saved file after the session end, got %v", files)
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+		})
+	}
+}
+
+func TestWebfetchTool_SaveSessionIsolation(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<title>Report</title><p>Private report</p>`))
+	}))
+	defer site.Close()
+
+	server := setupMCPServer(config{saveDir: t.TempDir()})
+	saving := connectHTTPTestClient(t, server)
+	other := connectHTTPTestClient(t, server)
+	ctx := context.Background()
+
+	res, err := saving.CallTool(ctx, &mcp.CallToolParams{
+		Name:      "webfetch",
+		Arguments: map[string]any{"url": site.URL, "save": true},
+	})
+	if err != nil || res.IsError {
+		t.Fatalf("unexpected error: %v %+v", err, res)
+	}
+	uri := regexp.MustCompile(`webfetch://saved/[A-Z2-7]{26}`).FindString(res.Content[0].(*mcp.TextContent).Text)
+	if uri == "" {
+		t.Fatalf("expected a random resource URI, got %+v", res.Content)
+	}
+
+	// Only the saving session may read the result, which is not listed
+	if read, err := saving.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri}); err != nil || read.Contents[0].Text != "Private report" {
+		t.Errorf("expected the saved result, got %+v (%v)", read, err)
+	}
+	if _, err := other.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri}); err == nil {
+		t.Errorf("expected the result of another session not to be found")
+	}
+	if list, err := other.ListResources(ctx, nil); err != nil || len(list.Resources) != 0 {
+		t.Errorf("expected no listed resource, got %+v (%v)", list, err)
+	}
+}
+
+func TestCrawlTool_SaveDir(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<title>Home</title><p>Home page</p>`))
+	}))
+	defer site.Close()
+
+	saveDir := t.TempDir()
+	session := connectTestClient(t, setupMCPServer(config{saveDir: saveDir}))
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch_crawl",
+		Arguments: map[string]any{"url": site.URL + "/"},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+
+	var output crawlToolOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	json.Unmarshal(data, &output)
+	if len(output.Pages) != 1 || filepath.Dir(output.Pages[0].Path) != saveDir {
+		t.Fatalf("expected the page to be saved in %s, got %+v", saveDir, output.Pages)
+	}
+	if data, err := os.ReadFile(output.Pages[0].Path); err != nil || string(data) != "Home page" {
+		t.Errorf("expected the page Markdown in the file, got %q (%v)", data, err)
+	}
+}
+
+func TestDocuments_Limit(t *testing.T) {
+	d := newDocuments()
+	for i := range maxSessionDocuments {
+		evicted, attach := d.add("s", savedDocument{uri: fmt.Sprintf("webfetch://saved/%d", i)})
+		if len(evicted) != 0 || attach != (i == 0) {
+			t.Fatalf("add %d: expected no eviction and attach %v, got %v and %v", i, i == 0, evicted, attach)
+		}
+	}
+	evicted, attach := d.add("s", savedDocument{uri: "webfetch://saved/last"})
+	if attach || len(evicted) != 1 || evicted[0].uri != "webfetch://saved/0" {
+		t.Errorf("expected the oldest document evicted, got %v and %v", evicted, attach)
+	}
+	if docs := d.removeSession("s"); len(docs) != maxSessionDocuments || docs[len(docs)-1].uri != "webfetch://saved/last" {
+		t.Errorf("expected %d documents ending with the last one, got %d", maxSessionDocuments, len(docs))
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"golang.org/x/net/html"
+)
+
+// Search engines of the webfetch_search tool
+const (
+	searchEngineSearXNG    = "searxng"
+	searchEngineBrave      = "brave"
+	searchEngineDuckDuckGo = "duckduckgo"
+)
+
+// Default endpoints of the search engines; SearXNG instances are self-hosted,
+// so their URL is always configured
+const (
+	defaultBraveSearchURL      = "https://api.search.brave.com/res/v1/web/search"
+	defaultDuckDuckGoSearchURL = "https://html.duckduckgo.com/html/"
+)
+
+// searchTimeout bounds each search request
+const searchTimeout = 30 * time.Second
+
+// Limits of the webfetch_search tool
+const (
+	defaultSearchResults = 10
+	maxSearchResults     = 20
+	maxSearchFetches     = 5
+)
+
+// DuckDuckGo HTML results: the result links and their snippets, ads excluded
+var (
+	duckDuckGoResult  = cascadia.MustCompile(".result:not(.result--ad)")
+	duckDuckGoLink    = cascadia.MustCompile("a.result__a")
+	duckDuckGoSnippet = cascadia.MustCompile(".result__snippet")
+)
+
+// searchEngines are the values of the -search flag
+var searchEngines = []string{searchEngineSearXNG, searchEngineBrave, searchEngineDuckDuckGo}
+
+// checkSearchConfig ensures the search engine has what it needs: SearXNG an
+// instance URL and Brave an API key
+func checkSearchConfig(engine, searchURL, apiKey string) error {
+	switch {
+	case engine == searchEngineSearXNG && searchURL == "":
+		return fmt.Errorf("-search %s requires -search-url", engine)
+	case engine == searchEngineBrave && apiKey == "":
+		return fmt.Errorf("-search %s requires -search-api-key", engine)
+	}
+	return nil
+}
+
+// searchResult is a result of a web search
+type searchResult struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Snippet string `json:"snippet,omitempty"`
+	// Fetched is set when the page was fetched, its Markdown being returned
+	// in a separate content block
+	Fetched         bool                `json:"fetched,omitempty"`
+	FetchError      string              `json:"fetch_error,omitempty"`
+	FetchErrorClass webfetch.ErrorClass `json:"fetch_error_class,omitempty"`
+}
+
+// searcher queries a web search engine
+type searcher struct {
+	engine    string
+	url       string
+	apiKey    string
+	userAgent string
+	client    *http.Client
+}
+
+func newSearcher(engine, searchURL, apiKey, userAgent string) *searcher {
+	if searchURL == "" {
+		switch engine {
+		case searchEngineBrave:
+			searchURL = defaultBraveSearchURL
+		case searchEngineDuckDuckGo:
+			searchURL = defaultDuckDuckGoSearchURL
+		}
+	}
+	if userAgent == "" {
+		userAgent = webfetch.DefaultUserAgent
+	}
+	return &searcher{engine: engine, url: searchURL, apiKey: apiKey, userAgent: userAgent, client: &http.Client{Timeout: searchTimeout}}
+}
+
+// search returns at most count results for query
+func (s *searcher) search(ctx context.Context, query string, count int) ([]searchResult, error) {
+	endpoint, err := url.Parse(s.url)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: invalid search URL: %w", err)
+	}
+	params := url.Values{"q": {query}}
+	switch s.engine {
+	case searchEngineSearXNG:
+		endpoint = endpoint.JoinPath("search")
+		params.Set("format", "json")
+	case searchEngineBrave:
+		params.Set("count", strconv.Itoa(count))
+	}
+	endpoint.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+	req.Header.Set("User-Agent", s.userAgent)
+	if s.engine == searchEngineBrave {
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("X-Subscription-Token", s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("search failed: %w", &webfetch.StatusError{StatusCode: resp.StatusCode})
+	}
+	body := io.LimitReader(resp.Body, 10<<20)
+
+	var results []searchResult
+	switch s.engine {
+	case searchEngineSearXNG:
+		results, err = parseSearXNGResults(body)
+	case searchEngineBrave:
+		results, err = parseBraveResults(body)
+	default:
+		results, err = parseDuckDuckGoResults(body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("search failed: invalid response: %w", err)
+	}
+	if len(results) > count {
+		results = results[:count]
+	}
+	return results, nil
+}
+
+// parseSearXNGResults parses the JSON results of a SearXNG instance
+func parseSearXNGResults(r io.Reader) ([]searchResult, error) {
+	var response struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(r).Decode(&response); err != nil {
+		return nil, err
+	}
+	var results []searchResult
+	for _, r := range response.Results {
+		results = append(results, searchResult{Title: r.Title, URL: r.URL, Snippet: r.Content})
+	}
+	return results, nil
+}
+
+// parseBraveResults parses the web results of the Brave Search API
+func parseBraveResults(r io.Reader) ([]searchResult, error) {
+	var response struct {
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	if err := json.NewDecoder(r).Decode(&response); err != nil {
+		return nil, err
+	}
+	var results []searchResult
+	for _, r := range response.Web.Results {
+		// Descriptions highlight the query terms with <strong> tags
+		results = append(results, searchResult{Title: r.Title, URL: r.URL, Snippet: stripTags(r.Description)})
+	}
+	return results, nil
+}
+
+// parseDuckDuckGoResults parses the results page of the DuckDuckGo HTML
+// version, whose links go through a redirect carrying the target in uddg
+func parseDuckDuckGoResults(r io.Reader) ([]searchResult, error) {
+	root, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	var results []searchResult
+	for _, n := range cascadia.QueryAll(root, duckDuckGoResult) {
+		link := cascadia.Query(n, duckDuckGoLink)
+		if link == nil {
+			continue
+		}
+		target := attr(link, "href")
+		if u, err := url.Parse(target); err == nil && u.Query().Get("uddg") != "" {
+			target = u.Query().Get("uddg")
+		}
+		if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+			continue
+		}
+		result := searchResult{Title: nodeText(link), URL: target}
+		if snippet := cascadia.Query(n, duckDuckGoSnippet); snippet != nil {
+			result.Snippet = nodeText(snippet)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// attr returns the value of the attribute key of n
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// nodeText returns the text of n with collapsed whitespace
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// stripTags returns the text of an HTML fragment
+func stripTags(s string) string {
+	root, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return s
+	}
+	return nodeText(root)
+}
+
+type searchToolInput struct {
+	Query            string `json:"query" jsonschema:"The search query (required)"`
+	MaxResults       int    `json:"max_results,omitempty" jsonschema:"Maximum number of results, at most 20 (default: 10)"`
+	Fetch            int    `json:"fetch,omitempty" jsonschema:"Fetch the top N results, at most 5, and return their Markdown like webfetch (default: 0)"`
+	Timeout          string `json:"timeout,omitempty" jsonschema:"Timeout of each page fetch, capped by the server (default: 5s)"`
+	MaxContentTokens int    `json:"max_content_tokens,omitempty" jsonschema:"Maximum content length of each fetched page, capped by the server (default: 100000)"`
+}
+
+type searchToolOutput struct {
+	Query   string         `json:"query"`
+	Results []searchResult `json:"results,omitempty"`
+}
+
+// addSearchTool registers the webfetch_search tool on the server
+func (t *tools) addSearchTool() {
+	mcp.AddTool(t.server, &mcp.Tool{
+		Name: t.cfg.toolName("webfetch_search"),
+		Description: "Searches the web and returns the title, URL and snippet of the results. With fetch, the top results " +
+			"are also fetched and converted to Markdown as with " + t.cfg.toolName("webfetch") + ", in one call.",
+	}, func(
+		ctx context.Context,
+		req *mcp.CallToolRequest,
+		input searchToolInput,
+	) (*mcp.CallToolResult, *searchToolOutput, error) {
+		if strings.TrimSpace(input.Query) == "" {
+			return toolError("query is required"), nil, nil
+		}
+		if input.MaxResults < 0 || input.Fetch < 0 {
+			return toolError("max_results and fetch must not be negative"), nil, nil
+		}
+		if _, err := t.resolveTimeout(input.Timeout); err != nil {
+			return toolError(err.Error()), nil, nil
+		}
+		count := input.MaxResults
+		if count == 0 {
+			count = defaultSearchResults
+		}
+		count = min(count, maxSearchResults)
+
+		results, err := t.searcher.search(ctx, input.Query, count)
+		if err != nil {
+			return fetchError(err), nil, nil
+		}
+
+		result := &mcp.CallToolResult{}
+		var sb strings.Builder
+		if len(results) == 0 {
+			sb.WriteString("No results.")
+		}
+		for i := range results {
+			if t.pii != nil {
+				results[i].Snippet = t.pii.scrub(results[i].Snippet)
+			}
+			fmt.Fprintf(&sb, "%d. [%s](%s)\n", i+1, results[i].Title, results[i].URL)
+			if results[i].Snippet != "" {
+				fmt.Fprintf(&sb, "   %s\n", results[i].Snippet)
+			}
+		}
+		result.Content = append(result.Content, &mcp.TextContent{Text: sb.String()})
+
+		// Fetch the top results through the webfetch pipeline, so that the
+		// blocklist, policy, quotas, cache and post-processing apply
+		for i := range results[:min(input.Fetch, maxSearchFetches, len(results))] {
+			page, _, _ := t.handleWebfetch(ctx, req, webfetchToolInput{
+				URL:              results[i].URL,
+				Timeout:          input.Timeout,
+				MaxContentTokens: input.MaxContentTokens,
+			})
+			t.recordFetch(ctx, req, "webfetch_search", results[i].URL, page, nil)
+			text := page.Content[0].(*mcp.TextContent).Text
+			if page.IsError {
+				results[i].FetchError = text
+				if info, ok := page.Meta[errorMetaKey].(errorInfo); ok {
+					results[i].FetchErrorClass = info.Class
+				}
+				continue
+			}
+			results[i].Fetched = true
+			result.Content = append(result.Content, &mcp.TextContent{Text: "Content of " + results[i].URL + ":\n\n" + text})
+		}
+
+		return result, &searchToolOutput{Query: input.Query, Results: results}, nil
+	})
+}
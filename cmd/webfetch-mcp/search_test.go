@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestSearcher(t *testing.T) {
+	tests := []struct {
+		engine   string
+		path     string
+		body     string
+		expected []searchResult
+	}{
+		{
+			engine: searchEngineSearXNG,
+			path:   "/search",
+			body:   `{"results": [{"title": "Go", "url": "https://go.dev/", "content": "The Go language"}, {"title": "Tour", "url": "https://go.dev/tour/"}]}`,
+			expected: []searchResult{
+				{Title: "Go", URL: "https://go.dev/", Snippet: "The Go language"},
+				{Title: "Tour", URL: "https://go.dev/tour/"},
+			},
+		},
+		{
+			engine: searchEngineBrave,
+			path:   "/",
+			body:   `{"web": {"results": [{"title": "Go", "url": "https://go.dev/", "description": "The <strong>Go</strong> language"}]}}`,
+			expected: []searchResult{
+				{Title: "Go", URL: "https://go.dev/", Snippet: "The Go language"},
+			},
+		},
+		{
+			engine: searchEngineDuckDuckGo,
+			path:   "/",
+			body: `<div class="result result--ad"><a class="result__a" href="https://ads.example.com/">Ad</a></div>
+<div class="result"><h2><a class="result__a" href="//duckduckgo.com/l/?uddg=https%3A%2F%2Fgo.dev%2F&rut=1">The <b>Go</b>
+Programming Language</a></h2><a class="result__snippet">Build simple, secure systems.</a></div>`,
+			expected: []searchResult{
+				{Title: "The Go Programming Language", URL: "https://go.dev/", Snippet: "Build simple, secure systems."},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.engine, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.path || r.URL.Query().Get("q") != "golang" {
+					t.Errorf("expected query golang on %s, got %s", tt.path, r.URL)
+				}
+				if tt.engine == searchEngineBrave && r.Header.Get("X-Subscription-Token") != "key" {
+					t.Errorf("expected API key, got %q", r.Header.Get("X-Subscription-Token"))
+				}
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			results, err := newSearcher(tt.engine, server.URL, "key", "").search(context.Background(), "golang", 10)
+			if err != nil {
+				t.Fatalf("search failed: %v", err)
+			}
+			if !slices.Equal(results, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, results)
+			}
+		})
+	}
+}
+
+func TestCheckSearchConfig(t *testing.T) {
+	tests := []struct {
+		engine    string
+		searchURL string
+		apiKey    string
+		valid     bool
+	}{
+		{engine: "", valid: true},
+		{engine: searchEngineDuckDuckGo, valid: true},
+		{engine: searchEngineSearXNG, valid: false},
+		{engine: searchEngineSearXNG, searchURL: "http://localhost:8888", valid: true},
+		{engine: searchEngineBrave, valid: false},
+		{engine: searchEngineBrave, apiKey: "key", valid: true},
+	}
+
+	for _, tt := range tests {
+		if err := checkSearchConfig(tt.engine, tt.searchURL, tt.apiKey); (err == nil) != tt.valid {
+			t.Errorf("%+v: expected valid %v, got %v", tt, tt.valid, err)
+		}
+	}
+}
+
+func TestSearchTool(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<h1>Result page</h1>")
+	}))
+	defer site.Close()
+	engine := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"results": [{"title": "Missing", "url": "%[1]s/missing"}, {"title": "Page", "url": "%[1]s/page"}, {"title": "Other", "url": "%[1]s/other"}]}`, site.URL)
+	}))
+	defer engine.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{searchEngine: searchEngineSearXNG, searchURL: engine.URL}))
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch_search",
+		Arguments: map[string]any{"query": "result", "max_results": 2, "fetch": 2},
+	})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected error: %+v", res.Content)
+	}
+
+	var output searchToolOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	json.Unmarshal(data, &output)
+	if len(output.Results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", output.Results)
+	}
+	if output.Results[0].Fetched || output.Results[0].FetchError == "" {
+		t.Errorf("expected a fetch error for the missing page, got %+v", output.Results[0])
+	}
+	if !output.Results[1].Fetched {
+		t.Errorf("expected the page to be fetched, got %+v", output.Results[1])
+	}
+
+	if len(res.Content) != 2 {
+		t.Fatalf("expected the results and one page, got %d content blocks", len(res.Content))
+	}
+	if text := res.Content[0].(*mcp.TextContent).Text; !strings.HasPrefix(text, "1. [Missing]("+site.URL+"/missing)\n2. [Page]") {
+		t.Errorf("expected the list of results, got %q", text)
+	}
+	if text := res.Content[1].(*mcp.TextContent).Text; !strings.Contains(text, "# Result page") {
+		t.Errorf("expected the Markdown of the page, got %q", text)
+	}
+}
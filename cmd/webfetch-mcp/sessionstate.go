@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	// defaultSessionTTL is how long the state of an idle session is kept
+	defaultSessionTTL = 24 * time.Hour
+	// redisSessionKeyPrefix prefixes the keys of session states in Redis
+	redisSessionKeyPrefix = "webfetch:session:"
+	// sessionIDHeader is the HTTP header carrying the MCP session ID
+	sessionIDHeader = "Mcp-Session-Id"
+)
+
+// sessionStore keeps the state of sessions across restarts. It is implemented
+// by dirSessionStore and webfetch.RedisStore.
+type sessionStore interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// openSessionStore opens the store at location: a Redis URL, or else a
+// directory, created if needed
+func openSessionStore(location string) (sessionStore, error) {
+	if strings.HasPrefix(location, "redis://") || strings.HasPrefix(location, "rediss://") {
+		return webfetch.NewRedisStore(location, redisSessionKeyPrefix)
+	}
+	return newDirSessionStore(location)
+}
+
+// dirSessionStore keeps each value in a file of a directory. The modification
+// time of a file is set to its expiry.
+type dirSessionStore struct {
+	dir string
+}
+
+// newDirSessionStore returns a store in dir, removing the expired values left
+// by previous runs
+func newDirSessionStore(dir string) (*dirSessionStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && strings.HasSuffix(entry.Name(), ".json") && info.ModTime().Before(now) {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+	return &dirSessionStore{dir: dir}, nil
+}
+
+// path returns the file of key, named after its hash since session IDs are
+// chosen by clients
+func (s *dirSessionStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (s *dirSessionStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	path := s.path(key)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	if info.ModTime().Before(time.Now()) {
+		os.Remove(path)
+		return nil, false, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	return data, err == nil, err
+}
+
+func (s *dirSessionStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	// Write to a temporary file first, so that a crash never leaves a partial state
+	tmp, err := os.CreateTemp(s.dir, "session-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	expiry := time.Now().Add(ttl)
+	if err := os.Chtimes(tmp.Name(), expiry, expiry); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(key))
+}
+
+func (s *dirSessionStore) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// sessionState is the state of a session kept in a sessionStore
+type sessionState struct {
+	// Init holds the parameters of the initialize request of the session,
+	// replayed to resume it after a restart
+	Init    *mcp.InitializeParams `json:"init"`
+	History []historyEntry        `json:"history,omitempty"`
+	Quota   *quotaUsage           `json:"quota,omitempty"`
+}
+
+// sessionPersistence saves the state of HTTP sessions, their history and
+// quota usage, to a store so that clients keep their Mcp-Session-Id across
+// server restarts. It is safe for concurrent use.
+type sessionPersistence struct {
+	store  sessionStore
+	ttl    time.Duration
+	logger *slog.Logger
+
+	mu sync.Mutex
+	// sessions maps the sessions of this process to their initialize parameters
+	sessions map[string]*mcp.InitializeParams
+	// nextID is the ID given to the next session, when resuming one
+	nextID string
+
+	// resuming is held exclusively while a session is resumed, so that no new
+	// session takes its ID
+	resuming sync.RWMutex
+}
+
+func newSessionPersistence(store sessionStore, ttl time.Duration, logger *slog.Logger) *sessionPersistence {
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+	return &sessionPersistence{store: store, ttl: ttl, logger: logger, sessions: make(map[string]*mcp.InitializeParams)}
+}
+
+// sessionID returns the ID of a new session, for mcp.ServerOptions.GetSessionID
+func (p *sessionPersistence) sessionID() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if id := p.nextID; id != "" {
+		p.nextID = ""
+		return id
+	}
+	return rand.Text()
+}
+
+// known reports whether session is active in this process
+func (p *sessionPersistence) known(session string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, ok := p.sessions[session]
+	return ok
+}
+
+// handler wraps the streamable HTTP handler next to resume the sessions of
+// previous runs, whose ID next would otherwise reject
+func (p *sessionPersistence) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := r.Header.Get(sessionIDHeader)
+		if session == "" {
+			p.resuming.RLock()
+			defer p.resuming.RUnlock()
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			next.ServeHTTP(w, r)
+			p.forget(r.Context(), session)
+			return
+		}
+		if !p.known(session) {
+			if err := p.resume(r.Context(), session, next); err != nil {
+				p.logger.Warn("session resumption failed", "session", session, "error", err)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// resume creates session in next again, with the initialize request it was
+// created with, if the store has its state
+func (p *sessionPersistence) resume(ctx context.Context, session string, next http.Handler) error {
+	p.resuming.Lock()
+	defer p.resuming.Unlock()
+
+	if p.known(session) {
+		return nil
+	}
+	state, err := p.load(ctx, session)
+	if err != nil || state == nil || state.Init == nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.nextID = session
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.nextID = ""
+		p.mu.Unlock()
+	}()
+
+	params, err := json.Marshal(state.Init)
+	if err != nil {
+		return err
+	}
+	initialize := fmt.Sprintf(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":%s}`, params)
+	if status, id := replay(ctx, next, "", state.Init.ProtocolVersion, initialize); status != http.StatusOK || id != session {
+		return fmt.Errorf("initialize replay failed with status %d", status)
+	}
+	initialized := `{"jsonrpc":"2.0","method":"notifications/initialized"}`
+	if status, _ := replay(ctx, next, session, state.Init.ProtocolVersion, initialized); status >= 300 {
+		return fmt.Errorf("initialized replay failed with status %d", status)
+	}
+	return nil
+}
+
+// replay posts the JSON-RPC message body to next, returning the status and the
+// session ID of the response
+func replay(ctx context.Context, next http.Handler, session, protocolVersion, body string) (int, string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/", strings.NewReader(body))
+	if err != nil {
+		return http.StatusInternalServerError, ""
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	req.Header.Set("Mcp-Protocol-Version", protocolVersion)
+	if session != "" {
+		req.Header.Set(sessionIDHeader, session)
+	}
+	w := &replayResponse{header: make(http.Header), status: http.StatusOK}
+	next.ServeHTTP(w, req)
+	return w.status, w.header.Get(sessionIDHeader)
+}
+
+// replayResponse is a discarded response of a replayed request
+type replayResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *replayResponse) Header() http.Header         { return r.header }
+func (r *replayResponse) Write(b []byte) (int, error) { return r.body.Write(b) }
+func (r *replayResponse) WriteHeader(status int)      { r.status = status }
+
+// load returns the stored state of session, or nil if there is none
+func (p *sessionPersistence) load(ctx context.Context, session string) (*sessionState, error) {
+	data, ok, err := p.store.Get(ctx, session)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var state sessionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid session state: %w", err)
+	}
+	return &state, nil
+}
+
+// forget drops session, closed by its client
+func (p *sessionPersistence) forget(ctx context.Context, session string) {
+	p.mu.Lock()
+	delete(p.sessions, session)
+	p.mu.Unlock()
+	if err := p.store.Delete(ctx, session); err != nil {
+		p.logger.Warn("session state removal failed", "session", session, "error", err)
+	}
+}
+
+// persistSessions is a middleware restoring the state of resumed sessions when
+// they are initialized again, and saving the state of sessions after each tool
+// call
+func (t *tools) persistSessions(next mcp.MethodHandler) mcp.MethodHandler {
+	p := t.cfg.sessions
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		session := ""
+		if s := req.GetSession(); s != nil {
+			session = s.ID()
+		}
+		if session == "" || (method != "initialize" && method != "tools/call") {
+			return next(ctx, method, req)
+		}
+
+		if method == "initialize" {
+			result, err := next(ctx, method, req)
+			if err == nil {
+				t.startSession(ctx, session, req.GetParams().(*mcp.InitializeParams))
+				// The state stays in the store, for the client to resume the
+				// session after a restart
+				if ss, ok := req.GetSession().(*mcp.ServerSession); ok {
+					go func() {
+						ss.Wait()
+						t.endSession(session)
+					}()
+				}
+			}
+			return result, err
+		}
+
+		result, err := next(ctx, method, req)
+		p.mu.Lock()
+		init, ok := p.sessions[session]
+		p.mu.Unlock()
+		if ok {
+			t.saveSession(ctx, session, init)
+		}
+		return result, err
+	}
+}
+
+// startSession registers a new or resumed session, restoring the history and
+// quota usage of a resumed one
+func (t *tools) startSession(ctx context.Context, session string, init *mcp.InitializeParams) {
+	p := t.cfg.sessions
+	state, err := p.load(ctx, session)
+	if err != nil {
+		p.logger.Warn("session state load failed", "session", session, "error", err)
+	} else if state != nil {
+		t.history.restore(session, state.History)
+		if t.quotas != nil && state.Quota != nil {
+			t.quotas.restore(session, *state.Quota)
+		}
+	}
+
+	p.mu.Lock()
+	p.sessions[session] = init
+	p.mu.Unlock()
+	t.saveSession(ctx, session, init)
+}
+
+// endSession drops session, ended in this process, and its history
+func (t *tools) endSession(session string) {
+	p := t.cfg.sessions
+	p.mu.Lock()
+	delete(p.sessions, session)
+	p.mu.Unlock()
+	t.history.remove(session)
+}
+
+// saveSession stores the state of session
+func (t *tools) saveSession(ctx context.Context, session string, init *mcp.InitializeParams) {
+	p := t.cfg.sessions
+	state := sessionState{Init: init, History: t.history.list(session, 0)}
+	if t.quotas != nil {
+		state.Quota = t.quotas.snapshot(session)
+	}
+	data, err := json.Marshal(state)
+	if err == nil {
+		err = p.store.Set(ctx, session, data, p.ttl)
+	}
+	if err != nil {
+		p.logger.Warn("session state save failed", "session", session, "error", err)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestDirSessionStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := newDirSessionStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Set(ctx, "a", []byte("state"), time.Hour); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if value, ok, err := store.Get(ctx, "a"); err != nil || !ok || string(value) != "state" {
+		t.Errorf("expected %q, got %q, %t, %v", "state", value, ok, err)
+	}
+	if _, ok, _ := store.Get(ctx, "b"); ok {
+		t.Error("expected no value for an unknown key")
+	}
+
+	// Expired values are dropped on read and when the store is opened again
+	store.Set(ctx, "expired", []byte("state"), -time.Second)
+	if _, ok, _ := store.Get(ctx, "expired"); ok {
+		t.Error("expected the expired value to be dropped")
+	}
+	store.Set(ctx, "expired", []byte("state"), -time.Second)
+	if _, err := newDirSessionStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(store.path("expired")); !os.IsNotExist(err) {
+		t.Errorf("expected the expired file to be removed, got %v", err)
+	}
+
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, ok, _ := store.Get(ctx, "a"); ok {
+		t.Error("expected the deleted value to be gone")
+	}
+}
+
+func TestSessionPersistence_Restart(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Hello</p>"))
+	}))
+	defer site.Close()
+
+	dir := t.TempDir()
+	// start returns the handler of a new server process keeping its sessions in dir
+	start := func() http.Handler {
+		store, err := newDirSessionStore(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := config{sessionMaxFetches: 2}
+		cfg.sessions = newSessionPersistence(store, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		server := setupMCPServer(cfg)
+		return cfg.sessions.handler(mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, nil))
+	}
+	var current atomic.Pointer[http.Handler]
+	handler := start()
+	current.Store(&handler)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		(*current.Load()).ServeHTTP(w, r)
+	}))
+	defer endpoint.Close()
+
+	ctx := context.Background()
+	client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "v1.0.0"}, nil)
+	session, err := client.Connect(ctx, &mcp.StreamableClientTransport{Endpoint: endpoint.URL}, nil)
+	if err != nil {
+		t.Fatalf("failed to connect client: %v", err)
+	}
+	defer session.Close()
+	call := func(name string, args map[string]any) *mcp.CallToolResult {
+		res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+		if err != nil {
+			t.Fatalf("CallTool %s failed: %v", name, err)
+		}
+		return res
+	}
+
+	for range 2 {
+		if res := call("webfetch", map[string]any{"url": site.URL}); res.IsError {
+			t.Fatalf("unexpected error: %+v", res.Content)
+		}
+	}
+
+	// The restarted server resumes the session with its history and quota usage
+	handler = start()
+	current.Store(&handler)
+
+	res := call("webfetch_history", nil)
+	var output historyToolOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	json.Unmarshal(data, &output)
+	if len(output.Entries) != 2 {
+		t.Errorf("expected 2 history entries, got %d", len(output.Entries))
+	}
+	res = call("webfetch", map[string]any{"url": site.URL})
+	if !res.IsError || !strings.Contains(res.Content[0].(*mcp.TextContent).Text, "quota exceeded") {
+		t.Errorf("expected quota exceeded error, got %+v", res.Content)
+	}
+}
+
+func TestSessionPersistence_EndSession(t *testing.T) {
+	store, err := newDirSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{sessions: newSessionPersistence(store, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))}
+	tl := &tools{cfg: cfg, history: newHistory()}
+	ctx := context.Background()
+
+	tl.startSession(ctx, "s1", &mcp.InitializeParams{ProtocolVersion: "2025-06-18"})
+	tl.history.add("s1", historyEntry{URL: "https://example.com/"})
+	tl.saveSession(ctx, "s1", &mcp.InitializeParams{ProtocolVersion: "2025-06-18"})
+	tl.endSession("s1")
+
+	if cfg.sessions.known("s1") || len(tl.history.list("s1", 0)) != 0 {
+		t.Error("expected the ended session and its history to be dropped")
+	}
+	// The state stays stored for the client to resume the session
+	if state, err := cfg.sessions.load(ctx, "s1"); err != nil || state == nil || len(state.History) != 1 {
+		t.Errorf("expected the stored state to be kept, got %+v (%v)", state, err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Fetch outcomes counted by the stats tool
+const (
+	outcomeOK        = "ok"
+	outcomeCached    = "cached"
+	outcomeHTTPError = "http_error"
+	outcomeFailed    = "failed"
+)
+
+// stats counts fetches and tool calls since the server started. It is safe for
+// concurrent use.
+type stats struct {
+	mu       sync.Mutex
+	started  time.Time
+	outcomes map[string]int64
+	// latency is the total duration of fetches not served from cache
+	latency     time.Duration
+	bytes       int64
+	activeCalls int64
+}
+
+func newStats() *stats {
+	return &stats{started: time.Now(), outcomes: make(map[string]int64)}
+}
+
+// record counts a completed fetch
+func (s *stats) record(info webfetch.FetchInfo) {
+	outcome := outcomeOK
+	switch {
+	case info.Cached:
+		outcome = outcomeCached
+	case info.Err != nil && info.StatusCode != 0:
+		outcome = outcomeHTTPError
+	case info.Err != nil:
+		outcome = outcomeFailed
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.outcomes[outcome]++
+	if !info.Cached {
+		s.latency += info.Duration
+	}
+	s.bytes += info.Bytes
+}
+
+// middleware counts the tool calls in progress
+func (s *stats) middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if method != "tools/call" {
+			return next(ctx, method, req)
+		}
+
+		s.mu.Lock()
+		s.activeCalls++
+		s.mu.Unlock()
+		defer func() {
+			s.mu.Lock()
+			s.activeCalls--
+			s.mu.Unlock()
+		}()
+
+		return next(ctx, method, req)
+	}
+}
+
+type statsToolOutput struct {
+	UptimeSeconds    float64          `json:"uptime_seconds"`
+	Fetches          int64            `json:"fetches"`
+	Outcomes         map[string]int64 `json:"fetches_by_outcome"`
+	CacheHitRate     float64          `json:"cache_hit_rate"`
+	AverageLatencyMs float64          `json:"average_latency_ms"`
+	BytesTransferred int64            `json:"bytes_transferred"`
+	ActiveCalls      int64            `json:"active_calls"`
+	// Cache describes the in-memory cache, if any
+	Cache *cacheStats `json:"cache,omitempty"`
+	// Requests describes the outbound requests, if their concurrency is capped
+	Requests *requestStats `json:"requests,omitempty"`
+}
+
+// requestStats describes the outbound requests under -max-concurrent-requests
+type requestStats struct {
+	InFlight int `json:"in_flight"`
+	Waiting  int `json:"waiting"`
+	Max      int `json:"max"`
+}
+
+// cacheStats describes the content of the in-memory cache
+type cacheStats struct {
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+	Evictions int64 `json:"evictions"`
+}
+
+// snapshot returns the current counters
+func (s *stats) snapshot() statsToolOutput {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	output := statsToolOutput{
+		UptimeSeconds:    time.Since(s.started).Round(time.Second).Seconds(),
+		Outcomes:         make(map[string]int64),
+		BytesTransferred: s.bytes,
+		ActiveCalls:      s.activeCalls,
+	}
+	for _, outcome := range []string{outcomeOK, outcomeCached, outcomeHTTPError, outcomeFailed} {
+		output.Outcomes[outcome] = s.outcomes[outcome]
+		output.Fetches += s.outcomes[outcome]
+	}
+	if output.Fetches > 0 {
+		output.CacheHitRate = float64(s.outcomes[outcomeCached]) / float64(output.Fetches)
+	}
+	if fetched := output.Fetches - s.outcomes[outcomeCached]; fetched > 0 {
+		output.AverageLatencyMs = float64(s.latency.Microseconds()) / 1000 / float64(fetched)
+	}
+	return output
+}
+
+// addStatsTool registers the webfetch_stats tool on the server
+func (t *tools) addStatsTool() {
+	mcp.AddTool(t.server, &mcp.Tool{
+		Name: t.cfg.toolName("webfetch_stats"),
+		Description: "Reports server counters since startup: fetches by outcome, cache hit rate, " +
+			"average latency, bytes transferred, tool calls in progress, the size and evictions of the cache " +
+			"and the outbound requests in flight and waiting.",
+	}, func(
+		ctx context.Context,
+		req *mcp.CallToolRequest,
+		input struct{},
+	) (*mcp.CallToolResult, statsToolOutput, error) {
+		output := t.stats.snapshot()
+		if t.cacheMemory != nil {
+			s := t.cacheMemory.Stats()
+			output.Cache = &cacheStats{Entries: s.Entries, Bytes: s.Bytes, Evictions: s.Evictions}
+		}
+		if t.requestLimiter != nil {
+			output.Requests = &requestStats{
+				InFlight: t.requestLimiter.InFlight(),
+				Waiting:  t.requestLimiter.Waiting(),
+				Max:      t.cfg.maxConcurrentRequests,
+			}
+		}
+		return nil, output, nil
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestStats_Snapshot(t *testing.T) {
+	s := newStats()
+	s.record(webfetch.FetchInfo{StatusCode: 200, Bytes: 100, Duration: 10 * time.Millisecond})
+	s.record(webfetch.FetchInfo{StatusCode: 200, Bytes: 50, Duration: 30 * time.Millisecond})
+	s.record(webfetch.FetchInfo{Cached: true, Duration: time.Millisecond})
+	s.record(webfetch.FetchInfo{StatusCode: 404, Err: errors.New("unexpected status code: 404")})
+	s.record(webfetch.FetchInfo{Err: errors.New("connection refused"), Duration: 20 * time.Millisecond})
+
+	snapshot := s.snapshot()
+
+	if snapshot.Fetches != 5 {
+		t.Errorf("expected 5 fetches, got %d", snapshot.Fetches)
+	}
+	expectedOutcomes := map[string]int64{outcomeOK: 2, outcomeCached: 1, outcomeHTTPError: 1, outcomeFailed: 1}
+	for outcome, count := range expectedOutcomes {
+		if snapshot.Outcomes[outcome] != count {
+			t.Errorf("expected %d %s fetches, got %d", count, outcome, snapshot.Outcomes[outcome])
+		}
+	}
+	if snapshot.CacheHitRate != 0.2 {
+		t.Errorf("expected cache hit rate 0.2, got %v", snapshot.CacheHitRate)
+	}
+	if snapshot.AverageLatencyMs != 15 {
+		t.Errorf("expected average latency 15ms, got %v", snapshot.AverageLatencyMs)
+	}
+	if snapshot.BytesTransferred != 150 {
+		t.Errorf("expected 150 bytes transferred, got %d", snapshot.BytesTransferred)
+	}
+}
+
+func TestStatsTool(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Hello</p>"))
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{cacheTTL: time.Minute, cacheMaxEntries: 2, maxConcurrentRequests: 4}))
+
+	for _, path := range []string{"/a", "/a", "/b"} {
+		if _, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+			Name:      "webfetch",
+			Arguments: map[string]any{"url": site.URL + path},
+		}); err != nil {
+			t.Fatalf("CallTool failed: %v", err)
+		}
+	}
+
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "webfetch_stats"})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+
+	var output statsToolOutput
+	if err := json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &output); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	if output.Fetches != 3 || output.Outcomes[outcomeCached] != 1 || output.CacheHitRate != 1.0/3 {
+		t.Errorf("unexpected stats: %+v", output)
+	}
+	// Caching /b evicted /a, leaving /b and the content it shares with /a
+	if output.Cache == nil || output.Cache.Entries != 2 || output.Cache.Evictions != 1 {
+		t.Errorf("expected two cache entries after one eviction, got %+v", output.Cache)
+	}
+	if output.Requests == nil || *output.Requests != (requestStats{Max: 4}) {
+		t.Errorf("expected no request in flight out of 4, got %+v", output.Requests)
+	}
+	if output.ActiveCalls != 1 {
+		t.Errorf("expected the stats call itself to be active, got %d", output.ActiveCalls)
+	}
+}
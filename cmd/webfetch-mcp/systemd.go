@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation
+const listenFDsStart = 3
+
+// systemdListener returns the listening socket passed by systemd socket
+// activation, or nil if the server was not socket activated. The environment
+// variables of the activation are cleared, so that subprocesses do not take
+// the socket for theirs.
+func systemdListener() (net.Listener, error) {
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	return activationListener(pid, fds, listenFDsStart)
+}
+
+// activationListener returns the listener of the file descriptor fd if the
+// LISTEN_PID and LISTEN_FDS values pass sockets to this process
+func activationListener(pid, fds string, fd uintptr) (net.Listener, error) {
+	if pid == "" || fds == "" {
+		return nil, nil
+	}
+	if pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fds)
+	}
+	if n > 1 {
+		return nil, fmt.Errorf("systemd passed %d sockets, expected one", n)
+	}
+	f := os.NewFile(fd, "systemd-socket")
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("socket passed by systemd: %w", err)
+	}
+	return ln, nil
+}
+
+// sdNotify sends state, e.g. READY=1, to the service manager when the server
+// runs as a systemd service of Type=notify. It does nothing otherwise.
+func sdNotify(state string) error {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil
+	}
+	// Sockets in the abstract namespace start with @
+	if path[0] == '@' {
+		path = "\x00" + path[1:]
+	} else if path[0] != '/' {
+		return errors.New("invalid NOTIFY_SOCKET")
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
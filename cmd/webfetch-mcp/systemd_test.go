@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestActivationListener(t *testing.T) {
+	passed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer passed.Close()
+	f, err := passed.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	pid := strconv.Itoa(os.Getpid())
+
+	tests := []struct {
+		name        string
+		pid         string
+		fds         string
+		expectedNil bool
+		expectErr   bool
+	}{
+		{name: "not activated", expectedNil: true},
+		{name: "other process", pid: "1", fds: "1", expectedNil: true},
+		{name: "activated", pid: pid, fds: "1"},
+		{name: "several sockets", pid: pid, fds: "2", expectErr: true},
+		{name: "invalid count", pid: pid, fds: "x", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Each call takes ownership of a copy of the descriptor
+			dup, err := passed.(*net.TCPListener).File()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dup.Close()
+
+			ln, err := activationListener(tt.pid, tt.fds, dup.Fd())
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("expected error %v, got %v", tt.expectErr, err)
+			}
+			if tt.expectErr {
+				return
+			}
+			if (ln == nil) != tt.expectedNil {
+				t.Fatalf("expected nil listener %v, got %v", tt.expectedNil, ln)
+			}
+			if ln != nil {
+				defer ln.Close()
+				if ln.Addr().String() != passed.Addr().String() {
+					t.Errorf("expected listener on %s, got %s", passed.Addr(), ln.Addr())
+				}
+			}
+		})
+	}
+}
+
+func TestSdNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+	if err := sdNotify("READY=1"); err != nil {
+		t.Fatalf("sdNotify failed: %v", err)
+	}
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != "READY=1" {
+		t.Errorf("expected %q, got %q", "READY=1", got)
+	}
+
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := sdNotify("READY=1"); err != nil {
+		t.Errorf("expected no error without NOTIFY_SOCKET, got %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// serverTLSConfig returns the TLS configuration of the HTTP listener, or nil
+// to serve plain HTTP. With a client CA bundle, clients must present a
+// certificate issued by one of its CAs.
+func serverTLSConfig(cfg config) (*tls.Config, error) {
+	if cfg.tlsCertPath == "" && cfg.tlsKeyPath == "" {
+		if cfg.tlsClientCAPath != "" {
+			return nil, errors.New("-tls-client-ca requires -tls-cert and -tls-key")
+		}
+		return nil, nil
+	}
+	if cfg.tlsCertPath == "" || cfg.tlsKeyPath == "" {
+		return nil, errors.New("-tls-cert and -tls-key must be set together")
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.tlsCertPath, cfg.tlsKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if cfg.tlsClientCAPath != "" {
+		data, err := os.ReadFile(cfg.tlsClientCAPath)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificate found in %s", cfg.tlsClientCAPath)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// markdownLink matches an inline Markdown link or image, capturing its text
+var markdownLink = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+
+// tableOfContents returns a Markdown list linking to the ATX headings of
+// markdown, indented by level, or "" if it has none. Anchors follow the GitHub
+// convention: lowercase text without punctuation, spaces replaced by hyphens and
+// a -1, -2, ... suffix for duplicates.
+func tableOfContents(markdown string) string {
+	var sb strings.Builder
+	seen := make(map[string]int)
+	minLevel := 7
+	type heading struct {
+		level  int
+		text   string
+		anchor string
+	}
+	var headings []heading
+
+	fence := ""
+	for line := range strings.SplitSeq(markdown, "\n") {
+		trimmed := strings.TrimSpace(line)
+		// Skip fenced code blocks
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+
+		level := len(line) - len(strings.TrimLeft(line, "#"))
+		if level == 0 || level > 6 || !strings.HasPrefix(line[level:], " ") {
+			continue
+		}
+		text := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(line[level:]), "#"))
+		text = markdownLink.ReplaceAllString(text, "$1")
+		text = strings.NewReplacer("*", "", "`", "", "\\", "").Replace(text)
+		if text == "" {
+			continue
+		}
+
+		anchor := headingAnchor(text)
+		if n := seen[anchor]; n > 0 {
+			seen[anchor]++
+			anchor = fmt.Sprintf("%s-%d", anchor, n)
+		} else {
+			seen[anchor] = 1
+		}
+		headings = append(headings, heading{level: level, text: text, anchor: anchor})
+		minLevel = min(minLevel, level)
+	}
+
+	for _, h := range headings {
+		fmt.Fprintf(&sb, "%s- [%s](#%s)\n", strings.Repeat("  ", h.level-minLevel), h.text, h.anchor)
+	}
+	return sb.String()
+}
+
+// headingAnchor returns the GitHub anchor of a heading text
+func headingAnchor(text string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			sb.WriteRune(r)
+		case r == ' ':
+			sb.WriteByte('-')
+		}
+	}
+	return sb.String()
+}
+
+// withTableOfContents prepends a table of contents to markdown if it is at least
+// minLength characters long and has headings
+func withTableOfContents(markdown string, minLength int) string {
+	if minLength <= 0 || len([]rune(markdown)) < minLength {
+		return markdown
+	}
+	toc := tableOfContents(markdown)
+	if toc == "" {
+		return markdown
+	}
+	return "## Contents\n\n" + toc + "\n" + markdown
+}
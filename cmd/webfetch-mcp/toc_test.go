@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestTableOfContents(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		expected string
+	}{
+		{
+			name:     "no headings",
+			markdown: "Just text\n\nMore text",
+			expected: "",
+		},
+		{
+			name:     "nested levels",
+			markdown: "## Install\n\ntext\n\n### From *source*\n\n## Usage [docs](https://example.com)\n",
+			expected: "- [Install](#install)\n  - [From source](#from-source)\n- [Usage docs](#usage-docs)\n",
+		},
+		{
+			name:     "duplicates and punctuation",
+			markdown: "# What's new?\n\n# Notes\n\n# Notes\n",
+			expected: "- [What's new?](#whats-new)\n- [Notes](#notes)\n- [Notes](#notes-1)\n",
+		},
+		{
+			name:     "code blocks skipped",
+			markdown: "# Title\n\n```sh\n# not a heading\n```\n\n#hashtag\n",
+			expected: "- [Title](#title)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tableOfContents(tt.markdown); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestWithTableOfContents(t *testing.T) {
+	markdown := "# Title\n\nBody"
+
+	if got := withTableOfContents(markdown, 0); got != markdown {
+		t.Errorf("expected no table of contents when disabled, got %q", got)
+	}
+	if got := withTableOfContents(markdown, 100); got != markdown {
+		t.Errorf("expected no table of contents for short documents, got %q", got)
+	}
+	expected := "## Contents\n\n- [Title](#title)\n\n" + markdown
+	if got := withTableOfContents(markdown, 10); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
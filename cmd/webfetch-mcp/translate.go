@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// postProcessor transforms the Markdown of a page before it is returned by the
+// webfetch tool
+type postProcessor interface {
+	postProcess(ctx context.Context, input webfetchToolInput, markdown string) (string, error)
+}
+
+// translateBatchSize is the maximum number of text segments sent in one
+// translation request
+const translateBatchSize = 100
+
+// translateTimeout bounds each translation request
+const translateTimeout = 60 * time.Second
+
+// markdownVerbatim matches the parts of a Markdown line that are not translated:
+// the block markers at its start, inline code, link and image targets, bare
+// URLs and HTML tags
+var markdownVerbatim = regexp.MustCompile("^(?:\\s*(?:#{1,6}|[-*+>]|\\d+[.)]|\\|)\\s)+|`[^`]*`|\\]\\([^)]*\\)|<[^>]+>|https?://\\S+|[|*_~\\[\\]]+")
+
+// translator is a postProcessor translating Markdown with a LibreTranslate
+// compatible HTTP API into the language of webfetchToolInput.TranslateTo. Code
+// blocks, inline code and link targets are kept as is.
+type translator struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+func newTranslator(url, apiKey string) *translator {
+	return &translator{url: url, apiKey: apiKey, client: &http.Client{Timeout: translateTimeout}}
+}
+
+// markdownSegment is a part of a Markdown document that is translated or kept
+type markdownSegment struct {
+	text      string
+	translate bool
+}
+
+// splitMarkdown splits markdown into segments, marking the prose to translate
+func splitMarkdown(markdown string) []markdownSegment {
+	var segments []markdownSegment
+	keep := func(s string) {
+		if n := len(segments); n > 0 && !segments[n-1].translate {
+			segments[n-1].text += s
+		} else if s != "" {
+			segments = append(segments, markdownSegment{text: s})
+		}
+	}
+	prose := func(s string) {
+		// Whitespace and punctuation around the text are kept
+		start := strings.IndexFunc(s, isWordRune)
+		if start < 0 {
+			keep(s)
+			return
+		}
+		end := strings.LastIndexFunc(s, isWordRune) + 1
+		for end < len(s) && strings.ContainsRune(".,;:!?)\"'", rune(s[end])) {
+			end++
+		}
+		keep(s[:start])
+		segments = append(segments, markdownSegment{text: s[start:end], translate: true})
+		keep(s[end:])
+	}
+
+	fence := ""
+	lines := strings.SplitAfter(markdown, "\n")
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			keep(line)
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			keep(line)
+			continue
+		}
+
+		last := 0
+		for _, m := range markdownVerbatim.FindAllStringIndex(line, -1) {
+			prose(line[last:m[0]])
+			keep(line[m[0]:m[1]])
+			last = m[1]
+		}
+		prose(line[last:])
+	}
+	return segments
+}
+
+// isWordRune reports whether r is part of translatable text
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r)
+}
+
+func (tr *translator) postProcess(ctx context.Context, input webfetchToolInput, markdown string) (string, error) {
+	if input.TranslateTo == "" {
+		return markdown, nil
+	}
+
+	segments := splitMarkdown(markdown)
+	var texts []string
+	var indexes []int
+	for i, s := range segments {
+		if s.translate {
+			texts = append(texts, s.text)
+			indexes = append(indexes, i)
+		}
+	}
+
+	for start := 0; start < len(texts); start += translateBatchSize {
+		end := min(start+translateBatchSize, len(texts))
+		translated, err := tr.translate(ctx, texts[start:end], input.TranslateTo)
+		if err != nil {
+			return "", err
+		}
+		for i, text := range translated {
+			segments[indexes[start+i]].text = text
+		}
+	}
+
+	var sb strings.Builder
+	for _, s := range segments {
+		sb.WriteString(s.text)
+	}
+	return sb.String(), nil
+}
+
+// translateRequest is the body of a LibreTranslate /translate request
+type translateRequest struct {
+	Q      []string `json:"q"`
+	Source string   `json:"source"`
+	Target string   `json:"target"`
+	Format string   `json:"format"`
+	APIKey string   `json:"api_key,omitempty"`
+}
+
+type translateResponse struct {
+	TranslatedText []string `json:"translatedText"`
+	Error          string   `json:"error"`
+}
+
+// translate translates texts into target
+func (tr *translator) translate(ctx context.Context, texts []string, target string) ([]string, error) {
+	body, err := json.Marshal(translateRequest{Q: texts, Source: "auto", Target: target, Format: "text", APIKey: tr.apiKey})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tr.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("translation failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := tr.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("translation failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result translateResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 10<<20)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("translation failed: status %d: invalid response: %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("translation failed: status %d: %s", resp.StatusCode, result.Error)
+	}
+	if len(result.TranslatedText) != len(texts) {
+		return nil, fmt.Errorf("translation failed: expected %d texts, got %d", len(texts), len(result.TranslatedText))
+	}
+	return result.TranslatedText, nil
+}
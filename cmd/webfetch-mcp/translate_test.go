@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestSplitMarkdown(t *testing.T) {
+	markdown := "## Getting started\n\nRun `go build` and see [the docs](https://go.dev/doc).\n\n```go\n// not translated\n```\n- **Fast** builds\n"
+
+	var translated []string
+	var sb strings.Builder
+	for _, s := range splitMarkdown(markdown) {
+		if s.translate {
+			translated = append(translated, s.text)
+		}
+		sb.WriteString(s.text)
+	}
+
+	if sb.String() != markdown {
+		t.Errorf("expected segments to join into the input, got %q", sb.String())
+	}
+	expected := []string{"Getting started", "Run", "and see", "the docs", "Fast", "builds"}
+	if strings.Join(translated, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected translated segments %q, got %q", expected, translated)
+	}
+}
+
+func TestWebfetchTool_TranslateTo(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<h1>Hello world</h1><p>Read <a href="https://example.com/guide">the guide</a>, then run <code>make</code>.</p>`))
+	}))
+	defer site.Close()
+
+	// The fake translation API upper-cases texts
+	var target string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req translateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid translation request: %v", err)
+		}
+		target = req.Target
+		var resp translateResponse
+		for _, q := range req.Q {
+			resp.TranslatedText = append(resp.TranslatedText, strings.ToUpper(q))
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer api.Close()
+
+	tests := []struct {
+		name     string
+		cfg      config
+		expected string
+		isError  bool
+	}{
+		{
+			name:     "translated",
+			cfg:      config{translateURL: api.URL},
+			expected: "# HELLO WORLD\n\nREAD [THE GUIDE](https://example.com/guide), THEN RUN `make`.",
+		},
+		{
+			name:     "not configured",
+			expected: "translation is not configured on this server",
+			isError:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := connectTestClient(t, setupMCPServer(tt.cfg))
+			res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+				Name:      "webfetch",
+				Arguments: map[string]any{"url": site.URL, "translate_to": "de"},
+			})
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+			text := res.Content[0].(*mcp.TextContent).Text
+			if res.IsError != tt.isError || text != tt.expected {
+				t.Errorf("expected %q (error %t), got %q (error %t)", tt.expected, tt.isError, text, res.IsError)
+			}
+		})
+	}
+	if target != "de" {
+		t.Errorf("expected target language de, got %q", target)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// typographyReplacer maps typographic characters to plain ASCII equivalents
+var typographyReplacer = strings.NewReplacer(
+	// Quotes and primes
+	"‘", "'", "’", "'", "‚", "'", "‛", "'", "′", "'",
+	"“", `"`, "”", `"`, "„", `"`, "‟", `"`, "″", `"`,
+	"«", `"`, "»", `"`,
+	// Dashes and hyphens
+	"‐", "-", "‑", "-", "‒", "-", "–", "-", "−", "-",
+	"—", "--", "―", "--",
+	// Ellipsis
+	"…", "...",
+	// Non-breaking, narrow, figure, thin and hair spaces
+	"\u00a0", " ", "\u202f", " ", "\u2007", " ", "\u2009", " ", "\u200a", " ",
+	// Zero-width spaces, soft hyphens and byte order marks
+	"\u200b", "", "\u00ad", "", "\ufeff", "",
+)
+
+// normalizeTypography replaces smart quotes, dashes, ellipses and special spaces
+// in s with plain ASCII, and drops zero-width spaces and soft hyphens
+func normalizeTypography(s string) string {
+	return typographyReplacer.Replace(s)
+}
+
+// Unicode normalization forms accepted by the unicode_normalization parameter
+const (
+	normalizationNFC  = "nfc"
+	normalizationNFKC = "nfkc"
+)
+
+// normalizeUnicode applies the normalization form to s: NFC composes characters,
+// NFKC also replaces compatibility characters such as ligatures and fullwidth
+// forms. An empty form leaves s unchanged.
+func normalizeUnicode(s, form string) (string, error) {
+	switch strings.ToLower(form) {
+	case "":
+		return s, nil
+	case normalizationNFC:
+		return norm.NFC.String(s), nil
+	case normalizationNFKC:
+		return norm.NFKC.String(s), nil
+	}
+	return "", fmt.Errorf("unknown unicode_normalization: %s (expected nfc or nfkc)", form)
+}
@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestNormalizeTypography(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "plain text", expected: "plain text"},
+		{input: "“Quoted” and ‘single’ it’s", expected: `"Quoted" and 'single' it's`},
+		{input: "1990–1999 — a decade", expected: "1990-1999 -- a decade"},
+		{input: "Wait…", expected: "Wait..."},
+		{input: "10\u00a0km\u202f/\u2009h", expected: "10 km / h"},
+		{input: "hy\u00adphen\u200bated", expected: "hyphenated"},
+		{input: "café à la carte", expected: "café à la carte"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := normalizeTypography(tt.input); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNormalizeUnicode(t *testing.T) {
+	// "e" followed by a combining acute accent, a "fi" ligature and a fullwidth "Ａ"
+	input := "cafe\u0301 \ufb01le \uff21"
+
+	tests := []struct {
+		form     string
+		expected string
+		err      bool
+	}{
+		{form: "", expected: input},
+		{form: "nfc", expected: "caf\u00e9 \ufb01le \uff21"},
+		{form: "NFKC", expected: "café file A"},
+		{form: "nfd", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.form, func(t *testing.T) {
+			got, err := normalizeUnicode(input, tt.form)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %t, got %v", tt.err, err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// warmConcurrency is the number of pages fetched at once when warming the cache
+const warmConcurrency = 4
+
+// cacheWarmFailure is a URL that could not be fetched into the cache
+type cacheWarmFailure struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+// warmCache fetches urls into the cache of the session of req, and returns the
+// number of pages fetched and the URLs that failed, in the order of urls
+func (t *tools) warmCache(ctx context.Context, req *mcp.CallToolRequest, urls []string) (int, []cacheWarmFailure) {
+	timeout, _ := t.resolveTimeout("")
+	errs := make([]string, len(urls))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, warmConcurrency)
+	for i, rawURL := range urls {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if result := t.checkPolicy(ctx, req, "webfetch_cache", rawURL); result != nil {
+				errs[i] = result.Content[0].(*mcp.TextContent).Text
+				return
+			}
+			opts := t.fetchOptions(ctx, req, "webfetch_cache", timeout)
+			opts.Accept = t.cfg.acceptTypes(rawURL)
+			if _, err := webfetch.Fetch(ctx, rawURL, opts); err != nil {
+				errs[i] = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var failures []cacheWarmFailure
+	for i, err := range errs {
+		if err != "" {
+			failures = append(failures, cacheWarmFailure{URL: urls[i], Error: err})
+		}
+	}
+	return len(urls) - len(failures), failures
+}
+
+// warmCacheAtStartup warms the shared cache with urls, logging the outcome to w
+func (t *tools) warmCacheAtStartup(urls []string, w io.Writer) {
+	logger := slog.New(slog.NewJSONHandler(w, nil))
+	warmed, failures := t.warmCache(context.Background(), nil, urls)
+	for _, f := range failures {
+		logger.Warn("cache warm-up failed", "url", f.URL, "error", f.Error)
+	}
+	logger.Info("cache warm-up done", "warmed", warmed, "failed", len(failures))
+}
+
+// readURLList reads the URLs listed in the file at path, one per line. Blank
+// lines and lines starting with # are ignored.
+func readURLList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var urls []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			urls = append(urls, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return urls, nil
+}
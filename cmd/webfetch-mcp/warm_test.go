@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// lineWriter sends each write to a channel
+type lineWriter chan string
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func newWarmTestSite(hits *atomic.Int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<p>Page ` + r.URL.Path + `</p>`))
+	}))
+}
+
+func TestCacheTool_Warm(t *testing.T) {
+	var hits atomic.Int64
+	site := newWarmTestSite(&hits)
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{cacheTTL: time.Minute}))
+	ctx := context.Background()
+
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "webfetch_cache", Arguments: map[string]any{
+		"action": "warm",
+		"urls":   []string{site.URL + "/a", site.URL + "/missing", site.URL + "/b"},
+	}})
+	if err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	var output cacheToolOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &output); err != nil {
+		t.Fatalf("failed to decode output: %v", err)
+	}
+	if output.Warmed != 2 || len(output.Failed) != 1 || output.Failed[0].URL != site.URL+"/missing" {
+		t.Errorf("expected 2 pages warmed and /missing failed, got %+v", output)
+	}
+
+	if _, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "webfetch", Arguments: map[string]any{"url": site.URL + "/b"}}); err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if hits.Load() != 3 {
+		t.Errorf("expected the warmed page to be served from cache, got %d requests", hits.Load())
+	}
+}
+
+func TestCacheWarmAtStartup(t *testing.T) {
+	var hits atomic.Int64
+	site := newWarmTestSite(&hits)
+	defer site.Close()
+
+	path := filepath.Join(t.TempDir(), "urls.txt")
+	list := "# Docs\n" + site.URL + "/a\n\n" + site.URL + "/missing\n"
+	if err := os.WriteFile(path, []byte(list), 0o644); err != nil {
+		t.Fatalf("failed to write URL list: %v", err)
+	}
+	urls, err := readURLList(path)
+	if err != nil || len(urls) != 2 {
+		t.Fatalf("expected 2 URLs, got %v, %v", urls, err)
+	}
+
+	logs := make(lineWriter, 10)
+	session := connectTestClient(t, setupMCPServer(config{cacheTTL: time.Minute, cacheWarmURLs: urls, logOutput: logs}))
+
+	var lines []string
+	for line := range logs {
+		lines = append(lines, line)
+		if strings.Contains(line, "cache warm-up done") {
+			break
+		}
+	}
+	if !strings.Contains(strings.Join(lines, ""), `"url":"`+site.URL+`/missing"`) || !strings.Contains(lines[len(lines)-1], `"warmed":1`) {
+		t.Errorf("unexpected warm-up logs: %q", lines)
+	}
+
+	if _, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "webfetch", Arguments: map[string]any{"url": site.URL + "/a"}}); err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("expected the warmed page to be served from cache, got %d requests", hits.Load())
+	}
+}
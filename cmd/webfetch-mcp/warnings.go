@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/benoute/webfetch"
+)
+
+// fetchWarnings logs fetches that are slower or larger than the operator thresholds
+type fetchWarnings struct {
+	logger *slog.Logger
+	// slow is the fetch duration above which a warning is logged; 0 disables it
+	slow time.Duration
+	// large is the converted content size above which a warning is logged; 0 disables it
+	large int
+}
+
+// check logs a warning with the timing breakdown if info exceeds a threshold
+func (w *fetchWarnings) check(session, requestID, tool string, info webfetch.FetchInfo) {
+	if info.Cached {
+		return
+	}
+
+	var reasons []string
+	if w.slow > 0 && info.Duration > w.slow {
+		reasons = append(reasons, "slow")
+	}
+	if w.large > 0 && info.ContentSize > w.large {
+		reasons = append(reasons, "large")
+	}
+	if len(reasons) == 0 {
+		return
+	}
+
+	host := ""
+	if u, err := url.Parse(info.URL); err == nil {
+		host = u.Host
+	}
+
+	w.logger.LogAttrs(context.Background(), slog.LevelWarn, "fetch exceeded threshold",
+		slog.Any("reasons", reasons),
+		slog.String("session", session),
+		slog.String("request_id", requestID),
+		slog.String("tool", tool),
+		slog.String("host", host),
+		slog.Int("status", info.StatusCode),
+		slog.Int64("bytes", info.Bytes),
+		slog.Int("content_size", info.ContentSize),
+		slog.Group("timings_ms",
+			slog.Float64("total", milliseconds(info.Duration)),
+			slog.Float64("dns", milliseconds(info.Timings.DNS)),
+			slog.Float64("connect", milliseconds(info.Timings.Connect)),
+			slog.Float64("tls", milliseconds(info.Timings.TLS)),
+			slog.Float64("ttfb", milliseconds(info.Timings.TTFB)),
+			slog.Float64("read", milliseconds(info.Timings.Read)),
+			slog.Float64("convert", milliseconds(info.Timings.Convert)),
+		),
+	)
+}
+
+// milliseconds converts d to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
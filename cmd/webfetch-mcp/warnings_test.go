@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/benoute/webfetch"
+)
+
+func TestFetchWarnings(t *testing.T) {
+	tests := []struct {
+		name            string
+		info            webfetch.FetchInfo
+		expectedReasons []any
+	}{
+		{
+			name: "fast and small",
+			info: webfetch.FetchInfo{Duration: time.Second, ContentSize: 100},
+		},
+		{
+			name:            "slow",
+			info:            webfetch.FetchInfo{Duration: 3 * time.Second, ContentSize: 100},
+			expectedReasons: []any{"slow"},
+		},
+		{
+			name:            "slow and large",
+			info:            webfetch.FetchInfo{Duration: 3 * time.Second, ContentSize: 5000},
+			expectedReasons: []any{"slow", "large"},
+		},
+		{
+			name: "cached",
+			info: webfetch.FetchInfo{Duration: 3 * time.Second, ContentSize: 5000, Cached: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := &fetchWarnings{
+				logger: slog.New(slog.NewJSONHandler(&buf, nil)),
+				slow:   2 * time.Second,
+				large:  1000,
+			}
+
+			tt.info.URL = "https://example.com/page"
+			tt.info.Timings.TTFB = 1500 * time.Millisecond
+			w.check("session", "req", "webfetch", tt.info)
+
+			if tt.expectedReasons == nil {
+				if buf.Len() != 0 {
+					t.Errorf("expected no warning, got %s", buf.String())
+				}
+				return
+			}
+
+			var record struct {
+				Level   string
+				Reasons []any
+				Host    string
+				Timings map[string]float64 `json:"timings_ms"`
+			}
+			if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+				t.Fatalf("failed to decode warning %q: %v", buf.String(), err)
+			}
+			if record.Level != "WARN" || record.Host != "example.com" {
+				t.Errorf("unexpected warning: %s", buf.String())
+			}
+			if len(record.Reasons) != len(tt.expectedReasons) || record.Reasons[0] != tt.expectedReasons[0] {
+				t.Errorf("expected reasons %v, got %v", tt.expectedReasons, record.Reasons)
+			}
+			if record.Timings["ttfb"] != 1500 {
+				t.Errorf("expected ttfb 1500ms, got %v", record.Timings["ttfb"])
+			}
+		})
+	}
+}
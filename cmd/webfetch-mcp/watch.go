@@ -0,0 +1,471 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/benoute/webfetch"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	defaultMaxWatches       = 10
+	defaultWatchInterval    = 15 * time.Minute
+	defaultWatchMinInterval = time.Minute
+	// maxWatchChanges is the number of changes remembered per session
+	maxWatchChanges = 100
+	// maxWatchDiffSize bounds the diff of each change, in bytes
+	maxWatchDiffSize = 10000
+)
+
+// watch is a page re-fetched periodically on behalf of a session
+type watch struct {
+	// id is random, keeping the resource URIs of other sessions unknown
+	id string
+	// order is the rank of the watch among those added
+	order    int
+	session  string
+	url      string
+	uri      string
+	interval time.Duration
+	// check fetches the page and returns its Markdown
+	check func(ctx context.Context) (string, error)
+	stop  context.CancelFunc
+
+	// The state of the page, guarded by watches.mu
+	content   string
+	checkedAt time.Time
+	changedAt time.Time
+	err       string
+}
+
+// watchInfo describes a watch in the output of the webfetch_watch tool
+type watchInfo struct {
+	ID        string `json:"id"`
+	URL       string `json:"url"`
+	URI       string `json:"uri"`
+	Interval  string `json:"interval"`
+	CheckedAt string `json:"checked_at,omitempty"`
+	ChangedAt string `json:"changed_at,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// watchChange records a change of a watched page
+type watchChange struct {
+	Seq          int64     `json:"seq"`
+	WatchID      string    `json:"watch_id"`
+	URL          string    `json:"url"`
+	URI          string    `json:"uri"`
+	Time         time.Time `json:"time"`
+	AddedLines   int       `json:"added_lines"`
+	RemovedLines int       `json:"removed_lines"`
+	Diff         string    `json:"diff"`
+}
+
+// watches keeps the watches of each session and the changes they found. It is
+// safe for concurrent use.
+type watches struct {
+	// maxPerSession bounds the watches of each session when positive
+	maxPerSession int
+
+	mu        sync.Mutex
+	lastOrder int
+	lastSeq   int64
+	byID      map[string]*watch
+	changes   map[string][]watchChange
+	// attached holds the sessions whose end removes their watches
+	attached map[string]bool
+}
+
+func newWatches(maxPerSession int) *watches {
+	return &watches{
+		maxPerSession: maxPerSession,
+		byID:          make(map[string]*watch),
+		changes:       make(map[string][]watchChange),
+		attached:      make(map[string]bool),
+	}
+}
+
+// add registers w, with the content of its first check, giving it an ID and
+// resource URI. It returns an error when the session of w has too many watches.
+func (ws *watches) add(w *watch, content string) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.maxPerSession > 0 && len(ws.sessionWatches(w.session)) >= ws.maxPerSession {
+		return fmt.Errorf("too many watches: at most %d per session", ws.maxPerSession)
+	}
+	ws.lastOrder++
+	w.order = ws.lastOrder
+	w.id = rand.Text()
+	w.uri = "webfetch://watch/" + w.id
+	w.content = content
+	w.checkedAt = time.Now()
+	ws.byID[w.id] = w
+	return nil
+}
+
+// attach reports whether the end of session must be awaited to remove its
+// watches, i.e. on its first watch
+func (ws *watches) attach(session string) bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.attached[session] {
+		return false
+	}
+	ws.attached[session] = true
+	return true
+}
+
+// sessionWatches returns the watches of session in the order they were added.
+// ws.mu must be held.
+func (ws *watches) sessionWatches(session string) []*watch {
+	var list []*watch
+	for _, w := range ws.byID {
+		if w.session == session {
+			list = append(list, w)
+		}
+	}
+	slices.SortFunc(list, func(a, b *watch) int { return a.order - b.order })
+	return list
+}
+
+// remove stops and drops the watch id of session, returning it, or nil if
+// there is none
+func (ws *watches) remove(session, id string) *watch {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	w := ws.byID[id]
+	if w == nil || w.session != session {
+		return nil
+	}
+	w.stop()
+	delete(ws.byID, id)
+	return w
+}
+
+// removeSession stops and drops the watches and changes of session
+func (ws *watches) removeSession(session string) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for _, w := range ws.sessionWatches(session) {
+		w.stop()
+		delete(ws.byID, w.id)
+	}
+	delete(ws.changes, session)
+	delete(ws.attached, session)
+}
+
+// list describes the watches of session
+func (ws *watches) list(session string) []watchInfo {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	var infos []watchInfo
+	for _, w := range ws.sessionWatches(session) {
+		infos = append(infos, w.info())
+	}
+	return infos
+}
+
+// info describes w. watches.mu must be held.
+func (w *watch) info() watchInfo {
+	return watchInfo{
+		ID:        w.id,
+		URL:       webfetch.StripUserinfo(w.url),
+		URI:       w.uri,
+		Interval:  w.interval.String(),
+		CheckedAt: formatFetchedAt(w.checkedAt),
+		ChangedAt: formatFetchedAt(w.changedAt),
+		Error:     w.err,
+	}
+}
+
+// byURI returns the watch of session whose resource is uri, or nil: the
+// watches of other sessions are not found
+func (ws *watches) byURI(session, uri string) *watch {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for _, w := range ws.byID {
+		if w.uri == uri && w.session == session {
+			return w
+		}
+	}
+	return nil
+}
+
+// content returns the Markdown of the last version of the page of w
+func (ws *watches) content(w *watch) string {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	return w.content
+}
+
+// update records the outcome of a check of w, and returns whether the page
+// changed
+func (ws *watches) update(w *watch, content string, err error) bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.byID[w.id] != w {
+		// Removed during the check
+		return false
+	}
+	w.checkedAt = time.Now()
+	if err != nil {
+		w.err = err.Error()
+		return false
+	}
+	w.err = ""
+	if content == w.content {
+		return false
+	}
+
+	ops := diffLines(w.content, content)
+	diff := formatDiff(ops, diffModeUnified, diffContextLines)
+	if len(diff) > maxWatchDiffSize {
+		diff = diff[:maxWatchDiffSize] + "\n... (truncated)"
+	}
+	ws.lastSeq++
+	change := watchChange{Seq: ws.lastSeq, WatchID: w.id, URL: webfetch.StripUserinfo(w.url), URI: w.uri, Time: w.checkedAt, Diff: diff}
+	for _, op := range ops {
+		switch op.kind {
+		case '+':
+			change.AddedLines++
+		case '-':
+			change.RemovedLines++
+		}
+	}
+	changes := append(ws.changes[w.session], change)
+	if len(changes) > maxWatchChanges {
+		changes = changes[len(changes)-maxWatchChanges:]
+	}
+	ws.changes[w.session] = changes
+	w.content = content
+	w.changedAt = w.checkedAt
+	return true
+}
+
+// changesSince returns the changes found for session after the change seq,
+// oldest first
+func (ws *watches) changesSince(session string, seq int64) []watchChange {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	changes := []watchChange{}
+	for _, change := range ws.changes[session] {
+		if change.Seq > seq {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// subscribe accepts subscriptions of sessions to the resources of their own
+// watches, for mcp.ServerOptions.SubscribeHandler
+func (ws *watches) subscribe(ctx context.Context, req *mcp.SubscribeRequest) error {
+	if ws.byURI(serverSessionID(req.Session), req.Params.URI) == nil {
+		return fmt.Errorf("unknown watch resource: %s", req.Params.URI)
+	}
+	return nil
+}
+
+func (ws *watches) unsubscribe(ctx context.Context, req *mcp.UnsubscribeRequest) error {
+	if ws.byURI(serverSessionID(req.Session), req.Params.URI) == nil {
+		return fmt.Errorf("unknown watch resource: %s", req.Params.URI)
+	}
+	return nil
+}
+
+type watchToolInput struct {
+	Action   string `json:"action" jsonschema:"One of: add (start watching a URL), remove (stop a watch), list (show the watches of this session)"`
+	URL      string `json:"url,omitempty" jsonschema:"URL to watch (add action)"`
+	Interval string `json:"interval,omitempty" jsonschema:"Time between checks, e.g. 1h, at least the server minimum (add action, default: 15m)"`
+	Selector string `json:"selector,omitempty" jsonschema:"CSS selector restricting the watched content to the matching elements, e.g. #content (add action)"`
+	ID       string `json:"id,omitempty" jsonschema:"ID of the watch to remove (remove action)"`
+}
+
+type watchToolOutput struct {
+	Watches []watchInfo `json:"watches,omitempty"`
+}
+
+type changesToolInput struct {
+	Since int64 `json:"since,omitempty" jsonschema:"Only return changes after this seq, the last_seq of the previous call (default: all)"`
+}
+
+type changesToolOutput struct {
+	Changes []watchChange `json:"changes"`
+	// LastSeq is the seq to pass as since to get the next changes
+	LastSeq int64 `json:"last_seq"`
+}
+
+// addWatchTools registers the webfetch_watch and webfetch_changes tools on the server
+func (t *tools) addWatchTools() {
+	mcp.AddTool(t.server, &mcp.Tool{
+		Name: t.cfg.toolName("webfetch_watch"),
+		Description: "Watches pages for changes: the server re-fetches each watched URL periodically. " +
+			"Each watch is a resource with the current Markdown of the page; subscribe to it to be notified of changes, " +
+			"or poll " + t.cfg.toolName("webfetch_changes") + " for the diffs.",
+	}, func(
+		ctx context.Context,
+		req *mcp.CallToolRequest,
+		input watchToolInput,
+	) (*mcp.CallToolResult, watchToolOutput, error) {
+		return t.handleWatch(ctx, req, input)
+	})
+
+	mcp.AddTool(t.server, &mcp.Tool{
+		Name:        t.cfg.toolName("webfetch_changes"),
+		Description: "Lists the changes found on the pages watched with " + t.cfg.toolName("webfetch_watch") + ", as unified diffs of their Markdown.",
+	}, func(
+		ctx context.Context,
+		req *mcp.CallToolRequest,
+		input changesToolInput,
+	) (*mcp.CallToolResult, changesToolOutput, error) {
+		output := changesToolOutput{Changes: t.watches.changesSince(sessionID(req), input.Since), LastSeq: input.Since}
+		if n := len(output.Changes); n > 0 {
+			output.LastSeq = output.Changes[n-1].Seq
+		}
+		return nil, output, nil
+	})
+
+	// Each session may only read its own watches, which are not listed
+	t.server.AddResourceTemplate(&mcp.ResourceTemplate{
+		URITemplate: "webfetch://watch/{id}",
+		Name:        "watch",
+		Description: "Current Markdown of the pages watched with " + t.cfg.toolName("webfetch_watch") + ", readable by the session that watches them",
+		MIMEType:    "text/markdown",
+	}, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+		w := t.watches.byURI(serverSessionID(req.Session), req.Params.URI)
+		if w == nil {
+			return nil, mcp.ResourceNotFoundError(req.Params.URI)
+		}
+		return &mcp.ReadResourceResult{
+			Contents: []*mcp.ResourceContents{
+				{URI: w.uri, MIMEType: "text/markdown", Text: t.watches.content(w)},
+			},
+		}, nil
+	})
+}
+
+func (t *tools) handleWatch(ctx context.Context, req *mcp.CallToolRequest, input watchToolInput) (
+	*mcp.CallToolResult,
+	watchToolOutput,
+	error,
+) {
+	session := sessionID(req)
+	switch input.Action {
+	case "list":
+		return nil, watchToolOutput{Watches: t.watches.list(session)}, nil
+	case "remove":
+		w := t.watches.remove(session, input.ID)
+		if w == nil {
+			return toolError("unknown watch: " + input.ID), watchToolOutput{}, nil
+		}
+		return nil, watchToolOutput{Watches: t.watches.list(session)}, nil
+	case "add":
+	default:
+		return toolError("unknown action: " + input.Action + " (expected add, remove or list)"), watchToolOutput{}, nil
+	}
+
+	if input.URL == "" {
+		return toolError("url is required"), watchToolOutput{}, nil
+	}
+	minInterval := t.cfg.watchMinInterval
+	if minInterval <= 0 {
+		minInterval = defaultWatchMinInterval
+	}
+	interval := max(defaultWatchInterval, minInterval)
+	if input.Interval != "" {
+		parsed, err := time.ParseDuration(input.Interval)
+		if err != nil {
+			return toolError("invalid interval format: " + err.Error()), watchToolOutput{}, nil
+		}
+		interval = max(parsed, minInterval)
+	}
+	if result := t.checkPolicy(ctx, req, "webfetch_watch", input.URL); result != nil {
+		return result, watchToolOutput{}, nil
+	}
+
+	timeout, _ := t.resolveTimeout("")
+	w := &watch{session: session, url: input.URL, interval: interval}
+	w.check = func(ctx context.Context) (string, error) {
+		// The fetch is logged with the request ID of ctx
+		opts := t.fetchOptions(ctx, req, "webfetch_watch", timeout)
+		opts.Accept = t.cfg.acceptTypes(w.url)
+		opts.Selector = input.Selector
+		// Checks must see the live page
+		opts.CacheMode = webfetch.CacheBypass
+		doc, err := webfetch.Fetch(ctx, w.url, opts)
+		if err != nil {
+			return "", err
+		}
+		if t.noarchive != nil {
+			if err := t.noarchive.check(session, opts.RequestID, "webfetch_watch", doc); err != nil {
+				return "", err
+			}
+		}
+		if t.pii != nil {
+			return t.pii.scrub(doc.Content), nil
+		}
+		return doc.Content, nil
+	}
+
+	content, err := w.check(ctx)
+	if err != nil {
+		result := fetchError(err)
+		t.recordFetch(ctx, req, "webfetch_watch", input.URL, result, nil)
+		return result, watchToolOutput{}, nil
+	}
+	t.recordFetch(ctx, req, "webfetch_watch", input.URL, nil, &webfetch.Document{Content: content})
+	watchCtx, stop := context.WithCancel(context.Background())
+	w.stop = stop
+	if err := t.watches.add(w, content); err != nil {
+		stop()
+		return toolError(err.Error()), watchToolOutput{}, nil
+	}
+
+	go t.runWatch(watchCtx, w)
+
+	// Watches end with their session
+	if req.Session != nil && t.watches.attach(session) {
+		go func() {
+			req.Session.Wait()
+			t.watches.removeSession(session)
+		}()
+	}
+
+	return nil, watchToolOutput{Watches: t.watches.list(session)}, nil
+}
+
+// runWatch checks the page of w at its interval until ctx is done, notifying
+// the subscribers of its resource of changes
+func (t *tools) runWatch(ctx context.Context, w *watch) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// Each check is a request of its own in the logs, not part of the
+		// tool call that added the watch
+		content, err := w.check(context.WithValue(ctx, requestIDKey{}, newRequestID()))
+		if ctx.Err() != nil {
+			return
+		}
+		if t.watches.update(w, content, err) {
+			t.server.ResourceUpdated(ctx, &mcp.ResourceUpdatedNotificationParams{URI: w.uri})
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestWatchTools(t *testing.T) {
+	var version atomic.Int64
+	version.Store(1)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<h1>Status</h1><p>Version %d</p>", version.Load())
+	}))
+	defer site.Close()
+
+	ctx := context.Background()
+	server := setupMCPServer(config{watchMinInterval: time.Millisecond})
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := server.Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatalf("failed to connect server: %v", err)
+	}
+	updated := make(chan string, 10)
+	client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "v1.0.0"}, &mcp.ClientOptions{
+		ResourceUpdatedHandler: func(ctx context.Context, req *mcp.ResourceUpdatedNotificationRequest) {
+			updated <- req.Params.URI
+		},
+	})
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect client: %v", err)
+	}
+	defer session.Close()
+	call := func(name string, args map[string]any, output any) {
+		t.Helper()
+		res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+		if err != nil {
+			t.Fatalf("CallTool %s failed: %v", name, err)
+		}
+		if res.IsError {
+			t.Fatalf("unexpected error: %+v", res.Content)
+		}
+		data, _ := json.Marshal(res.StructuredContent)
+		json.Unmarshal(data, output)
+	}
+
+	var watched watchToolOutput
+	call("webfetch_watch", map[string]any{"action": "add", "url": site.URL, "interval": "10ms"}, &watched)
+	if len(watched.Watches) != 1 || watched.Watches[0].URL != site.URL || watched.Watches[0].Interval != "10ms" {
+		t.Fatalf("expected the watch of %s, got %+v", site.URL, watched.Watches)
+	}
+	uri := watched.Watches[0].URI
+	if err := session.Subscribe(ctx, &mcp.SubscribeParams{URI: uri}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := session.Subscribe(ctx, &mcp.SubscribeParams{URI: "webfetch://watch/UNKNOWN"}); err == nil {
+		t.Error("expected an error subscribing to an unknown watch")
+	}
+
+	version.Store(2)
+	select {
+	case got := <-updated:
+		if got != uri {
+			t.Errorf("expected update of %s, got %s", uri, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a resource update notification")
+	}
+
+	read, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri})
+	if err != nil {
+		t.Fatalf("ReadResource failed: %v", err)
+	}
+	if text := read.Contents[0].Text; !strings.Contains(text, "Version 2") {
+		t.Errorf("expected the current version, got %q", text)
+	}
+
+	var changes changesToolOutput
+	call("webfetch_changes", nil, &changes)
+	if len(changes.Changes) != 1 || changes.LastSeq != changes.Changes[0].Seq {
+		t.Fatalf("expected one change, got %+v", changes)
+	}
+	if change := changes.Changes[0]; change.AddedLines != 1 || change.RemovedLines != 1 || !strings.Contains(change.Diff, "-Version 1\n+Version 2\n") {
+		t.Errorf("expected the diff of the version, got %+v", change)
+	}
+	var next changesToolOutput
+	call("webfetch_changes", map[string]any{"since": changes.LastSeq}, &next)
+	if len(next.Changes) != 0 || next.LastSeq != changes.LastSeq {
+		t.Errorf("expected no new change, got %+v", next)
+	}
+
+	var remaining watchToolOutput
+	call("webfetch_watch", map[string]any{"action": "remove", "id": watched.Watches[0].ID}, &remaining)
+	if len(remaining.Watches) != 0 {
+		t.Errorf("expected no watch left, got %+v", remaining.Watches)
+	}
+	if _, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri}); err == nil {
+		t.Error("expected the resource of the removed watch to be gone")
+	}
+}
+
+func TestWatchTool_Limits(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Hello</p>"))
+	}))
+	defer site.Close()
+
+	session := connectTestClient(t, setupMCPServer(config{maxWatches: 1}))
+	add := func(args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		args["action"] = "add"
+		res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "webfetch_watch", Arguments: args})
+		if err != nil {
+			t.Fatalf("CallTool failed: %v", err)
+		}
+		return res
+	}
+
+	// The interval is raised to the server minimum
+	res := add(map[string]any{"url": site.URL, "interval": "1s"})
+	var output watchToolOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	json.Unmarshal(data, &output)
+	if res.IsError || len(output.Watches) != 1 || output.Watches[0].Interval != defaultWatchMinInterval.String() {
+		t.Errorf("expected a watch every %v, got %+v", defaultWatchMinInterval, res.Content)
+	}
+
+	tests := []struct {
+		name     string
+		args     map[string]any
+		expected string
+	}{
+		{name: "too many watches", args: map[string]any{"url": site.URL}, expected: "too many watches"},
+		{name: "invalid interval", args: map[string]any{"url": site.URL, "interval": "often"}, expected: "invalid interval"},
+		{name: "fetch error", args: map[string]any{"url": site.URL + "/missing"}, expected: "unexpected status code: 404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := add(tt.args)
+			if text := res.Content[0].(*mcp.TextContent).Text; !res.IsError || !strings.Contains(text, tt.expected) {
+				t.Errorf("expected error %q, got %q", tt.expected, text)
+			}
+		})
+	}
+}
+
+func TestWatchTool_SessionIsolation(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Private status</p>"))
+	}))
+	defer site.Close()
+
+	server := setupMCPServer(config{})
+	watching := connectHTTPTestClient(t, server)
+	other := connectHTTPTestClient(t, server)
+	ctx := context.Background()
+
+	res, err := watching.CallTool(ctx, &mcp.CallToolParams{Name: "webfetch_watch", Arguments: map[string]any{"action": "add", "url": site.URL}})
+	if err != nil || res.IsError {
+		t.Fatalf("unexpected error: %v %+v", err, res)
+	}
+	var output watchToolOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	json.Unmarshal(data, &output)
+	uri := output.Watches[0].URI
+	if !regexp.MustCompile(`^webfetch://watch/[A-Z2-7]{26}$`).MatchString(uri) {
+		t.Errorf("expected a random watch ID, got %s", uri)
+	}
+
+	// Only the watching session may read and subscribe to the watch
+	if read, err := watching.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri}); err != nil || read.Contents[0].Text != "Private status" {
+		t.Errorf("expected the watched page, got %+v (%v)", read, err)
+	}
+	if err := watching.Subscribe(ctx, &mcp.SubscribeParams{URI: uri}); err != nil {
+		t.Errorf("Subscribe failed: %v", err)
+	}
+	if _, err := other.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri}); err == nil {
+		t.Error("expected the watch of another session not to be found")
+	}
+	if err := other.Subscribe(ctx, &mcp.SubscribeParams{URI: uri}); err == nil {
+		t.Error("expected an error subscribing to the watch of another session")
+	}
+	if err := other.Unsubscribe(ctx, &mcp.UnsubscribeParams{URI: uri}); err == nil {
+		t.Error("expected an error unsubscribing from the watch of another session")
+	}
+	if list, err := other.ListResources(ctx, nil); err != nil || len(list.Resources) != 0 {
+		t.Errorf("expected no listed resource, got %+v (%v)", list, err)
+	}
+}
+
+func TestWatchTool_CheckRequestIDs(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Status</p>"))
+	}))
+	defer site.Close()
+
+	logFile, err := os.Create(filepath.Join(t.TempDir(), "access.log"))
+	if err != nil {
+		t.Fatalf("failed to create access log: %v", err)
+	}
+	defer logFile.Close()
+	session := connectTestClient(t, setupMCPServer(config{accessLogOutput: logFile, watchMinInterval: time.Millisecond}))
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "webfetch_watch",
+		Arguments: map[string]any{"action": "add", "url": site.URL, "interval": "10ms"},
+	})
+	if err != nil || res.IsError {
+		t.Fatalf("unexpected error: %v %+v", err, res)
+	}
+
+	// The first check belongs to the tool call, and each later one has its own ID
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(logFile.Name())
+		// Only complete lines are decoded
+		lines := strings.Split(string(data), "\n")
+		if len(lines) > 3 {
+			ids := make(map[string]bool)
+			for _, line := range lines[:3] {
+				var record map[string]any
+				json.Unmarshal([]byte(line), &record)
+				ids[record["request_id"].(string)] = true
+			}
+			if !ids[res.Meta[requestIDMetaKey].(string)] || len(ids) != 3 {
+				t.Errorf("expected the ID of the call and two new IDs, got %v", ids)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 3 checks, got %q", data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
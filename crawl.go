@@ -0,0 +1,168 @@
+package webfetch
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// defaultCrawlMaxPages is the number of pages fetched when CrawlOptions.MaxPages is not set
+const defaultCrawlMaxPages = 10
+
+// Stop reasons reported in CrawlResult.StopReason when a budget is exhausted
+const (
+	StopMaxPages      = "max_pages"
+	StopMaxDepth      = "max_depth"
+	StopMaxTotalBytes = "max_total_bytes"
+	StopMaxDuration   = "max_duration"
+)
+
+// CrawlOptions configures a crawl. Zero limits other than MaxPages mean unlimited.
+type CrawlOptions struct {
+	FetchOptions
+
+	// MaxPages is the maximum number of pages to fetch (default 10).
+	MaxPages int
+	// MaxDepth is the maximum number of links followed from the start URL.
+	MaxDepth int
+	// MaxTotalBytes stops the crawl once the converted pages reach this size.
+	MaxTotalBytes int
+	// MaxDuration bounds the wall-clock time of the whole crawl.
+	MaxDuration time.Duration
+	// StripTrackingParams treats URLs that only differ by tracking parameters
+	// (see FetchOptions.TrackingParams) as the same page.
+	StripTrackingParams bool
+}
+
+// CrawlResult holds the pages of a crawl and reports whether it was cut short.
+type CrawlResult struct {
+	// Pages contains the converted pages in the order they were fetched. Pages
+	// with the same content as an earlier page have DuplicateOf set to its URL
+	// and an empty Content.
+	Pages []*Document
+	// BudgetExhausted is set when a limit was hit before every reachable page was fetched.
+	BudgetExhausted bool
+	// StopReason names the limit that was hit (one of the Stop* constants), if any.
+	StopReason string
+}
+
+// crawlItem is a queued URL together with its link distance from the start URL
+type crawlItem struct {
+	url   string
+	depth int
+}
+
+// Crawl fetches rawURL and follows the links it finds to other pages on the same host,
+// breadth-first, converting each page to Markdown. Pages that cannot be fetched or
+// converted are skipped; an error is only returned when the start URL itself fails.
+// When a budget in opts is exhausted the crawl stops cleanly and returns the pages
+// fetched so far.
+func Crawl(ctx context.Context, rawURL string, opts CrawlOptions) (*CrawlResult, error) {
+	maxPages := opts.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultCrawlMaxPages
+	}
+
+	startURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	// The credentials of the start URL authenticate the requests to its origin
+	if startURL.User != nil {
+		ctx = withURLCredentials(ctx, startURL)
+		rawURL = startURL.String()
+	}
+	var tracking []string
+	if opts.StripTrackingParams {
+		tracking = trackingParams(opts.FetchOptions)
+	}
+	startURL = canonicalURL(startURL, tracking)
+
+	crawlCtx := ctx
+	if opts.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		crawlCtx, cancel = context.WithTimeout(ctx, opts.MaxDuration)
+		defer cancel()
+	}
+
+	queue := []crawlItem{{url: rawURL}}
+	seen := map[string]bool{startURL.String(): true}
+	result := &CrawlResult{}
+	totalBytes := 0
+	// firstURLs maps the content hashes of the pages to the first URL serving them
+	firstURLs := make(map[string]string)
+
+	// stop records the first exhausted budget
+	stop := func(reason string) {
+		if !result.BudgetExhausted {
+			result.BudgetExhausted = true
+			result.StopReason = reason
+		}
+	}
+
+	for len(queue) > 0 {
+		if ctx.Err() != nil {
+			break
+		}
+		if crawlCtx.Err() != nil {
+			stop(StopMaxDuration)
+			break
+		}
+		if len(result.Pages) >= maxPages {
+			stop(StopMaxPages)
+			break
+		}
+		if opts.MaxTotalBytes > 0 && totalBytes >= opts.MaxTotalBytes {
+			stop(StopMaxTotalBytes)
+			break
+		}
+
+		item := queue[0]
+		queue = queue[1:]
+
+		doc, err := Fetch(crawlCtx, item.url, opts.FetchOptions)
+		if err != nil {
+			if ctx.Err() == nil && crawlCtx.Err() != nil {
+				stop(StopMaxDuration)
+				break
+			}
+			if item.depth == 0 {
+				return nil, err
+			}
+			continue
+		}
+		if first, ok := firstURLs[doc.ContentHash]; !ok {
+			firstURLs[doc.ContentHash] = doc.URL
+		} else if doc.Content != "" {
+			doc.DuplicateOf = first
+			doc.Content = ""
+		}
+		result.Pages = append(result.Pages, doc)
+		totalBytes += len(doc.Content)
+
+		// Enqueue unseen links on the same host
+		for _, link := range doc.Links {
+			u, err := url.Parse(link)
+			if err != nil {
+				continue
+			}
+			u = canonicalURL(u, tracking)
+			if u.Host != startURL.Host {
+				continue
+			}
+			key := u.String()
+			if seen[key] {
+				continue
+			}
+			if opts.MaxDepth > 0 && item.depth >= opts.MaxDepth {
+				stop(StopMaxDepth)
+				continue
+			}
+			seen[key] = true
+			queue = append(queue, crawlItem{url: link, depth: item.depth + 1})
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,184 @@
+package webfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCrawlTestServer() *httptest.Server {
+	pages := map[string]string{
+		"/":  `<html><head><title>Home</title></head><body><a href="/a">A</a> <a href="/b#top">B</a> <a href="https://other.example/">Other</a></body></html>`,
+		"/a": `<html><head><title>Page A</title></head><body><a href="/">Home</a> <a href="/b">B</a> <a href="/missing">Missing</a></body></html>`,
+		"/b": `<html><head><title>Page B</title></head><body><p>Leaf</p></body></html>`,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	}))
+}
+
+func TestCrawl(t *testing.T) {
+	server := newCrawlTestServer()
+	defer server.Close()
+
+	result, err := Crawl(context.Background(), server.URL+"/", CrawlOptions{
+		FetchOptions: FetchOptions{Timeout: 5 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, want := crawlTitles(result), "Home,Page A,Page B"; got != want {
+		t.Errorf("expected pages %q, got %q", want, got)
+	}
+	if result.BudgetExhausted {
+		t.Errorf("expected complete crawl, got budget exhausted (%s)", result.StopReason)
+	}
+}
+
+func crawlTitles(result *CrawlResult) string {
+	var titles []string
+	for _, doc := range result.Pages {
+		titles = append(titles, doc.Title)
+	}
+	return strings.Join(titles, ",")
+}
+
+func TestCrawl_Budgets(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           CrawlOptions
+		expectedTitles string
+		expectedReason string
+	}{
+		{
+			name:           "max pages",
+			opts:           CrawlOptions{MaxPages: 2},
+			expectedTitles: "Home,Page A",
+			expectedReason: StopMaxPages,
+		},
+		{
+			name:           "max depth",
+			opts:           CrawlOptions{MaxDepth: 1},
+			expectedTitles: "Home,Page A,Page B",
+			expectedReason: StopMaxDepth,
+		},
+		{
+			name:           "max total bytes",
+			opts:           CrawlOptions{MaxTotalBytes: 1},
+			expectedTitles: "Home",
+			expectedReason: StopMaxTotalBytes,
+		},
+		{
+			name:           "max duration",
+			opts:           CrawlOptions{MaxDuration: time.Nanosecond},
+			expectedTitles: "",
+			expectedReason: StopMaxDuration,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newCrawlTestServer()
+			defer server.Close()
+
+			tt.opts.Timeout = 5 * time.Second
+			result, err := Crawl(context.Background(), server.URL+"/", tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := crawlTitles(result); got != tt.expectedTitles {
+				t.Errorf("expected pages %q, got %q", tt.expectedTitles, got)
+			}
+			if !result.BudgetExhausted || result.StopReason != tt.expectedReason {
+				t.Errorf("expected budget exhausted by %q, got %v (%q)",
+					tt.expectedReason, result.BudgetExhausted, result.StopReason)
+			}
+		})
+	}
+}
+
+func TestCrawl_StripTrackingParams(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="/?utm_source=self">Home</a> <a href="/a?id=1&fbclid=x">A</a> <a href="/a?id=1">A again</a>`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		stripTracking bool
+		expectedPages int
+	}{
+		{name: "tracking variants are distinct pages", stripTracking: false, expectedPages: 4},
+		{name: "tracking variants are deduplicated", stripTracking: true, expectedPages: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Crawl(context.Background(), server.URL+"/", CrawlOptions{
+				FetchOptions:        FetchOptions{Timeout: 5 * time.Second},
+				StripTrackingParams: tt.stripTracking,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(result.Pages) != tt.expectedPages {
+				t.Errorf("expected %d pages, got %d", tt.expectedPages, len(result.Pages))
+			}
+		})
+	}
+}
+
+func TestCrawl_StartURLError(t *testing.T) {
+	server := newCrawlTestServer()
+	defer server.Close()
+
+	_, err := Crawl(context.Background(), server.URL+"/missing", CrawlOptions{
+		FetchOptions: FetchOptions{Timeout: 5 * time.Second},
+	})
+	if err == nil || !strings.Contains(err.Error(), "unexpected status code: 404") {
+		t.Errorf("expected 404 error, got %v", err)
+	}
+}
+
+func TestCrawl_Duplicates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/docs">Docs</a> <a href="/mirror/docs">Mirror</a>`))
+		default:
+			w.Write([]byte(`<p>Same documentation</p>`))
+		}
+	}))
+	defer server.Close()
+
+	result, err := Crawl(context.Background(), server.URL+"/", CrawlOptions{
+		FetchOptions: FetchOptions{Timeout: 5 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result.Pages) != 3 {
+		t.Fatalf("expected 3 pages, got %d", len(result.Pages))
+	}
+	docs, mirror := result.Pages[1], result.Pages[2]
+	if docs.Content != "Same documentation" || docs.DuplicateOf != "" {
+		t.Errorf("expected the first copy to be kept, got %q (duplicate of %q)", docs.Content, docs.DuplicateOf)
+	}
+	if mirror.Content != "" || mirror.DuplicateOf != server.URL+"/docs" || mirror.ContentHash != docs.ContentHash {
+		t.Errorf("expected the mirror to be a duplicate of %s/docs, got %q (duplicate of %q)", server.URL, mirror.Content, mirror.DuplicateOf)
+	}
+}
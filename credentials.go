@@ -0,0 +1,61 @@
+package webfetch
+
+import (
+	"context"
+	"encoding/base64"
+	"net/url"
+	"strings"
+)
+
+// urlCredentials are the credentials of the userinfo of a URL, sent in a Basic
+// Authorization header to the requests to the origin of the URL only
+type urlCredentials struct {
+	scheme, host  string
+	authorization string
+}
+
+// credentialsKey is the context key of the urlCredentials of a fetch
+type credentialsKey struct{}
+
+// withURLCredentials removes the userinfo of u, if any, and returns ctx
+// carrying its credentials
+func withURLCredentials(ctx context.Context, u *url.URL) context.Context {
+	if u.User == nil {
+		return ctx
+	}
+	username := u.User.Username()
+	password, _ := u.User.Password()
+	u.User = nil
+	return context.WithValue(ctx, credentialsKey{}, urlCredentials{
+		scheme:        strings.ToLower(u.Scheme),
+		host:          strings.ToLower(u.Host),
+		authorization: "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password)),
+	})
+}
+
+// credentialsFor returns the Authorization header carrying the URL credentials
+// of ctx to u, if they are for the origin of u
+func credentialsFor(ctx context.Context, u *url.URL) (string, bool) {
+	creds, ok := ctx.Value(credentialsKey{}).(urlCredentials)
+	if !ok || !strings.EqualFold(u.Scheme, creds.scheme) || !strings.EqualFold(u.Host, creds.host) {
+		return "", false
+	}
+	return creds.authorization, true
+}
+
+// hasURLCredentials reports whether ctx carries URL credentials
+func hasURLCredentials(ctx context.Context) bool {
+	_, ok := ctx.Value(credentialsKey{}).(urlCredentials)
+	return ok
+}
+
+// StripUserinfo returns rawURL without its user name and password, so that it
+// can be logged or reported. Invalid URLs are returned as is.
+func StripUserinfo(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	u.User = nil
+	return u.String()
+}
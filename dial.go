@@ -0,0 +1,58 @@
+package webfetch
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// dialTransport returns a transport applying the connection timeouts of opts,
+// resolving host names with opts.Resolver, if set, and calling opts.AllowIP,
+// if set, with the address of each connection, after DNS resolution, so that
+// host names resolving to a refused address are caught, including on
+// redirects. Keep-alives are disabled, as the transport of a single fetch is
+// dropped after it.
+func dialTransport(opts FetchOptions) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if opts.AllowIP != nil {
+		allowIP := opts.AllowIP
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			return allowIP(ip.Unmap())
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dial := dialer.DialContext
+	if opts.Resolver != nil {
+		dial = opts.Resolver.dialContext(dialer.DialContext, opts.Resolver.LookupNetIP)
+	}
+	transport.DialContext = dial
+	// The timeout covers the DNS lookup and the connection attempts to each
+	// address
+	if opts.ConnectTimeout > 0 {
+		transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, opts.ConnectTimeout)
+			defer cancel()
+			return dial(ctx, network, address)
+		}
+	}
+	if opts.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = opts.TLSHandshakeTimeout
+	}
+	transport.ResponseHeaderTimeout = opts.ResponseHeaderTimeout
+	transport.DisableKeepAlives = true
+	return transport
+}
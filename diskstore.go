@@ -0,0 +1,164 @@
+package webfetch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// diskStoreExt is the extension of the files of a DiskStore
+const diskStoreExt = ".cache"
+
+// DiskStore is a CacheStore keeping each value in a file of a directory, so
+// that the cache survives restarts. It is safe for concurrent use, including
+// by several processes sharing the directory.
+type DiskStore struct {
+	dir string
+}
+
+// diskHeader is the first line of the file of a value, followed by the value
+type diskHeader struct {
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// NewDiskStore returns a store keeping its values in dir, created if missing.
+// Expired values left by a previous process are removed.
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	s := &DiskStore{dir: dir}
+	if _, err := s.Keys(context.Background()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// path returns the path of the file of key
+func (s *DiskStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+diskStoreExt)
+}
+
+func (s *DiskStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	path := s.path(key)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	line, value, ok := bytes.Cut(data, []byte("\n"))
+	var header diskHeader
+	if !ok || json.Unmarshal(line, &header) != nil {
+		os.Remove(path)
+		return nil, false, nil
+	}
+	if header.Key != key || header.expired() {
+		if header.Key == key {
+			os.Remove(path)
+		}
+		return nil, false, nil
+	}
+	return value, true, nil
+}
+
+func (s *DiskStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	header := diskHeader{Key: key}
+	if ttl > 0 {
+		header.ExpiresAt = time.Now().Add(ttl)
+	}
+	line, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	// The file is written apart and renamed, so that readers never see a
+	// partial value
+	f, err := os.CreateTemp(s.dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	w := bufio.NewWriter(f)
+	w.Write(line)
+	w.WriteByte('\n')
+	w.Write(value)
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path(key))
+}
+
+func (s *DiskStore) Delete(_ context.Context, key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Keys returns the keys of the stored values, removing the expired ones.
+func (s *DiskStore) Keys(_ context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), diskStoreExt) {
+			continue
+		}
+		path := filepath.Join(s.dir, entry.Name())
+		header, err := readDiskHeader(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Deleted meanwhile
+			continue
+		}
+		if err != nil || header.expired() {
+			os.Remove(path)
+			continue
+		}
+		keys = append(keys, header.Key)
+	}
+	return keys, nil
+}
+
+// readDiskHeader reads the header of the file at path
+func readDiskHeader(path string) (diskHeader, error) {
+	var header diskHeader
+	f, err := os.Open(path)
+	if err != nil {
+		return header, err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return header, err
+	}
+	if err := json.Unmarshal(line, &header); err != nil {
+		return header, fmt.Errorf("invalid cache file %s: %w", path, err)
+	}
+	return header, nil
+}
+
+// expired reports whether the value of h expired
+func (h diskHeader) expired() bool {
+	return !h.ExpiresAt.IsZero() && !time.Now().Before(h.ExpiresAt)
+}
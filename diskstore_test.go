@@ -0,0 +1,92 @@
+package webfetch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDiskStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	store, err := NewDiskStore(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b", "content:c\nd"} {
+		if err := store.Set(ctx, key, []byte("value\n"+key), time.Minute); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := store.Set(ctx, "expired", []byte("gone"), time.Nanosecond); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+
+	value, ok, err := store.Get(ctx, "content:c\nd")
+	if err != nil || !ok || string(value) != "value\ncontent:c\nd" {
+		t.Errorf("expected the value of content:c\\nd, got %q, %t, %v", value, ok, err)
+	}
+	if _, ok, err := store.Get(ctx, "missing"); ok || err != nil {
+		t.Errorf("expected missing key, got %t, %v", ok, err)
+	}
+	if _, ok, err := store.Get(ctx, "expired"); ok || err != nil {
+		t.Errorf("expected expired key to be missing, got %t, %v", ok, err)
+	}
+
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok, _ := store.Get(ctx, "a"); ok {
+		t.Error("expected deleted key to be missing")
+	}
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Errorf("expected deleting a missing key to succeed, got %v", err)
+	}
+
+	// The values survive the store, and the expired ones are removed
+	store.Set(ctx, "expired", []byte("gone"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	reopened, err := NewDiskStore(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keys, err := reopened.Keys(ctx)
+	slices.Sort(keys)
+	if err != nil || !slices.Equal(keys, []string{"b", "content:c\nd"}) {
+		t.Errorf("expected keys b and content:c\\nd, got %q, %v", keys, err)
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("expected 2 files, got %d", len(files))
+	}
+}
+
+func TestFetch_DiskCache(t *testing.T) {
+	var hits atomic.Int64
+	server := newCountingServer(&hits)
+	defer server.Close()
+
+	dir := t.TempDir()
+	for i := range 2 {
+		// Each process opens the directory again
+		store, err := NewDiskStore(dir)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		opts := FetchOptions{Timeout: 5 * time.Second, Cache: NewCacheWithStore(time.Minute, store)}
+		doc, err := Fetch(context.Background(), server.URL, opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := []CacheStatus{CacheMiss, CacheHit}[i]
+		if doc.Content != "hit 1" || doc.CacheStatus != expected {
+			t.Errorf("fetch %d: expected hit 1 (%s), got %q (%s)", i+1, expected, doc.Content, doc.CacheStatus)
+		}
+	}
+}
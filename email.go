@@ -0,0 +1,83 @@
+package webfetch
+
+import (
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// cfEmailPath is the link path used by Cloudflare email address obfuscation
+const cfEmailPath = "/cdn-cgi/l/email-protection"
+
+// obfuscatedEmail matches addresses written as "name [at] example [dot] com",
+// with brackets, parentheses or braces around "at" and "dot"
+var obfuscatedEmail = regexp.MustCompile(`(?i)([\w.+-]+)\s*[\[({]\s*at\s*[\])}]\s*([\w-]+(?:(?:\s*[\[({]\s*dot\s*[\])}]\s*|\.)[\w-]+)+)`)
+
+// obfuscatedDot matches the "[dot]" separators of an obfuscated domain
+var obfuscatedDot = regexp.MustCompile(`(?i)\s*[\[({]\s*dot\s*[\])}]\s*`)
+
+// decodeEmails restores the email addresses of root obfuscated by Cloudflare
+// email protection or written as "name [at] example [dot] com".
+func decodeEmails(root *html.Node) {
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.ElementNode:
+			if n.DataAtom == atom.Script || n.DataAtom == atom.Style {
+				return
+			}
+			if encoded := getAttr(n, "data-cfemail"); encoded != "" {
+				if email, ok := decodeCFEmail(encoded); ok {
+					for c := n.FirstChild; c != nil; c = n.FirstChild {
+						n.RemoveChild(c)
+					}
+					n.AppendChild(&html.Node{Type: html.TextNode, Data: email})
+				}
+			}
+			if n.DataAtom == atom.A {
+				for i, attr := range n.Attr {
+					if attr.Key != "href" {
+						continue
+					}
+					path, encoded, ok := strings.Cut(attr.Val, "#")
+					if !ok || !strings.HasSuffix(path, cfEmailPath) {
+						continue
+					}
+					if email, ok := decodeCFEmail(encoded); ok {
+						n.Attr[i].Val = "mailto:" + email
+					}
+				}
+			}
+		case html.TextNode:
+			n.Data = obfuscatedEmail.ReplaceAllStringFunc(n.Data, func(s string) string {
+				m := obfuscatedEmail.FindStringSubmatch(s)
+				return m[1] + "@" + obfuscatedDot.ReplaceAllString(m[2], ".")
+			})
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+}
+
+// decodeCFEmail decodes a Cloudflare protected address: hex bytes XORed with
+// the first byte
+func decodeCFEmail(encoded string) (string, bool) {
+	data, err := hex.DecodeString(encoded)
+	if err != nil || len(data) < 2 {
+		return "", false
+	}
+	key := data[0]
+	email := make([]byte, len(data)-1)
+	for i, b := range data[1:] {
+		email[i] = b ^ key
+	}
+	if !strings.Contains(string(email), "@") {
+		return "", false
+	}
+	return string(email), true
+}
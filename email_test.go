@@ -0,0 +1,60 @@
+package webfetch
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func Test_decodeEmails(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com")
+
+	tests := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{
+			name:     "cloudflare span",
+			html:     `<p>Mail <span class="__cf_email__" data-cfemail="422b2c242d02273a232f322e276c212d2f">[email&#160;protected]</span></p>`,
+			expected: "Mail info@example.com",
+		},
+		{
+			name:     "cloudflare link",
+			html:     `<p><a href="/cdn-cgi/l/email-protection#422b2c242d02273a232f322e276c212d2f">Contact us</a></p>`,
+			expected: "[Contact us](mailto:info@example.com)",
+		},
+		{
+			name:     "invalid cloudflare data",
+			html:     `<p><span data-cfemail="zz">[email protected]</span></p>`,
+			expected: "\\[email protected]",
+		},
+		{
+			name:     "bracketed at and dot",
+			html:     `<p>Write to jane.doe [at] example [dot] co [dot] uk today</p>`,
+			expected: "Write to jane.doe@example.co.uk today",
+		},
+		{
+			name:     "parenthesized at",
+			html:     `<p>press (AT) example.org</p>`,
+			expected: "press@example.org",
+		},
+		{
+			name:     "plain at left alone",
+			html:     `<p>Meet me at example dot com</p>`,
+			expected: "Meet me at example dot com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := convertHTMLToMarkdown(strings.NewReader(tt.html), baseURL)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package webfetch
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// maxEntityRepairs is the number of times double-escaped character references
+// are decoded, e.g. twice for "&amp;amp;lt;"
+const maxEntityRepairs = 3
+
+// characterReference matches a named or numeric character reference
+var characterReference = regexp.MustCompile(`&(?:#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[a-zA-Z][a-zA-Z0-9]{1,31});`)
+
+// leadingReference matches a character reference at the start of a string
+var leadingReference = regexp.MustCompile("^" + characterReference.String())
+
+// repairEntities decodes the character references left in the text of root by
+// pages escaping their content twice, such as "&amp;nbsp;" showing as "&nbsp;".
+// Code, whose text may legitimately show references, is left as is.
+func repairEntities(root *html.Node) {
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Pre, atom.Code, atom.Kbd, atom.Samp, atom.Script, atom.Style, atom.Textarea:
+				return
+			}
+		}
+		if n.Type == html.TextNode {
+			for range maxEntityRepairs {
+				if !characterReference.MatchString(n.Data) {
+					break
+				}
+				n.Data = characterReference.ReplaceAllStringFunc(n.Data, html.UnescapeString)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+}
+
+// entityPlugin is a 'converter' plugin that undoes the escaping of &, < and > as
+// character references in text, which readers of the Markdown source see as
+// noise. They stay escaped where Markdown would read them as a reference or an
+// HTML tag.
+type entityPlugin struct{}
+
+func (p *entityPlugin) Name() string {
+	return "entities"
+}
+
+func (p *entityPlugin) Init(conv *converter.Converter) error {
+	conv.Register.TextTransformer(unescapeText, converter.PriorityLate)
+	return nil
+}
+
+// unescapeText replaces the &amp;, &lt; and &gt; references in content with
+// the characters, unless the result would start a reference or a tag
+func unescapeText(_ converter.Context, content string) string {
+	if !strings.Contains(content, "&") {
+		return content
+	}
+
+	var sb strings.Builder
+	for {
+		i := strings.IndexByte(content, '&')
+		if i < 0 {
+			sb.WriteString(content)
+			return sb.String()
+		}
+		sb.WriteString(content[:i])
+		content = content[i:]
+
+		switch {
+		case strings.HasPrefix(content, "&amp;"):
+			rest := content[len("&amp;"):]
+			if leadingReference.MatchString("&" + rest) {
+				sb.WriteString("&amp;")
+			} else {
+				sb.WriteByte('&')
+			}
+			content = rest
+		case strings.HasPrefix(content, "&lt;"):
+			rest := content[len("&lt;"):]
+			if rest != "" && (isASCIILetter(rest[0]) || strings.ContainsRune("/!?", rune(rest[0]))) {
+				sb.WriteString("&lt;")
+			} else {
+				sb.WriteByte('<')
+			}
+			content = rest
+		case strings.HasPrefix(content, "&gt;"):
+			sb.WriteByte('>')
+			content = content[len("&gt;"):]
+		default:
+			sb.WriteByte('&')
+			content = content[1:]
+		}
+	}
+}
+
+// isASCIILetter reports whether c is an ASCII letter
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,65 @@
+package webfetch
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func Test_convertHTMLToMarkdown_Entities(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com")
+
+	tests := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{
+			name:     "ampersand",
+			html:     `<p>AT&amp;T sells fish &amp; chips</p>`,
+			expected: "AT&T sells fish & chips",
+		},
+		{
+			name:     "numeric references",
+			html:     `<p>&#8212; &#x2192; &#X41;</p>`,
+			expected: "— → A",
+		},
+		{
+			name:     "double escaped",
+			html:     `<p>a&amp;nbsp;b &amp;#8212; &amp;amp;lt;</p>`,
+			expected: "a b — <",
+		},
+		{
+			name:     "comparison",
+			html:     `<p>1 &lt; 2 &gt; 0</p>`,
+			expected: "1 < 2 > 0",
+		},
+		{
+			name:     "tag-like text stays escaped",
+			html:     `<p>Use &lt;div&gt; here</p>`,
+			expected: "Use &lt;div> here",
+		},
+		{
+			name:     "reference-like text stays escaped",
+			html:     `<p>&amp;amp;copy; vs &amp;unknown;</p>`,
+			expected: "© vs &amp;unknown;",
+		},
+		{
+			name:     "code is kept",
+			html:     `<pre><code>&amp;lt;div&amp;gt;</code></pre><p><code>&amp;amp;</code></p>`,
+			expected: "```\n&lt;div&gt;\n```\n\n`&amp;`",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := convertHTMLToMarkdown(strings.NewReader(tt.html), baseURL)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
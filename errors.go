@@ -0,0 +1,93 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// ErrorClass tells whether a failed fetch is worth retrying.
+type ErrorClass string
+
+const (
+	// ErrorTransient is the class of failures that may not happen again, such
+	// as timeouts, connection resets, 5xx responses and rate limiting.
+	ErrorTransient ErrorClass = "transient"
+	// ErrorPermanent is the class of failures that retrying the same request
+	// would repeat, such as 4xx responses, invalid URLs and unsupported or
+	// too large content.
+	ErrorPermanent ErrorClass = "permanent"
+)
+
+// ClassifyError returns the class of an error returned by Fetch and the other
+// functions of the package. Errors it does not know are permanent.
+func ClassifyError(err error) ErrorClass {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Class()
+	}
+	var archiveErr *ArchiveError
+	if errors.As(err, &archiveErr) && archiveErr.StatusCode != 0 {
+		return classifyStatus(archiveErr.StatusCode)
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		// Unknown hosts stay unknown
+		if dnsErr.IsNotFound {
+			return ErrorPermanent
+		}
+		return ErrorTransient
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrRequestQueueTimeout),
+		errors.Is(err, ErrBodyReadTimeout),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout(),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, io.EOF):
+		return ErrorTransient
+	}
+	return ErrorPermanent
+}
+
+// classifyStatus returns the class of a response with statusCode: request
+// timeouts, rate limiting and server errors other than unsupported features
+// are transient
+func classifyStatus(statusCode int) ErrorClass {
+	switch {
+	case statusCode == http.StatusRequestTimeout,
+		statusCode == http.StatusTooEarly,
+		statusCode == http.StatusTooManyRequests,
+		statusCode >= 500 && statusCode != http.StatusNotImplemented && statusCode != http.StatusHTTPVersionNotSupported:
+		return ErrorTransient
+	}
+	return ErrorPermanent
+}
+
+// parseRetryAfter parses a Retry-After header, in seconds or as an HTTP date,
+// returning 0 when absent or invalid
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
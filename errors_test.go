@@ -0,0 +1,88 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected ErrorClass
+	}{
+		{name: "not found", err: &StatusError{StatusCode: http.StatusNotFound}, expected: ErrorPermanent},
+		{name: "forbidden", err: &StatusError{StatusCode: http.StatusForbidden}, expected: ErrorPermanent},
+		{name: "rate limited", err: &StatusError{StatusCode: http.StatusTooManyRequests}, expected: ErrorTransient},
+		{name: "request timeout", err: &StatusError{StatusCode: http.StatusRequestTimeout}, expected: ErrorTransient},
+		{name: "unavailable", err: &StatusError{StatusCode: http.StatusServiceUnavailable}, expected: ErrorTransient},
+		{name: "not implemented", err: &StatusError{StatusCode: http.StatusNotImplemented}, expected: ErrorPermanent},
+		{name: "wrapped status", err: fmt.Errorf("search failed: %w", &StatusError{StatusCode: http.StatusBadGateway}), expected: ErrorTransient},
+		{name: "archive rate limited", err: &ArchiveError{StatusCode: http.StatusTooManyRequests}, expected: ErrorTransient},
+		{name: "archive refused", err: &ArchiveError{Message: "blocked"}, expected: ErrorPermanent},
+		{name: "deadline", err: fmt.Errorf("failed to fetch URL: %w", context.DeadlineExceeded), expected: ErrorTransient},
+		{name: "read deadline", err: os.ErrDeadlineExceeded, expected: ErrorTransient},
+		{name: "connection reset", err: fmt.Errorf("failed to fetch URL: %w", &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), expected: ErrorTransient},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, expected: ErrorTransient},
+		{name: "unknown host", err: &net.DNSError{Err: "no such host", Name: "nowhere.invalid", IsNotFound: true}, expected: ErrorPermanent},
+		{name: "DNS timeout", err: &net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}, expected: ErrorTransient},
+		{name: "request queue", err: ErrRequestQueueTimeout, expected: ErrorTransient},
+		{name: "too large", err: &TooLargeError{ContentType: "text/html", Limit: 10}, expected: ErrorPermanent},
+		{name: "content mismatch", err: &ContentMismatchError{Declared: "application/pdf", Sniffed: "text/html"}, expected: ErrorPermanent},
+		{name: "not cached", err: fmt.Errorf("%w: https://example.com", ErrNotCached), expected: ErrorPermanent},
+		{name: "invalid URL", err: errors.New("invalid URL: missing scheme or host"), expected: ErrorPermanent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyError(tt.err); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{value: "", expected: 0},
+		{value: "120", expected: 2 * time.Minute},
+		{value: "Sun, 01 Mar 2026 12:00:30 GMT", expected: 30 * time.Second},
+		{value: "Sun, 01 Mar 2026 11:00:00 GMT", expected: 0},
+		{value: "soon", expected: 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.expected {
+			t.Errorf("%q: expected %v, got %v", tt.value, tt.expected, got)
+		}
+	}
+}
+
+func TestFetch_StatusErrorRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := Fetch(context.Background(), server.URL, FetchOptions{})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("expected a status error, got %v", err)
+	}
+	if statusErr.RetryAfter != time.Minute || statusErr.Class() != ErrorTransient {
+		t.Errorf("expected a transient error retried after 1m, got %+v", statusErr)
+	}
+}
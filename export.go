@@ -0,0 +1,159 @@
+package webfetch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ExportIndex is the name of the index file written by Export.
+const ExportIndex = "index.md"
+
+// unsafePathChars matches the characters replaced in exported file names
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ExportedPage describes a document written by Export.
+type ExportedPage struct {
+	// URL is the URL of the document.
+	URL string
+	// Title is the title of the document, if any.
+	Title string
+	// Path is the slash-separated path of the file, relative to the export directory.
+	Path string
+}
+
+// Export writes docs, e.g. the pages of a crawl or Cache.Documents, to dir as
+// Markdown files with YAML front matter, and an index linking to them. Files
+// are laid out by host and URL path, e.g. https://example.com/docs/intro is
+// written to example.com/docs/intro.md. Binary documents and the duplicates of
+// a crawl, whose content is empty, are skipped. Existing files with the same
+// names are overwritten.
+func Export(dir string, docs []*Document) ([]ExportedPage, error) {
+	var pages []ExportedPage
+	used := map[string]bool{ExportIndex: true}
+	for _, doc := range docs {
+		if doc.Encoding != "" || doc.DuplicateOf != "" && doc.Content == "" {
+			continue
+		}
+
+		name := exportPath(doc.URL)
+		// URLs mapped to the same file, e.g. /a and /a.html, are numbered
+		base := strings.TrimSuffix(name, ".md")
+		for i := 2; used[strings.ToLower(name)]; i++ {
+			name = base + "-" + strconv.Itoa(i) + ".md"
+		}
+		used[strings.ToLower(name)] = true
+
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			return nil, fmt.Errorf("export failed: %w", err)
+		}
+		if err := os.WriteFile(file, []byte(frontMatter(doc)+doc.Content+"\n"), 0o644); err != nil {
+			return nil, fmt.Errorf("export failed: %w", err)
+		}
+		pages = append(pages, ExportedPage{URL: doc.URL, Title: doc.Title, Path: name})
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# Index\n\n")
+	for _, p := range pages {
+		title := p.Title
+		if title == "" {
+			title = p.URL
+		}
+		fmt.Fprintf(&sb, "- [%s](%s) - <%s>\n", escapeLinkText(title), p.Path, p.URL)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("export failed: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ExportIndex), []byte(sb.String()), 0o644); err != nil {
+		return nil, fmt.Errorf("export failed: %w", err)
+	}
+	return pages, nil
+}
+
+// exportPath returns the relative path of the file holding the document fetched
+// from rawURL: the host followed by the URL path, with index.md for
+// directories. Queries are kept as a short hash.
+func exportPath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return path.Join("other", hashName(rawURL)+".md")
+	}
+
+	segments := []string{sanitizePathSegment(u.Host)}
+	for _, s := range strings.Split(u.Path, "/") {
+		if s = sanitizePathSegment(s); s != "" {
+			segments = append(segments, s)
+		}
+	}
+	name := "index"
+	if !strings.HasSuffix(u.Path, "/") && len(segments) > 1 {
+		name = segments[len(segments)-1]
+		segments = segments[:len(segments)-1]
+		// Extensions of pages are dropped, e.g. guide.html becomes guide.md
+		switch ext := path.Ext(name); strings.ToLower(ext) {
+		case ".html", ".htm", ".php", ".asp", ".aspx", ".jsp", ".md":
+			if name != ext {
+				name = strings.TrimSuffix(name, ext)
+			}
+		}
+	}
+	if u.RawQuery != "" {
+		name += "-" + hashName(u.RawQuery)
+	}
+	return path.Join(append(segments, name+".md")...)
+}
+
+// sanitizePathSegment returns s with the characters that are not safe in file
+// names replaced, and "" for empty, "." and ".." segments
+func sanitizePathSegment(s string) string {
+	if unescaped, err := url.PathUnescape(s); err == nil {
+		s = unescaped
+	}
+	s = strings.Trim(unsafePathChars.ReplaceAllString(s, "-"), "-")
+	if strings.Trim(s, ".") == "" {
+		return ""
+	}
+	return s
+}
+
+// hashName returns a short hash of s usable in file names
+func hashName(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
+
+// frontMatter returns the YAML front matter describing doc
+func frontMatter(doc *Document) string {
+	var sb strings.Builder
+	sb.WriteString("---\n")
+	field := func(name, value string) {
+		if value != "" {
+			// Go quoted strings are valid YAML double-quoted scalars
+			fmt.Fprintf(&sb, "%s: %s\n", name, strconv.Quote(value))
+		}
+	}
+	field("url", doc.URL)
+	field("title", doc.Title)
+	field("description", doc.Metadata.Description)
+	field("language", doc.Metadata.Language)
+	field("author", doc.Metadata.Author)
+	field("published_time", doc.Metadata.PublishedTime)
+	field("canonical", doc.Metadata.Canonical)
+	field("content_type", doc.ContentType)
+	sb.WriteString("---\n\n")
+	return sb.String()
+}
+
+// escapeLinkText escapes the characters of s that end Markdown link text
+func escapeLinkText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, "\n", " ").Replace(s)
+}
@@ -0,0 +1,92 @@
+package webfetch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportPath(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{url: "https://example.com", expected: "example.com/index.md"},
+		{url: "https://example.com/", expected: "example.com/index.md"},
+		{url: "https://example.com/docs/", expected: "example.com/docs/index.md"},
+		{url: "https://example.com/docs/intro", expected: "example.com/docs/intro.md"},
+		{url: "https://example.com/guide.html", expected: "example.com/guide.md"},
+		{url: "https://example.com/v1.2/a%20b", expected: "example.com/v1.2/a-b.md"},
+		{url: "https://example.com/../../etc/passwd", expected: "example.com/etc/passwd.md"},
+		{url: "https://example.com:8443/search?q=go", expected: "example.com-8443/search-" + hashName("q=go") + ".md"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := exportPath(tt.url); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	docs := []*Document{
+		{URL: "https://example.com/a", Title: `Say "hi" [now]`, ContentType: "text/html", Content: "# A"},
+		{URL: "https://example.com/a.html", Content: "# A again"},
+		{URL: "https://example.com/logo.png", Encoding: "base64", Content: "iVBORw0K"},
+	}
+
+	pages, err := Export(dir, docs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pages) != 2 || pages[0].Path != "example.com/a.md" || pages[1].Path != "example.com/a-2.md" {
+		t.Fatalf("unexpected pages: %+v", pages)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "example.com", "a.md"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "---\nurl: \"https://example.com/a\"\ntitle: \"Say \\\"hi\\\" [now]\"\ncontent_type: \"text/html\"\n---\n\n# A\n"
+	if string(data) != expected {
+		t.Errorf("expected %q, got %q", expected, data)
+	}
+
+	index, err := os.ReadFile(filepath.Join(dir, ExportIndex))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = "# Index\n\n" +
+		"- [Say \"hi\" \\[now\\]](example.com/a.md) - <https://example.com/a>\n" +
+		"- [https://example.com/a.html](example.com/a-2.md) - <https://example.com/a.html>\n"
+	if string(index) != expected {
+		t.Errorf("expected %q, got %q", expected, index)
+	}
+}
+
+func TestCache_Documents(t *testing.T) {
+	cache := NewCache(time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	cache.set(ctx, "b", "https://example.com/b", &Document{Content: "b"}, false, cachePolicy{})
+	cache.set(ctx, "a-old", "https://example.com/a", &Document{Content: "old"}, false, cachePolicy{})
+	now = now.Add(time.Second)
+	cache.set(ctx, "a-new", "https://example.com/a", &Document{Content: "new"}, false, cachePolicy{})
+	cache.set(ctx, "a-raw", "https://example.com/a", &Document{Content: "<p>raw</p>"}, true, cachePolicy{})
+
+	var contents []string
+	for _, doc := range cache.Documents() {
+		contents = append(contents, doc.Content)
+	}
+	if strings.Join(contents, ",") != "new,b" {
+		t.Errorf("expected documents new,b, got %v", contents)
+	}
+}
@@ -0,0 +1,103 @@
+package webfetch
+
+import (
+	"context"
+	"maps"
+	"time"
+)
+
+// Fetcher fetches and converts URLs with the same options, configured once.
+// Its own HTTP transport keeps connections open for the next fetches of the
+// same hosts, including with the options, such as AllowIP, Resolver or
+// ConnectTimeout, for which the Fetch function opens new connections on each
+// call. It is safe for concurrent use.
+type Fetcher struct {
+	opts FetchOptions
+}
+
+// Option configures the fetch options of a Fetcher.
+type Option func(*FetchOptions)
+
+// WithFetchOptions sets all the fetch options of a Fetcher to opts. It
+// replaces the options set by the previous Option values, so it comes first
+// when combined with them.
+func WithFetchOptions(opts FetchOptions) Option {
+	return func(o *FetchOptions) { *o = opts }
+}
+
+// WithTimeout sets the timeout of each fetch, as FetchOptions.Timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *FetchOptions) { o.Timeout = timeout }
+}
+
+// WithConnectTimeout sets the timeout of connections, as
+// FetchOptions.ConnectTimeout.
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(o *FetchOptions) { o.ConnectTimeout = timeout }
+}
+
+// WithUserAgent sets the User-Agent header of requests, as
+// FetchOptions.UserAgent.
+func WithUserAgent(userAgent string) Option {
+	return func(o *FetchOptions) { o.UserAgent = userAgent }
+}
+
+// WithHeader adds a header sent with every request, as FetchOptions.Headers.
+func WithHeader(key, value string) Option {
+	return func(o *FetchOptions) {
+		headers := make(map[string]string, len(o.Headers)+1)
+		maps.Copy(headers, o.Headers)
+		headers[key] = value
+		o.Headers = headers
+	}
+}
+
+// WithMaxRedirects sets the maximum number of redirects followed, as
+// FetchOptions.MaxRedirects.
+func WithMaxRedirects(n int) Option {
+	return func(o *FetchOptions) { o.MaxRedirects = n }
+}
+
+// NewFetcher returns a Fetcher applying the options, such as the user agent,
+// headers, size limits and conversion settings, to each of its fetches.
+// Options are applied in order; WithFetchOptions sets any field of
+// FetchOptions. Call Close to release its idle connections.
+func NewFetcher(options ...Option) *Fetcher {
+	var opts FetchOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	transport := dialTransport(opts)
+	// The connections outlive a single fetch
+	transport.DisableKeepAlives = false
+	opts.transport = transport
+	return &Fetcher{opts: opts}
+}
+
+// Fetch fetches rawURL and converts it like the Fetch function.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Document, error) {
+	return Fetch(ctx, rawURL, f.opts)
+}
+
+// FetchAndConvert fetches rawURL and returns its content converted to
+// Markdown, like the FetchAndConvert function.
+func (f *Fetcher) FetchAndConvert(ctx context.Context, rawURL string) (string, error) {
+	doc, err := f.Fetch(ctx, rawURL)
+	if err != nil {
+		return "", err
+	}
+	return doc.Content, nil
+}
+
+// Crawl crawls from startURL like the Crawl function, fetching pages with the
+// options of f.
+func (f *Fetcher) Crawl(ctx context.Context, startURL string, opts CrawlOptions) (*CrawlResult, error) {
+	opts.FetchOptions = f.opts
+	return Crawl(ctx, startURL, opts)
+}
+
+// Close closes the idle connections of f. Fetches made afterwards open new
+// connections.
+func (f *Fetcher) Close() {
+	f.opts.transport.CloseIdleConnections()
+}
@@ -0,0 +1,91 @@
+package webfetch
+
+import (
+	"context"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetcher(t *testing.T) {
+	var conns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>" + r.UserAgent() + "</p>"))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		fetch         func(ctx context.Context, rawURL string) (*Document, error)
+		expectedConns int32
+	}{
+		{
+			name: "function",
+			fetch: func(ctx context.Context, rawURL string) (*Document, error) {
+				return Fetch(ctx, rawURL, FetchOptions{Timeout: 5 * time.Second, UserAgent: "agent/1.0", ConnectTimeout: time.Second})
+			},
+			expectedConns: 3,
+		},
+		{
+			name:          "fetcher",
+			fetch:         NewFetcher(WithTimeout(5*time.Second), WithUserAgent("agent/1.0"), WithConnectTimeout(time.Second)).Fetch,
+			expectedConns: 1,
+		},
+		{
+			name:          "fetcher with fetch options",
+			fetch:         NewFetcher(WithFetchOptions(FetchOptions{Timeout: 5 * time.Second, UserAgent: "agent/0.1"}), WithUserAgent("agent/1.0")).Fetch,
+			expectedConns: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conns.Store(0)
+			for range 3 {
+				doc, err := tt.fetch(context.Background(), server.URL)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !strings.Contains(doc.Content, "agent/1.0") {
+					t.Errorf("expected the user agent of the options, got %q", doc.Content)
+				}
+			}
+			if conns.Load() != tt.expectedConns {
+				t.Errorf("expected %d connections, got %d", tt.expectedConns, conns.Load())
+			}
+		})
+	}
+
+	// Closed fetchers open new connections
+	fetcher := NewFetcher(WithTimeout(5 * time.Second))
+	fetcher.Close()
+	if _, err := fetcher.FetchAndConvert(context.Background(), server.URL); err != nil {
+		t.Errorf("unexpected error after Close: %v", err)
+	}
+}
+
+func TestNewFetcher_Options(t *testing.T) {
+	fetcher := NewFetcher(
+		WithFetchOptions(FetchOptions{Selector: "main", Headers: map[string]string{"Accept-Language": "fr"}}),
+		WithHeader("X-Token", "secret"),
+		WithMaxRedirects(-1),
+	)
+	defer fetcher.Close()
+
+	expected := map[string]string{"Accept-Language": "fr", "X-Token": "secret"}
+	if fetcher.opts.Selector != "main" || fetcher.opts.MaxRedirects != -1 || !maps.Equal(fetcher.opts.Headers, expected) {
+		t.Errorf("expected the options to be applied in order, got %+v", fetcher.opts)
+	}
+}
@@ -0,0 +1,117 @@
+package webfetch
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// update rewrites the golden files with the current conversions:
+//
+//	go test -run TestGolden -update
+var update = flag.Bool("update", false, "update the golden files of testdata/golden")
+
+// goldenDir holds the conversion corpus: HTML and PDF fixtures, each next to
+// the Markdown expected from it, with the same name and a .md extension
+const goldenDir = "testdata/golden"
+
+// goldenBaseURL is the URL the fixtures are converted as served from, so that
+// their links resolve to the same URLs on every run
+const goldenBaseURL = "https://example.com/corpus/"
+
+// convertFixture converts the fixture at path as Fetch converts the responses
+// of its content type, without extraction options
+func convertFixture(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	source, err := url.Parse(goldenBaseURL + filepath.Base(path))
+	if err != nil {
+		t.Fatalf("invalid fixture URL: %v", err)
+	}
+
+	switch filepath.Ext(path) {
+	case ".pdf":
+		markdown, err := ConvertPDF(context.Background(), data, FetchOptions{})
+		if err != nil {
+			t.Fatalf("failed to convert PDF: %v", err)
+		}
+		return linkPDFPages(markdown, source)
+	default:
+		doc, err := convertHTML(decodeHTML(bytes.NewReader(data), "text/html"), source, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to convert HTML: %v", err)
+		}
+		return doc.Content
+	}
+}
+
+// diffLines describes the first line where got differs from expected, with
+// the lines around it
+func diffLines(expected, got string) string {
+	want, have := strings.Split(expected, "\n"), strings.Split(got, "\n")
+	i := 0
+	for i < len(want) && i < len(have) && want[i] == have[i] {
+		i++
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "first difference at line %d:\n", i+1)
+	for j := max(0, i-2); j < i; j++ {
+		fmt.Fprintf(&b, "  %s\n", want[j])
+	}
+	for j := i; j < min(len(want), i+3); j++ {
+		fmt.Fprintf(&b, "- %s\n", want[j])
+	}
+	for j := i; j < min(len(have), i+3); j++ {
+		fmt.Fprintf(&b, "+ %s\n", have[j])
+	}
+	return b.String()
+}
+
+func TestGolden(t *testing.T) {
+	var fixtures []string
+	for _, pattern := range []string{"*.html", "*.pdf"} {
+		matches, err := filepath.Glob(filepath.Join(goldenDir, pattern))
+		if err != nil {
+			t.Fatalf("failed to list fixtures: %v", err)
+		}
+		fixtures = append(fixtures, matches...)
+	}
+	if len(fixtures) == 0 {
+		t.Fatalf("expected fixtures in %s, got none", goldenDir)
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(filepath.Base(fixture), func(t *testing.T) {
+			got := convertFixture(t, fixture)
+			// Conversions must not depend on map order or the time
+			if again := convertFixture(t, fixture); again != got {
+				t.Fatalf("expected the same output on every conversion, %s", diffLines(got, again))
+			}
+
+			golden := strings.TrimSuffix(fixture, filepath.Ext(fixture)) + ".md"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatalf("failed to write golden file: %v", err)
+				}
+				return
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read golden file (run go test -run TestGolden -update to create it): %v", err)
+			}
+			if string(expected) != got {
+				t.Errorf("expected the output of %s (run go test -run TestGolden -update to accept the new one), %s", golden, diffLines(string(expected), got))
+			}
+		})
+	}
+}
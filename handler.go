@@ -0,0 +1,173 @@
+package webfetch
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// handler serves the conversions of NewHandler
+type handler struct {
+	fetcher *Fetcher
+}
+
+// documentResponse is the JSON representation of a Document served by the
+// handler of NewHandler
+type documentResponse struct {
+	URL         string     `json:"url"`
+	FinalURL    string     `json:"final_url,omitempty"`
+	Title       string     `json:"title,omitempty"`
+	ContentType string     `json:"content_type,omitempty"`
+	Content     string     `json:"content"`
+	Encoding    string     `json:"encoding,omitempty"`
+	Links       []string   `json:"links,omitempty"`
+	Citations   []Citation `json:"citations,omitempty"`
+	Metadata    Metadata   `json:"metadata"`
+	ContentHash string     `json:"content_hash,omitempty"`
+	DuplicateOf string     `json:"duplicate_of,omitempty"`
+	FetchedAt   time.Time  `json:"fetched_at,omitzero"`
+	Stale       bool       `json:"stale,omitempty"`
+	CacheStatus string     `json:"cache_status,omitempty"`
+}
+
+// errorResponse is the JSON body of the errors of the handler of NewHandler
+type errorResponse struct {
+	Error string     `json:"error"`
+	Class ErrorClass `json:"class"`
+}
+
+// NewHandler returns an http.Handler fetching and converting pages with opts,
+// so that Go services can embed the conversion without speaking MCP. It
+// serves GET /convert with the query parameters:
+//
+//   - url: the http or https URL to fetch, required;
+//   - format: "markdown", the default, for the converted content, or "json"
+//     for the whole Document. Requests accepting application/json without
+//     format get JSON;
+//   - selector: a CSS selector overriding opts.Selector.
+//
+// Markdown responses are text/markdown; documents that are not converted,
+// in raw mode or for the types of opts.Accept, are served with their own
+// content type, except HTML, SVG and other XML documents, which could run
+// scripts in the origin of the handler and are served as text/plain.
+// Responses are never sniffed, and documents are sandboxed with a
+// Content-Security-Policy. Invalid requests fail with status 400, timeouts with 504 and
+// other fetch errors with 502, the message in the body, as JSON in the json
+// format. The X-Request-Id header of a request is forwarded with its fetch,
+// and connections are reused across requests, as with a Fetcher.
+// Mount the handler with http.StripPrefix to serve it under a prefix. Access
+// control and rate limiting are left to the embedding service.
+func NewHandler(opts FetchOptions) http.Handler {
+	h := &handler{fetcher: NewFetcher(WithFetchOptions(opts))}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /convert", h.convert)
+	return mux
+}
+
+// convert fetches and converts the URL of the request
+func (h *handler) convert(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "markdown"
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			format = "json"
+		}
+	}
+	if format != "markdown" && format != "json" {
+		writeHandlerError(w, "markdown", http.StatusBadRequest, errors.New(`invalid format: expected "markdown" or "json"`))
+		return
+	}
+	rawURL := query.Get("url")
+	if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeHandlerError(w, format, http.StatusBadRequest, errors.New("invalid url: expected an absolute http or https URL"))
+		return
+	}
+
+	opts := h.fetcher.opts
+	if selector := query.Get("selector"); selector != "" {
+		opts.Selector = selector
+	}
+	if requestID := r.Header.Get("X-Request-Id"); requestID != "" {
+		opts.RequestID = requestID
+	}
+	doc, err := Fetch(r.Context(), rawURL, opts)
+	if err != nil {
+		status := http.StatusBadGateway
+		if isTimeout(err) || errors.Is(err, ErrBodyReadTimeout) {
+			status = http.StatusGatewayTimeout
+		}
+		writeHandlerError(w, format, status, err)
+		return
+	}
+
+	if format == "json" {
+		writeJSON(w, http.StatusOK, documentResponse{
+			URL:         doc.URL,
+			FinalURL:    doc.FinalURL,
+			Title:       doc.Title,
+			ContentType: doc.ContentType,
+			Content:     doc.Content,
+			Encoding:    doc.Encoding,
+			Links:       doc.Links,
+			Citations:   doc.Citations,
+			Metadata:    doc.Metadata,
+			ContentHash: doc.ContentHash,
+			DuplicateOf: doc.DuplicateOf,
+			FetchedAt:   doc.FetchedAt,
+			Stale:       doc.Stale,
+			CacheStatus: string(doc.CacheStatus),
+		})
+		return
+	}
+
+	if !opts.Raw && (isHTMLContentType(doc.ContentType) || isPDFContentType(doc.ContentType)) {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Write([]byte(doc.Content))
+		return
+	}
+	body := []byte(doc.Content)
+	if doc.Encoding == "base64" {
+		if body, err = base64.StdEncoding.DecodeString(doc.Content); err != nil {
+			writeHandlerError(w, format, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	contentType := doc.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	} else if isScriptableContentType(contentType) {
+		contentType = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Write(body)
+}
+
+// isScriptableContentType reports whether browsers may run the scripts of a
+// document of contentType, as for HTML, XHTML, SVG and other XML documents
+func isScriptableContentType(contentType string) bool {
+	ct := strings.ToLower(contentType)
+	return isHTMLContentType(ct) || strings.Contains(ct, "xml")
+}
+
+// writeHandlerError writes err with status, as JSON in the json format
+func writeHandlerError(w http.ResponseWriter, format string, status int, err error) {
+	if format == "json" {
+		writeJSON(w, status, errorResponse{Error: err.Error(), Class: ClassifyError(err)})
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// writeJSON writes v as the JSON body of a response with status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,113 @@
+package webfetch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewHandler(t *testing.T) {
+	var requestID atomic.Value
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID.Store(r.Header.Get("X-Request-Id"))
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		case "/logo.svg":
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`))
+		case "/data.json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"ok":true}`))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><title>Hello</title></head><body><h1>Hello</h1><p class="intro">Intro</p><p>World</p></body></html>`))
+		}
+	}))
+	defer upstream.Close()
+
+	handler := NewHandler(FetchOptions{Timeout: 500 * time.Millisecond, Accept: []string{"application/json", "image/svg+xml"}})
+
+	tests := []struct {
+		name                string
+		method              string
+		path                string
+		query               string
+		header              http.Header
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{name: "markdown", query: "url=" + upstream.URL, expectedStatus: 200, expectedContentType: "text/markdown; charset=utf-8", expectedBody: "# Hello\n\nIntro\n\nWorld"},
+		{name: "selector", query: "selector=.intro&url=" + upstream.URL, expectedStatus: 200, expectedContentType: "text/markdown; charset=utf-8", expectedBody: "Intro"},
+		{name: "json", query: "format=json&url=" + upstream.URL, expectedStatus: 200, expectedContentType: "application/json", expectedBody: `"title":"Hello"`},
+		{name: "accept json", query: "url=" + upstream.URL, header: http.Header{"Accept": {"application/json"}}, expectedStatus: 200, expectedContentType: "application/json", expectedBody: `"content":"# Hello`},
+		{name: "not converted", query: "url=" + upstream.URL + "/data.json", expectedStatus: 200, expectedContentType: "application/json", expectedBody: `{"ok":true}`},
+		{name: "not converted script", query: "url=" + upstream.URL + "/logo.svg", expectedStatus: 200, expectedContentType: "text/plain; charset=utf-8", expectedBody: "<svg"},
+		{name: "missing url", query: "", expectedStatus: 400, expectedBody: "invalid url"},
+		{name: "relative url", query: "url=/docs", expectedStatus: 400, expectedBody: "invalid url"},
+		{name: "invalid format", query: "format=pdf&url=" + upstream.URL, expectedStatus: 400, expectedBody: "invalid format"},
+		{name: "upstream error", query: "format=json&url=" + upstream.URL + "/missing", expectedStatus: 502, expectedBody: `"class":"permanent"`},
+		{name: "timeout", query: "url=" + upstream.URL + "/slow", expectedStatus: 504},
+		{name: "method", method: http.MethodPost, query: "url=" + upstream.URL, expectedStatus: 405},
+		{name: "not found", path: "/other", query: "url=" + upstream.URL, expectedStatus: 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			path := tt.path
+			if path == "" {
+				path = "/convert"
+			}
+			req := httptest.NewRequest(method, path+"?"+tt.query, nil)
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedContentType != "" && rec.Header().Get("Content-Type") != tt.expectedContentType {
+				t.Errorf("expected content type %q, got %q", tt.expectedContentType, rec.Header().Get("Content-Type"))
+			}
+			if !strings.Contains(rec.Body.String(), tt.expectedBody) {
+				t.Errorf("expected body containing %q, got %q", tt.expectedBody, rec.Body.String())
+			}
+			if rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+				t.Error("expected a response that is not sniffed")
+			}
+			if strings.HasPrefix(tt.name, "not converted") && rec.Header().Get("Content-Security-Policy") != "sandbox" {
+				t.Errorf("expected a sandboxed document, got policy %q", rec.Header().Get("Content-Security-Policy"))
+			}
+		})
+	}
+
+	// The request ID of the caller is forwarded
+	req := httptest.NewRequest(http.MethodGet, "/convert?format=json&url="+url.QueryEscape(upstream.URL), nil)
+	req.Header.Set("X-Request-Id", "req-42")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var doc documentResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if doc.URL != upstream.URL || requestID.Load() != "req-42" {
+		t.Errorf("expected the document of %s fetched with request ID req-42, got %s with %q", upstream.URL, doc.URL, requestID.Load())
+	}
+}
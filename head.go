@@ -0,0 +1,61 @@
+package webfetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HeadInfo describes a resource as reported by a HEAD request.
+type HeadInfo struct {
+	// URL is the final URL after redirects.
+	URL string
+	// StatusCode is the HTTP status code of the final response.
+	StatusCode int
+	// ContentType is the Content-Type header.
+	ContentType string
+	// ContentLength is the Content-Length header, or -1 if unknown.
+	ContentLength int64
+	// LastModified is the Last-Modified header, or the zero time if absent.
+	LastModified time.Time
+}
+
+// Head requests the headers of rawURL without downloading the body. Unlike
+// Fetch, it does not fail on non-200 status codes.
+func Head(ctx context.Context, rawURL string, opts FetchOptions) (*HeadInfo, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return nil, fmt.Errorf("invalid URL: missing scheme or host")
+	}
+	if opts.AllowURL != nil {
+		if err := opts.AllowURL(parsedURL); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := newRequest(ctx, http.MethodHead, rawURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := newClient(opts).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	resp.Body.Close()
+
+	info := &HeadInfo{
+		URL:           resp.Request.URL.String(),
+		StatusCode:    resp.StatusCode,
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: resp.ContentLength,
+	}
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = lastModified
+	}
+	return info, nil
+}
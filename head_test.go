@@ -0,0 +1,39 @@
+package webfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/doc.pdf", http.StatusMovedPermanently)
+			return
+		}
+		if r.Method != http.MethodHead {
+			t.Errorf("expected HEAD request, got %s", r.Method)
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Length", "2048")
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+	}))
+	defer server.Close()
+
+	info, err := Head(context.Background(), server.URL+"/old", FetchOptions{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.URL != server.URL+"/doc.pdf" || info.StatusCode != http.StatusOK {
+		t.Errorf("unexpected final URL or status: %+v", info)
+	}
+	if info.ContentType != "application/pdf" || info.ContentLength != 2048 {
+		t.Errorf("unexpected content type or length: %+v", info)
+	}
+	if info.LastModified.Year() != 2015 {
+		t.Errorf("expected last modified in 2015, got %v", info.LastModified)
+	}
+}
@@ -0,0 +1,82 @@
+package webfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFetch_HostHeaders(t *testing.T) {
+	type seen struct{ apiKey, userAgent string }
+	var otherSeen []seen
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherSeen = append(otherSeen, seen{r.Header.Get("X-Api-Key"), r.Header.Get("User-Agent")})
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Other</p>"))
+	}))
+	defer other.Close()
+
+	var internalSeen []seen
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		internalSeen = append(internalSeen, seen{r.Header.Get("X-Api-Key"), r.Header.Get("User-Agent")})
+		if r.URL.Path == "/away" {
+			http.Redirect(w, r, other.URL+"/page", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Internal</p>"))
+	}))
+	defer internal.Close()
+	internalURL, _ := url.Parse(internal.URL)
+
+	opts := FetchOptions{
+		Timeout:   5 * time.Second,
+		UserAgent: "agent/1.0",
+		Headers:   map[string]string{"X-Api-Key": "from-call"},
+		HostHeaders: func(u *url.URL) map[string]string {
+			if u.Host == internalURL.Host {
+				return map[string]string{"X-Api-Key": "secret", "User-Agent": "internal/1.0"}
+			}
+			return nil
+		},
+	}
+	tests := []struct {
+		name          string
+		path          string
+		expected      []seen
+		expectedOther []seen
+	}{
+		{name: "matching host", path: "/page", expected: []seen{{"secret", "internal/1.0"}}},
+		{
+			name:          "redirect to another host",
+			path:          "/away",
+			expected:      []seen{{"secret", "internal/1.0"}},
+			expectedOther: []seen{{"", "agent/1.0"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			internalSeen, otherSeen = nil, nil
+			if _, err := Fetch(context.Background(), internal.URL+tt.path, opts); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(internalSeen, tt.expected) || !slices.Equal(otherSeen, tt.expectedOther) {
+				t.Errorf("expected headers %v and %v on the other host, got %v and %v", tt.expected, tt.expectedOther, internalSeen, otherSeen)
+			}
+		})
+	}
+
+	// Other hosts get the headers of the call
+	otherSeen = nil
+	if _, err := Fetch(context.Background(), other.URL, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(otherSeen) != 1 || otherSeen[0] != (seen{"from-call", "agent/1.0"}) {
+		t.Errorf("expected the headers of the call, got %v", otherSeen)
+	}
+}
@@ -0,0 +1,96 @@
+package webfetch
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// languageTag matches a BCP 47 language tag, also accepting underscores as
+// separators
+var languageTag = regexp.MustCompile(`^[A-Za-z]{1,8}(?:[-_][A-Za-z0-9]{1,8})*$`)
+
+// primaryLanguage returns the lowercase primary subtag of language
+func primaryLanguage(language string) string {
+	language = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(language), "_", "-"))
+	primary, _, _ := strings.Cut(language, "-")
+	return primary
+}
+
+// sameLanguage reports whether the language tags a and b have the same
+// primary language, e.g. "en-US" and "en"
+func sameLanguage(a, b string) bool {
+	return primaryLanguage(a) == primaryLanguage(b)
+}
+
+// acceptLanguage returns the Accept-Language header value preferring
+// language, then its primary language
+func acceptLanguage(language string) string {
+	language = strings.ReplaceAll(language, "_", "-")
+	if primary := primaryLanguage(language); primary != strings.ToLower(language) {
+		return language + ", " + primary + ";q=0.9"
+	}
+	return language
+}
+
+// matchHreflang returns the hreflang of alternates best matching language: the
+// same tag, else its primary language, else the first tag in that language
+func matchHreflang(alternates map[string]string, language string) (string, bool) {
+	language = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(language), "_", "-"))
+	if language == "" || len(alternates) == 0 {
+		return "", false
+	}
+	if _, ok := alternates[language]; ok {
+		return language, true
+	}
+	primary := primaryLanguage(language)
+	if _, ok := alternates[primary]; ok {
+		return primary, true
+	}
+
+	tags := make([]string, 0, len(alternates))
+	for tag := range alternates {
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, primary+"-") {
+			return tag, true
+		}
+	}
+	return "", false
+}
+
+// fetchLanguageVariant returns the alternate version of doc in opts.Language,
+// fetching it if it is another page. It returns doc when the page has no such
+// alternate or it cannot be fetched.
+func fetchLanguageVariant(ctx context.Context, doc *Document, opts FetchOptions, extract *extraction, info *FetchInfo) *Document {
+	hreflang, ok := matchHreflang(doc.Metadata.Alternates, opts.Language)
+	if !ok {
+		return doc
+	}
+
+	variantURL := doc.Metadata.Alternates[hreflang]
+	parsedURL, err := url.Parse(variantURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+		return doc
+	}
+	current, err := url.Parse(doc.URL)
+	if err == nil && canonicalURL(parsedURL, nil).String() == canonicalURL(current, nil).String() {
+		doc.Metadata.Hreflang = hreflang
+		return doc
+	}
+
+	var variantInfo FetchInfo
+	variant, err := fetch(ctx, variantURL, parsedURL, opts, extract, &variantInfo)
+	info.Bytes += variantInfo.Bytes
+	if err != nil {
+		return doc
+	}
+	info.StatusCode = variantInfo.StatusCode
+	info.cachePolicy = variantInfo.cachePolicy
+	variant.Metadata.Hreflang = hreflang
+	return variant
+}
@@ -0,0 +1,109 @@
+package webfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_matchHreflang(t *testing.T) {
+	alternates := map[string]string{
+		"en":        "https://example.com/en/",
+		"fr-ca":     "https://example.com/fr-ca/",
+		"fr-fr":     "https://example.com/fr-fr/",
+		"pt":        "https://example.com/pt/",
+		"x-default": "https://example.com/",
+	}
+
+	tests := []struct {
+		language string
+		expected string
+		ok       bool
+	}{
+		{language: "en", expected: "en", ok: true},
+		{language: "FR-CA", expected: "fr-ca", ok: true},
+		{language: "fr", expected: "fr-ca", ok: true},
+		{language: "pt_BR", expected: "pt", ok: true},
+		{language: "de", ok: false},
+		{language: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.language, func(t *testing.T) {
+			got, ok := matchHreflang(alternates, tt.language)
+			if got != tt.expected || ok != tt.ok {
+				t.Errorf("expected %q, %t, got %q, %t", tt.expected, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestFetch_Language(t *testing.T) {
+	var server *httptest.Server
+	var acceptLanguage string
+	page := func(lang, content string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			acceptLanguage = r.Header.Get("Accept-Language")
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html lang="` + lang + `"><head>
+<link rel="alternate" hreflang="en" href="/en">
+<link rel="alternate" hreflang="de" href="` + server.URL + `/de">
+<link rel="alternate" hreflang="es" href="/missing">
+</head><body><p>` + content + `</p></body></html>`))
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/en", page("en", "Hello"))
+	mux.HandleFunc("/de", page("de", "Hallo"))
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		language string
+		content  string
+		url      string
+		hreflang string
+		accept   string
+		mismatch bool
+	}{
+		{name: "no preference", content: "Hello", url: server.URL + "/en"},
+		{name: "current page", language: "en-US", content: "Hello", url: server.URL + "/en", hreflang: "en", accept: "en-US, en;q=0.9"},
+		{name: "alternate fetched", language: "de", content: "Hallo", url: server.URL + "/de", hreflang: "de", accept: "de"},
+		{name: "no matching alternate", language: "ja", content: "Hello", url: server.URL + "/en", accept: "ja", mismatch: true},
+		{name: "failed alternate falls back", language: "pt_BR", content: "Hello", url: server.URL + "/en", accept: "pt-BR, pt;q=0.9", mismatch: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Fetch(context.Background(), server.URL+"/en", FetchOptions{Timeout: 5 * time.Second, Language: tt.language})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if doc.Content != tt.content || doc.URL != tt.url || doc.Metadata.Hreflang != tt.hreflang {
+				t.Errorf("expected %q from %s (hreflang %q), got %q from %s (hreflang %q)",
+					tt.content, tt.url, tt.hreflang, doc.Content, doc.URL, doc.Metadata.Hreflang)
+			}
+			if acceptLanguage != tt.accept {
+				t.Errorf("expected Accept-Language %q, got %q", tt.accept, acceptLanguage)
+			}
+			if doc.Metadata.RequestedLanguage != tt.language || doc.Metadata.LanguageMismatch != tt.mismatch {
+				t.Errorf("expected requested language %q (mismatch %t), got %q (mismatch %t)",
+					tt.language, tt.mismatch, doc.Metadata.RequestedLanguage, doc.Metadata.LanguageMismatch)
+			}
+			if len(doc.Metadata.Alternates) != 3 {
+				t.Errorf("expected 3 alternates, got %v", doc.Metadata.Alternates)
+			}
+		})
+	}
+}
+
+func TestFetch_InvalidLanguage(t *testing.T) {
+	_, err := Fetch(context.Background(), "https://example.com", FetchOptions{Language: "en\r\nX-Injected: 1"})
+	if err == nil || !strings.Contains(err.Error(), "invalid language") {
+		t.Errorf("expected invalid language error, got %v", err)
+	}
+}
@@ -2,14 +2,19 @@ package webfetch
 
 import (
 	// "bytes"
+	"cmp"
 	"fmt"
 	"io"
 	"net/url"
+	"slices"
 	"strings"
 
 	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
 	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/base"
 	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/commonmark"
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 // tagsToRemove contains HTML tags that typically contain non-content elements
@@ -48,6 +53,7 @@ var htmlConverter = converter.NewConverter(
 		base.NewBasePlugin(),
 		commonmark.NewCommonmarkPlugin(),
 		&removeTagsPlugin{tags: tagsToRemove},
+		&entityPlugin{},
 	),
 )
 
@@ -60,14 +66,499 @@ func isHTMLContentType(contentType string) bool {
 // convertHTMLToMarkdown converts HTML content to Markdown, removing non-content elements
 // and resolving relative URLs to absolute using the provided base URL.
 func convertHTMLToMarkdown(r io.Reader, baseURL *url.URL) (string, error) {
-	// Build domain string for absolute URL resolution
-	domain := fmt.Sprintf("%s://%s", baseURL.Scheme, baseURL.Host)
+	doc, err := convertHTML(r, baseURL, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	return doc.Content, nil
+}
+
+// extraction holds the compiled selectors that restrict which parts of a page are
+// converted, and the tracking parameters stripped from its links
+type extraction struct {
+	include cascadia.SelectorGroup
+	exclude []cascadia.SelectorGroup
+	// fragment is the id of the section converted when there is no include selector
+	fragment string
+	// trackingParams are the patterns of the parameters removed from link URLs
+	trackingParams []string
+}
+
+// newExtraction compiles the selectors of opts. Without include selector, only
+// the section identified by fragment is converted, if the page has it. It
+// returns nil if there is nothing to extract.
+func newExtraction(opts FetchOptions, fragment string) (*extraction, error) {
+	// Text fragments (#:~:text=) do not identify an element
+	if strings.HasPrefix(fragment, ":~:") {
+		fragment = ""
+	}
+	if opts.Selector == "" && len(opts.ExcludeSelectors) == 0 && fragment == "" && !opts.StripTrackingLinks {
+		return nil, nil
+	}
+
+	e := &extraction{fragment: fragment}
+	if opts.StripTrackingLinks {
+		e.trackingParams = trackingParams(opts)
+	}
+	if opts.Selector != "" {
+		sel, err := cascadia.ParseGroup(opts.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", opts.Selector, err)
+		}
+		e.include = sel
+	}
+	for _, s := range opts.ExcludeSelectors {
+		sel, err := cascadia.ParseGroup(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude selector %q: %w", s, err)
+		}
+		e.exclude = append(e.exclude, sel)
+	}
+	return e, nil
+}
+
+// apply removes the excluded elements from root and, if an include selector is set,
+// returns a new root containing only the matching elements.
+func (e *extraction) apply(root *html.Node) (*html.Node, error) {
+	for _, sel := range e.exclude {
+		for _, n := range cascadia.QueryAll(root, sel) {
+			if n.Parent != nil {
+				n.Parent.RemoveChild(n)
+			}
+		}
+	}
+
+	if e.include == nil {
+		if e.fragment != "" {
+			if section := fragmentSection(root, e.fragment); section != nil {
+				return newBody(section), nil
+			}
+		}
+		return root, nil
+	}
+
+	matches := cascadia.QueryAll(root, e.include)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("selector matched no elements")
+	}
+
+	// Skip matches nested in an earlier one
+	var selected []*html.Node
+	for _, n := range matches {
+		if slices.ContainsFunc(selected, func(s *html.Node) bool { return isAncestor(s, n) }) {
+			continue
+		}
+		selected = append(selected, n)
+	}
+	return newBody(selected), nil
+}
+
+// newBody returns a document whose body holds nodes, moved from their tree
+func newBody(nodes []*html.Node) *html.Node {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	for _, n := range nodes {
+		if n.Parent != nil {
+			n.Parent.RemoveChild(n)
+		}
+		body.AppendChild(n)
+	}
+
+	doc := &html.Node{Type: html.DocumentNode}
+	doc.AppendChild(body)
+	return doc
+}
+
+// headingLevel returns the level of a h1-h6 element, or 0 for other nodes
+func headingLevel(n *html.Node) int {
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		return int(n.Data[1] - '0')
+	}
+	return 0
+}
+
+// fragmentSection returns the nodes of the section of root identified by
+// fragment, or nil if no element has that id or anchor name. A heading starts a
+// section running until the next heading of the same or a higher level; any
+// other element is a section on its own.
+func fragmentSection(root *html.Node, fragment string) []*html.Node {
+	target := findElement(root, func(n *html.Node) bool {
+		return getAttr(n, "id") == fragment || (n.DataAtom == atom.A && getAttr(n, "name") == fragment)
+	})
+	if target == nil {
+		return nil
+	}
+
+	// An anchor inside a heading identifies the heading, and an empty anchor
+	// the element following it
+	for p := target.Parent; p != nil; p = p.Parent {
+		if headingLevel(p) > 0 {
+			target = p
+			break
+		}
+	}
+	if strings.TrimSpace(textContent(target)) == "" {
+		next := target.NextSibling
+		for next != nil && next.Type != html.ElementNode {
+			next = next.NextSibling
+		}
+		if next == nil {
+			return nil
+		}
+		target = next
+	}
+
+	level := headingLevel(target)
+	if level == 0 {
+		return []*html.Node{target}
+	}
+	section := []*html.Node{target}
+	for n := target.NextSibling; n != nil; n = n.NextSibling {
+		if l := headingLevel(n); l > 0 && l <= level {
+			break
+		}
+		section = append(section, n)
+	}
+	return section
+}
+
+// isAncestor reports whether a is a proper ancestor of n.
+func isAncestor(a, n *html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p == a {
+			return true
+		}
+	}
+	return false
+}
+
+// documentBase returns the URL that relative URLs of the document root fetched
+// from baseURL resolve against: the href of its first <base> element, if any.
+func documentBase(root *html.Node, baseURL *url.URL) *url.URL {
+	base := findElement(root, func(n *html.Node) bool { return n.DataAtom == atom.Base && hasAttr(n, "href") })
+	if base == nil {
+		return baseURL
+	}
+	u, err := baseURL.Parse(strings.TrimSpace(getAttr(base, "href")))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return baseURL
+	}
+	return u
+}
+
+// resolveURLs makes the link, image and media URLs of n and its descendants
+// absolute, resolving them against baseURL
+func resolveURLs(n *html.Node, baseURL *url.URL) {
+	if n.Type == html.ElementNode {
+		for i, attr := range n.Attr {
+			if attr.Key != "href" && attr.Key != "src" && attr.Key != "poster" {
+				continue
+			}
+			if u, err := baseURL.Parse(strings.TrimSpace(attr.Val)); err == nil {
+				n.Attr[i].Val = u.String()
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		resolveURLs(c, baseURL)
+	}
+}
+
+// stripLinkTracking removes the query parameters matching patterns from the
+// href of the links of n and its descendants
+func stripLinkTracking(n *html.Node, patterns []string) {
+	if n.Type == html.ElementNode && (n.DataAtom == atom.A || n.DataAtom == atom.Area) {
+		for i, attr := range n.Attr {
+			if attr.Key != "href" {
+				continue
+			}
+			if u, err := url.Parse(strings.TrimSpace(attr.Val)); err == nil {
+				if stripped := stripTrackingURL(u, patterns); stripped != u {
+					n.Attr[i].Val = stripped.String()
+				}
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		stripLinkTracking(c, patterns)
+	}
+}
 
-	// Convert HTML to Markdown with domain for absolute URL resolution
-	markdownBytes, err := htmlConverter.ConvertReader(r, converter.WithDomain(domain))
+// convertHTML parses HTML content into a Document: the title and links are extracted
+// from the full page before the optional extraction selectors are applied and the
+// remaining tree is converted to Markdown. If iframes is not nil, the remaining
+// same-origin iframes are inlined.
+func convertHTML(r io.Reader, baseURL *url.URL, extract *extraction, iframes *iframeInliner) (*Document, error) {
+	counter := &countingReader{r: r}
+	root, err := html.Parse(counter)
 	if err != nil {
-		return "", fmt.Errorf("failed to convert HTML to Markdown: %w", err)
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	flattenShadowRoots(root)
+	decodeEmails(root)
+	repairEntities(root)
+	baseURL = documentBase(root, baseURL)
+	if extract != nil && len(extract.trackingParams) > 0 {
+		stripLinkTracking(root, extract.trackingParams)
+	}
+
+	// The converter mutates the tree, so extract everything we need first
+	doc := &Document{
+		Title:     extractTitle(root),
+		Links:     extractLinks(root, baseURL),
+		Citations: extractCitations(root, baseURL),
+		Metadata:  extractMetadata(root, baseURL),
+	}
+	doc.Metadata.Quality = assessQuality(root, counter.n)
+
+	if extract != nil {
+		if root, err = extract.apply(root); err != nil {
+			return nil, err
+		}
+	}
+	if iframes != nil {
+		iframes.inline(root, baseURL)
+	}
+	convertMedia(root, baseURL)
+
+	// Convert HTML to Markdown, resolving relative URLs against the document base
+	markdownBytes, err := htmlConverter.ConvertNode(root, converter.WithDomain(baseURL.String()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert HTML to Markdown: %w", err)
+	}
+	doc.Content = string(markdownBytes)
+
+	return doc, nil
+}
+
+// flattenShadowRoots replaces the elements hosting a declarative shadow root
+// (<template shadowrootmode>) with their shadow tree, as a browser renders them:
+// light DOM children are moved into the matching <slot> elements, and slots
+// without assigned nodes keep their fallback content.
+func flattenShadowRoots(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		flattenShadowRoots(c)
+	}
+
+	var shadow *html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.DataAtom == atom.Template &&
+			(hasAttr(c, "shadowrootmode") || hasAttr(c, "shadowroot")) {
+			shadow = c
+			break
+		}
+	}
+	if shadow == nil {
+		return
+	}
+
+	// Group the light DOM children by the slot they are assigned to
+	assigned := make(map[string][]*html.Node)
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		n.RemoveChild(c)
+		if c != shadow {
+			name := ""
+			if c.Type == html.ElementNode {
+				name = getAttr(c, "slot")
+			}
+			assigned[name] = append(assigned[name], c)
+		}
+		c = next
+	}
+
+	var slots []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Slot {
+			slots = append(slots, n)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(shadow)
+
+	for _, slot := range slots {
+		nodes := assigned[getAttr(slot, "name")]
+		if len(nodes) == 0 {
+			continue
+		}
+		for c := slot.FirstChild; c != nil; c = slot.FirstChild {
+			slot.RemoveChild(c)
+		}
+		for _, node := range nodes {
+			slot.AppendChild(node)
+		}
+	}
+
+	for c := shadow.FirstChild; c != nil; c = shadow.FirstChild {
+		shadow.RemoveChild(c)
+		n.AppendChild(c)
+	}
+}
+
+// hasAttr reports whether n has the named attribute.
+func hasAttr(n *html.Node, key string) bool {
+	return slices.ContainsFunc(n.Attr, func(attr html.Attribute) bool { return attr.Key == key })
+}
+
+// findElement returns the first element in document order for which match returns true.
+func findElement(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if n.Type == html.ElementNode && match(n) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// textContent returns the concatenated text of n and its descendants.
+func textContent(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+// getAttr returns the value of the named attribute of n, or "" if it is not set.
+func getAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// extractTitle returns the whitespace-normalized content of the <title> element,
+// falling back to the first <h1> when the page has no title.
+func extractTitle(root *html.Node) string {
+	for _, a := range []atom.Atom{atom.Title, atom.H1} {
+		n := findElement(root, func(n *html.Node) bool { return n.DataAtom == a })
+		if n == nil {
+			continue
+		}
+		if title := strings.Join(strings.Fields(textContent(n)), " "); title != "" {
+			return title
+		}
+	}
+	return ""
+}
+
+// extractMetadata collects page metadata from the html lang attribute and the meta
+// and link elements. Standard meta names take precedence over OpenGraph properties.
+func extractMetadata(root *html.Node, baseURL *url.URL) Metadata {
+	var md Metadata
+	var og Metadata
+
+	// resolve makes a URL found in the page absolute
+	resolve := func(ref string) string {
+		if u, err := baseURL.Parse(strings.TrimSpace(ref)); err == nil {
+			return u.String()
+		}
+		return ref
+	}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Html:
+				md.Language = strings.TrimSpace(getAttr(n, "lang"))
+			case atom.Meta:
+				content := strings.TrimSpace(getAttr(n, "content"))
+				switch strings.ToLower(getAttr(n, "name")) {
+				case "description":
+					md.Description = content
+				case "author":
+					md.Author = content
+				case "robots":
+					md.Robots = mergeRobotsDirectives(md.Robots, parseRobotsDirectives(content))
+				}
+				switch strings.ToLower(getAttr(n, "property")) {
+				case "og:description":
+					og.Description = content
+				case "og:site_name":
+					og.SiteName = content
+				case "og:image":
+					og.Image = resolve(content)
+				case "og:locale":
+					og.Language = content
+				case "article:published_time":
+					og.PublishedTime = content
+				case "article:author":
+					og.Author = content
+				}
+			case atom.Link:
+				rel := strings.Fields(strings.ToLower(getAttr(n, "rel")))
+				if slices.Contains(rel, "canonical") {
+					md.Canonical = resolve(getAttr(n, "href"))
+				}
+				hreflang := strings.ToLower(strings.TrimSpace(getAttr(n, "hreflang")))
+				if slices.Contains(rel, "alternate") && hreflang != "" && getAttr(n, "href") != "" {
+					if md.Alternates == nil {
+						md.Alternates = make(map[string]string)
+					}
+					md.Alternates[hreflang] = resolve(getAttr(n, "href"))
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+
+	// Fill in the gaps from OpenGraph
+	md.Description = cmp.Or(md.Description, og.Description)
+	md.Language = cmp.Or(md.Language, og.Language)
+	md.Author = cmp.Or(md.Author, og.Author)
+	md.SiteName = og.SiteName
+	md.Image = og.Image
+	md.PublishedTime = og.PublishedTime
+
+	return md
+}
+
+// extractLinks returns the absolute http(s) URLs of all <a href> elements,
+// resolved against baseURL, with fragments removed and duplicates dropped.
+func extractLinks(root *html.Node, baseURL *url.URL) []string {
+	var links []string
+	seen := make(map[string]bool)
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			if href := strings.TrimSpace(getAttr(n, "href")); href != "" {
+				if u, err := baseURL.Parse(href); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+					u.Fragment = ""
+					u.RawFragment = ""
+					if link := u.String(); !seen[link] {
+						seen[link] = true
+						links = append(links, link)
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
 	}
+	walk(root)
 
-	return string(markdownBytes), nil
+	return links
 }
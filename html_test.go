@@ -2,6 +2,7 @@ package webfetch
 
 import (
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -112,6 +113,359 @@ func Test_convertHTMLToMarkdown(t *testing.T) {
 	}
 }
 
+func Test_convertHTML(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com/docs/")
+
+	html := `<html><head><title>  Page
+Title </title></head><body>
+<a href="intro#setup">Intro</a>
+<a href="/about">About</a>
+<a href="intro">Intro again</a>
+<a href="mailto:someone@example.com">Mail</a>
+<a href="https://other.example/x">Other</a>
+</body></html>`
+
+	doc, err := convertHTML(strings.NewReader(html), baseURL, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if doc.Title != "Page Title" {
+		t.Errorf("expected title %q, got %q", "Page Title", doc.Title)
+	}
+
+	expectedLinks := []string{
+		"https://example.com/docs/intro",
+		"https://example.com/about",
+		"https://other.example/x",
+	}
+	if strings.Join(doc.Links, " ") != strings.Join(expectedLinks, " ") {
+		t.Errorf("expected links %v, got %v", expectedLinks, doc.Links)
+	}
+
+	if !strings.Contains(doc.Content, "[About](https://example.com/about)") {
+		t.Errorf("expected content to contain absolute link, got %q", doc.Content)
+	}
+}
+
+func Test_convertHTML_BaseElement(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com/blog/post")
+
+	tests := []struct {
+		name     string
+		html     string
+		expected string
+		link     string
+	}{
+		{
+			name:     "no base",
+			html:     `<a href="next">Next</a>`,
+			expected: "[Next](https://example.com/blog/next)",
+			link:     "https://example.com/blog/next",
+		},
+		{
+			name:     "relative base",
+			html:     `<head><base href="/docs/v2/"></head><a href="next">Next</a> <img src="a.png" alt="A">`,
+			expected: "[Next](https://example.com/docs/v2/next) ![A](https://example.com/docs/v2/a.png)",
+			link:     "https://example.com/docs/v2/next",
+		},
+		{
+			name:     "absolute base",
+			html:     `<base href="https://cdn.example.org/site/"><a href="next">Next</a>`,
+			expected: "[Next](https://cdn.example.org/site/next)",
+			link:     "https://cdn.example.org/site/next",
+		},
+		{
+			name:     "non-http base ignored",
+			html:     `<base href="javascript:void(0)"><a href="next">Next</a>`,
+			expected: "[Next](https://example.com/blog/next)",
+			link:     "https://example.com/blog/next",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := convertHTML(strings.NewReader(tt.html), baseURL, nil, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if doc.Content != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, doc.Content)
+			}
+			if len(doc.Links) != 1 || doc.Links[0] != tt.link {
+				t.Errorf("expected links [%s], got %v", tt.link, doc.Links)
+			}
+		})
+	}
+}
+
+func Test_extractTitle_FallsBackToH1(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com")
+
+	doc, err := convertHTML(strings.NewReader("<h1>Heading</h1><p>Body</p>"), baseURL, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if doc.Title != "Heading" {
+		t.Errorf("expected title %q, got %q", "Heading", doc.Title)
+	}
+}
+
+func Test_extractMetadata(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com/blog/post")
+
+	page := `<html lang="fr"><head>
+<title>Post</title>
+<meta name="description" content="A post about things">
+<meta property="og:description" content="OpenGraph description">
+<meta name="author" content="Jane Doe">
+<meta property="og:site_name" content="Example Blog">
+<meta property="og:image" content="/img/cover.png">
+<meta property="article:published_time" content="2024-05-01T10:00:00Z">
+<link rel="canonical" href="/blog/post-canonical">
+</head><body><p>Body</p></body></html>`
+
+	doc, err := convertHTML(strings.NewReader(page), baseURL, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := Metadata{
+		Description:   "A post about things",
+		Language:      "fr",
+		Canonical:     "https://example.com/blog/post-canonical",
+		Author:        "Jane Doe",
+		SiteName:      "Example Blog",
+		Image:         "https://example.com/img/cover.png",
+		PublishedTime: "2024-05-01T10:00:00Z",
+	}
+	// The quality is covered by TestAssessQuality
+	doc.Metadata.Quality = nil
+	if !reflect.DeepEqual(doc.Metadata, expected) {
+		t.Errorf("expected metadata %+v, got %+v", expected, doc.Metadata)
+	}
+}
+
+func Test_extractMetadata_OpenGraphFallback(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com")
+
+	page := `<head><meta property="og:description" content="OG only"><meta property="og:locale" content="de_DE"></head>`
+
+	doc, err := convertHTML(strings.NewReader(page), baseURL, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if doc.Metadata.Description != "OG only" || doc.Metadata.Language != "de_DE" {
+		t.Errorf("expected OpenGraph fallbacks, got %+v", doc.Metadata)
+	}
+}
+
+func Test_convertHTML_Selectors(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com")
+
+	page := `<html><head><title>Page</title></head><body>
+<div id="sidebar"><a href="/other">Other</a></div>
+<div id="content"><p>Article text</p><div class="comments">First!</div></div>
+<div class="note"><p>Note one</p></div>
+<div class="note"><p>Note two</p></div>
+</body></html>`
+
+	tests := []struct {
+		name           string
+		opts           FetchOptions
+		expectedOutput []string
+		notExpected    []string
+		expectedError  string
+	}{
+		{
+			name:           "selector keeps only matching element",
+			opts:           FetchOptions{Selector: "#content"},
+			expectedOutput: []string{"Article text", "First!"},
+			notExpected:    []string{"Other", "Note one"},
+		},
+		{
+			name:           "selector group keeps all matches in order",
+			opts:           FetchOptions{Selector: ".note, #content"},
+			expectedOutput: []string{"Article text", "Note one", "Note two"},
+			notExpected:    []string{"Other"},
+		},
+		{
+			name:           "exclude selectors drop elements",
+			opts:           FetchOptions{ExcludeSelectors: []string{".comments", "#sidebar"}},
+			expectedOutput: []string{"Article text", "Note one"},
+			notExpected:    []string{"First!", "Other"},
+		},
+		{
+			name:           "selector combined with exclude",
+			opts:           FetchOptions{Selector: "#content", ExcludeSelectors: []string{".comments"}},
+			expectedOutput: []string{"Article text"},
+			notExpected:    []string{"First!", "Note one"},
+		},
+		{
+			name:          "selector without match",
+			opts:          FetchOptions{Selector: "#missing"},
+			expectedError: "selector matched no elements",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extract, err := newExtraction(tt.opts, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			doc, err := convertHTML(strings.NewReader(page), baseURL, extract, nil)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, exp := range tt.expectedOutput {
+				if !strings.Contains(doc.Content, exp) {
+					t.Errorf("expected output to contain %q, got %q", exp, doc.Content)
+				}
+			}
+			for _, notExp := range tt.notExpected {
+				if strings.Contains(doc.Content, notExp) {
+					t.Errorf("output should not contain %q, got %q", notExp, doc.Content)
+				}
+			}
+			if doc.Title != "Page" {
+				t.Errorf("expected title from full page, got %q", doc.Title)
+			}
+		})
+	}
+}
+
+func Test_convertHTMLToMarkdown_ShadowRoots(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com")
+
+	tests := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{
+			name:     "open shadow root",
+			html:     `<x-card><template shadowrootmode="open"><h2>Shadow title</h2></template></x-card>`,
+			expected: "## Shadow title",
+		},
+		{
+			name: "named and default slots",
+			html: `<x-card><template shadowrootmode="open"><h2><slot name="title"></slot></h2><slot></slot><p>End</p></template>` +
+				`<p>Body</p><span slot="title">Card</span></x-card>`,
+			expected: "## Card\n\nBody\n\nEnd",
+		},
+		{
+			name:     "fallback content of unassigned slot",
+			html:     `<x-card><template shadowrootmode="open"><p><slot name="title">Untitled</slot></p></template></x-card>`,
+			expected: "Untitled",
+		},
+		{
+			name: "nested shadow roots",
+			html: `<x-outer><template shadowrootmode="open"><x-inner><template shadowrootmode="open"><p>Inner <slot></slot></p></template>` +
+				`<slot></slot></x-inner></template><em>light</em></x-outer>`,
+			expected: "Inner *light*",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := convertHTMLToMarkdown(strings.NewReader(tt.html), baseURL)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func Test_convertHTML_Fragment(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com/docs")
+
+	page := `<h1>Guide</h1><p>Intro</p>
+<h2 id="install">Install</h2><p>Run it.</p><h3>From source</h3><p>Build it.</p>
+<h2><span id="usage">Usage</span></h2><p>Use it.</p>
+<a id="faq"></a><h2>FAQ</h2><p>Ask.</p>
+<div id="note"><p>A note.</p></div><p>After the note.</p>`
+
+	tests := []struct {
+		name     string
+		fragment string
+		expected string
+	}{
+		{
+			name:     "heading section up to same level",
+			fragment: "install",
+			expected: "## Install\n\nRun it.\n\n### From source\n\nBuild it.",
+		},
+		{
+			name:     "element inside heading",
+			fragment: "usage",
+			expected: "## Usage\n\nUse it.",
+		},
+		{
+			name:     "empty anchor before heading",
+			fragment: "faq",
+			expected: "## FAQ\n\nAsk.\n\nA note.\n\nAfter the note.",
+		},
+		{
+			name:     "element",
+			fragment: "note",
+			expected: "A note.",
+		},
+		{
+			name:     "missing fragment falls back to the page",
+			fragment: "missing",
+			expected: "# Guide",
+		},
+		{
+			name:     "text fragment ignored",
+			fragment: ":~:text=Ask",
+			expected: "# Guide",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extract, err := newExtraction(FetchOptions{}, tt.fragment)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			doc, err := convertHTML(strings.NewReader(page), baseURL, extract, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.HasPrefix(doc.Content, tt.expected) {
+				t.Errorf("expected content to start with %q, got %q", tt.expected, doc.Content)
+			}
+			if doc.Title != "Guide" {
+				t.Errorf("expected title from the full page, got %q", doc.Title)
+			}
+		})
+	}
+}
+
+func Test_newExtraction_InvalidSelector(t *testing.T) {
+	_, err := newExtraction(FetchOptions{Selector: "div["}, "")
+	if err == nil || !strings.Contains(err.Error(), "invalid selector") {
+		t.Errorf("expected invalid selector error, got %v", err)
+	}
+
+	_, err = newExtraction(FetchOptions{ExcludeSelectors: []string{"##"}}, "")
+	if err == nil || !strings.Contains(err.Error(), "invalid exclude selector") {
+		t.Errorf("expected invalid exclude selector error, got %v", err)
+	}
+}
+
 func Test_isHTMLContentType(t *testing.T) {
 	tests := []struct {
 		contentType string
@@ -0,0 +1,139 @@
+package webfetch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// maxIframeSize is the maximum size of an iframe document that is inlined (2MB)
+const maxIframeSize = 2 * 1024 * 1024
+
+// maxIframes is the maximum number of iframes inlined in a page
+const maxIframes = 10
+
+// iframeInliner fetches same-origin iframe documents and replaces the iframes
+// with their content. Iframes of inlined documents are not followed.
+type iframeInliner struct {
+	ctx    context.Context
+	client *http.Client
+	opts   FetchOptions
+	// bytes is the number of iframe body bytes read
+	bytes int64
+}
+
+func newIframeInliner(ctx context.Context, client *http.Client, opts FetchOptions) *iframeInliner {
+	opts.Raw = false
+	return &iframeInliner{ctx: ctx, client: client, opts: opts}
+}
+
+// inline replaces the same-origin iframes of root with a blockquote holding a
+// marker and the body of the iframe document. Other iframes, and those that
+// cannot be fetched, are left to be removed by the converter.
+func (f *iframeInliner) inline(root *html.Node, baseURL *url.URL) {
+	var iframes []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Iframe {
+			iframes = append(iframes, n)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+
+	inlined := 0
+	for _, iframe := range iframes {
+		if inlined == maxIframes || iframe.Parent == nil {
+			break
+		}
+		src, err := baseURL.Parse(getAttr(iframe, "src"))
+		if err != nil || getAttr(iframe, "src") == "" || src.Scheme != baseURL.Scheme || src.Host != baseURL.Host {
+			continue
+		}
+		src.Fragment = ""
+
+		body, err := f.fetch(src)
+		if err != nil {
+			continue
+		}
+		inlined++
+
+		// <blockquote><p><em>Inlined iframe: <a>src</a></em></p>...body...</blockquote>
+		quote := &html.Node{Type: html.ElementNode, Data: "blockquote", DataAtom: atom.Blockquote}
+		marker := &html.Node{Type: html.ElementNode, Data: "p", DataAtom: atom.P}
+		em := &html.Node{Type: html.ElementNode, Data: "em", DataAtom: atom.Em}
+		link := &html.Node{
+			Type: html.ElementNode, Data: "a", DataAtom: atom.A,
+			Attr: []html.Attribute{{Key: "href", Val: src.String()}},
+		}
+		link.AppendChild(&html.Node{Type: html.TextNode, Data: src.String()})
+		em.AppendChild(&html.Node{Type: html.TextNode, Data: "Inlined iframe: "})
+		em.AppendChild(link)
+		marker.AppendChild(em)
+		quote.AppendChild(marker)
+		for c := body.FirstChild; c != nil; c = body.FirstChild {
+			body.RemoveChild(c)
+			quote.AppendChild(c)
+		}
+		iframe.Parent.InsertBefore(quote, iframe)
+		iframe.Parent.RemoveChild(iframe)
+	}
+}
+
+// fetch requests the iframe document at src and returns its parsed body
+func (f *iframeInliner) fetch(src *url.URL) (*html.Node, error) {
+	if f.opts.AllowURL != nil {
+		if err := f.opts.AllowURL(src); err != nil {
+			return nil, err
+		}
+	}
+	req, err := newRequest(f.ctx, http.MethodGet, src.String(), f.opts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !isHTMLContentType(contentType) {
+		return nil, fmt.Errorf("unsupported content type: %s", contentType)
+	}
+
+	body := &countingReader{r: io.LimitReader(resp.Body, maxIframeSize+1)}
+	defer func() { f.bytes += body.n }()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxIframeSize {
+		return nil, fmt.Errorf("iframe too large")
+	}
+
+	root, err := html.Parse(decodeHTML(bytes.NewReader(data), resp.Header.Get("Content-Type")))
+	if err != nil {
+		return nil, err
+	}
+	flattenShadowRoots(root)
+	decodeEmails(root)
+	// Relative URLs of the iframe document do not resolve against the page
+	resolveURLs(root, documentBase(root, resp.Request.URL))
+	bodyNode := findElement(root, func(n *html.Node) bool { return n.DataAtom == atom.Body })
+	if bodyNode == nil {
+		return nil, fmt.Errorf("iframe has no body")
+	}
+	return bodyNode, nil
+}
@@ -0,0 +1,70 @@
+package webfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetch_InlineIframes(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<p>Page</p>
+<iframe src="/changelog"></iframe>
+<iframe src="https://other.example/embed"></iframe>
+<iframe src="/missing"></iframe>`))
+	})
+	mux.HandleFunc("/changelog", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><h2>v1.2</h2><iframe src="/nested"></iframe></body></html>`))
+	})
+	mux.HandleFunc("/nested", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("iframes of inlined documents should not be fetched")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		inline      bool
+		expected    []string
+		notExpected []string
+	}{
+		{
+			name:        "dropped by default",
+			notExpected: []string{"v1.2", "Inlined iframe"},
+		},
+		{
+			name:        "same-origin inlined",
+			inline:      true,
+			expected:    []string{"> *Inlined iframe: [" + server.URL + "/changelog](" + server.URL + "/changelog)*", "> ## v1.2"},
+			notExpected: []string{"other.example", "missing"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Fetch(context.Background(), server.URL, FetchOptions{
+				Timeout:       5 * time.Second,
+				InlineIframes: tt.inline,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, exp := range tt.expected {
+				if !strings.Contains(doc.Content, exp) {
+					t.Errorf("expected content to contain %q, got %q", exp, doc.Content)
+				}
+			}
+			for _, notExp := range tt.notExpected {
+				if strings.Contains(doc.Content, notExp) {
+					t.Errorf("content should not contain %q, got %q", notExp, doc.Content)
+				}
+			}
+		})
+	}
+}
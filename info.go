@@ -0,0 +1,196 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+)
+
+const (
+	// infoBlockSize is the size of the ranges requested to read PDF details
+	infoBlockSize = 64 * 1024
+	// maxInfoBytes is the maximum number of bytes of a PDF downloaded by Info
+	maxInfoBytes = 1024 * 1024
+)
+
+// errInfoBudget stops reading PDF details once maxInfoBytes are downloaded
+var errInfoBudget = errors.New("PDF details need too many bytes")
+
+// DocumentInfo describes a document without downloading it.
+type DocumentInfo struct {
+	// URL is the final URL after redirects.
+	URL string `json:"url"`
+	// ContentType is the Content-Type header.
+	ContentType string `json:"content_type,omitempty"`
+	// Size is the size of the document in bytes, or -1 if unknown.
+	Size int64 `json:"size"`
+	// LastModified is the Last-Modified header, or the zero time if absent.
+	LastModified time.Time `json:"last_modified,omitzero"`
+	// Pages is the page count of a PDF, or 0 if it could not be read.
+	Pages int `json:"pages,omitempty"`
+	// Title is the title of a PDF from its document information, if any.
+	Title string `json:"title,omitempty"`
+}
+
+// Info returns the content type, size and last modification time of rawURL
+// from a HEAD request, falling back to a one byte ranged GET for servers that
+// do not support HEAD. For PDFs, it also reads the page count and title with
+// ranged GET requests, downloading the cross-reference table and the few
+// objects needed rather than the whole document; they are left out when the
+// server does not support ranges.
+func Info(ctx context.Context, rawURL string, opts FetchOptions) (*DocumentInfo, error) {
+	head, err := Head(ctx, rawURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	if head.StatusCode == http.StatusMethodNotAllowed || head.StatusCode == http.StatusNotImplemented {
+		if head, err = rangeHead(ctx, rawURL, opts); err != nil {
+			return nil, err
+		}
+	}
+	if head.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", head.StatusCode)
+	}
+
+	info := &DocumentInfo{
+		URL:          head.URL,
+		ContentType:  head.ContentType,
+		Size:         head.ContentLength,
+		LastModified: head.LastModified,
+	}
+	if isPDFContentType(info.ContentType) && info.Size > 0 {
+		ra := &rangeReaderAt{ctx: ctx, url: info.URL, opts: opts, client: newClient(opts), blocks: make(map[int64][]byte)}
+		info.Pages, info.Title = pdfInfo(ra, info.Size)
+	}
+	return info, nil
+}
+
+// rangeHead requests the first byte of rawURL to learn its headers, reporting
+// the total size of partial responses as the content length
+func rangeHead(ctx context.Context, rawURL string, opts FetchOptions) (*HeadInfo, error) {
+	req, err := newRequest(ctx, http.MethodGet, rawURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err := newClient(opts).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	resp.Body.Close()
+
+	head := &HeadInfo{
+		URL:           resp.Request.URL.String(),
+		StatusCode:    resp.StatusCode,
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: -1,
+	}
+	if resp.StatusCode == http.StatusPartialContent {
+		head.StatusCode = http.StatusOK
+		if _, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/"); ok {
+			if size, err := strconv.ParseInt(total, 10, 64); err == nil {
+				head.ContentLength = size
+			}
+		}
+	} else if resp.StatusCode == http.StatusOK {
+		head.ContentLength = resp.ContentLength
+	}
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		head.LastModified = lastModified
+	}
+	return head, nil
+}
+
+// pdfInfo reads the page count and title of the PDF read from ra, or zero
+// values if they cannot be read
+func pdfInfo(ra io.ReaderAt, size int64) (pages int, title string) {
+	// The parser panics on malformed documents and failed reads
+	defer func() {
+		if r := recover(); r != nil {
+			pages, title = 0, ""
+		}
+	}()
+	r, err := pdf.NewReader(ra, size)
+	if err != nil {
+		return 0, ""
+	}
+	return r.NumPage(), strings.TrimSpace(r.Trailer().Key("Info").Key("Title").Text())
+}
+
+// rangeReaderAt reads a remote document with ranged GET requests of
+// infoBlockSize bytes, caching the blocks read
+type rangeReaderAt struct {
+	ctx        context.Context
+	url        string
+	opts       FetchOptions
+	client     *http.Client
+	blocks     map[int64][]byte
+	downloaded int64
+}
+
+func (r *rangeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		index := (off + int64(n)) / infoBlockSize
+		block, err := r.block(index)
+		if err != nil {
+			return n, err
+		}
+		start := off + int64(n) - index*infoBlockSize
+		if start >= int64(len(block)) {
+			return n, io.EOF
+		}
+		n += copy(p[n:], block[start:])
+	}
+	return n, nil
+}
+
+// block returns the block at index, requesting it if needed
+func (r *rangeReaderAt) block(index int64) ([]byte, error) {
+	if block, ok := r.blocks[index]; ok {
+		return block, nil
+	}
+	if r.downloaded >= maxInfoBytes {
+		return nil, errInfoBudget
+	}
+	parsedURL, err := url.Parse(r.url)
+	if err != nil {
+		return nil, err
+	}
+	if r.opts.AllowURL != nil {
+		if err := r.opts.AllowURL(parsedURL); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := newRequest(r.ctx, http.MethodGet, r.url, r.opts)
+	if err != nil {
+		return nil, err
+	}
+	start := index * infoBlockSize
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, start+infoBlockSize-1))
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// A server ignoring the range would send the whole document
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("ranges not supported: status %d", resp.StatusCode)
+	}
+	block, err := io.ReadAll(io.LimitReader(resp.Body, infoBlockSize))
+	if err != nil {
+		return nil, err
+	}
+	r.downloaded += int64(len(block))
+	r.blocks[index] = block
+	return block, nil
+}
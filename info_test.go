@@ -0,0 +1,96 @@
+package webfetch
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInfo(t *testing.T) {
+	// Pad the document so that reading its details does not download it all
+	padding := "% " + strings.Repeat("x", 300*1024) + "\n"
+	pdf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>\n"+padding,
+		"<< /Title (Annual Report) >>",
+	)
+	pdf = bytes.Replace(pdf, []byte("/Root 1 0 R"), []byte("/Root 1 0 R /Info 5 0 R"), 1)
+	modified := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	var downloaded atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/nohead" && r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		if r.URL.Path == "/noranges" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(pdf)))
+			if r.Method == http.MethodGet {
+				w.Write(pdf)
+			}
+			return
+		}
+		cw := &countingWriter{ResponseWriter: w, n: &downloaded}
+		http.ServeContent(cw, r, "", modified, bytes.NewReader(pdf))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		expected DocumentInfo
+	}{
+		{
+			name:     "ranges",
+			path:     "/report.pdf",
+			expected: DocumentInfo{ContentType: "application/pdf", Size: int64(len(pdf)), LastModified: modified, Pages: 2, Title: "Annual Report"},
+		},
+		{
+			name:     "HEAD not allowed",
+			path:     "/nohead",
+			expected: DocumentInfo{ContentType: "application/pdf", Size: int64(len(pdf)), LastModified: modified, Pages: 2, Title: "Annual Report"},
+		},
+		{
+			name:     "no ranges",
+			path:     "/noranges",
+			expected: DocumentInfo{ContentType: "application/pdf", Size: int64(len(pdf))},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			downloaded.Store(0)
+			info, err := Info(context.Background(), server.URL+tt.path, FetchOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tt.expected.URL = server.URL + tt.path
+			if *info != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, *info)
+			}
+			if n := downloaded.Load(); n > 4*infoBlockSize {
+				t.Errorf("expected a fraction of the %d bytes to be downloaded, got %d", len(pdf), n)
+			}
+		})
+	}
+}
+
+// countingWriter counts the body bytes written to n
+type countingWriter struct {
+	http.ResponseWriter
+	n *atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n.Add(int64(len(p)))
+	return w.ResponseWriter.Write(p)
+}
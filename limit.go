@@ -0,0 +1,114 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrRequestQueueTimeout is returned when an outbound request waited longer
+// than the queue timeout of its RequestLimiter.
+var ErrRequestQueueTimeout = errors.New("timed out waiting for an outbound request slot")
+
+// RequestLimiter caps the number of simultaneous outbound requests made by
+// every Fetch, Head and robots.txt request sharing it. Requests over the cap
+// wait in a queue. A request holds its slot until its body is read or closed.
+// It is safe for concurrent use.
+type RequestLimiter struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+	waiting      atomic.Int64
+}
+
+// NewRequestLimiter returns a limiter allowing max simultaneous requests.
+// Requests waiting longer than queueTimeout, if positive, fail with
+// ErrRequestQueueTimeout.
+func NewRequestLimiter(max int, queueTimeout time.Duration) *RequestLimiter {
+	return &RequestLimiter{slots: make(chan struct{}, max), queueTimeout: queueTimeout}
+}
+
+// InFlight returns the number of requests holding a slot.
+func (l *RequestLimiter) InFlight() int {
+	return len(l.slots)
+}
+
+// Waiting returns the number of requests waiting for a slot.
+func (l *RequestLimiter) Waiting() int {
+	return int(l.waiting.Load())
+}
+
+// acquire waits for a slot until ctx is done or the queue timeout expires
+func (l *RequestLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	l.waiting.Add(1)
+	defer l.waiting.Add(-1)
+	var timeout <-chan time.Time
+	if l.queueTimeout > 0 {
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timeout:
+		return ErrRequestQueueTimeout
+	}
+}
+
+// release frees a slot
+func (l *RequestLimiter) release() {
+	<-l.slots
+}
+
+// limitedTransport makes the requests of base within the slots of limiter
+type limitedTransport struct {
+	base    http.RoundTripper
+	limiter *RequestLimiter
+}
+
+func (t limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.acquire(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		t.limiter.release()
+		return nil, err
+	}
+	resp.Body = &slotBody{ReadCloser: resp.Body, release: t.limiter.release}
+	return resp, nil
+}
+
+// slotBody releases the slot of its request once read to the end or closed, so
+// that requests made while converting the body, e.g. for iframes, do not wait
+// for it
+type slotBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *slotBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.once.Do(b.release)
+	}
+	return n, err
+}
+
+func (b *slotBody) Close() error {
+	b.once.Do(b.release)
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,59 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetch_RequestLimiter(t *testing.T) {
+	started := make(chan struct{}, 1)
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-unblock
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Hello</p>"))
+	}))
+	defer server.Close()
+
+	limiter := NewRequestLimiter(1, 200*time.Millisecond)
+	opts := FetchOptions{RequestLimiter: limiter}
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := Fetch(context.Background(), server.URL+"/slow", opts)
+		slow <- err
+	}()
+	<-started
+
+	// The slow request holds the only slot
+	if _, err := Fetch(context.Background(), server.URL+"/fast", opts); !errors.Is(err, ErrRequestQueueTimeout) {
+		t.Errorf("expected ErrRequestQueueTimeout, got %v", err)
+	}
+
+	// A queued request gets the slot once it is released
+	queued := make(chan error, 1)
+	go func() {
+		_, err := Fetch(context.Background(), server.URL+"/fast", FetchOptions{RequestLimiter: limiter})
+		queued <- err
+	}()
+	for limiter.Waiting() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(unblock)
+
+	for name, ch := range map[string]chan error{"slow": slow, "queued": queued} {
+		if err := <-ch; err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+	if limiter.InFlight() != 0 || limiter.Waiting() != 0 {
+		t.Errorf("expected no request in flight or waiting, got %d and %d", limiter.InFlight(), limiter.Waiting())
+	}
+}
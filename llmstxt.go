@@ -0,0 +1,126 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// LLMsTxt describes the llms.txt file of a site, a Markdown index of the
+// content its authors curated for language models (see https://llmstxt.org).
+type LLMsTxt struct {
+	// URL is the URL of the llms.txt file, or empty when the site has none.
+	URL string `json:"url,omitempty"`
+	// Title is the name of the site or project, from the H1 heading.
+	Title string `json:"title,omitempty"`
+	// Summary is the short description in the blockquote following the title.
+	Summary string `json:"summary,omitempty"`
+	// Links are the curated pages listed in the file.
+	Links []LLMsTxtLink `json:"links,omitempty"`
+	// Content is the Markdown of the file.
+	Content string `json:"-"`
+	// FullURL is the URL of the llms-full.txt file, holding the curated
+	// content itself in one document, or empty when the site has none.
+	FullURL string `json:"full_url,omitempty"`
+	// FullSize is the size in bytes of llms-full.txt, or -1 if unknown.
+	FullSize int64 `json:"full_size,omitempty"`
+}
+
+// LLMsTxtLink is a page listed in an llms.txt file.
+type LLMsTxtLink struct {
+	// Section is the H2 heading the link is listed under.
+	Section string `json:"section,omitempty"`
+	// Title is the text of the link.
+	Title string `json:"title"`
+	// URL is the absolute URL of the page.
+	URL string `json:"url"`
+	// Description is the note following the link, if any.
+	Description string `json:"description,omitempty"`
+	// Optional is set for links of the Optional section, which can be skipped
+	// when a shorter context is needed.
+	Optional bool `json:"optional,omitempty"`
+}
+
+// llmsTxtLink matches the list items of an llms.txt file: "- [title](url): description"
+var llmsTxtLink = regexp.MustCompile(`^[-*+]\s+\[([^\]]+)\]\(([^)\s]+)\)(?:\s*:\s*(.*))?$`)
+
+// DiscoverLLMsTxt looks for the llms.txt and llms-full.txt files at the root
+// of the site of rawURL. llms.txt is fetched and parsed with Fetch, so opts
+// applies, while the presence of llms-full.txt is checked with a HEAD request.
+// A site without the files yields an LLMsTxt with empty URLs.
+func DiscoverLLMsTxt(ctx context.Context, rawURL string, opts FetchOptions) (*LLMsTxt, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return nil, fmt.Errorf("invalid URL: missing scheme or host")
+	}
+	root := &url.URL{Scheme: parsedURL.Scheme, Host: parsedURL.Host}
+	opts.Raw = true
+
+	result := &LLMsTxt{}
+	indexURL := root.JoinPath("llms.txt")
+	doc, err := Fetch(ctx, indexURL.String(), opts)
+	var statusErr *StatusError
+	switch {
+	case errors.As(err, &statusErr):
+		// The site has no llms.txt
+	case err != nil:
+		return nil, err
+	case isLLMsTxtDocument(doc):
+		parsed := ParseLLMsTxt(doc.Content, indexURL)
+		parsed.URL = indexURL.String()
+		result = parsed
+	}
+
+	fullURL := root.JoinPath("llms-full.txt").String()
+	if head, err := Head(ctx, fullURL, opts); err == nil && head.StatusCode == http.StatusOK && !isHTMLContentType(head.ContentType) {
+		result.FullURL = fullURL
+		result.FullSize = head.ContentLength
+	}
+	return result, nil
+}
+
+// isLLMsTxtDocument reports whether doc, fetched raw, is a text file rather
+// than an HTML page served for any path
+func isLLMsTxtDocument(doc *Document) bool {
+	return doc.Encoding == "" && !isHTMLContentType(doc.ContentType) && !strings.HasPrefix(strings.TrimSpace(doc.Content), "<")
+}
+
+// ParseLLMsTxt parses the Markdown of an llms.txt file, resolving its links
+// against base.
+func ParseLLMsTxt(content string, base *url.URL) *LLMsTxt {
+	result := &LLMsTxt{Content: content}
+	var section string
+	var summary []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "# ") && result.Title == "":
+			result.Title = strings.TrimSpace(line[2:])
+		case strings.HasPrefix(line, "## "):
+			section = strings.TrimSpace(line[3:])
+		case strings.HasPrefix(line, ">") && section == "":
+			summary = append(summary, strings.TrimSpace(line[1:]))
+		default:
+			m := llmsTxtLink.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			link := LLMsTxtLink{Section: section, Title: m[1], URL: m[2], Description: m[3], Optional: strings.EqualFold(section, "Optional")}
+			if base != nil {
+				if resolved, err := base.Parse(m[2]); err == nil {
+					link.URL = resolved.String()
+				}
+			}
+			result.Links = append(result.Links, link)
+		}
+	}
+	result.Summary = strings.Join(summary, " ")
+	return result
+}
@@ -0,0 +1,107 @@
+package webfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+const testLLMsTxt = `# FastHTML
+
+> FastHTML is a python library which brings together Starlette, Uvicorn, HTMX,
+> and fastcore's FT "FastTags" into a library for creating server-rendered hypermedia applications.
+
+Important notes:
+
+- Although parts of its API are inspired by FastAPI, it is not compatible with FastAPI syntax
+
+## Docs
+
+- [FastHTML quick start](https://fastht.ml/docs/tutorials/quickstart_for_web_devs.html.md): A brief overview of many FastHTML features
+- [HTMX reference](/docs/htmx.md)
+
+## Optional
+
+- [Starlette full documentation](https://gist.githubusercontent.com/starlette.md): A subset of the Starlette documentation
+`
+
+func TestParseLLMsTxt(t *testing.T) {
+	base, _ := url.Parse("https://fastht.ml/llms.txt")
+	got := ParseLLMsTxt(testLLMsTxt, base)
+
+	expected := &LLMsTxt{
+		Title:   "FastHTML",
+		Summary: "FastHTML is a python library which brings together Starlette, Uvicorn, HTMX, and fastcore's FT \"FastTags\" into a library for creating server-rendered hypermedia applications.",
+		Links: []LLMsTxtLink{
+			{Section: "Docs", Title: "FastHTML quick start", URL: "https://fastht.ml/docs/tutorials/quickstart_for_web_devs.html.md", Description: "A brief overview of many FastHTML features"},
+			{Section: "Docs", Title: "HTMX reference", URL: "https://fastht.ml/docs/htmx.md"},
+			{Section: "Optional", Title: "Starlette full documentation", URL: "https://gist.githubusercontent.com/starlette.md", Description: "A subset of the Starlette documentation", Optional: true},
+		},
+		Content: testLLMsTxt,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestDiscoverLLMsTxt(t *testing.T) {
+	tests := []struct {
+		name          string
+		handler       http.HandlerFunc
+		expectedIndex bool
+		expectedFull  bool
+	}{
+		{
+			name: "both files",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.Write([]byte(testLLMsTxt))
+			},
+			expectedIndex: true,
+			expectedFull:  true,
+		},
+		{
+			name: "only llms-full.txt",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/llms.txt" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", "text/markdown")
+				w.Write([]byte("# Everything"))
+			},
+			expectedFull: true,
+		},
+		{
+			name: "HTML served for every path",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				w.Write([]byte("<html><body>App</body></html>"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site := httptest.NewServer(tt.handler)
+			defer site.Close()
+
+			got, err := DiscoverLLMsTxt(context.Background(), site.URL+"/docs/page", FetchOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (got.URL == site.URL+"/llms.txt") != tt.expectedIndex || (got.URL != "") != tt.expectedIndex {
+				t.Errorf("expected llms.txt %v, got %q", tt.expectedIndex, got.URL)
+			}
+			if tt.expectedIndex && len(got.Links) != 3 {
+				t.Errorf("expected 3 links, got %d", len(got.Links))
+			}
+			if (got.FullURL == site.URL+"/llms-full.txt") != tt.expectedFull || (got.FullURL != "") != tt.expectedFull {
+				t.Errorf("expected llms-full.txt %v, got %q", tt.expectedFull, got.FullURL)
+			}
+		})
+	}
+}
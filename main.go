@@ -2,66 +2,864 @@ package webfetch
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptrace"
+	"net/netip"
 	"net/url"
+	"strings"
 	"time"
 )
 
+// DefaultUserAgent is the User-Agent sent when FetchOptions.UserAgent is empty.
+const DefaultUserAgent = "webfetch/1.0"
+
+// DefaultMaxRedirects is the number of redirects followed when
+// FetchOptions.MaxRedirects is zero, as in net/http.
+const DefaultMaxRedirects = 10
+
+// CacheMode selects how Fetch uses FetchOptions.Cache.
+type CacheMode string
+
+const (
+	// CacheDefault serves cached documents and caches fetched ones.
+	CacheDefault CacheMode = ""
+	// CacheBypass fetches the document without reading or writing the cache.
+	CacheBypass CacheMode = "bypass"
+	// CacheOnly serves cached documents and never fetches: Fetch returns an
+	// error wrapping ErrNotCached for documents not in the cache.
+	CacheOnly CacheMode = "only"
+	// CacheRefresh fetches the document and replaces the cached copy.
+	CacheRefresh CacheMode = "refresh"
+)
+
+// CacheStatus reports how Fetch used FetchOptions.Cache for a document.
+type CacheStatus string
+
+const (
+	// CacheHit is a document served from the cache without a request.
+	CacheHit CacheStatus = "hit"
+	// CacheMiss is a document fetched because it was not in the cache, or
+	// was refreshed with CacheRefresh.
+	CacheMiss CacheStatus = "miss"
+	// CacheRevalidated is a cached document served after a conditional
+	// request answered 304 Not Modified (see Cache.SetRevalidation).
+	CacheRevalidated CacheStatus = "revalidated"
+	// CacheBypassed is a document fetched with CacheBypass.
+	CacheBypassed CacheStatus = "bypass"
+)
+
+// FetchOptions configures how a URL is fetched and converted.
+type FetchOptions struct {
+	// Timeout bounds the whole request, including reading the response body.
+	Timeout time.Duration
+	// ConnectTimeout, if positive, bounds resolving the host and opening the
+	// connection of each request, so that unreachable hosts fail fast.
+	ConnectTimeout time.Duration
+	// TLSHandshakeTimeout, if positive, bounds the TLS handshake of each
+	// connection. It defaults to 10 seconds.
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout, if positive, bounds the wait for the response
+	// headers once the request is sent.
+	ResponseHeaderTimeout time.Duration
+	// BodyReadTimeout, if positive, bounds the wait for each part of the
+	// response body, so that a server that stops sending fails with
+	// ErrBodyReadTimeout while one that streams slowly is read until Timeout.
+	BodyReadTimeout time.Duration
+	// Headers are added to the outgoing request, overriding the defaults.
+	Headers map[string]string
+	// UserAgent overrides DefaultUserAgent.
+	UserAgent string
+	// MaxRedirects is the number of redirects followed before failing,
+	// DefaultMaxRedirects if zero. Redirects are not followed if negative.
+	MaxRedirects int
+	// HostHeaders, if set, returns headers added to the requests to u, e.g.
+	// the credentials of its host, overriding Headers and UserAgent. They are
+	// looked up again for each redirect, so that they are not forwarded to
+	// other hosts.
+	HostHeaders func(u *url.URL) map[string]string
+
+	// Selector is a CSS selector restricting HTML conversion to the matching elements.
+	Selector string
+	// ExcludeSelectors are CSS selectors for HTML elements dropped before conversion.
+	ExcludeSelectors []string
+
+	// Language, if set, is a preferred language tag (e.g. "fr" or "pt-BR"). It is
+	// sent in the Accept-Language header, unless Headers set one. When an HTML
+	// page declares an alternate version in that language with <link
+	// rel="alternate" hreflang>, that version is fetched instead.
+	Language string
+
+	// IgnoreFragment converts the whole page of a URL with a fragment, instead
+	// of only the section starting at the element the fragment identifies.
+	IgnoreFragment bool
+
+	// InlineIframes replaces same-origin iframes of HTML pages with the content of
+	// their documents, instead of dropping them. Iframes of the inlined documents
+	// are not followed.
+	InlineIframes bool
+
+	// Render, if set, renders HTML pages in a browser, running their scripts,
+	// and the rendered document is converted instead of the response body,
+	// so that pages building their content client-side are not empty. The
+	// browser loads the page and its resources itself, outside of AllowURL,
+	// AllowIP, Resolver and RequestLimiter.
+	Render RenderFunc
+
+	// StripTrackingLinks removes the tracking parameters, e.g. utm_source, from
+	// the links of HTML pages: the Markdown links, Links and Citations.
+	StripTrackingLinks bool
+
+	// StripTrackingURL removes the tracking parameters from rawURL before
+	// fetching it. Document.URL is the stripped URL.
+	StripTrackingURL bool
+
+	// TrackingParams, if not nil, replaces the package-level TrackingParams as the
+	// patterns of the tracking parameters removed by this fetch or crawl.
+	TrackingParams []string
+
+	// Accept, if set, lists the media types preferred for the response, most
+	// preferred first, e.g. application/json then text/html for an API host.
+	// They are sent in the Accept header with decreasing quality values, in
+	// place of DefaultAccept, and the textual types among them that are not
+	// converted, such as application/json or text/csv, are returned as-is
+	// instead of refused. A major type, e.g. text/*, matches all its subtypes.
+	Accept []string
+
+	// Raw skips conversion and returns the response body as-is. Bodies of any content
+	// type are accepted; non-textual bodies are base64 encoded.
+	Raw bool
+
+	// NormalizeWhitespace trims the trailing whitespace of the lines of plain
+	// text documents and collapses their runs of blank lines. Markdown
+	// documents are always returned untouched.
+	NormalizeWhitespace bool
+
+	// Cache, if set, serves fresh documents without fetching and stores new ones.
+	Cache *Cache
+
+	// HonorNoArchive neither stores in Cache nor serves from it the documents
+	// whose robots directives ask not to keep a copy (see Metadata.NoArchive).
+	HonorNoArchive bool
+
+	// CacheMode selects how Cache is used by this call (default CacheDefault).
+	CacheMode CacheMode
+
+	// Offline serves documents only from Cache and never makes requests. Fetch
+	// returns an error wrapping ErrNotCached for documents not in the cache, and
+	// other requests, e.g. by Head, fail with ErrOffline.
+	Offline bool
+
+	// StrictContentType refuses responses whose first bytes contradict their
+	// Content-Type header or the extension of their URL, e.g. HTML served as
+	// application/pdf, with a *ContentMismatchError.
+	StrictContentType bool
+
+	// MaxDownloadSize is the maximum size in bytes of a response body that is
+	// read (default DefaultMaxDownloadSize). Larger bodies fail with a
+	// *TooLargeError.
+	MaxDownloadSize int64
+
+	// MaxDownloadSizes overrides MaxDownloadSize and MaxPDFSize per media type,
+	// e.g. text/html, or per major type, e.g. text/*.
+	MaxDownloadSizes map[string]int64
+
+	// MaxPDFSize is the maximum size in bytes of a PDF that is converted (default DefaultMaxPDFSize).
+	MaxPDFSize int64
+
+	// DisablePDF rejects PDF responses instead of converting them.
+	DisablePDF bool
+
+	// MaxPDFPages, if positive, is the maximum number of pages of a PDF that is
+	// converted. PDFs with more pages fail with a *PDFParseError.
+	MaxPDFPages int
+
+	// PDFTimeout, if positive, bounds the time spent parsing a PDF. Slower PDFs
+	// fail with a *PDFParseError wrapping ErrPDFTimeout. The parser cannot be
+	// interrupted and keeps running in the background until it is done; use
+	// PDFParser to run it in a process that can be killed.
+	PDFTimeout time.Duration
+
+	// PDFParser, if set, converts PDFs instead of ConvertPDF, e.g. in a
+	// subprocess with a memory cap so that malformed PDFs cannot take down the
+	// caller. Its errors are returned by Fetch as is.
+	PDFParser func(ctx context.Context, pdf io.Reader) (string, error)
+
+	// PDFSpoolThreshold is the size in bytes above which a PDF is spooled to a
+	// temporary file and parsed from disk instead of memory (default
+	// DefaultPDFSpoolThreshold). A negative threshold holds all PDFs in memory.
+	PDFSpoolThreshold int64
+
+	// PDFSpoolDir is the directory of the temporary files of spooled PDFs
+	// (default os.TempDir).
+	PDFSpoolDir string
+
+	// PDFFallback, if set, extracts the text of PDFs that the built-in parser
+	// fails to parse or finds no text in.
+	PDFFallback *PDFEngine
+
+	// PDFOCR, if set, recognizes the text of the PDF pages whose fonts do not
+	// map their glyphs to Unicode, such as CJK fonts without ToUnicode map,
+	// which otherwise yield no text.
+	PDFOCR OCRFunc
+
+	// AllowURL, if set, is called before requesting a URL, including each redirect
+	// target. A non-nil error aborts the fetch and is returned wrapped by Fetch.
+	AllowURL func(u *url.URL) error
+
+	// AllowIP, if set, is called with the address of each connection, once the
+	// host name is resolved. A non-nil error aborts the connection and is
+	// returned wrapped by Fetch. Connections through a proxy check the address
+	// of the proxy.
+	AllowIP func(ip netip.Addr) error
+
+	// Resolver, if set, resolves the host names of the requests instead of the
+	// system resolver. Connections through a proxy resolve the proxy with it.
+	Resolver *Resolver
+
+	// RequestLimiter, if set, caps the number of simultaneous outbound requests
+	// shared with the other calls using it. Requests that wait too long for a
+	// slot fail with ErrRequestQueueTimeout.
+	RequestLimiter *RequestLimiter
+
+	// RequestID, if set, is sent in the X-Request-Id header to correlate the request
+	// with the caller's logs. It does not affect caching.
+	RequestID string
+
+	// OnFetch, if set, is called once per Fetch call with its outcome, including
+	// fetches served from Cache.
+	OnFetch func(FetchInfo)
+
+	// transport, if set, is the transport of the Fetcher making the requests,
+	// whose connections are reused
+	transport *http.Transport
+	// revalidate, if set, is the cached entry whose validators are sent in a
+	// conditional request
+	revalidate *cacheEntry
+}
+
+// RenderFunc loads the page at rawURL in a browser and returns the HTML of
+// the document once its scripts ran.
+type RenderFunc func(ctx context.Context, rawURL string) (string, error)
+
+// OCRFunc recognizes the text of a page of a PDF document, given its data and
+// the page number starting at 1.
+type OCRFunc func(ctx context.Context, pdf []byte, page int) (string, error)
+
+// FetchInfo describes the outcome of a fetch, as reported to FetchOptions.OnFetch.
+type FetchInfo struct {
+	// URL is the requested URL.
+	URL string
+	// StatusCode is the HTTP status code, or 0 if no response was received.
+	StatusCode int
+	// Bytes is the number of response body bytes read.
+	Bytes int64
+	// Duration is the time spent fetching and converting.
+	Duration time.Duration
+	// Cached reports whether the document was served from the cache.
+	Cached bool
+	// Revalidated reports that the cached document was served after a
+	// conditional request answered 304 Not Modified.
+	Revalidated bool
+	// Resumes is the number of times the download of the body resumed with a
+	// Range request after the connection broke.
+	Resumes int
+	// ContentSize is the size in bytes of the converted content.
+	ContentSize int
+	// Timings breaks down Duration for fetches not served from the cache.
+	Timings Timings
+	// Err is the error returned by Fetch, if any.
+	Err error
+
+	// cachePolicy is how the response may be cached
+	cachePolicy cachePolicy
+}
+
+// Document is a fetched resource converted to Markdown.
+type Document struct {
+	// URL is the URL the document was fetched from.
+	URL string
+	// FinalURL is the URL the document was served from, after redirects. It
+	// is URL when the request was not redirected.
+	FinalURL string
+	// Title is the document title, if one could be determined.
+	Title string
+	// ContentType is the Content-Type of the response.
+	ContentType string
+	// Content is the converted Markdown, or the response body in raw mode.
+	Content string
+	// Encoding is "base64" when Content holds a base64 encoded binary body, otherwise empty.
+	Encoding string
+	// Links contains the absolute URLs of the links found in an HTML document,
+	// without fragments and in document order.
+	Links []string
+	// Citations holds the links in the content of an HTML document with their
+	// anchor text and surrounding sentence, in document order.
+	Citations []Citation
+	// Metadata holds the page metadata found in an HTML document.
+	Metadata Metadata
+	// ContentHash is the hex-encoded SHA-256 hash of Content.
+	ContentHash string
+	// DuplicateOf is the URL of a document with the same content, e.g. a mirror
+	// or an alias of the URL, found in the Cache or earlier in a crawl.
+	DuplicateOf string
+	// FetchedAt is when the document was fetched, before the call for documents
+	// served from the Cache.
+	FetchedAt time.Time
+	// Stale reports that the document was served from the Cache after it
+	// expired, while a fresh copy is fetched in the background (see
+	// Cache.SetStaleWhileRevalidate).
+	Stale bool
+	// CacheStatus reports how the document was obtained with the Cache, or is
+	// empty without a Cache.
+	CacheStatus CacheStatus
+}
+
+// Metadata is page metadata declared in HTML meta and link elements.
+type Metadata struct {
+	Description   string `json:"description,omitempty"`
+	Language      string `json:"language,omitempty"`
+	Canonical     string `json:"canonical,omitempty"`
+	Author        string `json:"author,omitempty"`
+	SiteName      string `json:"site_name,omitempty"`
+	Image         string `json:"image,omitempty"`
+	PublishedTime string `json:"published_time,omitempty"`
+	// Alternates maps the lowercase hreflang of the alternate language versions
+	// of the page to their URL.
+	Alternates map[string]string `json:"alternates,omitempty"`
+	// Hreflang is the alternate chosen for FetchOptions.Language, if any.
+	Hreflang string `json:"hreflang,omitempty"`
+	// RequestedLanguage is FetchOptions.Language.
+	RequestedLanguage string `json:"requested_language,omitempty"`
+	// LanguageMismatch reports that the page declares a language other than
+	// RequestedLanguage, e.g. when the site has no version in that language.
+	LanguageMismatch bool `json:"language_mismatch,omitempty"`
+	// Robots holds the lowercase directives of the X-Robots-Tag headers and the
+	// robots meta tags of the page that apply to every user agent, e.g. noindex.
+	Robots []string `json:"robots,omitempty"`
+	// PDFEngine is the engine that extracted the text of a PDF:
+	// PDFEngineBuiltin or the name of FetchOptions.PDFFallback.
+	PDFEngine string `json:"pdf_engine,omitempty"`
+	// Quality estimates how much of an HTML page is readable content.
+	Quality *Quality `json:"quality,omitempty"`
+}
+
 // FetchAndConvert fetches the URL and converts its HTML or PDF content to Markdown.
 // It removes common non-content elements from HTML and preserves links with absolute URLs.
-// For PDFs, it extracts text with page separators.
+// For PDFs, it extracts text with page separators. Plain text and Markdown
+// are returned as-is.
 func FetchAndConvert(
 	ctx context.Context,
 	rawURL string,
 	timeout time.Duration,
 ) (string, error) {
+	doc, err := Fetch(ctx, rawURL, FetchOptions{Timeout: timeout})
+	if err != nil {
+		return "", err
+	}
+	return doc.Content, nil
+}
+
+// Fetch fetches the URL and converts its HTML or PDF content to a Document.
+// It behaves like FetchAndConvert, but also reports the title and links of the
+// fetched page.
+func Fetch(ctx context.Context, rawURL string, opts FetchOptions) (*Document, error) {
 	// Validate URL
 	parsedURL, err := url.Parse(rawURL)
 	if err != nil {
-		return "", fmt.Errorf("invalid URL: %w", err)
+		return nil, fmt.Errorf("invalid URL: %w", err)
 	}
 	if parsedURL.Scheme == "" || parsedURL.Host == "" {
-		return "", fmt.Errorf("invalid URL: missing scheme or host")
+		return nil, fmt.Errorf("invalid URL: missing scheme or host")
+	}
+	if opts.Language != "" && !languageTag.MatchString(opts.Language) {
+		return nil, fmt.Errorf("invalid language: %q", opts.Language)
+	}
+	switch opts.CacheMode {
+	case CacheDefault, CacheBypass, CacheOnly, CacheRefresh:
+	default:
+		return nil, fmt.Errorf("invalid cache mode: %q", opts.CacheMode)
+	}
+	// Credentials of the URL are sent in an Authorization header, and never
+	// reported
+	if parsedURL.User != nil {
+		ctx = withURLCredentials(ctx, parsedURL)
+		rawURL = parsedURL.String()
+	}
+	// Authenticated fetches, including the pages of authenticated crawls, are
+	// neither served from nor stored in the cache, which is shared with
+	// callers without the credentials
+	if hasURLCredentials(ctx) {
+		opts.Cache = nil
+	}
+	if opts.StripTrackingURL {
+		if stripped := stripTrackingURL(parsedURL, trackingParams(opts)); stripped != parsedURL {
+			parsedURL = stripped
+			rawURL = stripped.String()
+		}
 	}
 
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: timeout,
+	// Compile extraction selectors before making the request
+	fragment := parsedURL.Fragment
+	if opts.IgnoreFragment {
+		fragment = ""
+	}
+	extract, err := newExtraction(opts, fragment)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create request with context
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	start := time.Now()
+	info := FetchInfo{URL: rawURL}
+	defer func() {
+		if opts.OnFetch != nil {
+			info.Duration = time.Since(start)
+			opts.OnFetch(info)
+		}
+	}()
+
+	// Serve from cache when possible
+	var key, canonical string
+	if opts.Cache != nil {
+		canonical = canonicalURL(parsedURL, nil).String()
+		key = cacheKey(canonical, fragment, opts)
+	}
+	if opts.Cache != nil && opts.CacheMode != CacheBypass && opts.CacheMode != CacheRefresh {
+		if doc, ok := opts.Cache.get(ctx, key); ok && !(opts.HonorNoArchive && doc.Metadata.NoArchive()) {
+			doc.CacheStatus = CacheHit
+			info.Cached = true
+			info.ContentSize = len(doc.Content)
+			if doc.Stale && !opts.Offline && opts.CacheMode != CacheOnly && opts.Cache.startRefresh(key) {
+				go func() {
+					defer opts.Cache.endRefresh(key)
+					refresh := FetchInfo{URL: rawURL}
+					refreshStart := time.Now()
+					// The refresh outlives the call
+					fetchAndCache(context.WithoutCancel(ctx), rawURL, parsedURL, opts, extract, key, canonical, &refresh)
+					if opts.OnFetch != nil {
+						refresh.Duration = time.Since(refreshStart)
+						opts.OnFetch(refresh)
+					}
+				}()
+			}
+			return doc, nil
+		}
+	}
+	if opts.Offline || opts.CacheMode == CacheOnly {
+		info.Err = fmt.Errorf("%w: %s", ErrNotCached, rawURL)
+		return nil, info.Err
+	}
+
+	return fetchAndCache(ctx, rawURL, parsedURL, opts, extract, key, canonical, &info)
+}
+
+// fetchAndCache fetches and converts rawURL, and stores the document in
+// opts.Cache, if any, under key.
+func fetchAndCache(
+	ctx context.Context,
+	rawURL string,
+	parsedURL *url.URL,
+	opts FetchOptions,
+	extract *extraction,
+	key, canonical string,
+	info *FetchInfo,
+) (*Document, error) {
+	// Cached documents that can be revalidated are only downloaded again if
+	// they changed
+	if opts.Cache != nil && opts.CacheMode == CacheDefault {
+		opts.revalidate, _ = opts.Cache.revalidation(ctx, key)
+	}
+	fetchedAt := time.Now()
+	doc, err := fetch(ctx, rawURL, parsedURL, opts, extract, info)
+	if errors.Is(err, errNotModified) {
+		return revalidated(ctx, opts, key, canonical, fetchedAt, info)
+	}
+	// The validators only apply to rawURL
+	opts.revalidate = nil
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		// Size limits are reported as such, whatever the converter hitting them
+		var tooLarge *TooLargeError
+		if errors.As(err, &tooLarge) {
+			err = tooLarge
+		}
+		info.Err = err
+		return nil, err
+	}
+	if opts.Language != "" {
+		doc = fetchLanguageVariant(ctx, doc, opts, extract, info)
+		doc.Metadata.RequestedLanguage = opts.Language
+		doc.Metadata.LanguageMismatch = doc.Metadata.Language != "" && !sameLanguage(doc.Metadata.Language, opts.Language)
 	}
+	info.ContentSize = len(doc.Content)
+	doc.ContentHash = contentHash(doc.Content)
+	doc.FetchedAt = fetchedAt
 
-	// Set a reasonable User-Agent
-	req.Header.Set("User-Agent", "webfetch/1.0")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/pdf")
+	if opts.Cache != nil && opts.CacheMode != CacheBypass && !(opts.HonorNoArchive && doc.Metadata.NoArchive()) {
+		doc.DuplicateOf = opts.Cache.set(ctx, key, canonical, doc, opts.Raw, info.cachePolicy)
+	}
+	switch {
+	case opts.Cache != nil && opts.CacheMode == CacheBypass:
+		doc.CacheStatus = CacheBypassed
+	case opts.Cache != nil:
+		doc.CacheStatus = CacheMiss
+	}
+	return doc, nil
+}
+
+// errNotModified is returned by fetch when the conditional request of
+// FetchOptions.revalidate is answered 304 Not Modified
+var errNotModified = errors.New("not modified")
+
+// revalidated renews the cached entry of opts.revalidate, confirmed current at
+// fetchedAt by a 304 Not Modified response, and returns its document.
+func revalidated(
+	ctx context.Context,
+	opts FetchOptions,
+	key, canonical string,
+	fetchedAt time.Time,
+	info *FetchInfo,
+) (*Document, error) {
+	entry := opts.revalidate
+	doc := entry.Doc
+	doc.FetchedAt = fetchedAt
+	doc.Stale = false
+	// 304 responses may leave out the validators, which stay the same
+	policy := info.cachePolicy
+	if policy.etag == "" && policy.lastModified == "" {
+		policy.etag, policy.lastModified = entry.ETag, entry.LastModified
+	}
+	doc.DuplicateOf = opts.Cache.set(ctx, key, canonical, &doc, entry.Raw, policy)
+	doc.CacheStatus = CacheRevalidated
+	info.Cached = true
+	info.Revalidated = true
+	info.ContentSize = len(doc.Content)
+	return &doc, nil
+}
+
+// StatusError is returned by Fetch when the server responds with a status
+// code other than 200 OK.
+type StatusError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// RetryAfter is the delay asked by the Retry-After header of the
+	// response, or 0 if absent.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
+// Class returns ErrorTransient for request timeouts, rate limiting and server
+// errors, and ErrorPermanent for other status codes.
+func (e *StatusError) Class() ErrorClass {
+	return classifyStatus(e.StatusCode)
+}
+
+// SupportsContentType reports whether Fetch converts responses of contentType with opts.
+func SupportsContentType(contentType string, opts FetchOptions) bool {
+	if opts.Raw {
+		return true
+	}
+	if isHTMLContentType(contentType) || (isPDFContentType(contentType) && !opts.DisablePDF) ||
+		isPlainTextContentType(contentType) || isMarkdownContentType(contentType) {
+		return true
+	}
+	return isTextContentType(contentType) && acceptsMediaType(opts.Accept, contentType)
+}
+
+// fetch performs the request and converts the response according to opts.
+func fetch(
+	ctx context.Context,
+	rawURL string,
+	parsedURL *url.URL,
+	opts FetchOptions,
+	extract *extraction,
+	info *FetchInfo,
+) (*Document, error) {
+	client := newClient(opts)
+	if opts.AllowURL != nil {
+		if err := opts.AllowURL(parsedURL); err != nil {
+			return nil, err
+		}
+	}
+
+	// Trace the connection phases
+	trace := newFetchTrace()
+	defer func() {
+		trace.mu.Lock()
+		defer trace.mu.Unlock()
+		info.Timings.DNS = trace.timings.DNS
+		info.Timings.Connect = trace.timings.Connect
+		info.Timings.TLS = trace.timings.TLS
+		info.Timings.TTFB = trace.timings.TTFB
+	}()
+	ctx = httptrace.WithClientTrace(ctx, trace.clientTrace())
+
+	// The request is cancelled when its body stalls
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := newRequest(reqCtx, http.MethodGet, rawURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	if entry := opts.revalidate; entry != nil {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
 
 	// Fetch the URL
+	var deadline time.Time
+	if opts.Timeout > 0 {
+		deadline = time.Now().Add(opts.Timeout)
+	}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch URL: %w", err)
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
 	}
 	defer resp.Body.Close()
+	info.StatusCode = resp.StatusCode
+
+	// Count the body bytes actually read and the time spent reading them; the
+	// rest of the time after the headers is conversion. Broken or stalled
+	// downloads resume where they stopped, within the timeout.
+	resp.Body = withBodyReadTimeout(resp.Body, opts.BodyReadTimeout, cancel)
+	respBody := newResumableBody(ctx, client, resp, deadline, opts.BodyReadTimeout)
+	defer respBody.Close()
+	body := &countingReader{r: respBody}
+	received := time.Now()
+	defer func() {
+		if resumable, ok := respBody.(*resumableBody); ok {
+			info.Resumes = resumable.resumes
+		}
+		info.Bytes = body.n
+		info.Timings.Read = body.elapsed
+		info.Timings.Convert = time.Since(received) - body.elapsed
+	}()
 
 	// Check status code
+	if resp.StatusCode == http.StatusNotModified && opts.revalidate != nil {
+		info.cachePolicy = responseCachePolicy(resp.Header, time.Now())
+		return nil, errNotModified
+	}
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, &StatusError{StatusCode: resp.StatusCode, RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
 	}
 
+	info.cachePolicy = responseCachePolicy(resp.Header, time.Now())
+	robots := headerRobotsDirectives(resp.Header)
+
 	// Get content type and route to appropriate converter
 	contentType := resp.Header.Get("Content-Type")
+	if !SupportsContentType(contentType, opts) {
+		if isPDFContentType(contentType) {
+			return nil, fmt.Errorf("unsupported content type: %s (PDF support is disabled)", contentType)
+		}
+		return nil, fmt.Errorf("unsupported content type: %s (expected HTML, PDF, plain text or Markdown)", contentType)
+	}
+	limited, err := limitBody(body, contentType, resp.ContentLength, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.StrictContentType {
+		if limited, err = checkContentType(limited, contentType, resp.Request.URL.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	// Plain text and Markdown need no conversion
+	if !opts.Raw && (isPlainTextContentType(contentType) || isMarkdownContentType(contentType)) {
+		doc, err := convertText(limited, contentType, resp.Request.URL, opts.NormalizeWhitespace)
+		if err != nil {
+			return nil, err
+		}
+		doc.URL = rawURL
+		doc.FinalURL = resp.Request.URL.String()
+		doc.Metadata.Robots = robots
+		return doc, nil
+	}
+
+	// Accepted types that are not converted are returned as-is
+	if opts.Raw || !isHTMLContentType(contentType) && !isPDFContentType(contentType) {
+		doc, err := readRaw(limited, contentType)
+		if err != nil {
+			return nil, err
+		}
+		doc.URL = rawURL
+		doc.FinalURL = resp.Request.URL.String()
+		doc.Metadata.Robots = robots
+		return doc, nil
+	}
 
 	if isPDFContentType(contentType) {
-		return convertPDFToMarkdown(resp.Body, resp.ContentLength)
+		spoolThreshold := opts.PDFSpoolThreshold
+		if spoolThreshold == 0 {
+			spoolThreshold = DefaultPDFSpoolThreshold
+		}
+		data, err := readPDF(limited, resp.ContentLength, MaxDownloadSize(contentType, opts), spoolThreshold, opts.PDFSpoolDir)
+		if err != nil {
+			return nil, err
+		}
+		markdown, engine, err := convertPDF(ctx, data, opts)
+		if err != nil {
+			return nil, err
+		}
+		// Pages link to the final URL, after redirects
+		markdown = linkPDFPages(markdown, resp.Request.URL)
+		return &Document{URL: rawURL, FinalURL: resp.Request.URL.String(), ContentType: contentType, Content: markdown, Metadata: Metadata{Robots: robots, PDFEngine: engine}}, nil
 	}
 
-	if isHTMLContentType(contentType) {
-		return convertHTMLToMarkdown(resp.Body, parsedURL)
+	var iframes *iframeInliner
+	if opts.InlineIframes {
+		iframes = newIframeInliner(ctx, client, opts)
+		defer func() { info.Bytes += iframes.bytes }()
+	}
+	page := decodeHTML(limited, contentType)
+	if opts.Render != nil {
+		// The page is loaded again by the browser, from its final URL
+		rendered, err := opts.Render(ctx, resp.Request.URL.String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to render page: %w", err)
+		}
+		page = strings.NewReader(rendered)
 	}
+	// Relative URLs resolve against the final URL, after redirects
+	doc, err := convertHTML(page, resp.Request.URL, extract, iframes)
+	if err != nil {
+		return nil, err
+	}
+	doc.URL = rawURL
+	doc.FinalURL = resp.Request.URL.String()
+	doc.ContentType = contentType
+	doc.Metadata.Robots = mergeRobotsDirectives(robots, doc.Metadata.Robots)
+	return doc, nil
+}
+
+// newClient returns an HTTP client applying the timeouts, redirect and address
+// checks, the resolver and the request limiter of opts.
+func newClient(opts FetchOptions) *http.Client {
+	client := &http.Client{
+		Timeout: opts.Timeout,
+	}
+	if opts.Offline {
+		client.Transport = offlineTransport{}
+	} else if opts.transport != nil {
+		client.Transport = opts.transport
+	} else if opts.AllowIP != nil || opts.Resolver != nil ||
+		opts.ConnectTimeout > 0 || opts.TLSHandshakeTimeout > 0 || opts.ResponseHeaderTimeout > 0 {
+		client.Transport = dialTransport(opts)
+	}
+	if opts.RequestLimiter != nil && !opts.Offline {
+		base := client.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		client.Transport = limitedTransport{base: base, limiter: opts.RequestLimiter}
+	}
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		limit := opts.MaxRedirects
+		if limit == 0 {
+			limit = DefaultMaxRedirects
+		}
+		if limit = max(limit, 0); len(via) > limit {
+			return fmt.Errorf("stopped after %d redirects", limit)
+		}
+		// Credentials are neither taken from redirect targets nor forwarded
+		// to other origins
+		req.URL.User = nil
+		if _, ok := credentialsFor(req.Context(), req.URL); !ok && hasURLCredentials(req.Context()) {
+			req.Header.Del("Authorization")
+		}
+		if opts.HostHeaders != nil {
+			// Headers are copied from the first request
+			for name := range opts.HostHeaders(via[0].URL) {
+				req.Header.Del(name)
+			}
+			if req.Header.Get("User-Agent") == "" {
+				req.Header.Set("User-Agent", userAgent(opts))
+			}
+			for name, value := range opts.HostHeaders(req.URL) {
+				req.Header.Set(name, value)
+			}
+		}
+		if opts.AllowURL != nil {
+			return opts.AllowURL(req.URL)
+		}
+		return nil
+	}
+	return client
+}
+
+// newRequest creates a request with the headers of opts, and the credentials
+// of the userinfo of rawURL or of the fetch in a Basic Authorization header.
+func newRequest(ctx context.Context, method, rawURL string, opts FetchOptions) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if req.URL.User != nil {
+		req = req.WithContext(withURLCredentials(ctx, req.URL))
+	}
+
+	// Set a reasonable User-Agent
+	req.Header.Set("User-Agent", userAgent(opts))
+	req.Header.Set("Accept", acceptHeader(opts.Accept))
+	if opts.Raw {
+		req.Header.Set("Accept", "*/*")
+	}
+	if opts.Language != "" {
+		req.Header.Set("Accept-Language", acceptLanguage(opts.Language))
+	}
+	for name, value := range opts.Headers {
+		req.Header.Set(name, value)
+	}
+	if opts.HostHeaders != nil {
+		for name, value := range opts.HostHeaders(req.URL) {
+			req.Header.Set(name, value)
+		}
+	}
+	if auth, ok := credentialsFor(req.Context(), req.URL); ok && req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", auth)
+	}
+	if opts.RequestID != "" {
+		req.Header.Set("X-Request-Id", opts.RequestID)
+	}
+	return req, nil
+}
+
+// userAgent returns the User-Agent of the requests made with opts
+func userAgent(opts FetchOptions) string {
+	if opts.UserAgent != "" {
+		return opts.UserAgent
+	}
+	return DefaultUserAgent
+}
+
+// countingReader counts the bytes read from r and the time spent reading them
+type countingReader struct {
+	r       io.Reader
+	n       int64
+	elapsed time.Duration
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := c.r.Read(p)
+	c.elapsed += time.Since(start)
+	c.n += int64(n)
+	return n, err
+}
 
-	return "", fmt.Errorf("unsupported content type: %s (expected HTML or PDF)", contentType)
+// contentHash returns the hex-encoded SHA-256 hash of content
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
 }
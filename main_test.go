@@ -2,9 +2,13 @@ package webfetch
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -225,6 +229,307 @@ func TestFetchAndConvert_ContextCancellation(t *testing.T) {
 	}
 }
 
+func TestFetch_Headers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>" + r.Header.Get("Referer") + " " + r.Header.Get("User-Agent") + "</p>"))
+	}))
+	defer server.Close()
+
+	doc, err := Fetch(context.Background(), server.URL, FetchOptions{
+		Timeout: 5 * time.Second,
+		Headers: map[string]string{
+			"Referer":    "https://example.com/",
+			"User-Agent": "custom/2.0",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(doc.Content, "https://example.com/ custom/2.0") {
+		t.Errorf("expected headers to be sent, got %q", doc.Content)
+	}
+}
+
+func TestFetch_AllowURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/private", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>" + r.URL.Path + "</p>"))
+	}))
+	defer server.Close()
+
+	errPrivate := errors.New("private path")
+	opts := FetchOptions{
+		Timeout: 5 * time.Second,
+		AllowURL: func(u *url.URL) error {
+			if u.Path == "/private" {
+				return errPrivate
+			}
+			return nil
+		},
+	}
+
+	if _, err := Fetch(context.Background(), server.URL+"/public", opts); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, path := range []string{"/private", "/redirect"} {
+		if _, err := Fetch(context.Background(), server.URL+path, opts); !errors.Is(err, errPrivate) {
+			t.Errorf("expected %s to be rejected, got %v", path, err)
+		}
+	}
+}
+
+func TestFetch_Redirects(t *testing.T) {
+	// /hop/N redirects to /hop/N-1, and /hop/0 to the page
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hops, ok := strings.CutPrefix(r.URL.Path, "/hop/"); ok {
+			n, _ := strconv.Atoi(hops)
+			target := "/docs/page"
+			if n > 0 {
+				target = "/hop/" + strconv.Itoa(n-1)
+			}
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<p><a href="next">Next</a></p>`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		path         string
+		maxRedirects int
+		expectedErr  string
+	}{
+		{name: "not redirected", path: "/docs/page"},
+		{name: "chained", path: "/hop/4"},
+		{name: "default limit", path: "/hop/9"},
+		{name: "over default limit", path: "/hop/10", expectedErr: "stopped after 10 redirects"},
+		{name: "custom limit", path: "/hop/2", maxRedirects: 3},
+		{name: "over custom limit", path: "/hop/3", maxRedirects: 3, expectedErr: "stopped after 3 redirects"},
+		{name: "disabled", path: "/hop/0", maxRedirects: -1, expectedErr: "stopped after 0 redirects"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Fetch(context.Background(), server.URL+tt.path, FetchOptions{Timeout: 5 * time.Second, MaxRedirects: tt.maxRedirects})
+			if tt.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+					t.Errorf("expected error %q, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if doc.URL != server.URL+tt.path || doc.FinalURL != server.URL+"/docs/page" {
+				t.Errorf("expected %s served from %s/docs/page, got %s served from %s", server.URL+tt.path, server.URL, doc.URL, doc.FinalURL)
+			}
+			// Relative links resolve against the final URL
+			if !strings.Contains(doc.Content, "("+server.URL+"/docs/next)") {
+				t.Errorf("expected a link to %s/docs/next, got %q", server.URL, doc.Content)
+			}
+		})
+	}
+}
+
+func TestFetch_AllowIP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Hello</p>"))
+	}))
+	defer server.Close()
+
+	errDenied := errors.New("address denied")
+	tests := []struct {
+		name    string
+		allowed bool
+	}{
+		{name: "allowed", allowed: true},
+		{name: "denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen []netip.Addr
+			_, err := Fetch(context.Background(), server.URL, FetchOptions{
+				Timeout: 5 * time.Second,
+				AllowIP: func(ip netip.Addr) error {
+					seen = append(seen, ip)
+					if !tt.allowed {
+						return errDenied
+					}
+					return nil
+				},
+			})
+			if tt.allowed && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tt.allowed && !errors.Is(err, errDenied) {
+				t.Errorf("expected the connection to be refused, got %v", err)
+			}
+			if len(seen) != 1 || seen[0] != netip.MustParseAddr("127.0.0.1") {
+				t.Errorf("expected AllowIP to be called with 127.0.0.1, got %v", seen)
+			}
+		})
+	}
+}
+
+func TestFetch_StripTracking(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<p>See <a href="/a?id=1&utm_source=news&ref=x">this page</a>.</p>`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		path         string
+		opts         FetchOptions
+		expectedURL  string
+		expectedLink string
+	}{
+		{
+			name:         "disabled",
+			path:         "/?utm_medium=email",
+			expectedURL:  "/?utm_medium=email",
+			expectedLink: "/a?id=1&utm_source=news&ref=x",
+		},
+		{
+			name:         "links",
+			path:         "/?utm_medium=email",
+			opts:         FetchOptions{StripTrackingLinks: true},
+			expectedURL:  "/?utm_medium=email",
+			expectedLink: "/a?id=1&ref=x",
+		},
+		{
+			name:         "URL",
+			path:         "/?q=go&utm_medium=email",
+			opts:         FetchOptions{StripTrackingURL: true},
+			expectedURL:  "/?q=go",
+			expectedLink: "/a?id=1&utm_source=news&ref=x",
+		},
+		{
+			name:         "custom patterns",
+			path:         "/?utm_medium=email",
+			opts:         FetchOptions{StripTrackingLinks: true, StripTrackingURL: true, TrackingParams: []string{"ref"}},
+			expectedURL:  "/?utm_medium=email",
+			expectedLink: "/a?id=1&utm_source=news",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Timeout = 5 * time.Second
+			doc, err := Fetch(context.Background(), server.URL+tt.path, tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if doc.URL != server.URL+tt.expectedURL {
+				t.Errorf("expected URL %q, got %q", server.URL+tt.expectedURL, doc.URL)
+			}
+			link := server.URL + tt.expectedLink
+			if !strings.Contains(doc.Content, "("+link+")") {
+				t.Errorf("expected content to link to %q, got %q", link, doc.Content)
+			}
+			if len(doc.Links) != 1 || doc.Links[0] != link {
+				t.Errorf("expected links [%s], got %v", link, doc.Links)
+			}
+			if len(doc.Citations) != 1 || doc.Citations[0].URL != link {
+				t.Errorf("expected citation of %s, got %+v", link, doc.Citations)
+			}
+		})
+	}
+}
+
+func TestFetch_RequestID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>" + r.Header.Get("X-Request-Id") + "</p>"))
+	}))
+	defer server.Close()
+
+	doc, err := Fetch(context.Background(), server.URL, FetchOptions{Timeout: 5 * time.Second, RequestID: "abc123"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if doc.Content != "abc123" {
+		t.Errorf("expected X-Request-Id abc123, got %q", doc.Content)
+	}
+}
+
+func TestFetch_RedirectResolvesAgainstFinalURL(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new/page", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/new/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="other">Other</a>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	doc, err := Fetch(context.Background(), server.URL+"/old", FetchOptions{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "[Other](" + server.URL + "/new/other)"
+	if doc.Content != expected {
+		t.Errorf("expected %q, got %q", expected, doc.Content)
+	}
+}
+
+func TestFetch_UserAgent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>" + r.Header.Get("User-Agent") + "</p>"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		userAgent string
+		expected  string
+	}{
+		{name: "default", userAgent: "", expected: DefaultUserAgent},
+		{name: "custom", userAgent: "Mozilla/5.0 (compatible; test)", expected: "Mozilla/5.0 (compatible; test)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Fetch(context.Background(), server.URL, FetchOptions{
+				Timeout:   5 * time.Second,
+				UserAgent: tt.userAgent,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(doc.Content, tt.expected) {
+				t.Errorf("expected User-Agent %q, got %q", tt.expected, doc.Content)
+			}
+		})
+	}
+}
+
+func TestFetch_DisablePDF(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-1.4"))
+	}))
+	defer server.Close()
+
+	_, err := Fetch(context.Background(), server.URL, FetchOptions{Timeout: 5 * time.Second, DisablePDF: true})
+	if err == nil || !strings.Contains(err.Error(), "PDF support is disabled") {
+		t.Errorf("expected PDF support disabled error, got %v", err)
+	}
+}
+
 func TestFetchAndConvert_PDF(t *testing.T) {
 	// Read test PDF
 	pdfData, err := os.ReadFile("testdata/test.pdf")
@@ -255,13 +560,13 @@ func TestFetchAndConvert_PDF(t *testing.T) {
 			expectedOutput: "## Page 1",
 		},
 		{
-			name: "PDF too large via Content-Length",
+			name: "content too large via Content-Length",
 			handler: func(w http.ResponseWriter, r *http.Request) {
 				w.Header().Set("Content-Type", "application/pdf")
 				w.Header().Set("Content-Length", "200000000") // 200MB
 				// Don't write anything, the Content-Length check should fail first
 			},
-			expectedError: "PDF too large",
+			expectedError: "content too large",
 		},
 	}
 
@@ -294,3 +599,42 @@ func TestFetchAndConvert_PDF(t *testing.T) {
 		})
 	}
 }
+
+func TestFetch_OnFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Hello</p>"))
+	}))
+	defer server.Close()
+
+	var infos []FetchInfo
+	opts := FetchOptions{
+		Timeout: 5 * time.Second,
+		Cache:   NewCache(time.Minute),
+		OnFetch: func(info FetchInfo) { infos = append(infos, info) },
+	}
+
+	for _, path := range []string{"/page", "/page", "/missing"} {
+		Fetch(context.Background(), server.URL+path, opts)
+	}
+
+	if len(infos) != 3 {
+		t.Fatalf("expected 3 reported fetches, got %d", len(infos))
+	}
+	if infos[0].StatusCode != http.StatusOK || infos[0].Bytes != int64(len("<p>Hello</p>")) || infos[0].Cached {
+		t.Errorf("unexpected first fetch: %+v", infos[0])
+	}
+	if infos[0].ContentSize != len("Hello") || infos[0].Timings.TTFB <= 0 || infos[0].Timings.TTFB > infos[0].Duration {
+		t.Errorf("expected content size and TTFB within duration: %+v", infos[0])
+	}
+	if !infos[1].Cached {
+		t.Errorf("expected second fetch to be cached: %+v", infos[1])
+	}
+	if infos[2].StatusCode != http.StatusNotFound || infos[2].Err == nil {
+		t.Errorf("expected failed fetch with status 404: %+v", infos[2])
+	}
+}
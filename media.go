@@ -0,0 +1,141 @@
+package webfetch
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// convertMedia replaces the <video>, <audio> and <picture> elements of root,
+// which the converter drops or renders as their fallback text, with elements it
+// converts: the poster image, a link to the media source with the labels of its
+// text tracks, and the image of a picture without an <img> fallback.
+func convertMedia(root *html.Node, baseURL *url.URL) {
+	var media []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Video, atom.Audio, atom.Picture:
+				media = append(media, n)
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+
+	// resolve makes a URL found in the page absolute
+	resolve := func(ref string) string {
+		if u, err := baseURL.Parse(strings.TrimSpace(ref)); err == nil {
+			return u.String()
+		}
+		return ref
+	}
+
+	for _, n := range media {
+		var replacement []*html.Node
+		if n.DataAtom == atom.Picture {
+			if findElement(n, func(c *html.Node) bool { return c.DataAtom == atom.Img }) != nil {
+				continue
+			}
+			src := firstSrcset(n)
+			if src == "" {
+				continue
+			}
+			replacement = append(replacement, newImage(resolve(src), getAttr(n, "title")))
+		} else {
+			replacement = mediaElements(n, resolve)
+		}
+
+		for _, r := range replacement {
+			n.Parent.InsertBefore(r, n)
+		}
+		n.Parent.RemoveChild(n)
+	}
+}
+
+// mediaElements returns the paragraphs describing a <video> or <audio> element
+func mediaElements(n *html.Node, resolve func(string) string) []*html.Node {
+	var nodes []*html.Node
+	if poster := getAttr(n, "poster"); poster != "" {
+		p := &html.Node{Type: html.ElementNode, Data: "p", DataAtom: atom.P}
+		p.AppendChild(newImage(resolve(poster), "Video poster"))
+		nodes = append(nodes, p)
+	}
+
+	src := getAttr(n, "src")
+	var tracks []string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.DataAtom {
+		case atom.Source:
+			if src == "" {
+				src = getAttr(c, "src")
+			}
+		case atom.Track:
+			label := strings.TrimSpace(getAttr(c, "label"))
+			if label == "" {
+				label = strings.TrimSpace(getAttr(c, "srclang"))
+			}
+			if label != "" {
+				tracks = append(tracks, label)
+			}
+		}
+	}
+	if src == "" {
+		return nodes
+	}
+
+	kind := "Video"
+	if n.DataAtom == atom.Audio {
+		kind = "Audio"
+	}
+	src = resolve(src)
+	text := strings.TrimSpace(getAttr(n, "title"))
+	if text == "" {
+		text = src
+	}
+
+	p := &html.Node{Type: html.ElementNode, Data: "p", DataAtom: atom.P}
+	p.AppendChild(&html.Node{Type: html.TextNode, Data: kind + ": "})
+	link := &html.Node{
+		Type: html.ElementNode, Data: "a", DataAtom: atom.A,
+		Attr: []html.Attribute{{Key: "href", Val: src}},
+	}
+	link.AppendChild(&html.Node{Type: html.TextNode, Data: text})
+	p.AppendChild(link)
+	if len(tracks) > 0 {
+		p.AppendChild(&html.Node{Type: html.TextNode, Data: " (tracks: " + strings.Join(tracks, ", ") + ")"})
+	}
+	return append(nodes, p)
+}
+
+// newImage returns an <img> element
+func newImage(src, alt string) *html.Node {
+	return &html.Node{
+		Type: html.ElementNode, Data: "img", DataAtom: atom.Img,
+		Attr: []html.Attribute{{Key: "src", Val: src}, {Key: "alt", Val: alt}},
+	}
+}
+
+// firstSrcset returns the first image candidate of the <source> elements of a
+// <picture>
+func firstSrcset(n *html.Node) string {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.DataAtom != atom.Source {
+			continue
+		}
+		candidate, _, _ := strings.Cut(getAttr(c, "srcset"), ",")
+		if fields := strings.Fields(candidate); len(fields) > 0 {
+			return fields[0]
+		}
+	}
+	return ""
+}
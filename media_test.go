@@ -0,0 +1,61 @@
+package webfetch
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func Test_convertMedia(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com/docs/")
+
+	tests := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{
+			name:     "video with poster",
+			html:     `<video src="intro.mp4" poster="intro.jpg">Your browser does not support video</video>`,
+			expected: "![Video poster](https://example.com/docs/intro.jpg)\n\nVideo: [https://example.com/docs/intro.mp4](https://example.com/docs/intro.mp4)",
+		},
+		{
+			name: "video sources and tracks",
+			html: `<video><source src="/v.webm" type="video/webm"><source src="/v.mp4">` +
+				`<track kind="captions" label="English" src="en.vtt"><track kind="subtitles" srclang="fr" src="fr.vtt"></video>`,
+			expected: "Video: [https://example.com/v.webm](https://example.com/v.webm) (tracks: English, fr)",
+		},
+		{
+			name:     "audio with title",
+			html:     `<audio src="episode.mp3" title="Episode 1"></audio>`,
+			expected: "Audio: [Episode 1](https://example.com/docs/episode.mp3)",
+		},
+		{
+			name:     "video without source",
+			html:     `<p>Before</p><video>Fallback</video>`,
+			expected: "Before",
+		},
+		{
+			name:     "picture with img",
+			html:     `<picture><source srcset="/x.webp"><img src="/x.png" alt="Diagram"></picture>`,
+			expected: "![Diagram](https://example.com/x.png)",
+		},
+		{
+			name:     "picture without img",
+			html:     `<picture><source srcset="x.webp 1x, x2.webp 2x"></picture>`,
+			expected: "![](https://example.com/docs/x.webp)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := convertHTMLToMarkdown(strings.NewReader(tt.html), baseURL)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package webfetch
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrNotCached is returned by Fetch in offline mode for documents that are not
+// in the cache.
+var ErrNotCached = errors.New("not in cache")
+
+// ErrOffline is returned for requests made in offline mode, such as Head.
+var ErrOffline = errors.New("offline mode: outbound requests are disabled")
+
+// offlineTransport is an http.RoundTripper failing every request with ErrOffline
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, ErrOffline
+}
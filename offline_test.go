@@ -0,0 +1,39 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetch_Offline(t *testing.T) {
+	var hits atomic.Int64
+	server := newCountingServer(&hits)
+	defer server.Close()
+
+	cache := NewCache(time.Minute)
+	if _, err := Fetch(context.Background(), server.URL+"/page", FetchOptions{Timeout: 5 * time.Second, Cache: cache}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	opts := FetchOptions{Timeout: 5 * time.Second, Cache: cache, Offline: true}
+	doc, err := Fetch(context.Background(), server.URL+"/page", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if doc.Content != "hit 1" {
+		t.Errorf("expected cached content %q, got %q", "hit 1", doc.Content)
+	}
+
+	if _, err := Fetch(context.Background(), server.URL+"/other", opts); !errors.Is(err, ErrNotCached) {
+		t.Errorf("expected ErrNotCached, got %v", err)
+	}
+	if _, err := Head(context.Background(), server.URL+"/page", opts); !errors.Is(err, ErrOffline) {
+		t.Errorf("expected ErrOffline, got %v", err)
+	}
+	if hits.Load() != 1 {
+		t.Errorf("expected no request in offline mode, got %d hits", hits.Load())
+	}
+}
@@ -2,18 +2,29 @@ package webfetch
 
 import (
 	"bytes"
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
+	"regexp"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/ledongthuc/pdf"
 )
 
+// DefaultMaxPDFSize is the maximum size of a PDF that is converted when
+// FetchOptions.MaxPDFSize is not set (100MB).
+const DefaultMaxPDFSize = 100 * 1024 * 1024
+
 const (
-	// maxPDFSize is the maximum size of a PDF file that can be processed (100MB)
-	maxPDFSize = 100 * 1024 * 1024
 	// maxConcurrency is the maximum concurrency allowed for extracting pages
 	maxConcurrency = 32
 )
@@ -44,58 +55,129 @@ func isPDFContentType(contentType string) bool {
 }
 
 // extractPageText extracts text from a PDF page by analyzing character positions
-// to properly reconstruct words with spaces between them.
-func extractPageText(page pdf.Page, buf *bytes.Buffer) {
-	content := page.Content()
-	if len(content.Text) == 0 {
-		return
+// to properly reconstruct words with spaces between them. It reports whether
+// the text of the page is missing because its fonts do not map their glyphs to
+// Unicode.
+func extractPageText(page pdf.Page, buf *bytes.Buffer) (unmapped bool) {
+	if hasCompositeFont(page) {
+		texts, unmapped := interpretPageText(page)
+		writePageText(texts, buf)
+		return unmapped
 	}
+	texts := page.Content().Text
+	// The library places glyphs as if all text ran left to right, which splits
+	// rotated lines into one line per glyph
+	if pageRotation(page) != 0 || hasRotatedText(texts) {
+		texts, _ = interpretPageText(page)
+	}
+	writePageText(texts, buf)
+	return false
+}
 
-	var lastText pdf.Text
-	hasLast := false
-
-	for _, t := range content.Text {
+// writePageText writes the text elements of a page, one line per run of elements
+// at the same height.
+func writePageText(texts []pdf.Text, buf *bytes.Buffer) {
+	var line []pdf.Text
+	for _, t := range texts {
 		// Skip empty strings
 		if t.S == "" {
 			continue
 		}
-
-		if !hasLast {
-			buf.WriteString(t.S)
-			lastText = t
-			hasLast = true
-			continue
-		}
+		t.S = glyphReplacer.Replace(t.S)
 
 		// Check if on different line (Y position changed significantly)
-		if abs(t.Y-lastText.Y) > 1 {
+		if len(line) > 0 && abs(t.Y-line[len(line)-1].Y) > 1 {
+			writeLine(line, buf)
 			buf.WriteString("\n")
-			buf.WriteString(t.S)
-			lastText = t
-			continue
+			line = line[:0]
 		}
+		line = append(line, t)
+	}
+	if len(line) > 0 {
+		writeLine(line, buf)
+	}
+}
 
-		// Same line - check for gap between characters
-		// If current X > last X + last W, there's a gap indicating a space
-		expectedX := lastText.X + lastText.W
-		gap := t.X - expectedX
+// writeLine writes the text elements of a line. Lines with right-to-left text
+// are laid out by position and reordered into logical order, since their
+// elements are not drawn in reading order.
+func writeLine(line []pdf.Text, buf *bytes.Buffer) {
+	rtl := slices.ContainsFunc(line, func(t pdf.Text) bool { return strings.IndexFunc(t.S, isRTL) >= 0 })
+	if !rtl {
+		writeRun(line, buf)
+		return
+	}
 
-		// Use a fraction of font size as threshold for detecting word gaps
-		// A gap of ~20% of font size typically indicates a space
-		threshold := lastText.FontSize * 0.2
-		if threshold < 1 {
-			threshold = 1
-		}
+	line = slices.Clone(line)
+	slices.SortStableFunc(line, func(a, b pdf.Text) int { return cmp.Compare(a.X, b.X) })
+	var visual bytes.Buffer
+	writeRun(line, &visual)
+	buf.WriteString(logicalOrder(visual.String()))
+}
 
-		if gap > threshold {
-			buf.WriteString(" ")
-		}
+// writeRun writes text elements laid out left to right, inserting a space where
+// the gap between two elements indicates a word break.
+func writeRun(line []pdf.Text, buf *bytes.Buffer) {
+	for i, t := range line {
+		if i > 0 {
+			last := line[i-1]
+			// Same line - check for gap between characters
+			// If current X > last X + last W, there's a gap indicating a space
+			expectedX := last.X + last.W
+			gap := t.X - expectedX
+
+			// Use a fraction of font size as threshold for detecting word gaps
+			// A gap of ~20% of font size typically indicates a space
+			threshold := last.FontSize * 0.2
+			if threshold < 1 {
+				threshold = 1
+			}
 
+			// CJK text has no spaces between words, so gaps between CJK
+			// characters come from justification or fixed-width layout
+			if gap > threshold && !(endsWithCJK(last.S) && startsWithCJK(t.S)) {
+				buf.WriteString(" ")
+			}
+		}
 		buf.WriteString(t.S)
-		lastText = t
 	}
 }
 
+// glyphReplacer expands typographic ligatures, and the private use code points
+// that some fonts map their ligature glyphs to, so that searches for "file"
+// match text set with an fi ligature.
+var glyphReplacer = strings.NewReplacer(
+	"\ufb00", "ff",
+	"\ufb01", "fi",
+	"\ufb02", "fl",
+	"\ufb03", "ffi",
+	"\ufb04", "ffl",
+	"\ufb05", "st", // long s t
+	"\ufb06", "st",
+	"\uf001", "fi", // Adobe and Apple private use ligatures
+	"\uf002", "fl",
+)
+
+// isCJK reports whether r is a Chinese or Japanese character or punctuation,
+// which are written without spaces between words. Korean uses spaces.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) ||
+		(r >= 0x3000 && r <= 0x303f) || // CJK symbols and punctuation
+		(r >= 0xff00 && r <= 0xffef) // Halfwidth and fullwidth forms
+}
+
+// startsWithCJK reports whether s starts with a CJK character
+func startsWithCJK(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return isCJK(r)
+}
+
+// endsWithCJK reports whether s ends with a CJK character
+func endsWithCJK(s string) bool {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return isCJK(r)
+}
+
 // abs returns the absolute value of a float64
 func abs(x float64) float64 {
 	if x < 0 {
@@ -104,49 +186,133 @@ func abs(x float64) float64 {
 	return x
 }
 
-// convertPDFToMarkdown extracts text from a PDF and formats it as markdown
-// with page separators between pages. It limits reading to maxPDFSize bytes.
-func convertPDFToMarkdown(r io.Reader, contentLength int64) (string, error) {
-	// Early rejection if Content-Length header indicates too large
-	if contentLength > maxPDFSize {
-		return "", fmt.Errorf("PDF too large: %d bytes (max %d bytes)", contentLength, maxPDFSize)
+// pageOCR recognizes the text of a page (starting at 1) of the PDF data
+type pageOCR func(data []byte, page int) (string, error)
+
+// ErrPDFTimeout is wrapped by the *PDFParseError returned when a PDF is not
+// converted within FetchOptions.PDFTimeout.
+var ErrPDFTimeout = errors.New("parsing timed out")
+
+// PDFParseError is returned by Fetch and ConvertPDF when a PDF cannot be
+// converted: it is malformed, the parser crashed on it, or it exceeds the
+// parsing limits.
+type PDFParseError struct {
+	// Page is the page (starting at 1) being converted when parsing failed, or
+	// 0 if the failure is not tied to a page.
+	Page int
+	// Err describes the failure.
+	Err error
+}
+
+func (e *PDFParseError) Error() string {
+	if e.Page > 0 {
+		return fmt.Sprintf("failed to parse PDF: page %d: %v", e.Page, e.Err)
 	}
+	return fmt.Sprintf("failed to parse PDF: %v", e.Err)
+}
 
-	// Get buffer from pool
-	buf := pdfBufferPool.Get().(*bytes.Buffer)
-	buf.Reset()
-	defer func() {
-		buf.Reset() // Clear data before returning to pool
-		pdfBufferPool.Put(buf)
-	}()
+func (e *PDFParseError) Unwrap() error {
+	return e.Err
+}
 
-	// Wrap reader with limit to prevent reading more than maxPDFSize + 1
-	// The +1 allows us to detect if we hit the limit
-	limitedReader := io.LimitReader(r, maxPDFSize+1)
+// ConvertPDF extracts the text of the PDF data as markdown, with page
+// separators between pages. It applies the PDFOCR, MaxPDFPages and PDFTimeout
+// options of opts, and always parses in process, ignoring PDFParser. Parser
+// crashes are returned as a *PDFParseError.
+func ConvertPDF(ctx context.Context, data []byte, opts FetchOptions) (string, error) {
+	d := newPDFData(data)
+	defer d.release()
+	return convertPDFData(ctx, d, opts)
+}
 
-	// Read PDF data into buffer
-	_, err := buf.ReadFrom(limitedReader)
-	if err != nil {
-		return "", fmt.Errorf("failed to read PDF: %w", err)
+// convertPDFData converts the PDF of d in process like ConvertPDF. On timeout,
+// the parser keeps a reference to d until it is done.
+func convertPDFData(ctx context.Context, d *pdfData, opts FetchOptions) (string, error) {
+	var ocr pageOCR
+	if opts.PDFOCR != nil {
+		ocr = func(data []byte, page int) (string, error) { return opts.PDFOCR(ctx, data, page) }
+	}
+	if opts.PDFTimeout <= 0 {
+		return pdfToMarkdown(d, ocr, opts.MaxPDFPages)
+	}
+
+	type result struct {
+		markdown string
+		err      error
+	}
+	// The parser cannot be interrupted: on timeout it keeps running in the
+	// background until it is done with d
+	done := make(chan result, 1)
+	d.retain()
+	go func() {
+		defer d.release()
+		markdown, err := pdfToMarkdown(d, ocr, opts.MaxPDFPages)
+		done <- result{markdown, err}
+	}()
+	timer := time.NewTimer(opts.PDFTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.markdown, r.err
+	case <-timer.C:
+		return "", &PDFParseError{Err: ErrPDFTimeout}
 	}
+}
 
-	// Check if we hit the limit (read more than maxPDFSize)
-	if buf.Len() > maxPDFSize {
-		return "", fmt.Errorf("PDF too large: exceeds %d bytes", maxPDFSize)
+// convertPDFToMarkdown extracts text from a PDF and formats it as markdown
+// with page separators between pages. It limits reading to maxSize bytes,
+// or DefaultMaxPDFSize if maxSize is not positive. The text of pages whose
+// fonts have no Unicode mapping comes from ocr, if set.
+func convertPDFToMarkdown(r io.Reader, contentLength int64, maxSize int64, ocr pageOCR) (string, error) {
+	d, err := readPDF(r, contentLength, maxSize, 0, "")
+	if err != nil {
+		return "", err
 	}
+	defer d.release()
+	return pdfToMarkdown(d, ocr, 0)
+}
 
-	data := buf.Bytes()
+// pdfPageHeading matches the page headings of converted PDFs
+var pdfPageHeading = regexp.MustCompile(`(?m)^## Page (\d+)$`)
+
+// linkPDFPages appends to the page headings of markdown a link to that page of
+// the PDF at source, e.g. "## Page 2 ([source](https://example.com/a.pdf#page=2))",
+// so that the page can be cited
+func linkPDFPages(markdown string, source *url.URL) string {
+	u := *source
+	u.Fragment, u.RawFragment = "", ""
+	// Parentheses would end the link destination
+	base := strings.NewReplacer("(", "%28", ")", "%29").Replace(u.String())
+	return pdfPageHeading.ReplaceAllStringFunc(markdown, func(heading string) string {
+		page := strings.TrimPrefix(heading, "## Page ")
+		return fmt.Sprintf("%s ([source](%s#page=%s))", heading, base, page)
+	})
+}
+
+// pdfToMarkdown converts the PDF of d to markdown, failing with a
+// *PDFParseError if it has more than maxPages pages, when positive, or if the
+// parser panics on it.
+func pdfToMarkdown(d *pdfData, ocr pageOCR, maxPages int) (markdown string, err error) {
+	// The parser panics on many malformed documents
+	defer func() {
+		if r := recover(); r != nil {
+			markdown, err = "", &PDFParseError{Err: fmt.Errorf("parser crashed: %v", r)}
+		}
+	}()
 
 	// Create PDF reader from bytes
-	pdfReader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	pdfReader, err := pdf.NewReader(d.readerAt(), d.size)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse PDF: %w", err)
+		return "", &PDFParseError{Err: err}
 	}
 
 	numPages := pdfReader.NumPage()
 	if numPages == 0 {
 		return "", nil
 	}
+	if maxPages > 0 && numPages > maxPages {
+		return "", &PDFParseError{Err: fmt.Errorf("%d pages exceed the limit of %d", numPages, maxPages)}
+	}
 
 	// Launch up to GOMAXPROCS workers (but no more than numPages or maxConcurrency)
 	numWorkers := min(runtime.GOMAXPROCS(0), numPages, maxConcurrency)
@@ -163,6 +329,10 @@ func convertPDFToMarkdown(r io.Reader, contentLength int64) (string, error) {
 	// Calculate start page for each worker
 	page := 1
 
+	// Workers recover from parser panics, which cannot be recovered from
+	// another goroutine
+	var workerErrs [maxConcurrency]error
+
 	var wg sync.WaitGroup
 	wg.Add(numWorkers)
 
@@ -176,9 +346,17 @@ func convertPDFToMarkdown(r io.Reader, contentLength int64) (string, error) {
 			defer wg.Done()
 			workerBuf := pageBufferPool.Get().(*bytes.Buffer)
 			workerBuf.Reset()
+			workerBuffers[workerIdx] = workerBuf
+
+			pageNum := pageStart
+			defer func() {
+				if r := recover(); r != nil {
+					workerErrs[workerIdx] = &PDFParseError{Page: pageNum, Err: fmt.Errorf("parser crashed: %v", r)}
+				}
+			}()
 
 			// Process pages in order: startPage[workerIdx] to startPage[workerIdx+1]-1
-			for pageNum := pageStart; pageNum < pageEnd; pageNum++ {
+			for ; pageNum < pageEnd; pageNum++ {
 				if pageNum > pageStart {
 					workerBuf.WriteString("\n\n---\n\n")
 				}
@@ -188,11 +366,18 @@ func convertPDFToMarkdown(r io.Reader, contentLength int64) (string, error) {
 				if page.V.IsNull() {
 					workerBuf.WriteString("[Error: page not found]\n")
 				} else {
-					extractPageText(page, workerBuf)
+					start := workerBuf.Len()
+					if extractPageText(page, workerBuf) && ocr != nil {
+						// Keep the extracted text if recognition fails
+						if data, err := d.bytes(); err != nil {
+							// Keep the extracted text if the PDF cannot be loaded
+						} else if text, err := ocr(data, pageNum); err == nil {
+							workerBuf.Truncate(start)
+							workerBuf.WriteString(strings.TrimSpace(text))
+						}
+					}
 				}
 			}
-
-			workerBuffers[workerIdx] = workerBuf
 		}(i, page, page+count)
 
 		page += count
@@ -200,6 +385,17 @@ func convertPDFToMarkdown(r io.Reader, contentLength int64) (string, error) {
 
 	wg.Wait()
 
+	// Report the first page that failed
+	for _, err := range workerErrs[:numWorkers] {
+		if err != nil {
+			for _, workerBuf := range workerBuffers[:numWorkers] {
+				workerBuf.Reset()
+				pageBufferPool.Put(workerBuf)
+			}
+			return "", err
+		}
+	}
+
 	// Combine worker buffers in order using strings.Builder
 	var result strings.Builder
 	result.Grow(len(workerBuffers) * 1024)
@@ -2,9 +2,16 @@ package webfetch
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/ledongthuc/pdf"
 )
 
 func Test_isPDFContentType(t *testing.T) {
@@ -37,7 +44,7 @@ func Test_convertPDFToMarkdown(t *testing.T) {
 		t.Fatalf("failed to read test PDF: %v", err)
 	}
 
-	result, err := convertPDFToMarkdown(bytes.NewReader(data), int64(len(data)))
+	result, err := convertPDFToMarkdown(bytes.NewReader(data), int64(len(data)), 0, nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -73,11 +80,11 @@ func Test_convertPDFToMarkdown_SizeLimit(t *testing.T) {
 		{
 			name:          "Content-Length exceeds limit",
 			contentLength: 200 * 1024 * 1024, // 200MB
-			expectedError: "PDF too large",
+			expectedError: "content too large",
 		},
 		{
 			name:          "Content-Length at limit is ok",
-			contentLength: maxPDFSize,
+			contentLength: DefaultMaxPDFSize,
 			expectedError: "", // Should not error on Content-Length check
 		},
 	}
@@ -85,7 +92,7 @@ func Test_convertPDFToMarkdown_SizeLimit(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Use empty reader since we're testing Content-Length check
-			_, err := convertPDFToMarkdown(strings.NewReader(""), tt.contentLength)
+			_, err := convertPDFToMarkdown(strings.NewReader(""), tt.contentLength, 0, nil)
 
 			if tt.expectedError != "" {
 				if err == nil {
@@ -103,14 +110,231 @@ func Test_convertPDFToMarkdown_SizeLimit(t *testing.T) {
 func Test_convertPDFToMarkdown_ReadLimitExceeded(t *testing.T) {
 	// Create a reader that claims to have valid content length but provides too much data
 	// This tests the io.LimitReader behavior
-	largeData := make([]byte, maxPDFSize+100)
+	largeData := make([]byte, DefaultMaxPDFSize+100)
 
-	_, err := convertPDFToMarkdown(bytes.NewReader(largeData), -1) // -1 means unknown Content-Length
+	_, err := convertPDFToMarkdown(bytes.NewReader(largeData), -1, 0, nil) // -1 means unknown Content-Length
 	if err == nil {
 		t.Error("expected error for oversized PDF, got nil")
 		return
 	}
-	if !strings.Contains(err.Error(), "PDF too large") {
-		t.Errorf("expected 'PDF too large' error, got %q", err.Error())
+	if !strings.Contains(err.Error(), "content too large") {
+		t.Errorf("expected 'content too large' error, got %q", err.Error())
+	}
+}
+
+func Test_convertPDFToMarkdown_CustomSizeLimit(t *testing.T) {
+	data, err := os.ReadFile("testdata/test.pdf")
+	if err != nil {
+		t.Fatalf("failed to read test PDF: %v", err)
+	}
+
+	_, err = convertPDFToMarkdown(bytes.NewReader(data), -1, int64(len(data)-1), nil)
+	if err == nil || !strings.Contains(err.Error(), "content too large") {
+		t.Errorf("expected 'content too large' error, got %v", err)
+	}
+
+	if _, err := convertPDFToMarkdown(bytes.NewReader(data), -1, int64(len(data)), nil); err != nil {
+		t.Errorf("unexpected error at exact limit: %v", err)
+	}
+}
+
+func Test_writePageText_Spacing(t *testing.T) {
+	// line lays out glyphs left to right with the given gaps before each glyph
+	line := func(glyphs string, gaps ...float64) []pdf.Text {
+		var texts []pdf.Text
+		x := 0.0
+		for i, r := range []rune(glyphs) {
+			x += gaps[i]
+			texts = append(texts, pdf.Text{S: string(r), X: x, Y: 700, W: 10, FontSize: 10})
+			x += 10
+		}
+		return texts
+	}
+
+	tests := []struct {
+		name     string
+		texts    []pdf.Text
+		expected string
+	}{
+		{
+			name:     "latin word gap",
+			texts:    line("abcd", 0, 0, 4, 0),
+			expected: "ab cd",
+		},
+		{
+			name:     "justified japanese",
+			texts:    line("日本語の文書", 0, 3, 3, 3, 3, 3),
+			expected: "日本語の文書",
+		},
+		{
+			name:     "latin embedded in chinese",
+			texts:    line("使用Go语言", 0, 3, 4, 0, 4, 3),
+			expected: "使用 Go 语言",
+		},
+		{
+			name:     "korean keeps spaces",
+			texts:    line("한국어문서", 0, 0, 0, 4, 0),
+			expected: "한국어 문서",
+		},
+		{
+			name:     "ligatures",
+			texts:    line("\ufb01le \ufb02ow o\ufb00er", 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0),
+			expected: "file flow offer",
+		},
+		{
+			name:     "private use ligatures",
+			texts:    line("\uf001eld", 0, 0, 0, 0),
+			expected: "field",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writePageText(tt.texts, &buf)
+			if buf.String() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestConvertPDF_Errors(t *testing.T) {
+	pages := func(contents ...string) []byte {
+		objects := []string{"<< /Type /Catalog /Pages 2 0 R >>", ""}
+		var kids []string
+		for i, content := range contents {
+			kids = append(kids, fmt.Sprintf("%d 0 R", 3+2*i))
+			objects = append(objects,
+				fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents %d 0 R >>", 4+2*i),
+				pdfStream(content),
+			)
+		}
+		objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+		return buildPDF(objects...)
+	}
+	slowOCR := func(ctx context.Context, pdf []byte, page int) (string, error) {
+		time.Sleep(time.Second)
+		return "", nil
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		opts     FetchOptions
+		expected string
+		timeout  bool
+	}{
+		{name: "malformed", data: []byte("%PDF-1.7\nnot a PDF"), expected: "failed to parse PDF: "},
+		{name: "parser crash", data: pages("BT ET", "BT 1 Td ET"), expected: "failed to parse PDF: page 2: parser crashed: bad Td"},
+		{name: "too many pages", data: pages("BT ET", "BT ET"), opts: FetchOptions{MaxPDFPages: 1}, expected: "failed to parse PDF: 2 pages exceed the limit of 1"},
+		{
+			name:     "timeout",
+			data:     compositeFontPDF("Identity-H", "<00010002>", ""),
+			opts:     FetchOptions{PDFTimeout: 10 * time.Millisecond, PDFOCR: slowOCR},
+			expected: "failed to parse PDF: parsing timed out",
+			timeout:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ConvertPDF(context.Background(), tt.data, tt.opts)
+			var parseErr *PDFParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected a *PDFParseError, got %v", err)
+			}
+			if !strings.HasPrefix(err.Error(), tt.expected) {
+				t.Errorf("expected error %q, got %q", tt.expected, err.Error())
+			}
+			if errors.Is(err, ErrPDFTimeout) != tt.timeout {
+				t.Errorf("expected timeout %t, got %v", tt.timeout, err)
+			}
+		})
+	}
+}
+
+func Test_convertPDFToMarkdown_Rotated(t *testing.T) {
+	// rotatedPDF shows two lines with the text matrix tm on a page with the
+	// /Rotate attribute rotate
+	rotatedPDF := func(rotate int, tm string) []byte {
+		widths := strings.TrimSuffix(strings.Repeat("600 ", 95), " ")
+		return buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			fmt.Sprintf("<< /Type /Pages /Kids [3 0 R] /Count 1 /Rotate %d >>", rotate),
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>",
+			"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /FirstChar 32 /LastChar 126 /Widths ["+widths+"] >>",
+			pdfStream("BT /F1 12 Tf 14 TL "+tm+" Tm (Landscape table) Tj T* (Second line) Tj ET"),
+		)
+	}
+
+	tests := []struct {
+		name string
+		pdf  []byte
+	}{
+		{name: "upright", pdf: rotatedPDF(0, "1 0 0 1 72 720")},
+		{name: "page rotated 90", pdf: rotatedPDF(90, "0 1 -1 0 100 72")},
+		{name: "text rotated 90", pdf: rotatedPDF(0, "0 1 -1 0 100 72")},
+		{name: "upside down", pdf: rotatedPDF(180, "-1 0 0 -1 540 72")},
+		{name: "page rotated 270", pdf: rotatedPDF(270, "0 -1 1 0 500 720")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := convertPDFToMarkdown(bytes.NewReader(tt.pdf), int64(len(tt.pdf)), 0, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expected := "## Page 1\n\nLandscape table\nSecond line"
+			if result != expected {
+				t.Errorf("expected %q, got %q", expected, result)
+			}
+		})
+	}
+}
+
+func Test_linkPDFPages(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		markdown string
+		expected string
+	}{
+		{
+			name:     "pages",
+			source:   "https://example.com/doc.pdf",
+			markdown: "## Page 1\n\nHello\n\n---\n\n## Page 2\n\nWorld",
+			expected: "## Page 1 ([source](https://example.com/doc.pdf#page=1))\n\nHello\n\n---\n\n## Page 2 ([source](https://example.com/doc.pdf#page=2))\n\nWorld",
+		},
+		{
+			name:     "fragment replaced",
+			source:   "https://example.com/doc.pdf?v=2#page=7",
+			markdown: "## Page 3\n\nText",
+			expected: "## Page 3 ([source](https://example.com/doc.pdf?v=2#page=3))\n\nText",
+		},
+		{
+			name:     "parentheses escaped",
+			source:   "https://example.com/report_(final).pdf",
+			markdown: "## Page 1",
+			expected: "## Page 1 ([source](https://example.com/report_%28final%29.pdf#page=1))",
+		},
+		{
+			name:     "text lines untouched",
+			source:   "https://example.com/doc.pdf",
+			markdown: "## Page one\nsee ## Page 2",
+			expected: "## Page one\nsee ## Page 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := url.Parse(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := linkPDFPages(tt.markdown, source); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
 	}
 }
@@ -0,0 +1,80 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PDFEngineBuiltin names the built-in PDF parser in Metadata.PDFEngine.
+const PDFEngineBuiltin = "builtin"
+
+// PDFEngine is an alternate PDF text extractor, such as pdftotext or mutool.
+type PDFEngine struct {
+	// Name identifies the engine in Metadata.PDFEngine.
+	Name string
+	// Convert returns the text of the PDF. Pages separated by form feeds, as
+	// output by pdftotext and mutool, get page headers like the built-in parser.
+	Convert func(ctx context.Context, pdf io.Reader) (string, error)
+}
+
+// convertPDF converts the PDF of d, a result of readPDF that it releases, with
+// opts.PDFParser or in process, then with opts.PDFFallback if that fails or
+// finds no text. It returns the name of the engine that produced the markdown.
+func convertPDF(ctx context.Context, d *pdfData, opts FetchOptions) (string, string, error) {
+	defer d.release()
+	var markdown string
+	var err error
+	if opts.PDFParser != nil {
+		markdown, err = opts.PDFParser(ctx, d.reader())
+	} else {
+		markdown, err = convertPDFData(ctx, d, opts)
+	}
+
+	var parseErr *PDFParseError
+	if opts.PDFFallback == nil || (err != nil && !errors.As(err, &parseErr)) || (err == nil && !pdfTextEmpty(markdown)) {
+		return markdown, PDFEngineBuiltin, err
+	}
+
+	text, fallbackErr := opts.PDFFallback.Convert(ctx, d.reader())
+	switch {
+	case fallbackErr == nil && !pdfTextEmpty(text):
+		return formatPDFPages(text), opts.PDFFallback.Name, nil
+	case err != nil && fallbackErr != nil:
+		return "", "", &PDFParseError{Page: parseErr.Page, Err: fmt.Errorf("%w (%s: %v)", parseErr.Err, opts.PDFFallback.Name, fallbackErr)}
+	}
+	// Neither engine found text, or the fallback failed on an empty document
+	return markdown, PDFEngineBuiltin, err
+}
+
+// pdfTextEmpty reports whether markdown has no text besides page headers and
+// separators
+func pdfTextEmpty(markdown string) bool {
+	for line := range strings.Lines(markdown) {
+		line = strings.TrimSpace(line)
+		if line != "" && line != "---" && !strings.HasPrefix(line, "## Page ") && line != "[Error: page not found]" {
+			return false
+		}
+	}
+	return true
+}
+
+// formatPDFPages adds page headers and separators to text whose pages are
+// separated by form feeds, and expands ligatures, as the built-in parser does
+func formatPDFPages(text string) string {
+	text = glyphReplacer.Replace(text)
+	pages := strings.Split(strings.TrimRight(text, "\f\n"), "\f")
+	if len(pages) == 1 {
+		return strings.TrimSpace(text)
+	}
+	var sb strings.Builder
+	for i, page := range pages {
+		if i > 0 {
+			sb.WriteString("\n\n---\n\n")
+		}
+		fmt.Fprintf(&sb, "## Page %d\n\n%s", i+1, strings.TrimSpace(page))
+	}
+	return sb.String()
+}
@@ -0,0 +1,93 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFetch_PDFFallback(t *testing.T) {
+	valid, err := os.ReadFile("testdata/test.pdf")
+	if err != nil {
+		t.Fatalf("failed to read test PDF: %v", err)
+	}
+	page := func(content string) []byte {
+		return buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R >>",
+			pdfStream(content),
+		)
+	}
+	pdfs := map[string][]byte{
+		"/valid": valid,
+		"/crash": page("BT 1 Td ET"),
+		"/empty": page("0 0 m 10 10 l S"),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write(pdfs[r.URL.Path])
+	}))
+	defer server.Close()
+
+	working := &PDFEngine{Name: "pdftotext", Convert: func(ctx context.Context, pdf io.Reader) (string, error) {
+		return "First page\n\fSecond page\n\f", nil
+	}}
+	failing := &PDFEngine{Name: "pdftotext", Convert: func(ctx context.Context, pdf io.Reader) (string, error) {
+		return "", errors.New("exit status 1")
+	}}
+
+	tests := []struct {
+		name           string
+		path           string
+		fallback       *PDFEngine
+		expected       string
+		expectedEngine string
+		expectedErr    string
+	}{
+		{name: "parsed", path: "/valid", fallback: working, expected: "Hello World", expectedEngine: PDFEngineBuiltin},
+		{
+			name:           "parse failure",
+			path:           "/crash",
+			fallback:       working,
+			expected:       "## Page 1 ([source](" + server.URL + "/crash#page=1))\n\nFirst page\n\n---\n\n## Page 2 ([source](" + server.URL + "/crash#page=2))\n\nSecond page",
+			expectedEngine: "pdftotext",
+		},
+		{name: "no text", path: "/empty", fallback: working, expected: "([source](" + server.URL + "/empty#page=1))\n\nFirst page", expectedEngine: "pdftotext"},
+		{name: "no fallback", path: "/crash", expectedErr: "failed to parse PDF: page 1: parser crashed: bad Td"},
+		{
+			name:        "failing fallback",
+			path:        "/crash",
+			fallback:    failing,
+			expectedErr: "failed to parse PDF: page 1: parser crashed: bad Td (pdftotext: exit status 1)",
+		},
+		{name: "failing fallback without text", path: "/empty", fallback: failing, expected: "## Page 1", expectedEngine: PDFEngineBuiltin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Fetch(context.Background(), server.URL+tt.path, FetchOptions{PDFFallback: tt.fallback})
+			if tt.expectedErr != "" {
+				var parseErr *PDFParseError
+				if !errors.As(err, &parseErr) || err.Error() != tt.expectedErr {
+					t.Fatalf("expected *PDFParseError %q, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(doc.Content, tt.expected) {
+				t.Errorf("expected content containing %q, got %q", tt.expected, doc.Content)
+			}
+			if doc.Metadata.PDFEngine != tt.expectedEngine {
+				t.Errorf("expected engine %q, got %q", tt.expectedEngine, doc.Metadata.PDFEngine)
+			}
+		})
+	}
+}
@@ -0,0 +1,505 @@
+package webfetch
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// maxToUnicodeSize is the maximum size in bytes of a ToUnicode CMap that is read
+const maxToUnicodeSize = 4 * 1024 * 1024
+
+// pdfGlyph is a character code of a string shown with a font
+type pdfGlyph struct {
+	// text is the Unicode text of the code, empty if it has none
+	text string
+	// mapped reports whether the font maps the code to Unicode
+	mapped bool
+	// width is the advance width in thousandths of the font size
+	width float64
+	// space reports whether the code is the single-byte space, which the word
+	// spacing applies to
+	space bool
+}
+
+// glyphDecoder splits the strings shown with a font into glyphs
+type glyphDecoder interface {
+	glyphs(raw string) []pdfGlyph
+}
+
+// newGlyphDecoder returns the decoder of font: a cidFont for composite (Type0)
+// fonts, or the library encoding of simple fonts.
+func newGlyphDecoder(font pdf.Font) glyphDecoder {
+	if font.V.Key("Subtype").Name() == "Type0" {
+		return newCIDFont(font)
+	}
+	return simpleFont{font: font, enc: font.Encoder()}
+}
+
+// simpleFont decodes the single-byte codes of a simple font
+type simpleFont struct {
+	font pdf.Font
+	enc  pdf.TextEncoding
+}
+
+func (f simpleFont) glyphs(raw string) []pdfGlyph {
+	glyphs := make([]pdfGlyph, len(raw))
+	for i := range len(raw) {
+		glyphs[i] = pdfGlyph{
+			text:   f.enc.Decode(raw[i : i+1]),
+			mapped: true,
+			width:  f.font.Width(int(raw[i])),
+			space:  raw[i] == ' ',
+		}
+	}
+	return glyphs
+}
+
+// cidFont decodes the multi-byte codes of a composite font, using its
+// ToUnicode CMap or else the Unicode or legacy CJK encoding of its predefined
+// CMap. Codes of Identity CMaps without ToUnicode map are not mapped.
+type cidFont struct {
+	cmap      string
+	toUnicode *toUnicodeMap
+	identity  bool
+	widths    []cidWidths
+	dw        float64
+}
+
+// cidWidths is a range of CIDs with their widths, from the W array of a
+// CIDFont: either one width per CID or the same width for all of them
+type cidWidths struct {
+	first, last int
+	widths      []float64
+	width       float64
+}
+
+func newCIDFont(font pdf.Font) *cidFont {
+	f := &cidFont{cmap: font.V.Key("Encoding").Name(), dw: 1000}
+	f.identity = strings.HasPrefix(f.cmap, "Identity-")
+	if toUnicode := font.V.Key("ToUnicode"); toUnicode.Kind() == pdf.Stream {
+		f.toUnicode = readToUnicode(toUnicode)
+	}
+
+	desc := font.V.Key("DescendantFonts").Index(0)
+	if dw := desc.Key("DW"); dw.Kind() == pdf.Integer || dw.Kind() == pdf.Real {
+		f.dw = dw.Float64()
+	}
+	w := desc.Key("W")
+	for i := 0; i+1 < w.Len(); {
+		first := int(w.Index(i).Int64())
+		if next := w.Index(i + 1); next.Kind() == pdf.Array {
+			r := cidWidths{first: first, last: first + next.Len() - 1}
+			for j := range next.Len() {
+				r.widths = append(r.widths, next.Index(j).Float64())
+			}
+			f.widths = append(f.widths, r)
+			i += 2
+			continue
+		}
+		if i+2 >= w.Len() {
+			break
+		}
+		f.widths = append(f.widths, cidWidths{first: first, last: int(w.Index(i + 1).Int64()), width: w.Index(i + 2).Float64()})
+		i += 3
+	}
+	return f
+}
+
+func (f *cidFont) glyphs(raw string) []pdfGlyph {
+	var glyphs []pdfGlyph
+	for len(raw) > 0 {
+		n := min(f.codeLength(raw), len(raw))
+		code := raw[:n]
+		raw = raw[n:]
+
+		g := pdfGlyph{width: f.width(code), space: code == " "}
+		if f.toUnicode != nil {
+			g.text, g.mapped = f.toUnicode.lookup(code)
+		}
+		if !g.mapped {
+			g.text, g.mapped = decodeCMapCode(f.cmap, code)
+		}
+		glyphs = append(glyphs, g)
+	}
+	return glyphs
+}
+
+// codeLength returns the length of the code starting raw, from the codespace
+// ranges of the ToUnicode map or else the encoding of the CMap
+func (f *cidFont) codeLength(raw string) int {
+	if f.toUnicode != nil {
+		if n := f.toUnicode.codeLength(raw); n > 0 {
+			return n
+		}
+	}
+
+	b := raw[0]
+	switch {
+	case strings.Contains(f.cmap, "UTF16"):
+		if b >= 0xd8 && b <= 0xdb {
+			return 4
+		}
+		return 2
+	case strings.Contains(f.cmap, "UTF8"):
+		_, n := utf8.DecodeRuneInString(raw)
+		return n
+	case strings.Contains(f.cmap, "UTF32"):
+		return 4
+	case strings.Contains(f.cmap, "RKSJ"):
+		if (b >= 0x81 && b <= 0x9f) || (b >= 0xe0 && b <= 0xfc) {
+			return 2
+		}
+		return 1
+	case legacyCMapEncoding(f.cmap) != nil:
+		if b >= 0x81 {
+			return 2
+		}
+		return 1
+	}
+	return 2
+}
+
+// width returns the width of code, known for Identity CMaps, where the code is
+// the CID
+func (f *cidFont) width(code string) float64 {
+	if !f.identity {
+		return f.dw
+	}
+	cid := 0
+	for i := range len(code) {
+		cid = cid<<8 | int(code[i])
+	}
+	for _, r := range f.widths {
+		if cid < r.first || cid > r.last {
+			continue
+		}
+		if r.widths != nil {
+			return r.widths[cid-r.first]
+		}
+		return r.width
+	}
+	return f.dw
+}
+
+// decodeCMapCode returns the text of code in the encoding of a predefined
+// CMap: the Unicode CMaps (UniGB-UCS2-H, UniJIS-UTF16-H, ...) and the legacy
+// CJK encodings (90ms-RKSJ-H, GBK-EUC-H, KSCms-UHC-H, ETen-B5-H, ...)
+func decodeCMapCode(cmap, code string) (string, bool) {
+	switch {
+	case strings.Contains(cmap, "UCS2"), strings.Contains(cmap, "UTF16"):
+		return decodeUTF16BE(code), true
+	case strings.Contains(cmap, "UTF8"):
+		return strings.ToValidUTF8(code, "�"), true
+	case strings.Contains(cmap, "UTF32"):
+		r := rune(0)
+		for i := range len(code) {
+			r = r<<8 | rune(code[i])
+		}
+		return string(r), true
+	}
+	if e := legacyCMapEncoding(cmap); e != nil {
+		text, err := e.NewDecoder().String(code)
+		if err == nil && !strings.ContainsRune(text, utf8.RuneError) {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+// legacyCMapEncoding returns the encoding of the codes of a predefined CJK
+// CMap, or nil
+func legacyCMapEncoding(cmap string) encoding.Encoding {
+	switch {
+	case strings.Contains(cmap, "RKSJ"):
+		return japanese.ShiftJIS
+	case strings.HasPrefix(cmap, "EUC-"):
+		return japanese.EUCJP
+	case strings.HasPrefix(cmap, "GB"):
+		return simplifiedchinese.GB18030
+	case strings.HasPrefix(cmap, "KSC"):
+		return korean.EUCKR
+	case strings.Contains(cmap, "B5"):
+		return traditionalchinese.Big5
+	}
+	return nil
+}
+
+// decodeUTF16BE decodes the UTF-16 big endian string s
+func decodeUTF16BE(s string) string {
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// toUnicodeMap is a ToUnicode CMap, mapping character codes to Unicode
+type toUnicodeMap struct {
+	codespace []codeRange
+	chars     map[string]string
+	ranges    []unicodeRange
+}
+
+// codeRange is a range of codes of the same length
+type codeRange struct {
+	lo, hi string
+}
+
+// unicodeRange maps a range of codes to consecutive UTF-16 strings starting at
+// dst, or to the strings of dsts
+type unicodeRange struct {
+	codeRange
+	dst  string
+	dsts []string
+}
+
+// readToUnicode parses the ToUnicode CMap stream v. The PostScript of the CMap
+// is not interpreted: only its codespace, bfchar and bfrange sections are read.
+func readToUnicode(v pdf.Value) *toUnicodeMap {
+	rd := v.Reader()
+	defer rd.Close()
+	data, err := io.ReadAll(io.LimitReader(rd, maxToUnicodeSize))
+	if err != nil && len(data) == 0 {
+		return nil
+	}
+
+	m := &toUnicodeMap{chars: make(map[string]string)}
+	var operands []cmapOperand
+	for tok := range cmapTokens(data) {
+		switch tok.keyword {
+		case "":
+			operands = append(operands, tok)
+			continue
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				if lo, hi := operands[i].s, operands[i+1].s; lo != "" && len(lo) == len(hi) {
+					m.codespace = append(m.codespace, codeRange{lo, hi})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				m.chars[operands[i].s] = decodeUTF16BE(operands[i+1].s)
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				r := unicodeRange{codeRange: codeRange{operands[i].s, operands[i+1].s}, dst: operands[i+2].s, dsts: operands[i+2].array}
+				if r.lo != "" && len(r.lo) == len(r.hi) {
+					m.ranges = append(m.ranges, r)
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	if len(m.chars) == 0 && len(m.ranges) == 0 {
+		return nil
+	}
+	return m
+}
+
+// codeLength returns the length of the code starting raw in the codespace
+// ranges of m, or 0
+func (m *toUnicodeMap) codeLength(raw string) int {
+	for _, r := range m.codespace {
+		n := len(r.lo)
+		if n > len(raw) {
+			continue
+		}
+		// Each byte of the code is within the bounds of the range
+		inRange := true
+		for i := range n {
+			if raw[i] < r.lo[i] || raw[i] > r.hi[i] {
+				inRange = false
+				break
+			}
+		}
+		if inRange {
+			return n
+		}
+	}
+	return 0
+}
+
+// lookup returns the text code maps to
+func (m *toUnicodeMap) lookup(code string) (string, bool) {
+	if text, ok := m.chars[code]; ok {
+		return text, true
+	}
+	for _, r := range m.ranges {
+		if len(code) != len(r.lo) || code < r.lo || code > r.hi {
+			continue
+		}
+		offset := codeValue(code) - codeValue(r.lo)
+		if r.dsts != nil {
+			if offset < len(r.dsts) {
+				return decodeUTF16BE(r.dsts[offset]), true
+			}
+			return "", false
+		}
+		if len(r.dst) < 2 {
+			return "", false
+		}
+		// The last UTF-16 code unit of dst is incremented by the offset
+		units := []rune(decodeUTF16BE(r.dst))
+		if len(units) == 0 {
+			return "", false
+		}
+		units[len(units)-1] += rune(offset)
+		return string(units), true
+	}
+	return "", false
+}
+
+// codeValue returns the big endian value of code
+func codeValue(code string) int {
+	v := 0
+	for i := range len(code) {
+		v = v<<8 | int(code[i])
+	}
+	return v
+}
+
+// cmapOperand is a token of a CMap: a keyword, or a string or array operand
+type cmapOperand struct {
+	keyword string
+	s       string
+	array   []string
+}
+
+// cmapTokens yields the hex strings, arrays of hex strings and keywords of the
+// CMap data. Names, numbers, literal strings and dictionaries are yielded as
+// empty operands.
+func cmapTokens(data []byte) func(yield func(cmapOperand) bool) {
+	return func(yield func(cmapOperand) bool) {
+		var array []string
+		inArray := false
+		emit := func(tok cmapOperand) bool {
+			if inArray && tok.keyword == "" {
+				array = append(array, tok.s)
+				return true
+			}
+			return yield(tok)
+		}
+
+		for i := 0; i < len(data); {
+			c := data[i]
+			switch {
+			case isPDFSpace(c):
+				i++
+			case c == '%':
+				for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+					i++
+				}
+			case c == '<' && i+1 < len(data) && data[i+1] == '<', c == '>' && i+1 < len(data) && data[i+1] == '>':
+				i += 2
+			case c == '<':
+				end := bytes.IndexByte(data[i:], '>')
+				if end < 0 {
+					return
+				}
+				if !emit(cmapOperand{s: decodeHex(data[i+1 : i+end])}) {
+					return
+				}
+				i += end + 1
+			case c == '[':
+				inArray, array = true, nil
+				i++
+			case c == ']':
+				inArray = false
+				if !yield(cmapOperand{array: array}) {
+					return
+				}
+				i++
+			case c == '(':
+				// Literal strings, e.g. the Registry, are skipped
+				depth := 0
+				for ; i < len(data); i++ {
+					if data[i] == '\\' {
+						i++
+					} else if data[i] == '(' {
+						depth++
+					} else if data[i] == ')' {
+						if depth--; depth == 0 {
+							i++
+							break
+						}
+					}
+				}
+				if !emit(cmapOperand{}) {
+					return
+				}
+			default:
+				start := i
+				for i < len(data) && !isPDFSpace(data[i]) && !strings.ContainsRune("<>[]()%/", rune(data[i])) {
+					i++
+				}
+				if i == start {
+					// A name: its slash is skipped with the name itself
+					i++
+					for i < len(data) && !isPDFSpace(data[i]) && !strings.ContainsRune("<>[]()%/", rune(data[i])) {
+						i++
+					}
+					if !emit(cmapOperand{}) {
+						return
+					}
+					continue
+				}
+				word := string(data[start:i])
+				if (word[0] >= '0' && word[0] <= '9') || word[0] == '-' || word[0] == '.' {
+					if !emit(cmapOperand{}) {
+						return
+					}
+					continue
+				}
+				if !yield(cmapOperand{keyword: word}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// isPDFSpace reports whether c is a PDF whitespace character
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == 0
+}
+
+// decodeHex decodes the hex digits of a PDF hex string, ignoring whitespace;
+// an odd final digit is followed by 0
+func decodeHex(hex []byte) string {
+	var b []byte
+	var hi byte
+	odd := false
+	for _, c := range hex {
+		var v byte
+		switch {
+		case c >= '0' && c <= '9':
+			v = c - '0'
+		case c >= 'a' && c <= 'f':
+			v = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			v = c - 'A' + 10
+		default:
+			continue
+		}
+		if odd {
+			b = append(b, hi<<4|v)
+		} else {
+			hi = v
+		}
+		odd = !odd
+	}
+	if odd {
+		b = append(b, hi<<4)
+	}
+	return string(b)
+}
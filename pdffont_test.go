@@ -0,0 +1,132 @@
+package webfetch
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildPDF returns a PDF document with the objects, numbered from 1, and a
+// cross-reference table
+func buildPDF(objects ...string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// pdfStream returns a stream object with data
+func pdfStream(data string) string {
+	return fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(data), data)
+}
+
+// compositeFontPDF returns a one page PDF showing text with a Type0 font using
+// the cmap and ToUnicode map, if any
+func compositeFontPDF(cmap, text, toUnicode string) []byte {
+	font := "<< /Type /Font /Subtype /Type0 /BaseFont /ABCDEF+NotoSansCJK /Encoding /" + cmap + " /DescendantFonts [6 0 R]"
+	if toUnicode != "" {
+		font += " /ToUnicode 7 0 R"
+	}
+	font += " >>"
+	return buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>",
+		font,
+		pdfStream("BT /F1 12 Tf 72 720 Td "+text+" Tj ET"),
+		"<< /Type /Font /Subtype /CIDFontType0 /BaseFont /NotoSansCJK /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /DW 1000 /W [5 6 500] >>",
+		pdfStream(toUnicode),
+	)
+}
+
+func Test_convertPDFToMarkdown_CompositeFonts(t *testing.T) {
+	toUnicode := `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def
+/CMapName /Adobe-Identity-UCS def
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+2 beginbfchar
+<0001> <4F60>
+<0002> <597D>
+endbfchar
+2 beginbfrange
+<0003> <0004> [<4E16> <754C>]
+<0005> <0006> <0041>
+endbfrange
+endcmap
+CMapName currentdict /CMap defineresource pop
+end
+end`
+
+	tests := []struct {
+		name      string
+		cmap      string
+		text      string
+		toUnicode string
+		expected  string
+		ocr       bool
+	}{
+		{
+			name:      "identity with ToUnicode",
+			cmap:      "Identity-H",
+			text:      "<000100020003000400050006>",
+			toUnicode: toUnicode,
+			expected:  "你好世界AB",
+		},
+		{
+			name:     "unicode CMap",
+			cmap:     "UniGB-UCS2-H",
+			text:     "<4F60597D>",
+			expected: "你好",
+		},
+		{
+			name:     "shift_jis CMap",
+			cmap:     "90ms-RKSJ-H",
+			text:     "<82B182F182C982BF82CD>",
+			expected: "こんにちは",
+		},
+		{
+			name:     "identity without ToUnicode falls back to OCR",
+			cmap:     "Identity-H",
+			text:     "<00010002>",
+			expected: "recognized page 1",
+			ocr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := compositeFontPDF(tt.cmap, tt.text, tt.toUnicode)
+			ocrCalled := false
+			ocr := func(data []byte, page int) (string, error) {
+				ocrCalled = true
+				return fmt.Sprintf("recognized page %d\n", page), nil
+			}
+
+			result, err := convertPDFToMarkdown(bytes.NewReader(data), int64(len(data)), 0, ocr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if expected := "## Page 1\n\n" + tt.expected; strings.TrimSpace(result) != expected {
+				t.Errorf("expected %q, got %q", expected, result)
+			}
+			if ocrCalled != tt.ocr {
+				t.Errorf("expected OCR called %t, got %t", tt.ocr, ocrCalled)
+			}
+		})
+	}
+}
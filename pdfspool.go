@@ -0,0 +1,165 @@
+package webfetch
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultPDFSpoolThreshold is the size above which a PDF is spooled to a
+// temporary file when FetchOptions.PDFSpoolThreshold is not set (16MB).
+const DefaultPDFSpoolThreshold = 16 * 1024 * 1024
+
+// pdfData is a PDF held in memory or spooled to a temporary file. It is
+// reference counted, so that a parser left running after a timeout keeps it
+// until it is done.
+type pdfData struct {
+	// data is the content held in memory, nil if spooled
+	data []byte
+	// buf is the pooled buffer holding data, if any
+	buf *bytes.Buffer
+	// file is the temporary file holding the content, if spooled
+	file *os.File
+	size int64
+	refs atomic.Int32
+
+	loadOnce sync.Once
+	loaded   []byte
+	loadErr  error
+}
+
+// newPDFData returns a pdfData for data held in memory
+func newPDFData(data []byte) *pdfData {
+	d := &pdfData{data: data, size: int64(len(data))}
+	d.refs.Store(1)
+	return d
+}
+
+// readerAt returns a reader of the content at any offset, safe for concurrent use
+func (d *pdfData) readerAt() io.ReaderAt {
+	if d.file != nil {
+		return d.file
+	}
+	return bytes.NewReader(d.data)
+}
+
+// reader returns a reader of the whole content
+func (d *pdfData) reader() io.Reader {
+	return io.NewSectionReader(d.readerAt(), 0, d.size)
+}
+
+// bytes returns the content, loading a spooled file into memory the first
+// time, for consumers that need it all such as OCR commands
+func (d *pdfData) bytes() ([]byte, error) {
+	if d.file == nil {
+		return d.data, nil
+	}
+	d.loadOnce.Do(func() {
+		d.loaded, d.loadErr = io.ReadAll(d.reader())
+	})
+	return d.loaded, d.loadErr
+}
+
+// retain adds a reference to d
+func (d *pdfData) retain() {
+	d.refs.Add(1)
+}
+
+// release drops a reference to d, returning its buffer to the pool or removing
+// its temporary file with the last one
+func (d *pdfData) release() {
+	if d.refs.Add(-1) > 0 {
+		return
+	}
+	if d.buf != nil {
+		d.buf.Reset() // Clear data before returning to pool
+		pdfBufferPool.Put(d.buf)
+	}
+	if d.file != nil {
+		d.file.Close()
+		os.Remove(d.file.Name())
+	}
+}
+
+// readPDF reads a PDF of at most maxSize bytes, or DefaultMaxPDFSize if maxSize
+// is not positive. PDFs of up to spoolThreshold bytes, or all of them if it is
+// not positive, are held in a buffer of pdfBufferPool; larger ones are spooled
+// to a temporary file in spoolDir, or the default directory for temporary
+// files if empty.
+func readPDF(r io.Reader, contentLength, maxSize, spoolThreshold int64, spoolDir string) (*pdfData, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxPDFSize
+	}
+
+	// Early rejection if Content-Length header indicates too large
+	if contentLength > maxSize {
+		return nil, &TooLargeError{ContentType: "application/pdf", Size: contentLength, Limit: maxSize}
+	}
+
+	// Wrap reader with limit to prevent reading more than maxSize + 1
+	// The +1 allows us to detect if we hit the limit
+	r = io.LimitReader(r, maxSize+1)
+
+	// PDFs up to memoryLimit bytes are held in memory
+	memoryLimit := maxSize
+	if spoolThreshold > 0 {
+		memoryLimit = min(maxSize, spoolThreshold)
+	}
+
+	// Get buffer from pool
+	buf := pdfBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	d := &pdfData{buf: buf}
+	d.refs.Store(1)
+
+	// Read PDF data into buffer, unless it is known to be larger than memoryLimit
+	if contentLength <= memoryLimit {
+		if _, err := buf.ReadFrom(io.LimitReader(r, memoryLimit+1)); err != nil {
+			d.release()
+			return nil, fmt.Errorf("failed to read PDF: %w", err)
+		}
+		if int64(buf.Len()) <= memoryLimit {
+			d.data = buf.Bytes()
+			d.size = int64(buf.Len())
+			return d, nil
+		}
+	}
+	if memoryLimit == maxSize {
+		d.release()
+		return nil, &TooLargeError{ContentType: "application/pdf", Limit: maxSize}
+	}
+
+	if err := d.spool(r, spoolDir); err != nil {
+		d.release()
+		return nil, err
+	}
+	// Check if we hit the limit (read more than maxSize)
+	if d.size > maxSize {
+		d.release()
+		return nil, &TooLargeError{ContentType: "application/pdf", Limit: maxSize}
+	}
+	return d, nil
+}
+
+// spool writes the content read so far in the buffer of d, then the rest of r,
+// to a temporary file in dir, and returns the buffer to the pool
+func (d *pdfData) spool(r io.Reader, dir string) error {
+	file, err := os.CreateTemp(dir, "webfetch-*.pdf")
+	if err != nil {
+		return fmt.Errorf("failed to spool PDF: %w", err)
+	}
+	d.file = file
+
+	n, err := io.Copy(file, io.MultiReader(bytes.NewReader(d.buf.Bytes()), r))
+	d.buf.Reset()
+	pdfBufferPool.Put(d.buf)
+	d.buf = nil
+	if err != nil {
+		return fmt.Errorf("failed to spool PDF: %w", err)
+	}
+	d.size = n
+	return nil
+}
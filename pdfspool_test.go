@@ -0,0 +1,107 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFetch_PDFSpool(t *testing.T) {
+	data, err := os.ReadFile("testdata/test.pdf")
+	if err != nil {
+		t.Fatalf("failed to read test PDF: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		if r.URL.Query().Has("chunked") {
+			// Flushing before writing the body leaves its length unknown
+			w.(http.Flusher).Flush()
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	size := int64(len(data))
+	tests := []struct {
+		name        string
+		query       string
+		opts        FetchOptions
+		expectedErr *TooLargeError
+	}{
+		{name: "in memory", opts: FetchOptions{PDFSpoolThreshold: size}},
+		{name: "spooled", opts: FetchOptions{PDFSpoolThreshold: 100}},
+		{name: "spooled unknown length", query: "?chunked", opts: FetchOptions{PDFSpoolThreshold: 100}},
+		{name: "spooling disabled", opts: FetchOptions{PDFSpoolThreshold: -1}},
+		{
+			name:        "spooled too large",
+			query:       "?chunked",
+			opts:        FetchOptions{PDFSpoolThreshold: 100, MaxPDFSize: size - 1},
+			expectedErr: &TooLargeError{ContentType: "application/pdf", Limit: size - 1},
+		},
+		{
+			name:        "too large without spooling",
+			query:       "?chunked",
+			opts:        FetchOptions{PDFSpoolThreshold: -1, MaxPDFSize: size - 1},
+			expectedErr: &TooLargeError{ContentType: "application/pdf", Limit: size - 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.opts.PDFSpoolDir = dir
+			doc, err := Fetch(context.Background(), server.URL+tt.query, tt.opts)
+			if tt.expectedErr != nil {
+				var tooLarge *TooLargeError
+				if !errors.As(err, &tooLarge) || *tooLarge != *tt.expectedErr {
+					t.Fatalf("expected %+v, got %v", *tt.expectedErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if !strings.Contains(doc.Content, "Hello World") {
+				t.Errorf("expected content to contain %q, got %q", "Hello World", doc.Content)
+			}
+
+			// Spooled PDFs are removed once converted
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("expected no spool file left, got %d", len(entries))
+			}
+		})
+	}
+}
+
+func Test_readPDF_Spool(t *testing.T) {
+	data, err := os.ReadFile("testdata/test.pdf")
+	if err != nil {
+		t.Fatalf("failed to read test PDF: %v", err)
+	}
+	dir := t.TempDir()
+	d, err := readPDF(strings.NewReader(string(data)), -1, 0, 100, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.file == nil {
+		t.Fatal("expected the PDF to be spooled")
+	}
+	if d.size != int64(len(data)) {
+		t.Errorf("expected size %d, got %d", len(data), d.size)
+	}
+	// A parser still running after a timeout keeps the file until it is done
+	d.retain()
+	d.release()
+	if _, err := os.Stat(d.file.Name()); err != nil {
+		t.Errorf("expected the spool file to be kept, got %v", err)
+	}
+	d.release()
+	if _, err := os.Stat(d.file.Name()); !os.IsNotExist(err) {
+		t.Errorf("expected the spool file to be removed, got %v", err)
+	}
+}
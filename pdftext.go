@@ -0,0 +1,252 @@
+package webfetch
+
+import (
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// textMatrix is a PDF transformation matrix
+type textMatrix [3][3]float64
+
+var identityMatrix = textMatrix{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+
+func (x textMatrix) mul(y textMatrix) textMatrix {
+	var z textMatrix
+	for i := range 3 {
+		for j := range 3 {
+			for k := range 3 {
+				z[i][j] += x[i][k] * y[k][j]
+			}
+		}
+	}
+	return z
+}
+
+// translation returns the matrix translating by (tx, ty)
+func translation(tx, ty float64) textMatrix {
+	return textMatrix{{1, 0, 0}, {0, 1, 0}, {tx, ty, 1}}
+}
+
+// textState is the part of the graphics state used to place text
+type textState struct {
+	ctm   textMatrix
+	tc    float64 // character spacing
+	tw    float64 // word spacing
+	th    float64 // horizontal scaling
+	tl    float64 // leading
+	tfs   float64 // font size
+	trise float64 // rise
+	font  string  // font resource name
+}
+
+// hasCompositeFont reports whether page uses a composite (Type0) font, whose
+// text the library does not decode unless it has an Identity CMap
+func hasCompositeFont(page pdf.Page) bool {
+	for _, name := range page.Fonts() {
+		if page.Font(name).V.Key("Subtype").Name() == "Type0" {
+			return true
+		}
+	}
+	return false
+}
+
+// pageRotation returns the clockwise rotation in degrees of page when
+// displayed, 0, 90, 180 or 270, from its /Rotate attribute or that of its
+// ancestors
+func pageRotation(page pdf.Page) int {
+	for v := page.V; !v.IsNull(); v = v.Key("Parent") {
+		if r := v.Key("Rotate"); !r.IsNull() {
+			return (int(r.Int64())%360 + 360) % 360
+		}
+	}
+	return 0
+}
+
+// hasRotatedText reports whether texts, placed by the library, have glyphs that
+// do not run left to right. The library takes the horizontal scale of the text
+// rendering matrix as the font size, which is zero or negative for such glyphs.
+func hasRotatedText(texts []pdf.Text) bool {
+	return slices.ContainsFunc(texts, func(t pdf.Text) bool { return t.S != "" && t.FontSize <= 0 })
+}
+
+// readingFrame returns the position of a glyph drawn at (x, y) with the
+// direction (dx, dy) in a frame where its text runs left to right, rotating by
+// quarter turns so that the glyphs of a line share their Y position
+func readingFrame(x, y, dx, dy float64) (float64, float64) {
+	switch int(math.Round(math.Atan2(dy, dx)/(math.Pi/2))) & 3 {
+	case 1: // Bottom to top, as on pages rotated by 90 degrees
+		return y, -x
+	case 2: // Upside down
+		return -x, -y
+	case 3: // Top to bottom
+		return -y, x
+	}
+	return x, y
+}
+
+// interpretPageText returns the text elements of page, like page.Content,
+// decoding the codes of composite fonts with newCIDFont. Glyphs drawn rotated,
+// as on landscape pages and rotated scans, are placed in the frame where their
+// text runs left to right. It also reports whether most glyphs of composite
+// fonts have no Unicode mapping.
+func interpretPageText(page pdf.Page) (texts []pdf.Text, unmapped bool) {
+	contents := page.V.Key("Contents")
+	if contents.Kind() == pdf.Null {
+		return nil, false
+	}
+
+	decoders := make(map[string]glyphDecoder)
+	names := make(map[string]string)
+	decoder := func(name string) (glyphDecoder, string) {
+		if d, ok := decoders[name]; ok {
+			return d, names[name]
+		}
+		font := page.Font(name)
+		if font.V.IsNull() {
+			decoders[name] = nil
+			return nil, ""
+		}
+		base := font.BaseFont()
+		// Subset fonts are named with a tag, e.g. ABCDEF+NotoSansCJK
+		if i := strings.Index(base, "+"); i >= 0 {
+			base = base[i+1:]
+		}
+		decoders[name], names[name] = newGlyphDecoder(font), base
+		return decoders[name], base
+	}
+
+	var cidGlyphs, cidUnmapped int
+	g := textState{ctm: identityMatrix, th: 1}
+	var stack []textState
+	tm, tlm := identityMatrix, identityMatrix
+
+	show := func(raw string) {
+		d, base := decoder(g.font)
+		if d == nil {
+			return
+		}
+		_, cid := d.(*cidFont)
+		for _, glyph := range d.glyphs(raw) {
+			trm := textMatrix{{g.tfs * g.th, 0, 0}, {0, g.tfs, 0}, {0, g.trise, 1}}.mul(tm).mul(g.ctm)
+			if cid {
+				cidGlyphs++
+				if !glyph.mapped {
+					cidUnmapped++
+				}
+			}
+			if glyph.text != "" {
+				size := math.Hypot(trm[0][0], trm[0][1])
+				x, y := readingFrame(trm[2][0], trm[2][1], trm[0][0], trm[0][1])
+				texts = append(texts, pdf.Text{
+					Font:     base,
+					FontSize: size,
+					X:        x,
+					Y:        y,
+					W:        glyph.width / 1000 * size,
+					S:        glyph.text,
+				})
+			}
+
+			tx := glyph.width/1000*g.tfs + g.tc
+			if glyph.space {
+				tx += g.tw
+			}
+			tm = translation(tx*g.th, 0).mul(tm)
+		}
+	}
+	nextLine := func(tx, ty float64) {
+		tlm = translation(tx, ty).mul(tlm)
+		tm = tlm
+	}
+
+	pdf.Interpret(contents, func(stk *pdf.Stack, op string) {
+		args := make([]pdf.Value, stk.Len())
+		for i := len(args) - 1; i >= 0; i-- {
+			args[i] = stk.Pop()
+		}
+		number := func(i int) float64 {
+			if i < len(args) {
+				return args[i].Float64()
+			}
+			return 0
+		}
+
+		switch op {
+		case "q":
+			stack = append(stack, g)
+		case "Q":
+			if len(stack) > 0 {
+				g = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			if len(args) == 6 {
+				m := textMatrix{{number(0), number(1), 0}, {number(2), number(3), 0}, {number(4), number(5), 1}}
+				g.ctm = m.mul(g.ctm)
+			}
+		case "BT":
+			tm, tlm = identityMatrix, identityMatrix
+		case "Tc":
+			g.tc = number(0)
+		case "Tw":
+			g.tw = number(0)
+		case "Tz":
+			g.th = number(0) / 100
+		case "TL":
+			g.tl = number(0)
+		case "Ts":
+			g.trise = number(0)
+		case "Tf":
+			if len(args) == 2 {
+				g.font = args[0].Name()
+				g.tfs = number(1)
+			}
+		case "Td":
+			nextLine(number(0), number(1))
+		case "TD":
+			g.tl = -number(1)
+			nextLine(number(0), number(1))
+		case "Tm":
+			if len(args) == 6 {
+				tlm = textMatrix{{number(0), number(1), 0}, {number(2), number(3), 0}, {number(4), number(5), 1}}
+				tm = tlm
+			}
+		case "T*":
+			nextLine(0, -g.tl)
+		case "Tj":
+			if len(args) == 1 {
+				show(args[0].RawString())
+			}
+		case "'":
+			nextLine(0, -g.tl)
+			if len(args) == 1 {
+				show(args[0].RawString())
+			}
+		case "\"":
+			if len(args) == 3 {
+				g.tw, g.tc = number(0), number(1)
+				nextLine(0, -g.tl)
+				show(args[2].RawString())
+			}
+		case "TJ":
+			if len(args) != 1 {
+				return
+			}
+			for i := range args[0].Len() {
+				v := args[0].Index(i)
+				if v.Kind() == pdf.String {
+					show(v.RawString())
+				} else {
+					// Adjustments are in thousandths of the font size
+					tx := -v.Float64() / 1000 * g.tfs * g.th
+					tm = translation(tx, 0).mul(tm)
+				}
+			}
+		}
+	})
+
+	return texts, cidGlyphs > 0 && cidUnmapped*2 > cidGlyphs
+}
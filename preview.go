@@ -0,0 +1,96 @@
+package webfetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// previewBytes is the size of the start of a page read by Preview, which holds
+// the head of most pages
+const previewBytes = 64 * 1024
+
+// PagePreview summarizes a page from the start of its HTML.
+type PagePreview struct {
+	// URL is the final URL after redirects.
+	URL string `json:"url"`
+	// ContentType is the Content-Type header.
+	ContentType string `json:"content_type,omitempty"`
+	// Title is the title of the page.
+	Title string `json:"title,omitempty"`
+	// Description is the meta or OpenGraph description of the page.
+	Description string `json:"description,omitempty"`
+	// Image is the absolute URL of the OpenGraph image of the page.
+	Image string `json:"image,omitempty"`
+	// SiteName is the OpenGraph site name.
+	SiteName string `json:"site_name,omitempty"`
+	// Size is the size of the page in bytes, or -1 if unknown.
+	Size int64 `json:"size"`
+	// EstimatedTokens is the estimated size in tokens of the Markdown of the
+	// page, extrapolated from the text of its start, or 0 if unknown.
+	EstimatedTokens int `json:"estimated_tokens,omitempty"`
+}
+
+// Preview reads the title, description, image and site name of the HTML page
+// at rawURL from its first 64KB, fetched with a ranged GET request, or with a
+// GET request read up to that size from servers that do not support ranges.
+// Other documents are only described by their content type and size.
+func Preview(ctx context.Context, rawURL string, opts FetchOptions) (*PagePreview, error) {
+	req, err := newRequest(ctx, http.MethodGet, rawURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", previewBytes-1))
+	resp, err := newClient(opts).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	defer resp.Body.Close()
+
+	preview := &PagePreview{
+		URL:         resp.Request.URL.String(),
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        -1,
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if _, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/"); ok {
+			if size, err := strconv.ParseInt(total, 10, 64); err == nil {
+				preview.Size = size
+			}
+		}
+	case http.StatusOK:
+		preview.Size = resp.ContentLength
+	default:
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+	if !isHTMLContentType(preview.ContentType) {
+		return preview, nil
+	}
+
+	sample := &countingReader{r: io.LimitReader(resp.Body, previewBytes)}
+	root, err := html.Parse(decodeHTML(sample, preview.ContentType))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+	metadata := extractMetadata(root, documentBase(root, resp.Request.URL))
+	preview.Title = extractTitle(root)
+	preview.Description = metadata.Description
+	preview.Image = metadata.Image
+	preview.SiteName = metadata.SiteName
+
+	// A short page is read whole
+	if preview.Size < 0 && sample.n < previewBytes {
+		preview.Size = sample.n
+	}
+	if preview.Size > 0 && sample.n > 0 {
+		density := float64(measureText(root).content()) / float64(sample.n)
+		preview.EstimatedTokens = int(density*float64(preview.Size)+3) / 4
+	}
+	return preview, nil
+}
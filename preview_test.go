@@ -0,0 +1,87 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreview(t *testing.T) {
+	head := `<html><head><title>Annual Report</title>
+<meta name="description" content="Results of the year">
+<meta property="og:image" content="/cover.png">
+<meta property="og:site_name" content="Example Corp">
+</head><body>`
+	// The page is larger than the preview, with a text density of about 1/2
+	page := head + strings.Repeat("<p>"+strings.Repeat("x", 100)+"</p><div></div>"+strings.Repeat(" ", 80), 1000) + "</body></html>"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/noranges":
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Length", strconv.Itoa(len(page)))
+			w.Write([]byte(page))
+		case "/short":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<title>Short</title><p>Hello</p>"))
+		case "/report.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader("%PDF-1.7"))
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(page))
+		}
+	}))
+	defer server.Close()
+
+	full := PagePreview{
+		ContentType: "text/html",
+		Title:       "Annual Report",
+		Description: "Results of the year",
+		Image:       server.URL + "/cover.png",
+		SiteName:    "Example Corp",
+		Size:        int64(len(page)),
+	}
+	tests := []struct {
+		name           string
+		path           string
+		expected       PagePreview
+		expectedTokens int
+	}{
+		{name: "ranges", path: "/page", expected: full, expectedTokens: 25000},
+		{name: "no ranges", path: "/noranges", expected: full, expectedTokens: 25000},
+		{name: "short page", path: "/short", expected: PagePreview{ContentType: "text/html", Title: "Short", Size: 32}, expectedTokens: 2},
+		{name: "PDF", path: "/report.pdf", expected: PagePreview{ContentType: "application/pdf", Size: 8}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preview, err := Preview(context.Background(), server.URL+tt.path, FetchOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tokens := preview.EstimatedTokens
+			preview.EstimatedTokens = 0
+			tt.expected.URL = server.URL + tt.path
+			if *preview != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, *preview)
+			}
+			// Estimates are within 20%
+			if tokens*10 < tt.expectedTokens*8 || tokens*10 > tt.expectedTokens*12 {
+				t.Errorf("expected about %d tokens, got %d", tt.expectedTokens, tokens)
+			}
+		})
+	}
+
+	var statusErr *StatusError
+	if _, err := Preview(context.Background(), server.URL+"/missing", FetchOptions{}); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status error 404, got %v", err)
+	}
+}
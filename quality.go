@@ -0,0 +1,131 @@
+package webfetch
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Quality estimates how much of an HTML page is readable content, so that
+// pages made mostly of navigation, link lists or scripts can be told apart
+// from articles worth citing.
+type Quality struct {
+	// Score rates the page from 0, no readable content, to 1, a substantial
+	// text with little boilerplate.
+	Score float64 `json:"score"`
+	// TextDensity is the share of the HTML made of content text.
+	TextDensity float64 `json:"text_density"`
+	// BoilerplateRatio is the share of the text of the page in elements
+	// dropped from the Markdown, such as navigation, headers and footers.
+	BoilerplateRatio float64 `json:"boilerplate_ratio"`
+	// LinkDensity is the share of the content text that is link text.
+	LinkDensity float64 `json:"link_density"`
+	// Words is the number of words of the content text.
+	Words int `json:"words"`
+}
+
+// Thresholds of the quality score: pages reach the full density score when
+// qualityDensityTarget of their HTML is content text, and the full length
+// score at qualityWordsTarget words
+const (
+	qualityDensityTarget = 0.25
+	qualityWordsTarget   = 300
+)
+
+// textStats counts the non-space characters of the text of a page
+type textStats struct {
+	// total counts all the text, boilerplate the text of non-content elements
+	// and links the link text outside them
+	total, boilerplate, links int
+	// words counts the words outside non-content elements
+	words int
+}
+
+// content returns the number of characters of the content text
+func (s textStats) content() int {
+	return s.total - s.boilerplate
+}
+
+// measureText measures the text of the body of root, before non-content
+// elements are removed
+func measureText(root *html.Node) textStats {
+	body := findElement(root, func(n *html.Node) bool { return n.DataAtom == atom.Body })
+	if body == nil {
+		body = root
+	}
+
+	var stats textStats
+	var walk func(n *html.Node, inBoilerplate, inLink bool)
+	walk = func(n *html.Node, inBoilerplate, inLink bool) {
+		switch n.Type {
+		case html.TextNode:
+			chars := 0
+			for _, r := range n.Data {
+				if !unicode.IsSpace(r) {
+					chars++
+				}
+			}
+			stats.total += chars
+			switch {
+			case inBoilerplate:
+				stats.boilerplate += chars
+			case inLink:
+				stats.links += chars
+				stats.words += len(strings.Fields(n.Data))
+			default:
+				stats.words += len(strings.Fields(n.Data))
+			}
+			return
+		case html.ElementNode:
+			switch n.DataAtom {
+			case atom.Script, atom.Style, atom.Noscript, atom.Template:
+				return
+			case atom.A:
+				inLink = true
+			}
+			if slices.Contains(tagsToRemove, n.Data) {
+				inBoilerplate = true
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, inBoilerplate, inLink)
+		}
+	}
+	walk(body, false, false)
+	return stats
+}
+
+// assessQuality rates the text of root, parsed from htmlSize bytes of HTML
+func assessQuality(root *html.Node, htmlSize int64) *Quality {
+	stats := measureText(root)
+	q := &Quality{Words: stats.words}
+	content := stats.content()
+	if stats.total > 0 {
+		q.BoilerplateRatio = float64(stats.boilerplate) / float64(stats.total)
+	}
+	if content > 0 {
+		q.LinkDensity = float64(stats.links) / float64(content)
+	}
+	if htmlSize > 0 {
+		q.TextDensity = min(1, float64(content)/float64(htmlSize))
+	}
+
+	// Dense, mostly unlinked content scores high, scaled down for short pages
+	score := 0.4*min(1, q.TextDensity/qualityDensityTarget) + 0.3*(1-q.LinkDensity) + 0.3*(1-q.BoilerplateRatio)
+	q.Score = score * min(1, float64(stats.words)/qualityWordsTarget)
+
+	q.Score = roundRatio(q.Score)
+	q.TextDensity = roundRatio(q.TextDensity)
+	q.BoilerplateRatio = roundRatio(q.BoilerplateRatio)
+	q.LinkDensity = roundRatio(q.LinkDensity)
+	return q
+}
+
+// roundRatio rounds a ratio to two decimals
+func roundRatio(f float64) float64 {
+	return math.Round(f*100) / 100
+}
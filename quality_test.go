@@ -0,0 +1,70 @@
+package webfetch
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAssessQuality(t *testing.T) {
+	article := "<p>" + strings.Repeat("The committee published its findings on the river after two years of measurements. ", 30) + "</p>"
+	links := strings.Repeat(`<li><a href="/page">Another page of the site</a></li>`, 40)
+	nav := "<nav>" + strings.Repeat(`<a href="/section">Section</a> `, 40) + "</nav>"
+
+	tests := []struct {
+		name     string
+		page     string
+		minScore float64
+		maxScore float64
+		check    func(q *Quality) bool
+	}{
+		{
+			name:     "article",
+			page:     "<html><body><h1>Findings</h1>" + article + "</body></html>",
+			minScore: 0.9,
+			maxScore: 1,
+			check:    func(q *Quality) bool { return q.LinkDensity == 0 && q.BoilerplateRatio == 0 && q.Words == 391 },
+		},
+		{
+			name:     "article with navigation",
+			page:     "<html><body>" + nav + article + "</body></html>",
+			minScore: 0.9,
+			maxScore: 0.99,
+			check:    func(q *Quality) bool { return q.BoilerplateRatio > 0.1 && q.BoilerplateRatio < 0.2 },
+		},
+		{
+			name:     "link list",
+			page:     "<html><body><ul>" + links + "</ul></body></html>",
+			minScore: 0,
+			maxScore: 0.6,
+			check:    func(q *Quality) bool { return q.LinkDensity == 1 },
+		},
+		{
+			name:     "script shell",
+			page:     "<html><body><div id=app></div><script>" + strings.Repeat("render();", 500) + "</script><noscript>Enable JavaScript</noscript></body></html>",
+			minScore: 0,
+			maxScore: 0,
+			check:    func(q *Quality) bool { return q.Words == 0 && q.TextDensity == 0 },
+		},
+	}
+
+	baseURL, _ := url.Parse("https://example.com")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := convertHTML(strings.NewReader(tt.page), baseURL, nil, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			q := doc.Metadata.Quality
+			if q == nil {
+				t.Fatal("expected quality, got nil")
+			}
+			if q.Score < tt.minScore || q.Score > tt.maxScore {
+				t.Errorf("expected score in [%v, %v], got %+v", tt.minScore, tt.maxScore, q)
+			}
+			if !tt.check(q) {
+				t.Errorf("unexpected quality %+v", q)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package webfetch
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+// maxRawBinarySize is the maximum size of a binary body returned as base64 (1MB)
+const maxRawBinarySize = 1024 * 1024
+
+// isTextContentType checks if the content type indicates a textual format that can be
+// returned verbatim
+func isTextContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	if strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+json") ||
+		strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+
+	switch mediaType {
+	case "application/json",
+		"application/xml",
+		"application/javascript",
+		"application/ecmascript",
+		"application/x-javascript",
+		"application/x-www-form-urlencoded":
+		return true
+	}
+	return false
+}
+
+// readRaw reads the body without conversion. Textual bodies are returned as-is,
+// other bodies are base64 encoded when they do not exceed maxRawBinarySize. The
+// size of r is bounded by the caller.
+func readRaw(r io.Reader, contentType string) (*Document, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+
+	doc := &Document{ContentType: contentType}
+	if isTextContentType(contentType) {
+		doc.Content = string(data)
+		return doc, nil
+	}
+
+	if len(data) > maxRawBinarySize {
+		return nil, fmt.Errorf("binary body too large: %d bytes (max %d bytes)", len(data), maxRawBinarySize)
+	}
+	doc.Content = base64.StdEncoding.EncodeToString(data)
+	doc.Encoding = "base64"
+	return doc, nil
+}
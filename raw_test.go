@@ -0,0 +1,119 @@
+package webfetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_isTextContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		expected    bool
+	}{
+		{"text/html", true},
+		{"text/plain; charset=utf-8", true},
+		{"application/json", true},
+		{"application/ld+json", true},
+		{"application/rss+xml", true},
+		{"APPLICATION/JSON", true},
+		{"application/javascript", true},
+		{"application/pdf", false},
+		{"image/png", false},
+		{"application/octet-stream", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			result := isTextContentType(tt.contentType)
+			if result != tt.expected {
+				t.Errorf("isTextContentType(%q) = %v, want %v", tt.contentType, result, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_readRaw(t *testing.T) {
+	binary := []byte{0x89, 'P', 'N', 'G', 0x00, 0x01}
+
+	tests := []struct {
+		name             string
+		body             []byte
+		contentType      string
+		expectedContent  string
+		expectedEncoding string
+		expectedError    string
+	}{
+		{
+			name:            "HTML source returned verbatim",
+			body:            []byte(`<html><head><meta name="x"></head></html>`),
+			contentType:     "text/html",
+			expectedContent: `<html><head><meta name="x"></head></html>`,
+		},
+		{
+			name:            "JSON returned verbatim",
+			body:            []byte(`{"a": 1}`),
+			contentType:     "application/json",
+			expectedContent: `{"a": 1}`,
+		},
+		{
+			name:             "binary returned as base64",
+			body:             binary,
+			contentType:      "image/png",
+			expectedContent:  base64.StdEncoding.EncodeToString(binary),
+			expectedEncoding: "base64",
+		},
+		{
+			name:          "binary over size cap",
+			body:          make([]byte, maxRawBinarySize+1),
+			contentType:   "application/octet-stream",
+			expectedError: "binary body too large",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := readRaw(bytes.NewReader(tt.body), tt.contentType)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if doc.Content != tt.expectedContent {
+				t.Errorf("expected content %q, got %q", tt.expectedContent, doc.Content)
+			}
+			if doc.Encoding != tt.expectedEncoding {
+				t.Errorf("expected encoding %q, got %q", tt.expectedEncoding, doc.Encoding)
+			}
+			if doc.ContentType != tt.contentType {
+				t.Errorf("expected content type %q, got %q", tt.contentType, doc.ContentType)
+			}
+		})
+	}
+}
+
+func TestFetch_Raw(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"accept": "` + r.Header.Get("Accept") + `"}`))
+	}))
+	defer server.Close()
+
+	doc, err := Fetch(context.Background(), server.URL, FetchOptions{Timeout: 5 * time.Second, Raw: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if doc.Content != `{"accept": "*/*"}` {
+		t.Errorf("expected raw JSON body, got %q", doc.Content)
+	}
+}
@@ -0,0 +1,203 @@
+package webfetch
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a Redis server supporting the commands used by RedisStore,
+// requiring password and answering SCAN two keys at a time
+type fakeRedis struct {
+	mu       sync.Mutex
+	values   map[string]string
+	ttls     map[string]string
+	password string
+	db       string
+}
+
+func newFakeRedis(t *testing.T, password string) (*fakeRedis, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	f := &fakeRedis{values: make(map[string]string), ttls: make(map[string]string), password: password}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f, ln.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authenticated := f.password == ""
+	for {
+		req, err := readRedisReply(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range req.([]any) {
+			args = append(args, string(arg.([]byte)))
+		}
+
+		f.mu.Lock()
+		var reply string
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			authenticated = args[len(args)-1] == f.password
+			reply = "+OK\r\n"
+			if !authenticated {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case cmd == "SELECT":
+			f.db = args[1]
+			reply = "+OK\r\n"
+		case cmd == "GET":
+			reply = "$-1\r\n"
+			if v, ok := f.values[args[1]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			}
+		case cmd == "SET":
+			f.values[args[1]] = args[2]
+			if len(args) == 5 {
+				f.ttls[args[1]] = args[4]
+			}
+			reply = "+OK\r\n"
+		case cmd == "DEL":
+			_, ok := f.values[args[1]]
+			delete(f.values, args[1])
+			reply = ":0\r\n"
+			if ok {
+				reply = ":1\r\n"
+			}
+		case cmd == "SCAN":
+			prefix := strings.TrimSuffix(args[3], "*")
+			var keys []string
+			for k := range f.values {
+				if strings.HasPrefix(k, prefix) {
+					keys = append(keys, k)
+				}
+			}
+			// Pages are taken from a stable order of the keys
+			sort.Strings(keys)
+			var cursor int
+			fmt.Sscan(args[1], &cursor)
+			next := "0"
+			if cursor+2 < len(keys) {
+				next = fmt.Sprint(cursor + 2)
+			}
+			page := keys[min(cursor, len(keys)):min(cursor+2, len(keys))]
+			reply = fmt.Sprintf("*2\r\n$%d\r\n%s\r\n*%d\r\n", len(next), next, len(page))
+			for _, k := range page {
+				reply += fmt.Sprintf("$%d\r\n%s\r\n", len(k), k)
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		f.mu.Unlock()
+		conn.Write([]byte(reply))
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	fake, addr := newFakeRedis(t, "secret")
+	store, err := NewRedisStore("redis://:secret@"+addr+"/2", "webfetch:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := store.Set(ctx, key, []byte("value "+key), time.Minute); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	fake.mu.Lock()
+	fake.values["other"] = "not in the store"
+	fake.mu.Unlock()
+
+	value, ok, err := store.Get(ctx, "b")
+	if err != nil || !ok || string(value) != "value b" {
+		t.Errorf("expected value b, got %q, %t, %v", value, ok, err)
+	}
+	if _, ok, err := store.Get(ctx, "missing"); ok || err != nil {
+		t.Errorf("expected missing key, got %t, %v", ok, err)
+	}
+	fake.mu.Lock()
+	if fake.ttls["webfetch:a"] != "60000" || fake.db != "2" {
+		t.Errorf("expected TTL 60000 in database 2, got %q in %q", fake.ttls["webfetch:a"], fake.db)
+	}
+	fake.mu.Unlock()
+
+	keys, err := store.Keys(ctx)
+	if err != nil || len(keys) != 3 {
+		t.Errorf("expected 3 keys, got %v, %v", keys, err)
+	}
+
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok, _ := store.Get(ctx, "a"); ok {
+		t.Error("expected deleted key to be missing")
+	}
+
+	wrong, _ := NewRedisStore("redis://:wrong@"+addr, "webfetch:")
+	if _, _, err := wrong.Get(ctx, "b"); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("expected authentication error, got %v", err)
+	}
+}
+
+func TestNewRedisStore_InvalidURL(t *testing.T) {
+	for _, rawURL := range []string{"http://localhost", "redis://", "redis://localhost/db"} {
+		if _, err := NewRedisStore(rawURL, ""); err == nil || !strings.Contains(err.Error(), "invalid Redis URL") {
+			t.Errorf("expected invalid Redis URL error for %q, got %v", rawURL, err)
+		}
+	}
+}
+
+func TestFetch_SharedCacheStore(t *testing.T) {
+	var hits atomic.Int64
+	server := newCountingServer(&hits)
+	defer server.Close()
+
+	_, addr := newFakeRedis(t, "")
+	store, err := NewRedisStore("redis://"+addr, "webfetch:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Two replicas with their own cache share the store
+	for i := range 2 {
+		opts := FetchOptions{Timeout: 5 * time.Second, Cache: NewCacheWithStore(time.Minute, store)}
+		doc, err := Fetch(context.Background(), server.URL+"/page", opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if doc.Content != "hit 1" {
+			t.Errorf("expected fetch %d to be served the shared entry, got %q", i+1, doc.Content)
+		}
+	}
+
+	if entries := NewCacheWithStore(time.Minute, store).Entries(); len(entries) != 1 || entries[0].URL != server.URL+"/page" {
+		t.Errorf("expected the shared entry, got %+v", entries)
+	}
+}
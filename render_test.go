@@ -0,0 +1,70 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetch_Render(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/app", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><div id="app"></div><script src="/app.js"></script></body></html>`))
+	}))
+	defer server.Close()
+
+	errBrowser := errors.New("browser crashed")
+	tests := []struct {
+		name            string
+		render          RenderFunc
+		expectedContent string
+		expectedErr     error
+	}{
+		{name: "not rendered", expectedContent: ""},
+		{
+			name: "render error",
+			render: func(ctx context.Context, rawURL string) (string, error) {
+				return "", errBrowser
+			},
+			expectedErr: errBrowser,
+		},
+		{
+			name: "rendered",
+			render: func(ctx context.Context, rawURL string) (string, error) {
+				if rawURL != server.URL+"/app" {
+					t.Errorf("expected the final URL to be rendered, got %s", rawURL)
+				}
+				return `<html><body><div id="app"><h1>Dashboard</h1><a href="/settings">Settings</a></div></body></html>`, nil
+			},
+			expectedContent: "# Dashboard\n\n[Settings](" + server.URL + "/settings)",
+		},
+	}
+
+	cache := NewCache(time.Hour)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Fetch(context.Background(), server.URL+"/old", FetchOptions{Timeout: 5 * time.Second, Render: tt.render, Cache: cache})
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("expected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// Rendered pages are cached apart from the others
+			if strings.TrimSpace(doc.Content) != tt.expectedContent {
+				t.Errorf("expected content %q, got %q", tt.expectedContent, doc.Content)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package webfetch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Limits of DNS-over-HTTPS lookups: the size of a response, and how long its
+// answers are cached at most
+const (
+	maxDoHResponseSize = 64 * 1024
+	maxDoHCacheTTL     = 5 * time.Minute
+)
+
+// Resolver resolves the host names of the connections of Fetch and the other
+// functions of the package, instead of the system resolver, so that they work
+// in networks whose DNS is restricted and can pin internal names. Names are
+// looked up in Hosts first, then with the DNS-over-HTTPS endpoint DoHURL if
+// set, else with the DNS servers of Servers if any, else with the system
+// resolver. The fields must not be modified after first use. It is safe for
+// concurrent use.
+type Resolver struct {
+	// Hosts maps lowercase host names to their addresses, like a hosts file.
+	Hosts map[string][]netip.Addr
+	// Servers are the addresses, as host:port, of the DNS servers queried in
+	// turn instead of those of the system.
+	Servers []string
+	// DoHURL is the URL of a DNS-over-HTTPS endpoint (RFC 8484), such as
+	// https://cloudflare-dns.com/dns-query. Its own host name is resolved with
+	// Hosts and the system resolver.
+	DoHURL string
+
+	initOnce  sync.Once
+	resolver  *net.Resolver
+	dohClient *http.Client
+	next      atomic.Uint32
+
+	mu       sync.Mutex
+	dohCache map[string]dohEntry
+}
+
+// dohEntry is a cached DNS-over-HTTPS lookup
+type dohEntry struct {
+	addrs   []netip.Addr
+	expires time.Time
+}
+
+// init sets up the resolver of Servers and the client of DoHURL
+func (r *Resolver) init() {
+	r.initOnce.Do(func() {
+		r.resolver = net.DefaultResolver
+		if len(r.Servers) > 0 {
+			dialer := &net.Dialer{Timeout: 5 * time.Second}
+			r.resolver = &net.Resolver{
+				PreferGo: true,
+				// Each attempt of the Go resolver moves to the next server
+				Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+					server := r.Servers[int(r.next.Add(1)-1)%len(r.Servers)]
+					return dialer.DialContext(ctx, network, server)
+				},
+			}
+		}
+		if r.DoHURL != "" {
+			dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.DialContext = r.dialContext(dialer.DialContext, r.lookupSystem)
+			r.dohClient = &http.Client{Transport: transport, Timeout: 10 * time.Second}
+			r.dohCache = make(map[string]dohEntry)
+		}
+	})
+}
+
+// LookupNetIP returns the addresses of host. Unknown hosts fail with a
+// *net.DNSError whose IsNotFound is set.
+func (r *Resolver) LookupNetIP(ctx context.Context, host string) ([]netip.Addr, error) {
+	r.init()
+	if r.DoHURL != "" {
+		return r.lookupDoH(ctx, host)
+	}
+	return r.lookupSystem(ctx, host)
+}
+
+// lookupHosts returns the addresses of host in Hosts
+func (r *Resolver) lookupHosts(host string) ([]netip.Addr, bool) {
+	addrs, ok := r.Hosts[strings.TrimSuffix(strings.ToLower(host), ".")]
+	return addrs, ok && len(addrs) > 0
+}
+
+// lookupSystem resolves host with Hosts, then the DNS servers of Servers or
+// the system resolver
+func (r *Resolver) lookupSystem(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addrs, ok := r.lookupHosts(host); ok {
+		return addrs, nil
+	}
+	addrs, err := r.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	for i, addr := range addrs {
+		addrs[i] = addr.Unmap()
+	}
+	return addrs, nil
+}
+
+// lookupDoH resolves host with Hosts, then the A and AAAA records returned by
+// the DNS-over-HTTPS endpoint, cached for their TTL
+func (r *Resolver) lookupDoH(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addrs, ok := r.lookupHosts(host); ok {
+		return addrs, nil
+	}
+	name := strings.TrimSuffix(strings.ToLower(host), ".")
+	r.mu.Lock()
+	entry, ok := r.dohCache[name]
+	r.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	var addrs []netip.Addr
+	ttl := maxDoHCacheTTL
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		found, foundTTL, err := r.queryDoH(ctx, name, qtype)
+		if err != nil {
+			return nil, &net.DNSError{Err: err.Error(), Name: host, Server: r.DoHURL, IsNotFound: errors.Is(err, errDNSNotFound), IsTimeout: isTimeout(err)}
+		}
+		addrs = append(addrs, found...)
+		if len(found) > 0 {
+			ttl = min(ttl, foundTTL)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: errDNSNotFound.Error(), Name: host, Server: r.DoHURL, IsNotFound: true}
+	}
+
+	r.mu.Lock()
+	r.dohCache[name] = dohEntry{addrs: addrs, expires: time.Now().Add(ttl)}
+	r.mu.Unlock()
+	return addrs, nil
+}
+
+// errDNSNotFound is the error of names that do not exist
+var errDNSNotFound = errors.New("no such host")
+
+// isTimeout reports whether err is a timeout
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// queryDoH sends a query for the qtype records of name to the DNS-over-HTTPS
+// endpoint, returning the addresses of the answers and their lowest TTL
+func (r *Resolver) queryDoH(ctx context.Context, name string, qtype dnsmessage.Type) ([]netip.Addr, time.Duration, error) {
+	qname, err := dnsmessage.NewName(name + ".")
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid host name: %w", err)
+	}
+	// The ID is 0 so that responses can be cached by HTTP caches
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{RecursionDesired: true})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, 0, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, 0, err
+	}
+	query, err := b.Finish()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.DoHURL, bytes.NewReader(query))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := r.dohClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("DNS-over-HTTPS endpoint returned status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDoHResponseSize))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var p dnsmessage.Parser
+	header, err := p.Start(body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid DNS response: %w", err)
+	}
+	switch header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, 0, errDNSNotFound
+	default:
+		return nil, 0, fmt.Errorf("DNS server returned %s", header.RCode)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, 0, fmt.Errorf("invalid DNS response: %w", err)
+	}
+	var addrs []netip.Addr
+	ttl := maxDoHCacheTTL
+	for {
+		h, err := p.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid DNS response: %w", err)
+		}
+		// CNAME records are followed by the records of their target
+		switch {
+		case h.Type == dnsmessage.TypeA && qtype == dnsmessage.TypeA:
+			a, err := p.AResource()
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid DNS response: %w", err)
+			}
+			addrs = append(addrs, netip.AddrFrom4(a.A))
+		case h.Type == dnsmessage.TypeAAAA && qtype == dnsmessage.TypeAAAA:
+			aaaa, err := p.AAAAResource()
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid DNS response: %w", err)
+			}
+			addrs = append(addrs, netip.AddrFrom16(aaaa.AAAA))
+		default:
+			if err := p.SkipAnswer(); err != nil {
+				return nil, 0, fmt.Errorf("invalid DNS response: %w", err)
+			}
+			continue
+		}
+		ttl = min(ttl, time.Duration(h.TTL)*time.Second)
+	}
+	return addrs, ttl, nil
+}
+
+// dialContext returns a dial function resolving host names with lookup, then
+// dialing their addresses in turn with dial until one connects
+func (r *Resolver) dialContext(
+	dial func(ctx context.Context, network, address string) (net.Conn, error),
+	lookup func(ctx context.Context, host string) ([]netip.Addr, error),
+) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, portStr, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := netip.ParseAddr(host); err == nil {
+			return dial(ctx, network, address)
+		}
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", portStr)
+		}
+		addrs, err := lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var firstErr error
+		for _, addr := range addrs {
+			if network == "tcp4" && !addr.Is4() || network == "tcp6" && !addr.Is6() {
+				continue
+			}
+			conn, err := dial(ctx, network, netip.AddrPortFrom(addr, uint16(port)).String())
+			if err == nil {
+				return conn, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		if firstErr == nil {
+			firstErr = &net.DNSError{Err: "no suitable address", Name: host}
+		}
+		return nil, firstErr
+	}
+}
+
+// ParseHosts parses a hosts file, whose lines hold an address followed by
+// the host names it resolves, comments starting with #. Names are lowercased.
+func ParseHosts(r io.Reader) (map[string][]netip.Addr, error) {
+	hosts := make(map[string][]netip.Addr)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: missing host name", n)
+		}
+		addr, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid address %q", n, fields[0])
+		}
+		for _, name := range fields[1:] {
+			name = strings.TrimSuffix(strings.ToLower(name), ".")
+			hosts[name] = append(hosts[name], addr.Unmap())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
@@ -0,0 +1,197 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsAnswer answers a DNS query with the A records of names, or a name error
+// for other names
+func dnsAnswer(t *testing.T, query []byte, names map[string]netip.Addr) []byte {
+	t.Helper()
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil {
+		t.Errorf("invalid query: %v", err)
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		t.Errorf("invalid question: %v", err)
+		return nil
+	}
+
+	addr, ok := names[q.Name.String()]
+	rcode := dnsmessage.RCodeSuccess
+	if !ok {
+		rcode = dnsmessage.RCodeNameError
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, RecursionAvailable: true, RCode: rcode})
+	b.StartQuestions()
+	b.Question(q)
+	b.StartAnswers()
+	if ok && q.Type == dnsmessage.TypeA {
+		b.AResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}, dnsmessage.AResource{A: addr.As4()})
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Errorf("failed to build response: %v", err)
+	}
+	return msg
+}
+
+func TestParseHosts(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected map[string][]netip.Addr
+		err      string
+	}{
+		{
+			name:  "entries",
+			input: "# pinned names\n10.0.0.5 Wiki.Internal wiki.\n\n10.0.0.6 wiki.internal # secondary\n::1 local6\n",
+			expected: map[string][]netip.Addr{
+				"wiki.internal": {netip.MustParseAddr("10.0.0.5"), netip.MustParseAddr("10.0.0.6")},
+				"wiki":          {netip.MustParseAddr("10.0.0.5")},
+				"local6":        {netip.MustParseAddr("::1")},
+			},
+		},
+		{name: "invalid address", input: "10.0.0.500 wiki\n", err: `line 1: invalid address "10.0.0.500"`},
+		{name: "missing name", input: "\n10.0.0.5\n", err: "line 2: missing host name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts, err := ParseHosts(strings.NewReader(tt.input))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(hosts, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, hosts)
+			}
+		})
+	}
+}
+
+func TestFetch_Resolver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Hello from " + r.Host + "</p>"))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	names := map[string]netip.Addr{"app.internal.": netip.MustParseAddr("127.0.0.1")}
+
+	var dohQueries atomic.Int32
+	doh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			t.Errorf("expected a POST of application/dns-message, got %s of %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		dohQueries.Add(1)
+		query, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(dnsAnswer(t, query, names))
+	}))
+	defer doh.Close()
+
+	dns, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer dns.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := dns.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			dns.WriteTo(dnsAnswer(t, buf[:n], names), addr)
+		}
+	}()
+
+	tests := []struct {
+		name     string
+		resolver *Resolver
+	}{
+		{name: "hosts", resolver: &Resolver{Hosts: map[string][]netip.Addr{"app.internal": {netip.MustParseAddr("127.0.0.1")}}}},
+		{name: "servers", resolver: &Resolver{Servers: []string{dns.LocalAddr().String()}}},
+		{name: "doh", resolver: &Resolver{DoHURL: doh.URL}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := FetchOptions{Timeout: 5 * time.Second, Resolver: tt.resolver}
+			doc, err := Fetch(context.Background(), "http://app.internal:"+port+"/", opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(doc.Content, "Hello from app.internal:"+port) {
+				t.Errorf("expected the page of app.internal, got %q", doc.Content)
+			}
+
+			_, err = Fetch(context.Background(), "http://missing.internal:"+port+"/", opts)
+			var dnsErr *net.DNSError
+			if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+				t.Errorf("expected a not found DNS error, got %v", err)
+			}
+			if ClassifyError(err) != ErrorPermanent {
+				t.Errorf("expected a permanent error, got %s", ClassifyError(err))
+			}
+		})
+	}
+
+	// The answers of the DoH endpoint are cached
+	before := dohQueries.Load()
+	resolver := tests[2].resolver
+	if _, err := resolver.LookupNetIP(context.Background(), "app.internal"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dohQueries.Load() != before {
+		t.Errorf("expected a cached answer, got %d queries", dohQueries.Load()-before)
+	}
+}
+
+func TestFetch_ResolverAllowIP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Hello</p>"))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	errDenied := errors.New("address denied")
+	var seen []netip.Addr
+	_, err := Fetch(context.Background(), "http://app.internal:"+port+"/", FetchOptions{
+		Timeout:  5 * time.Second,
+		Resolver: &Resolver{Hosts: map[string][]netip.Addr{"app.internal": {netip.MustParseAddr("127.0.0.1")}}},
+		AllowIP: func(ip netip.Addr) error {
+			seen = append(seen, ip)
+			return errDenied
+		},
+	})
+	if !errors.Is(err, errDenied) {
+		t.Errorf("expected the connection to be refused, got %v", err)
+	}
+	if len(seen) != 1 || seen[0] != netip.MustParseAddr("127.0.0.1") {
+		t.Errorf("expected AllowIP to be called with 127.0.0.1, got %v", seen)
+	}
+}
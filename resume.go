@@ -0,0 +1,172 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxResumes is the number of times the download of a body is resumed
+const maxResumes = 3
+
+// resumableBody reads the body of a response, resuming the download with a
+// Range request from the offset reached when the connection breaks, if the
+// server supports byte ranges. The resumed requests share the timeout of
+// the first one.
+type resumableBody struct {
+	ctx      context.Context
+	client   *http.Client
+	req      *http.Request
+	deadline time.Time
+	// validator is the strong ETag or Last-Modified header of the response,
+	// sent in If-Range so that a changed document is not resumed
+	validator string
+	// size is the length of the body, or -1 if unknown
+	size int64
+	// readTimeout is the BodyReadTimeout of the resumed bodies
+	readTimeout time.Duration
+
+	body    io.ReadCloser
+	read    int64
+	resumes int
+	cancel  context.CancelFunc
+	// err is the error of a download that could not resume
+	err error
+}
+
+// newResumableBody returns the body of resp, sent by client, resumable until
+// deadline if not zero, the resumed bodies failing after readTimeout without
+// data. Bodies that the transport decompressed, whose server does not
+// announce byte ranges, or without a strong ETag or Last-Modified validator,
+// are returned as is.
+func newResumableBody(ctx context.Context, client *http.Client, resp *http.Response, deadline time.Time, readTimeout time.Duration) io.ReadCloser {
+	if resp.Uncompressed || resp.Header.Get("Content-Encoding") != "" ||
+		!strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes") {
+		return resp.Body
+	}
+	validator := resp.Header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = resp.Header.Get("Last-Modified")
+	}
+	if validator == "" {
+		// Without If-Range, the rest could belong to another version
+		return resp.Body
+	}
+	return &resumableBody{
+		ctx:         ctx,
+		client:      client,
+		req:         resp.Request,
+		deadline:    deadline,
+		validator:   validator,
+		size:        resp.ContentLength,
+		readTimeout: readTimeout,
+		body:        resp.Body,
+	}
+}
+
+func (b *resumableBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	for {
+		n, err := b.body.Read(p)
+		b.read += int64(n)
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		if !b.canResume(err) || b.resume() != nil {
+			b.err = err
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// canResume reports whether the download can resume after err
+func (b *resumableBody) canResume(err error) bool {
+	if b.resumes == maxResumes || b.ctx.Err() != nil {
+		return false
+	}
+	if !b.deadline.IsZero() && !time.Now().Before(b.deadline) {
+		return false
+	}
+	// Timeouts used up the time of the fetch
+	var netErr net.Error
+	return !errors.As(err, &netErr) || !netErr.Timeout()
+}
+
+// resume requests the rest of the body from the offset reached, after closing
+// the broken body so that its request limiter slot is free
+func (b *resumableBody) resume() error {
+	b.body.Close()
+	if b.cancel != nil {
+		b.cancel()
+		b.cancel = nil
+	}
+	// The request is cancelled when its body stalls
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if b.deadline.IsZero() {
+		ctx, cancel = context.WithCancel(b.ctx)
+	} else {
+		ctx, cancel = context.WithDeadline(b.ctx, b.deadline)
+	}
+	req := b.req.Clone(ctx)
+	// The conditions of a revalidation were already evaluated
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", b.read))
+	req.Header.Set("If-Range", b.validator)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		cancel()
+		return err
+	}
+	// The rest of the same document, starting at the offset reached
+	if resp.StatusCode != http.StatusPartialContent || !b.matchesRange(resp.Header.Get("Content-Range")) {
+		resp.Body.Close()
+		cancel()
+		return fmt.Errorf("cannot resume download: unexpected status code %d", resp.StatusCode)
+	}
+
+	b.body = withBodyReadTimeout(resp.Body, b.readTimeout, cancel)
+	b.cancel = cancel
+	b.resumes++
+	return nil
+}
+
+// matchesRange reports whether the Content-Range header of a resumed response
+// starts at the offset reached and ends at the end of the body
+func (b *resumableBody) matchesRange(contentRange string) bool {
+	rest, ok := strings.CutPrefix(contentRange, "bytes ")
+	if !ok {
+		return false
+	}
+	span, total, _ := strings.Cut(rest, "/")
+	first, last, _ := strings.Cut(span, "-")
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start != b.read {
+		return false
+	}
+	if b.size < 0 {
+		return true
+	}
+	end, err := strconv.ParseInt(last, 10, 64)
+	return err == nil && end == b.size-1 && (total == "*" || total == strconv.FormatInt(b.size, 10))
+}
+
+// Close closes the body of the last response
+func (b *resumableBody) Close() error {
+	if b.cancel != nil {
+		b.cancel()
+	}
+	return b.body.Close()
+}
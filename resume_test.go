@@ -0,0 +1,118 @@
+package webfetch
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetch_ResumeDownload(t *testing.T) {
+	page := []byte("<html><body><p>" + strings.Repeat("Lorem ipsum dolor sit amet. ", 2000) + "END</p></body></html>")
+
+	tests := []struct {
+		name            string
+		acceptRanges    bool
+		etag            string
+		changed         bool
+		expectedResumes int
+		// expectedRanges is the number of range requests of failed downloads
+		expectedRanges int32
+		expectedErr    bool
+	}{
+		{name: "resumed", acceptRanges: true, etag: `"v1"`, expectedResumes: 1},
+		{name: "no ranges", etag: `"v1"`, expectedErr: true},
+		{name: "changed", acceptRanges: true, etag: `"v1"`, changed: true, expectedRanges: 1, expectedErr: true},
+		{name: "weak validator", acceptRanges: true, etag: `W/"v1"`, expectedErr: true},
+		{name: "no validator", acceptRanges: true, expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ranges atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				if tt.etag != "" {
+					w.Header().Set("ETag", tt.etag)
+				}
+				if tt.acceptRanges {
+					w.Header().Set("Accept-Ranges", "bytes")
+				}
+				if r.Header.Get("Range") != "" {
+					ranges.Add(1)
+					if tt.changed {
+						w.Header().Set("ETag", `"v2"`)
+					}
+					http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(page))
+					return
+				}
+
+				// The connection breaks halfway through the body
+				w.Header().Set("Content-Length", strconv.Itoa(len(page)))
+				w.WriteHeader(http.StatusOK)
+				w.Write(page[:len(page)/2])
+				w.(http.Flusher).Flush()
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					t.Errorf("failed to hijack: %v", err)
+					return
+				}
+				conn.Close()
+			}))
+			defer server.Close()
+
+			var info FetchInfo
+			doc, err := Fetch(context.Background(), server.URL, FetchOptions{
+				Timeout: 5 * time.Second,
+				OnFetch: func(i FetchInfo) { info = i },
+			})
+			if tt.expectedErr {
+				if err == nil {
+					t.Errorf("expected an error, got %d characters", len(doc.Content))
+				}
+				if ranges.Load() != tt.expectedRanges {
+					t.Errorf("expected %d range requests, got %d", tt.expectedRanges, ranges.Load())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.HasSuffix(strings.TrimSpace(doc.Content), "END") {
+				t.Errorf("expected the whole page, got %d characters ending with %q", len(doc.Content), doc.Content[max(0, len(doc.Content)-20):])
+			}
+			if info.Resumes != tt.expectedResumes || int(ranges.Load()) != tt.expectedResumes {
+				t.Errorf("expected %d resumes, got %d with %d range requests", tt.expectedResumes, info.Resumes, ranges.Load())
+			}
+			if info.Bytes != int64(len(page)) {
+				t.Errorf("expected %d bytes, got %d", len(page), info.Bytes)
+			}
+		})
+	}
+}
+
+func Test_resumableBody_matchesRange(t *testing.T) {
+	b := &resumableBody{read: 500, size: 1000}
+	tests := []struct {
+		contentRange string
+		expected     bool
+	}{
+		{contentRange: "bytes 500-999/1000", expected: true},
+		{contentRange: "bytes 500-999/*", expected: true},
+		{contentRange: "bytes 0-999/1000"},
+		{contentRange: "bytes 500-799/1000"},
+		{contentRange: "bytes 500-999/2000"},
+		{contentRange: "items 500-999/1000"},
+	}
+
+	for _, tt := range tests {
+		if got := b.matchesRange(tt.contentRange); got != tt.expected {
+			t.Errorf("expected %t for %q, got %t", tt.expected, tt.contentRange, got)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package webfetch
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// maxRobotsSize is the maximum size of a robots.txt file that is parsed (500KB, as in RFC 9309)
+const maxRobotsSize = 500 * 1024
+
+// robotsRule is an allow or disallow rule of a robots.txt group
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// robotsGroup holds the rules for a set of user agents
+type robotsGroup struct {
+	agents []string
+	rules  []robotsRule
+}
+
+// robots is a parsed robots.txt file
+type robots struct {
+	groups []*robotsGroup
+}
+
+// RobotsAllowed fetches the robots.txt file of the host of rawURL and reports
+// whether opts.UserAgent may fetch rawURL. As in RFC 9309, a missing robots.txt
+// allows everything and a server error disallows everything.
+func RobotsAllowed(ctx context.Context, rawURL string, opts FetchOptions) (bool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, fmt.Errorf("invalid URL: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return false, fmt.Errorf("invalid URL: missing scheme or host")
+	}
+
+	robotsURL := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	opts.Raw = true
+	opts.Headers = nil
+	req, err := newRequest(ctx, http.MethodGet, robotsURL.String(), opts)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := newClient(opts).Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch robots.txt: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return false, nil
+	case resp.StatusCode >= 400:
+		return true, nil
+	case resp.StatusCode != http.StatusOK:
+		return false, fmt.Errorf("unexpected robots.txt status code: %d", resp.StatusCode)
+	}
+
+	return parseRobots(io.LimitReader(resp.Body, maxRobotsSize)).allowed(userAgent(opts), u), nil
+}
+
+// parseRobots parses a robots.txt file, ignoring lines it does not understand
+func parseRobots(r io.Reader) *robots {
+	rb := &robots{}
+	var group *robotsGroup
+	inAgents := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive user-agent lines share the following rules
+			if !inAgents {
+				group = &robotsGroup{}
+				rb.groups = append(rb.groups, group)
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+			inAgents = true
+		case "allow", "disallow":
+			inAgents = false
+			if group == nil || value == "" {
+				continue
+			}
+			group.rules = append(group.rules, robotsRule{
+				allow:   key == "allow",
+				pattern: value,
+				re:      robotsPattern(value),
+			})
+		}
+	}
+	return rb
+}
+
+// robotsPattern compiles a robots.txt path pattern, where * matches any
+// sequence and a trailing $ anchors the end of the path
+func robotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// allowed reports whether userAgent may fetch u. The rules of the groups
+// naming the product token of userAgent apply, or else those of the * groups.
+// The longest matching rule wins, allow rules winning ties.
+func (rb *robots) allowed(userAgent string, u *url.URL) bool {
+	product, _, _ := strings.Cut(strings.ToLower(userAgent), "/")
+	product = strings.TrimSpace(product)
+
+	var rules []robotsRule
+	for _, name := range []string{product, "*"} {
+		matched := false
+		for _, group := range rb.groups {
+			if slices.Contains(group.agents, name) {
+				rules = append(rules, group.rules...)
+				matched = true
+			}
+		}
+		if matched {
+			break
+		}
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	allowed, longest := true, -1
+	for _, rule := range rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		if n := len(rule.pattern); n > longest || (n == longest && rule.allow) {
+			allowed, longest = rule.allow, n
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,99 @@
+package webfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRobots = `# comment
+User-agent: *
+Disallow: /private/
+Allow: /private/public$
+Disallow: /*.pdf$
+
+User-agent: webfetch
+User-agent: otherbot
+Disallow: /no-webfetch
+`
+
+func Test_robots_allowed(t *testing.T) {
+	rb := parseRobots(strings.NewReader(testRobots))
+
+	tests := []struct {
+		userAgent string
+		path      string
+		expected  bool
+	}{
+		{userAgent: "somebot/2.0", path: "/", expected: true},
+		{userAgent: "somebot/2.0", path: "/private/page", expected: false},
+		{userAgent: "somebot/2.0", path: "/private/public", expected: true},
+		{userAgent: "somebot/2.0", path: "/private/public/more", expected: false},
+		{userAgent: "somebot/2.0", path: "/docs/file.pdf", expected: false},
+		{userAgent: "somebot/2.0", path: "/docs/file.pdf?download=1", expected: true},
+		{userAgent: "webfetch/1.0", path: "/private/page", expected: true},
+		{userAgent: "WebFetch/1.0", path: "/no-webfetch", expected: false},
+		{userAgent: "otherbot", path: "/no-webfetch/sub", expected: false},
+	}
+
+	for _, tt := range tests {
+		u, _ := url.Parse("https://example.com" + tt.path)
+		if got := rb.allowed(tt.userAgent, u); got != tt.expected {
+			t.Errorf("%s %s: expected %v, got %v", tt.userAgent, tt.path, tt.expected, got)
+		}
+	}
+}
+
+func TestRobotsAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		expected bool
+	}{
+		{
+			name: "disallowed",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("User-agent: *\nDisallow: /page\n"))
+			},
+			expected: false,
+		},
+		{
+			name:     "missing robots.txt",
+			handler:  http.NotFound,
+			expected: true,
+		},
+		{
+			name: "server error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				tt.handler(w, r)
+			}))
+			defer server.Close()
+
+			allowed, err := RobotsAllowed(context.Background(), server.URL+"/page", FetchOptions{Timeout: 5 * time.Second})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if path != "/robots.txt" {
+				t.Errorf("expected /robots.txt to be requested, got %s", path)
+			}
+			if allowed != tt.expected {
+				t.Errorf("expected allowed %v, got %v", tt.expected, allowed)
+			}
+		})
+	}
+}
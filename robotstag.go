@@ -0,0 +1,70 @@
+package webfetch
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Robots directives asking search engines and archives not to keep a copy of a page
+const (
+	RobotsNoIndex   = "noindex"
+	RobotsNoArchive = "noarchive"
+	RobotsNone      = "none"
+)
+
+// robotsParamDirectives are the directives taking a value after a colon, which
+// are not user agent prefixes
+var robotsParamDirectives = []string{"unavailable_after", "max-snippet", "max-image-preview", "max-video-preview"}
+
+// NoArchive reports whether the robots directives of the page ask not to keep
+// a copy of it: noindex, noarchive or none.
+func (m Metadata) NoArchive() bool {
+	return slices.ContainsFunc(m.Robots, func(d string) bool {
+		return d == RobotsNoIndex || d == RobotsNoArchive || d == RobotsNone
+	})
+}
+
+// headerRobotsDirectives returns the directives of the X-Robots-Tag headers that
+// apply to every user agent. Directives after a user agent prefix, e.g.
+// "googlebot: noindex, nofollow", only apply to that user agent.
+func headerRobotsDirectives(header http.Header) []string {
+	var directives []string
+	for _, value := range header.Values("X-Robots-Tag") {
+		agent := ""
+		for _, item := range strings.Split(value, ",") {
+			item = strings.ToLower(strings.TrimSpace(item))
+			if name, rest, ok := strings.Cut(item, ":"); ok && !slices.Contains(robotsParamDirectives, name) {
+				agent = strings.TrimSpace(name)
+				item = strings.TrimSpace(rest)
+			}
+			if agent == "" && item != "" {
+				directives = append(directives, item)
+			}
+		}
+	}
+	return directives
+}
+
+// parseRobotsDirectives returns the lowercase directives of the content of a
+// robots meta tag
+func parseRobotsDirectives(content string) []string {
+	var directives []string
+	for _, item := range strings.Split(content, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			directives = append(directives, item)
+		}
+	}
+	return directives
+}
+
+// mergeRobotsDirectives returns the directives of a and b, without duplicates
+func mergeRobotsDirectives(a, b []string) []string {
+	merged := slices.Clone(a)
+	for _, d := range b {
+		if !slices.Contains(merged, d) {
+			merged = append(merged, d)
+		}
+	}
+	return merged
+}
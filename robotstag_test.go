@@ -0,0 +1,85 @@
+package webfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHeaderRobotsDirectives(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []string
+		expected []string
+	}{
+		{name: "none"},
+		{name: "directives", values: []string{"NoIndex, nofollow"}, expected: []string{"noindex", "nofollow"}},
+		{name: "several headers", values: []string{"noarchive", "nosnippet"}, expected: []string{"noarchive", "nosnippet"}},
+		{name: "user agent", values: []string{"googlebot: noindex, nofollow", "noarchive"}, expected: []string{"noarchive"}},
+		{name: "directive with value", values: []string{"unavailable_after: 2030-01-01, noarchive"}, expected: []string{"unavailable_after: 2030-01-01", "noarchive"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for _, v := range tt.values {
+				header.Add("X-Robots-Tag", v)
+			}
+			if got := headerRobotsDirectives(header); !slices.Equal(got, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFetch_HonorNoArchive(t *testing.T) {
+	var hits atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/header" {
+			w.Header().Set("X-Robots-Tag", "noarchive")
+		}
+		if r.URL.Path == "/meta" {
+			w.Write([]byte(`<meta name="robots" content="noindex, follow">`))
+		}
+		w.Write([]byte(`<p>Hello</p>`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name           string
+		path           string
+		honor          bool
+		expectedRobots []string
+		expectedHits   int64
+	}{
+		{name: "header", path: "/header", honor: true, expectedRobots: []string{"noarchive"}, expectedHits: 2},
+		{name: "meta tag", path: "/meta", honor: true, expectedRobots: []string{"noindex", "follow"}, expectedHits: 2},
+		{name: "not honored", path: "/meta", expectedRobots: []string{"noindex", "follow"}, expectedHits: 1},
+		{name: "no directives", path: "/page", honor: true, expectedHits: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits.Store(0)
+			opts := FetchOptions{Timeout: 5 * time.Second, Cache: NewCache(time.Minute), HonorNoArchive: tt.honor}
+			for range 2 {
+				doc, err := Fetch(context.Background(), server.URL+tt.path, opts)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !slices.Equal(doc.Metadata.Robots, tt.expectedRobots) {
+					t.Errorf("expected robots directives %q, got %q", tt.expectedRobots, doc.Metadata.Robots)
+				}
+			}
+			if hits.Load() != tt.expectedHits {
+				t.Errorf("expected %d requests, got %d", tt.expectedHits, hits.Load())
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package webfetch
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+// DefaultMaxDownloadSize is the maximum size of a response body that is read
+// when FetchOptions.MaxDownloadSize is not set (10MB). PDFs are bounded by
+// FetchOptions.MaxPDFSize instead.
+const DefaultMaxDownloadSize = 10 * 1024 * 1024
+
+// TooLargeError is returned by Fetch when a response body exceeds the download
+// size limit of its content type.
+type TooLargeError struct {
+	// ContentType is the media type of the body, e.g. text/html.
+	ContentType string
+	// Size is the size in bytes declared by Content-Length, or 0 when the body
+	// was found too large while reading it.
+	Size int64
+	// Limit is the maximum size in bytes for ContentType.
+	Limit int64
+}
+
+func (e *TooLargeError) Error() string {
+	name := e.ContentType
+	if name == "" {
+		name = "response"
+	}
+	if e.Size > 0 {
+		return fmt.Sprintf("content too large: %s body of %d bytes (max %d bytes)", name, e.Size, e.Limit)
+	}
+	return fmt.Sprintf("content too large: %s body exceeds %d bytes", name, e.Limit)
+}
+
+// MaxDownloadSize returns the maximum size in bytes of a response body of
+// contentType read by Fetch with opts.
+func MaxDownloadSize(contentType string, opts FetchOptions) int64 {
+	mediaType := mediaTypeOf(contentType)
+	if size, ok := opts.MaxDownloadSizes[mediaType]; ok {
+		return size
+	}
+	if major, _, ok := strings.Cut(mediaType, "/"); ok {
+		if size, ok := opts.MaxDownloadSizes[major+"/*"]; ok {
+			return size
+		}
+	}
+	if isPDFContentType(contentType) {
+		if opts.MaxPDFSize > 0 {
+			return opts.MaxPDFSize
+		}
+		return DefaultMaxPDFSize
+	}
+	if opts.MaxDownloadSize > 0 {
+		return opts.MaxDownloadSize
+	}
+	return DefaultMaxDownloadSize
+}
+
+// mediaTypeOf returns the lowercase media type of contentType, without parameters
+func mediaTypeOf(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, _, _ = strings.Cut(contentType, ";")
+	}
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+// limitBody returns r bounded to the download size limit of contentType: the
+// body is rejected at once when contentLength exceeds it, and reading more
+// than the limit fails with a *TooLargeError.
+func limitBody(r io.Reader, contentType string, contentLength int64, opts FetchOptions) (io.Reader, error) {
+	limit := MaxDownloadSize(contentType, opts)
+	if contentLength > limit {
+		return nil, &TooLargeError{ContentType: mediaTypeOf(contentType), Size: contentLength, Limit: limit}
+	}
+	return &limitedReader{r: r, n: limit, err: &TooLargeError{ContentType: mediaTypeOf(contentType), Limit: limit}}, nil
+}
+
+// limitedReader reads at most n bytes from r, then fails with err if r has
+// more data. The failure is sticky, as readers such as bufio.Reader.Peek may
+// drop the first error.
+type limitedReader struct {
+	r        io.Reader
+	n        int64
+	err      error
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, l.err
+	}
+	if l.n <= 0 {
+		// Probe for one more byte to tell a body of exactly the limit apart
+		var b [1]byte
+		n, err := l.r.Read(b[:])
+		if n > 0 {
+			l.exceeded = true
+			return 0, l.err
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
@@ -0,0 +1,126 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxDownloadSize(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		opts        FetchOptions
+		expected    int64
+	}{
+		{name: "default", contentType: "text/html", expected: DefaultMaxDownloadSize},
+		{name: "PDF default", contentType: "application/pdf", expected: DefaultMaxPDFSize},
+		{name: "option", contentType: "text/html; charset=utf-8", opts: FetchOptions{MaxDownloadSize: 100}, expected: 100},
+		{name: "PDF option", contentType: "application/pdf", opts: FetchOptions{MaxDownloadSize: 100, MaxPDFSize: 200}, expected: 200},
+		{
+			name:        "media type",
+			contentType: "Text/HTML; charset=utf-8",
+			opts:        FetchOptions{MaxDownloadSize: 100, MaxDownloadSizes: map[string]int64{"text/html": 50, "text/*": 20}},
+			expected:    50,
+		},
+		{
+			name:        "major type",
+			contentType: "text/plain",
+			opts:        FetchOptions{MaxDownloadSize: 100, MaxDownloadSizes: map[string]int64{"text/html": 50, "text/*": 20}},
+			expected:    20,
+		},
+		{
+			name:        "PDF media type",
+			contentType: "application/pdf",
+			opts:        FetchOptions{MaxPDFSize: 200, MaxDownloadSizes: map[string]int64{"application/pdf": 300}},
+			expected:    300,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MaxDownloadSize(tt.contentType, tt.opts); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFetch_MaxDownloadSize(t *testing.T) {
+	page := "<p>" + strings.Repeat("a", 93) + "</p>" // 100 bytes
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		if r.URL.Query().Get("length") != "" {
+			w.Header().Set("Content-Length", r.URL.Query().Get("length"))
+			return
+		}
+		// Flushing before writing the body leaves its length unknown
+		w.(http.Flusher).Flush()
+		w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		query    string
+		opts     FetchOptions
+		expected *TooLargeError
+	}{
+		{name: "at limit", query: "type=text/html", opts: FetchOptions{MaxDownloadSize: 100}},
+		{
+			name:     "over limit",
+			query:    "type=text/html",
+			opts:     FetchOptions{MaxDownloadSize: 99},
+			expected: &TooLargeError{ContentType: "text/html", Limit: 99},
+		},
+		{
+			name:     "Content-Length over limit",
+			query:    "type=text/html&length=5000",
+			opts:     FetchOptions{MaxDownloadSize: 1000},
+			expected: &TooLargeError{ContentType: "text/html", Size: 5000, Limit: 1000},
+		},
+		{
+			name:     "media type limit",
+			query:    "type=text/html",
+			opts:     FetchOptions{MaxDownloadSizes: map[string]int64{"text/html": 10}},
+			expected: &TooLargeError{ContentType: "text/html", Limit: 10},
+		},
+		{
+			name:     "raw",
+			query:    "type=text/plain",
+			opts:     FetchOptions{Raw: true, MaxDownloadSizes: map[string]int64{"text/*": 10}},
+			expected: &TooLargeError{ContentType: "text/plain", Limit: 10},
+		},
+		{
+			name:     "PDF",
+			query:    "type=application/pdf",
+			opts:     FetchOptions{MaxPDFSize: 10},
+			expected: &TooLargeError{ContentType: "application/pdf", Limit: 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Fetch(context.Background(), server.URL+"/?"+tt.query, tt.opts)
+			if tt.expected == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var tooLarge *TooLargeError
+			if !errors.As(err, &tooLarge) {
+				t.Fatalf("expected a *TooLargeError, got %v", err)
+			}
+			if *tooLarge != *tt.expected {
+				t.Errorf("expected %+v, got %+v", *tt.expected, *tooLarge)
+			}
+			if err.Error() != tt.expected.Error() {
+				t.Errorf("expected error %q, got %q", tt.expected.Error(), err.Error())
+			}
+		})
+	}
+}
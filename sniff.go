@@ -0,0 +1,120 @@
+package webfetch
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// sniffLen is the number of bytes http.DetectContentType considers
+const sniffLen = 512
+
+// Kinds of content compared by StrictContentType
+const (
+	kindHTML    = "html"
+	kindText    = "text"
+	kindPDF     = "pdf"
+	kindImage   = "image"
+	kindArchive = "archive"
+	kindMedia   = "media"
+	kindBinary  = "binary"
+)
+
+// extensionKinds are the URL path extensions checked by StrictContentType
+var extensionKinds = map[string]string{
+	".html": kindHTML,
+	".htm":  kindHTML,
+	".pdf":  kindPDF,
+	".png":  kindImage,
+	".jpg":  kindImage,
+	".jpeg": kindImage,
+	".gif":  kindImage,
+	".webp": kindImage,
+	".zip":  kindArchive,
+	".gz":   kindArchive,
+}
+
+// ContentMismatchError is returned by Fetch with FetchOptions.StrictContentType
+// when the content of a response contradicts its declared type or the
+// extension of its URL.
+type ContentMismatchError struct {
+	// Declared is the media type of the Content-Type header.
+	Declared string
+	// Extension is the extension of the URL path when it is the one
+	// contradicted, e.g. .pdf, or empty.
+	Extension string
+	// Sniffed is the media type detected from the first bytes of the body, as
+	// by http.DetectContentType.
+	Sniffed string
+}
+
+func (e *ContentMismatchError) Error() string {
+	if e.Extension != "" {
+		return fmt.Sprintf("content type mismatch: body looks like %s but the URL extension is %s", e.Sniffed, e.Extension)
+	}
+	return fmt.Sprintf("content type mismatch: body looks like %s but is declared as %s", e.Sniffed, e.Declared)
+}
+
+// contentKind returns the kind of content of mediaType, or "" if it is not
+// known
+func contentKind(mediaType string) string {
+	major, _, _ := strings.Cut(mediaType, "/")
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		return kindHTML
+	case mediaType == "application/pdf":
+		return kindPDF
+	case mediaType == "application/octet-stream":
+		return kindBinary
+	case mediaType == "image/svg+xml" || major == "text" || mediaType == "application/json" ||
+		mediaType == "application/xml" || strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml"):
+		return kindText
+	case major == "image":
+		return kindImage
+	case major == "audio" || major == "video" || mediaType == "application/ogg":
+		return kindMedia
+	case mediaType == "application/zip" || mediaType == "application/x-gzip" || mediaType == "application/gzip" ||
+		mediaType == "application/x-rar-compressed" || mediaType == "application/vnd.rar":
+		return kindArchive
+	}
+	return ""
+}
+
+// contradicts reports whether content sniffed as kind sniffed contradicts the
+// kind claimed by a header or an extension. HTML and plain text are not told
+// apart, as text files often start like HTML, and unrecognized binary content
+// only contradicts textual kinds and PDFs, whose signature is known.
+func contradicts(claimed, sniffed string) bool {
+	switch {
+	case claimed == "" || sniffed == "" || claimed == kindBinary || claimed == sniffed:
+		return false
+	case (claimed == kindHTML || claimed == kindText) && (sniffed == kindHTML || sniffed == kindText):
+		return false
+	case sniffed == kindBinary:
+		return claimed == kindHTML || claimed == kindText || claimed == kindPDF
+	}
+	return true
+}
+
+// checkContentType sniffs the first bytes of body and returns a
+// *ContentMismatchError if they contradict contentType or the extension of
+// urlPath. The returned reader yields the whole body.
+func checkContentType(body io.Reader, contentType, urlPath string) (io.Reader, error) {
+	br := bufio.NewReaderSize(body, sniffLen)
+	// Errors are left for the converters to report
+	head, _ := br.Peek(sniffLen)
+	sniffed := mediaTypeOf(http.DetectContentType(head))
+	declared := mediaTypeOf(contentType)
+
+	if contradicts(contentKind(declared), contentKind(sniffed)) {
+		return nil, &ContentMismatchError{Declared: declared, Sniffed: sniffed}
+	}
+	ext := strings.ToLower(path.Ext(urlPath))
+	if contradicts(extensionKinds[ext], contentKind(sniffed)) {
+		return nil, &ContentMismatchError{Declared: declared, Extension: ext, Sniffed: sniffed}
+	}
+	return br, nil
+}
@@ -0,0 +1,73 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestFetch_StrictContentType(t *testing.T) {
+	pdf, err := os.ReadFile("testdata/test.pdf")
+	if err != nil {
+		t.Fatalf("failed to read test PDF: %v", err)
+	}
+	bodies := map[string][]byte{
+		"html":     []byte("<!DOCTYPE html><html><body><p>Hello</p></body></html>"),
+		"pdf":      pdf,
+		"png":      []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+		"markdown": []byte("<!-- generated -->\n# Title\n"),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		w.Write(bodies[r.URL.Query().Get("body")])
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		raw      bool
+		expected *ContentMismatchError
+	}{
+		{name: "HTML", path: "/page.html?type=text/html&body=html"},
+		{name: "PDF", path: "/doc.pdf?type=application/pdf&body=pdf"},
+		{name: "markdown starting like HTML", path: "/README.md?type=text/markdown&body=markdown", raw: true},
+		{
+			name:     "HTML served as PDF",
+			path:     "/doc?type=application/pdf&body=html",
+			expected: &ContentMismatchError{Declared: "application/pdf", Sniffed: "text/html"},
+		},
+		{
+			name:     "image served as HTML",
+			path:     "/?type=text/html%3B+charset=utf-8&body=png",
+			expected: &ContentMismatchError{Declared: "text/html", Sniffed: "image/png"},
+		},
+		{
+			name:     "HTML at a PDF URL",
+			path:     "/doc.PDF?type=text/html&body=html",
+			expected: &ContentMismatchError{Declared: "text/html", Extension: ".pdf", Sniffed: "text/html"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Fetch(context.Background(), server.URL+tt.path, FetchOptions{StrictContentType: true, Raw: tt.raw})
+			if tt.expected == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var mismatch *ContentMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("expected a *ContentMismatchError, got %v", err)
+			}
+			if *mismatch != *tt.expected {
+				t.Errorf("expected %+v, got %+v", *tt.expected, *mismatch)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package webfetch
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// isPlainTextContentType checks if the content type indicates plain text content
+func isPlainTextContentType(contentType string) bool {
+	return strings.Contains(strings.ToLower(contentType), "text/plain")
+}
+
+// isMarkdownContentType checks if the content type indicates Markdown content
+func isMarkdownContentType(contentType string) bool {
+	ct := strings.ToLower(contentType)
+	return strings.Contains(ct, "text/markdown") || strings.Contains(ct, "text/x-markdown")
+}
+
+// isMarkdownPath reports whether the path of a URL names a Markdown file, as
+// served as plain text by raw file hosts
+func isMarkdownPath(p string) bool {
+	ext := strings.ToLower(path.Ext(p))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// blankLines matches the runs of blank lines collapsed by normalizeWhitespace
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// convertText returns the document of a plain text or Markdown body, decoded
+// to UTF-8. Markdown, including plain text served from a .md URL, is returned
+// untouched, with the text of its first level 1 heading as title. Plain text
+// is returned verbatim, or with normalized whitespace when normalize is set.
+func convertText(r io.Reader, contentType string, finalURL *url.URL, normalize bool) (*Document, error) {
+	data, err := io.ReadAll(decodeHTML(r, contentType))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	text := string(data)
+
+	doc := &Document{ContentType: contentType}
+	if isMarkdownContentType(contentType) || isMarkdownPath(finalURL.Path) {
+		doc.Content = text
+		doc.Title = markdownTitle(text)
+		return doc, nil
+	}
+	if normalize {
+		text = normalizeWhitespace(text)
+	}
+	doc.Content = text
+	return doc, nil
+}
+
+// normalizeWhitespace converts the line endings of text to \n, trims the
+// trailing whitespace of its lines and of the text, and collapses runs of
+// blank lines into one.
+func normalizeWhitespace(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\f\v")
+	}
+	text = strings.Join(lines, "\n")
+	return strings.Trim(blankLines.ReplaceAllString(text, "\n\n"), "\n")
+}
+
+// markdownTitle returns the text of the first level 1 ATX heading of
+// markdown outside code blocks, if any
+func markdownTitle(markdown string) string {
+	inCode := false
+	for line := range strings.Lines(markdown) {
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+			inCode = !inCode
+			continue
+		}
+		if title, ok := strings.CutPrefix(line, "# "); ok && !inCode {
+			return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(title), "#"))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package webfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetch_Text(t *testing.T) {
+	const plain = "Release notes  \r\n\r\n\r\n\r\n- fixed a bug\t\n\n\n"
+	const markdown = "```\n# not a title\n```\n\n# Guide #\n\nSome  text  \n\n\n\nEnd\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		if r.URL.Query().Get("body") == "markdown" {
+			w.Write([]byte(markdown))
+			return
+		}
+		w.Write([]byte(plain))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		path          string
+		normalize     bool
+		expected      string
+		expectedTitle string
+	}{
+		{name: "plain text", path: "/notes.txt?type=text/plain", expected: plain},
+		{name: "plain text normalized", path: "/notes.txt?type=text/plain%3B+charset=utf-8", normalize: true, expected: "Release notes\n\n- fixed a bug"},
+		{name: "markdown", path: "/guide?type=text/markdown&body=markdown", normalize: true, expected: markdown, expectedTitle: "Guide"},
+		{name: "markdown URL", path: "/README.md?type=text/plain&body=markdown", normalize: true, expected: markdown, expectedTitle: "Guide"},
+		{name: "legacy markdown type", path: "/guide?type=text/x-markdown&body=markdown", expected: markdown, expectedTitle: "Guide"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Fetch(context.Background(), server.URL+tt.path, FetchOptions{Timeout: 5 * time.Second, NormalizeWhitespace: tt.normalize})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if doc.Content != tt.expected || doc.Title != tt.expectedTitle {
+				t.Errorf("expected %q titled %q, got %q titled %q", tt.expected, tt.expectedTitle, doc.Content, doc.Title)
+			}
+		})
+	}
+}
+
+func Test_markdownTitle(t *testing.T) {
+	tests := []struct {
+		markdown string
+		expected string
+	}{
+		{"# Title\n\nText", "Title"},
+		{"Intro\n\n## Section\n\n# Title ##\n", "Title"},
+		{"~~~\n# code\n~~~\n#Hashtag\n", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := markdownTitle(tt.markdown); got != tt.expected {
+			t.Errorf("markdownTitle(%q): expected %q, got %q", tt.markdown, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBodyReadTimeout is returned when the server sends no part of the
+// response body within FetchOptions.BodyReadTimeout. The download resumes, as
+// for a broken connection, if the server supports byte ranges.
+var ErrBodyReadTimeout = errors.New("timed out waiting for the response body")
+
+// stallTimeoutBody reads a response body, cancelling its request when a read
+// waits longer than timeout, which unblocks it
+type stallTimeoutBody struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	stalled atomic.Bool
+}
+
+// withBodyReadTimeout returns body, whose request is cancelled by cancel,
+// failing with ErrBodyReadTimeout when a read waits longer than timeout. It
+// returns body as is if timeout is not positive.
+func withBodyReadTimeout(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) io.ReadCloser {
+	if timeout <= 0 {
+		return body
+	}
+	b := &stallTimeoutBody{body: body, timeout: timeout}
+	b.timer = time.AfterFunc(timeout, func() {
+		b.stalled.Store(true)
+		cancel()
+	})
+	b.timer.Stop()
+	return b
+}
+
+func (b *stallTimeoutBody) Read(p []byte) (int, error) {
+	if b.stalled.Load() {
+		return 0, ErrBodyReadTimeout
+	}
+	b.timer.Reset(b.timeout)
+	n, err := b.body.Read(p)
+	// A read that returned as the timer fired is not reported as stalled
+	if b.timer.Stop() || err == nil || err == io.EOF {
+		return n, err
+	}
+	return n, ErrBodyReadTimeout
+}
+
+// Close closes the body and stops the timer
+func (b *stallTimeoutBody) Close() error {
+	b.timer.Stop()
+	return b.body.Close()
+}
@@ -0,0 +1,177 @@
+package webfetch
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetch_PhaseTimeouts(t *testing.T) {
+	page := []byte("<html><body><p>" + strings.Repeat("Lorem ipsum dolor sit amet. ", 500) + "END</p></body></html>")
+
+	// stall sends the first half of the page, then nothing until the request
+	// is cancelled; byte ranges are served in full
+	stall := func(acceptRanges bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("ETag", `"v1"`)
+			if acceptRanges {
+				w.Header().Set("Accept-Ranges", "bytes")
+			}
+			if r.Header.Get("Range") != "" {
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(page))
+				return
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(page)))
+			w.Write(page[:len(page)/2])
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}
+
+	tests := []struct {
+		name            string
+		opts            FetchOptions
+		setup           func(t *testing.T, opts *FetchOptions) string
+		expectedErr     string
+		expectedResumes int
+	}{
+		{
+			name: "connect",
+			opts: FetchOptions{ConnectTimeout: 100 * time.Millisecond},
+			setup: func(t *testing.T, opts *FetchOptions) string {
+				// The DNS server never answers
+				conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatalf("failed to listen: %v", err)
+				}
+				t.Cleanup(func() { conn.Close() })
+				opts.Resolver = &Resolver{Servers: []string{conn.LocalAddr().String()}}
+				return "http://app.internal/"
+			},
+			expectedErr: "lookup app.internal",
+		},
+		{
+			name: "tls handshake",
+			opts: FetchOptions{TLSHandshakeTimeout: 100 * time.Millisecond},
+			setup: func(t *testing.T, _ *FetchOptions) string {
+				// The server accepts connections but never answers
+				ln, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatalf("failed to listen: %v", err)
+				}
+				accepted := make(chan net.Conn, 1)
+				go func() {
+					if conn, err := ln.Accept(); err == nil {
+						accepted <- conn
+					}
+				}()
+				t.Cleanup(func() {
+					ln.Close()
+					select {
+					case conn := <-accepted:
+						conn.Close()
+					default:
+					}
+				})
+				return "https://" + ln.Addr().String() + "/"
+			},
+			expectedErr: "TLS handshake timeout",
+		},
+		{
+			name: "response headers",
+			opts: FetchOptions{ResponseHeaderTimeout: 100 * time.Millisecond},
+			setup: func(t *testing.T, _ *FetchOptions) string {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					select {
+					case <-r.Context().Done():
+					case <-time.After(5 * time.Second):
+					}
+				}))
+				t.Cleanup(server.Close)
+				return server.URL
+			},
+			expectedErr: "timeout awaiting response headers",
+		},
+		{
+			name: "body stalled",
+			opts: FetchOptions{BodyReadTimeout: 100 * time.Millisecond},
+			setup: func(t *testing.T, _ *FetchOptions) string {
+				server := httptest.NewServer(stall(false))
+				t.Cleanup(server.Close)
+				return server.URL
+			},
+			expectedErr: ErrBodyReadTimeout.Error(),
+		},
+		{
+			name: "body stalled and resumed",
+			opts: FetchOptions{BodyReadTimeout: 100 * time.Millisecond},
+			setup: func(t *testing.T, _ *FetchOptions) string {
+				server := httptest.NewServer(stall(true))
+				t.Cleanup(server.Close)
+				return server.URL
+			},
+			expectedResumes: 1,
+		},
+		{
+			name: "body streamed slowly",
+			opts: FetchOptions{BodyReadTimeout: 200 * time.Millisecond},
+			setup: func(t *testing.T, _ *FetchOptions) string {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "text/html")
+					chunk := len(page)/8 + 1
+					for i := 0; i < len(page); i += chunk {
+						w.Write(page[i:min(i+chunk, len(page))])
+						w.(http.Flusher).Flush()
+						time.Sleep(50 * time.Millisecond)
+					}
+				}))
+				t.Cleanup(server.Close)
+				return server.URL
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Timeout = 5 * time.Second
+			url := tt.setup(t, &opts)
+			var info FetchInfo
+			opts.OnFetch = func(i FetchInfo) { info = i }
+
+			start := time.Now()
+			doc, err := Fetch(context.Background(), url, opts)
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("expected the phase timeout to end the fetch, got %v", elapsed)
+			}
+			if tt.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+					t.Fatalf("expected an error containing %q, got %v", tt.expectedErr, err)
+				}
+				if ClassifyError(err) != ErrorTransient {
+					t.Errorf("expected a transient error, got %s", ClassifyError(err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.HasSuffix(strings.TrimSpace(doc.Content), "END") {
+				t.Errorf("expected the whole page, got %d characters", len(doc.Content))
+			}
+			if info.Resumes != tt.expectedResumes {
+				t.Errorf("expected %d resumes, got %d", tt.expectedResumes, info.Resumes)
+			}
+		})
+	}
+}
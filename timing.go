@@ -0,0 +1,81 @@
+package webfetch
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings breaks down the duration of a fetch. Phases that did not happen, such
+// as DNS resolution on a reused connection, are zero.
+type Timings struct {
+	// DNS is the time spent resolving the host name.
+	DNS time.Duration
+	// Connect is the time spent establishing the TCP connection.
+	Connect time.Duration
+	// TLS is the time spent in the TLS handshake.
+	TLS time.Duration
+	// TTFB is the time from starting the request to the first response byte.
+	TTFB time.Duration
+	// Read is the time spent reading the response body.
+	Read time.Duration
+	// Convert is the time spent converting the response, excluding reading it.
+	Convert time.Duration
+}
+
+// fetchTrace collects connection timings from an httptrace.ClientTrace. Dial
+// callbacks may run concurrently, hence the mutex.
+type fetchTrace struct {
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	timings      Timings
+}
+
+func newFetchTrace() *fetchTrace {
+	return &fetchTrace{start: time.Now()}
+}
+
+// clientTrace returns the hooks recording into t
+func (t *fetchTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.add(&t.timings.DNS, &t.dnsStart) },
+		ConnectStart: func(string, string) {
+			t.mark(&t.connectStart)
+		},
+		ConnectDone: func(string, string, error) {
+			t.add(&t.timings.Connect, &t.connectStart)
+		},
+		TLSHandshakeStart: func() { t.mark(&t.tlsStart) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.add(&t.timings.TLS, &t.tlsStart)
+		},
+		GotFirstResponseByte: func() {
+			// Measured from the start, so only the last redirect hop counts
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timings.TTFB = time.Since(t.start)
+		},
+	}
+}
+
+// mark records the current time in at
+func (t *fetchTrace) mark(at *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*at = time.Now()
+}
+
+// add adds the time elapsed since start to d. Phases repeated across redirects
+// accumulate.
+func (t *fetchTrace) add(d *time.Duration, start *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !start.IsZero() {
+		*d += time.Since(*start)
+	}
+}
@@ -0,0 +1,177 @@
+package webfetch
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// TrackingParams lists the query parameters removed when canonicalizing with tracking
+// stripping enabled, unless FetchOptions.TrackingParams is set. Entries ending in
+// "*" match any parameter with that prefix.
+var TrackingParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"dclid",
+	"gbraid",
+	"wbraid",
+	"msclkid",
+	"yclid",
+	"mc_cid",
+	"mc_eid",
+	"igshid",
+	"_ga",
+	"_gl",
+	"_hsenc",
+	"_hsmi",
+}
+
+// defaultPorts maps schemes to the port implied when none is given
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// CanonicalizeURL normalizes rawURL so that cosmetic variants of the same address
+// compare equal: the scheme and host are lowercased, default ports are removed, dot
+// segments are resolved, an empty path becomes "/" and the userinfo and fragment
+// are dropped. Escaped characters of the path, such as %2F, and duplicate slashes
+// are kept, as servers may tell them apart.
+// When stripTracking is set, the query parameters listed in TrackingParams are removed too.
+func CanonicalizeURL(rawURL string, stripTracking bool) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid URL: missing scheme or host")
+	}
+	var trackingParams []string
+	if stripTracking {
+		trackingParams = TrackingParams
+	}
+	return canonicalURL(u, trackingParams).String(), nil
+}
+
+// canonicalURL returns a canonicalized copy of u (see CanonicalizeURL), without
+// the query parameters matching trackingParams.
+func canonicalURL(u *url.URL, trackingParams []string) *url.URL {
+	c := *u
+	c.User = nil
+	c.Scheme = strings.ToLower(c.Scheme)
+	c.Fragment = ""
+	c.RawFragment = ""
+
+	// Lowercase host and drop the port when it is the scheme's default
+	host := strings.ToLower(c.Hostname())
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6 literal
+	}
+	if port := c.Port(); port != "" && port != defaultPorts[c.Scheme] {
+		host += ":" + port
+	}
+	c.Host = host
+
+	// Resolve dot segments of the escaped path, so that escaped slashes stay
+	// escaped, keeping empty segments and trailing slashes, which servers may
+	// tell apart
+	escaped := c.EscapedPath()
+	if !strings.HasPrefix(escaped, "/") {
+		escaped = "/" + escaped
+	}
+	escaped = removeDotSegments(escaped)
+	if unescaped, err := url.PathUnescape(escaped); err == nil {
+		c.Path = unescaped
+		c.RawPath = escaped
+	}
+
+	if len(trackingParams) > 0 && c.RawQuery != "" {
+		c.RawQuery = stripTrackingParams(c.RawQuery, trackingParams)
+	}
+	c.ForceQuery = false
+
+	return &c
+}
+
+// removeDotSegments resolves the "." and ".." segments of the absolute path p
+// as in RFC 3986, section 5.2.4
+func removeDotSegments(p string) string {
+	segments := strings.Split(p, "/")[1:]
+	kept := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		switch segment {
+		case ".":
+		case "..":
+			if len(kept) > 0 {
+				kept = kept[:len(kept)-1]
+			}
+		default:
+			kept = append(kept, segment)
+			continue
+		}
+		// A final dot segment names a directory
+		if i == len(segments)-1 {
+			kept = append(kept, "")
+		}
+	}
+	return "/" + strings.Join(kept, "/")
+}
+
+// trackingParams returns the tracking parameter patterns of opts
+func trackingParams(opts FetchOptions) []string {
+	if opts.TrackingParams != nil {
+		return opts.TrackingParams
+	}
+	return TrackingParams
+}
+
+// stripTrackingURL returns a copy of u without the query parameters matching
+// patterns, and u itself if it has none.
+func stripTrackingURL(u *url.URL, patterns []string) *url.URL {
+	if u.RawQuery == "" {
+		return u
+	}
+	query := stripTrackingParams(u.RawQuery, patterns)
+	if query == u.RawQuery {
+		return u
+	}
+	c := *u
+	c.RawQuery = query
+	return &c
+}
+
+// stripTrackingParams removes the parameters matching patterns from rawQuery,
+// preserving the order and encoding of the remaining parameters.
+func stripTrackingParams(rawQuery string, patterns []string) string {
+	var kept []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if !isTrackingParam(name, patterns) {
+			kept = append(kept, param)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+// isTrackingParam reports whether the query parameter name matches one of patterns.
+func isTrackingParam(name string, patterns []string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
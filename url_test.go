@@ -0,0 +1,112 @@
+package webfetch
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCanonicalizeURL(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		stripTracking bool
+		expected      string
+	}{
+		{
+			name:     "lowercases scheme and host",
+			url:      "HTTPS://Example.COM/Docs",
+			expected: "https://example.com/Docs",
+		},
+		{
+			name:     "strips default http port",
+			url:      "http://example.com:80/a",
+			expected: "http://example.com/a",
+		},
+		{
+			name:     "strips default https port",
+			url:      "https://example.com:443/a",
+			expected: "https://example.com/a",
+		},
+		{
+			name:     "keeps non-default port",
+			url:      "https://example.com:8443/a",
+			expected: "https://example.com:8443/a",
+		},
+		{
+			name:     "resolves dot segments",
+			url:      "https://example.com/a/./b/../c",
+			expected: "https://example.com/a/c",
+		},
+		{
+			name:     "keeps trailing slash",
+			url:      "https://example.com/a/b/../",
+			expected: "https://example.com/a/",
+		},
+		{
+			name:     "resolves final dot segment",
+			url:      "https://example.com/a/b/..",
+			expected: "https://example.com/a/",
+		},
+		{
+			name:     "keeps escaped slashes",
+			url:      "https://example.com/repos/a%2Fb/../c%2Fd",
+			expected: "https://example.com/repos/c%2Fd",
+		},
+		{
+			name:     "keeps duplicate slashes",
+			url:      "https://example.com/a//b/./c",
+			expected: "https://example.com/a//b/c",
+		},
+		{
+			name:     "adds root path",
+			url:      "https://example.com",
+			expected: "https://example.com/",
+		},
+		{
+			name:     "drops fragment",
+			url:      "https://example.com/a#section",
+			expected: "https://example.com/a",
+		},
+		{
+			name:     "keeps tracking params by default",
+			url:      "https://example.com/a?utm_source=x&id=1",
+			expected: "https://example.com/a?utm_source=x&id=1",
+		},
+		{
+			name:          "strips tracking params",
+			url:           "https://example.com/a?utm_source=x&id=1&fbclid=abc&UTM_Medium=y",
+			stripTracking: true,
+			expected:      "https://example.com/a?id=1",
+		},
+		{
+			name:          "drops empty query after stripping",
+			url:           "https://example.com/a?gclid=abc",
+			stripTracking: true,
+			expected:      "https://example.com/a",
+		},
+		{
+			name:     "IPv6 host",
+			url:      "http://[::1]:80/a",
+			expected: "http://[::1]/a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := CanonicalizeURL(tt.url, tt.stripTracking)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("CanonicalizeURL(%q) = %q, want %q", tt.url, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeURL_Invalid(t *testing.T) {
+	_, err := CanonicalizeURL("example.com/page", false)
+	if err == nil || !strings.Contains(err.Error(), "missing scheme or host") {
+		t.Errorf("expected missing scheme or host error, got %v", err)
+	}
+}